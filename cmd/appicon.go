@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/appicon"
+	"nim/pkg/image"
+)
+
+var (
+	appiconOutput            string
+	appiconPlatforms         string
+	appiconIOSBackground     string
+	appiconIOSPadding        float64
+	appiconAndroidBackground string
+	appiconAndroidPadding    float64
+)
+
+var appiconCmd = &cobra.Command{
+	Use:   "appicon [input]",
+	Short: "Generate iOS and Android app icon sets",
+	Long: `Generate complete app icon sets from a single source image, ideally
+1024x1024 pixels or an SVG:
+
+  ios/AppIcon.appiconset   every iPhone, iPad and App Store size with Contents.json,
+                           ready to drop into an Xcode asset catalog
+  android/res              legacy square and round icons and adaptive icon
+                           foregrounds for every mipmap density, the adaptive icon
+                           definitions and the background color resource
+
+Padding is the fraction of the icon left free on each side. iOS icons are
+always opaque, so transparent areas take the iOS background color, and a
+translucent background color is flattened onto white. Android adaptive icon
+foregrounds always keep the image inside the 66dp safe zone.`,
+	Example: `  nim appicon icon.png -o icons
+  nim appicon logo.svg -o icons --platform android --android-background "#3DDC84" --android-padding 0.15`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var platforms []string
+		for _, platform := range strings.Split(appiconPlatforms, ",") {
+			platform = strings.ToLower(strings.TrimSpace(platform))
+			if platform != "ios" && platform != "android" {
+				return fmt.Errorf("invalid platform: %s (expected ios or android)", platform)
+			}
+			platforms = append(platforms, platform)
+		}
+
+		iosOptions, err := appiconOptions(appiconIOSBackground, appiconIOSPadding)
+		if err != nil {
+			return fmt.Errorf("invalid iOS options: %w", err)
+		}
+		androidOptions, err := appiconOptions(appiconAndroidBackground, appiconAndroidPadding)
+		if err != nil {
+			return fmt.Errorf("invalid Android options: %w", err)
+		}
+
+		// Vector sources are rendered at the largest icon size
+		options := image.DefaultOptions()
+		options.Width, options.Height = 1024, 1024
+		start := time.Now()
+		src, err := image.OpenImageWithOptions(args[0], options)
+		if err != nil {
+			return fmt.Errorf("failed to open image: %w", err)
+		}
+
+		if slices.Contains(platforms, "ios") {
+			dir, err := appicon.GenerateIOS(src, filepath.Join(appiconOutput, "ios"), iosOptions)
+			if err != nil {
+				return err
+			}
+			if err := recordDir(args[0], dir, start); err != nil {
+				return err
+			}
+			printf("iOS icon set created successfully: %s\n", dir)
+		}
+		if slices.Contains(platforms, "android") {
+			dir, err := appicon.GenerateAndroid(src, filepath.Join(appiconOutput, "android"), androidOptions)
+			if err != nil {
+				return err
+			}
+			if err := recordDir(args[0], dir, start); err != nil {
+				return err
+			}
+			printf("Android icons created successfully: %s\n", dir)
+		}
+		return nil
+	},
+}
+
+// recordDir adds every file of a generated icon folder to the --json output
+func recordDir(input, dir string, start time.Time) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		return recordFile([]string{input}, path, start)
+	})
+}
+
+// appiconOptions parses the background color and padding of one platform.
+// Icons are opaque, so a translucent color is flattened onto white.
+func appiconOptions(background string, padding float64) (appicon.Options, error) {
+	c, err := image.ParseHexColor(background)
+	if err != nil {
+		return appicon.Options{}, err
+	}
+	if padding < 0 || padding >= 0.5 {
+		return appicon.Options{}, fmt.Errorf("invalid padding: %g (expected at least 0 and less than 0.5)", padding)
+	}
+	return appicon.Options{
+		Background: image.FlattenColor(c),
+		Padding:    padding,
+	}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(appiconCmd)
+
+	appiconCmd.Flags().StringVarP(&appiconOutput, "output", "o", ".", "Output folder")
+	appiconCmd.Flags().StringVar(&appiconPlatforms, "platform", "ios,android", "Comma-separated platforms to generate icons for (ios, android)")
+	appiconCmd.Flags().StringVar(&appiconIOSBackground, "ios-background", "#FFFFFF", "Background color of iOS icons (hex, rgb() or a CSS color name)")
+	appiconCmd.Flags().Float64Var(&appiconIOSPadding, "ios-padding", 0, "Padding of iOS icons as a fraction of the icon size")
+	appiconCmd.Flags().StringVar(&appiconAndroidBackground, "android-background", "#FFFFFF", "Background color of Android icons and the adaptive icon background layer (hex, rgb() or a CSS color name)")
+	appiconCmd.Flags().Float64Var(&appiconAndroidPadding, "android-padding", 0.1, "Padding of legacy Android icons as a fraction of the icon size")
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	stdimage "image"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"nim/pkg/archive"
+	"nim/pkg/batch"
+	"nim/pkg/image"
+)
+
+// processArchive processes every image in the input archive, one entry at a
+// time. The results go into a new archive when the output file has a zip or
+// tar extension, or into the output directory otherwise, keeping the paths
+// of the entries. Entries that are not images are skipped, and entries that
+// fail are skipped or retried as policy says. It returns the number of images
+// processed.
+func processArchive(options image.ProcessOptions, formats []string, policy batch.Policy) (int, error) {
+	start := time.Now()
+	readable := image.ReadableExtensions()
+
+	// write saves one processed entry under name
+	var write func(img *stdimage.NRGBA, name string, options image.ProcessOptions, src source) error
+	var out *archive.Writer
+	outPath := outputFile
+	if archive.IsArchive(outputFile) {
+		resolved, ok, err := resolveOutput(outputFile, inputFile)
+		if err != nil || !ok {
+			return 0, err
+		}
+		if out, err = archive.Create(resolved); err != nil {
+			return 0, err
+		}
+		defer out.Close()
+		if reproducible {
+			if out.Modified, err = sourceDate(); err != nil {
+				return 0, err
+			}
+		}
+		outPath = resolved
+		write = func(img *stdimage.NRGBA, name string, options image.ProcessOptions, _ source) error {
+			options, err := image.AutoQuality(img, name, options)
+			if err != nil {
+				return err
+			}
+			fitted, options, err := image.FitBytes(img, name, options)
+			if err != nil {
+				return err
+			}
+			options.OutputFormat = strings.TrimPrefix(path.Ext(name), ".")
+			return out.Add(name, func(w io.Writer) error {
+				return image.Encode(w, fitted, options)
+			})
+		}
+	} else {
+		write = func(img *stdimage.NRGBA, name string, options image.ProcessOptions, src source) error {
+			file := filepath.Join(outputFile, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+				return fmt.Errorf("failed to create output directory: %w", err)
+			}
+			_, err := saveImage(img, file, options, src)
+			return err
+		}
+	}
+
+	count := 0
+	runner := batch.Runner{Policy: policy}
+	err := archive.Walk(inputFile, func(name string, r io.Reader) error {
+		ext := strings.ToLower(path.Ext(name))
+		if !slices.Contains(readable, strings.TrimPrefix(ext, ".")) {
+			slog.Debug("skipping archive entry", "entry", name, "reason", "not an image")
+			return nil
+		}
+		defer options.Hooks.Start(name)()
+
+		start := time.Now()
+		file := inputFile + "/" + name
+		tmp, err := extractEntry(name, r)
+		if err != nil {
+			return runner.Fail(file, err)
+		}
+		defer os.Remove(tmp)
+		return runner.Do(file, func() error {
+			img, err := image.OpenImageWithOptions(tmp, options)
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %w", name, err)
+			}
+			src := source{file, img, start}
+			result, options, err := transform(src.img, options)
+			if err != nil {
+				return err
+			}
+			for _, format := range formats {
+				entry := name
+				if format != "" {
+					entry = strings.TrimSuffix(name, path.Ext(name)) + "." + format
+				}
+				options.OutputFormat = format
+				if err := write(result, entry, options, src); err != nil {
+					return fmt.Errorf("failed to write %s: %w", entry, err)
+				}
+			}
+			count++
+			return nil
+		})
+	})
+	if err != nil {
+		return count, err
+	}
+	if runner.Total() == 0 {
+		return 0, fmt.Errorf("no images found in %s", inputFile)
+	}
+
+	if out != nil {
+		if err := out.Close(); err != nil {
+			return count, err
+		}
+		if err := recordFile([]string{inputFile}, outPath, start); err != nil {
+			return count, err
+		}
+	}
+	return count, runner.Err()
+}
+
+// extractEntry copies an archive entry to a temporary file, so every format
+// decodes the same way as from disk and only one entry is held in memory at
+// a time. It returns the path of the file, which the caller removes.
+func extractEntry(name string, r io.Reader) (string, error) {
+	tmp, err := os.CreateTemp("", "nim-*"+path.Ext(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	return tmp.Name(), nil
+}
+
+// sourceDate returns the time --reproducible records in archives:
+// $SOURCE_DATE_EPOCH, as build systems set it, or the earliest time a zip
+// archive can hold
+func sourceDate() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH: %s (expected seconds since 1970)", epoch)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
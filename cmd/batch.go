@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/batch"
+	"nim/pkg/image"
+)
+
+var batchResume string
+
+// resumed is the journal of the run nim batch --resume continues
+var resumed *batch.Journal
+
+var batchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "Resume an interrupted --files-from run from its journal",
+	Long: `Continue a --files-from run that was interrupted, by a crash, a power loss
+or ctrl-C, from the journal it kept with --journal.
+
+The run starts again with the same command line, in the same folder, and
+skips the files the journal recorded as completed, as long as their outputs
+are still on disk with the size and xxHash they were written with; files
+whose outputs changed or disappeared are converted again, replacing the
+outputs the journal recorded whatever the overwrite policy. Outputs of the
+files the journal does not list follow the policy of the run, so with
+--no-overwrite an output written just before the interruption, but not yet
+recorded, fails until it is removed. Files that complete are added to the same journal, so
+a run can be resumed as many times as needed.`,
+	Example: `  nim --files-from photos.txt "avif/{name}.avif" --journal photos.journal
+  nim batch --resume photos.journal`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if batchResume == "" {
+			return usageErrorf("--resume is required")
+		}
+		journal, err := batch.OpenJournal(batchResume)
+		if err != nil {
+			return err
+		}
+		defer journal.Close()
+
+		wd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+		if err := os.Chdir(journal.Dir); err != nil {
+			return fmt.Errorf("failed to enter %s: %w", journal.Dir, err)
+		}
+		defer os.Chdir(wd)
+
+		resumed = journal
+		defer func() { resumed = nil }()
+		// The operations run in the order of the flags of the journal
+		prev := commandArgs
+		commandArgs = journal.Args
+		defer func() { commandArgs = prev }()
+		return runRoot(journal.Args)
+	},
+}
+
+// runRoot runs the root command with args as its command line, the way
+// cobra would, within the current run
+func runRoot(args []string) error {
+	if err := rootCmd.ParseFlags(args); err != nil {
+		return err
+	}
+	if err := rootCmd.ValidateFlagGroups(); err != nil {
+		return err
+	}
+	args = rootCmd.Flags().Args()
+	if err := rootCmd.ValidateArgs(args); err != nil {
+		return err
+	}
+	for _, run := range []func(*cobra.Command, []string) error{rootCmd.PersistentPreRunE, rootCmd.RunE, rootCmd.PostRunE} {
+		if err := run(rootCmd, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openListJournal returns the journal of a --files-from run: the one nim
+// batch resumes, a new one for --journal, or nil. The caller closes a new
+// journal.
+func openListJournal() (journal *batch.Journal, created bool, err error) {
+	if resumed != nil {
+		return resumed, false, nil
+	}
+	if journalFile == "" {
+		return nil, false, nil
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	journal, err = batch.CreateJournal(journalFile, runArgs(), dir)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, false, fmt.Errorf("%w: continue its run with nim batch --resume %s, or remove it to start again", err, journalFile)
+	}
+	return journal, err == nil, err
+}
+
+// recordJournal records an entry of a --files-from run as completed, with the
+// outputs written for it
+func recordJournal(journal *batch.Journal, entry batch.Entry, results []jsonResult) error {
+	if journal == nil {
+		return nil
+	}
+	var written []batch.JournalOutput
+	for _, r := range results {
+		if r.Skipped {
+			continue
+		}
+		o := batch.JournalOutput{Path: r.Output, Size: r.Bytes, XXHash: r.Hash}
+		if journalHash() == image.HashSHA256 {
+			o.XXHash, o.SHA256 = "", r.Hash
+		}
+		written = append(written, o)
+	}
+	return journal.Record(entry.Input, entry.Output, written)
+}
+
+// journalHash returns the hash computed of each output while it is written:
+// the one of --hash, or else the xxHash a journal records outputs with
+func journalHash() string {
+	if hashAlgo == "" && filesFrom != "" && (journalFile != "" || resumed != nil) {
+		return image.HashXXHash
+	}
+	return strings.ToLower(hashAlgo)
+}
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+
+	batchCmd.Flags().StringVar(&batchResume, "resume", "", "Journal of the run to resume, written by --journal")
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	stdimage "image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+	"nim/pkg/batch"
+	"nim/pkg/daemon"
+)
+
+func TestBatchResumeOperationOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPNG(t, filepath.Join(dir, "a.png"), 1000, 1000)
+	writeTestPNG(t, filepath.Join(dir, "b.png"), 1000, 1000)
+	if err := os.WriteFile(filepath.Join(dir, "list.txt"), []byte("a.png\nb.png\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "out"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A run interrupted after a.png: its output is recorded, b.png is left
+	args := []string{"--files-from", "list.txt", "out/{name}.png", "-s", "800x800", "--crop", "400x400+0+0", "--journal", "run.journal"}
+	journal, err := batch.CreateJournal(filepath.Join(dir, "run.journal"), args, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestPNG(t, filepath.Join(dir, "out", "a.png"), 10, 10)
+	if err := journal.Record("a.png", "out/a.png", []batch.JournalOutput{journalOutput(t, dir, "out/a.png")}); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+
+	var stdout, stderr bytes.Buffer
+	if code := runJob(daemon.Request{Args: []string{"batch", "--resume", "run.journal"}, Dir: dir}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Resume failed with %d: %s", code, stderr.String())
+	}
+
+	// The resumed run resizes, then crops, as the journal's flags say
+	if got := pngSize(t, filepath.Join(dir, "out", "b.png")); got != stdimage.Pt(400, 400) {
+		t.Errorf("Expected 400x400 for b.png, got %v", got)
+	}
+	if got := pngSize(t, filepath.Join(dir, "out", "a.png")); got != stdimage.Pt(10, 10) {
+		t.Errorf("Expected the completed a.png to be skipped, got %v", got)
+	}
+}
+
+func TestBatchResumeOverwritePolicy(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPNG(t, filepath.Join(dir, "a.png"), 20, 10)
+	writeTestPNG(t, filepath.Join(dir, "b.png"), 20, 10)
+	if err := os.WriteFile(filepath.Join(dir, "list.txt"), []byte("a.png\nb.png\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A --no-overwrite run records a.png, hashed as it is written, then b.png
+	// fails on an output that is in the way
+	writeTestPNG(t, filepath.Join(dir, "b.out.png"), 5, 5)
+	args := []string{"--files-from", "list.txt", "{name}.out.png", "-s", "10x5", "--no-overwrite", "--journal", "run.journal"}
+	var stdout, stderr bytes.Buffer
+	if code := runJob(daemon.Request{Args: args, Dir: dir}, &stdout, &stderr); code == 0 {
+		t.Fatalf("Expected the existing b.out.png to fail the run")
+	}
+	t.Chdir(dir)
+	journal, err := batch.OpenJournal("run.journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !journal.Completed("a.png", "a.out.png") || journal.Completed("b.png", "b.out.png") {
+		t.Errorf("Expected only a.png to be recorded")
+	}
+	journal.Close()
+
+	// On resume the changed output of a.png, which the journal recorded, is
+	// replaced, while b.out.png still is not
+	writeTestPNG(t, filepath.Join(dir, "a.out.png"), 5, 5)
+	stdout.Reset()
+	stderr.Reset()
+	if code := runJob(daemon.Request{Args: []string{"batch", "--resume", "run.journal"}, Dir: dir}, &stdout, &stderr); code == 0 {
+		t.Fatalf("Expected the existing b.out.png to fail the resumed run")
+	}
+	if got := pngSize(t, filepath.Join(dir, "a.out.png")); got != stdimage.Pt(10, 5) {
+		t.Errorf("Expected a.out.png to be converted again, got %v", got)
+	}
+	if got := pngSize(t, filepath.Join(dir, "b.out.png")); got != stdimage.Pt(5, 5) {
+		t.Errorf("Expected b.out.png to be kept, got %v", got)
+	}
+}
+
+func TestFilesFromMakesOutputFolders(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPNG(t, filepath.Join(dir, "a.png"), 20, 10)
+	if err := os.WriteFile(filepath.Join(dir, "list.txt"), []byte("a.png\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"--files-from", "list.txt", "new/folder/{name}.png", "-s", "10x5"}
+	if code := runJob(daemon.Request{Args: args, Dir: dir}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Failed with %d: %s", code, stderr.String())
+	}
+	if got := pngSize(t, filepath.Join(dir, "new", "folder", "a.png")); got != stdimage.Pt(10, 5) {
+		t.Errorf("Expected 10x5, got %v", got)
+	}
+}
+
+// journalOutput returns the journal output of the file at path in dir
+func journalOutput(t *testing.T, dir, path string) batch.JournalOutput {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return batch.JournalOutput{Path: path, Size: int64(len(data)), XXHash: fmt.Sprintf("%016x", xxhash.Sum64(data))}
+}
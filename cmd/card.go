@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/card"
+	"nim/pkg/colorparse"
+	"nim/pkg/image"
+)
+
+var (
+	cardTemplate   string
+	cardTitle      string
+	cardSubtitle   string
+	cardLogo       string
+	cardBackground string
+)
+
+var cardCmd = &cobra.Command{
+	Use:   "card <output>",
+	Short: "Render a social card from a template",
+	Long: `Render an Open Graph or Twitter card, 1200x630 by default, with a title and a
+subtitle over a background image, gradient or color, and a logo in a corner.
+Static site generators can call it for each page with the same template and
+the page title.
+
+A template is a YAML or JSON file; paths in it are relative to the file:
+
+  width: 1200
+  height: 630
+  padding: 80
+  align: left            # or center
+  background:
+    image: bg.jpg        # covers the card
+    dim: 0.4             # darkens the image to keep text legible
+    gradient: ["#1E3A8A", "#0F172A"]
+    angle: 45            # degrees, 0 from left to right
+    color: "#0F172A"
+  title:
+    text: Default title
+    font: Inter-Bold.ttf # TrueType or OpenType; Go Bold by default
+    size: 72             # pixels
+    color: "#FFFFFF"
+    max_lines: 3         # longer titles shrink, then end with an ellipsis
+  subtitle:
+    size: 36
+    color: "#CBD5E1"
+    max_lines: 2
+  logo:
+    image: logo.png
+    width: 160
+    position: bottom-right
+
+The flags override the template.`,
+	Example: `  nim card og.png --title "Release notes for 2.0"
+  nim card public/og/hello.jpg --template card.yaml --title "Hello, world" --subtitle "March 3, 2025"
+  nim card og.webp --title "Docs" --background "#FF6B6B,#556270" --logo logo.svg`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		start := time.Now()
+		t := card.Default()
+		if cardTemplate != "" {
+			var err error
+			if t, err = card.Load(cardTemplate); err != nil {
+				return err
+			}
+		}
+		if cmd.Flags().Changed("title") {
+			t.Title.Text = cardTitle
+		}
+		if cmd.Flags().Changed("subtitle") {
+			t.Subtitle.Text = cardSubtitle
+		}
+		if cardLogo != "" {
+			t.Logo.Image = cardLogo
+		}
+		if cardBackground != "" {
+			// A list of colors is a gradient, or a single color; anything
+			// else is an image
+			colors := colorparse.Split(cardBackground, ',')
+			if !slices.ContainsFunc(colors, func(c string) bool {
+				_, err := colorparse.Parse(c)
+				return err != nil
+			}) {
+				t.Background = card.Background{Gradient: colors, Angle: t.Background.Angle}
+			} else {
+				t.Background = card.Background{Image: cardBackground, Dim: t.Background.Dim}
+			}
+		}
+
+		img, err := card.Render(t)
+		if err != nil {
+			return err
+		}
+		_, err = saveImage(img, args[0], image.DefaultOptions(), source{cardTemplate, img, start})
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cardCmd)
+
+	cardCmd.Flags().StringVar(&cardTemplate, "template", "", "YAML or JSON card template")
+	cardCmd.Flags().StringVar(&cardTitle, "title", "", "Title of the card")
+	cardCmd.Flags().StringVar(&cardSubtitle, "subtitle", "", "Subtitle of the card, such as a date or a description")
+	cardCmd.Flags().StringVar(&cardLogo, "logo", "", "Logo image to put in a corner")
+	cardCmd.Flags().StringVar(&cardBackground, "background", "", "Background image, color (hex, rgb() or a CSS name), or comma-separated gradient colors (e.g., #1E3A8A,navy)")
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	stdimage "image"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/effect"
+	"nim/pkg/image"
+)
+
+var (
+	channelsList  string
+	channelsRed   string
+	channelsGreen string
+	channelsBlue  string
+	channelsAlpha string
+)
+
+var channelsCmd = &cobra.Command{
+	Use:   "channels",
+	Short: "Split images into channels and merge channels into images",
+	Long: `Split an image into its red, green, blue and alpha channels as grayscale
+images, or merge grayscale images into the channels of one, such as the
+roughness, metalness and ambient occlusion maps of a game material packed
+into the RGB of a single texture.`,
+}
+
+var channelsSplitCmd = &cobra.Command{
+	Use:   "split <input> <output>",
+	Short: "Write each channel of an image as a grayscale image",
+	Long: `Write each channel of an image as a grayscale image. {channel} in the output
+name is replaced by r, g, b or a, or -{channel} is added before the
+extension. The alpha channel is written when the image has transparency,
+unless --channels picks the channels.`,
+	Example: `  nim channels split texture.png "texture-{channel}.png"
+  nim channels split photo.jpg planes/photo.png --channels g`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if strings.Trim(strings.ToLower(channelsList), "rgba") != "" || cmd.Flags().Changed("channels") && channelsList == "" {
+			return fmt.Errorf("invalid --channels: %s (expected letters of rgba, e.g., rgb)", channelsList)
+		}
+		src, err := openSource(args[0], image.DefaultOptions())
+		if err != nil {
+			return err
+		}
+		selected := channelsList
+		if selected == "" {
+			selected = "rgb"
+			if opaque, ok := src.img.(interface{ Opaque() bool }); !ok || !opaque.Opaque() {
+				selected = "rgba"
+			}
+		}
+
+		planes := effect.SplitChannels(src.img)
+		var files []string
+		for c, name := range effect.Channels {
+			if !strings.Contains(strings.ToLower(selected), name) {
+				continue
+			}
+			path := expandFilename(args[1], "{channel}", name, "-{channel}")
+			written, err := saveImage(planes[c], path, image.DefaultOptions(), src)
+			if err != nil {
+				return err
+			}
+			files = append(files, written)
+		}
+		printf("Channels split successfully: %s -> %s\n", args[0], strings.Join(files, ", "))
+		return nil
+	},
+}
+
+var channelsMergeCmd = &cobra.Command{
+	Use:   "merge <output>",
+	Short: "Combine grayscale images into the channels of one image",
+	Long: `Combine grayscale images, given with --red, --green, --blue and --alpha,
+into the channels of one image; images in color are read as their
+luminance. Channels without an image are black, or opaque for alpha, and the
+images must all have the same size.`,
+	Example: `  nim channels merge material-orm.png --red ao.png --green roughness.png --blue metalness.png
+  nim channels merge sprite.png --red r.png --green g.png --blue b.png --alpha mask.png`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var planes [4]stdimage.Image
+		var first source
+		for c, path := range []string{channelsRed, channelsGreen, channelsBlue, channelsAlpha} {
+			if path == "" {
+				continue
+			}
+			src, err := openSource(path, image.DefaultOptions())
+			if err != nil {
+				return err
+			}
+			if first.img == nil {
+				first = src
+			}
+			planes[c] = src.img
+		}
+		if first.img == nil {
+			return fmt.Errorf("at least one of --red, --green, --blue and --alpha is required")
+		}
+
+		merged, err := effect.MergeChannels(planes)
+		if err != nil {
+			return err
+		}
+		_, err = saveImage(merged, args[0], image.DefaultOptions(), first)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(channelsCmd)
+	channelsCmd.AddCommand(channelsSplitCmd)
+	channelsCmd.AddCommand(channelsMergeCmd)
+
+	channelsSplitCmd.Flags().StringVar(&channelsList, "channels", "", "Channels to write, as letters of rgba (e.g., rgb or a) (default: rgb, and a when the image has transparency)")
+	channelsMergeCmd.Flags().StringVar(&channelsRed, "red", "", "Grayscale image to use as the red channel")
+	channelsMergeCmd.Flags().StringVar(&channelsGreen, "green", "", "Grayscale image to use as the green channel")
+	channelsMergeCmd.Flags().StringVar(&channelsBlue, "blue", "", "Grayscale image to use as the blue channel")
+	channelsMergeCmd.Flags().StringVar(&channelsAlpha, "alpha", "", "Grayscale image to use as the alpha channel")
+}
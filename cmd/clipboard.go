@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"nim/pkg/image"
+)
+
+// errNoClipboardImage is returned when the clipboard holds no image
+var errNoClipboardImage = errors.New("the clipboard holds no image")
+
+// PowerShell scripts that move a PNG between the Windows clipboard and
+// base64 on stdin or stdout
+const (
+	powershellRead = `Add-Type -AssemblyName System.Windows.Forms, System.Drawing
+$img = [Windows.Forms.Clipboard]::GetImage()
+if ($img -eq $null) { exit 3 }
+$ms = New-Object IO.MemoryStream
+$img.Save($ms, [Drawing.Imaging.ImageFormat]::Png)
+[Console]::Out.Write([Convert]::ToBase64String($ms.ToArray()))`
+	powershellWrite = `Add-Type -AssemblyName System.Windows.Forms, System.Drawing
+$ms = New-Object IO.MemoryStream(,[Convert]::FromBase64String([Console]::In.ReadToEnd()))
+[Windows.Forms.Clipboard]::SetImage([Drawing.Image]::FromStream($ms))`
+)
+
+// readClipboard decodes the image on the system clipboard
+func readClipboard() (stdimage.Image, error) {
+	var data []byte
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		var out []byte
+		out, err = runClipboard(nil, "osascript", "-e", "get the clipboard as «class PNGf»")
+		// The data is printed as «data PNGf89504E47...»
+		text := strings.TrimSpace(string(out))
+		if err != nil || !strings.HasPrefix(text, "«data PNGf") {
+			return nil, errNoClipboardImage
+		}
+		data, err = hex.DecodeString(strings.TrimSuffix(strings.TrimPrefix(text, "«data PNGf"), "»"))
+	case "windows":
+		var out []byte
+		out, err = runClipboard(nil, "powershell", "-NoProfile", "-STA", "-Command", powershellRead)
+		var exit *exec.ExitError
+		if errors.As(err, &exit) && exit.ExitCode() == 3 {
+			return nil, errNoClipboardImage
+		}
+		if err == nil {
+			data, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+		}
+	default:
+		switch {
+		case wayland():
+			data, err = runClipboard(nil, "wl-paste", "--no-newline", "--type", "image/png")
+		case installed("xclip"):
+			data, err = runClipboard(nil, "xclip", "-selection", "clipboard", "-target", "image/png", "-out")
+		default:
+			return nil, fmt.Errorf("clipboard access requires wl-clipboard (Wayland) or xclip (X11) in PATH")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errNoClipboardImage
+	}
+
+	img, _, err := stdimage.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode clipboard image: %w", err)
+	}
+	slog.Info("read clipboard image", "size", fmt.Sprintf("%dx%d", img.Bounds().Dx(), img.Bounds().Dy()), "bytes", len(data))
+	return img, nil
+}
+
+// writeClipboard puts img on the system clipboard as a PNG
+func writeClipboard(img stdimage.Image) error {
+	var buf bytes.Buffer
+	if err := image.Encode(&buf, img, image.ProcessOptions{OutputFormat: "png"}); err != nil {
+		return err
+	}
+	slog.Info("writing clipboard image", "size", fmt.Sprintf("%dx%d", img.Bounds().Dx(), img.Bounds().Dy()), "bytes", buf.Len())
+
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		script := "set the clipboard to «data PNGf" + strings.ToUpper(hex.EncodeToString(buf.Bytes())) + "»"
+		_, err = runClipboard(strings.NewReader(script), "osascript")
+	case "windows":
+		encoded := base64.StdEncoding.EncodeToString(buf.Bytes())
+		_, err = runClipboard(strings.NewReader(encoded), "powershell", "-NoProfile", "-STA", "-Command", powershellWrite)
+	default:
+		switch {
+		case wayland():
+			_, err = runClipboard(&buf, "wl-copy", "--type", "image/png")
+		case installed("xclip"):
+			_, err = runClipboard(&buf, "xclip", "-selection", "clipboard", "-target", "image/png", "-in")
+		default:
+			return fmt.Errorf("clipboard access requires wl-clipboard (Wayland) or xclip (X11) in PATH")
+		}
+	}
+	return err
+}
+
+// wayland reports whether the session is Wayland and wl-clipboard is installed
+func wayland() bool {
+	return os.Getenv("WAYLAND_DISPLAY") != "" && installed("wl-paste") && installed("wl-copy")
+}
+
+// installed reports whether a program is found in PATH
+func installed(program string) bool {
+	_, err := exec.LookPath(program)
+	return err == nil
+}
+
+// runClipboard runs a clipboard tool with stdin, which may be nil, and
+// returns its output
+func runClipboard(stdin io.Reader, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	slog.Debug("running clipboard tool", "program", name)
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
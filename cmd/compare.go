@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/compare"
+	"nim/pkg/image"
+)
+
+var (
+	compareDiff      string
+	compareMetric    string
+	compareThreshold float64
+)
+
+// jsonComparison describes a comparison in --json output
+type jsonComparison struct {
+	Reference     string   `json:"reference"`
+	Candidate     string   `json:"candidate"`
+	PSNR          *float64 `json:"psnr"` // null for identical images
+	SSIM          float64  `json:"ssim"`
+	MeanDiff      float64  `json:"mean_diff"`
+	ChangedPixels int      `json:"changed_pixels"`
+	Pixels        int      `json:"pixels"`
+	Metric        string   `json:"metric,omitempty"`
+	Threshold     *float64 `json:"threshold,omitempty"`
+	Passed        bool     `json:"passed"`
+}
+
+var compareCmd = &cobra.Command{
+	Use:   "compare [reference] [candidate]",
+	Short: "Compare two images with PSNR, SSIM and pixel difference",
+	Long: `Compare two images of the same size and print their PSNR, SSIM (structural
+similarity), mean pixel difference and the share of changed pixels.
+
+With --threshold, the command fails when the chosen --metric is worse than
+the threshold: SSIM or PSNR below it, or a mean difference above it. This
+makes it usable for visual regression tests in CI. --diff writes an image
+with the changed pixels in red over a faded copy of the reference.`,
+	Example: `  nim compare expected.png actual.png
+  nim compare expected.png actual.png --threshold 0.99 --diff diff.png
+  nim compare expected.png actual.png --metric psnr --threshold 40`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		metric := strings.ToLower(compareMetric)
+		switch metric {
+		case "ssim", "psnr", "diff":
+		default:
+			return fmt.Errorf("invalid metric: %s (expected ssim, psnr, or diff)", compareMetric)
+		}
+		checkThreshold := cmd.Flags().Changed("threshold")
+
+		options := image.DefaultOptions()
+		reference, err := openSource(args[0], options)
+		if err != nil {
+			return err
+		}
+		candidate, err := openSource(args[1], options)
+		if err != nil {
+			return err
+		}
+
+		result, err := compare.Compare(reference.img, candidate.img)
+		if err != nil {
+			return err
+		}
+
+		if compareDiff != "" {
+			diff, err := compare.Diff(reference.img, candidate.img)
+			if err != nil {
+				return err
+			}
+			if _, err := saveImage(diff, compareDiff, options, source{args[0], reference.img, time.Now()}); err != nil {
+				return err
+			}
+		}
+
+		passed := true
+		if checkThreshold {
+			switch metric {
+			case "ssim":
+				passed = result.SSIM >= compareThreshold
+			case "psnr":
+				passed = result.PSNR >= compareThreshold
+			case "diff":
+				passed = result.MeanDiff <= compareThreshold
+			}
+		}
+
+		report.Comparison = &jsonComparison{
+			Reference:     args[0],
+			Candidate:     args[1],
+			SSIM:          result.SSIM,
+			MeanDiff:      result.MeanDiff,
+			ChangedPixels: result.ChangedPixels,
+			Pixels:        result.Pixels,
+			Passed:        passed,
+		}
+		if !math.IsInf(result.PSNR, 1) {
+			report.Comparison.PSNR = &result.PSNR
+		}
+		if checkThreshold {
+			report.Comparison.Metric = metric
+			report.Comparison.Threshold = &compareThreshold
+		}
+
+		psnr := "identical"
+		if !math.IsInf(result.PSNR, 1) {
+			psnr = fmt.Sprintf("%.2f dB", result.PSNR)
+		}
+		printResult("PSNR       %s\n", psnr)
+		printResult("SSIM       %.6f\n", result.SSIM)
+		printResult("Mean diff  %.4f\n", result.MeanDiff)
+		printResult("Changed    %.2f%% (%d of %d pixels)\n",
+			100*float64(result.ChangedPixels)/float64(result.Pixels), result.ChangedPixels, result.Pixels)
+
+		if !passed {
+			// A failed comparison is a result, not a usage error
+			cmd.SilenceUsage = true
+			return fmt.Errorf("images differ: %s is worse than the threshold %g", metric, compareThreshold)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+
+	compareCmd.Flags().StringVar(&compareDiff, "diff", "", "Write an image highlighting the changed pixels")
+	compareCmd.Flags().StringVar(&compareMetric, "metric", "ssim", "Metric --threshold applies to (ssim, psnr, diff)")
+	compareCmd.Flags().Float64Var(&compareThreshold, "threshold", 0, "Fail when the metric is worse than this: SSIM or PSNR (dB) below it, or mean difference above it")
+}
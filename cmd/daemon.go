@@ -0,0 +1,362 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"nim/pkg/daemon"
+	"nim/pkg/image"
+	"nim/pkg/metrics"
+)
+
+var (
+	daemonSocket       string
+	daemonMetricsAddr  string
+	daemonQueue        int
+	daemonQueueTimeout time.Duration
+)
+
+// stageHooks are called as each stage of a conversion starts and ends, like
+// the spinner is; the daemon sets them to time stages for --metrics-addr
+var stageHooks image.Hooks
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Keep nim running and serve jobs from nim client over a unix socket",
+	Long: `Start nim once and keep it running, with its codecs initialized, to run jobs
+sent by nim client over a unix socket. Tools that call nim thousands of times
+spend most of that time starting it; the client skips that cost by handing
+its arguments to the daemon, which runs them as if given to nim directly, in
+the client's working directory, and streams the output back.
+
+Jobs run one at a time in the order they arrive, and decode their inputs in
+a separate, resource-limited process (see --sandbox) so a malicious file
+cannot crash the daemon. The socket is in
+$XDG_RUNTIME_DIR, or the temporary directory, unless --socket is given; the
+daemon stops on Ctrl+C or SIGTERM and removes it.
+
+--queue bounds the jobs waiting for their turn and --queue-timeout the
+time they may wait; jobs turned away print an error and exit with status 75,
+so a burst of large jobs fails fast and can be retried instead of piling up.
+
+--metrics-addr serves Prometheus metrics over HTTP at /metrics (jobs, job
+and per-stage durations, jobs and decodes in flight), with /healthz, which
+answers while the daemon runs, and /readyz, which fails once it is stopping.`,
+	Example: `  nim daemon &
+  nim client photo.jpg photo.webp -s 800x600
+  nim daemon --socket /run/nim.sock
+  nim daemon --queue 8 --queue-timeout 30s
+  nim daemon --metrics-addr 127.0.0.1:9464`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if daemonQueue < 0 || daemonQueueTimeout < 0 {
+			return fmt.Errorf("--queue and --queue-timeout cannot be negative")
+		}
+		if err := image.Warm(); err != nil {
+			return err
+		}
+		// Jobs decode in the sandbox unless the daemon or the job is given
+		// --sandbox=false, since they come from other users and programs
+		sandboxDefault := sandboxEnabled || !cmd.Flag("sandbox").Changed
+		rootCmd.PersistentFlags().Lookup("sandbox").DefValue = strconv.FormatBool(sandboxDefault)
+		l, err := daemon.Listen(daemonSocket)
+		if err != nil {
+			return err
+		}
+
+		handler := runJob
+		limits := daemon.Limits{Queue: daemonQueue, Timeout: daemonQueueTimeout}
+		var ready atomic.Bool
+		if daemonMetricsAddr != "" {
+			m := newJobMetrics()
+			srv, err := serveMetrics(daemonMetricsAddr, m.registry, &ready)
+			if err != nil {
+				l.Close()
+				return err
+			}
+			defer srv.Close()
+			handler = m.wrap(runJob)
+			limits.Rejected = func(req daemon.Request, err error) {
+				m.jobs.Inc("rejected")
+			}
+			printf("Serving metrics on http://%s/metrics\n", srv.Addr)
+		}
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(signals)
+		go func() {
+			<-signals
+			ready.Store(false)
+			l.Close()
+		}()
+
+		printf("Listening on %s\n", daemonSocket)
+		ready.Store(true)
+		return daemon.ServeWithLimits(l, handler, limits)
+	},
+}
+
+var clientCmd = &cobra.Command{
+	Use:   "client [--socket path] [nim arguments...]",
+	Short: "Run nim arguments on a running nim daemon",
+	Long: `Send the arguments to a running nim daemon, which runs them as if given to
+nim directly, in the current directory, and print their output. The exit
+status is the one of the job. A --socket before the arguments selects the
+daemon; $NIM_SOCKET does the same.`,
+	Example: `  nim client photo.jpg photo.webp -s 800x600
+  nim client --socket /run/nim.sock thumb photo.jpg thumb.jpg`,
+	DisableFlagParsing: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		socket := os.Getenv("NIM_SOCKET")
+		if socket == "" {
+			socket = daemon.DefaultSocket()
+		}
+		switch {
+		case len(args) > 1 && args[0] == "--socket":
+			socket, args = args[1], args[2:]
+		case len(args) > 0 && strings.HasPrefix(args[0], "--socket="):
+			socket, args = strings.TrimPrefix(args[0], "--socket="), args[1:]
+		}
+
+		dir, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+		code, err := daemon.Run(socket, daemon.Request{Args: args, Dir: dir}, os.Stdout, os.Stderr)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			os.Exit(code)
+		}
+		return nil
+	},
+}
+
+// runJob runs a daemon job like a new nim process would: in its directory,
+// with every flag back at its default and its output going to the client
+func runJob(req daemon.Request, stdout, stderr io.Writer) int {
+	if len(req.Args) > 0 && (req.Args[0] == "daemon" || req.Args[0] == "client") {
+		fmt.Fprintf(stderr, "Error: %s cannot run in the daemon\n", req.Args[0])
+		return 1
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: failed to get working directory: %v\n", err)
+		return 1
+	}
+	if err := os.Chdir(req.Dir); err != nil {
+		fmt.Fprintf(stderr, "Error: failed to enter %s: %v\n", req.Dir, err)
+		return 1
+	}
+	defer os.Chdir(wd)
+
+	restore, err := redirectOutput(stdout, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer restore()
+
+	// Flags are reset afterwards too, so the daemon's own report at exit
+	// does not pick up the last job
+	resetFlags(rootCmd)
+	report = jsonReport{}
+	defer func() { report = jsonReport{} }()
+	defer resetFlags(rootCmd)
+	rootCmd.SetArgs(req.Args)
+	commandArgs = req.Args
+	defer func() { commandArgs = nil }()
+	err = Execute()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	return ExitCode(err)
+}
+
+// jobMetrics are the metrics nim daemon serves with --metrics-addr
+type jobMetrics struct {
+	*stageMetrics
+	registry     *metrics.Registry
+	jobs         *metrics.Counter
+	jobDuration  *metrics.Histogram
+	jobsInFlight *metrics.Gauge
+}
+
+func newJobMetrics() *jobMetrics {
+	r := metrics.NewRegistry()
+	return &jobMetrics{
+		registry:     r,
+		jobs:         r.NewCounter("nim_jobs_total", "Jobs sent to the daemon, by status: ok, error, or rejected when the queue is full or the job waited too long.", "status"),
+		jobDuration:  r.NewHistogram("nim_job_duration_seconds", "Time taken by jobs, in seconds.", "", metrics.DefaultBuckets),
+		jobsInFlight: r.NewGauge("nim_jobs_in_flight", "Jobs running."),
+		stageMetrics: newStageMetrics(r),
+	}
+}
+
+// stageMetrics time the stages of conversions, in nim daemon and nim serve
+type stageMetrics struct {
+	stageDuration   *metrics.Histogram
+	decodesInFlight *metrics.Gauge
+}
+
+func newStageMetrics(r *metrics.Registry) *stageMetrics {
+	return &stageMetrics{
+		stageDuration:   r.NewHistogram("nim_stage_duration_seconds", "Time taken by each stage of a conversion, in seconds.", "stage", metrics.DefaultBuckets),
+		decodesInFlight: r.NewGauge("nim_decodes_in_flight", "Inputs being decoded."),
+	}
+}
+
+// hooks returns the hooks that record the stages of a conversion
+func (m *stageMetrics) hooks() image.Hooks {
+	return image.Hooks{OnStageStart: m.startStage, OnStageEnd: m.endStage}
+}
+
+// wrap returns a handler that runs jobs with next and records them
+func (m *jobMetrics) wrap(next daemon.Handler) daemon.Handler {
+	return func(req daemon.Request, stdout, stderr io.Writer) int {
+		m.jobsInFlight.Add(1)
+		defer m.jobsInFlight.Add(-1)
+		start := time.Now()
+		stageHooks = m.hooks()
+		defer func() { stageHooks = image.Hooks{} }()
+
+		code := next(req, stdout, stderr)
+		m.jobDuration.ObserveSince("", start)
+		if code == 0 {
+			m.jobs.Inc("ok")
+		} else {
+			m.jobs.Inc("error")
+		}
+		return code
+	}
+}
+
+// startStage counts the inputs being decoded
+func (m *stageMetrics) startStage(stage string) {
+	if stage == image.StageDecode {
+		m.decodesInFlight.Add(1)
+	}
+}
+
+// endStage records the time taken by a stage
+func (m *stageMetrics) endStage(stage string, elapsed time.Duration) {
+	if stage == image.StageDecode {
+		m.decodesInFlight.Add(-1)
+	}
+	m.stageDuration.Observe(stage, elapsed.Seconds())
+}
+
+// serveMetrics serves the metrics of registry, /healthz and /readyz over
+// HTTP on addr. /readyz fails unless ready is set.
+func serveMetrics(addr string, registry *metrics.Registry, ready *atomic.Bool) (*http.Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", registry.Handler())
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !ready.Load() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	srv := &http.Server{Addr: l.Addr().String(), Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(l)
+	return srv, nil
+}
+
+// redirectOutput points os.Stdout and os.Stderr, which commands print to, at
+// stdout and stderr until the returned function is called
+func redirectOutput(stdout, stderr io.Writer) (func(), error) {
+	oldStdout, oldStderr, logger := os.Stdout, os.Stderr, slog.Default()
+	var wg sync.WaitGroup
+	var writers []*os.File
+	redirect := func(w io.Writer) (*os.File, error) {
+		r, pw, err := os.Pipe()
+		if err != nil {
+			return nil, fmt.Errorf("failed to redirect output: %w", err)
+		}
+		writers = append(writers, pw)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer r.Close()
+			io.Copy(w, r)
+		}()
+		return pw, nil
+	}
+
+	restore := func() {
+		for _, w := range writers {
+			w.Close()
+		}
+		wg.Wait()
+		os.Stdout, os.Stderr = oldStdout, oldStderr
+		slog.SetDefault(logger)
+	}
+	outPipe, err := redirect(stdout)
+	if err != nil {
+		restore()
+		return nil, err
+	}
+	errPipe, err := redirect(stderr)
+	if err != nil {
+		restore()
+		return nil, err
+	}
+	os.Stdout, os.Stderr = outPipe, errPipe
+	return restore, nil
+}
+
+// resetFlags sets every flag of cmd and its subcommands back to its default,
+// as if it was never given
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			var values []string
+			if def := strings.Trim(f.DefValue, "[]"); def != "" {
+				values = strings.Split(def, ",")
+			}
+			slice.Replace(values)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(clientCmd)
+
+	daemonCmd.Flags().StringVar(&daemonSocket, "socket", daemon.DefaultSocket(), "Path of the unix socket to listen on")
+	daemonCmd.Flags().IntVar(&daemonQueue, "queue", 0, "Largest number of jobs waiting while one runs; more are turned away (0 for no limit)")
+	daemonCmd.Flags().DurationVar(&daemonQueueTimeout, "queue-timeout", 0, "Time a job may wait for its turn before it is turned away (0 for no limit)")
+	daemonCmd.Flags().StringVar(&daemonMetricsAddr, "metrics-addr", "", "Serve Prometheus metrics, /healthz and /readyz over HTTP on this address (host:port)")
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	stdimage "image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"nim/pkg/daemon"
+)
+
+// writeTestPNG writes a gray PNG of the given size
+func writeTestPNG(t *testing.T, path string, w, h int) {
+	t.Helper()
+	img := stdimage.NewGray(stdimage.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pngSize returns the size of the PNG at path
+func pngSize(t *testing.T, path string) stdimage.Point {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	config, err := png.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stdimage.Pt(config.Width, config.Height)
+}
+
+func TestDaemonOperationOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPNG(t, filepath.Join(dir, "in.png"), 1000, 1000)
+	socket := filepath.Join(dir, "nim.sock")
+	l, err := daemon.Listen(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go daemon.Serve(l, runJob)
+
+	// The operations run in the order of the flags of the job, as they do
+	// when nim is run directly
+	for _, tt := range []struct {
+		args []string
+		want stdimage.Point
+	}{
+		{[]string{"in.png", "resize-crop.png", "-s", "800x800", "--crop", "400x400+0+0"}, stdimage.Pt(400, 400)},
+		{[]string{"in.png", "crop-resize.png", "--crop", "400x400+0+0", "-s", "800x800"}, stdimage.Pt(800, 800)},
+	} {
+		var stdout, stderr bytes.Buffer
+		code, err := daemon.Run(socket, daemon.Request{Args: tt.args, Dir: dir}, &stdout, &stderr)
+		if err != nil || code != 0 {
+			t.Fatalf("Job %v failed with %d, %v: %s", tt.args, code, err, stderr.String())
+		}
+		if got := pngSize(t, filepath.Join(dir, tt.args[1])); got != tt.want {
+			t.Errorf("Expected %v for %v, got %v", tt.want, tt.args, got)
+		}
+	}
+}
+
+func TestDaemonJobsStartClean(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPNG(t, filepath.Join(dir, "in.png"), 100, 100)
+
+	// A job leaves neither its --op steps nor its --json report behind
+	for _, tt := range []struct {
+		args []string
+		want stdimage.Point
+	}{
+		{[]string{"in.png", "op.png", "--op", "resize=40x40", "--json"}, stdimage.Pt(40, 40)},
+		{[]string{"in.png", "plain.png", "-s", "20x20", "--json"}, stdimage.Pt(20, 20)},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := runJob(daemon.Request{Args: tt.args, Dir: dir}, &stdout, &stderr); code != 0 {
+			t.Fatalf("Job %v failed with %d: %s", tt.args, code, stderr.String())
+		}
+		var got jsonReport
+		if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Outputs) != 1 || got.Outputs[0].Output != tt.args[1] {
+			t.Errorf("Expected only %s in the report of %v, got %+v", tt.args[1], tt.args, got.Outputs)
+		}
+		if size := pngSize(t, filepath.Join(dir, tt.args[1])); size != tt.want {
+			t.Errorf("Expected %v for %v, got %v", tt.want, tt.args, size)
+		}
+	}
+	if report.Outputs != nil || opChain != nil {
+		t.Errorf("Expected the state of the last job to be cleared")
+	}
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/image"
+	"nim/pkg/phash"
+)
+
+var (
+	dedupeAlgorithm string
+	dedupeDistance  int
+)
+
+var dedupeCmd = &cobra.Command{
+	Use:   "dedupe [dirs...]",
+	Short: "Find near-duplicate images",
+	Long: `Hash every image in the given directories and their subdirectories with a
+perceptual hash, and report groups of near-duplicates: images whose hashes
+differ in at most --distance bits, directly or through other images of the
+group. Files are only read, never deleted.`,
+	Example: `  nim dedupe ~/Pictures
+  nim dedupe photos --distance 4 --algo dhash`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		algorithm := phash.Algorithm(strings.ToLower(dedupeAlgorithm))
+		if !slices.Contains(phash.Algorithms, algorithm) {
+			return fmt.Errorf("unknown hash algorithm: %s (expected ahash, dhash, or phash)", dedupeAlgorithm)
+		}
+		if dedupeDistance < 0 || dedupeDistance > 64 {
+			return fmt.Errorf("invalid distance: %d (expected 0-64)", dedupeDistance)
+		}
+
+		files, err := findImages(args)
+		if err != nil {
+			return err
+		}
+
+		update, stop := startBar(len(files))
+		var hashed []string
+		var hashList []phash.Hash
+		for i, file := range files {
+			update(i, filepath.Base(file))
+			h, err := hashFile(file, algorithm)
+			if err != nil {
+				// One unreadable file should not stop a scan of a whole library
+				slog.Warn("skipping unreadable image", "file", file, "error", err)
+				continue
+			}
+			hashed = append(hashed, file)
+			hashList = append(hashList, h)
+		}
+		update(len(files), "")
+		stop()
+
+		groups := phash.Group(hashList, dedupeDistance)
+		for i, group := range groups {
+			printResult("Group %d (%d images):\n", i+1, len(group))
+			files := make([]string, len(group))
+			for j, index := range group {
+				files[j] = hashed[index]
+				if j == 0 {
+					printResult("  %s\n", hashed[index])
+					continue
+				}
+				printResult("  %s (distance %d)\n", hashed[index], phash.Distance(hashList[group[0]], hashList[index]))
+			}
+			report.Duplicates = append(report.Duplicates, files)
+		}
+		printf("%d images scanned, near-duplicate groups: %d\n", len(hashed), len(groups))
+		return nil
+	},
+}
+
+// findImages returns the files in dirs and their subdirectories that nim can
+// read, in lexical order
+func findImages(dirs []string) ([]string, error) {
+	readable := image.ReadableExtensions()
+	var files []string
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+			if !entry.IsDir() && slices.Contains(readable, ext) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", dir, err)
+		}
+	}
+	return files, nil
+}
+
+func init() {
+	rootCmd.AddCommand(dedupeCmd)
+
+	dedupeCmd.Flags().StringVar(&dedupeAlgorithm, "algo", string(phash.AlgorithmPerceptual), "Hash algorithm (ahash, dhash, phash)")
+	dedupeCmd.Flags().IntVar(&dedupeDistance, "distance", 10, "Maximum number of differing hash bits for images to count as near-duplicates")
+}
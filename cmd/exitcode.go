@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/spf13/cobra"
+
+	"nim/pkg/batch"
+	"nim/pkg/image"
+)
+
+// Exit codes of nim, so scripts can tell failures apart
+const (
+	ExitOK          = 0 // Success
+	ExitFailure     = 1 // Other errors, and batches in which only some files failed
+	ExitUsage       = 2 // Invalid flags or arguments
+	ExitUnsupported = 3 // An input or output format nim cannot read or write
+	ExitDecode      = 4 // An input that could not be decoded
+	ExitEncode      = 5 // An output that could not be encoded
+	ExitIO          = 6 // A file that could not be read or written
+	ExitWarnings    = 7 // Warnings were logged with --warnings-as-errors
+)
+
+// errWarnings is the error of a run that logged warnings with
+// --warnings-as-errors
+var errWarnings = errors.New("failing because of --warnings-as-errors")
+
+// warningsError returns the error of a run that logged n warnings
+func warningsError(n int64) error {
+	if n == 1 {
+		return fmt.Errorf("1 warning was logged, %w", errWarnings)
+	}
+	return fmt.Errorf("%d warnings were logged, %w", n, errWarnings)
+}
+
+// ExitCode returns the exit code for the error a command returned. A batch
+// in which every file failed for the same kind of reason exits with the code
+// of that reason.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var usage *usageError
+	if errors.As(err, &usage) {
+		return ExitUsage
+	}
+	var batchErr *batch.Errors
+	if errors.As(err, &batchErr) {
+		if batchErr.Partial() || len(batchErr.Failures) == 0 {
+			return ExitFailure
+		}
+		code := ExitCode(batchErr.Failures[0].Err)
+		for _, f := range batchErr.Failures[1:] {
+			if ExitCode(f.Err) != code {
+				return ExitFailure
+			}
+		}
+		return code
+	}
+	switch {
+	case errors.Is(err, errWarnings):
+		return ExitWarnings
+	case errors.Is(err, image.ErrUnsupportedFormat):
+		return ExitUnsupported
+	case errors.Is(err, image.ErrDecode):
+		return ExitDecode
+	case errors.Is(err, image.ErrEncode):
+		return ExitEncode
+	case errors.Is(err, image.ErrOutputExists), errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrPermission):
+		return ExitIO
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return ExitIO
+	}
+	return ExitFailure
+}
+
+// usageError is an error in the flags or arguments of a command
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+// usageErrorf returns a usageError with a formatted message
+func usageErrorf(format string, a ...any) error {
+	return &usageError{err: fmt.Errorf(format, a...)}
+}
+
+// markUsage marks err, if not nil, as an error in the flags or arguments
+func markUsage(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &usageError{err: err}
+}
+
+var markUsageErrors sync.Once
+
+// markArgErrors makes the flag and argument errors of cmd and its
+// subcommands usage errors. Cobra no longer prints the usage for other
+// errors; Execute prints it for usage errors.
+func markArgErrors(cmd *cobra.Command) {
+	cmd.SilenceUsage = true
+	cmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return markUsage(err)
+	})
+	if args := cmd.Args; args != nil {
+		cmd.Args = func(cmd *cobra.Command, a []string) error {
+			return markUsage(args(cmd, a))
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		markArgErrors(sub)
+	}
+}
+
+// warnings counts the warnings logged during a run, for --warnings-as-errors
+var warnings atomic.Int64
+
+// warningCounter is a log handler that counts the warnings and errors it
+// receives. With --warnings-as-errors it sees them even when they are not
+// shown, such as with --quiet.
+type warningCounter struct {
+	slog.Handler
+}
+
+func (h warningCounter) Enabled(ctx context.Context, level slog.Level) bool {
+	return (warningsAsErrors && level >= slog.LevelWarn) || h.Handler.Enabled(ctx, level)
+}
+
+func (h warningCounter) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelWarn {
+		warnings.Add(1)
+	}
+	if !h.Handler.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h warningCounter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return warningCounter{h.Handler.WithAttrs(attrs)}
+}
+
+func (h warningCounter) WithGroup(name string) slog.Handler {
+	return warningCounter{h.Handler.WithGroup(name)}
+}
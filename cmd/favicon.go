@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/favicon"
+	"nim/pkg/image"
+)
+
+var (
+	faviconOutput     string
+	faviconBackground string
+	faviconPath       string
+)
+
+var faviconCmd = &cobra.Command{
+	Use:   "favicon [input]",
+	Short: "Generate a complete favicon set for a website",
+	Long: `Generate the favicon set a modern website needs from one source image:
+favicon.ico (16, 32 and 48 px), PNG favicons, an Apple touch icon, regular and
+maskable icons for the web app manifest, a manifest fragment (site.webmanifest)
+and an HTML snippet with the link tags (favicon.html, also printed).
+
+Use a square source of at least 512x512 pixels, or an SVG, which is also
+copied as favicon.svg.`,
+	Example: `  nim favicon logo.svg -o public
+  nim favicon logo.png -o static/icons --path /static/icons/ --background "#1E293B"`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		input := args[0]
+
+		background, err := image.ParseHexColor(faviconBackground)
+		if err != nil {
+			return fmt.Errorf("invalid --background %s: %w", faviconBackground, err)
+		}
+
+		// Vector sources are rendered at the largest icon size
+		options := image.DefaultOptions()
+		options.Width, options.Height = 512, 512
+		start := time.Now()
+		src, err := image.OpenImageWithOptions(input, options)
+		if err != nil {
+			return fmt.Errorf("failed to open image: %w", err)
+		}
+
+		faviconOptions := favicon.Options{
+			Background: background,
+			Path:       faviconPath,
+		}
+		if strings.EqualFold(filepath.Ext(input), ".svg") {
+			if faviconOptions.SVG, err = os.ReadFile(input); err != nil {
+				return fmt.Errorf("failed to read SVG: %w", err)
+			}
+		}
+
+		files, err := favicon.Generate(src, faviconOutput, faviconOptions)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range files {
+			if err := recordFile([]string{input}, filepath.Join(faviconOutput, name), start); err != nil {
+				return err
+			}
+		}
+
+		printf("Favicon set created successfully: %d files -> %s\n\n", len(files), faviconOutput)
+		printResult("%s", favicon.HTML(faviconPath, faviconOptions.SVG != nil))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(faviconCmd)
+
+	faviconCmd.Flags().StringVarP(&faviconOutput, "output", "o", ".", "Output folder")
+	faviconCmd.Flags().StringVar(&faviconBackground, "background", "#FFFFFF", "Background color of the Apple touch icon and maskable icons (hex, rgb() or a CSS color name); the Apple touch icon is flattened onto white")
+	faviconCmd.Flags().StringVar(&faviconPath, "path", "/", "URL path the icons are served from, used in the HTML and manifest")
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/image"
+)
+
+var formatsCmd = &cobra.Command{
+	Use:   "formats",
+	Short: "List the supported image formats",
+	Long: `List every image format nim knows with whether it can be read and written,
+whether it needs cgo or an external tool, and whether this binary and PATH
+meet those requirements.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FORMAT\tEXTENSIONS\tREAD\tWRITE\tREQUIRES\tENABLED\tNOTES")
+		for _, format := range image.Formats() {
+			var requires []string
+			if format.CGO {
+				requires = append(requires, "cgo")
+			}
+			if len(format.Tools) > 0 {
+				requires = append(requires, strings.Join(format.Tools, "|"))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", format.Name, strings.Join(format.Extensions, ","),
+				yesNo(format.Read), yesNo(format.Write), orDash(strings.Join(requires, ", ")), yesNo(format.Enabled), format.Note)
+		}
+		return w.Flush()
+	},
+}
+
+// yesNo formats a capability for a table
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// orDash returns s, or a dash if s is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(formatsCmd)
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/histogram"
+	"nim/pkg/image"
+)
+
+var (
+	histogramRender string
+	histogramSize   string
+)
+
+// jsonChannel describes the histogram of one channel in --json output
+type jsonChannel struct {
+	Counts     []int   `json:"counts"`
+	Mean       float64 `json:"mean"`
+	Median     int     `json:"median"`
+	Shadows    float64 `json:"shadows_clipped"`
+	Highlights float64 `json:"highlights_clipped"`
+}
+
+// jsonHistogram describes the histograms of a file in --json output
+type jsonHistogram struct {
+	File     string                 `json:"file"`
+	Width    int                    `json:"width"`
+	Height   int                    `json:"height"`
+	Pixels   int                    `json:"pixels"`
+	Channels map[string]jsonChannel `json:"channels"`
+}
+
+var histogramCmd = &cobra.Command{
+	Use:   "histogram [files...]",
+	Short: "Print per-channel histograms of images",
+	Long: `Count the pixels at each level (0-255) of the red, green, blue, alpha and
+luma channels of each image, to check the exposure of photos.
+
+A summary of the luma is printed for each file: its mean and median, and the
+share of pixels clipped to black (shadows) or white (highlights). The full
+histograms of every channel are in the --json report.
+
+--render also draws the red, green and blue histograms as an image; with
+several files, {name} in its path is replaced by the name of each input.`,
+	Example: `  nim histogram photo.jpg
+  nim histogram --json photos/*.jpg
+  nim histogram photo.jpg --render photo-histogram.png
+  nim histogram --render "hist/{name}.png" --render-size 512x200 photos/*.jpg`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		width, height, err := image.ParseSize(histogramSize)
+		if err != nil {
+			return err
+		}
+		if histogramRender != "" && len(args) > 1 && !strings.Contains(histogramRender, "{name}") {
+			return fmt.Errorf("--render needs {name} in its path with several files")
+		}
+
+		for _, file := range args {
+			src, err := openSource(file, image.DefaultOptions())
+			if err != nil {
+				return err
+			}
+			h := histogram.Compute(src.img)
+			report.Histograms = append(report.Histograms, jsonHistogram{
+				File:   file,
+				Width:  src.img.Bounds().Dx(),
+				Height: src.img.Bounds().Dy(),
+				Pixels: h.Pixels,
+				Channels: map[string]jsonChannel{
+					"red":   newJSONChannel(&h.Red),
+					"green": newJSONChannel(&h.Green),
+					"blue":  newJSONChannel(&h.Blue),
+					"alpha": newJSONChannel(&h.Alpha),
+					"luma":  newJSONChannel(&h.Luma),
+				},
+			})
+
+			shadows, highlights := h.Luma.Clipping()
+			printResult("%s: mean %.1f, median %d, shadows clipped %.1f%%, highlights clipped %.1f%%\n",
+				file, h.Luma.Mean(), h.Luma.Percentile(0.5), shadows*100, highlights*100)
+
+			if histogramRender != "" {
+				path, err := templateOutput(histogramRender, file)
+				if err != nil {
+					return err
+				}
+				if _, err := saveImage(histogram.Render(h, width, height), path, image.DefaultOptions(), src); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	},
+}
+
+// newJSONChannel summarizes a channel for --json output
+func newJSONChannel(c *histogram.Channel) jsonChannel {
+	shadows, highlights := c.Clipping()
+	return jsonChannel{
+		Counts:     c[:],
+		Mean:       c.Mean(),
+		Median:     c.Percentile(0.5),
+		Shadows:    shadows,
+		Highlights: highlights,
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(histogramCmd)
+
+	histogramCmd.Flags().StringVar(&histogramRender, "render", "", "Also draw the histograms as an image at this path ({name} is replaced by the input name)")
+	histogramCmd.Flags().StringVar(&histogramSize, "render-size", "512x200", "Size of the --render image in format WIDTHxHEIGHT")
+}
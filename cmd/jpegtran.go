@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	stdimage "image"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/image"
+)
+
+var (
+	jpegtranRotate      int
+	jpegtranFlip        string
+	jpegtranCrop        string
+	jpegtranAutoOrient  bool
+	jpegtranProgressive bool
+)
+
+var jpegtranCmd = &cobra.Command{
+	Use:   "jpegtran <input.jpg> <output.jpg>",
+	Short: "Rotate, flip or crop a JPEG without re-encoding it",
+	Long: `Rotate, flip or crop a JPEG losslessly, like jpegtran: the compressed DCT
+blocks are rearranged instead of decoding and encoding the image again, so no
+quality is lost however often it is done.
+
+Rotation and flips apply in that order, and the crop region is given in the
+result. Crops must start on the MCU grid, which is 8 or 16 pixels depending on
+the chroma subsampling. A flip moves the partial MCU at the right or bottom
+edge to the left or top, where JPEG cannot store it, so it is trimmed like
+jpegtran -trim does. EXIF and other metadata are kept; --auto-orient applies
+the EXIF orientation and resets it.`,
+	Example: `  nim jpegtran photo.jpg upright.jpg --auto-orient
+  nim jpegtran in.jpg out.jpg --rotate 90
+  nim jpegtran in.jpg out.jpg --flip h --crop 800x600+16+32`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		transform := image.JPEGTransform{
+			AutoOrient:  jpegtranAutoOrient,
+			Rotate:      jpegtranRotate,
+			Progressive: jpegtranProgressive,
+		}
+		switch jpegtranFlip {
+		case "":
+		case "h":
+			transform.FlipH = true
+		case "v":
+			transform.FlipV = true
+		case "hv", "vh":
+			transform.FlipH, transform.FlipV = true, true
+		default:
+			return fmt.Errorf("invalid flip: %s (expected h, v or hv)", jpegtranFlip)
+		}
+		if jpegtranCrop != "" {
+			crop, err := image.ParseGeometry(jpegtranCrop)
+			if err != nil {
+				return err
+			}
+			transform.Crop = crop
+		}
+
+		start := time.Now()
+		input, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read input file: %w", err)
+		}
+		var buf bytes.Buffer
+		if err := image.TransformJPEG(bytes.NewReader(input), &buf, transform); err != nil {
+			return fmt.Errorf("failed to transform JPEG: %w", err)
+		}
+
+		path, ok, err := resolveOutput(args[1], args[0])
+		if err != nil || !ok {
+			return err
+		}
+		err = image.WriteFile(path, func(w io.Writer) error {
+			_, err := w.Write(buf.Bytes())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+		if err := recordFile(args[:1], path, start); err != nil {
+			return err
+		}
+
+		size := "?"
+		if config, _, err := stdimage.DecodeConfig(bytes.NewReader(buf.Bytes())); err == nil {
+			size = fmt.Sprintf("%dx%d", config.Width, config.Height)
+		}
+		printf("JPEG transformed losslessly: %s -> %s (%s)\n", args[0], path, size)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(jpegtranCmd)
+
+	jpegtranCmd.Flags().IntVar(&jpegtranRotate, "rotate", 0, "Rotate clockwise by 90, 180 or 270 degrees")
+	jpegtranCmd.Flags().StringVar(&jpegtranFlip, "flip", "", "Mirror horizontally (h), vertically (v) or both (hv)")
+	jpegtranCmd.Flags().StringVar(&jpegtranCrop, "crop", "", "Keep the region WIDTHxHEIGHT+X+Y, with X and Y on the MCU grid")
+	jpegtranCmd.Flags().BoolVar(&jpegtranAutoOrient, "auto-orient", false, "Apply the EXIF orientation and reset it to upright")
+	jpegtranCmd.Flags().BoolVar(&jpegtranProgressive, "progressive", false, "Write a progressive JPEG")
+}
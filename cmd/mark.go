@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/image"
+	"nim/pkg/mark"
+)
+
+var (
+	markKey      string
+	markKeyFile  string
+	markPayload  string
+	markStrength float64
+)
+
+// jsonWatermark describes the watermark found in a file in --json output
+type jsonWatermark struct {
+	File    string  `json:"file"`
+	Found   bool    `json:"found"`
+	Payload string  `json:"payload,omitempty"`
+	Score   float64 `json:"score"`
+}
+
+var markCmd = &cobra.Command{
+	Use:   "mark",
+	Short: "Embed and detect invisible watermarks",
+	Long: fmt.Sprintf(`Hide a short payload, such as a customer or recipient ID, in an image without
+visible changes, and read it back from copies to attribute them or trace a
+leak. The payload is spread over the mid frequencies of the DCT of the whole
+image under a secret key, so it survives JPEG recompression and resizing, but
+not cropping. It can be up to %d bytes; trailing zero bytes are dropped.
+
+The key is needed to read or remove the watermark: keep it secret, and pass it
+with --key-file rather than --key to keep it out of the shell history.`, mark.Capacity),
+}
+
+var markEmbedCmd = &cobra.Command{
+	Use:   "embed <input> <output>",
+	Short: "Hide a payload in an image",
+	Example: `  nim mark embed photo.jpg photo-alice.jpg --key-file mark.key --payload alice
+  nim mark embed art.png art-042.webp --key s3cret --payload order042 --strength 2`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := readMarkKey()
+		if err != nil {
+			return err
+		}
+		if markPayload == "" {
+			return fmt.Errorf("--payload is required")
+		}
+		src, err := openSource(args[0], image.DefaultOptions())
+		if err != nil {
+			return err
+		}
+		marked, err := mark.Embed(src.img, key, []byte(markPayload), markStrength)
+		if err != nil {
+			return err
+		}
+		_, err = saveImage(marked, args[1], image.DefaultOptions(), src)
+		return err
+	},
+}
+
+var markDetectCmd = &cobra.Command{
+	Use:   "detect <files...>",
+	Short: "Read the payload hidden in images",
+	Long: `Print the payload hidden in each image under the key, or "none" if there is
+no watermark of the key. The score is the strength of the watermark relative
+to when it was embedded: about 1 for an untouched copy, lower after heavy
+recompression. The command fails if any image has no watermark.`,
+	Example: `  nim mark detect leaked.jpg --key-file mark.key
+  nim mark detect --json --key s3cret downloads/*.jpg`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := readMarkKey()
+		if err != nil {
+			return err
+		}
+		missing := 0
+		for _, file := range args {
+			src, err := openSource(file, image.DefaultOptions())
+			if err != nil {
+				return err
+			}
+			d := mark.Detect(src.img, key)
+			result := jsonWatermark{File: file, Found: d.Found, Score: d.Score}
+			if d.Found {
+				result.Payload = formatPayload(d.Payload)
+				printResult("%s  %.2f  %s\n", result.Payload, d.Score, file)
+			} else {
+				missing++
+				printResult("none  %.2f  %s\n", d.Score, file)
+			}
+			report.Watermarks = append(report.Watermarks, result)
+		}
+		if missing > 0 {
+			// A missing watermark is a result, not a usage error
+			cmd.SilenceUsage = true
+			return fmt.Errorf("no watermark found in %d of %d files", missing, len(args))
+		}
+		return nil
+	},
+}
+
+// readMarkKey returns the key of --key or the first line of --key-file
+func readMarkKey() ([]byte, error) {
+	switch {
+	case markKey != "" && markKeyFile != "":
+		return nil, fmt.Errorf("--key and --key-file cannot be used together")
+	case markKeyFile != "":
+		data, err := os.ReadFile(markKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+		key, _, _ := strings.Cut(string(data), "\n")
+		if key = strings.TrimRight(key, "\r"); key == "" {
+			return nil, fmt.Errorf("key file %s is empty", markKeyFile)
+		}
+		return []byte(key), nil
+	case markKey != "":
+		return []byte(markKey), nil
+	}
+	return nil, fmt.Errorf("--key or --key-file is required")
+}
+
+// formatPayload returns a payload as text if it is printable, or in
+// hexadecimal otherwise
+func formatPayload(payload []byte) string {
+	text := string(payload)
+	for _, r := range text {
+		if r == '�' || !unicode.IsPrint(r) || unicode.IsSpace(r) {
+			return "0x" + hex.EncodeToString(payload)
+		}
+	}
+	return text
+}
+
+func init() {
+	rootCmd.AddCommand(markCmd)
+	markCmd.AddCommand(markEmbedCmd)
+	markCmd.AddCommand(markDetectCmd)
+
+	markCmd.PersistentFlags().StringVar(&markKey, "key", "", "Secret key of the watermark")
+	markCmd.PersistentFlags().StringVar(&markKeyFile, "key-file", "", "Read the secret key from the first line of a file")
+	markEmbedCmd.Flags().StringVar(&markPayload, "payload", "", fmt.Sprintf("Payload to hide, up to %d bytes (e.g., a recipient ID)", mark.Capacity))
+	markEmbedCmd.Flags().Float64Var(&markStrength, "strength", 1, "How strongly to embed the watermark; higher survives more damage but may become visible")
+}
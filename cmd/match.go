@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/effect"
+	"nim/pkg/image"
+)
+
+var (
+	matchReference string
+	matchOutput    string
+	matchMethod    string
+	matchStrength  float64
+	matchQuality   int
+)
+
+var matchCmd = &cobra.Command{
+	Use:   "match-colors [targets...]",
+	Short: "Match the colors of images to a reference image",
+	Long: `Move the colors of each target to those of a reference image, so a batch of
+photos from different cameras or lighting gets the same look.
+
+  reinhard    shift and scale the lightness and color of each target (in CIE
+              L*a*b*) to the mean and spread of the reference, keeping the
+              contrast within the target
+  histogram   map the red, green and blue levels so that their histograms
+              follow those of the reference, a closer match that also takes
+              on its contrast and clipping
+
+The reference is measured once for the whole batch. --strength blends the
+result with the original colors, and transparent pixels are left out of both
+the measurement and the matching. With several targets, {name} in the output
+path is replaced by the name of each input.`,
+	Example: `  nim match-colors --reference ref.jpg target.jpg -o out.jpg
+  nim match-colors --reference look.jpg -o "graded/{name}.jpg" shoot/*.jpg
+  nim match-colors --reference ref.png --method histogram --strength 0.6 scan.png -o scan-matched.png`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if matchReference == "" {
+			return usageErrorf("--reference is required")
+		}
+		if matchOutput == "" {
+			return usageErrorf("output is required")
+		}
+		if len(args) > 1 && !strings.Contains(matchOutput, "{name}") {
+			return usageErrorf("--output needs {name} in its path with several targets")
+		}
+		method, err := effect.ParseMatchMethod(matchMethod)
+		if err != nil {
+			return markUsage(err)
+		}
+		if matchStrength < 0 || matchStrength > 1 {
+			return usageErrorf("invalid --strength: %g (expected 0-1)", matchStrength)
+		}
+		if matchQuality < 1 || matchQuality > 100 {
+			return usageErrorf("invalid --quality: %d (expected 1-100)", matchQuality)
+		}
+
+		options := image.DefaultOptions()
+		options.Quality = matchQuality
+		ref, err := openSource(matchReference, image.DefaultOptions())
+		if err != nil {
+			return err
+		}
+		reference := effect.NewColorReference(ref.img)
+
+		update, stop := startBar(len(args))
+		defer stop()
+		for i, file := range args {
+			update(i, filepath.Base(file))
+			src, err := openSource(file, options)
+			if err != nil {
+				return err
+			}
+			matched := effect.MatchColors(src.img, reference, method, matchStrength)
+			path, err := templateOutput(matchOutput, file)
+			if err != nil {
+				return err
+			}
+			if path, err = saveImage(matched, path, options, src); err != nil {
+				return err
+			}
+			if path != "" {
+				printResult("Matched %s to %s (%s) -> %s\n", file, matchReference, method, path)
+			}
+		}
+		update(len(args), "")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(matchCmd)
+
+	matchCmd.Flags().StringVar(&matchReference, "reference", "", "Image whose colors the targets take on")
+	matchCmd.Flags().StringVarP(&matchOutput, "output", "o", "", "Output file ({name} is replaced by the input name)")
+	matchCmd.Flags().StringVar(&matchMethod, "method", "reinhard", "How to match the colors (reinhard, histogram)")
+	matchCmd.Flags().Float64Var(&matchStrength, "strength", 1, "How far to move the colors toward the reference (0-1)")
+	matchCmd.Flags().IntVarP(&matchQuality, "quality", "q", 85, "Output quality (1-100)")
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/image"
+)
+
+var optimizeCmd = &cobra.Command{
+	Use:   "optimize [files...]",
+	Short: "Losslessly shrink JPEG, PNG, GIF and WebP files in place",
+	Long: `Recompress image files in place without changing a pixel, and print the bytes
+saved per file. Files that cannot be made smaller are left untouched.
+
+  JPEG  Huffman tables are built for each image, as a baseline or progressive
+        JPEG, whichever is smaller. Comments, XMP and EXIF data are dropped,
+        except EXIF data that rotates the image; ICC profiles are kept.
+  PNG   Every row filter is tried at the best zlib level, and the image is
+        stored as grayscale or a palette with fewer bits when no color is
+        lost. Ancillary chunks (text, timestamps, color profiles) and
+        interlacing are dropped.
+  GIF   The frames are LZW-compressed again with the same palettes and
+        timing; comments and extensions other than the loop count are dropped.
+  WebP  EXIF and XMP data are dropped, and lossless images are compressed
+        again at the highest effort. Lossy and animated WebP images are not
+        re-encoded.`,
+	Example: `  nim optimize *.png
+  nim optimize photos/*.jpg icons/*.gif
+  nim optimize --json assets/* > savings.json`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		update, stop := startBar(len(args))
+		var before, after int64
+		for i, file := range args {
+			update(i, filepath.Base(file))
+			original, optimized, err := optimizeFile(file)
+			if err != nil {
+				stop()
+				return err
+			}
+			before += original
+			after += optimized
+		}
+		update(len(args), "")
+		stop()
+
+		if len(args) > 1 {
+			printf("Total: %s -> %s (saved %s)\n", formatBytes(before), formatBytes(after), savedPercent(before, after))
+		}
+		return nil
+	},
+}
+
+// optimizeFile shrinks a file in place, returning its old and new size
+func optimizeFile(path string) (int64, int64, error) {
+	start := time.Now()
+	var optimize func([]byte) ([]byte, error)
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".jpg", ".jpeg":
+		optimize = image.OptimizeJPEG
+	case ".png":
+		optimize = image.OptimizePNG
+	case ".gif":
+		optimize = image.OptimizeGIF
+	case ".webp":
+		optimize = image.OptimizeWebP
+	default:
+		return 0, 0, fmt.Errorf("cannot optimize %s: only JPEG, PNG, GIF and WebP files are supported", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read input file: %w", err)
+	}
+
+	optimized, err := optimize(data)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to optimize %s: %w", path, err)
+	}
+	if len(optimized) < len(data) {
+		// Replace the file only once the new one is complete
+		err := image.WriteFile(path, func(w io.Writer) error {
+			_, err := w.Write(optimized)
+			return err
+		})
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to write output file: %w", err)
+		}
+	}
+
+	if err := recordFile([]string{path}, path, start); err != nil {
+		return 0, 0, err
+	}
+	report.Outputs[len(report.Outputs)-1].SavedBytes = int64(len(data) - len(optimized))
+	printf("%s: %s -> %s (saved %s)\n", path, formatBytes(int64(len(data))), formatBytes(int64(len(optimized))),
+		savedPercent(int64(len(data)), int64(len(optimized))))
+	return int64(len(data)), int64(len(optimized)), nil
+}
+
+// formatBytes formats a size in bytes with the units ParseByteSize reads
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1000*1000:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1000*1000))
+	case n >= 1000:
+		return fmt.Sprintf("%.1fKB", float64(n)/1000)
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// savedPercent formats the share of before that after saves
+func savedPercent(before, after int64) string {
+	if before == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(before-after)*100/float64(before))
+}
+
+func init() {
+	rootCmd.AddCommand(optimizeCmd)
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/image"
+	"nim/pkg/pdf"
+)
+
+var (
+	pdfOutput     string
+	pdfSize       string
+	pdfResizeMode string
+	pdfQuality    int
+	pdfDPI        float64
+	pdfPageSize   string
+	pdfMargin     string
+)
+
+var pdfCmd = &cobra.Command{
+	Use:   "pdf [inputs...]",
+	Short: "Combine images into a multi-page PDF",
+	Long: `Combine images into a PDF with one page per input, in the order given.
+
+Each image is scaled to fit the page inside the margins and centered. Pages
+turn to landscape for landscape images. With --page-size fit (the default),
+every page is sized to its image at --dpi.`,
+	Example: `  nim pdf -o scans.pdf scan1.jpg scan2.jpg scan3.jpg
+  nim pdf -o photos.pdf --page-size a4 --margin 10mm *.heic
+  nim pdf -o slides.pdf -s 1920x1080 --page-size fit --dpi 96 slide*.png`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if pdfOutput == "" {
+			return fmt.Errorf("output file is required")
+		}
+
+		layout, err := parsePDFLayout(pdfPageSize, pdfMargin)
+		if err != nil {
+			return err
+		}
+		if pdfDPI <= 0 {
+			return fmt.Errorf("invalid DPI: %g", pdfDPI)
+		}
+		mode, err := parseResizeMode(pdfResizeMode)
+		if err != nil {
+			return err
+		}
+
+		options := image.DefaultOptions()
+		options.ResizeMode = mode
+		options.Quality = pdfQuality
+		options.DPI = pdfDPI
+		options.PDF = layout
+
+		// Images are only resized when a size is given
+		resize := pdfSize != ""
+		if resize {
+			if options.Width, options.Height, err = image.ParseSize(pdfSize); err != nil {
+				return err
+			}
+		}
+
+		start := time.Now()
+		path, ok, err := resolveOutput(pdfOutput, args...)
+		if err != nil || !ok {
+			return err
+		}
+
+		pages, err := openImages(args, options, resize)
+		if err != nil {
+			return err
+		}
+
+		err = image.WriteFile(path, func(w io.Writer) error {
+			return image.EncodePDF(w, pages, options)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write PDF: %w", err)
+		}
+
+		if err := recordFile(args, path, start); err != nil {
+			return err
+		}
+		printf("PDF created successfully: %d pages -> %s\n", len(pages), path)
+		return nil
+	},
+}
+
+// parsePDFLayout parses the page size and margin of PDF output
+func parsePDFLayout(pageSize, margin string) (pdf.Options, error) {
+	size, err := pdf.ParsePageSize(pageSize)
+	if err != nil {
+		return pdf.Options{}, err
+	}
+	points, err := pdf.ParseLength(margin)
+	if err != nil {
+		return pdf.Options{}, fmt.Errorf("invalid margin: %w", err)
+	}
+	return pdf.Options{PageSize: size, Margin: points}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(pdfCmd)
+
+	pdfCmd.Flags().StringVarP(&pdfOutput, "output", "o", "", "Output PDF file")
+	pdfCmd.Flags().StringVarP(&pdfSize, "size", "s", "", "Resize each image to WIDTHxHEIGHT before embedding it")
+	pdfCmd.Flags().StringVarP(&pdfResizeMode, "mode", "m", "fit", "Resize mode (fit, fill, stretch, liquid)")
+	pdfCmd.Flags().IntVarP(&pdfQuality, "quality", "q", 85, "JPEG quality of embedded images (1-100)")
+	pdfCmd.Flags().Float64Var(&pdfDPI, "dpi", image.DefaultDPI, "Resolution images are placed at with --page-size fit")
+	pdfCmd.Flags().StringVar(&pdfPageSize, "page-size", "fit", "Page size (a3, a4, a5, letter, legal, fit, or e.g. 210x297mm)")
+	pdfCmd.Flags().StringVar(&pdfMargin, "margin", "0", "Page margin (e.g., 10mm, 0.5in, 36pt)")
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/image"
+	"nim/pkg/placeholder"
+)
+
+var (
+	placeholderAlgorithm  string
+	placeholderComponents string
+)
+
+// jsonPlaceholder describes the placeholder of a file in --json output
+type jsonPlaceholder struct {
+	File        string `json:"file"`
+	Algorithm   string `json:"algorithm"`
+	Placeholder string `json:"placeholder"`
+}
+
+var placeholderCmd = &cobra.Command{
+	Use:   "placeholder [files...]",
+	Short: "Print BlurHash, ThumbHash or LQIP placeholders of images",
+	Long: `Print a compact placeholder string for each image, to be decoded into a
+blurry preview by the page while the image loads.
+
+Algorithms:
+  blurhash   BlurHash (https://blurha.sh); --components sets the detail
+  thumbhash  ThumbHash (https://evanw.github.io/thumbhash), base64-encoded;
+             keeps the aspect ratio and transparency
+  lqip       a 24px wide blurred WebP preview as a data: URI (see also --lqip)`,
+	Example: `  nim placeholder photo.jpg
+  nim placeholder --algo thumbhash --json *.png
+  nim placeholder --components 3x4 portrait.jpg`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		algorithm := placeholder.Algorithm(strings.ToLower(placeholderAlgorithm))
+		x, y, err := image.ParseSize(placeholderComponents)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range args {
+			src, err := openSource(file, image.DefaultOptions())
+			if err != nil {
+				return err
+			}
+
+			var hash string
+			if algorithm == placeholder.AlgorithmBlurHash {
+				hash, err = placeholder.BlurHash(src.img, x, y)
+			} else {
+				hash, err = placeholder.Compute(src.img, algorithm)
+			}
+			if err != nil {
+				return err
+			}
+
+			report.Placeholders = append(report.Placeholders, jsonPlaceholder{File: file, Algorithm: string(algorithm), Placeholder: hash})
+			printResult("%s  %s\n", hash, file)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(placeholderCmd)
+
+	placeholderCmd.Flags().StringVar(&placeholderAlgorithm, "algo", string(placeholder.AlgorithmBlurHash), "Placeholder algorithm (blurhash, thumbhash, lqip)")
+	placeholderCmd.Flags().StringVar(&placeholderComponents, "components", "4x3", "Horizontal and vertical BlurHash components in format XxY (1-9 each)")
+}
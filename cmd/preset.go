@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"nim/pkg/config"
+	"nim/pkg/presets"
+)
+
+// presetExcludedFlags are flags of the main command that cannot be saved in a
+// preset; shared flags such as --overwrite are excluded as well
+var presetExcludedFlags = []string{"input", "output", "help", "preset"}
+
+var presetCmd = &cobra.Command{
+	Use:   "preset",
+	Short: "List, show and save named presets",
+	Long: `Presets are named sets of flag values, applied with --preset. nim bundles
+the thumbnail, avatar and og-image presets, and user-defined presets are stored
+under presets in the configuration file.
+
+Crop presets, applied with --crop-preset, are the image specs of platforms
+such as instagram-square, youtube-thumb and twitter-header: the exact size,
+the resize mode and the quality, with the format to write outputs without an
+extension in. nim preset list shows them with their specs.`,
+}
+
+var presetListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the available presets",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, preset := range presets.All(cfg.Presets) {
+			source := "user"
+			if preset.Builtin {
+				source = "bundled"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", preset.Name, source, preset.Description)
+		}
+		for _, crop := range presets.Crops {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", crop.Name, "crop", crop.Preset().Description)
+		}
+		return w.Flush()
+	},
+}
+
+var presetShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Show the flag values of a preset",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		preset, ok := presets.Lookup(args[0], cfg.Presets)
+		crop, isCrop := presets.LookupCrop(args[0])
+		if !ok && isCrop {
+			preset = crop.Preset()
+		} else if !ok {
+			return fmt.Errorf("unknown preset: %s (see nim preset list)", args[0])
+		}
+
+		if preset.Description != "" {
+			fmt.Printf("# %s\n", preset.Description)
+		}
+		for _, key := range preset.Keys() {
+			fmt.Printf("%s: %s\n", key, preset.Values[key])
+		}
+		if !ok {
+			fmt.Printf("# Outputs without an extension are written as %s\n", crop.Format)
+		}
+		return nil
+	},
+}
+
+var presetSaveCmd = &cobra.Command{
+	Use:   "save [name] [flags]",
+	Short: "Save flag values as a user-defined preset",
+	Long: `Save the given flags of the main command as a preset in the user
+configuration file, or in .nim.yaml with --project. A preset with the same
+name is replaced.`,
+	Example: `  nim preset save hero -s 1600x900 -m fill -q 82 --description "Homepage hero"
+  nim preset save card -s 600x400 -f webp --project`,
+	// Flags are those of the main command, so they are parsed in RunE
+	DisableFlagParsing: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := pflag.NewFlagSet("preset save", pflag.ContinueOnError)
+		rootCmd.LocalNonPersistentFlags().VisitAll(func(flag *pflag.Flag) {
+			if !slices.Contains(presetExcludedFlags, flag.Name) {
+				flags.AddFlag(flag)
+			}
+		})
+		description := flags.String("description", "", "Description of the preset")
+		project := flags.Bool("project", false, "Save to .nim.yaml in the working directory instead of the user configuration")
+		help := flags.BoolP("help", "h", false, "Help for save")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if *help {
+			cmd.Println(cmd.Long + "\n\nUsage:\n  nim preset save [name] [flags]\n\nExamples:\n" + cmd.Example + "\n\nFlags:\n" + flags.FlagUsages())
+			return nil
+		}
+		if flags.NArg() != 1 {
+			return fmt.Errorf("expected one preset name, got %d arguments", flags.NArg())
+		}
+		name := flags.Arg(0)
+
+		values := map[string]string{}
+		flags.Visit(func(flag *pflag.Flag) {
+			switch flag.Name {
+			case "description", "project", "help":
+				return
+			}
+			if slice, ok := flag.Value.(pflag.SliceValue); ok {
+				values[flag.Name] = strings.Join(slice.GetSlice(), ",")
+				return
+			}
+			values[flag.Name] = flag.Value.String()
+		})
+		if len(values) == 0 {
+			return fmt.Errorf("no flags given to save in preset %s", name)
+		}
+		if *description != "" {
+			values[presets.DescriptionKey] = *description
+		}
+
+		path, err := config.UserPath()
+		if err != nil {
+			return err
+		}
+		if *project {
+			path = config.FileName
+		}
+		if err := config.SavePreset(path, name, values); err != nil {
+			return err
+		}
+		printf("Preset saved successfully: %s -> %s\n", name, path)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(presetCmd)
+	presetCmd.AddCommand(presetListCmd, presetShowCmd, presetSaveCmd)
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/image"
+	"nim/pkg/pyramid"
+)
+
+var (
+	pyramidOutput   string
+	pyramidLayout   string
+	pyramidTileSize int
+	pyramidOverlap  int
+	pyramidFormat   string
+	pyramidQuality  int
+	pyramidID       string
+	pyramidJobs     int
+)
+
+var pyramidCmd = &cobra.Command{
+	Use:   "pyramid [input]",
+	Short: "Tile a large image for zoomable viewers (Deep Zoom or IIIF)",
+	Long: `Cut an image into the tile pyramid of zoomable viewers such as
+OpenSeadragon, Leaflet and Mirador. Each level of the pyramid halves the one
+above it, and the tiles of every level are encoded at once on every CPU.
+
+  dzi    Deep Zoom: OUTPUT.dzi and the tiles in OUTPUT_files/LEVEL/COL_ROW.jpg,
+         with levels down to a single pixel (tiles of 254 pixels and an
+         overlap of 1 by default)
+  iiif   IIIF Image API 3.0 level 0 static tiles: OUTPUT/info.json and the
+         tiles in OUTPUT/X,Y,W,H/W,H/0/default.jpg, for any web server
+         (tiles of 512 pixels by default); --id sets the URI the folder is
+         served at
+
+PNG and TIFF inputs are read a row at a time, so gigapixel scans and maps far
+larger than memory can be tiled; other formats are decoded whole first. The
+.dzi or info.json file is written last, once every tile is. Use --format png
+or webp for images with transparency.`,
+	Example: `  nim pyramid scan.tiff -o scan.dzi
+  nim pyramid map.png -o tiles/map --layout iiif --id https://example.com/iiif/map
+  nim pyramid photo.jpg -o photo --tile-size 510 --overlap 2 --format webp -q 80`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if pyramidOutput == "" {
+			return usageErrorf("output is required")
+		}
+		layout, err := pyramid.ParseLayout(pyramidLayout)
+		if err != nil {
+			return markUsage(err)
+		}
+
+		options := pyramid.DefaultOptions()
+		options.Layout = layout
+		options.Format = strings.TrimPrefix(strings.ToLower(pyramidFormat), ".")
+		if options.Format == "jpeg" {
+			options.Format = "jpg"
+		}
+		options.Quality = pyramidQuality
+		options.ID = pyramidID
+		options.Workers = pyramidJobs
+		if layout == pyramid.LayoutIIIF {
+			options.TileSize, options.Overlap = 512, 0
+		}
+		if cmd.Flags().Changed("tile-size") {
+			options.TileSize = pyramidTileSize
+		}
+		if cmd.Flags().Changed("overlap") {
+			options.Overlap = pyramidOverlap
+		}
+		switch {
+		case options.TileSize < 1:
+			return usageErrorf("invalid --tile-size: %d (expected 1 or more)", options.TileSize)
+		case options.Overlap < 0 || options.Overlap > options.TileSize:
+			return usageErrorf("invalid --overlap: %d (expected 0 to the tile size)", options.Overlap)
+		case layout == pyramid.LayoutIIIF && options.Overlap > 0:
+			return usageErrorf("--overlap cannot be used with --layout iiif")
+		case !slices.Contains(pyramid.Formats, options.Format):
+			return usageErrorf("invalid --format: %s (expected %s)", pyramidFormat, strings.Join(pyramid.Formats, ", "))
+		case pyramidQuality < 1 || pyramidQuality > 100:
+			return usageErrorf("invalid --quality: %d (expected 1-100)", pyramidQuality)
+		case pyramidJobs < 0:
+			return usageErrorf("invalid --jobs: %d (expected 0 or more)", pyramidJobs)
+		case pyramidID != "" && layout != pyramid.LayoutIIIF:
+			return usageErrorf("--id requires --layout iiif")
+		}
+
+		// A Deep Zoom pyramid is named by its .dzi file, an IIIF one by its
+		// folder
+		output := pyramidOutput
+		if layout == pyramid.LayoutDZI && !strings.EqualFold(filepath.Ext(output), ".dzi") {
+			output += ".dzi"
+		}
+		start := time.Now()
+		path, ok, err := resolveOutput(output, args[0])
+		if err != nil || !ok {
+			return err
+		}
+
+		src, err := image.OpenRows(args[0], image.DefaultOptions())
+		if err != nil {
+			return fmt.Errorf("failed to open image: %w", err)
+		}
+		defer src.Close()
+
+		// Redraw the progress bar once per percent of the rows read
+		update, stop := startBar(src.Size().Y)
+		step := max(src.Size().Y/100, 1)
+		options.Progress = func(done, total int) {
+			if done%step == 0 || done == total {
+				update(done, filepath.Base(args[0]))
+			}
+		}
+		result, err := pyramid.Generate(src, path, options)
+		stop()
+		if err != nil {
+			return err
+		}
+
+		if err := recordFile(args, result.Descriptor, start); err != nil {
+			return err
+		}
+		printf("Pyramid created successfully: %s (%dx%d) -> %s, %d levels, %d tiles\n",
+			args[0], result.Width, result.Height, result.Descriptor, result.Levels, result.Tiles)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pyramidCmd)
+
+	pyramidCmd.Flags().StringVarP(&pyramidOutput, "output", "o", "", "Output .dzi file, or folder with --layout iiif")
+	pyramidCmd.Flags().StringVar(&pyramidLayout, "layout", "dzi", "Layout of the tiles (dzi, iiif)")
+	pyramidCmd.Flags().IntVar(&pyramidTileSize, "tile-size", 254, "Width and height of tiles, without the overlap; 512 unless given with --layout iiif")
+	pyramidCmd.Flags().IntVar(&pyramidOverlap, "overlap", 1, "Pixels each Deep Zoom tile repeats of its neighbors")
+	pyramidCmd.Flags().StringVarP(&pyramidFormat, "format", "f", "jpg", "Format of the tiles (jpg, png, webp)")
+	pyramidCmd.Flags().IntVarP(&pyramidQuality, "quality", "q", 85, "Quality of JPEG and WebP tiles (1-100)")
+	pyramidCmd.Flags().StringVar(&pyramidID, "id", "", "URI the IIIF folder is served at, for info.json (default: the folder name)")
+	pyramidCmd.Flags().IntVar(&pyramidJobs, "jobs", 0, "Tiles encoded at once (default: one per CPU)")
+}
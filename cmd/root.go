@@ -1,12 +1,36 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
+	stdimage "image"
+	"image/color"
+	"io"
+	"log/slog"
+	"math"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
+	"nim/pkg/archive"
+	"nim/pkg/batch"
+	"nim/pkg/colorparse"
+	"nim/pkg/config"
 	"nim/pkg/image"
+	"nim/pkg/pipeline"
+	"nim/pkg/placeholder"
+	"nim/pkg/plugin"
+	"nim/pkg/presets"
+	"nim/pkg/progress"
+	"nim/pkg/video"
 )
 
 var (
@@ -16,129 +40,2072 @@ var (
 	height       int
 	size         string
 	resizeMode   string
-	quality      int
+	quality      string
 	outputFormat string
 	padColor     string
+	fromVideo    string
+	fromClip     bool
+	toClip       bool
+	frameAt      string
+	frameEvery   string
+	gridColumns  int
+	rawWB        string
+	rawExposure  float64
+	rawDemosaic  string
+	rawHalf      bool
+	toneMap      string
+	hdrExposure  float64
+	netpbmPlain  bool
+	page         int
+	frame        string
+	dpi          float64
+	pageSize     string
+	pageMargin   string
+	allPages     bool
+	hotspot      string
+	icoSizes     string
+	iconset      bool
+	gridLayout   string
+	gridSelect   string
+	widths       string
+	srcset       bool
+	cropRegion   string
+	rotate       int
+	order        string
+	ops          []string
+	plugins      []string
+	simulate     string
+	daltonize    string
+	autoContrast bool
+	autoWB       bool
+	levels       []string
+	vignette     string
+	grain        string
+	deskew       string
+	shadow       string
+	extent       string
+	anchor       string
+	lqip         bool
+	lqipWidth    int
+	lqipFormat   string
+	maxBytes     string
+	maxMemory    string
+	hashAlgo     string
+	bestEffort   bool
+	reproducible bool
+	onError      string
+	failedList   string
+	filesFrom    string
+	nullList     bool
+	journalFile  string
+	density      float64
+	exifThumb    bool
+	progressive  bool
+	pngLevel     string
+	pngFilter    string
+	pngReduce    bool
+	interlace    bool
+	optimize     bool
+	webpLossless bool
+	webpNear     int
+	webpMethod   int
+	webpAlpha    int
+	webpExact    bool
+	avifSpeed    int
+	avifChroma   string
+	avifColor    string
+	avifAlpha    int
+	avifLossless bool
+	avifThreads  int
+
+	overwrite        bool
+	noOverwrite      bool
+	skipExisting     bool
+	renameOnConflict bool
+	overwritePolicy  image.OverwritePolicy
+	fsync            string
+	backup           bool
+	backupSuffix     string
+	noProgress       bool
+	warningsAsErrors bool
+	jsonOutput       bool
+	verbosity        int
+	quiet            bool
+	configFile       string
+	presetName       string
+	cropPresetName   string
+	cropFormat       string // Format recommended by --crop-preset, for outputs without an extension
+
+	// display is the progress indicator currently drawn on stderr, if any
+	display progress.Display
+	// report collects the files written, and what other commands found, for
+	// --json
+	report jsonReport
+	// opChain runs the --op steps, if any
+	opChain *pipeline.Pipeline
+	// effectChain runs the effects such as --simulate, if any
+	effectChain *pipeline.Pipeline
+	// pluginChain runs the --plugin filters, if any
+	pluginChain *pipeline.Pipeline
+	// registerPlugins registers the codec plugins in PATH once per process
+	registerPlugins sync.Once
 )
 
+// operationFlags maps each operation to the flags that configure it, so the
+// order of operations can follow the order of flags on the command line
+var operationFlags = map[string][]string{
+	image.OperationCrop:   {"crop"},
+	image.OperationResize: {"width", "w", "height", "H", "size", "s", "mode", "m"},
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "nim [input] [output]",
 	Short: "Nim is an image manipulation tool",
 	Long: `Nim is a cross-platform CLI tool for image manipulation.
-It can resize, crop, pad, and convert images between formats.`,
+It can resize, crop, pad, and convert images between formats.
+
+Operations run in the order their flags appear on the command line, so
+"--crop 400x400+0+0 -s 200x200" crops first while "-s 800x800 --crop 400x400+0+0"
+resizes first. Use --order to set the order explicitly.
+
+For longer chains, --op adds one step at a time and the steps run in the order
+given, e.g. "--op crop=800x800+10+10 --op resize=400x400:fit --op blur=2".
+Steps are the same as in pipeline recipes (see nim run --help).`,
 	Example: `  nim -i input.jpg -o output.png -w 800 -H 600
   nim -i input.png -o output.jpg -s 1024x768 -q 90
   nim -i input.gif -o output.webp -s 300x300 -m stretch -p "#FF0000"
   nim input.jpg output.png -w 800 -H 600
-  nim input.jpg output.png`,
+  nim input.jpg output.png
+  nim input.jpg output.png -s 800x800 -m fill --crop 400x400+200+200
+  nim input.jpg output.png --crop 1000x1000+50+50 --order crop,resize
+  nim in.jpg out.webp --op crop=800x800+10+10 --op resize=400x400:fit --op blur=2
+  nim manual.pdf page3.png --page 3 --dpi 300
+  nim scan.tiff page-{page}.png --all-pages
+  nim sprites.png "sprite-{cell}.png" --grid 4x8
+  nim contact-sheet.jpg photo.jpg --grid 3x4 --select 5
+  nim photo.jpg "photo-{w}w.webp" --widths 320,640,1024,1920 --srcset
+  nim photo.jpg --lqip -s 800x600 -m fill
+  nim photo.jpg hero.jpg -s 1200x800 -f avif,webp,jpg
+  nim photo.jpg upload.jpg --max-bytes 200KB
+  nim logo.png "dist/logo.{hash:8}.webp" --hash xxhash
+  nim photo.jpg web.webp -q auto:ssim=0.97
+  nim logo.png AppIcon.icns -s 1024x1024 --iconset
+  nim pointer.png pointer.cur -s 32x32 --hotspot 4,2
+  nim --from-video movie.mp4 --at 00:01:23 poster.jpg -s 1280x720
+  nim --from-video movie.mp4 --every 10s grid.jpg -s 320x180 --columns 5
+  nim --from-clipboard screenshot.webp -s 1280x800
+  nim photos.zip web.zip -s 1600x1600 -f webp
+  find photos -name '*.jpg' -print0 | nim --files-from - --null "web/{name}.webp" -s 1600x1600
+  nim --from-clipboard --to-clipboard -s 800x600`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		cfg, unknown, err := applyConfig(cmd)
+		if err != nil {
+			return err
+		}
+		configRules = cfg.Rules
+		if !cmd.HasParent() && presetName != "" {
+			preset, ok := presets.Lookup(presetName, cfg.Presets)
+			if !ok {
+				return usageErrorf("unknown preset: %s (see nim preset list)", presetName)
+			}
+			if err := applyPreset(cmd, preset); err != nil {
+				return err
+			}
+		}
+		// A crop preset is applied last, so its size wins over --preset
+		cropFormat = ""
+		if !cmd.HasParent() && cropPresetName != "" {
+			crop, ok := presets.LookupCrop(cropPresetName)
+			if !ok {
+				return usageErrorf("unknown crop preset: %s (see nim preset list)", cropPresetName)
+			}
+			if err := applyPreset(cmd, crop.Preset()); err != nil {
+				return err
+			}
+			cropFormat = crop.Format
+		}
+		overwritePolicy = parseOverwritePolicy()
+		if err := setWriteOptions(); err != nil {
+			return markUsage(err)
+		}
+		slog.SetDefault(newLogger(os.Stderr))
+		for _, key := range unknown {
+			slog.Warn("ignoring unknown configuration key", "key", key)
+		}
+		registerPlugins.Do(func() {
+			for _, err := range plugin.RegisterCodecs() {
+				slog.Warn("ignoring codec plugin", "error", err)
+			}
+		})
+		return setupSandbox(cmd)
+	},
+	// Positional arguments are validated below; this keeps cobra from treating them as subcommands
+	Args: cobra.ArbitraryArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Handle positional arguments
 		if len(args) > 2 {
-			return fmt.Errorf("too many arguments: expected at most 2 arguments (input and output files)")
+			return usageErrorf("too many arguments: expected at most 2 arguments (input and output files)")
 		} else if len(args) == 2 {
 			// Two args: input and output
 			inputFile = args[0]
 			outputFile = args[1]
+		} else if len(args) == 1 && (lqip || toClip) && inputFile == "" && !fromClip {
+			// One arg with --lqip or --to-clipboard: input only, no output file is written
+			inputFile = args[0]
 		} else if len(args) == 1 {
 			// One arg: output only
 			outputFile = args[0]
 		}
+		// An output without an extension takes the format of --crop-preset
+		if cropFormat != "" && outputFormat == "" && outputFile != "" && filepath.Ext(outputFile) == "" {
+			outputFile += "." + cropFormat
+		}
+
+		// A sidecar file next to the input overrides the flags for it
+		if inputFile != "" && filesFrom == "" {
+			restore, _, err := applySidecar(cmd, inputFile)
+			if err != nil {
+				return err
+			}
+			defer restore()
+		}
 
 		// Check if input and output files are provided
-		if inputFile == "" {
-			return fmt.Errorf("input file is required")
+		if filesFrom != "" {
+			if inputFile != "" || fromVideo != "" || fromClip || toClip {
+				return usageErrorf("--files-from cannot be used with an input file, --from-video or the clipboard")
+			}
+		} else if inputFile == "" && fromVideo == "" && !fromClip {
+			return usageErrorf("input file is required")
+		}
+		if nullList && filesFrom == "" {
+			return usageErrorf("--null requires --files-from")
+		}
+		if journalFile != "" && (filesFrom == "" || filesFrom == "-") {
+			return usageErrorf("--journal requires --files-from with a list file")
+		}
+		if outputFile == "" && !lqip && !toClip && filesFrom == "" {
+			return usageErrorf("output file is required")
+		}
+		if fromClip && (inputFile != "" || fromVideo != "") {
+			return usageErrorf("--from-clipboard cannot be used with an input file or --from-video")
 		}
-		if outputFile == "" {
-			return fmt.Errorf("output file is required")
+		if toClip && outputFile != "" {
+			return usageErrorf("--to-clipboard cannot be used with an output file")
+		}
+		if (fromClip || toClip) && (widths != "" || allPages || iconset) {
+			return usageErrorf("--from-clipboard and --to-clipboard cannot be used with --widths, --all-pages or --iconset")
+		}
+		if gridLayout != "" && (widths != "" || allPages || iconset || fromVideo != "" || toClip || lqip || filesFrom != "") {
+			return usageErrorf("--grid cannot be used with --widths, --all-pages, --iconset, --from-video, --to-clipboard, --lqip or --files-from")
+		}
+		if cmd.Flags().Changed("select") && gridLayout == "" {
+			return usageErrorf("--select requires --grid")
+		}
+		if lqip && lqipWidth <= 0 {
+			return usageErrorf("invalid LQIP width: %d", lqipWidth)
 		}
 
-		// Parse size if provided
-		if size != "" {
-			parts := strings.Split(size, "x")
-			if len(parts) != 2 {
-				return fmt.Errorf("invalid size format: %s (expected WIDTHxHEIGHT)", size)
-			}
+		c, err := parseConversion(cmd)
+		if err != nil {
+			return markUsage(err)
+		}
 
-			w, err := strconv.Atoi(parts[0])
+		// Convert every file of a --files-from list, or the single input
+		if filesFrom != "" {
+			return processList(cmd, c)
+		}
+		return convert(cmd, c.options, c.formats, c.policy)
+	},
+	// Print the previews of the files written once they are all done, so
+	// --lqip works the same for every kind of output
+	PostRunE: func(cmd *cobra.Command, args []string) error {
+		if !lqip {
+			return nil
+		}
+		for _, output := range report.Outputs {
+			if output.Skipped {
+				continue
+			}
+			img, err := image.OpenImage(output.Output)
 			if err != nil {
-				return fmt.Errorf("invalid width in size: %s", parts[0])
+				slog.Warn("no LQIP for output", "file", output.Output, "error", err)
+				continue
+			}
+			if err := printLQIP(output.Output, img); err != nil {
+				return err
 			}
+		}
+		return nil
+	},
+}
 
-			h, err := strconv.Atoi(parts[1])
-			if err != nil {
-				return fmt.Errorf("invalid height in size: %s", parts[1])
+// conversion is what the flags of the main command ask of each input
+type conversion struct {
+	options image.ProcessOptions
+	formats []string
+	policy  batch.Policy
+}
+
+// parseConversion checks and parses the flags of the main command into the
+// options of a conversion
+func parseConversion(cmd *cobra.Command) (conversion, error) {
+	// Parse size if provided
+	if size != "" {
+		w, h, err := image.ParseSize(size)
+		if err != nil {
+			return conversion{}, err
+		}
+		width = w
+		height = h
+	}
+
+	// Parse resize mode
+	mode, err := parseResizeMode(resizeMode)
+	if err != nil {
+		return conversion{}, err
+	}
+
+	// Parse pad color
+	padColorRGBA := color.NRGBA{255, 255, 255, 255} // Default to white
+	if padColor != "" {
+		padColorRGBA, err = image.ParseHexColor(padColor)
+		if err != nil {
+			return conversion{}, fmt.Errorf("invalid --pad-color %s: %w", padColor, err)
+		}
+	}
+	if !alphaOutput() {
+		padColorRGBA = image.FlattenColor(padColorRGBA)
+	}
+
+	// Validate RAW development settings
+	switch strings.ToLower(rawWB) {
+	case "camera", "auto", "daylight":
+	default:
+		return conversion{}, fmt.Errorf("invalid RAW white balance: %s (expected camera, auto, or daylight)", rawWB)
+	}
+	switch strings.ToLower(rawDemosaic) {
+	case "linear", "vng", "ppg", "ahd":
+	default:
+		return conversion{}, fmt.Errorf("invalid RAW demosaic algorithm: %s (expected linear, vng, ppg, or ahd)", rawDemosaic)
+	}
+
+	// Validate the tone mapping operator
+	switch strings.ToLower(toneMap) {
+	case image.ToneMapReinhard, image.ToneMapACES, image.ToneMapClamp:
+	default:
+		return conversion{}, fmt.Errorf("invalid tone mapping operator: %s (expected reinhard, aces, or clamp)", toneMap)
+	}
+
+	// Validate page selection and rendering resolution
+	if page < 1 {
+		return conversion{}, fmt.Errorf("invalid page: %d (pages are numbered from 1)", page)
+	}
+	if allPages && cmd.Flags().Changed("page") {
+		return conversion{}, fmt.Errorf("--page and --all-pages cannot be used together")
+	}
+	if dpi <= 0 {
+		return conversion{}, fmt.Errorf("invalid DPI: %g", dpi)
+	}
+	var frameNumber int
+	if frame != "" {
+		if allPages {
+			return conversion{}, fmt.Errorf("--frame and --all-pages cannot be used together")
+		}
+		if frameNumber, err = image.ParseFrame(frame); err != nil {
+			return conversion{}, err
+		}
+	}
+
+	// Parse the page layout of PDF output
+	layout, err := parsePDFLayout(pageSize, pageMargin)
+	if err != nil {
+		return conversion{}, err
+	}
+
+	// Parse the cursor hotspot
+	var hotspotPoint stdimage.Point
+	if hotspot != "" {
+		hotspotPoint, err = parsePoint(hotspot)
+		if err != nil {
+			return conversion{}, err
+		}
+	}
+
+	// Parse ICO frame sizes
+	var icoSizeList []int
+	if icoSizes != "" {
+		icoSizeList, err = parseInts(icoSizes)
+		if err != nil {
+			return conversion{}, fmt.Errorf("invalid ICO sizes: %w", err)
+		}
+	}
+
+	// Parse the rotation, which comes before the crop
+	rotation, err := image.ParseRotation(rotate)
+	if err != nil {
+		return conversion{}, err
+	}
+	if rotation != 0 && len(ops) > 0 {
+		return conversion{}, fmt.Errorf("--rotate cannot be used with --op")
+	}
+
+	// Parse crop region
+	var crop stdimage.Rectangle
+	if cropRegion != "" {
+		var err error
+		crop, err = image.ParseGeometry(cropRegion)
+		if err != nil {
+			return conversion{}, err
+		}
+	}
+
+	// Determine the order of operations, either explicitly or from the flag order
+	var operations []string
+	if order != "" {
+		for _, operation := range strings.Split(order, ",") {
+			operation = strings.ToLower(strings.TrimSpace(operation))
+			if _, ok := operationFlags[operation]; !ok {
+				return conversion{}, fmt.Errorf("invalid operation in order: %s (expected crop or resize)", operation)
+			}
+			if slices.Contains(operations, operation) {
+				return conversion{}, fmt.Errorf("duplicate operation in order: %s", operation)
 			}
+			operations = append(operations, operation)
+		}
+	} else {
+		operations = flagOrder(runArgs())
+	}
 
-			width = w
-			height = h
+	// --extent places the image, --deskew levels it, and --grid writes the
+	// cells, at their own size unless a size is given
+	if (extent != "" || deskew != "" || gridLayout != "") && !slices.ContainsFunc([]string{"width", "height", "size", "mode"}, cmd.Flags().Changed) {
+		operations = []string{image.OperationCrop}
+	}
+	if cmd.Flags().Changed("anchor") && extent == "" {
+		return conversion{}, fmt.Errorf("--anchor requires --extent")
+	}
+
+	// Steps given with --op replace --crop and the resize flags
+	opChain, pluginChain = nil, nil
+	if len(ops) > 0 {
+		for _, name := range []string{"crop", "order", "width", "height", "size", "mode"} {
+			if cmd.Flags().Changed(name) {
+				return conversion{}, fmt.Errorf("--op cannot be used with --%s: give cropping and resizing as --op steps too", name)
+			}
 		}
+		if widths != "" || allPages {
+			return conversion{}, fmt.Errorf("--op cannot be used with --widths or --all-pages")
+		}
+		if opChain, err = parseOps(ops); err != nil {
+			return conversion{}, err
+		}
+	}
+
+	// Effects run after the resize, and before the --plugin filters
+	if effectChain, err = parseEffects(); err != nil {
+		return conversion{}, err
+	}
+	if effectChain != nil && widths != "" {
+		return conversion{}, fmt.Errorf("--deskew, --auto-contrast, --auto-wb, --levels, --vignette, --grain, --shadow, --extent, --simulate and --daltonize cannot be used with --widths")
+	}
 
-		// Parse resize mode
-		var mode image.ResizeMode
-		switch strings.ToLower(resizeMode) {
-		case "fit":
-			mode = image.ResizeModeFit
-		case "fill":
-			mode = image.ResizeModeFill
-		case "stretch":
-			mode = image.ResizeModeStretch
-		default:
-			return fmt.Errorf("invalid resize mode: %s", resizeMode)
+	// Filters given with --plugin run after the other operations
+	if len(plugins) > 0 {
+		if widths != "" {
+			return conversion{}, fmt.Errorf("--plugin cannot be used with --widths")
 		}
+		if pluginChain, err = parsePlugins(plugins); err != nil {
+			return conversion{}, err
+		}
+	}
 
-		// Parse pad color
-		var padColorRGB [3]uint8
-		if padColor != "" {
-			// Remove # if present
-			padColor = strings.TrimPrefix(padColor, "#")
+	// Parse the quality, or the similarity target of --quality auto
+	qualityValue, targetSSIM, err := image.ParseQuality(quality)
+	if err != nil {
+		return conversion{}, err
+	}
 
-			// Parse hex color
-			if len(padColor) == 6 {
-				r, err := strconv.ParseUint(padColor[0:2], 16, 8)
-				if err != nil {
-					return fmt.Errorf("invalid pad color: %s", padColor)
-				}
-				g, err := strconv.ParseUint(padColor[2:4], 16, 8)
-				if err != nil {
-					return fmt.Errorf("invalid pad color: %s", padColor)
-				}
-				b, err := strconv.ParseUint(padColor[4:6], 16, 8)
-				if err != nil {
-					return fmt.Errorf("invalid pad color: %s", padColor)
+	// Parse the PNG compression settings
+	pngCompression, err := image.ParsePNGCompression(pngLevel)
+	if err != nil {
+		return conversion{}, err
+	}
+	switch strings.ToLower(pngFilter) {
+	case image.PNGFilterAdaptive, image.PNGFilterNone, image.PNGFilterSub, image.PNGFilterUp, image.PNGFilterAverage, image.PNGFilterPaeth:
+	default:
+		return conversion{}, fmt.Errorf("invalid PNG filter: %s (expected adaptive, none, sub, up, average, or paeth)", pngFilter)
+	}
+
+	// Check the WebP encoder settings
+	if webpNear < 1 || webpNear > 100 {
+		return conversion{}, fmt.Errorf("invalid --webp-near-lossless: %d (expected 1-100)", webpNear)
+	}
+	if webpMethod < 1 || webpMethod > 6 {
+		return conversion{}, fmt.Errorf("invalid --webp-method: %d (expected 1-6)", webpMethod)
+	}
+	if webpAlpha < 1 || webpAlpha > 100 {
+		return conversion{}, fmt.Errorf("invalid --webp-alpha-quality: %d (expected 1-100)", webpAlpha)
+	}
+
+	// Check the AVIF encoder settings
+	if avifSpeed < 1 || avifSpeed > 10 {
+		return conversion{}, fmt.Errorf("invalid --avif-speed: %d (expected 1-10)", avifSpeed)
+	}
+	switch avifChroma {
+	case image.AVIFChroma420, image.AVIFChroma422, image.AVIFChroma444:
+	default:
+		return conversion{}, fmt.Errorf("invalid --avif-chroma: %s (expected 420, 422, or 444)", avifChroma)
+	}
+	switch avifColor {
+	case image.AVIFColorSRGB, image.AVIFColorKeep:
+	default:
+		return conversion{}, fmt.Errorf("invalid --avif-color: %s (expected srgb or keep)", avifColor)
+	}
+	if avifAlpha < 0 || avifAlpha > 100 {
+		return conversion{}, fmt.Errorf("invalid --avif-alpha-quality: %d (expected 1-100, or 0 for the --quality)", avifAlpha)
+	}
+	if avifThreads < 0 {
+		return conversion{}, fmt.Errorf("invalid --avif-threads: %d (expected 0 or more)", avifThreads)
+	}
+
+	if density < 0 || density > 65535 {
+		return conversion{}, fmt.Errorf("invalid --density: %g (expected 1-65535 dpi)", density)
+	}
+
+	// Parse the output size budget
+	var budget int64
+	if maxBytes != "" {
+		if budget, err = image.ParseByteSize(maxBytes); err != nil {
+			return conversion{}, err
+		}
+	}
+
+	if err := image.ValidateHash(hashAlgo); err != nil {
+		return conversion{}, err
+	}
+	if _, err := image.ExpandEXIF(outputFile, image.EXIF{}); err != nil {
+		return conversion{}, err
+	}
+	policy, err := batch.ParsePolicy(onError)
+	if err != nil {
+		return conversion{}, err
+	}
+
+	// Parse the memory limit above which inputs are streamed
+	var memory int64
+	if maxMemory != "" {
+		if memory, err = image.ParseByteSize(maxMemory); err != nil {
+			return conversion{}, fmt.Errorf("invalid --max-memory: %w", err)
+		}
+	}
+
+	// Create options
+	options := image.ProcessOptions{
+		Width:        width,
+		Height:       height,
+		ResizeMode:   mode,
+		Quality:      qualityValue,
+		OutputFormat: outputFormat,
+		PadColor:     padColorRGBA,
+		Raw: image.RawOptions{
+			WhiteBalance: rawWB,
+			Exposure:     rawExposure,
+			Demosaic:     rawDemosaic,
+			HalfSize:     rawHalf,
+		},
+		HDR: image.HDROptions{
+			ToneMap:  toneMap,
+			Exposure: hdrExposure,
+		},
+		NetpbmPlain: netpbmPlain,
+		JPEG: image.JPEGOptions{
+			Progressive: progressive,
+			Thumbnail:   exifThumb,
+		},
+		PNG: image.PNGOptions{
+			Compression: pngCompression,
+			Filter:      pngFilter,
+			Reduce:      pngReduce,
+			Interlace:   interlace,
+			Optimize:    optimize,
+		},
+		WebP: image.WebPOptions{
+			Lossless:     webpLossless,
+			NearLossless: webpNear,
+			Method:       webpMethod,
+			AlphaQuality: webpAlpha,
+			Exact:        webpExact,
+		},
+		AVIF: image.AVIFOptions{
+			Speed:        avifSpeed,
+			Chroma:       avifChroma,
+			Color:        avifColor,
+			AlphaQuality: avifAlpha,
+			Lossless:     avifLossless,
+			Threads:      avifThreads,
+		},
+		Page:       page,
+		Frame:      frameNumber,
+		DPI:        dpi,
+		PDF:        layout,
+		Hotspot:    hotspotPoint,
+		IcoSizes:   icoSizeList,
+		Rotate:     rotation,
+		Crop:       crop,
+		Order:      operations,
+		TargetSSIM: targetSSIM,
+		MaxBytes:   budget,
+		MaxMemory:  memory,
+		Density:    density,
+		Hash:       journalHash(),
+		BestEffort: bestEffort,
+		Hooks:      stageHooks,
+	}
+
+	// Several comma-separated formats write sibling files from one decode
+	formats := strings.Split(outputFormat, ",")
+	for i, format := range formats {
+		formats[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(format, ".")))
+		if len(formats) > 1 && formats[i] == "" {
+			return conversion{}, fmt.Errorf("invalid format list: %s", outputFormat)
+		}
+	}
+	if len(formats) > 1 && (fromVideo != "" || allPages || iconset || toClip) {
+		return conversion{}, fmt.Errorf("multiple formats cannot be used with --from-video, --all-pages, --iconset or --to-clipboard")
+	}
+
+	return conversion{options, formats, policy}, nil
+}
+
+// convert processes inputFile into outputFile with the options of the
+// command line, in the way its flags ask for
+func convert(cmd *cobra.Command, options image.ProcessOptions, formats []string, policy batch.Policy) error {
+	// Process every image of an archive
+	if archive.IsArchive(inputFile) {
+		if fromClip || toClip || fromVideo != "" || widths != "" || allPages || iconset || lqip || gridLayout != "" {
+			return fmt.Errorf("archive input cannot be used with the clipboard, --from-video, --widths, --all-pages, --iconset, --lqip or --grid")
+		}
+		defer startSpinner(filepath.Base(inputFile), &options)()
+		count, err := processArchive(options, formats, policy)
+		if err := finishBatch(cmd, err); err != nil {
+			return err
+		}
+		printf("Archive processed successfully: %d images of %s -> %s\n", count, inputFile, outputFile)
+		return nil
+	}
+
+	// Read from or write to the clipboard instead of files
+	if fromClip || toClip {
+		return processClipboard(options, formats)
+	}
+
+	// Only print the preview of the processed input with --lqip and no output file
+	if outputFile == "" {
+		if fromVideo != "" {
+			return fmt.Errorf("output file is required with --from-video")
+		}
+		src, err := openSource(inputFile, options)
+		if err != nil {
+			return err
+		}
+		result, _, err := transform(src.img, options)
+		if err != nil {
+			return err
+		}
+		return printLQIP(inputFile, result)
+	}
+
+	// Show the stages of single conversions; --all-pages shows a progress bar instead
+	if !allPages {
+		label := inputFile
+		if fromVideo != "" {
+			label = fromVideo
+		}
+		defer startSpinner(filepath.Base(label), &options)()
+	}
+
+	// Extract frames from a video instead of reading an input image
+	if fromVideo != "" {
+		if err := processVideo(options); err != nil {
+			return err
+		}
+		printf("Video frames processed successfully: %s -> %s\n", fromVideo, outputFile)
+		return nil
+	}
+
+	// Write one output per width
+	if widths != "" {
+		widthList, err := parseInts(widths)
+		if err != nil {
+			return fmt.Errorf("invalid widths: %w", err)
+		}
+		files, err := processWidths(options, widthList, formats)
+		if err != nil {
+			return err
+		}
+		printf("Image processed successfully: %s -> %d files\n", inputFile, len(files))
+		if srcset {
+			printResult("%s\n", srcsetHTML(files))
+		}
+		return nil
+	}
+
+	// Convert every page of a multi-page input
+	if allPages {
+		count, err := processPages(options, policy)
+		if err := finishBatch(cmd, err); err != nil {
+			return err
+		}
+		printf("Pages processed successfully: %d pages of %s -> %s\n", count, inputFile, outputFile)
+		return nil
+	}
+
+	// Also write an .iconset folder for iconutil
+	if iconset {
+		dir, err := processIconset(options)
+		if err != nil {
+			return err
+		}
+		printf("Image processed successfully: %s -> %s, %s\n", inputFile, outputFile, dir)
+		return nil
+	}
+
+	// Slice the cells of a grid into outputs of their own
+	if gridLayout != "" {
+		files, err := processGrid(options, formats)
+		if err != nil {
+			return err
+		}
+		printf("Grid processed successfully: %s -> %s\n", inputFile, strings.Join(files, ", "))
+		return nil
+	}
+
+	// Keep the frames of animated inputs in animated WebP and AVIF output
+	if len(formats) == 1 {
+		done, err := processAnimation(options, formats[0])
+		if done || err != nil {
+			return err
+		}
+	}
+
+	// Encode the processed image in several formats
+	if len(formats) > 1 {
+		src, err := openSource(inputFile, options)
+		if err != nil {
+			return err
+		}
+		result, options, err := transform(src.img, options)
+		if err != nil {
+			return err
+		}
+		files, err := saveFormats(result, outputFile, options, formats, src)
+		if err != nil {
+			return err
+		}
+		printf("Image processed successfully: %s -> %s\n", inputFile, strings.Join(files, ", "))
+		return nil
+	}
+
+	// Run the --op steps, effects and --plugin filters
+	if opChain != nil || effectChain != nil || pluginChain != nil {
+		src, err := openSource(inputFile, options)
+		if err != nil {
+			return err
+		}
+		result, options, err := transform(src.img, options)
+		if err != nil {
+			return err
+		}
+		path, err := saveImage(result, outputFile, options, src)
+		if err != nil {
+			return err
+		}
+		printf("Image processed successfully: %s -> %s\n", inputFile, path)
+		return nil
+	}
+
+	// Process the image
+	path, ok, err := resolveOutput(outputFile, inputFile)
+	if err != nil || !ok {
+		return err
+	}
+	result, err := image.Process(inputFile, path, options)
+	if err != nil {
+		return err
+	}
+	record(result)
+
+	printf("Image processed successfully: %s -> %s\n", inputFile, result.Output)
+	return nil
+}
+
+// processAnimation converts every frame of an animated GIF, WebP or PNG
+// input into an animated WebP or AVIF. It returns false without converting
+// anything for still inputs, other output formats and a selected --frame.
+func processAnimation(options image.ProcessOptions, format string) (bool, error) {
+	if format == "" {
+		format = strings.ToLower(strings.TrimPrefix(filepath.Ext(outputFile), "."))
+	}
+	if options.Frame != 0 || !slices.Contains(image.AnimationFormats, format) {
+		return false, nil
+	}
+	// Animations are decoded in this process, so a sandboxed run converts
+	// the first frame, as Process does
+	if image.DecoderSet() {
+		slog.Debug("not decoding animation frames", "file", inputFile, "reason", "sandbox")
+		return false, nil
+	}
+	a, err := image.OpenAnimation(inputFile)
+	if err != nil || a == nil {
+		return err != nil, err
+	}
+	if options.MaxBytes > 0 {
+		return true, fmt.Errorf("--max-bytes cannot be used with animated output (use --frame to convert one frame)")
+	}
+
+	path, ok, err := resolveOutput(outputFile, inputFile)
+	if err != nil || !ok {
+		return true, err
+	}
+	options.OutputFormat = format
+	result, err := image.ProcessAnimation(a, inputFile, path, options, transform)
+	if err != nil {
+		return true, err
+	}
+	record(result)
+	printf("Animation processed successfully: %s -> %s, %d frames\n", inputFile, result.Output, a.Len())
+	return true, nil
+}
+
+// processVideo extracts frames from the input video and runs them through the
+// normal pipeline. A single frame (--at) becomes the output image, while
+// periodic frames (--every) are resized one by one, as they are extracted,
+// and tiled into a grid.
+func processVideo(options image.ProcessOptions) error {
+	if frameAt != "" && frameEvery != "" {
+		return fmt.Errorf("--at and --every cannot be used together")
+	}
+
+	if frameEvery == "" {
+		at := frameAt
+		if at == "" {
+			at = "0"
+		}
+		start := time.Now()
+		frame, err := video.ExtractFrame(fromVideo, at)
+		if err != nil {
+			return err
+		}
+		result, options, err := transform(frame, options)
+		if err != nil {
+			return err
+		}
+		_, err = saveImage(result, outputFile, options, source{fromVideo, frame, start})
+		return err
+	}
+
+	interval, err := time.ParseDuration(frameEvery)
+	if err != nil {
+		return fmt.Errorf("invalid frame interval: %s (expected a duration such as 10s or 1m)", frameEvery)
+	}
+	start := time.Now()
+	// Frames are resized as ffmpeg extracts them, so only their thumbnails
+	// are kept, with the first frame as the source of the output
+	var first stdimage.Image
+	var thumbs []stdimage.Image
+	encodeOptions := options
+	err = video.ExtractFrames(fromVideo, interval, func(frame stdimage.Image) error {
+		thumb, thumbOptions, err := transform(frame, options)
+		if err != nil {
+			return err
+		}
+		if first == nil {
+			first = frame
+		}
+		thumbs, encodeOptions = append(thumbs, thumb), thumbOptions
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = saveImage(image.Grid(thumbs, gridColumns, options.PadColor), outputFile, encodeOptions, source{fromVideo, first, start})
+	return err
+}
+
+// processClipboard runs a conversion that reads its input from the
+// clipboard, writes its output to the clipboard, or both
+func processClipboard(options image.ProcessOptions, formats []string) error {
+	label := inputFile
+	if fromClip {
+		label = "clipboard"
+	}
+	defer startSpinner(label, &options)()
+
+	var src source
+	var err error
+	if fromClip {
+		start := time.Now()
+		img, err := readClipboard()
+		if err != nil {
+			return err
+		}
+		src = source{"", img, start}
+	} else if src, err = openSource(inputFile, options); err != nil {
+		return err
+	}
+
+	result, options, err := transform(src.img, options)
+	if err != nil {
+		return err
+	}
+	if toClip {
+		if err := writeClipboard(result); err != nil {
+			return fmt.Errorf("failed to write to the clipboard: %w", err)
+		}
+		printf("Image processed successfully: %s -> clipboard\n", label)
+		return nil
+	}
+
+	files, err := saveFormats(result, outputFile, options, formats, src)
+	if err != nil {
+		return err
+	}
+	printf("Image processed successfully: clipboard -> %s\n", strings.Join(files, ", "))
+	return nil
+}
+
+// processPages converts every page of a multi-page TIFF input, naming each
+// output after the output file with {page} replaced by the page number
+func processPages(options image.ProcessOptions, policy batch.Policy) (int, error) {
+	switch strings.ToLower(filepath.Ext(inputFile)) {
+	case ".tif", ".tiff":
+	default:
+		return 0, fmt.Errorf("--all-pages requires a multi-page TIFF input")
+	}
+
+	file, err := os.Open(inputFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	count, err := image.TIFFPageCount(file)
+	file.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	var jobs []batch.Job
+	for p := 1; p <= count; p++ {
+		options.Page = p
+		path, ok, err := resolveOutput(pageFilename(outputFile, p, count), inputFile)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			jobs = append(jobs, batch.Job{Input: inputFile, Output: path, Options: options})
+		}
+	}
+
+	update, stop := startBar(len(jobs))
+	defer stop()
+	results, err := batch.RunWithPolicy(jobs, policy, func(done, total int, job batch.Job) {
+		update(done, filepath.Base(job.Output))
+	})
+	for _, result := range results {
+		record(result)
+	}
+	return count, err
+}
+
+// processList converts every file of the --files-from list in turn, as if
+// each were given on the command line. Entries without an output are named
+// after the output file with {name} replaced by the input name.
+func processList(cmd *cobra.Command, c conversion) error {
+	list := os.Stdin
+	if filesFrom != "-" {
+		file, err := os.Open(filesFrom)
+		if err != nil {
+			return fmt.Errorf("failed to open file list: %w", err)
+		}
+		defer file.Close()
+		list = file
+	}
+	entries, err := batch.ReadList(list, nullList)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no files in %s", filesFrom)
+	}
+
+	// Check every output before converting anything
+	template := outputFile
+	templated := make([]bool, len(entries))
+	for i, entry := range entries {
+		if entry.Output != "" {
+			continue
+		}
+		if template == "" {
+			return fmt.Errorf("no output for %s: give an output path with {name} or INPUT<TAB>OUTPUT entries", entry.Input)
+		}
+		if len(entries) > 1 && !strings.Contains(template, "{name}") {
+			return fmt.Errorf("the output path needs {name} with several files in --files-from")
+		}
+		entries[i].Output = pipeline.OutputPath(template, entry.Input)
+		templated[i] = true
+	}
+
+	journal, created, err := openListJournal()
+	if err != nil {
+		return err
+	}
+	if created {
+		defer journal.Close()
+	}
+
+	runner := batch.Runner{Policy: c.policy}
+	skipped := 0
+	for i, entry := range entries {
+		if journal != nil && journal.Completed(entry.Input, entry.Output) {
+			slog.Debug("skipping file completed before", "file", entry.Input)
+			skipped++
+			continue
+		}
+		inputFile, outputFile = entry.Input, entry.Output
+		if err := runner.Do(entry.Input, func() error {
+			if templated[i] {
+				if err := makeOutputDir(entry.Output); err != nil {
+					return err
 				}
-				padColorRGB = [3]uint8{uint8(r), uint8(g), uint8(b)}
-			} else {
-				return fmt.Errorf("invalid pad color format: %s (expected #RRGGBB)", padColor)
 			}
-		} else {
-			// Default to white
-			padColorRGB = [3]uint8{255, 255, 255}
+			first := len(report.Outputs)
+			if err := convertEntry(cmd, c); err != nil {
+				return err
+			}
+			return recordJournal(journal, entry, report.Outputs[first:])
+		}); err != nil {
+			return finishBatch(cmd, err)
 		}
+	}
+	if err := finishBatch(cmd, runner.Err()); err != nil {
+		return err
+	}
+	name := filesFrom
+	if name == "-" {
+		name = "stdin"
+	}
+	if skipped > 0 {
+		printf("Files processed successfully: %d files of %s, %d completed before\n", len(entries)-skipped, name, skipped)
+		return nil
+	}
+	printf("Files processed successfully: %d files of %s\n", len(entries), name)
+	return nil
+}
+
+// convertEntry converts inputFile like convert, with the flags of the
+// configuration rules it matches and of its sidecar file, if any, instead of
+// those of c
+func convertEntry(cmd *cobra.Command, c conversion) error {
+	restoreRules, matched, err := applyRules(cmd, inputFile)
+	if err != nil {
+		return err
+	}
+	defer restoreRules()
+	restore, applied, err := applySidecar(cmd, inputFile)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	if !matched && !applied {
+		return convert(cmd, c.options, c.formats, c.policy)
+	}
+	c, err = parseConversion(cmd)
+	if err != nil {
+		return err
+	}
+	return convert(cmd, c.options, c.formats, c.policy)
+}
 
-		// Create options
-		options := image.ProcessOptions{
-			Width:        width,
-			Height:       height,
-			ResizeMode:   mode,
-			Quality:      quality,
-			OutputFormat: outputFormat,
-			PadColor:     padColorRGB,
+// processIconset processes the input like ProcessImage, and also writes the
+// result as an .iconset folder named after the output file
+func processIconset(options image.ProcessOptions) (string, error) {
+	src, err := openSource(inputFile, options)
+	if err != nil {
+		return "", err
+	}
+	result, options, err := transform(src.img, options)
+	if err != nil {
+		return "", err
+	}
+	path, err := saveImage(result, outputFile, options, src)
+	if err != nil {
+		return "", err
+	}
+
+	dir := strings.TrimSuffix(path, filepath.Ext(path)) + ".iconset"
+	return dir, image.WriteIconset(dir, result)
+}
+
+// processGrid slices the input, laid out as a --grid of uniform cells, into
+// an output for each cell of --select, run through the other flags like a
+// whole image would be. It returns the paths written.
+func processGrid(options image.ProcessOptions, formats []string) ([]string, error) {
+	rows, columns, err := image.ParseGrid(gridLayout)
+	if err != nil {
+		return nil, err
+	}
+	count := rows * columns
+	var cells []int
+	if strings.EqualFold(gridSelect, "all") {
+		for n := 1; n <= count; n++ {
+			cells = append(cells, n)
 		}
+	} else if cells, err = parseInts(gridSelect); err != nil {
+		return nil, fmt.Errorf("invalid --select: %w (expected cell numbers or all)", err)
+	}
+	for _, n := range cells {
+		if n > count {
+			return nil, fmt.Errorf("invalid --select: cell %d is outside the %s grid of %d cells", n, gridLayout, count)
+		}
+	}
 
-		// Process the image
-		if err := image.ProcessImage(inputFile, outputFile, options); err != nil {
-			return err
+	src, err := openSource(inputFile, options)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, n := range cells {
+		path := outputFile
+		if len(cells) > 1 || strings.Contains(path, "{cell}") {
+			path = cellFilename(outputFile, n, count)
+		}
+		bounds := src.img.Bounds()
+		cell, err := image.Crop(src.img, image.GridCell(bounds.Dx(), bounds.Dy(), rows, columns, n))
+		if err != nil {
+			return nil, err
+		}
+		result, options, err := transform(cell, options)
+		if err != nil {
+			return nil, err
+		}
+		written, err := saveFormats(result, path, options, formats, src)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, written...)
+	}
+	return files, nil
+}
+
+// cellFilename expands {cell} in a filename template to the cell number,
+// zero-padded like pageFilename does
+func cellFilename(template string, cell, count int) string {
+	number := fmt.Sprintf("%0*d", len(strconv.Itoa(count)), cell)
+	return expandFilename(template, "{cell}", number, "-{cell}")
+}
+
+// pageFilename expands {page} in a filename template to the page number,
+// zero-padded so the files sort in page order. Templates without {page} get
+// "-{page}" appended before the extension.
+func pageFilename(template string, page, count int) string {
+	number := fmt.Sprintf("%0*d", len(strconv.Itoa(count)), page)
+	return expandFilename(template, "{page}", number, "-{page}")
+}
+
+// expandFilename replaces placeholder in a filename template with value. If
+// the template lacks the placeholder, fallback is inserted before the
+// extension first so every expansion yields a distinct name.
+func expandFilename(template, placeholder, value, fallback string) string {
+	if !strings.Contains(template, placeholder) {
+		ext := filepath.Ext(template)
+		template = strings.TrimSuffix(template, ext) + fallback + ext
+	}
+	return strings.ReplaceAll(template, placeholder, value)
+}
+
+// saveFormats writes img once per format, replacing the extension of path
+// with the format. A single empty format writes path as SaveImage does. The
+// returned paths account for renamed and skipped outputs.
+func saveFormats(img stdimage.Image, path string, options image.ProcessOptions, formats []string, src source) ([]string, error) {
+	if len(formats) == 1 {
+		options.OutputFormat = formats[0]
+		written, err := saveImage(img, path, options, src)
+		if err != nil {
+			return nil, err
 		}
+		return []string{written}, nil
+	}
+
+	files := make([]string, len(formats))
+	for i, format := range formats {
+		options.OutputFormat = format
+		written, err := saveImage(img, strings.TrimSuffix(path, filepath.Ext(path))+"."+format, options, src)
+		if err != nil {
+			return nil, err
+		}
+		files[i] = written
+	}
+	return files, nil
+}
+
+// templateOutput expands {name} in an output path to the name of input, and
+// creates the folder of the output, since templates name folders per input
+func templateOutput(template, input string) (string, error) {
+	path := pipeline.OutputPath(template, input)
+	if path == template {
+		return path, nil
+	}
+	return path, makeOutputDir(path)
+}
+
+// makeOutputDir creates the folder of an output path built from a template
+func makeOutputDir(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create output folder: %w", err)
+	}
+	return nil
+}
+
+// resolveOutput expands {exif.*} in an output path, applies the overwrite
+// policy to it and makes sure none of the inputs is overwritten. It returns
+// the path to write to, and false if an existing output is skipped.
+func resolveOutput(path string, inputs ...string) (string, bool, error) {
+	// Fill in {exif.*} from the first input, and make the folders they name
+	if image.HasEXIFPlaceholder(path) && len(inputs) > 0 {
+		exif, err := image.ReadEXIF(inputs[0])
+		if err != nil {
+			slog.Debug("no EXIF data for output name", "file", inputs[0], "error", err)
+		}
+		if path, err = image.ExpandEXIF(path, exif); err != nil {
+			return "", false, err
+		}
+		if err := makeOutputDir(path); err != nil {
+			return "", false, err
+		}
+	}
+
+	policy := overwritePolicy
+	if resumed != nil && resumed.Wrote(path) {
+		// The interrupted run wrote it, so it is no one else's to protect
+		policy = image.OverwriteAlways
+	}
+	resolved, err := image.ResolveOutput(path, policy)
+	switch {
+	case errors.Is(err, image.ErrOutputSkipped):
+		printf("Skipping %s: output already exists\n", path)
+		report.Outputs = append(report.Outputs, jsonResult{Inputs: inputs, Output: path, Skipped: true})
+		return path, false, nil
+	case errors.Is(err, image.ErrOutputExists):
+		return "", false, fmt.Errorf("%w (drop --no-overwrite, or use --skip-existing or --rename-on-conflict)", err)
+	case err != nil:
+		return "", false, err
+	}
+
+	// Outputs replace their path only once complete, so the input can be
+	// replaced too when a backup of it is kept
+	for _, input := range inputs {
+		if !backup && image.SameFile(input, resolved) {
+			return "", false, fmt.Errorf("output %s is the input file: refusing to overwrite it (use --backup to replace it in place)", resolved)
+		}
+	}
+	return resolved, true, nil
+}
+
+// source is a decoded input that outputs are written from
+type source struct {
+	path  string
+	img   stdimage.Image
+	start time.Time
+}
 
-		fmt.Printf("Image processed successfully: %s -> %s\n", inputFile, outputFile)
+// openSource decodes an input, noting when it was opened
+func openSource(path string, options image.ProcessOptions) (source, error) {
+	start := time.Now()
+	img, err := image.OpenImageWithOptions(path, options)
+	if err != nil {
+		return source{}, fmt.Errorf("failed to open image: %w", err)
+	}
+	return source{path, img, start}, nil
+}
+
+// saveImage writes img like SaveImage, following the overwrite policy,
+// --quality auto and the --max-bytes budget. It returns the path of the
+// output, which differs from path when the output was renamed.
+func saveImage(img stdimage.Image, path string, options image.ProcessOptions, src source) (string, error) {
+	resolved, ok, err := resolveOutput(path, src.path)
+	if err != nil || !ok {
+		return resolved, err
+	}
+	if options, err = image.KeepColor(src.path, resolved, options); err != nil {
+		return "", err
+	}
+	if options, err = image.AutoQuality(img, resolved, options); err != nil {
+		return "", err
+	}
+	img, options, err = image.FitBytes(img, resolved, options)
+	if err != nil {
+		return "", err
+	}
+	written, digest, err := image.WriteImage(img, resolved, options)
+	if err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", resolved, err)
+	}
+
+	result, err := image.NewResult(src.path, src.img, written, img, options, src.start)
+	if err != nil {
+		return "", err
+	}
+	result.Hash = digest
+	record(result)
+	return written, nil
+}
+
+// printLQIP prints the --lqip data URI of an image and adds it to the --json
+// placeholders
+func printLQIP(file string, img stdimage.Image) error {
+	options := placeholder.DefaultLQIPOptions()
+	options.Width = lqipWidth
+	options.Format = lqipFormat
+	uri, err := placeholder.LQIP(img, options)
+	if err != nil {
+		return fmt.Errorf("failed to create LQIP of %s: %w", file, err)
+	}
+	report.Placeholders = append(report.Placeholders, jsonPlaceholder{File: file, Algorithm: string(placeholder.AlgorithmLQIP), Placeholder: uri})
+	printResult("%s  %s\n", uri, file)
+	return nil
+}
+
+// jsonResult describes one output file in --json output
+type jsonResult struct {
+	Inputs         []string        `json:"inputs,omitempty"`
+	Output         string          `json:"output"`
+	InputFormat    string          `json:"input_format,omitempty"`
+	OutputFormat   string          `json:"output_format,omitempty"`
+	OriginalWidth  int             `json:"original_width,omitempty"`
+	OriginalHeight int             `json:"original_height,omitempty"`
+	Width          int             `json:"width,omitempty"`
+	Height         int             `json:"height,omitempty"`
+	Bytes          int64           `json:"bytes"`
+	Hash           string          `json:"hash,omitempty"`
+	Recovery       *image.Recovery `json:"recovery,omitempty"`
+	DurationMS     float64         `json:"duration_ms"`
+	Skipped        bool            `json:"skipped,omitempty"`
+	SavedBytes     int64           `json:"saved_bytes,omitempty"`
+}
+
+// jsonReport is the document --json writes to stdout
+type jsonReport struct {
+	Success      bool              `json:"success"`
+	Outputs      []jsonResult      `json:"outputs"`
+	Comparison   *jsonComparison   `json:"comparison,omitempty"`
+	Hashes       []jsonHash        `json:"hashes,omitempty"`
+	Duplicates   [][]string        `json:"duplicates,omitempty"`
+	Placeholders []jsonPlaceholder `json:"placeholders,omitempty"`
+	Histograms   []jsonHistogram   `json:"histograms,omitempty"`
+	Scores       []jsonScore       `json:"scores,omitempty"`
+	Benchmarks   []jsonBenchmark   `json:"benchmarks,omitempty"`
+	Watermarks   []jsonWatermark   `json:"watermarks,omitempty"`
+	Failures     []jsonFailure     `json:"failures,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// jsonFailure describes a file that failed in a multi-file run in --json
+// output
+type jsonFailure struct {
+	File     string `json:"file"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error"`
+}
+
+// finishBatch reports the files that failed in a multi-file run that ended
+// with err: it adds them to --json, writes them to --failed-list, and prints
+// a summary when the run went on after them. It returns err.
+func finishBatch(cmd *cobra.Command, err error) error {
+	var batchErr *batch.Errors
+	if !errors.As(err, &batchErr) {
+		batchErr = &batch.Errors{}
+	}
+	var list strings.Builder
+	for _, f := range batchErr.Failures {
+		report.Failures = append(report.Failures, jsonFailure{File: f.File, Attempts: f.Attempts, Error: f.Err.Error()})
+		list.WriteString(f.File + "\n")
+	}
+	if failedList != "" {
+		if writeErr := os.WriteFile(failedList, []byte(list.String()), 0o644); writeErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to write --failed-list: %w", writeErr))
+		}
+	}
+	if len(batchErr.Failures) > 0 && !batchErr.Aborted {
+		cmd.SilenceUsage = true
+		printf("%d of %d files failed:\n", len(batchErr.Failures), batchErr.Total)
+		for _, f := range batchErr.Failures {
+			printf("  %s: %v\n", f.File, f.Err)
+		}
+	}
+	return err
+}
+
+// record adds a processed image to the --json output
+func record(result image.Result) {
+	report.Outputs = append(report.Outputs, jsonResult{
+		Inputs:         []string{result.Input},
+		Output:         result.Output,
+		InputFormat:    result.InputFormat,
+		OutputFormat:   result.OutputFormat,
+		OriginalWidth:  result.OriginalWidth,
+		OriginalHeight: result.OriginalHeight,
+		Width:          result.Width,
+		Height:         result.Height,
+		Bytes:          result.Bytes,
+		Hash:           result.Hash,
+		Recovery:       result.Recovery,
+		DurationMS:     float64(result.Duration.Microseconds()) / 1000,
+	})
+}
+
+// recordFile adds a file written from inputs, such as a PDF or an icon set
+// file, to the --json output
+func recordFile(inputs []string, path string, start time.Time) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read output file: %w", err)
+	}
+	report.Outputs = append(report.Outputs, jsonResult{
+		Inputs:       inputs,
+		Output:       path,
+		OutputFormat: strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")),
+		Bytes:        info.Size(),
+		DurationMS:   float64(time.Since(start).Microseconds()) / 1000,
+	})
+	return nil
+}
+
+// writeJSON writes the --json report of a run that ended with err
+func writeJSON(err error) error {
+	out := report
+	out.Success = err == nil
+	if out.Outputs == nil {
+		out.Outputs = []jsonResult{}
+	}
+	if err != nil {
+		out.Error = err.Error()
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// printf prints a status message for humans, unless --quiet is given
+func printf(format string, a ...any) {
+	if quiet {
+		return
+	}
+	printResult(format, a...)
+}
+
+// printResult prints output meant for humans, such as an HTML snippet,
+// without breaking up the progress indicator. It goes to stdout, or to
+// stderr with --json.
+func printResult(format string, a ...any) {
+	var w io.Writer = os.Stdout
+	if jsonOutput {
+		w = os.Stderr
+	}
+	if display != nil {
+		display.Printf(w, format, a...)
+		return
+	}
+	fmt.Fprintf(w, format, a...)
+}
+
+// progressEnabled reports whether progress is drawn, which needs stderr to be
+// a terminal and no --no-progress. Progress is also hidden with --quiet, and
+// with -v so it does not get in the way of the log.
+func progressEnabled() bool {
+	return !noProgress && !quiet && verbosity == 0 && progress.IsTerminal(os.Stderr)
+}
+
+// newLogger returns the logger for the verbosity flags: warnings and errors
+// by default, errors only with --quiet, processing details with -v and
+// debugging details with -vv. It counts the warnings for
+// --warnings-as-errors.
+func newLogger(w io.Writer) *slog.Logger {
+	level := slog.LevelWarn
+	switch {
+	case quiet:
+		level = slog.LevelError
+	case verbosity == 1:
+		level = slog.LevelInfo
+	case verbosity >= 2:
+		level = slog.LevelDebug
+	}
+
+	return slog.New(warningCounter{slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: level,
+		// Timestamps are noise for a command-line tool
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	})})
+}
+
+// startSpinner shows a spinner with the name of each stage of options, and
+// its percentage where known, while a single conversion runs. The returned
+// function stops it.
+func startSpinner(label string, options *image.ProcessOptions) func() {
+	if !progressEnabled() {
+		return func() {}
+	}
+	spinner := progress.StartSpinner(os.Stderr, label)
+	next := options.Hooks
+	options.Hooks.OnStageStart = func(stage string) {
+		spinner.Stage(stage)
+		if next.OnStageStart != nil {
+			next.OnStageStart(stage)
+		}
+	}
+	options.Hooks.OnProgress = func(stage string, percent float64) {
+		spinner.Stage(fmt.Sprintf("%s %.0f%%", stage, percent))
+		if next.OnProgress != nil {
+			next.OnProgress(stage, percent)
+		}
+	}
+	display = spinner
+	return func() {
+		spinner.Stop()
+		display = nil
+	}
+}
+
+// startBar shows a progress bar over total items. The returned functions
+// update and erase it.
+func startBar(total int) (func(done int, current string), func()) {
+	if !progressEnabled() {
+		return func(int, string) {}, func() {}
+	}
+	bar := progress.NewBar(os.Stderr, total)
+	display = bar
+	return bar.Update, func() {
+		bar.Finish()
+		display = nil
+	}
+}
+
+// applyConfig sets the flags of cmd that were not given on the command line
+// to the defaults from the configuration files, either --config or the user
+// and project files. Top-level values apply to the main command and, for
+// shared flags such as --overwrite, to every subcommand; sections named after
+// a subcommand apply to it alone. It returns the configuration and the keys
+// that match no flag.
+func applyConfig(cmd *cobra.Command) (config.Config, []string, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return config.Config{}, nil, err
+	}
+
+	root := cmd.Root()
+	var unknown []string
+	set := func(key, value string, ok bool) error {
+		flag := cmd.Flags().Lookup(key)
+		if !ok || flag == nil {
+			return nil
+		}
+		// Flags given on the command line win
+		if flag.Changed {
+			return nil
+		}
+		if err := flag.Value.Set(value); err != nil {
+			return fmt.Errorf("invalid configuration value for %s: %w", key, err)
+		}
 		return nil
-	},
+	}
+
+	for key, value := range cfg.Flags {
+		if root.Flags().Lookup(key) == nil && root.PersistentFlags().Lookup(key) == nil {
+			unknown = append(unknown, key)
+			continue
+		}
+		if err := set(key, value, cmd == root || cmd.InheritedFlags().Lookup(key) != nil); err != nil {
+			return config.Config{}, nil, err
+		}
+	}
+	for name, values := range cfg.Commands {
+		sub, _, err := root.Find([]string{name})
+		if err != nil || sub == root {
+			unknown = append(unknown, name)
+			continue
+		}
+		for key, value := range values {
+			if sub.Flags().Lookup(key) == nil {
+				unknown = append(unknown, name+"."+key)
+				continue
+			}
+			if err := set(key, value, sub == cmd); err != nil {
+				return config.Config{}, nil, err
+			}
+		}
+	}
+	slices.Sort(unknown)
+	return cfg, unknown, nil
+}
+
+// loadConfig loads --config, or the user and project configuration files
+func loadConfig() (config.Config, error) {
+	paths := config.DefaultPaths()
+	if configFile != "" {
+		paths = []string{configFile}
+	}
+	return config.Load(paths...)
+}
+
+// applyPreset sets the flags of cmd that were not given on the command line
+// to the values of a preset. Preset values replace configured defaults.
+func applyPreset(cmd *cobra.Command, preset presets.Preset) error {
+	name := preset.Name
+	for _, key := range preset.Keys() {
+		flag := cmd.Flags().Lookup(key)
+		if flag == nil {
+			return fmt.Errorf("preset %s sets unknown flag: %s", name, key)
+		}
+		if flag.Changed {
+			continue
+		}
+		if err := flag.Value.Set(preset.Values[key]); err != nil {
+			return fmt.Errorf("invalid value for %s in preset %s: %w", key, name, err)
+		}
+	}
+	return nil
+}
+
+// parseOverwritePolicy returns the overwrite policy selected by the flags
+func parseOverwritePolicy() image.OverwritePolicy {
+	switch {
+	case overwrite:
+		return image.OverwriteAlways
+	case noOverwrite:
+		return image.OverwriteFail
+	case skipExisting:
+		return image.OverwriteSkip
+	case renameOnConflict:
+		return image.OverwriteRename
+	}
+	return image.OverwriteAlways
+}
+
+// setWriteOptions applies --fsync and --backup to every output
+func setWriteOptions() error {
+	mode, err := image.ParseFsync(fsync)
+	if err != nil {
+		return err
+	}
+	options := image.WriteOptions{Fsync: mode, Reproducible: reproducible}
+	if backup {
+		if backupSuffix == "" {
+			return fmt.Errorf("--backup-suffix cannot be empty")
+		}
+		options.Backup = backupSuffix
+	}
+	image.SetWriteOptions(options)
+	return nil
+}
+
+// srcsetFile is an output written for one width of a responsive image
+type srcsetFile struct {
+	path   string
+	width  int
+	format string
+}
+
+// processWidths decodes the input once and writes one output per width and
+// format, named after the output file with {w} replaced by the width. The
+// height follows the aspect ratio and images are never enlarged, so widths
+// beyond the source width are skipped.
+func processWidths(options image.ProcessOptions, widths []int, formats []string) ([]srcsetFile, error) {
+	decoded, err := openSource(inputFile, options)
+	if err != nil {
+		return nil, err
+	}
+	src := decoded.img
+	if !options.Crop.Empty() {
+		if src, err = image.Crop(src, options.Crop); err != nil {
+			return nil, err
+		}
+	}
+
+	// Widths are resized largest first so smaller ones reuse them, and the
+	// files are listed in the order the widths were given
+	bounds := src.Bounds()
+	for _, w := range widths {
+		if w > bounds.Dx() {
+			printf("Skipping %dw: wider than the %dpx source\n", w, bounds.Dx())
+		}
+	}
+	cascade := image.NewCascade(src)
+	byWidth := make([][]srcsetFile, len(widths))
+	for _, i := range image.Descending(widths) {
+		w := widths[i]
+		if w > bounds.Dx() {
+			continue
+		}
+		height := max(int(math.Round(float64(w)*float64(bounds.Dy())/float64(bounds.Dx()))), 1)
+		resized := cascade.Resize(w, height)
+
+		path := expandFilename(outputFile, "{w}", strconv.Itoa(w), "-{w}w")
+		paths, err := saveFormats(resized, path, options, formats, decoded)
+		if err != nil {
+			return nil, err
+		}
+		for j, p := range paths {
+			byWidth[i] = append(byWidth[i], srcsetFile{path: p, width: w, format: formats[j]})
+		}
+	}
+
+	var files []srcsetFile
+	for i := range widths {
+		files = append(files, byWidth[i]...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("all widths are wider than the %dpx source", bounds.Dx())
+	}
+	return files, nil
+}
+
+// imageType returns the MIME type of an image format
+func imageType(format string) string {
+	if t := mime.TypeByExtension("." + format); t != "" {
+		return t
+	}
+	return "image/" + format
+}
+
+// srcsetHTML returns an img tag that offers the files as a srcset, with the
+// largest one as the fallback src. Files in several formats become a picture
+// element with one source per format, in the order given, and the last
+// format as the img fallback.
+func srcsetHTML(files []srcsetFile) string {
+	var formats []string
+	byFormat := make(map[string][]srcsetFile)
+	for _, f := range files {
+		if _, ok := byFormat[f.format]; !ok {
+			formats = append(formats, f.format)
+		}
+		byFormat[f.format] = append(byFormat[f.format], f)
+	}
+
+	srcset := func(files []srcsetFile) string {
+		candidates := make([]string, len(files))
+		for i, f := range files {
+			candidates[i] = fmt.Sprintf("%s %dw", filepath.ToSlash(f.path), f.width)
+		}
+		return html.EscapeString(strings.Join(candidates, ", "))
+	}
+
+	fallback := byFormat[formats[len(formats)-1]]
+	largest := fallback[0]
+	for _, f := range fallback {
+		if f.width > largest.width {
+			largest = f
+		}
+	}
+	img := fmt.Sprintf(`<img src="%s" srcset="%s" sizes="100vw" alt="">`,
+		html.EscapeString(filepath.ToSlash(largest.path)), srcset(fallback))
+	if len(formats) == 1 {
+		return img
+	}
+
+	var b strings.Builder
+	b.WriteString("<picture>\n")
+	for _, format := range formats[:len(formats)-1] {
+		fmt.Fprintf(&b, "  <source type=\"%s\" srcset=\"%s\" sizes=\"100vw\">\n", imageType(format), srcset(byFormat[format]))
+	}
+	b.WriteString("  " + img + "\n</picture>")
+	return b.String()
+}
+
+// openImages opens each input for a multi-page output, resizing it when
+// resize is set
+func openImages(inputs []string, options image.ProcessOptions, resize bool) ([]stdimage.Image, error) {
+	update, stop := startBar(len(inputs))
+	defer stop()
+
+	images := make([]stdimage.Image, len(inputs))
+	for i, input := range inputs {
+		update(i, filepath.Base(input))
+		img, err := image.OpenImageWithOptions(input, options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", input, err)
+		}
+		if resize {
+			if img, err = image.Resize(img, options); err != nil {
+				return nil, err
+			}
+		}
+		images[i] = img
+	}
+	update(len(inputs), "")
+	return images, nil
+}
+
+// parseResizeMode parses a resize mode name
+func parseResizeMode(mode string) (image.ResizeMode, error) {
+	switch strings.ToLower(mode) {
+	case "fit":
+		return image.ResizeModeFit, nil
+	case "fill":
+		return image.ResizeModeFill, nil
+	case "stretch":
+		return image.ResizeModeStretch, nil
+	case "liquid":
+		return image.ResizeModeLiquid, nil
+	}
+	return "", fmt.Errorf("invalid resize mode: %s", mode)
+}
+
+// parseInts parses a comma-separated list of positive integers
+func parseInts(list string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(list, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("%q is not a positive integer", field)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// parsePoint parses a point in the form X,Y
+func parsePoint(point string) (stdimage.Point, error) {
+	xs, ys, ok := strings.Cut(point, ",")
+	x, errX := strconv.Atoi(strings.TrimSpace(xs))
+	y, errY := strconv.Atoi(strings.TrimSpace(ys))
+	if !ok || errX != nil || errY != nil || x < 0 || y < 0 {
+		return stdimage.Point{}, fmt.Errorf("invalid point: %s (expected X,Y)", point)
+	}
+	return stdimage.Pt(x, y), nil
+}
+
+// parseOps parses the --op steps and validates them with the pipeline engine
+func parseOps(specs []string) (*pipeline.Pipeline, error) {
+	steps := make([]pipeline.Step, len(specs))
+	for i, spec := range specs {
+		step, err := pipeline.ParseStep(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --op %s: %w", spec, err)
+		}
+		steps[i] = step
+	}
+	chain, err := pipeline.CompileSteps(steps)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --op: %w", err)
+	}
+	return chain, nil
+}
+
+// parsePlugins compiles --plugin filters, given as MODULE[:KEY=VALUE...],
+// into a pipeline of plugin steps
+func parsePlugins(specs []string) (*pipeline.Pipeline, error) {
+	steps := make([]pipeline.Step, len(specs))
+	for i, spec := range specs {
+		step, err := pipeline.ParseStep("plugin=" + spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --plugin %s: %w", spec, err)
+		}
+		steps[i] = step
+	}
+	chain, err := pipeline.CompileSteps(steps)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --plugin: %w", err)
+	}
+	return chain, nil
+}
+
+// parseEffects compiles the effect flags into a pipeline, or returns nil when
+// none is set. The effects run in a fixed order: deskewing first, so the
+// others see the leveled image, the white balance, contrast and levels
+// corrections, the vignette and grain on the image alone, the shadow around
+// it, the canvas of --extent around both, then daltonizing before the
+// simulation, so the corrected image can be previewed as it is seen.
+func parseEffects() (*pipeline.Pipeline, error) {
+	type effectFlag struct{ flag, value, spec string }
+	var effects []effectFlag
+	add := func(flag, value string) {
+		if value != "" {
+			// Commas inside rgb() colors are kept
+			effects = append(effects, effectFlag{flag, value, flag + "=" + strings.Join(colorparse.Split(value, ','), ":")})
+		}
+	}
+	add("deskew", deskew)
+	if autoWB {
+		effects = append(effects, effectFlag{"auto-wb", "", "auto-wb"})
+	}
+	if autoContrast {
+		effects = append(effects, effectFlag{"auto-contrast", "", "auto-contrast"})
+	}
+	for _, value := range levels {
+		// An optional channel comes first, as in blue:0,1,230
+		spec := "levels=" + strings.ReplaceAll(value, ",", ":")
+		if channel, rest, ok := strings.Cut(value, ":"); ok {
+			spec = "levels=" + strings.ReplaceAll(rest, ",", ":") + ":channel=" + channel
+		}
+		effects = append(effects, effectFlag{"levels", value, spec})
+	}
+	add("vignette", vignette)
+	add("grain", grain)
+	add("shadow", shadow)
+	if extent != "" {
+		add("extent", extent+","+anchor)
+	}
+	add("daltonize", daltonize)
+	add("simulate", simulate)
+
+	var steps []pipeline.Step
+	for _, effect := range effects {
+		spec := effect.spec
+		if (effect.flag == "deskew" || effect.flag == "shadow" || effect.flag == "extent") && !alphaOutput() {
+			spec += ":background=" + opaquePadColor()
+		}
+		step, err := pipeline.ParseStep(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s %s: %w", effect.flag, effect.value, err)
+		}
+		def, _ := pipeline.Lookup(step.Operation)
+		if _, err := def.Build(step.Params); err != nil {
+			return nil, fmt.Errorf("invalid --%s %s: %w", effect.flag, effect.value, err)
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, nil
+	}
+	return pipeline.CompileSteps(steps)
+}
+
+// opaquePadColor returns --pad-color flattened onto white, for outputs
+// without transparency
+func opaquePadColor() string {
+	c, err := image.ParseHexColor(padColor)
+	if err != nil {
+		return padColor
+	}
+	c = image.FlattenColor(c)
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
+
+// alphaOutput reports whether every output format keeps transparency, from
+// --format or the output file extension
+func alphaOutput() bool {
+	formats := strings.Split(outputFormat, ",")
+	if outputFormat == "" {
+		formats = []string{filepath.Ext(outputFile)}
+	}
+	for _, format := range formats {
+		if !image.SupportsAlpha(strings.TrimSpace(format)) {
+			return false
+		}
+	}
+	return true
+}
+
+// transform applies the crop and resize flags to img, or the --op steps if
+// any were given, then the effects and the --plugin filters. It returns the
+// options to encode the result with, which an encode step may have changed.
+func transform(img stdimage.Image, options image.ProcessOptions) (*stdimage.NRGBA, image.ProcessOptions, error) {
+	var result *stdimage.NRGBA
+	var err error
+	if opChain != nil {
+		result, options, err = opChain.Transform(img, options)
+	} else {
+		result, err = image.Transform(img, options)
+	}
+	if err == nil && effectChain != nil {
+		result, options, err = effectChain.Transform(result, options)
+	}
+	if err != nil || pluginChain == nil {
+		return result, options, err
+	}
+	return pluginChain.Transform(result, options)
+}
+
+// commandArgs are the arguments of a daemon job or of a resumed run, which
+// stand for those of the process while it runs
+var commandArgs []string
+
+// runArgs returns the arguments of the command being run, without the
+// program name
+func runArgs() []string {
+	if commandArgs != nil {
+		return commandArgs
+	}
+	return os.Args[1:]
+}
+
+// flagOrder returns the operations in the order their flags first appear in
+// args. Operations without flags keep their default relative order after them.
+func flagOrder(args []string) []string {
+	position := make(map[string]int)
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		var name string
+		if strings.HasPrefix(arg, "--") {
+			name, _, _ = strings.Cut(arg[2:], "=")
+		} else if strings.HasPrefix(arg, "-") && len(arg) > 1 {
+			name = arg[1:2]
+		} else {
+			continue
+		}
+
+		for operation, flags := range operationFlags {
+			if _, seen := position[operation]; !seen && slices.Contains(flags, name) {
+				position[operation] = i
+			}
+		}
+	}
+
+	operations := slices.Clone(image.DefaultOrder)
+	slices.SortStableFunc(operations, func(a, b string) int {
+		pa, okA := position[a]
+		pb, okB := position[b]
+		switch {
+		case okA && okB:
+			return pa - pb
+		case okA:
+			return -1
+		case okB:
+			return 1
+		}
+		return 0
+	})
+	return operations
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() error {
-	return rootCmd.Execute()
+	markUsageErrors.Do(func() { markArgErrors(rootCmd) })
+	warnings.Store(0)
+	cmd, err := rootCmd.ExecuteC()
+	var usage *usageError
+	if errors.As(err, &usage) {
+		cmd.Println(cmd.UsageString())
+	}
+	if n := warnings.Load(); err == nil && warningsAsErrors && n > 0 {
+		err = warningsError(n)
+	}
+	if jsonOutput {
+		if jsonErr := writeJSON(err); err == nil {
+			err = jsonErr
+		}
+	}
+	return err
 }
 
 func init() {
@@ -146,14 +2113,107 @@ func init() {
 	rootCmd.PersistentFlags().BoolP("help", "", false, "Help for nim")
 	rootCmd.Flags().BoolP("help", "?", false, "Help for nim")
 
+	// Overwrite policy, shared by every command that writes files
+	rootCmd.PersistentFlags().BoolVar(&overwrite, "overwrite", false, "Replace output files that already exist (the default)")
+	rootCmd.PersistentFlags().BoolVar(&noOverwrite, "no-overwrite", false, "Fail instead of replacing output files that already exist")
+	rootCmd.PersistentFlags().BoolVar(&skipExisting, "skip-existing", false, "Skip outputs that already exist, so re-runs only write what is missing")
+	rootCmd.PersistentFlags().BoolVar(&renameOnConflict, "rename-on-conflict", false, "Write to a new name with a -1, -2, ... suffix when the output already exists")
+	rootCmd.MarkFlagsMutuallyExclusive("overwrite", "no-overwrite", "skip-existing", "rename-on-conflict")
+	rootCmd.PersistentFlags().StringVar(&fsync, "fsync", "none", "Flush outputs to disk before they replace their path: none, file (the contents), or full (the folder too)")
+	rootCmd.PersistentFlags().BoolVar(&backup, "backup", false, "Keep the previous version of a replaced output as NAME~, and allow replacing the input file itself")
+	rootCmd.PersistentFlags().StringVar(&backupSuffix, "backup-suffix", "~", "Suffix of the copies --backup keeps")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Configuration file to load instead of ~/.config/nim/config.yaml and .nim.yaml")
+	rootCmd.PersistentFlags().CountVarP(&verbosity, "verbose", "v", "Log processing details to stderr (-v), or debugging details too (-vv)")
+	rootCmd.PersistentFlags().BoolVar(&quiet, "quiet", false, "Only print errors")
+	rootCmd.MarkFlagsMutuallyExclusive("verbose", "quiet")
+	rootCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "Print a JSON report of the files written on stdout; other messages go to stderr")
+	rootCmd.PersistentFlags().BoolVar(&warningsAsErrors, "warnings-as-errors", false, "Exit with status 7 when warnings were logged, even if everything else succeeded")
+	rootCmd.PersistentFlags().BoolVar(&noProgress, "no-progress", false, "Do not show progress bars and spinners (they are also hidden when stderr is not a terminal)")
+
 	// Define flags and bind them to variables
 	rootCmd.Flags().StringVarP(&inputFile, "input", "i", "", "Input image file")
 	rootCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output image file")
 	rootCmd.Flags().IntVarP(&width, "width", "w", 800, "Target width")
 	rootCmd.Flags().IntVarP(&height, "height", "H", 512, "Target height")
 	rootCmd.Flags().StringVarP(&size, "size", "s", "", "Target size in format WIDTHxHEIGHT (e.g., 512x512)")
-	rootCmd.Flags().StringVarP(&resizeMode, "mode", "m", "fit", "Resize mode (fit, fill, stretch)")
-	rootCmd.Flags().IntVarP(&quality, "quality", "q", 85, "Output quality (1-100, only for JPEG)")
-	rootCmd.Flags().StringVarP(&outputFormat, "format", "f", "", "Output format (jpg, png, gif, etc.)")
-	rootCmd.Flags().StringVarP(&padColor, "pad-color", "p", "#FFFFFF", "Padding color in hex format (#RRGGBB)")
+	rootCmd.Flags().StringVarP(&resizeMode, "mode", "m", "fit", "Resize mode (fit, fill, stretch, liquid)")
+	rootCmd.Flags().StringVarP(&quality, "quality", "q", "85", "Output quality (1-100), or auto[:ssim=0.95] to choose the lowest JPEG, WebP or AVIF quality that keeps the SSIM target per image")
+	rootCmd.Flags().StringVarP(&outputFormat, "format", "f", "", "Output format (jpg, png, gif, etc.); a comma-separated list (e.g., webp,avif,jpg) writes one file per format")
+	rootCmd.Flags().StringVarP(&padColor, "pad-color", "p", "#FFFFFF", "Padding color: hex (#RRGGBB, #RRGGBBAA or #RGB), rgb(R,G,B), transparent or a CSS color name; flattened onto white for formats without transparency")
+	rootCmd.Flags().StringVar(&fromVideo, "from-video", "", "Extract frames from a video file with ffmpeg instead of reading an input image")
+	rootCmd.Flags().BoolVar(&fromClip, "from-clipboard", false, "Read the input image from the system clipboard instead of a file")
+	rootCmd.Flags().BoolVar(&toClip, "to-clipboard", false, "Put the output image on the system clipboard as a PNG instead of writing a file")
+	rootCmd.Flags().StringVar(&frameAt, "at", "", "Timestamp of the frame to extract from the video (e.g., 00:01:23)")
+	rootCmd.Flags().StringVar(&frameEvery, "every", "", "Extract a frame at every interval (e.g., 10s) and tile them into a grid")
+	rootCmd.Flags().IntVar(&gridColumns, "columns", 4, "Number of columns in the frame grid")
+	rootCmd.Flags().StringVar(&rawWB, "raw-wb", "camera", "White balance for RAW inputs (camera, auto, daylight)")
+	rootCmd.Flags().Float64Var(&rawExposure, "raw-exposure", 0, "Exposure correction for RAW inputs in stops")
+	rootCmd.Flags().StringVar(&rawDemosaic, "raw-demosaic", "ahd", "Demosaic algorithm for RAW inputs (linear, vng, ppg, ahd)")
+	rootCmd.Flags().BoolVar(&rawHalf, "raw-half", false, "Develop RAW inputs at half resolution for faster proofs")
+	rootCmd.Flags().StringVar(&toneMap, "tonemap", "reinhard", "Tone mapping operator for HDR inputs (reinhard, aces, clamp)")
+	rootCmd.Flags().Float64Var(&hdrExposure, "hdr-exposure", 0, "Exposure adjustment for HDR inputs in stops, applied before tone mapping")
+	rootCmd.Flags().BoolVar(&netpbmPlain, "ascii", false, "Write plain (ASCII) Netpbm output instead of binary")
+	rootCmd.Flags().IntVar(&page, "page", 1, "Page of multi-page inputs (such as PDF or TIFF) to read, starting at 1")
+	rootCmd.Flags().StringVar(&frame, "frame", "", "Frame of animated GIF, WebP and PNG inputs to convert, as a number from 1, first, middle or last; drawn as it is shown in the animation. Without it, WebP and AVIF outputs keep every frame")
+	rootCmd.Flags().BoolVar(&allPages, "all-pages", false, "Convert every page of a multi-page TIFF; {page} in the output name is replaced by the page number")
+	rootCmd.Flags().Float64Var(&dpi, "dpi", image.DefaultDPI, "Resolution to render PDF pages at, and to size PDF output pages with --page-size fit")
+	rootCmd.Flags().StringVar(&pageSize, "page-size", "fit", "Page size of PDF output (a3, a4, a5, letter, legal, fit, or e.g. 210x297mm)")
+	rootCmd.Flags().StringVar(&pageMargin, "margin", "0", "Page margin of PDF output (e.g., 10mm, 0.5in, 36pt)")
+	rootCmd.Flags().StringVar(&widths, "widths", "", "Comma-separated widths to write one output each for (e.g., 320,640,1024); {w} in the output name is replaced by the width")
+	rootCmd.Flags().BoolVar(&srcset, "srcset", false, "Print an HTML img tag with a srcset of the --widths outputs")
+	rootCmd.Flags().StringVar(&gridLayout, "grid", "", "Slice an input laid out as a uniform grid of ROWSxCOLUMNS (e.g., 4x8), such as a sprite sheet, into one output per cell; {cell} in the output name is replaced by the cell number")
+	rootCmd.Flags().StringVar(&gridSelect, "select", "all", "Cells of --grid to write, numbered from 1 row by row (e.g., 3 or 1,2,5), or all")
+	rootCmd.Flags().BoolVar(&iconset, "iconset", false, "Also write the macOS icon family as an .iconset folder for iconutil, named after the output file")
+	rootCmd.Flags().StringVar(&hotspot, "hotspot", "", "Click position of cursor (.cur) output in format X,Y (default 0,0)")
+	rootCmd.Flags().StringVar(&icoSizes, "ico-sizes", "", "Comma-separated frame sizes of ICO output (default 16,24,32,48,64,128,256)")
+	rootCmd.Flags().StringVar(&cropPresetName, "crop-preset", "", "Platform image spec setting the size, resize mode and quality (e.g., instagram-square, youtube-thumb, twitter-header; see nim preset list)")
+	rootCmd.Flags().StringVar(&presetName, "preset", "", "Named preset of flag values (e.g., thumbnail, avatar, og-image); flags given on the command line override it")
+	rootCmd.Flags().StringVar(&cropRegion, "crop", "", "Crop region in format WIDTHxHEIGHT+X+Y (e.g., 400x300+10+20)")
+	rootCmd.Flags().IntVar(&rotate, "rotate", 0, "Rotate the input clockwise by 90, 180 or 270 degrees right after decoding, before the crop and resize")
+	rootCmd.Flags().BoolVar(&progressive, "progressive", false, "Write progressive JPEG output, which browsers show blurry at first and sharpen as it loads")
+	rootCmd.Flags().BoolVar(&exifThumb, "exif-thumbnail", false, "Embed a 160x120 EXIF thumbnail in JPEG output for fast gallery previews")
+	rootCmd.Flags().StringVar(&pngLevel, "png-compression", "default", "Compression of PNG output (default, none, fast, best, or a level from 0 to 9)")
+	rootCmd.Flags().StringVar(&pngFilter, "png-filter", "adaptive", "Row filter of PNG output (adaptive, none, sub, up, average, paeth)")
+	rootCmd.Flags().BoolVar(&pngReduce, "png-reduce", false, "Write PNG output as grayscale or a palette, with fewer bits per pixel, when no color is lost")
+	rootCmd.Flags().BoolVar(&interlace, "interlace", false, "Write interlaced (Adam7) PNG output, which browsers show coarse at first and refine as it loads")
+	rootCmd.Flags().BoolVar(&optimize, "optimize", false, "Losslessly search filters, compression and color types for the smallest PNG output; slower")
+	rootCmd.Flags().BoolVar(&webpLossless, "webp-lossless", false, "Write lossless WebP output; --quality then sets the compression effort")
+	rootCmd.Flags().IntVar(&webpNear, "webp-near-lossless", 100, "Near-lossless WebP output, from 1 (smallest) to 100 (lossless); below 100 implies --webp-lossless")
+	rootCmd.Flags().IntVar(&webpMethod, "webp-method", 4, "WebP compression effort, from 1 (fastest) to 6 (smallest files)")
+	rootCmd.Flags().IntVar(&webpAlpha, "webp-alpha-quality", 100, "Quality of the alpha channel of lossy WebP output, from 1 to 100")
+	rootCmd.Flags().BoolVar(&webpExact, "webp-exact", false, "Keep the RGB values of fully transparent pixels in WebP output")
+	rootCmd.Flags().IntVar(&avifSpeed, "avif-speed", image.DefaultAVIFSpeed, "AVIF encoder speed, from 1 (slowest, smallest files) to 10 (fastest)")
+	rootCmd.Flags().StringVar(&avifChroma, "avif-chroma", image.AVIFChroma420, "Chroma subsampling of AVIF output (420, 422, 444)")
+	rootCmd.Flags().StringVar(&avifColor, "avif-color", image.AVIFColorSRGB, "Color space of AVIF output: srgb, or keep the wide-gamut or HDR (PQ, HLG) primaries and transfer of AVIF and HEIF inputs")
+	rootCmd.Flags().IntVar(&avifAlpha, "avif-alpha-quality", 0, "Quality of the alpha channel of AVIF output, from 1 to 100, or 0 for the --quality")
+	rootCmd.Flags().BoolVar(&avifLossless, "avif-lossless", false, "Write AVIF output at full quality with full-resolution color")
+	rootCmd.Flags().IntVar(&avifThreads, "avif-threads", 0, "CPUs the system libavif may encode AVIF output on, Linux only (0 for all)")
+	rootCmd.Flags().Float64Var(&density, "density", 0, "Physical resolution in dots per inch to record in JPEG, PNG and TIFF output (e.g., 300)")
+	rootCmd.Flags().StringVar(&maxMemory, "max-memory", "", "Largest PNG or TIFF input to decode whole (e.g., 2GB); larger ones are read, resized and written a row at a time")
+	rootCmd.Flags().BoolVar(&bestEffort, "best-effort", false, "Recover what can be decoded from truncated or corrupt JPEG, PNG and GIF inputs, filling the rest with --pad-color, instead of failing")
+	rootCmd.Flags().StringVar(&hashAlgo, "hash", "", "Hash each output while it is written (sha256, xxhash) and add it to --json; {hash} or {hash:8} in the output name is replaced by the hash")
+	rootCmd.Flags().BoolVar(&reproducible, "reproducible", false, "Write byte-identical output for identical inputs and options: zip and tar entries get the time of $SOURCE_DATE_EPOCH, or 1980-01-01, instead of the current time, and encoders whose output depends on the machine (AVIF with the system libavif, codec plugins) are refused")
+	rootCmd.Flags().StringVar(&filesFrom, "files-from", "", "Convert the files listed in this file (- for stdin), one INPUT or INPUT<TAB>OUTPUT per line; the output argument is the template of outputs not given, with {name} replaced by the input name. Configuration rules and sidecar files apply to these files only")
+	rootCmd.Flags().BoolVar(&nullList, "null", false, "Entries of --files-from end with a NUL byte instead of a newline, as find -print0 writes them")
+	rootCmd.Flags().StringVar(&journalFile, "journal", "", "Record the files of --files-from in this journal as they complete, so an interrupted run can continue with nim batch --resume")
+	rootCmd.Flags().StringVar(&onError, "on-error", "abort", "What to do when a file of an archive or a --files-from list, or a page of --all-pages, fails (abort, skip, retry, retry:N); the run still fails at the end")
+	rootCmd.Flags().StringVar(&failedList, "failed-list", "", "Write the files that failed in an archive, --files-from or --all-pages run to this file, one per line")
+	rootCmd.Flags().StringVar(&maxBytes, "max-bytes", "", "Largest size of each output file (e.g., 200KB, 1.5MB); lowers the JPEG, WebP or AVIF quality, then the dimensions, until it fits")
+	rootCmd.Flags().StringVar(&order, "order", "", "Comma-separated order of operations (e.g., resize,crop); defaults to the order of flags")
+	rootCmd.Flags().BoolVar(&lqip, "lqip", false, "Print a tiny blurred preview of each output as a data: URI for inlining; with only an input file, print it without writing a file")
+	rootCmd.Flags().IntVar(&lqipWidth, "lqip-width", 24, "Width of --lqip previews")
+	rootCmd.Flags().StringVar(&lqipFormat, "lqip-format", "webp", "Format of --lqip previews (webp, jpg, png)")
+	rootCmd.Flags().StringArrayVar(&ops, "op", nil, "Add a step, run in the order given, instead of --crop and the resize flags (e.g., resize=400x400:fit, blur=2); repeatable")
+	rootCmd.Flags().BoolVar(&autoContrast, "auto-contrast", false, "Stretch the levels after the resize so the darkest 0.5% of the pixels turn black and the brightest white, keeping the colors")
+	rootCmd.Flags().BoolVar(&autoWB, "auto-wb", false, "Remove a color cast after the resize by balancing the means of the red, green and blue channels")
+	rootCmd.Flags().StringArrayVar(&levels, "levels", nil, "Map the levels after the resize, as [CHANNEL:]BLACK,GAMMA,WHITE with levels from 0 to 255 (e.g., 12,1.1,240 or blue:0,1,230); repeatable")
+	rootCmd.Flags().StringVar(&vignette, "vignette", "", "Darken the corners after the resize, as STRENGTH[,RADIUS] from 0 to 1 (e.g., 0.5,0.6)")
+	rootCmd.Flags().StringVar(&grain, "grain", "", "Add noise after the resize, as AMOUNT[,gaussian|perlin[,SIZE]] with AMOUNT from 0 to 100 (e.g., 4); hides banding in low-quality AVIF and WebP gradients")
+	rootCmd.Flags().StringVar(&deskew, "deskew", "", "Level a tilted scan or photo after the resize, as crop|pad[,MAX_ANGLE] (e.g., crop,10); crop keeps the size, pad grows the canvas, transparent or in --pad-color for JPEG output")
+	rootCmd.Flags().StringVar(&extent, "extent", "", "Place the image on a canvas of this size (WIDTHxHEIGHT) after the resize, at its own size when no size is given; the canvas is transparent, or --pad-color for JPEG output")
+	rootCmd.Flags().StringVar(&anchor, "anchor", "center", "Position of the image on the --extent canvas (center, top-left, top, top-right, left, right, bottom-left, bottom, bottom-right)")
+	rootCmd.Flags().StringVar(&shadow, "shadow", "", "Add a drop shadow after the resize, as OFFSET[,BLUR[,COLOR]] (e.g., 12,10,#00000080); the canvas grows, transparent or in --pad-color for JPEG output")
+	rootCmd.Flags().StringVar(&simulate, "simulate", "", "Show the output as seen with a color vision deficiency (protanopia, deuteranopia, tritanopia)")
+	rootCmd.Flags().StringVar(&daltonize, "daltonize", "", "Shift colors that are lost to a color vision deficiency (protanopia, deuteranopia, tritanopia) into ones that stay visible")
+	rootCmd.Flags().StringArrayVar(&plugins, "plugin", nil, "Run a WebAssembly filter module on the image after the other operations, with optional KEY=VALUE arguments (e.g., vintage.wasm:strength=3); repeatable")
 }
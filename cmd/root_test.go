@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bytes"
+	stdimage "image"
+	"image/color"
+	_ "image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nim/pkg/daemon"
+)
+
+// decodeFile decodes the image at path
+func decodeFile(t *testing.T, path string) stdimage.Image {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, _, err := stdimage.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestPadColorTransparent(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPNG(t, filepath.Join(dir, "in.png"), 200, 100)
+
+	for _, tt := range []struct {
+		args   []string
+		corner color.NRGBA
+	}{
+		// Formats with alpha keep the transparent padding, in memory and
+		// when streamed
+		{[]string{"in.png", "out.png", "-s", "100x100", "--pad-color", "transparent"}, color.NRGBA{}},
+		{[]string{"in.png", "streamed.png", "-s", "100x100", "--pad-color", "transparent", "--max-memory", "1KB"}, color.NRGBA{}},
+		{[]string{"in.png", "half.png", "-s", "100x100", "--pad-color", "#FF000080"}, color.NRGBA{255, 0, 0, 128}},
+		// Formats without are flattened onto white
+		{[]string{"in.png", "out.jpg", "-s", "100x100", "--pad-color", "transparent"}, color.NRGBA{255, 255, 255, 255}},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := runJob(daemon.Request{Args: tt.args, Dir: dir}, &stdout, &stderr); code != 0 {
+			t.Fatalf("%v failed with %d: %s", tt.args, code, stderr.String())
+		}
+		img := decodeFile(t, filepath.Join(dir, tt.args[1]))
+		if img.Bounds().Size() != stdimage.Pt(100, 100) {
+			t.Errorf("%v: expected 100x100, got %v", tt.args, img.Bounds().Size())
+		}
+		got := color.NRGBAModel.Convert(img.At(0, 0)).(color.NRGBA)
+		if tt.corner.A == 255 {
+			// JPEG is lossy
+			if got.R < 250 || got.G < 250 || got.B < 250 {
+				t.Errorf("%v: expected white padding, got %v", tt.args, got)
+			}
+		} else if got != tt.corner {
+			t.Errorf("%v: expected %v padding, got %v", tt.args, tt.corner, got)
+		}
+		if _, _, _, a := img.At(50, 50).RGBA(); a != 0xffff {
+			t.Errorf("%v: expected the image to stay opaque, got %v", tt.args, img.At(50, 50))
+		}
+	}
+}
+
+func TestOverwritePolicy(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPNG(t, filepath.Join(dir, "in.png"), 20, 10)
+	writeTestPNG(t, filepath.Join(dir, "out.png"), 5, 5)
+
+	for _, tt := range []struct {
+		args []string
+		code int
+		size stdimage.Point
+	}{
+		// Existing outputs are replaced by default, as before the flags
+		{[]string{"in.png", "out.png", "-s", "40x20"}, ExitOK, stdimage.Pt(40, 20)},
+		{[]string{"in.png", "out.png", "-s", "10x5", "--no-overwrite"}, ExitIO, stdimage.Pt(40, 20)},
+		{[]string{"in.png", "out.png", "-s", "10x5", "--skip-existing"}, ExitOK, stdimage.Pt(40, 20)},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := runJob(daemon.Request{Args: tt.args, Dir: dir}, &stdout, &stderr); code != tt.code {
+			t.Fatalf("%v: expected exit code %d, got %d: %s", tt.args, tt.code, code, stderr.String())
+		}
+		if got := decodeFile(t, filepath.Join(dir, "out.png")).Bounds().Size(); got != tt.size {
+			t.Errorf("%v: expected %v, got %v", tt.args, tt.size, got)
+		}
+	}
+}
+
+func TestUsageOnUsageErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		args  []string
+		usage bool
+	}{
+		{[]string{"missing.png", "out.png"}, false},
+		{[]string{"missing.png", "out.png", "--no-such-flag"}, true},
+	} {
+		var stdout, stderr bytes.Buffer
+		runJob(daemon.Request{Args: tt.args, Dir: dir}, &stdout, &stderr)
+		if got := strings.Contains(stdout.String()+stderr.String(), "Usage:"); got != tt.usage {
+			t.Errorf("%v: expected the usage printed to be %v, got:\n%s%s", tt.args, tt.usage, stdout.String(), stderr.String())
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	stdimage "image"
+	"log/slog"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"nim/pkg/config"
+	"nim/pkg/image"
+)
+
+// configRules are the rules of the configuration files, which set flags for
+// the inputs of a --files-from run that match them. Single inputs, archive
+// entries and the inputs of nim run are converted without them.
+var configRules []config.Rule
+
+// applyRules sets the flags of cmd that were not given on the command line
+// to the values of the configuration rules input matches, later rules
+// winning over earlier ones. The input is only decoded for rules that check
+// its content. A format changes the extension of the output file. It reports
+// whether a rule matched, and returns a function that puts the flags and the
+// output file back.
+func applyRules(cmd *cobra.Command, input string) (func(), bool, error) {
+	if len(configRules) == 0 {
+		return func() {}, false, nil
+	}
+	decoded := sync.OnceValues(func() (stdimage.Image, error) {
+		return image.OpenImage(input)
+	})
+	content := config.Image{
+		Transparent: func() (bool, error) {
+			img, err := decoded()
+			return err == nil && image.HasTransparency(img), err
+		},
+		Animated: func() (bool, error) {
+			// Animations are decoded in this process, so a sandboxed run
+			// treats every input as a still image, as it converts them
+			if image.DecoderSet() {
+				return false, nil
+			}
+			a, err := image.OpenAnimation(input)
+			return a != nil, err
+		},
+		Content: func() (string, error) {
+			img, err := decoded()
+			if err != nil {
+				return "", err
+			}
+			return string(image.ClassifyContent(img)), nil
+		},
+	}
+
+	values := map[string]string{}
+	for i, rule := range configRules {
+		ok, err := rule.Matches(input, content)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to check rule %d for %s: %w", i+1, input, err)
+		}
+		if ok {
+			slog.Debug("input matches rule", "file", input, "rule", i+1)
+			maps.Copy(values, rule.Set)
+		}
+	}
+	if len(values) == 0 {
+		return func() {}, false, nil
+	}
+
+	output := outputFile
+	undo := []func(){func() { outputFile = output }}
+	restore := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		flag := cmd.LocalNonPersistentFlags().Lookup(key)
+		if flag == nil || slices.Contains(sidecarExcludedFlags, key) {
+			restore()
+			return nil, false, fmt.Errorf("configuration rule sets a flag that cannot be set per image: %s", key)
+		}
+		// Flags given on the command line win
+		if flag.Changed {
+			continue
+		}
+		undo = append(undo, saveFlag(flag))
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		}
+		if err := cmd.Flags().Set(key, values[key]); err != nil {
+			restore()
+			return nil, false, fmt.Errorf("invalid value for %s in configuration rule: %w", key, err)
+		}
+		if key == "format" && !strings.Contains(outputFormat, ",") {
+			outputFile = strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + "." + outputFormat
+		}
+	}
+	return restore, true, nil
+}
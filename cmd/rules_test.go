@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"nim/pkg/daemon"
+)
+
+func TestRulesScope(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	writeTestPNG(t, filepath.Join(dir, "in.png"), 20, 10)
+	rules := "rules:\n  - match: \"*.png\"\n    set:\n      format: bmp\n"
+	if err := os.WriteFile(filepath.Join(dir, "rules.yaml"), []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "list.txt"), []byte("in.png\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "in.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("in.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	zw.Close()
+	if err := os.WriteFile(filepath.Join(dir, "in.zip"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		// The files of a list match the rule
+		{[]string{"--files-from", "list.txt", "list/{name}.png", "--config", "rules.yaml"}, "list/in.bmp"},
+		// Archive entries and single inputs do not
+		{[]string{"in.zip", "archive", "--config", "rules.yaml"}, "archive/in.png"},
+		{[]string{"in.png", "single/in.png", "--config", "rules.yaml"}, "single/in.png"},
+	} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(tt.want)), 0o755)
+		var stdout, stderr bytes.Buffer
+		if code := runJob(daemon.Request{Args: tt.args, Dir: dir}, &stdout, &stderr); code != 0 {
+			t.Fatalf("%v failed with %d: %s", tt.args, code, stderr.String())
+		}
+		if _, err := os.Stat(filepath.Join(dir, tt.want)); err != nil {
+			t.Errorf("%v: expected %s: %v", tt.args, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/batch"
+	"nim/pkg/image"
+	"nim/pkg/pipeline"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run [recipe] [inputs...]",
+	Short: "Run a pipeline recipe",
+	Long: `Run a pipeline recipe: a YAML or JSON file that declares an ordered list of
+steps (crop, resize, watermark, adjust, blur, sharpen, encode) and the
+outputs written from their result. Each output can set its own format and
+quality and add steps of its own, so one decode produces several variants.
+
+The inputs given on the command line replace the input of the recipe, and
+{name} in an output path is replaced by the input file name without its
+extension. The whole recipe is validated before any image is processed.`,
+	Example: `  nim run pipeline.yaml
+  nim run web.yaml photos/*.jpg
+  nim run web.yaml photos/*.jpg --on-error skip --failed-list failed.txt`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		recipe, err := pipeline.Load(args[0])
+		if err != nil {
+			return err
+		}
+		p, err := pipeline.Compile(recipe)
+		if err != nil {
+			return fmt.Errorf("invalid recipe %s: %w", args[0], err)
+		}
+
+		inputs := args[1:]
+		if len(inputs) == 0 {
+			if recipe.Input == "" {
+				return fmt.Errorf("input file is required: give one on the command line or set input in the recipe")
+			}
+			inputs = []string{recipe.Input}
+		}
+
+		policy, err := batch.ParsePolicy(onError)
+		if err != nil {
+			return err
+		}
+		runner := batch.Runner{Policy: policy}
+		for _, input := range inputs {
+			err := runner.Do(input, func() error {
+				files, err := runRecipe(p, input)
+				if err != nil {
+					return err
+				}
+				printf("Recipe applied successfully: %s -> %s\n", input, strings.Join(files, ", "))
+				return nil
+			})
+			if err != nil {
+				return finishBatch(cmd, err)
+			}
+		}
+		return finishBatch(cmd, runner.Err())
+	},
+}
+
+// runRecipe runs a compiled recipe on one input and writes its outputs,
+// following the overwrite policy. It returns the paths of the outputs.
+func runRecipe(p *pipeline.Pipeline, input string) ([]string, error) {
+	options := image.DefaultOptions()
+	options.Hooks = stageHooks
+	defer startSpinner(filepath.Base(input), &options)()
+
+	src, err := openSource(input, options)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := p.Run(src.img, options)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, len(rendered))
+	for i, r := range rendered {
+		path, err := templateOutput(r.Path, input)
+		if err != nil {
+			return nil, err
+		}
+		if files[i], err = saveImage(r.Image, path, r.Options, src); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+
+	runCmd.Flags().StringVar(&onError, "on-error", "abort", "What to do when an input fails (abort, skip, retry, retry:N); the run still fails at the end")
+	runCmd.Flags().StringVar(&failedList, "failed-list", "", "Write the inputs that failed to this file, one per line")
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/image"
+	"nim/pkg/sandbox"
+)
+
+var (
+	sandboxEnabled bool
+	sandboxMemory  string
+	sandboxTimeout time.Duration
+	sandboxSeccomp bool
+)
+
+// sandboxWorkerCmd decodes one image for the parent nim process; it is
+// started by the sandbox and not meant to be run by hand
+var sandboxWorkerCmd = &cobra.Command{
+	Use:    sandbox.WorkerCommand,
+	Short:  "Decode an image for a sandboxed nim process",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Errors are printed bare for the parent to report as its own, with
+		// an exit code that tells it their kind
+		if err := sandbox.Serve(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(sandbox.ExitCode(err))
+		}
+	},
+}
+
+// setupSandbox makes every decode of cmd run in a sandboxed worker process
+// with --sandbox, or in this process otherwise
+func setupSandbox(cmd *cobra.Command) error {
+	if !sandboxEnabled || cmd == sandboxWorkerCmd {
+		image.SetDecoder(nil)
+		return nil
+	}
+
+	limits := sandbox.DefaultLimits()
+	if sandboxMemory != "" {
+		memory, err := image.ParseByteSize(sandboxMemory)
+		if err != nil {
+			return fmt.Errorf("invalid --sandbox-memory: %w", err)
+		}
+		limits.Memory = memory
+	}
+	limits.Timeout = sandboxTimeout
+	limits.Seccomp = sandboxSeccomp
+
+	s, err := sandbox.New(limits)
+	if err != nil {
+		return err
+	}
+	image.SetDecoder(s.Decode)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(sandboxWorkerCmd)
+
+	rootCmd.PersistentFlags().BoolVar(&sandboxEnabled, "sandbox", false, "Decode inputs in a separate, resource-limited process, so a malicious file cannot crash nim (default in nim daemon)")
+	rootCmd.PersistentFlags().StringVar(&sandboxMemory, "sandbox-memory", "4GB", "Largest memory a sandboxed decoder may use")
+	rootCmd.PersistentFlags().DurationVar(&sandboxTimeout, "sandbox-timeout", 2*time.Minute, "Time a sandboxed decoder may take before it is killed")
+	rootCmd.PersistentFlags().BoolVar(&sandboxSeccomp, "sandbox-seccomp", false, "Also deny sandboxed decoders network access, running programs and tracing processes (Linux only)")
+}
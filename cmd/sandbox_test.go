@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	stdimage "image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"nim/pkg/config"
+	"nim/pkg/image"
+)
+
+func TestSandboxSkipsAnimation(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "anim.gif")
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{
+		Image: []*stdimage.Paletted{stdimage.NewPaletted(stdimage.Rect(0, 0, 4, 4), palette), stdimage.NewPaletted(stdimage.Rect(0, 0, 4, 4), palette)},
+		Delay: []int{10, 10},
+	}
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gif.EncodeAll(f, anim); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// Nothing may be read in this process while a sandbox decodes inputs
+	var decoded []string
+	image.SetDecoder(func(path string, options image.ProcessOptions) (stdimage.Image, error) {
+		decoded = append(decoded, path)
+		return stdimage.NewNRGBA(stdimage.Rect(0, 0, 4, 4)), nil
+	})
+	defer image.SetDecoder(nil)
+
+	inputFile, outputFile = input, filepath.Join(dir, "out.webp")
+	defer func() { inputFile, outputFile = "", "" }()
+	if done, err := processAnimation(image.DefaultOptions(), "webp"); done || err != nil {
+		t.Errorf("Expected the animation path to be skipped, got %v, %v", done, err)
+	}
+
+	configRules = []config.Rule{{Animated: new(bool), Set: map[string]string{"quality": "10"}}}
+	defer func() { configRules = nil }()
+	restore, matched, err := applyRules(rootCmd, input)
+	if err != nil || !matched {
+		t.Fatalf("Expected the input to count as still, got %v, %v", matched, err)
+	}
+	restore()
+	if len(decoded) != 0 {
+		t.Errorf("Expected no decoding for the animation checks, got %v", decoded)
+	}
+}
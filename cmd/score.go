@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/image"
+	"nim/pkg/score"
+)
+
+var scoreLimits = score.DefaultThresholds()
+
+// jsonScore describes the quality of a file in --json output
+type jsonScore struct {
+	File         string   `json:"file"`
+	Sharpness    float64  `json:"sharpness"`
+	Noise        float64  `json:"noise"`
+	Underexposed float64  `json:"underexposed"`
+	Overexposed  float64  `json:"overexposed"`
+	Brightness   float64  `json:"brightness"`
+	Issues       []string `json:"issues"`
+}
+
+var scoreCmd = &cobra.Command{
+	Use:   "score [files...]",
+	Short: "Rate the sharpness, noise and exposure of photos",
+	Long: `Measure the technical quality of each image, so batch jobs can flag or skip
+bad photos before converting them:
+
+  sharpness     Variance of the Laplacian of the luma, measured at most 1024
+                pixels on the longest side; blurry photos score low
+  noise         Estimated standard deviation of the noise, in levels (0-255)
+  underexposed  Share of pixels near black (luma 10 or below)
+  overexposed   Share of pixels near white (luma 245 or above)
+  brightness    Mean luma (0-255)
+
+Photos past the limits set by --min-sharpness, --max-noise,
+--max-underexposed and --max-overexposed are listed with their issues:
+blurry, noisy, underexposed or overexposed. A limit of 0 is not checked.
+The --json report has every score and issue of each file.`,
+	Example: `  nim score photo.jpg
+  nim score --json photos/*.jpg
+  nim score --min-sharpness 200 --max-noise 0 photos/*.jpg`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, file := range args {
+			src, err := openSource(file, image.DefaultOptions())
+			if err != nil {
+				return err
+			}
+			s := score.Compute(src.img)
+			issues := s.Issues(scoreLimits)
+			report.Scores = append(report.Scores, jsonScore{
+				File:         file,
+				Sharpness:    s.Sharpness,
+				Noise:        s.Noise,
+				Underexposed: s.Underexposed,
+				Overexposed:  s.Overexposed,
+				Brightness:   s.Brightness,
+				Issues:       append([]string{}, issues...),
+			})
+
+			verdict := "ok"
+			if len(issues) > 0 {
+				verdict = strings.Join(issues, ", ")
+			}
+			printResult("%s: sharpness %.1f, noise %.2f, underexposed %.1f%%, overexposed %.1f%%, brightness %.1f (%s)\n",
+				file, s.Sharpness, s.Noise, s.Underexposed*100, s.Overexposed*100, s.Brightness, verdict)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scoreCmd)
+
+	scoreCmd.Flags().Float64Var(&scoreLimits.MinSharpness, "min-sharpness", scoreLimits.MinSharpness, "Flag photos with a lower sharpness as blurry")
+	scoreCmd.Flags().Float64Var(&scoreLimits.MaxNoise, "max-noise", scoreLimits.MaxNoise, "Flag photos with more noise as noisy")
+	scoreCmd.Flags().Float64Var(&scoreLimits.MaxUnderexposed, "max-underexposed", scoreLimits.MaxUnderexposed, "Flag photos with a larger share (0-1) of pixels near black as underexposed")
+	scoreCmd.Flags().Float64Var(&scoreLimits.MaxOverexposed, "max-overexposed", scoreLimits.MaxOverexposed, "Flag photos with a larger share (0-1) of pixels near white as overexposed")
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"nim/pkg/api"
+	"nim/pkg/image"
+	"nim/pkg/metrics"
+	"nim/pkg/signurl"
+)
+
+var (
+	serveGRPC         string
+	serveJobs         int
+	serveQueue        int
+	serveQueueTimeout time.Duration
+	serveRate         float64
+	serveBurst        int
+	serveMaxUpload    string
+	serveSignKeys     []string
+	serveMetricsAddr  string
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve nim's processing to other services over gRPC",
+	Long: `Serve the ImageService of pkg/api/nim.proto over gRPC, so backend services
+can process, identify and compare images without shelling out to nim:
+
+  Process    resize and convert an image, with the main options of nim
+  Identify   report the format and size of an image
+  Compare    compute the PSNR, SSIM and changed pixels of two images
+
+Images are streamed in chunks both ways and spooled to temporary files, so
+large payloads never sit in a single message. The input format is detected
+from the data unless the request sets it. --jobs bounds the requests that
+decode and encode at the same time; others wait for their turn.
+--queue bounds the requests waiting for a slot and --queue-timeout the time
+they may wait; requests turned away fail with RESOURCE_EXHAUSTED and
+DEADLINE_EXCEEDED, so a burst of large requests fails fast instead of piling
+up. --rate limits the requests each client address may start per second,
+with bursts of --burst; requests above it fail with RESOURCE_EXHAUSTED.
+--max-upload bounds the size of each uploaded image: requests sending more
+fail with RESOURCE_EXHAUSTED.
+
+With --sign-key or $NIM_SIGN_KEY, only signed requests run: clients send the
+path api.RequestPath describes a request with, expiry included, signed with
+one of the keys in the nim-signed-path metadata (see api.SignContext and nim
+sign-url). Unsigned and expired requests fail with UNAUTHENTICATED, and
+requests that differ from their signed path with PERMISSION_DENIED.
+
+The server answers the standard grpc.health.v1 Health service, SERVING until
+it starts stopping. --metrics-addr serves Prometheus metrics over HTTP at
+/metrics (requests by status code, request and per-stage durations, requests
+and decodes in flight), with /healthz and /readyz as in nim daemon.
+
+Inputs come from other programs, so they are decoded in a separate,
+resource-limited process (see --sandbox) unless --sandbox=false is given. The
+server stops on Ctrl+C or SIGTERM, after the requests in flight finish. Go
+programs can use the generated client of the nim/pkg/api package.`,
+	Example: `  nim serve --grpc 127.0.0.1:50051
+  nim serve --grpc :50051 --jobs 4 --sandbox-memory 2GB
+  nim serve --grpc :50051 --max-upload 1GB
+  nim serve --grpc :50051 --queue 16 --queue-timeout 30s --rate 5 --burst 20
+  nim serve --grpc :50051 --sign-key "$NEW_KEY,$OLD_KEY"
+  nim serve --grpc :50051 --metrics-addr :9464`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if serveGRPC == "" {
+			return usageErrorf("--grpc is required")
+		}
+		if serveJobs < 0 {
+			return usageErrorf("invalid --jobs: %d (expected 0 or more)", serveJobs)
+		}
+		if serveQueue < 0 || serveQueueTimeout < 0 || serveRate < 0 || serveBurst < 0 {
+			return usageErrorf("--queue, --queue-timeout, --rate and --burst cannot be negative")
+		}
+		limits := api.Limits{Queue: serveQueue, Timeout: serveQueueTimeout, Rate: serveRate, Burst: serveBurst}
+		if serveMaxUpload != "0" {
+			var err error
+			if limits.MaxBytes, err = image.ParseByteSize(serveMaxUpload); err != nil {
+				return usageErrorf("invalid --max-upload: %w", err)
+			}
+		}
+		specs := serveSignKeys
+		if len(specs) == 0 && os.Getenv("NIM_SIGN_KEY") != "" {
+			specs = strings.Split(os.Getenv("NIM_SIGN_KEY"), ",")
+		}
+		keys, err := signurl.ParseKeys(specs)
+		if err != nil {
+			return usageErrorf("invalid --sign-key: %w", err)
+		}
+		if !cmd.Flag("sandbox").Changed {
+			sandboxEnabled = true
+			if err := setupSandbox(cmd); err != nil {
+				return err
+			}
+		}
+		if err := image.Warm(); err != nil {
+			return err
+		}
+
+		l, err := net.Listen("tcp", serveGRPC)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", serveGRPC, err)
+		}
+		service := api.NewServer("", serveJobs, limits)
+		service.SetKeys(keys)
+		var serverOptions []grpc.ServerOption
+		var ready atomic.Bool
+		if serveMetricsAddr != "" {
+			m := newRequestMetrics()
+			srv, err := serveMetrics(serveMetricsAddr, m.registry, &ready)
+			if err != nil {
+				l.Close()
+				return err
+			}
+			defer srv.Close()
+			service.SetHooks(m.hooks())
+			serverOptions = append(serverOptions, grpc.ChainStreamInterceptor(m.intercept))
+			printf("Serving metrics on http://%s/metrics\n", srv.Addr)
+		}
+		server := grpc.NewServer(serverOptions...)
+		service.Register(server)
+		health := grpchealth.NewServer()
+		healthpb.RegisterHealthServer(server, health)
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(signals)
+		go func() {
+			<-signals
+			ready.Store(false)
+			health.Shutdown()
+			server.GracefulStop()
+		}()
+
+		printf("Serving ImageService over gRPC on %s\n", l.Addr())
+		ready.Store(true)
+		return server.Serve(l)
+	},
+}
+
+// requestMetrics are the metrics nim serve serves with --metrics-addr
+type requestMetrics struct {
+	*stageMetrics
+	registry         *metrics.Registry
+	requests         *metrics.Counter
+	requestDuration  *metrics.Histogram
+	requestsInFlight *metrics.Gauge
+}
+
+func newRequestMetrics() *requestMetrics {
+	r := metrics.NewRegistry()
+	return &requestMetrics{
+		registry:         r,
+		requests:         r.NewCounter("nim_requests_total", "gRPC requests, by status code.", "code"),
+		requestDuration:  r.NewHistogram("nim_request_duration_seconds", "Time taken by gRPC requests, by method, in seconds.", "method", metrics.DefaultBuckets),
+		requestsInFlight: r.NewGauge("nim_requests_in_flight", "gRPC requests running."),
+		stageMetrics:     newStageMetrics(r),
+	}
+}
+
+// intercept runs a request and records it
+func (m *requestMetrics) intercept(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	m.requestsInFlight.Add(1)
+	defer m.requestsInFlight.Add(-1)
+	start := time.Now()
+	err := handler(srv, stream)
+	m.requestDuration.ObserveSince(path.Base(info.FullMethod), start)
+	m.requests.Inc(status.Code(err).String())
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveGRPC, "grpc", "", "Address to serve gRPC on (host:port)")
+	serveCmd.Flags().IntVar(&serveJobs, "jobs", 0, "Largest number of requests processed at the same time (0 for one per CPU)")
+	serveCmd.Flags().IntVar(&serveQueue, "queue", 0, "Largest number of requests waiting for their turn (0 for no limit)")
+	serveCmd.Flags().DurationVar(&serveQueueTimeout, "queue-timeout", 0, "Time a request may wait for its turn (0 for no limit)")
+	serveCmd.Flags().Float64Var(&serveRate, "rate", 0, "Requests each client address may start per second (0 for no limit)")
+	serveCmd.Flags().IntVar(&serveBurst, "burst", 1, "Requests a client may start at once before --rate applies")
+	serveCmd.Flags().StringVar(&serveMaxUpload, "max-upload", "256MB", "Largest image a request may upload (0 for no limit)")
+	serveCmd.Flags().StringSliceVar(&serveSignKeys, "sign-key", nil, "Only run requests signed with one of these keys, in hex as SECRET or SECRET:SALT, comma-separated")
+	serveCmd.Flags().StringVar(&serveMetricsAddr, "metrics-addr", "", "Serve Prometheus metrics, /healthz and /readyz over HTTP on this address (host:port)")
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+	"nim/pkg/api"
+)
+
+func TestServeMetrics(t *testing.T) {
+	m := newRequestMetrics()
+	service := api.NewServer(t.TempDir(), 1, api.Limits{})
+	service.SetHooks(m.hooks())
+	server := grpc.NewServer(grpc.ChainStreamInterceptor(m.intercept))
+	service.Register(server)
+	healthpb.RegisterHealthServer(server, grpchealth.NewServer())
+	l := bufconn.Listen(1 << 20)
+	go server.Serve(l)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	health, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || health.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("Expected the server to be serving, got %v, %v", health, err)
+	}
+	path := filepath.Join(t.TempDir(), "in.png")
+	writeTestPNG(t, path, 20, 10)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := api.NewImageServiceClient(conn)
+	if _, err := api.Identify(context.Background(), client, bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	api.Identify(context.Background(), client, strings.NewReader("not an image"))
+
+	var buf bytes.Buffer
+	if err := m.registry.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`nim_requests_total{code="OK"} 1`,
+		`nim_requests_total{code="InvalidArgument"} 1`,
+		`nim_request_duration_seconds_count{method="Identify"} 2`,
+		`nim_stage_duration_seconds_count{stage="decode"} 1`,
+		"nim_requests_in_flight 0",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected %s in the metrics, got:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"nim/pkg/config"
+)
+
+// noSidecar is set by --no-sidecar
+var noSidecar bool
+
+// sidecarExcludedFlags are flags of the main command that a sidecar cannot
+// set, as they pick the inputs and outputs of a run rather than how an image
+// is converted; shared flags such as --overwrite are excluded as well
+var sidecarExcludedFlags = append(slices.Clone(presetExcludedFlags),
+	"files-from", "null", "on-error", "failed-list", "from-video", "from-clipboard", "to-clipboard", "no-sidecar")
+
+// applySidecar sets the flags of cmd to the values in the sidecar file of
+// input, if it has one, as if they were given on the command line. A crop
+// in a sidecar comes before the resize unless it sets an order too, since it
+// is picked on the full image. It reports whether there was a sidecar, and
+// returns a function that puts the flags back.
+func applySidecar(cmd *cobra.Command, input string) (func(), bool, error) {
+	if noSidecar {
+		return func() {}, false, nil
+	}
+	values, err := config.LoadSidecar(input)
+	if err != nil || values == nil {
+		return func() {}, false, err
+	}
+	path := config.SidecarPath(input)
+	slog.Info("applying sidecar", "file", path)
+	if values["crop"] != "" && values["order"] == "" {
+		values["order"] = "crop,resize"
+	}
+
+	var undo []func()
+	restore := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		flag := cmd.LocalNonPersistentFlags().Lookup(key)
+		if flag == nil || slices.Contains(sidecarExcludedFlags, key) {
+			restore()
+			return nil, false, fmt.Errorf("sidecar %s sets a flag that cannot be set per image: %s", path, key)
+		}
+		undo = append(undo, saveFlag(flag))
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		}
+		if err := cmd.Flags().Set(key, values[key]); err != nil {
+			restore()
+			return nil, false, fmt.Errorf("invalid value for %s in sidecar %s: %w", key, path, err)
+		}
+	}
+	return restore, true, nil
+}
+
+// saveFlag returns a function that puts flag back to its current value
+func saveFlag(flag *pflag.Flag) func() {
+	changed := flag.Changed
+	if slice, ok := flag.Value.(pflag.SliceValue); ok {
+		values := slice.GetSlice()
+		return func() {
+			slice.Replace(values)
+			flag.Changed = changed
+		}
+	}
+	value := flag.Value.String()
+	return func() {
+		flag.Value.Set(value)
+		flag.Changed = changed
+	}
+}
+
+func init() {
+	rootCmd.Flags().BoolVar(&noSidecar, "no-sidecar", false, "Ignore the INPUT.nim.yaml sidecar files that override flags for their image")
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	stdimage "image"
+	"time"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/image"
+	"nim/pkg/stack"
+)
+
+var (
+	stackOutput   string
+	stackMethod   string
+	stackNoAlign  bool
+	stackMaxShift int
+	stackQuality  int
+)
+
+var stackCmd = &cobra.Command{
+	Use:   "stack [inputs...]",
+	Short: "Merge exposures of the same scene into one image",
+	Long: `Align several shots of the same scene and merge them into one image.
+
+  mean     average the shots to reduce noise, as for astrophotography or
+           long exposures without a filter
+  median   take the median of the shots, which also removes things that
+           appear in only a few of them, such as passers-by
+  fusion   blend bracketed exposures, keeping the best exposed parts of each
+           (Mertens exposure fusion), for an HDR look without tone mapping
+
+The shots must have the same size. They are aligned to the first one by
+shifting them up to --max-shift pixels, which corrects a handheld camera but
+not rotation, and the result is cropped to the area they all cover.`,
+	Example: `  nim stack -o night.png --method median night-*.jpg
+  nim stack -o room.jpg --method fusion room-under.jpg room.jpg room-over.jpg
+  nim stack -o stars.tiff --method mean --no-align frames/*.tif`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if stackOutput == "" {
+			return fmt.Errorf("output file is required")
+		}
+		method, err := stack.ParseMethod(stackMethod)
+		if err != nil {
+			return err
+		}
+		if stackMaxShift < 0 {
+			return fmt.Errorf("invalid --max-shift: %d (expected 0 or more)", stackMaxShift)
+		}
+
+		start := time.Now()
+		options := image.DefaultOptions()
+		options.Quality = stackQuality
+		frames := make([]stdimage.Image, len(args))
+		for i, path := range args {
+			src, err := openSource(path, options)
+			if err != nil {
+				return err
+			}
+			frames[i] = src.img
+		}
+		merged, err := stack.Merge(frames, stack.Options{Method: method, Align: !stackNoAlign, MaxShift: stackMaxShift})
+		if err != nil {
+			return err
+		}
+		path, err := saveImage(merged, stackOutput, options, source{args[0], frames[0], start})
+		if err != nil {
+			return err
+		}
+		printf("Stacked %d images (%s) -> %s\n", len(args), method, path)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stackCmd)
+
+	stackCmd.Flags().StringVarP(&stackOutput, "output", "o", "", "Output file")
+	stackCmd.Flags().StringVar(&stackMethod, "method", "mean", "How to merge the images (mean, median, fusion)")
+	stackCmd.Flags().BoolVar(&stackNoAlign, "no-align", false, "Do not align the images, for shots from a tripod")
+	stackCmd.Flags().IntVar(&stackMaxShift, "max-shift", stack.DefaultMaxShift, "Largest shift between images that alignment corrects, in pixels")
+	stackCmd.Flags().IntVarP(&stackQuality, "quality", "q", 85, "Output quality (1-100)")
+}
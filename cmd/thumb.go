@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	stdimage "image"
+	"image/jpeg"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/image"
+)
+
+var (
+	thumbSize     string
+	thumbFromEXIF bool
+)
+
+var thumbCmd = &cobra.Command{
+	Use:   "thumb <input> <output>",
+	Short: "Write a small thumbnail of an image",
+	Long: `Scale an image down to fit within --size, keeping its aspect ratio. Images
+that are already smaller are not enlarged.
+
+With --from-exif, the thumbnail embedded in the EXIF data of a JPEG, or the
+smallest JPEG preview embedded in a camera RAW file (DNG, CR2, NEF, ARW), is
+used instead of decoding the whole image, which is an order of magnitude
+faster for galleries. Files without one are decoded in full. Embedded
+thumbnails are usually 160x120, so larger sizes need a full decode.`,
+	Example: `  nim thumb photo.jpg thumb.jpg
+  nim thumb --from-exif photo.nef thumb.webp -s 160x160`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		width, height, err := image.ParseSize(thumbSize)
+		if err != nil {
+			return err
+		}
+		src, err := openThumbSource(args[0])
+		if err != nil {
+			return err
+		}
+		_, err = saveImage(image.Thumbnail(src.img, width, height), args[1], image.DefaultOptions(), src)
+		return err
+	},
+}
+
+// openThumbSource decodes the embedded thumbnail of an input with
+// --from-exif, or the whole input
+func openThumbSource(path string) (source, error) {
+	if !thumbFromEXIF {
+		return openSource(path, image.DefaultOptions())
+	}
+	start := time.Now()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return source{}, fmt.Errorf("failed to read input file: %w", err)
+	}
+	thumb, err := image.ExtractEXIFThumbnail(data)
+	if err != nil {
+		slog.Info("decoding the whole image", "file", path, "reason", err)
+		return openSource(path, image.DefaultOptions())
+	}
+	var img stdimage.Image
+	if img, err = jpeg.Decode(bytes.NewReader(thumb)); err != nil {
+		return source{}, fmt.Errorf("failed to decode EXIF thumbnail: %w", err)
+	}
+	slog.Info("using EXIF thumbnail", "file", path, "size", fmt.Sprintf("%dx%d", img.Bounds().Dx(), img.Bounds().Dy()))
+	return source{path, img, start}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(thumbCmd)
+
+	thumbCmd.Flags().StringVarP(&thumbSize, "size", "s", "160x160", "Largest size of the thumbnail in format WIDTHxHEIGHT")
+	thumbCmd.Flags().BoolVar(&thumbFromEXIF, "from-exif", false, "Use the thumbnail embedded in JPEG EXIF data or RAW files instead of decoding the whole image")
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+	"nim/pkg/image"
+)
+
+var (
+	tiffOutput     string
+	tiffSize       string
+	tiffResizeMode string
+)
+
+var tiffCmd = &cobra.Command{
+	Use:   "tiff [inputs...]",
+	Short: "Combine images into a multi-page TIFF",
+	Long: `Combine images into a single TIFF file with one page per input, in the
+order given. Pages are stored as 8-bit RGBA with Deflate compression.`,
+	Example: `  nim tiff -o document.tiff page1.png page2.png page3.png
+  nim tiff -o fax.tiff -s 1728x2200 scan*.jpg`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if tiffOutput == "" {
+			return fmt.Errorf("output file is required")
+		}
+
+		mode, err := parseResizeMode(tiffResizeMode)
+		if err != nil {
+			return err
+		}
+		options := image.DefaultOptions()
+		options.ResizeMode = mode
+
+		// Images are only resized when a size is given
+		resize := tiffSize != ""
+		if resize {
+			if options.Width, options.Height, err = image.ParseSize(tiffSize); err != nil {
+				return err
+			}
+		}
+
+		start := time.Now()
+		path, ok, err := resolveOutput(tiffOutput, args...)
+		if err != nil || !ok {
+			return err
+		}
+
+		pages, err := openImages(args, options, resize)
+		if err != nil {
+			return err
+		}
+
+		err = image.WriteFile(path, func(w io.Writer) error {
+			return image.EncodeMultiPageTIFF(w, pages)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write TIFF: %w", err)
+		}
+
+		if err := recordFile(args, path, start); err != nil {
+			return err
+		}
+		printf("TIFF created successfully: %d pages -> %s\n", len(pages), path)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tiffCmd)
+
+	tiffCmd.Flags().StringVarP(&tiffOutput, "output", "o", "", "Output TIFF file")
+	tiffCmd.Flags().StringVarP(&tiffSize, "size", "s", "", "Resize each image to WIDTHxHEIGHT before adding it")
+	tiffCmd.Flags().StringVarP(&tiffResizeMode, "mode", "m", "fit", "Resize mode (fit, fill, stretch, liquid)")
+}
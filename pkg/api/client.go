@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ChunkSize is the size of the chunks images are streamed in
+const ChunkSize = 64 << 10
+
+// Process sends the image read from r to the service with the options,
+// writes the output to w and returns its description
+func Process(ctx context.Context, client ImageServiceClient, options *ProcessOptions, r io.Reader, w io.Writer) (*ImageInfo, error) {
+	stream, err := client.Process(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&ProcessRequest{Payload: &ProcessRequest_Options{Options: options}}); err != nil {
+		return nil, err
+	}
+	err = sendChunks(r, func(data []byte) error {
+		return stream.Send(&ProcessRequest{Payload: &ProcessRequest_Chunk{Chunk: &Chunk{Data: data}}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	var info *ImageInfo
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if msg.GetInfo() != nil {
+			info = msg.GetInfo()
+			continue
+		}
+		if _, err := w.Write(msg.GetChunk().GetData()); err != nil {
+			return nil, err
+		}
+	}
+	if info == nil {
+		return nil, errors.New("the service sent no output")
+	}
+	return info, nil
+}
+
+// Identify sends the image read from r to the service and returns its
+// format and size
+func Identify(ctx context.Context, client ImageServiceClient, r io.Reader) (*ImageInfo, error) {
+	stream, err := client.Identify(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := sendChunks(r, func(data []byte) error { return stream.Send(&Chunk{Data: data}) }); err != nil {
+		return nil, err
+	}
+	return stream.CloseAndRecv()
+}
+
+// Compare sends the images read from a and b to the service and returns how
+// much they differ
+func Compare(ctx context.Context, client ImageServiceClient, a, b io.Reader) (*CompareResult, error) {
+	stream, err := client.Compare(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = sendChunks(a, func(data []byte) error {
+		return stream.Send(&CompareRequest{Payload: &CompareRequest_A{A: &Chunk{Data: data}}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = sendChunks(b, func(data []byte) error {
+		return stream.Send(&CompareRequest{Payload: &CompareRequest_B{B: &Chunk{Data: data}}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stream.CloseAndRecv()
+}
+
+// sendChunks reads r to the end and sends it in chunks of ChunkSize
+func sendChunks(r io.Reader, send func([]byte) error) error {
+	buf := make([]byte, ChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := send(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Limits bound what clients may ask of a Server, so that a burst of large
+// requests is turned away instead of piling up. Zero values mean no limit.
+type Limits struct {
+	MaxBytes int64         // Largest image a request may upload in bytes
+	Queue    int           // Requests that may wait for a job slot while all are taken
+	Timeout  time.Duration // Time a request may wait for a job slot
+	Rate     float64       // Requests each client, by address, may start per second
+	Burst    int           // Requests a client may start at once before Rate applies; at least 1
+}
+
+// turn waits for a free job slot, within the limits, and returns the
+// function that frees it. Requests that find the queue full fail with
+// ResourceExhausted, and those that wait longer than the timeout with
+// DeadlineExceeded.
+func (s *Server) turn(ctx context.Context) (func(), error) {
+	free := func() { <-s.jobs }
+	select {
+	case s.jobs <- struct{}{}:
+		return free, nil
+	default:
+	}
+	if n := s.waiting.Add(1); s.limits.Queue > 0 && n > int64(s.limits.Queue) {
+		s.waiting.Add(-1)
+		return nil, status.Error(codes.ResourceExhausted, "the server is busy: too many requests are waiting")
+	}
+	defer s.waiting.Add(-1)
+	var timeout <-chan time.Time
+	if s.limits.Timeout > 0 {
+		timer := time.NewTimer(s.limits.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case s.jobs <- struct{}{}:
+		return free, nil
+	case <-timeout:
+		return nil, status.Error(codes.DeadlineExceeded, "the server is busy: the request waited too long to run")
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// allow fails with ResourceExhausted when the client of ctx starts requests
+// faster than the rate limit allows
+func (s *Server) allow(ctx context.Context) error {
+	if s.limits.Rate <= 0 {
+		return nil
+	}
+	client := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		client = p.Addr.String()
+		if host, _, err := net.SplitHostPort(client); err == nil {
+			client = host
+		}
+	}
+	if !s.clients.take(client, s.limits.Rate, max(s.limits.Burst, 1), time.Now()) {
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded: too many requests from this client")
+	}
+	return nil
+}
+
+// rateLimiter keeps a token bucket for each client
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// bucket holds the requests a client may start, refilled at the rate limit
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// maxIdleBuckets is the number of clients above which the buckets of idle
+// clients are dropped
+const maxIdleBuckets = 4096
+
+// take takes a token from the bucket of client, which holds up to burst
+// tokens and gains rate per second, and reports whether there was one
+func (r *rateLimiter) take(client string, rate float64, burst int, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.buckets == nil {
+		r.buckets = make(map[string]*bucket)
+	}
+	b, ok := r.buckets[client]
+	if !ok {
+		if len(r.buckets) >= maxIdleBuckets {
+			r.dropFull(rate, burst, now)
+		}
+		b = &bucket{tokens: float64(burst), last: now}
+		r.buckets[client] = b
+	}
+	b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// dropFull drops the buckets that have refilled, whose clients are treated
+// the same as new ones
+func (r *rateLimiter) dropFull(rate float64, burst int, now time.Time) {
+	for client, b := range r.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rate >= float64(burst) {
+			delete(r.buckets, client)
+		}
+	}
+}
@@ -0,0 +1,759 @@
+// ImageService exposes nim's processing to other services over gRPC; nim
+// serve --grpc runs it. Images are streamed in chunks both ways, so large
+// payloads are never held in one message. The Go code in this package is
+// generated from this file with protoc-gen-go and protoc-gen-go-grpc:
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//	  --go-grpc_out=. --go-grpc_opt=paths=source_relative nim.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: nim.proto
+
+package api
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ResizeMode int32
+
+const (
+	ResizeMode_RESIZE_MODE_FIT     ResizeMode = 0
+	ResizeMode_RESIZE_MODE_FILL    ResizeMode = 1
+	ResizeMode_RESIZE_MODE_STRETCH ResizeMode = 2
+)
+
+// Enum value maps for ResizeMode.
+var (
+	ResizeMode_name = map[int32]string{
+		0: "RESIZE_MODE_FIT",
+		1: "RESIZE_MODE_FILL",
+		2: "RESIZE_MODE_STRETCH",
+	}
+	ResizeMode_value = map[string]int32{
+		"RESIZE_MODE_FIT":     0,
+		"RESIZE_MODE_FILL":    1,
+		"RESIZE_MODE_STRETCH": 2,
+	}
+)
+
+func (x ResizeMode) Enum() *ResizeMode {
+	p := new(ResizeMode)
+	*p = x
+	return p
+}
+
+func (x ResizeMode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ResizeMode) Descriptor() protoreflect.EnumDescriptor {
+	return file_nim_proto_enumTypes[0].Descriptor()
+}
+
+func (ResizeMode) Type() protoreflect.EnumType {
+	return &file_nim_proto_enumTypes[0]
+}
+
+func (x ResizeMode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ResizeMode.Descriptor instead.
+func (ResizeMode) EnumDescriptor() ([]byte, []int) {
+	return file_nim_proto_rawDescGZIP(), []int{0}
+}
+
+// Chunk is a piece of a streamed image file
+type Chunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Chunk) Reset() {
+	*x = Chunk{}
+	mi := &file_nim_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Chunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Chunk) ProtoMessage() {}
+
+func (x *Chunk) ProtoReflect() protoreflect.Message {
+	mi := &file_nim_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Chunk.ProtoReflect.Descriptor instead.
+func (*Chunk) Descriptor() ([]byte, []int) {
+	return file_nim_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Chunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// ProcessOptions mirrors the main fields of image.ProcessOptions
+type ProcessOptions struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Width         int32                  `protobuf:"varint,1,opt,name=width,proto3" json:"width,omitempty"`
+	Height        int32                  `protobuf:"varint,2,opt,name=height,proto3" json:"height,omitempty"`
+	ResizeMode    ResizeMode             `protobuf:"varint,3,opt,name=resize_mode,json=resizeMode,proto3,enum=nim.api.v1.ResizeMode" json:"resize_mode,omitempty"`
+	Quality       int32                  `protobuf:"varint,4,opt,name=quality,proto3" json:"quality,omitempty"`                              // 1-100; 0 uses the default of 85
+	OutputFormat  string                 `protobuf:"bytes,5,opt,name=output_format,json=outputFormat,proto3" json:"output_format,omitempty"` // jpg, png, webp, avif, ...
+	PadColor      string                 `protobuf:"bytes,6,opt,name=pad_color,json=padColor,proto3" json:"pad_color,omitempty"`             // Color as --pad-color takes it, e.g. "white" or "#FFFFFF"
+	MaxBytes      int64                  `protobuf:"varint,7,opt,name=max_bytes,json=maxBytes,proto3" json:"max_bytes,omitempty"`            // Largest size of the output; 0 disables the limit
+	TargetSsim    float64                `protobuf:"fixed64,8,opt,name=target_ssim,json=targetSsim,proto3" json:"target_ssim,omitempty"`     // 0 uses quality
+	InputFormat   string                 `protobuf:"bytes,9,opt,name=input_format,json=inputFormat,proto3" json:"input_format,omitempty"`    // Format of the input; empty detects it from the data
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProcessOptions) Reset() {
+	*x = ProcessOptions{}
+	mi := &file_nim_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProcessOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProcessOptions) ProtoMessage() {}
+
+func (x *ProcessOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_nim_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProcessOptions.ProtoReflect.Descriptor instead.
+func (*ProcessOptions) Descriptor() ([]byte, []int) {
+	return file_nim_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ProcessOptions) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *ProcessOptions) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *ProcessOptions) GetResizeMode() ResizeMode {
+	if x != nil {
+		return x.ResizeMode
+	}
+	return ResizeMode_RESIZE_MODE_FIT
+}
+
+func (x *ProcessOptions) GetQuality() int32 {
+	if x != nil {
+		return x.Quality
+	}
+	return 0
+}
+
+func (x *ProcessOptions) GetOutputFormat() string {
+	if x != nil {
+		return x.OutputFormat
+	}
+	return ""
+}
+
+func (x *ProcessOptions) GetPadColor() string {
+	if x != nil {
+		return x.PadColor
+	}
+	return ""
+}
+
+func (x *ProcessOptions) GetMaxBytes() int64 {
+	if x != nil {
+		return x.MaxBytes
+	}
+	return 0
+}
+
+func (x *ProcessOptions) GetTargetSsim() float64 {
+	if x != nil {
+		return x.TargetSsim
+	}
+	return 0
+}
+
+func (x *ProcessOptions) GetInputFormat() string {
+	if x != nil {
+		return x.InputFormat
+	}
+	return ""
+}
+
+type ProcessRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*ProcessRequest_Options
+	//	*ProcessRequest_Chunk
+	Payload       isProcessRequest_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProcessRequest) Reset() {
+	*x = ProcessRequest{}
+	mi := &file_nim_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProcessRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProcessRequest) ProtoMessage() {}
+
+func (x *ProcessRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_nim_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProcessRequest.ProtoReflect.Descriptor instead.
+func (*ProcessRequest) Descriptor() ([]byte, []int) {
+	return file_nim_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ProcessRequest) GetPayload() isProcessRequest_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *ProcessRequest) GetOptions() *ProcessOptions {
+	if x != nil {
+		if x, ok := x.Payload.(*ProcessRequest_Options); ok {
+			return x.Options
+		}
+	}
+	return nil
+}
+
+func (x *ProcessRequest) GetChunk() *Chunk {
+	if x != nil {
+		if x, ok := x.Payload.(*ProcessRequest_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isProcessRequest_Payload interface {
+	isProcessRequest_Payload()
+}
+
+type ProcessRequest_Options struct {
+	Options *ProcessOptions `protobuf:"bytes,1,opt,name=options,proto3,oneof"` // First message only
+}
+
+type ProcessRequest_Chunk struct {
+	Chunk *Chunk `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*ProcessRequest_Options) isProcessRequest_Payload() {}
+
+func (*ProcessRequest_Chunk) isProcessRequest_Payload() {}
+
+type ProcessResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*ProcessResponse_Info
+	//	*ProcessResponse_Chunk
+	Payload       isProcessResponse_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProcessResponse) Reset() {
+	*x = ProcessResponse{}
+	mi := &file_nim_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProcessResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProcessResponse) ProtoMessage() {}
+
+func (x *ProcessResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_nim_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProcessResponse.ProtoReflect.Descriptor instead.
+func (*ProcessResponse) Descriptor() ([]byte, []int) {
+	return file_nim_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ProcessResponse) GetPayload() isProcessResponse_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *ProcessResponse) GetInfo() *ImageInfo {
+	if x != nil {
+		if x, ok := x.Payload.(*ProcessResponse_Info); ok {
+			return x.Info
+		}
+	}
+	return nil
+}
+
+func (x *ProcessResponse) GetChunk() *Chunk {
+	if x != nil {
+		if x, ok := x.Payload.(*ProcessResponse_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isProcessResponse_Payload interface {
+	isProcessResponse_Payload()
+}
+
+type ProcessResponse_Info struct {
+	Info *ImageInfo `protobuf:"bytes,1,opt,name=info,proto3,oneof"` // First message: the output format and size
+}
+
+type ProcessResponse_Chunk struct {
+	Chunk *Chunk `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*ProcessResponse_Info) isProcessResponse_Payload() {}
+
+func (*ProcessResponse_Chunk) isProcessResponse_Payload() {}
+
+type ImageInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Format        string                 `protobuf:"bytes,1,opt,name=format,proto3" json:"format,omitempty"`
+	Width         int32                  `protobuf:"varint,2,opt,name=width,proto3" json:"width,omitempty"`
+	Height        int32                  `protobuf:"varint,3,opt,name=height,proto3" json:"height,omitempty"`
+	Bytes         int64                  `protobuf:"varint,4,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImageInfo) Reset() {
+	*x = ImageInfo{}
+	mi := &file_nim_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImageInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImageInfo) ProtoMessage() {}
+
+func (x *ImageInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_nim_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImageInfo.ProtoReflect.Descriptor instead.
+func (*ImageInfo) Descriptor() ([]byte, []int) {
+	return file_nim_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ImageInfo) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+func (x *ImageInfo) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *ImageInfo) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *ImageInfo) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+type CompareRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*CompareRequest_A
+	//	*CompareRequest_B
+	Payload       isCompareRequest_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CompareRequest) Reset() {
+	*x = CompareRequest{}
+	mi := &file_nim_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompareRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompareRequest) ProtoMessage() {}
+
+func (x *CompareRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_nim_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompareRequest.ProtoReflect.Descriptor instead.
+func (*CompareRequest) Descriptor() ([]byte, []int) {
+	return file_nim_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CompareRequest) GetPayload() isCompareRequest_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *CompareRequest) GetA() *Chunk {
+	if x != nil {
+		if x, ok := x.Payload.(*CompareRequest_A); ok {
+			return x.A
+		}
+	}
+	return nil
+}
+
+func (x *CompareRequest) GetB() *Chunk {
+	if x != nil {
+		if x, ok := x.Payload.(*CompareRequest_B); ok {
+			return x.B
+		}
+	}
+	return nil
+}
+
+type isCompareRequest_Payload interface {
+	isCompareRequest_Payload()
+}
+
+type CompareRequest_A struct {
+	A *Chunk `protobuf:"bytes,1,opt,name=a,proto3,oneof"` // Chunks of the first image
+}
+
+type CompareRequest_B struct {
+	B *Chunk `protobuf:"bytes,2,opt,name=b,proto3,oneof"` // Chunks of the second image
+}
+
+func (*CompareRequest_A) isCompareRequest_Payload() {}
+
+func (*CompareRequest_B) isCompareRequest_Payload() {}
+
+// CompareResult mirrors compare.Result
+type CompareResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Psnr          float64                `protobuf:"fixed64,1,opt,name=psnr,proto3" json:"psnr,omitempty"` // +Inf for identical images
+	Ssim          float64                `protobuf:"fixed64,2,opt,name=ssim,proto3" json:"ssim,omitempty"`
+	MeanDiff      float64                `protobuf:"fixed64,3,opt,name=mean_diff,json=meanDiff,proto3" json:"mean_diff,omitempty"`
+	ChangedPixels int64                  `protobuf:"varint,4,opt,name=changed_pixels,json=changedPixels,proto3" json:"changed_pixels,omitempty"`
+	Pixels        int64                  `protobuf:"varint,5,opt,name=pixels,proto3" json:"pixels,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CompareResult) Reset() {
+	*x = CompareResult{}
+	mi := &file_nim_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompareResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompareResult) ProtoMessage() {}
+
+func (x *CompareResult) ProtoReflect() protoreflect.Message {
+	mi := &file_nim_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompareResult.ProtoReflect.Descriptor instead.
+func (*CompareResult) Descriptor() ([]byte, []int) {
+	return file_nim_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *CompareResult) GetPsnr() float64 {
+	if x != nil {
+		return x.Psnr
+	}
+	return 0
+}
+
+func (x *CompareResult) GetSsim() float64 {
+	if x != nil {
+		return x.Ssim
+	}
+	return 0
+}
+
+func (x *CompareResult) GetMeanDiff() float64 {
+	if x != nil {
+		return x.MeanDiff
+	}
+	return 0
+}
+
+func (x *CompareResult) GetChangedPixels() int64 {
+	if x != nil {
+		return x.ChangedPixels
+	}
+	return 0
+}
+
+func (x *CompareResult) GetPixels() int64 {
+	if x != nil {
+		return x.Pixels
+	}
+	return 0
+}
+
+var File_nim_proto protoreflect.FileDescriptor
+
+const file_nim_proto_rawDesc = "" +
+	"\n" +
+	"\tnim.proto\x12\n" +
+	"nim.api.v1\"\x1b\n" +
+	"\x05Chunk\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\"\xb4\x02\n" +
+	"\x0eProcessOptions\x12\x14\n" +
+	"\x05width\x18\x01 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x02 \x01(\x05R\x06height\x127\n" +
+	"\vresize_mode\x18\x03 \x01(\x0e2\x16.nim.api.v1.ResizeModeR\n" +
+	"resizeMode\x12\x18\n" +
+	"\aquality\x18\x04 \x01(\x05R\aquality\x12#\n" +
+	"\routput_format\x18\x05 \x01(\tR\foutputFormat\x12\x1b\n" +
+	"\tpad_color\x18\x06 \x01(\tR\bpadColor\x12\x1b\n" +
+	"\tmax_bytes\x18\a \x01(\x03R\bmaxBytes\x12\x1f\n" +
+	"\vtarget_ssim\x18\b \x01(\x01R\n" +
+	"targetSsim\x12!\n" +
+	"\finput_format\x18\t \x01(\tR\vinputFormat\"~\n" +
+	"\x0eProcessRequest\x126\n" +
+	"\aoptions\x18\x01 \x01(\v2\x1a.nim.api.v1.ProcessOptionsH\x00R\aoptions\x12)\n" +
+	"\x05chunk\x18\x02 \x01(\v2\x11.nim.api.v1.ChunkH\x00R\x05chunkB\t\n" +
+	"\apayload\"t\n" +
+	"\x0fProcessResponse\x12+\n" +
+	"\x04info\x18\x01 \x01(\v2\x15.nim.api.v1.ImageInfoH\x00R\x04info\x12)\n" +
+	"\x05chunk\x18\x02 \x01(\v2\x11.nim.api.v1.ChunkH\x00R\x05chunkB\t\n" +
+	"\apayload\"g\n" +
+	"\tImageInfo\x12\x16\n" +
+	"\x06format\x18\x01 \x01(\tR\x06format\x12\x14\n" +
+	"\x05width\x18\x02 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x03 \x01(\x05R\x06height\x12\x14\n" +
+	"\x05bytes\x18\x04 \x01(\x03R\x05bytes\"a\n" +
+	"\x0eCompareRequest\x12!\n" +
+	"\x01a\x18\x01 \x01(\v2\x11.nim.api.v1.ChunkH\x00R\x01a\x12!\n" +
+	"\x01b\x18\x02 \x01(\v2\x11.nim.api.v1.ChunkH\x00R\x01bB\t\n" +
+	"\apayload\"\x93\x01\n" +
+	"\rCompareResult\x12\x12\n" +
+	"\x04psnr\x18\x01 \x01(\x01R\x04psnr\x12\x12\n" +
+	"\x04ssim\x18\x02 \x01(\x01R\x04ssim\x12\x1b\n" +
+	"\tmean_diff\x18\x03 \x01(\x01R\bmeanDiff\x12%\n" +
+	"\x0echanged_pixels\x18\x04 \x01(\x03R\rchangedPixels\x12\x16\n" +
+	"\x06pixels\x18\x05 \x01(\x03R\x06pixels*P\n" +
+	"\n" +
+	"ResizeMode\x12\x13\n" +
+	"\x0fRESIZE_MODE_FIT\x10\x00\x12\x14\n" +
+	"\x10RESIZE_MODE_FILL\x10\x01\x12\x17\n" +
+	"\x13RESIZE_MODE_STRETCH\x10\x022\xd2\x01\n" +
+	"\fImageService\x12F\n" +
+	"\aProcess\x12\x1a.nim.api.v1.ProcessRequest\x1a\x1b.nim.api.v1.ProcessResponse(\x010\x01\x126\n" +
+	"\bIdentify\x12\x11.nim.api.v1.Chunk\x1a\x15.nim.api.v1.ImageInfo(\x01\x12B\n" +
+	"\aCompare\x12\x1a.nim.api.v1.CompareRequest\x1a\x19.nim.api.v1.CompareResult(\x01B\rZ\vnim/pkg/apib\x06proto3"
+
+var (
+	file_nim_proto_rawDescOnce sync.Once
+	file_nim_proto_rawDescData []byte
+)
+
+func file_nim_proto_rawDescGZIP() []byte {
+	file_nim_proto_rawDescOnce.Do(func() {
+		file_nim_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_nim_proto_rawDesc), len(file_nim_proto_rawDesc)))
+	})
+	return file_nim_proto_rawDescData
+}
+
+var file_nim_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_nim_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_nim_proto_goTypes = []any{
+	(ResizeMode)(0),         // 0: nim.api.v1.ResizeMode
+	(*Chunk)(nil),           // 1: nim.api.v1.Chunk
+	(*ProcessOptions)(nil),  // 2: nim.api.v1.ProcessOptions
+	(*ProcessRequest)(nil),  // 3: nim.api.v1.ProcessRequest
+	(*ProcessResponse)(nil), // 4: nim.api.v1.ProcessResponse
+	(*ImageInfo)(nil),       // 5: nim.api.v1.ImageInfo
+	(*CompareRequest)(nil),  // 6: nim.api.v1.CompareRequest
+	(*CompareResult)(nil),   // 7: nim.api.v1.CompareResult
+}
+var file_nim_proto_depIdxs = []int32{
+	0,  // 0: nim.api.v1.ProcessOptions.resize_mode:type_name -> nim.api.v1.ResizeMode
+	2,  // 1: nim.api.v1.ProcessRequest.options:type_name -> nim.api.v1.ProcessOptions
+	1,  // 2: nim.api.v1.ProcessRequest.chunk:type_name -> nim.api.v1.Chunk
+	5,  // 3: nim.api.v1.ProcessResponse.info:type_name -> nim.api.v1.ImageInfo
+	1,  // 4: nim.api.v1.ProcessResponse.chunk:type_name -> nim.api.v1.Chunk
+	1,  // 5: nim.api.v1.CompareRequest.a:type_name -> nim.api.v1.Chunk
+	1,  // 6: nim.api.v1.CompareRequest.b:type_name -> nim.api.v1.Chunk
+	3,  // 7: nim.api.v1.ImageService.Process:input_type -> nim.api.v1.ProcessRequest
+	1,  // 8: nim.api.v1.ImageService.Identify:input_type -> nim.api.v1.Chunk
+	6,  // 9: nim.api.v1.ImageService.Compare:input_type -> nim.api.v1.CompareRequest
+	4,  // 10: nim.api.v1.ImageService.Process:output_type -> nim.api.v1.ProcessResponse
+	5,  // 11: nim.api.v1.ImageService.Identify:output_type -> nim.api.v1.ImageInfo
+	7,  // 12: nim.api.v1.ImageService.Compare:output_type -> nim.api.v1.CompareResult
+	10, // [10:13] is the sub-list for method output_type
+	7,  // [7:10] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_nim_proto_init() }
+func file_nim_proto_init() {
+	if File_nim_proto != nil {
+		return
+	}
+	file_nim_proto_msgTypes[2].OneofWrappers = []any{
+		(*ProcessRequest_Options)(nil),
+		(*ProcessRequest_Chunk)(nil),
+	}
+	file_nim_proto_msgTypes[3].OneofWrappers = []any{
+		(*ProcessResponse_Info)(nil),
+		(*ProcessResponse_Chunk)(nil),
+	}
+	file_nim_proto_msgTypes[5].OneofWrappers = []any{
+		(*CompareRequest_A)(nil),
+		(*CompareRequest_B)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_nim_proto_rawDesc), len(file_nim_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_nim_proto_goTypes,
+		DependencyIndexes: file_nim_proto_depIdxs,
+		EnumInfos:         file_nim_proto_enumTypes,
+		MessageInfos:      file_nim_proto_msgTypes,
+	}.Build()
+	File_nim_proto = out.File
+	file_nim_proto_goTypes = nil
+	file_nim_proto_depIdxs = nil
+}
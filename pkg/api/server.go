@@ -0,0 +1,417 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"nim/pkg/compare"
+	"nim/pkg/image"
+	"nim/pkg/signurl"
+)
+
+// Server runs the requests of ImageService with nim's image package. Inputs
+// and outputs are spooled to temporary files, so large images are streamed
+// rather than held in messages.
+type Server struct {
+	UnimplementedImageServiceServer
+
+	dir     string
+	jobs    chan struct{}
+	waiting atomic.Int64
+	limits  Limits
+	clients rateLimiter
+	keys    []signurl.Key
+	hooks   image.Hooks
+}
+
+// NewServer returns a server that spools files in dir, or the temporary
+// directory if it is empty, and runs at most jobs requests at a time, or one
+// per CPU if it is 0; requests beyond that wait for their turn within limits
+func NewServer(dir string, jobs int, limits Limits) *Server {
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	return &Server{dir: dir, jobs: make(chan struct{}, jobs), limits: limits}
+}
+
+// SetHooks makes the server call hooks as the stages of each request start
+// and end, such as to record their durations
+func (s *Server) SetHooks(hooks image.Hooks) {
+	s.hooks = hooks
+}
+
+// decodeOptions returns the options requests without their own decode with
+func (s *Server) decodeOptions() image.ProcessOptions {
+	options := image.DefaultOptions()
+	options.Hooks = s.hooks
+	return options
+}
+
+// Register registers the server as the ImageService of r
+func (s *Server) Register(r grpc.ServiceRegistrar) {
+	RegisterImageServiceServer(r, s)
+}
+
+// Process resizes and converts the streamed image, and streams the output
+// back after its description
+func (s *Server) Process(stream grpc.BidiStreamingServer[ProcessRequest, ProcessResponse]) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	req := first.GetOptions()
+	if req == nil {
+		return status.Error(codes.InvalidArgument, "the first message must hold the options")
+	}
+	if err := s.allow(stream.Context()); err != nil {
+		return err
+	}
+	if err := s.authorize(stream.Context(), "Process", req); err != nil {
+		return err
+	}
+	options, err := processOptions(req)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	options.Hooks = s.hooks
+
+	dir, err := os.MkdirTemp(s.dir, "nim-grpc-")
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to create temporary folder: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	input, err := s.receive(dir, "input", req.InputFormat, func() ([]byte, error) {
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if msg.GetChunk() == nil {
+			return nil, status.Error(codes.InvalidArgument, "expected image chunks after the options")
+		}
+		return msg.GetChunk().Data, nil
+	})
+	if err != nil {
+		return err
+	}
+	format := options.OutputFormat
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(input), ".")
+	}
+
+	free, err := s.turn(stream.Context())
+	if err != nil {
+		return err
+	}
+	defer free()
+	result, err := image.Process(input, filepath.Join(dir, "output."+format), options)
+	if err != nil {
+		return statusError(err)
+	}
+	info := &ImageInfo{Format: result.OutputFormat, Width: int32(result.Width), Height: int32(result.Height), Bytes: result.Bytes}
+	if err := stream.Send(&ProcessResponse{Payload: &ProcessResponse_Info{Info: info}}); err != nil {
+		return err
+	}
+	return send(result.Output, func(data []byte) error {
+		return stream.Send(&ProcessResponse{Payload: &ProcessResponse_Chunk{Chunk: &Chunk{Data: data}}})
+	})
+}
+
+// Identify decodes the streamed image and reports its format and size
+func (s *Server) Identify(stream grpc.ClientStreamingServer[Chunk, ImageInfo]) error {
+	if err := s.allow(stream.Context()); err != nil {
+		return err
+	}
+	if err := s.authorize(stream.Context(), "Identify", nil); err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp(s.dir, "nim-grpc-")
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to create temporary folder: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	input, err := s.receive(dir, "input", "", func() ([]byte, error) {
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return msg.Data, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	free, err := s.turn(stream.Context())
+	if err != nil {
+		return err
+	}
+	defer free()
+	img, err := image.OpenImageWithOptions(input, s.decodeOptions())
+	if err != nil {
+		return statusError(err)
+	}
+	stat, err := os.Stat(input)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	bounds := img.Bounds()
+	return stream.SendAndClose(&ImageInfo{
+		Format: strings.TrimPrefix(filepath.Ext(input), "."),
+		Width:  int32(bounds.Dx()),
+		Height: int32(bounds.Dy()),
+		Bytes:  stat.Size(),
+	})
+}
+
+// Compare decodes the two streamed images and reports how much they differ
+func (s *Server) Compare(stream grpc.ClientStreamingServer[CompareRequest, CompareResult]) error {
+	if err := s.allow(stream.Context()); err != nil {
+		return err
+	}
+	if err := s.authorize(stream.Context(), "Compare", nil); err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp(s.dir, "nim-grpc-")
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to create temporary folder: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The chunks of both images may be interleaved, so each is spooled to a
+	// file of its own and named after its format once it is complete
+	var files [2]*os.File
+	var sizes [2]int64
+	for i, name := range []string{"a", "b"} {
+		if files[i], err = os.Create(filepath.Join(dir, name)); err != nil {
+			return status.Errorf(codes.Internal, "failed to create temporary file: %v", err)
+		}
+		defer files[i].Close()
+	}
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		i, chunk := 0, msg.GetA()
+		if chunk == nil {
+			i, chunk = 1, msg.GetB()
+		}
+		if chunk == nil {
+			return status.Error(codes.InvalidArgument, "expected a chunk of image a or b")
+		}
+		sizes[i] += int64(len(chunk.Data))
+		if err := s.checkSize(sizes[i]); err != nil {
+			return err
+		}
+		if _, err := files[i].Write(chunk.Data); err != nil {
+			return status.Errorf(codes.Internal, "failed to write temporary file: %v", err)
+		}
+	}
+	var images [2]stdimage.Image
+	free, err := s.turn(stream.Context())
+	if err != nil {
+		return err
+	}
+	defer free()
+	for i, file := range files {
+		path, err := nameByFormat(file, "")
+		if err != nil {
+			return err
+		}
+		if images[i], err = image.OpenImageWithOptions(path, s.decodeOptions()); err != nil {
+			return statusError(err)
+		}
+	}
+	result, err := compare.Compare(images[0], images[1])
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return stream.SendAndClose(&CompareResult{
+		Psnr:          result.PSNR,
+		Ssim:          result.SSIM,
+		MeanDiff:      result.MeanDiff,
+		ChangedPixels: int64(result.ChangedPixels),
+		Pixels:        int64(result.Pixels),
+	})
+}
+
+// processOptions converts the options of a request to those of Process,
+// keeping the defaults of nim for unset fields
+func processOptions(req *ProcessOptions) (image.ProcessOptions, error) {
+	options := image.DefaultOptions()
+	if req.Width < 0 || req.Height < 0 {
+		return options, fmt.Errorf("invalid size: %dx%d", req.Width, req.Height)
+	}
+	if req.Width > 0 {
+		options.Width = int(req.Width)
+	}
+	if req.Height > 0 {
+		options.Height = int(req.Height)
+	}
+	switch req.ResizeMode {
+	case ResizeMode_RESIZE_MODE_FIT:
+		options.ResizeMode = image.ResizeModeFit
+	case ResizeMode_RESIZE_MODE_FILL:
+		options.ResizeMode = image.ResizeModeFill
+	case ResizeMode_RESIZE_MODE_STRETCH:
+		options.ResizeMode = image.ResizeModeStretch
+	default:
+		return options, fmt.Errorf("unknown resize mode: %d", req.ResizeMode)
+	}
+	if req.Quality < 0 || req.Quality > 100 {
+		return options, fmt.Errorf("invalid quality: %d (expected 1-100)", req.Quality)
+	}
+	if req.Quality > 0 {
+		options.Quality = int(req.Quality)
+	}
+	if req.PadColor != "" {
+		color, err := image.ParseHexColor(req.PadColor)
+		if err != nil {
+			return options, fmt.Errorf("invalid pad color %s: %w", req.PadColor, err)
+		}
+		options.PadColor = color
+	}
+	if req.MaxBytes < 0 || req.TargetSsim < 0 || req.TargetSsim > 1 {
+		return options, errors.New("invalid max_bytes or target_ssim")
+	}
+	options.OutputFormat = strings.ToLower(req.OutputFormat)
+	options.MaxBytes = req.MaxBytes
+	options.TargetSSIM = req.TargetSsim
+	return options, nil
+}
+
+// receive writes the chunks next returns to a file in dir until the stream
+// ends, and returns its path, named after format or the format detected from
+// its data
+func (s *Server) receive(dir, name, format string, next func() ([]byte, error)) (string, error) {
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "failed to create temporary file: %v", err)
+	}
+	defer file.Close()
+	var size int64
+	for {
+		data, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		size += int64(len(data))
+		if err := s.checkSize(size); err != nil {
+			return "", err
+		}
+		if _, err := file.Write(data); err != nil {
+			return "", status.Errorf(codes.Internal, "failed to write temporary file: %v", err)
+		}
+	}
+	return nameByFormat(file, format)
+}
+
+// checkSize fails with ResourceExhausted once an upload of size bytes is
+// larger than the server allows
+func (s *Server) checkSize(size int64) error {
+	if s.limits.MaxBytes > 0 && size > s.limits.MaxBytes {
+		return status.Errorf(codes.ResourceExhausted, "the image is larger than %d bytes", s.limits.MaxBytes)
+	}
+	return nil
+}
+
+// nameByFormat renames a spooled file with the extension of format, or of
+// the format detected from its data, since nim picks decoders by extension
+func nameByFormat(file *os.File, format string) (string, error) {
+	if format == "" {
+		header := make([]byte, 32)
+		n, _ := file.ReadAt(header, 0)
+		if format = DetectFormat(header[:n]); format == "" {
+			return "", status.Error(codes.InvalidArgument, "unknown input format: set input_format")
+		}
+	}
+	file.Close()
+	path := file.Name() + "." + strings.ToLower(format)
+	if err := os.Rename(file.Name(), path); err != nil {
+		return "", status.Errorf(codes.Internal, "failed to rename temporary file: %v", err)
+	}
+	return path, nil
+}
+
+// send streams the file at path in chunks of ChunkSize
+func send(path string, write func([]byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to open output: %v", err)
+	}
+	defer file.Close()
+	buf := make([]byte, ChunkSize)
+	for {
+		n, err := file.Read(buf)
+		if n > 0 {
+			if err := write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to read output: %v", err)
+		}
+	}
+}
+
+// statusError returns the gRPC status of an error of the image package:
+// inputs nim cannot read are invalid arguments
+func statusError(err error) error {
+	switch {
+	case errors.Is(err, image.ErrUnsupportedFormat), errors.Is(err, image.ErrDecode):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// DetectFormat returns the format of an image from the first bytes of its
+// file, or an empty string if it is not recognized
+func DetectFormat(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return "jpg"
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return "gif"
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WEBP":
+		return "webp"
+	case bytes.HasPrefix(header, []byte("BM")):
+		return "bmp"
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		return "tiff"
+	case bytes.HasPrefix(header, []byte{0, 0, 1, 0}):
+		return "ico"
+	case bytes.HasPrefix(header, []byte("icns")):
+		return "icns"
+	case bytes.HasPrefix(header, []byte{0xFF, 0x0A}), bytes.HasPrefix(header, []byte("\x00\x00\x00\x0cJXL \r\n\x87\n")):
+		return "jxl"
+	case len(header) >= 12 && string(header[4:8]) == "ftyp":
+		switch string(header[8:12]) {
+		case "avif", "avis":
+			return "avif"
+		case "heic", "heix", "hevc", "hevx", "mif1", "msf1":
+			return "heic"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand/v2"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"nim/pkg/signurl"
+)
+
+// testClient serves a Server with limits over an in-memory connection
+func testClient(t *testing.T, limits Limits) ImageServiceClient {
+	t.Helper()
+	return serveClient(t, NewServer(t.TempDir(), 2, limits))
+}
+
+// serveClient serves server over an in-memory connection
+func serveClient(t *testing.T, server *Server) ImageServiceClient {
+	t.Helper()
+	l := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	server.Register(s)
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewImageServiceClient(conn)
+}
+
+// testPNG encodes a gradient with noise, which compresses poorly, so that
+// larger images take several chunks
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 255 / w), uint8(y * 255 / h), uint8(rng.IntN(256)), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcess(t *testing.T) {
+	client := testClient(t, Limits{})
+	input := testPNG(t, 400, 300)
+	if len(input) <= ChunkSize {
+		t.Fatalf("Expected an input of several chunks, got %d bytes", len(input))
+	}
+
+	var out bytes.Buffer
+	options := &ProcessOptions{Width: 200, Height: 200, ResizeMode: ResizeMode_RESIZE_MODE_FILL, OutputFormat: "jpg", Quality: 80}
+	info, err := Process(context.Background(), client, options, bytes.NewReader(input), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Format != "jpg" || info.Width != 200 || info.Height != 200 || info.Bytes != int64(out.Len()) {
+		t.Errorf("Unexpected output %v for %d bytes", info, out.Len())
+	}
+	if DetectFormat(out.Bytes()) != "jpg" {
+		t.Errorf("Expected a JPEG output")
+	}
+
+	// Without a format the output keeps the format of the input; fit pads
+	// the image to the size
+	out.Reset()
+	info, err = Process(context.Background(), client, &ProcessOptions{Width: 100, Height: 100}, bytes.NewReader(input), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Format != "png" || info.Width != 100 || info.Height != 100 {
+		t.Errorf("Unexpected output %v", info)
+	}
+}
+
+func TestProcessErrors(t *testing.T) {
+	client := testClient(t, Limits{})
+	input := testPNG(t, 40, 30)
+	for _, tt := range []struct {
+		options *ProcessOptions
+		input   []byte
+	}{
+		{&ProcessOptions{Quality: 101}, input},
+		{&ProcessOptions{PadColor: "not a color"}, input},
+		{&ProcessOptions{}, []byte("not an image")},
+		{&ProcessOptions{InputFormat: "png"}, input[:50]},
+	} {
+		_, err := Process(context.Background(), client, tt.options, bytes.NewReader(tt.input), &bytes.Buffer{})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected an invalid argument for %v, got %v", tt.options, err)
+		}
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	client := testClient(t, Limits{})
+	input := testPNG(t, 321, 123)
+	info, err := Identify(context.Background(), client, bytes.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Format != "png" || info.Width != 321 || info.Height != 123 || info.Bytes != int64(len(input)) {
+		t.Errorf("Unexpected info %v", info)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	client := testClient(t, Limits{})
+	a := testPNG(t, 300, 300)
+	result, err := Compare(context.Background(), client, bytes.NewReader(a), bytes.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsInf(result.Psnr, 1) || result.ChangedPixels != 0 || result.Pixels != 300*300 {
+		t.Errorf("Expected identical images, got %v", result)
+	}
+
+	if _, err := Compare(context.Background(), client, bytes.NewReader(a), bytes.NewReader(testPNG(t, 30, 30))); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected an invalid argument for images of different sizes, got %v", err)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	client := testClient(t, Limits{MaxBytes: 1000})
+	small, large := testPNG(t, 10, 10), testPNG(t, 100, 100)
+	if _, err := Identify(context.Background(), client, bytes.NewReader(small)); err != nil {
+		t.Fatalf("Expected an image below the limit to be accepted, got %v", err)
+	}
+	if _, err := Identify(context.Background(), client, bytes.NewReader(large)); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected Identify to exhaust the limit, got %v", err)
+	}
+	if _, err := Process(context.Background(), client, &ProcessOptions{}, bytes.NewReader(large), &bytes.Buffer{}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected Process to exhaust the limit, got %v", err)
+	}
+	if _, err := Compare(context.Background(), client, bytes.NewReader(small), bytes.NewReader(large)); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected Compare to exhaust the limit, got %v", err)
+	}
+}
+
+func TestQueueLimits(t *testing.T) {
+	s := NewServer(t.TempDir(), 1, Limits{Queue: 1, Timeout: 50 * time.Millisecond})
+	free, err := s.turn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer free()
+
+	waited := make(chan error)
+	go func() {
+		_, err := s.turn(context.Background())
+		waited <- err
+	}()
+	for s.waiting.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := s.turn(context.Background()); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected a full queue, got %v", err)
+	}
+	if err := <-waited; status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("Expected the waiting request to time out, got %v", err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	client := testClient(t, Limits{Rate: 0.01, Burst: 2})
+	input := testPNG(t, 10, 10)
+	for i := range 3 {
+		_, err := Identify(context.Background(), client, bytes.NewReader(input))
+		if i < 2 && err != nil {
+			t.Fatalf("Expected request %d within the burst to run, got %v", i+1, err)
+		}
+		if i == 2 && status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("Expected the rate limit to turn away request 3, got %v", err)
+		}
+	}
+
+	var r rateLimiter
+	now := time.Now()
+	if !r.take("a", 1, 1, now) || r.take("a", 1, 1, now) || !r.take("b", 1, 1, now) {
+		t.Error("Expected a bucket of one token per client")
+	}
+	if !r.take("a", 1, 1, now.Add(time.Second)) {
+		t.Error("Expected the bucket to refill after a second")
+	}
+}
+
+func TestSignedRequests(t *testing.T) {
+	key, other := signurl.Key{Secret: []byte("secret")}, signurl.Key{Secret: []byte("other")}
+	server := NewServer(t.TempDir(), 2, Limits{})
+	server.SetKeys([]signurl.Key{key})
+	client := serveClient(t, server)
+	input := testPNG(t, 40, 30)
+	options := &ProcessOptions{Width: 20, OutputFormat: "png"}
+	later := time.Now().Add(time.Hour)
+
+	sign := func(key signurl.Key, method string, options *ProcessOptions, expires time.Time) context.Context {
+		ctx, err := SignContext(context.Background(), key, method, options, expires)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ctx
+	}
+	if _, err := Process(sign(key, "Process", options, later), client, options, bytes.NewReader(input), &bytes.Buffer{}); err != nil {
+		t.Fatalf("Expected a signed request to run, got %v", err)
+	}
+	if _, err := Identify(sign(key, "Identify", nil, later), client, bytes.NewReader(input)); err != nil {
+		t.Fatalf("Expected a signed Identify to run, got %v", err)
+	}
+	for name, tt := range map[string]struct {
+		ctx  context.Context
+		code codes.Code
+	}{
+		"unsigned":  {context.Background(), codes.Unauthenticated},
+		"wrong key": {sign(other, "Process", options, later), codes.Unauthenticated},
+		"expired":   {sign(key, "Process", options, time.Now().Add(-time.Minute)), codes.Unauthenticated},
+		"tampered":  {sign(key, "Process", &ProcessOptions{Width: 2000, OutputFormat: "png"}, later), codes.PermissionDenied},
+		"method":    {sign(key, "Identify", nil, later), codes.PermissionDenied},
+	} {
+		if _, err := Process(tt.ctx, client, options, bytes.NewReader(input), &bytes.Buffer{}); status.Code(err) != tt.code {
+			t.Errorf("%s: expected %v, got %v", name, tt.code, err)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	for header, want := range map[string]string{
+		"\xFF\xD8\xFF\xE0":               "jpg",
+		"\x89PNG\r\n\x1a\n":              "png",
+		"GIF89a":                         "gif",
+		"RIFF\x00\x00\x00\x00WEBPVP8 ":   "webp",
+		"\x00\x00\x00\x1cftypavif":       "avif",
+		"\x00\x00\x00\x18ftypheic":       "heic",
+		"II*\x00":                        "tiff",
+		"\x00\x00\x00\x0cJXL \r\n\x87\n": "jxl",
+		"%PDF-1.7":                       "",
+	} {
+		if got := DetectFormat([]byte(header)); got != want {
+			t.Errorf("DetectFormat(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
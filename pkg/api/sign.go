@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"nim/pkg/signurl"
+)
+
+// SignatureMetadata is the metadata key of the signed path of a request
+const SignatureMetadata = "nim-signed-path"
+
+// RequestPath returns the path that describes a request to method (Process,
+// Identify or Compare) with options, which only Process takes, valid until
+// expires. Signing it with the signurl package and sending it with
+// SignContext lets a server that requires signatures run the request.
+func RequestPath(method string, options *ProcessOptions, expires time.Time) string {
+	var b strings.Builder
+	b.WriteString("/" + strings.ToLower(method))
+	if options != nil {
+		fmt.Fprintf(&b, "/w:%d/h:%d/rm:%d/q:%d/bg:%s/mb:%d/ssim:%g/f:%s/in:%s",
+			options.Width, options.Height, options.ResizeMode, options.Quality,
+			url.PathEscape(options.PadColor), options.MaxBytes, options.TargetSsim,
+			url.PathEscape(options.OutputFormat), url.PathEscape(options.InputFormat))
+	}
+	fmt.Fprintf(&b, "/exp:%d", expires.Unix())
+	return b.String()
+}
+
+// SignContext returns ctx with the path of a request to method with options,
+// valid until expires, signed with key
+func SignContext(ctx context.Context, key signurl.Key, method string, options *ProcessOptions, expires time.Time) (context.Context, error) {
+	signed, err := signurl.Sign(key, RequestPath(method, options, expires))
+	if err != nil {
+		return nil, err
+	}
+	return metadata.AppendToOutgoingContext(ctx, SignatureMetadata, signed), nil
+}
+
+// SetKeys makes the server run only requests whose path was signed with one
+// of keys and has not expired; no keys accept every request
+func (s *Server) SetKeys(keys []signurl.Key) {
+	s.keys = keys
+}
+
+// authorize checks the signed path of a request to method with options when
+// the server requires signatures
+func (s *Server) authorize(ctx context.Context, method string, options *ProcessOptions) error {
+	if len(s.keys) == 0 {
+		return nil
+	}
+	values := metadata.ValueFromIncomingContext(ctx, SignatureMetadata)
+	if len(values) == 0 {
+		return status.Errorf(codes.Unauthenticated, "a signed path is required in the %s metadata", SignatureMetadata)
+	}
+	path, err := signurl.Verify(s.keys, values[0])
+	if err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	rest, exp, ok := strings.Cut(path, "/exp:")
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if !ok || err != nil {
+		return status.Error(codes.Unauthenticated, "the signed path has no expiry")
+	}
+	if time.Now().Unix() > expires {
+		return status.Errorf(codes.Unauthenticated, "the signed path expired at %s", time.Unix(expires, 0).UTC().Format(time.RFC3339))
+	}
+	if want, _, _ := strings.Cut(RequestPath(method, options, time.Time{}), "/exp:"); rest != want {
+		return status.Error(codes.PermissionDenied, "the signed path does not match the request")
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+// Package appicon generates the launcher icon sets of iOS and Android apps
+// from a single source image
+package appicon
+
+import (
+	"encoding/json"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"nim/pkg/image"
+)
+
+// ForegroundPadding keeps the image of an Android adaptive icon foreground
+// inside the 66dp safe zone of its 108dp canvas, which launchers never mask
+const ForegroundPadding = (108.0 - 66.0) / 2 / 108.0
+
+// Options controls the icons of one platform
+type Options struct {
+	Background color.NRGBA // Color behind the image; iOS icons must be opaque
+	Padding    float64     // Fraction of the icon left free on each side
+}
+
+// iosIcon is one entry of an iOS asset catalog icon set
+type iosIcon struct {
+	idiom  string
+	points float64
+	scale  int
+}
+
+// iosIcons covers every iPhone, iPad and App Store icon slot
+var iosIcons = []iosIcon{
+	{"iphone", 20, 2}, {"iphone", 20, 3},
+	{"iphone", 29, 2}, {"iphone", 29, 3},
+	{"iphone", 40, 2}, {"iphone", 40, 3},
+	{"iphone", 60, 2}, {"iphone", 60, 3},
+	{"ipad", 20, 1}, {"ipad", 20, 2},
+	{"ipad", 29, 1}, {"ipad", 29, 2},
+	{"ipad", 40, 1}, {"ipad", 40, 2},
+	{"ipad", 76, 1}, {"ipad", 76, 2},
+	{"ipad", 83.5, 2},
+	{"ios-marketing", 1024, 1},
+}
+
+// androidDensities maps mipmap densities to their scale relative to mdpi
+var androidDensities = []struct {
+	name  string
+	scale float64
+}{
+	{"mdpi", 1},
+	{"hdpi", 1.5},
+	{"xhdpi", 2},
+	{"xxhdpi", 3},
+	{"xxxhdpi", 4},
+}
+
+// GenerateIOS writes an AppIcon.appiconset asset catalog folder with every
+// icon size and its Contents.json into dir, and returns the folder path
+func GenerateIOS(src stdimage.Image, dir string, options Options) (string, error) {
+	set := filepath.Join(dir, "AppIcon.appiconset")
+	if err := os.MkdirAll(set, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create icon set folder: %w", err)
+	}
+
+	type contentsImage struct {
+		Filename string `json:"filename"`
+		Idiom    string `json:"idiom"`
+		Scale    string `json:"scale"`
+		Size     string `json:"size"`
+	}
+	var images []contentsImage
+
+	// Icons are opaque, so transparent pixels take the background color
+	options.Background.A = 255
+	pixels := make([]int, len(iosIcons))
+	for i, icon := range iosIcons {
+		pixels[i] = int(math.Round(icon.points * float64(icon.scale)))
+	}
+	// Icons are resized largest first so smaller ones reuse them, and slots
+	// of the same pixel size share a file
+	written := make(map[int]bool)
+	cascade := image.NewCascade(src)
+	for _, i := range image.Descending(pixels) {
+		if written[pixels[i]] {
+			continue
+		}
+		frame := cascade.PaddedIconFrame(pixels[i], options.Padding, options.Background)
+		if err := writePNG(filepath.Join(set, iosName(pixels[i])), frame); err != nil {
+			return "", err
+		}
+		written[pixels[i]] = true
+	}
+
+	for i, icon := range iosIcons {
+		points := strconv.FormatFloat(icon.points, 'f', -1, 64)
+		name := iosName(pixels[i])
+		images = append(images, contentsImage{
+			Filename: name,
+			Idiom:    icon.idiom,
+			Scale:    fmt.Sprintf("%dx", icon.scale),
+			Size:     points + "x" + points,
+		})
+	}
+
+	contents := map[string]any{
+		"images": images,
+		"info":   map[string]any{"author": "xcode", "version": 1},
+	}
+	if err := writeJSON(filepath.Join(set, "Contents.json"), contents); err != nil {
+		return "", err
+	}
+	return set, nil
+}
+
+// iosName returns the file name of an iOS icon of a pixel size
+func iosName(pixels int) string {
+	return fmt.Sprintf("Icon-%dx%d.png", pixels, pixels)
+}
+
+// GenerateAndroid writes launcher icons into a res folder inside dir: legacy
+// square and round icons and adaptive icon foregrounds for every mipmap
+// density, the adaptive icon definitions, and the background color resource.
+// It returns the res folder path.
+func GenerateAndroid(src stdimage.Image, dir string, options Options) (string, error) {
+	res := filepath.Join(dir, "res")
+	options.Background.A = 255
+
+	// Densities are resized largest first so smaller ones reuse them
+	cascade := image.NewCascade(src)
+	for _, density := range slices.Backward(androidDensities) {
+		folder := filepath.Join(res, "mipmap-"+density.name)
+		if err := os.MkdirAll(folder, 0o755); err != nil {
+			return "", fmt.Errorf("failed to create %s: %w", folder, err)
+		}
+
+		legacy := int(math.Round(48 * density.scale))
+		square := cascade.PaddedIconFrame(legacy, options.Padding, options.Background)
+		if err := writePNG(filepath.Join(folder, "ic_launcher.png"), square); err != nil {
+			return "", err
+		}
+		if err := writePNG(filepath.Join(folder, "ic_launcher_round.png"), circle(square)); err != nil {
+			return "", err
+		}
+
+		adaptive := int(math.Round(108 * density.scale))
+		foreground := cascade.PaddedIconFrame(adaptive, ForegroundPadding, color.Transparent)
+		if err := writePNG(filepath.Join(folder, "ic_launcher_foreground.png"), foreground); err != nil {
+			return "", err
+		}
+	}
+
+	anydpi := filepath.Join(res, "mipmap-anydpi-v26")
+	values := filepath.Join(res, "values")
+	for _, folder := range []string{anydpi, values} {
+		if err := os.MkdirAll(folder, 0o755); err != nil {
+			return "", fmt.Errorf("failed to create %s: %w", folder, err)
+		}
+	}
+
+	adaptiveIcon := `<?xml version="1.0" encoding="utf-8"?>
+<adaptive-icon xmlns:android="http://schemas.android.com/apk/res/android">
+    <background android:drawable="@color/ic_launcher_background"/>
+    <foreground android:drawable="@mipmap/ic_launcher_foreground"/>
+</adaptive-icon>
+`
+	for _, name := range []string{"ic_launcher.xml", "ic_launcher_round.xml"} {
+		if err := writeFile(filepath.Join(anydpi, name), []byte(adaptiveIcon)); err != nil {
+			return "", err
+		}
+	}
+
+	bg := options.Background
+	colors := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<resources>
+    <color name="ic_launcher_background">#%02X%02X%02X</color>
+</resources>
+`, bg.R, bg.G, bg.B)
+	if err := writeFile(filepath.Join(values, "ic_launcher_background.xml"), []byte(colors)); err != nil {
+		return "", err
+	}
+
+	return res, nil
+}
+
+// circle masks a square icon to an anti-aliased circle
+func circle(src *stdimage.NRGBA) *stdimage.NRGBA {
+	dst := stdimage.NewNRGBA(src.Bounds())
+	copy(dst.Pix, src.Pix)
+	size := src.Bounds().Dx()
+	r := float64(size) / 2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			// Coverage of the pixel by the circle, one pixel wide at the edge
+			d := math.Hypot(float64(x)+0.5-r, float64(y)+0.5-r)
+			coverage := math.Min(math.Max(r-d+0.5, 0), 1)
+			i := dst.PixOffset(x, y) + 3
+			dst.Pix[i] = uint8(math.Round(float64(dst.Pix[i]) * coverage))
+		}
+	}
+	return dst
+}
+
+func writePNG(path string, img stdimage.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := image.Encode(file, img, image.ProcessOptions{OutputFormat: "png"}); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	return writeFile(path, append(data, '\n'))
+}
+
+func writeFile(path string, data []byte) error {
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package appicon
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func decodePNG(t *testing.T, path string) image.Image {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("Failed to decode %s: %v", path, err)
+	}
+	return img
+}
+
+func TestGenerateIOS(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 1024, 1024))
+	set, err := GenerateIOS(src, t.TempDir(), Options{Background: color.NRGBA{R: 255}})
+	if err != nil {
+		t.Fatalf("GenerateIOS failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(set, "Contents.json"))
+	if err != nil {
+		t.Fatalf("Missing Contents.json: %v", err)
+	}
+	var contents struct {
+		Images []struct{ Filename, Idiom, Scale, Size string }
+	}
+	if err := json.Unmarshal(data, &contents); err != nil {
+		t.Fatalf("Invalid Contents.json: %v", err)
+	}
+	if len(contents.Images) != len(iosIcons) {
+		t.Fatalf("Expected %d images, got %d", len(iosIcons), len(contents.Images))
+	}
+
+	// Every referenced file exists and transparent sources become opaque
+	for _, entry := range contents.Images {
+		if _, err := os.Stat(filepath.Join(set, entry.Filename)); err != nil {
+			t.Errorf("Missing %s", entry.Filename)
+		}
+	}
+	ipadPro := decodePNG(t, filepath.Join(set, "Icon-167x167.png"))
+	if r, _, _, a := ipadPro.At(0, 0).RGBA(); r != 0xffff || a != 0xffff {
+		t.Errorf("Expected an opaque red background")
+	}
+}
+
+func TestGenerateAndroid(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 1024, 1024))
+	res, err := GenerateAndroid(src, t.TempDir(), Options{Background: color.NRGBA{G: 128}, Padding: 0.1})
+	if err != nil {
+		t.Fatalf("GenerateAndroid failed: %v", err)
+	}
+
+	if img := decodePNG(t, filepath.Join(res, "mipmap-xxxhdpi", "ic_launcher.png")); img.Bounds().Dx() != 192 {
+		t.Errorf("Expected a 192px xxxhdpi icon, got %v", img.Bounds())
+	}
+	if img := decodePNG(t, filepath.Join(res, "mipmap-hdpi", "ic_launcher_foreground.png")); img.Bounds().Dx() != 162 {
+		t.Errorf("Expected a 162px hdpi foreground, got %v", img.Bounds())
+	}
+
+	// Round icons are transparent outside the circle
+	round := decodePNG(t, filepath.Join(res, "mipmap-mdpi", "ic_launcher_round.png"))
+	if _, _, _, a := round.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("Expected a transparent corner on the round icon")
+	}
+
+	colors, _ := os.ReadFile(filepath.Join(res, "values", "ic_launcher_background.xml"))
+	if !strings.Contains(string(colors), "#008000") {
+		t.Errorf("Expected the background color resource, got:\n%s", colors)
+	}
+	if _, err := os.Stat(filepath.Join(res, "mipmap-anydpi-v26", "ic_launcher.xml")); err != nil {
+		t.Errorf("Missing adaptive icon definition: %v", err)
+	}
+}
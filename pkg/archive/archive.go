@@ -0,0 +1,230 @@
+// Package archive reads and writes the zip and tar archives that asset
+// bundles and photo exports arrive in, one entry at a time so memory use
+// does not grow with the size of the archive
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Kind is an archive format
+type Kind string
+
+const (
+	// KindZip is a zip archive
+	KindZip Kind = "zip"
+	// KindTar is an uncompressed tar archive
+	KindTar Kind = "tar"
+	// KindTarGz is a gzip-compressed tar archive
+	KindTarGz Kind = "tar.gz"
+)
+
+// KindOf returns the kind of archive a file name refers to, from its
+// extension, and false if it is not an archive
+func KindOf(name string) (Kind, bool) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return KindZip, true
+	case strings.HasSuffix(lower, ".tar"):
+		return KindTar, true
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return KindTarGz, true
+	}
+	return "", false
+}
+
+// IsArchive reports whether name has the extension of a zip or tar archive
+func IsArchive(name string) bool {
+	_, ok := KindOf(name)
+	return ok
+}
+
+// WalkFunc is called with the name and contents of each file in an archive.
+// The reader is only valid until it returns.
+type WalkFunc func(name string, r io.Reader) error
+
+// Walk calls fn for each regular file of the archive at file, in the order
+// they are stored. Names use forward slashes and are cleaned, so they never
+// point outside the directory they are extracted to. It stops at the first
+// error fn returns.
+func Walk(file string, fn WalkFunc) error {
+	kind, ok := KindOf(file)
+	if !ok {
+		return fmt.Errorf("not a zip or tar archive: %s", file)
+	}
+	if kind == KindZip {
+		return walkZip(file, fn)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if kind == KindTarGz {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name, ok := CleanName(header.Name)
+		if !ok {
+			continue
+		}
+		if err := fn(name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// walkZip calls fn for each regular file of a zip archive
+func walkZip(file string, fn WalkFunc) error {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	defer zr.Close()
+
+	for _, entry := range zr.File {
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+		name, ok := CleanName(entry.Name)
+		if !ok {
+			continue
+		}
+		r, err := entry.Open()
+		if err != nil {
+			return fmt.Errorf("failed to read %s in %s: %w", entry.Name, file, err)
+		}
+		err = fn(name, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CleanName turns the name of an archive entry into a relative slash-separated
+// path. It returns false for names that are empty or would leave the
+// directory the archive is extracted to.
+func CleanName(name string) (string, bool) {
+	name = path.Clean("/" + strings.ReplaceAll(name, `\`, "/"))[1:]
+	if name == "" || strings.HasPrefix(name, "__MACOSX/") {
+		return "", false
+	}
+	return name, true
+}
+
+// Writer writes files into a new archive
+type Writer struct {
+	// Modified is the modification time recorded for the entries, the time
+	// the archive was created unless it is changed before adding them
+	Modified time.Time
+
+	file *os.File
+	gz   *gzip.Writer
+	tar  *tar.Writer
+	zip  *zip.Writer
+	buf  bytes.Buffer
+}
+
+// Create creates an archive at file, of the kind given by its extension
+func Create(file string) (*Writer, error) {
+	kind, ok := KindOf(file)
+	if !ok {
+		return nil, fmt.Errorf("not a zip or tar archive: %s", file)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive: %w", err)
+	}
+
+	w := &Writer{Modified: time.Now(), file: f}
+	switch kind {
+	case KindZip:
+		w.zip = zip.NewWriter(f)
+	case KindTar:
+		w.tar = tar.NewWriter(f)
+	case KindTarGz:
+		w.gz = gzip.NewWriter(f)
+		w.tar = tar.NewWriter(w.gz)
+	}
+	return w, nil
+}
+
+// Add adds a file named name whose contents write produces. Zip entries are
+// streamed into the archive; tar entries are buffered first, since a tar
+// header records the size of the file before its contents.
+func (w *Writer) Add(name string, write func(io.Writer) error) error {
+	if w.zip != nil {
+		// Compressed images do not shrink further, so entries are stored
+		entry, err := w.zip.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: w.Modified})
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", name, err)
+		}
+		return write(entry)
+	}
+
+	w.buf.Reset()
+	if err := write(&w.buf); err != nil {
+		return err
+	}
+	header := &tar.Header{Name: name, Mode: 0o644, Size: int64(w.buf.Len()), ModTime: w.Modified, Typeflag: tar.TypeReg}
+	if err := w.tar.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	if _, err := w.tar.Write(w.buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close finishes the archive and closes its file
+func (w *Writer) Close() error {
+	var err error
+	if w.zip != nil {
+		err = w.zip.Close()
+	}
+	if w.tar != nil {
+		err = w.tar.Close()
+	}
+	if w.gz != nil && err == nil {
+		err = w.gz.Close()
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
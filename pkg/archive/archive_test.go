@@ -0,0 +1,169 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := map[string]Kind{
+		"photos.zip":    KindZip,
+		"Assets.ZIP":    KindZip,
+		"bundle.tar":    KindTar,
+		"bundle.tar.gz": KindTarGz,
+		"bundle.tgz":    KindTarGz,
+	}
+	for name, want := range tests {
+		if got, ok := KindOf(name); !ok || got != want {
+			t.Errorf("KindOf(%q) = %q, %v; expected %q", name, got, ok, want)
+		}
+	}
+	for _, name := range []string{"photo.jpg", "archive.gz", "zip"} {
+		if IsArchive(name) {
+			t.Errorf("IsArchive(%q) = true", name)
+		}
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	tests := map[string]string{
+		"a/b.png":          "a/b.png",
+		"./a/./b.png":      "a/b.png",
+		"../../etc/passwd": "etc/passwd",
+		"/abs/c.jpg":       "abs/c.jpg",
+		`win\path\d.jpg`:   "win/path/d.jpg",
+	}
+	for name, want := range tests {
+		if got, ok := CleanName(name); !ok || got != want {
+			t.Errorf("CleanName(%q) = %q, %v; expected %q", name, got, ok, want)
+		}
+	}
+	for _, name := range []string{"", "/", "..", "__MACOSX/._a.png"} {
+		if _, ok := CleanName(name); ok {
+			t.Errorf("CleanName(%q) should be rejected", name)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, ext := range []string{"zip", "tar", "tar.gz"} {
+		t.Run(ext, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "out."+ext)
+			w, err := Create(file)
+			if err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			files := map[string]string{"a.png": "first", "dir/b.jpg": "second one"}
+			for _, name := range []string{"a.png", "dir/b.jpg"} {
+				err := w.Add(name, func(out io.Writer) error {
+					_, err := io.WriteString(out, files[name])
+					return err
+				})
+				if err != nil {
+					t.Fatalf("Add failed: %v", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			got := make(map[string]string)
+			var order []string
+			err = Walk(file, func(name string, r io.Reader) error {
+				data, err := io.ReadAll(r)
+				got[name] = string(data)
+				order = append(order, name)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("Walk failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, files) {
+				t.Errorf("Expected %v, got %v", files, got)
+			}
+			if !reflect.DeepEqual(order, []string{"a.png", "dir/b.jpg"}) {
+				t.Errorf("Entries out of order: %v", order)
+			}
+		})
+	}
+}
+
+func TestModified(t *testing.T) {
+	modified := time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, ext := range []string{"zip", "tar"} {
+		t.Run(ext, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "out."+ext)
+			w, err := Create(file)
+			if err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			w.Modified = modified
+			err = w.Add("a.png", func(out io.Writer) error {
+				_, err := io.WriteString(out, "data")
+				return err
+			})
+			if err != nil {
+				t.Fatalf("Add failed: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			var got time.Time
+			if ext == "zip" {
+				r, err := zip.OpenReader(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer r.Close()
+				got = r.File[0].Modified
+			} else {
+				f, err := os.Open(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				header, err := tar.NewReader(f).Next()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = header.ModTime
+			}
+			if !got.Equal(modified) {
+				t.Errorf("Expected entries modified at %v, got %v", modified, got)
+			}
+		})
+	}
+}
+
+func TestWalkStops(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out.zip")
+	w, err := Create(file)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := w.Add(name, func(io.Writer) error { return nil }); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	calls := 0
+	err = Walk(file, func(string, io.Reader) error {
+		calls++
+		return fmt.Errorf("stop")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Expected Walk to stop at the first error, got %v after %d calls", err, calls)
+	}
+}
@@ -0,0 +1,136 @@
+// Package barcode encodes QR codes and Code 128 barcodes and draws them as
+// images, for stamping asset IDs and URLs onto pictures
+package barcode
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Kind is a type of barcode
+type Kind string
+
+const (
+	KindQR      Kind = "qr"
+	KindCode128 Kind = "code128"
+)
+
+// ParseKind parses the name of a barcode type
+func ParseKind(name string) (Kind, error) {
+	switch k := Kind(strings.ToLower(strings.TrimSpace(name))); k {
+	case KindQR, KindCode128:
+		return k, nil
+	}
+	return "", fmt.Errorf("invalid barcode type: %s (expected qr or code128)", name)
+}
+
+// Symbol is an encoded barcode: a grid of dark and light modules, surrounded
+// by a light quiet zone that scanners need to find it
+type Symbol struct {
+	Width, Height int         // Size in modules, without the quiet zone
+	quiet         image.Point // Width of the quiet zone on the sides and on the top and bottom
+	dark          []bool
+}
+
+func newSymbol(width, height int, quiet image.Point) *Symbol {
+	return &Symbol{Width: width, Height: height, quiet: quiet, dark: make([]bool, width*height)}
+}
+
+// Dark reports whether the module at x, y is dark
+func (s *Symbol) Dark(x, y int) bool {
+	return s.dark[y*s.Width+x]
+}
+
+func (s *Symbol) set(x, y int, dark bool) {
+	s.dark[y*s.Width+x] = dark
+}
+
+// Encode encodes a payload as a barcode of the given kind. QR codes use the
+// error correction level.
+func Encode(kind Kind, payload string, level Level) (*Symbol, error) {
+	if payload == "" {
+		return nil, fmt.Errorf("barcode payload is empty")
+	}
+	switch kind {
+	case KindQR:
+		return EncodeQR([]byte(payload), level)
+	case KindCode128:
+		return EncodeCode128(payload)
+	}
+	return nil, fmt.Errorf("invalid barcode type: %s", kind)
+}
+
+// Size returns the size in pixels of the image Image draws with modules of
+// the given size
+func (s *Symbol) Size(module int, label string) image.Point {
+	width := (s.Width + 2*s.quiet.X) * module
+	height := (s.Height + 2*s.quiet.Y) * module
+	if label != "" {
+		height += labelHeight(width, label)
+	}
+	return image.Pt(width, height)
+}
+
+// Image draws the symbol black on white, each module a square of module
+// pixels, inside its quiet zone. A label, such as the payload, is written
+// below it.
+func (s *Symbol) Image(module int, label string) *image.NRGBA {
+	module = max(module, 1)
+	size := s.Size(module, label)
+	img := image.NewNRGBA(image.Rectangle{Max: size})
+	draw.Draw(img, img.Rect, image.White, image.Point{}, draw.Src)
+	for y := range s.Height {
+		for x := range s.Width {
+			if s.Dark(x, y) {
+				p := image.Pt(x, y).Add(s.quiet).Mul(module)
+				r := image.Rectangle{Min: p, Max: p.Add(image.Pt(module, module))}
+				draw.Draw(img, r, image.Black, image.Point{}, draw.Src)
+			}
+		}
+	}
+	if label != "" {
+		drawLabel(img, (s.Height+2*s.quiet.Y)*module, label)
+	}
+	return img
+}
+
+// labelFont is the monospace font of labels, so IDs are easy to read back
+var labelFont, _ = opentype.Parse(gomono.TTF)
+
+// labelSize returns the font size that fits a label in the width of the
+// image, at most an eighth of it
+func labelSize(width int, label string) float64 {
+	// Go Mono advances 0.6 em per character
+	return min(float64(width)*0.9/(0.6*float64(len([]rune(label)))), float64(width)/8)
+}
+
+// labelHeight returns the height of the band below the symbol for a label
+func labelHeight(width int, label string) int {
+	return int(math.Ceil(labelSize(width, label) * 1.2))
+}
+
+// drawLabel writes the label centered in the band of img below top
+func drawLabel(img *image.NRGBA, top int, label string) {
+	face, err := opentype.NewFace(labelFont, &opentype.FaceOptions{Size: labelSize(img.Rect.Dx(), label), DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return
+	}
+	defer face.Close()
+	d := font.Drawer{Dst: img, Src: image.NewUniform(color.Black), Face: face}
+	metrics := face.Metrics()
+	width := d.MeasureString(label)
+	d.Dot = fixed.Point26_6{
+		X: (fixed.I(img.Rect.Dx()) - width) / 2,
+		Y: fixed.I(top) + metrics.Ascent,
+	}
+	d.DrawString(label)
+}
@@ -0,0 +1,65 @@
+package barcode
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestImage(t *testing.T) {
+	s, err := Encode(KindQR, "A-10042", LevelM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Version 1 with a quiet zone of 4 modules on each side
+	img := s.Image(3, "")
+	if img.Rect.Size() != image.Pt(87, 87) || s.Size(3, "") != image.Pt(87, 87) {
+		t.Fatalf("Expected 87x87, got %v", img.Rect.Size())
+	}
+	white, black := color.NRGBA{255, 255, 255, 255}, color.NRGBA{0, 0, 0, 255}
+	for _, p := range []image.Point{{0, 0}, {11, 11}, {86, 86}} {
+		if got := img.NRGBAAt(p.X, p.Y); got != white {
+			t.Errorf("Expected white at %v, got %v", p, got)
+		}
+	}
+	if got := img.NRGBAAt(12, 12); got != black {
+		t.Errorf("Expected the corner of the finder at 12,12, got %v", got)
+	}
+
+	// A label is written in a band below the quiet zone
+	labeled := s.Image(3, "A-10042")
+	size := s.Size(3, "A-10042")
+	if labeled.Rect.Size() != size || size.X != 87 || size.Y <= 87 {
+		t.Fatalf("Unexpected labeled size %v", labeled.Rect.Size())
+	}
+	dark := 0
+	for y := 87; y < size.Y; y++ {
+		for x := range size.X {
+			if labeled.NRGBAAt(x, y).R < 128 {
+				dark++
+			}
+		}
+	}
+	if dark == 0 {
+		t.Errorf("Expected the label below the code")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	if _, err := Encode(KindCode128, "", LevelM); err == nil {
+		t.Errorf("Expected an error for an empty payload")
+	}
+	s, err := Encode(KindCode128, "A-10042", LevelM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.quiet != image.Pt(10, 2) || s.Height >= s.Width {
+		t.Errorf("Unexpected Code 128 symbol %dx%d with a quiet zone of %v", s.Width, s.Height, s.quiet)
+	}
+	if kind, err := ParseKind("QR"); err != nil || kind != KindQR {
+		t.Errorf("Expected qr, got %v, %v", kind, err)
+	}
+	if _, err := ParseKind("ean13"); err == nil {
+		t.Errorf("Expected an error for an unknown type")
+	}
+}
@@ -0,0 +1,125 @@
+package barcode
+
+import (
+	"fmt"
+	"image"
+)
+
+// code128Patterns are the widths of the bars and spaces of each Code 128
+// symbol value, alternating from a bar; the last is the stop pattern
+var code128Patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+// Code 128 values that switch code sets, and the start and stop symbols
+const (
+	code128CodeC  = 99
+	code128CodeB  = 100
+	code128StartB = 104
+	code128StartC = 105
+	code128Stop   = 106
+)
+
+// code128Height is the height of the bars as a share of the width of the
+// symbol, above the 15% that scanners expect
+const code128Height = 0.25
+
+// EncodeCode128 encodes printable ASCII text as a Code 128 barcode. Runs of
+// digits are packed two to a symbol in code set C, so numeric IDs stay short.
+func EncodeCode128(text string) (*Symbol, error) {
+	for _, c := range []byte(text) {
+		if c < 32 || c > 126 {
+			return nil, fmt.Errorf("invalid Code 128 payload %q: only printable ASCII characters are supported", text)
+		}
+	}
+	if len(text) > 80 {
+		return nil, fmt.Errorf("payload too long for a Code 128 barcode: %d characters (at most 80)", len(text))
+	}
+
+	values := code128Values(text)
+	width := 0
+	for _, v := range values {
+		for _, w := range code128Patterns[v] {
+			width += int(w - '0')
+		}
+	}
+	height := max(int(float64(width)*code128Height), 1)
+	s := newSymbol(width, height, image.Pt(10, 2))
+	x := 0
+	for _, v := range values {
+		for i, w := range code128Patterns[v] {
+			for range int(w - '0') {
+				for y := range height {
+					s.set(x, y, i%2 == 0)
+				}
+				x++
+			}
+		}
+	}
+	return s, nil
+}
+
+// code128Values returns the symbol values of text, from the start symbol to
+// the checksum and the stop symbol
+func code128Values(text string) []int {
+	digits := func(i int) int {
+		n := 0
+		for i+n < len(text) && text[i+n] >= '0' && text[i+n] <= '9' {
+			n++
+		}
+		return n
+	}
+	var values []int
+	emitB := func(c byte) {
+		if len(values) == 0 {
+			values = append(values, code128StartB)
+		}
+		values = append(values, int(c-32))
+	}
+	setC := false
+	for i := 0; i < len(text); {
+		run := digits(i)
+		if setC {
+			if run >= 2 {
+				values = append(values, int(text[i]-'0')*10+int(text[i+1]-'0'))
+				i += 2
+				continue
+			}
+			values = append(values, code128CodeB)
+			setC = false
+		} else if run >= 6 || run >= 4 && (i == 0 || i+run == len(text)) {
+			// Code set C pays off for 4 digits at the start or end, and 6
+			// between other characters, since switching costs a symbol each
+			// way. An odd digit stays in code set B.
+			if run%2 == 1 {
+				emitB(text[i])
+				i++
+			}
+			if len(values) == 0 {
+				values = append(values, code128StartC)
+			} else {
+				values = append(values, code128CodeC)
+			}
+			setC = true
+			continue
+		}
+		emitB(text[i])
+		i++
+	}
+
+	checksum := values[0]
+	for i, v := range values[1:] {
+		checksum += (i + 1) * v
+	}
+	return append(values, checksum%103, code128Stop)
+}
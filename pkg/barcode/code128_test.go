@@ -0,0 +1,59 @@
+package barcode
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCode128Patterns(t *testing.T) {
+	seen := make(map[string]bool)
+	for v, pattern := range code128Patterns[:code128Stop] {
+		width, bars := 0, 0
+		for i, w := range pattern {
+			width += int(w - '0')
+			if i%2 == 0 {
+				bars += int(w - '0')
+			}
+		}
+		// Every symbol is 11 modules wide with an even number of dark ones
+		if len(pattern) != 6 || width != 11 || bars%2 != 0 || seen[pattern] {
+			t.Errorf("Invalid pattern %s for value %d", pattern, v)
+		}
+		seen[pattern] = true
+	}
+}
+
+func TestCode128Values(t *testing.T) {
+	for text, want := range map[string][]int{
+		"Wikipedia": {104, 55, 73, 75, 73, 80, 69, 68, 73, 65, 88, 106},
+		"12345678":  {105, 12, 34, 56, 78, 47, 106},
+		"AB123456":  {104, 33, 34, 99, 12, 34, 56, 26, 106},
+		"X12345":    {104, 56, 17, 99, 23, 45, 87, 106},
+		"A-1042":    {104, 33, 13, 99, 10, 42, 92, 106},
+	} {
+		if got := code128Values(text); !slices.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %v", text, want, got)
+		}
+	}
+}
+
+func TestEncodeCode128(t *testing.T) {
+	s, err := EncodeCode128("Wikipedia")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 11 symbols of 11 modules and the stop symbol of 13
+	if s.Width != 11*11+13 || s.Height != s.Width/4 {
+		t.Errorf("Expected %dx%d modules, got %dx%d", 11*11+13, s.Width/4, s.Width, s.Height)
+	}
+	// Start B is a bar of 2, a space of 1, and a bar of 1
+	if !s.Dark(0, 0) || !s.Dark(1, 0) || s.Dark(2, 0) || !s.Dark(3, s.Height-1) || s.Dark(4, 0) {
+		t.Errorf("Unexpected start symbol")
+	}
+	if _, err := EncodeCode128("tab\there"); err == nil {
+		t.Errorf("Expected an error for a control character")
+	}
+	if _, err := EncodeCode128("é"); err == nil {
+		t.Errorf("Expected an error for a character outside ASCII")
+	}
+}
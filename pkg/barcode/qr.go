@@ -0,0 +1,493 @@
+package barcode
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+// Level is the error correction level of a QR code: the share of the code
+// that can be damaged or covered and still be read
+type Level int
+
+const (
+	LevelL Level = iota // About 7%
+	LevelM              // About 15%
+	LevelQ              // About 25%
+	LevelH              // About 30%
+)
+
+// ParseLevel parses an error correction level (L, M, Q or H)
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "L":
+		return LevelL, nil
+	case "M":
+		return LevelM, nil
+	case "Q":
+		return LevelQ, nil
+	case "H":
+		return LevelH, nil
+	}
+	return 0, fmt.Errorf("invalid error correction level: %s (expected L, M, Q or H)", name)
+}
+
+func (l Level) String() string {
+	return [...]string{"L", "M", "Q", "H"}[l]
+}
+
+// formatBits are the bits of each level in the format information
+var formatBits = [...]int{LevelL: 1, LevelM: 0, LevelQ: 3, LevelH: 2}
+
+// eccPerBlock and eccBlocks are the error correction codewords of each block
+// and the number of blocks, by level and version (ISO/IEC 18004 table 9)
+var eccPerBlock = [4][41]int{
+	{0, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{0, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{0, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var eccBlocks = [4][41]int{
+	{0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{0, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{0, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// rawModules returns the number of modules of a version that hold data and
+// error correction, after the function patterns and the format and version
+// information
+func rawModules(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		n -= (25*align-10)*align - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+// dataCodewords returns the number of data codewords of a version and level
+func dataCodewords(version int, level Level) int {
+	return rawModules(version)/8 - eccPerBlock[level][version]*eccBlocks[level][version]
+}
+
+// EncodeQR encodes data in byte mode as the smallest QR code that holds it at
+// the error correction level
+func EncodeQR(data []byte, level Level) (*Symbol, error) {
+	if level < LevelL || level > LevelH {
+		return nil, fmt.Errorf("invalid error correction level: %d", level)
+	}
+	version := 1
+	for ; version <= 40; version++ {
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= dataCodewords(version, level)*8 && len(data) < 1<<countBits {
+			break
+		}
+	}
+	if version > 40 {
+		return nil, fmt.Errorf("payload too long for a QR code: %d bytes (at most %d at level %s)", len(data), dataCodewords(40, level)-3, level)
+	}
+
+	// Mode, length and data, then a terminator and padding to the capacity
+	var bits bitBuffer
+	bits.append(0b0100, 4)
+	if version >= 10 {
+		bits.append(len(data), 16)
+	} else {
+		bits.append(len(data), 8)
+	}
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := dataCodewords(version, level) * 8
+	bits.append(0, min(4, capacity-bits.n))
+	bits.append(0, (8-bits.n%8)%8)
+	for pad := 0xEC; bits.n < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	q := newQR(version)
+	q.drawFunctionPatterns(level)
+	q.drawCodewords(addECC(bits.bytes, version, level))
+
+	// Keep the mask that leaves the fewest patterns that confuse scanners
+	best, lowest := 0, -1
+	for mask := range 8 {
+		q.applyMask(mask)
+		q.drawFormat(level, mask)
+		if p := q.penalty(); lowest < 0 || p < lowest {
+			best, lowest = mask, p
+		}
+		q.applyMask(mask)
+	}
+	q.applyMask(best)
+	q.drawFormat(level, best)
+	return q.Symbol, nil
+}
+
+// bitBuffer collects bits, most significant first
+type bitBuffer struct {
+	bytes []byte
+	n     int
+}
+
+func (b *bitBuffer) append(value, count int) {
+	for i := count - 1; i >= 0; i-- {
+		if b.n%8 == 0 {
+			b.bytes = append(b.bytes, 0)
+		}
+		b.bytes[b.n/8] |= byte(value>>i&1) << (7 - b.n%8)
+		b.n++
+	}
+}
+
+// addECC splits the data into blocks, adds the error correction codewords of
+// each, and interleaves the blocks
+func addECC(data []byte, version int, level Level) []byte {
+	count, eccLen := eccBlocks[level][version], eccPerBlock[level][version]
+	raw := rawModules(version) / 8
+	short := count - raw%count // Blocks with one data codeword less
+	shortLen := raw / count
+
+	divisor := rsDivisor(eccLen)
+	blocks := make([][]byte, count)
+	k := 0
+	for i := range blocks {
+		n := shortLen - eccLen
+		if i >= short {
+			n++
+		}
+		block := append([]byte(nil), data[k:k+n]...)
+		k += n
+		ecc := rsRemainder(block, divisor)
+		if i < short {
+			block = append(block, 0) // Placeholder so all blocks have the same length
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	out := make([]byte, 0, raw)
+	for i := range shortLen + 1 {
+		for j, block := range blocks {
+			if i != shortLen-eccLen || j >= short {
+				out = append(out, block[i])
+			}
+		}
+	}
+	return out
+}
+
+// rsDivisor returns the generator polynomial of a Reed-Solomon code with the
+// given number of error correction codewords, without its leading term
+func rsDivisor(degree int) []byte {
+	out := make([]byte, degree)
+	out[degree-1] = 1
+	root := byte(1)
+	for range degree {
+		for j := range out {
+			out[j] = gfMultiply(out[j], root)
+			if j+1 < len(out) {
+				out[j] ^= out[j+1]
+			}
+		}
+		root = gfMultiply(root, 2)
+	}
+	return out
+}
+
+// rsRemainder returns the error correction codewords of data
+func rsRemainder(data, divisor []byte) []byte {
+	out := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ out[0]
+		copy(out, out[1:])
+		out[len(out)-1] = 0
+		for i, d := range divisor {
+			out[i] ^= gfMultiply(d, factor)
+		}
+	}
+	return out
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// qr is a QR code being drawn
+type qr struct {
+	*Symbol
+	version  int
+	function []bool // Modules of function patterns, which masks leave alone
+}
+
+func newQR(version int) *qr {
+	size := version*4 + 17
+	return &qr{
+		Symbol:   newSymbol(size, size, image.Pt(4, 4)),
+		version:  version,
+		function: make([]bool, size*size),
+	}
+}
+
+func (q *qr) setFunction(x, y int, dark bool) {
+	q.set(x, y, dark)
+	q.function[y*q.Width+x] = true
+}
+
+// drawFunctionPatterns draws the finder, alignment and timing patterns, and
+// reserves the format and version information
+func (q *qr) drawFunctionPatterns(level Level) {
+	size := q.Width
+	for i := range size {
+		q.setFunction(6, i, i%2 == 0)
+		q.setFunction(i, 6, i%2 == 0)
+	}
+	for _, c := range []image.Point{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c.X+dx, c.Y+dy
+				if x >= 0 && x < size && y >= 0 && y < size {
+					d := max(abs(dx), abs(dy))
+					q.setFunction(x, y, d != 2 && d != 4)
+				}
+			}
+		}
+	}
+	positions := alignmentPositions(q.version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// Not over the finder patterns
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+	q.drawFormat(level, 0)
+	q.drawVersion()
+}
+
+// alignmentPositions returns the centers of the alignment patterns on each
+// axis
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	count := version/7 + 2
+	step := (version*8 + count*3 + 5) / (count*4 - 4) * 2
+	out := make([]int, count)
+	out[0] = 6
+	for i, pos := count-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		out[i] = pos
+	}
+	return out
+}
+
+// formatWord returns the format information of a level and mask, protected
+// by a BCH code
+func formatWord(level Level, mask int) int {
+	data := formatBits[level]<<3 | mask
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// drawFormat draws both copies of the format information
+func (q *qr) drawFormat(level Level, mask int) {
+	bits := formatWord(level, mask)
+	bit := func(i int) bool { return bits>>i&1 != 0 }
+
+	size := q.Width
+	for i := range 6 {
+		q.setFunction(8, i, bit(i))
+	}
+	q.setFunction(8, 7, bit(6))
+	q.setFunction(8, 8, bit(7))
+	q.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.setFunction(14-i, 8, bit(i))
+	}
+	for i := range 8 {
+		q.setFunction(size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.setFunction(8, size-15+i, bit(i))
+	}
+	q.setFunction(8, size-8, true) // Always dark
+}
+
+// versionWord returns the version information, protected by a BCH code
+func versionWord(version int) int {
+	rem := version
+	for range 12 {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return version<<12 | rem
+}
+
+// drawVersion draws both copies of the version of codes from version 7 up
+func (q *qr) drawVersion() {
+	if q.version < 7 {
+		return
+	}
+	bits := versionWord(q.version)
+	for i := range 18 {
+		dark := bits>>i&1 != 0
+		a, b := q.Width-11+i%3, i/3
+		q.setFunction(a, b, dark)
+		q.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords places the codewords in the modules left by the function
+// patterns, in two-module columns zigzagging up and down from the bottom
+// right corner
+func (q *qr) drawCodewords(data []byte) {
+	size := q.Width
+	i := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // Skip the vertical timing pattern
+		}
+		for vert := range size {
+			for j := range 2 {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = size - 1 - vert
+				}
+				if !q.function[y*size+x] && i < len(data)*8 {
+					q.set(x, y, data[i>>3]>>(7-i&7)&1 != 0)
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by a mask pattern; applying it
+// again undoes it
+func (q *qr) applyMask(mask int) {
+	for y := range q.Height {
+		for x := range q.Width {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.function[y*q.Width+x] {
+				q.set(x, y, !q.Dark(x, y))
+			}
+		}
+	}
+}
+
+// finderLike is the 1:1:3:1:1 pattern of finders, with four light modules on
+// one side, which scanners may mistake for a finder
+var finderLike = [2][11]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// penalty scores the patterns of the code that make it harder to scan: long
+// runs of one color, 2x2 blocks, finder-like patterns, and an uneven balance
+// of dark and light
+func (q *qr) penalty() int {
+	size := q.Width
+	score := 0
+	for _, vertical := range []bool{false, true} {
+		at := func(line, i int) bool {
+			if vertical {
+				return q.Dark(line, i)
+			}
+			return q.Dark(i, line)
+		}
+		for line := range size {
+			run := 0
+			for i := range size {
+				if i > 0 && at(line, i) == at(line, i-1) {
+					run++
+				} else {
+					run = 1
+				}
+				if run == 5 {
+					score += 3
+				} else if run > 5 {
+					score++
+				}
+				if i+11 > size {
+					continue
+				}
+				for _, pattern := range finderLike {
+					match := true
+					for k, dark := range pattern {
+						if at(line, i+k) != dark {
+							match = false
+							break
+						}
+					}
+					if match {
+						score += 40
+					}
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := range size {
+		for x := range size {
+			c := q.Dark(x, y)
+			if c {
+				dark++
+			}
+			if x+1 < size && y+1 < size && c == q.Dark(x+1, y) && c == q.Dark(x, y+1) && c == q.Dark(x+1, y+1) {
+				score += 3
+			}
+		}
+	}
+	total := size * size
+	score += ((abs(dark*20-total*10)+total-1)/total - 1) * 10
+	return score
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
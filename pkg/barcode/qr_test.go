@@ -0,0 +1,184 @@
+package barcode
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRSRemainder(t *testing.T) {
+	// The codewords of HELLO WORLD in a version 1-M code
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestFormatAndVersionWords(t *testing.T) {
+	for _, tc := range []struct {
+		level Level
+		mask  int
+		want  int
+	}{
+		{LevelL, 0, 0b111011111000100},
+		{LevelM, 0, 0b101010000010010},
+		{LevelH, 0, 0b001011010001001},
+	} {
+		if got := formatWord(tc.level, tc.mask); got != tc.want {
+			t.Errorf("%s%d: expected %015b, got %015b", tc.level, tc.mask, tc.want, got)
+		}
+	}
+	if got := versionWord(7); got != 0b000111110010010100 {
+		t.Errorf("Expected version 7 as 000111110010010100, got %018b", got)
+	}
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	for version, want := range map[int][]int{
+		1:  nil,
+		2:  {6, 18},
+		7:  {6, 22, 38},
+		32: {6, 34, 60, 86, 112, 138},
+		40: {6, 30, 58, 86, 114, 142, 170},
+	} {
+		if got := alignmentPositions(version); !slices.Equal(got, want) {
+			t.Errorf("Version %d: expected %v, got %v", version, want, got)
+		}
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	for _, tc := range []struct {
+		length int
+		level  Level
+		size   int
+	}{
+		{14, LevelM, 21},  // Version 1
+		{15, LevelM, 25},  // Version 2
+		{119, LevelH, 57}, // Version 10
+		{2953, LevelL, 177},
+	} {
+		s, err := EncodeQR(bytes.Repeat([]byte("a"), tc.length), tc.level)
+		if err != nil {
+			t.Errorf("%d bytes at %s: %v", tc.length, tc.level, err)
+			continue
+		}
+		if s.Width != tc.size || s.Height != tc.size {
+			t.Errorf("%d bytes at %s: expected %d modules, got %dx%d", tc.length, tc.level, tc.size, s.Width, s.Height)
+		}
+	}
+	if _, err := EncodeQR(make([]byte, 2954), LevelL); err == nil || !strings.Contains(err.Error(), "at most 2953") {
+		t.Errorf("Expected an error for too long a payload, got %v", err)
+	}
+}
+
+// readFormat reads the level and mask of a code from the copy of the format
+// information around the top left finder
+func readFormat(t *testing.T, s *Symbol) (Level, int) {
+	t.Helper()
+	word := 0
+	positions := [][2]int{{8, 0}, {8, 1}, {8, 2}, {8, 3}, {8, 4}, {8, 5}, {8, 7}, {8, 8}, {7, 8}, {5, 8}, {4, 8}, {3, 8}, {2, 8}, {1, 8}, {0, 8}}
+	for i, p := range positions {
+		if s.Dark(p[0], p[1]) {
+			word |= 1 << i
+		}
+	}
+	for _, level := range []Level{LevelL, LevelM, LevelQ, LevelH} {
+		for mask := range 8 {
+			if formatWord(level, mask) == word {
+				return level, mask
+			}
+		}
+	}
+	t.Fatalf("Unknown format information %015b", word)
+	return 0, 0
+}
+
+func TestEncodeQR(t *testing.T) {
+	payload := []byte("https://example.com/assets/A-10042")
+	s, err := EncodeQR(payload, LevelQ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 34 bytes need version 4 at level Q
+	if s.Width != 33 {
+		t.Fatalf("Expected 33 modules, got %d", s.Width)
+	}
+	level, mask := readFormat(t, s)
+	if level != LevelQ {
+		t.Errorf("Expected level Q, got %s", level)
+	}
+
+	// The finders and the dark module are in place
+	for _, corner := range [][2]int{{0, 0}, {26, 0}, {0, 26}} {
+		for _, p := range [][2]int{{0, 0}, {6, 6}, {3, 3}} {
+			if !s.Dark(corner[0]+p[0], corner[1]+p[1]) {
+				t.Errorf("Expected a dark finder module at %v", [2]int{corner[0] + p[0], corner[1] + p[1]})
+			}
+		}
+		if s.Dark(corner[0]+1, corner[1]+1) {
+			t.Errorf("Expected a light finder ring at %v", corner)
+		}
+	}
+	if !s.Dark(8, s.Height-8) {
+		t.Errorf("Expected the dark module")
+	}
+
+	// Reading the modules back without the mask gives the codewords
+	q := newQR(4)
+	q.drawFunctionPatterns(level)
+	copy(q.dark, s.dark)
+	q.applyMask(mask)
+	var bits bitBuffer
+	size := q.Width
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := range size {
+			for j := range 2 {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = size - 1 - vert
+				}
+				if !q.function[y*size+x] {
+					if q.Dark(x, y) {
+						bits.append(1, 1)
+					} else {
+						bits.append(0, 1)
+					}
+				}
+			}
+		}
+	}
+	// Version 4-Q has two blocks of 24 data codewords, interleaved
+	codewords := bits.bytes[:100]
+	var data []byte
+	for i := range 24 {
+		data = append(data, codewords[2*i])
+	}
+	for i := range 24 {
+		data = append(data, codewords[2*i+1])
+	}
+	if data[0]>>4 != 0b0100 || int(data[0]&0xF)<<4|int(data[1]>>4) != len(payload) {
+		t.Fatalf("Expected byte mode and a length of %d, got %08b %08b", len(payload), data[0], data[1])
+	}
+	var decoded []byte
+	for i := range payload {
+		decoded = append(decoded, data[1+i]<<4|data[2+i]>>4)
+	}
+	if !bytes.Equal(decoded, payload) {
+		t.Errorf("Expected %q, got %q", payload, decoded)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := ParseLevel("h"); err != nil || level != LevelH {
+		t.Errorf("Expected H, got %v, %v", level, err)
+	}
+	if _, err := ParseLevel("X"); err == nil {
+		t.Errorf("Expected an error for an unknown level")
+	}
+}
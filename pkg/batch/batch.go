@@ -0,0 +1,52 @@
+package batch
+
+import (
+	"nim/pkg/image"
+)
+
+// Job is one conversion of a batch
+type Job struct {
+	Input   string
+	Output  string
+	Options image.ProcessOptions
+}
+
+// ProgressFunc is called before each job starts with the number of jobs done
+// so far, and once more with done equal to total when the batch completes
+type ProgressFunc func(done, total int, job Job)
+
+// Run processes the jobs in order with image.Process and stops at the first
+// failure. It returns the results of the jobs that completed. progress may be
+// nil.
+func Run(jobs []Job, progress ProgressFunc) ([]image.Result, error) {
+	return RunWithPolicy(jobs, Policy{}, progress)
+}
+
+// RunWithPolicy processes the jobs in order with image.Process, skipping or
+// retrying the jobs that fail as policy says. It returns the results of the
+// jobs that completed and, if any failed, an *Errors listing their outputs.
+func RunWithPolicy(jobs []Job, policy Policy, progress ProgressFunc) ([]image.Result, error) {
+	if progress == nil {
+		progress = func(int, int, Job) {}
+	}
+
+	runner := Runner{Policy: policy}
+	var results []image.Result
+	for i, job := range jobs {
+		progress(i, len(jobs), job)
+		err := runner.Do(job.Output, func() error {
+			result, err := image.Process(job.Input, job.Output, job.Options)
+			if err == nil {
+				results = append(results, result)
+			}
+			return err
+		})
+		if err != nil {
+			return results, err
+		}
+	}
+	if len(jobs) > 0 {
+		progress(len(jobs), len(jobs), jobs[len(jobs)-1])
+	}
+	return results, runner.Err()
+}
@@ -0,0 +1,128 @@
+package batch
+
+import (
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	nimimage "nim/pkg/image"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.png")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatalf("Failed to create input: %v", err)
+	}
+	png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 8, 8)))
+	f.Close()
+
+	options := nimimage.DefaultOptions()
+	options.Width, options.Height = 4, 4
+	jobs := []Job{
+		{Input: input, Output: filepath.Join(dir, "a.png"), Options: options},
+		{Input: input, Output: filepath.Join(dir, "b.png"), Options: options},
+	}
+
+	var calls [][2]int
+	results, err := Run(jobs, func(done, total int, job Job) { calls = append(calls, [2]int{done, total}) })
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(results) != 2 || results[1].Output != jobs[1].Output || results[1].Width != 4 {
+		t.Errorf("Unexpected results: %+v", results)
+	}
+
+	expected := [][2]int{{0, 2}, {1, 2}, {2, 2}}
+	if len(calls) != len(expected) {
+		t.Fatalf("Expected progress %v, got %v", expected, calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Errorf("Expected progress %v, got %v", expected, calls)
+			break
+		}
+	}
+	for _, job := range jobs {
+		if _, err := os.Stat(job.Output); err != nil {
+			t.Errorf("Expected %s to be written: %v", job.Output, err)
+		}
+	}
+}
+
+func TestRunStopsOnError(t *testing.T) {
+	dir := t.TempDir()
+	jobs := []Job{
+		{Input: filepath.Join(dir, "missing.png"), Output: filepath.Join(dir, "a.png"), Options: nimimage.DefaultOptions()},
+		{Input: filepath.Join(dir, "missing.png"), Output: filepath.Join(dir, "b.png"), Options: nimimage.DefaultOptions()},
+	}
+
+	started := 0
+	if _, err := Run(jobs, func(done, total int, job Job) { started++ }); err == nil {
+		t.Fatalf("Expected an error for a missing input")
+	}
+	if started != 1 {
+		t.Errorf("Expected the batch to stop after the first job, got %d starts", started)
+	}
+}
+
+func TestRunWithPolicy(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.png")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatalf("Failed to create input: %v", err)
+	}
+	png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 8, 8)))
+	f.Close()
+
+	missing := filepath.Join(dir, "missing.png")
+	jobs := []Job{
+		{Input: missing, Output: filepath.Join(dir, "a.png"), Options: nimimage.DefaultOptions()},
+		{Input: input, Output: filepath.Join(dir, "b.png"), Options: nimimage.DefaultOptions()},
+		{Input: missing, Output: filepath.Join(dir, "c.png"), Options: nimimage.DefaultOptions()},
+	}
+	results, err := RunWithPolicy(jobs, Policy{Action: ActionRetry, Retries: 1}, nil)
+	if len(results) != 1 || results[0].Output != jobs[1].Output {
+		t.Errorf("Expected the second job to complete, got %+v", results)
+	}
+	batchErr, ok := err.(*Errors)
+	if !ok {
+		t.Fatalf("Expected *Errors, got %v", err)
+	}
+	if batchErr.Total != 3 || batchErr.Aborted || len(batchErr.Failures) != 2 || !batchErr.Partial() {
+		t.Fatalf("Unexpected errors: %+v", batchErr)
+	}
+	if f := batchErr.Failures[1]; f.File != jobs[2].Output || f.Attempts != 2 || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected failure: %+v", f)
+	}
+
+	// A batch in which every file failed is not a partial failure
+	_, err = RunWithPolicy(jobs[:1], Policy{Action: ActionSkip}, nil)
+	if batchErr, ok := err.(*Errors); !ok || batchErr.Partial() {
+		t.Errorf("Expected a batch without successes, got %v", err)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := map[string]Policy{
+		"abort":   {Action: ActionAbort},
+		"Skip":    {Action: ActionSkip},
+		"retry":   {Action: ActionRetry, Retries: DefaultRetries},
+		"retry:5": {Action: ActionRetry, Retries: 5},
+	}
+	for spec, want := range tests {
+		if got, err := ParsePolicy(spec); err != nil || got != want {
+			t.Errorf("ParsePolicy(%q) = %+v, %v; expected %+v", spec, got, err, want)
+		}
+	}
+	for _, spec := range []string{"ignore", "retry:0", "retry:x", "skip:2"} {
+		if _, err := ParsePolicy(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package batch
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// journalVersion is the version of the journal format
+const journalVersion = 1
+
+// Journal records the files of a batch as they complete, so a run that is
+// interrupted by a crash, a power loss or ctrl-C can resume where it stopped.
+// It is a file of JSON lines: a header with the command line of the run,
+// then one line per completed file with the size and hash of its outputs.
+// Each line is flushed to disk before the next file starts.
+type Journal struct {
+	Args []string // Command line of the run, without the program name
+	Dir  string   // Working directory of the run
+
+	file  *os.File
+	done  map[string][]JournalOutput
+	wrote map[string]bool // Outputs recorded when the journal was opened
+}
+
+// journalHeader is the first line of a journal
+type journalHeader struct {
+	Journal int      `json:"nim_journal"`
+	Dir     string   `json:"dir"`
+	Args    []string `json:"args"`
+}
+
+// journalEntry is a line of a journal for a completed file
+type journalEntry struct {
+	Input   string          `json:"input"`
+	Output  string          `json:"output,omitempty"`
+	Outputs []JournalOutput `json:"outputs"`
+}
+
+// JournalOutput is a file written for an entry of a batch, with the hash
+// computed while it was written: its xxHash, or its SHA-256 when the run
+// used --hash sha256
+type JournalOutput struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	XXHash string `json:"xxhash,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// CreateJournal starts a journal for a run with the given arguments in dir.
+// It fails if the file already exists, so a journal is never overwritten by
+// mistake.
+func CreateJournal(path string, args []string, dir string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal: %w", err)
+	}
+	j := &Journal{Args: args, Dir: dir, file: file, done: make(map[string][]JournalOutput)}
+	if err := j.write(journalHeader{Journal: journalVersion, Dir: dir, Args: args}); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// OpenJournal reads a journal to resume its run, and opens it to record the
+// files that complete from then on. A last line cut short by a crash is
+// ignored.
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	j, end, err := readJournal(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("invalid journal %s: %w", path, err)
+	}
+	// Drop a partial last line, so the next entry starts on a line of its own
+	if err := file.Truncate(end); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to repair journal: %w", err)
+	}
+	if _, err := file.Seek(end, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	j.file = file
+	return j, nil
+}
+
+// readJournal reads the header and entries of a journal, returning the
+// offset after the last complete line
+func readJournal(r io.Reader) (*Journal, int64, error) {
+	reader := bufio.NewReader(r)
+	var end int64
+	var header journalHeader
+	line, err := reader.ReadBytes('\n')
+	if err != nil || json.Unmarshal(line, &header) != nil || header.Journal == 0 {
+		return nil, 0, errors.New("not a nim journal")
+	}
+	if header.Journal > journalVersion {
+		return nil, 0, fmt.Errorf("journal version %d is newer than this nim supports", header.Journal)
+	}
+	end += int64(len(line))
+
+	j := &Journal{Args: header.Args, Dir: header.Dir, done: make(map[string][]JournalOutput), wrote: make(map[string]bool)}
+	for n := 2; ; n++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		var entry journalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, 0, fmt.Errorf("line %d: %w", n, err)
+		}
+		j.done[journalKey(entry.Input, entry.Output)] = entry.Outputs
+		for _, o := range entry.Outputs {
+			j.wrote[filepath.Clean(o.Path)] = true
+		}
+		end += int64(len(line))
+	}
+	return j, end, nil
+}
+
+// journalKey identifies an entry of a batch by its input and output
+func journalKey(input, output string) string {
+	return input + "\t" + output
+}
+
+// Completed reports whether the entry of input and output was recorded, and
+// its outputs are still on disk with the size and hash they were written
+// with
+func (j *Journal) Completed(input, output string) bool {
+	outputs, ok := j.done[journalKey(input, output)]
+	if !ok {
+		return false
+	}
+	for _, o := range outputs {
+		if !unchanged(o) {
+			slog.Info("output changed since the journal recorded it", "file", input, "output", o.Path)
+			return false
+		}
+	}
+	return true
+}
+
+// Wrote reports whether path is an output of an entry recorded in the
+// journal before this run, which a resumed run may replace
+func (j *Journal) Wrote(path string) bool {
+	return j.wrote[filepath.Clean(path)]
+}
+
+// unchanged reports whether an output is on disk with the size and hash it
+// was recorded with. The sizes are compared first, which is quick; an output
+// recorded without a hash is only compared by size.
+func unchanged(o JournalOutput) bool {
+	info, err := os.Stat(o.Path)
+	if err != nil || info.Size() != o.Size {
+		return false
+	}
+	switch {
+	case o.XXHash != "":
+		current, err := hashFile(o.Path, xxhash.New())
+		return err == nil && current == o.XXHash
+	case o.SHA256 != "":
+		current, err := hashFile(o.Path, sha256.New())
+		return err == nil && current == o.SHA256
+	}
+	return true
+}
+
+// Record adds a completed entry with the files written for it, hashed as
+// they were written, and flushes the journal to disk
+func (j *Journal) Record(input, output string, outputs []JournalOutput) error {
+	if err := j.write(journalEntry{Input: input, Output: output, Outputs: outputs}); err != nil {
+		return err
+	}
+	j.done[journalKey(input, output)] = outputs
+	return nil
+}
+
+// write appends a line and flushes it to disk
+func (j *Journal) write(v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// hashFile returns the hex digest of a file with h
+func hashFile(path string, h hash.Hash) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,118 @@
+package batch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestJournal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "run.journal")
+	args := []string{"--files-from", "list.txt", "out/{name}.avif", "--journal", "run.journal"}
+	j, err := CreateJournal(path, args, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := filepath.Join(dir, "a.avif"), filepath.Join(dir, "b.avif")
+	os.WriteFile(a, []byte("first"), 0o644)
+	os.WriteFile(b, []byte("second"), 0o644)
+	if err := j.Record("a.jpg", a, []JournalOutput{written(t, a)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Record("b.jpg", b, []JournalOutput{written(t, b)}); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+	if _, err := CreateJournal(path, args, dir); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Expected an existing journal to be kept, got %v", err)
+	}
+
+	// A crash in the middle of a line leaves it cut short
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"input":"c.jpg","outp`)
+	f.Close()
+	// An output is changed after it was recorded, with the same size
+	os.WriteFile(b, []byte("SECOND"), 0o644)
+
+	j, err = OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(j.Args, args) || j.Dir != dir {
+		t.Errorf("Unexpected command line %v in %s", j.Args, j.Dir)
+	}
+	if !j.Completed("a.jpg", a) || j.Completed("b.jpg", b) || j.Completed("c.jpg", "") || j.Completed("a.jpg", b) {
+		t.Errorf("Expected only a.jpg to be completed")
+	}
+	if !j.Wrote(a) || !j.Wrote(b) || j.Wrote(filepath.Join(dir, "c.avif")) {
+		t.Errorf("Expected only the recorded outputs to be written by the journal's run")
+	}
+	os.Remove(a)
+	if j.Completed("a.jpg", a) {
+		t.Errorf("Expected a missing output to be converted again")
+	}
+
+	// The partial line is dropped before new entries are added
+	if err := j.Record("b.jpg", b, []JournalOutput{written(t, b)}); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+	data, _ := os.ReadFile(path)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 4 || strings.Contains(string(data), "c.jpg") {
+		t.Errorf("Unexpected journal:\n%s", data)
+	}
+	j, err = OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if !j.Completed("b.jpg", b) {
+		t.Errorf("Expected b.jpg to be completed once recorded again")
+	}
+}
+
+func TestOpenJournalInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	os.WriteFile(path, []byte("a.jpg\nb.jpg\n"), 0o644)
+	if _, err := OpenJournal(path); err == nil || !strings.Contains(err.Error(), "not a nim journal") {
+		t.Errorf("Expected an error for a file that is not a journal, got %v", err)
+	}
+	if _, err := OpenJournal(path + ".missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected a missing journal error, got %v", err)
+	}
+}
+
+func TestJournalSHA256(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.avif")
+	os.WriteFile(path, []byte("first"), 0o644)
+	sum := sha256.Sum256([]byte("first"))
+	o := JournalOutput{Path: path, Size: 5, SHA256: hex.EncodeToString(sum[:])}
+	if !unchanged(o) {
+		t.Errorf("Expected an output recorded with its SHA-256 to be unchanged")
+	}
+	os.WriteFile(path, []byte("FIRST"), 0o644)
+	if unchanged(o) {
+		t.Errorf("Expected a changed output to be detected by its SHA-256")
+	}
+}
+
+// written returns the journal output of the file at path, as an encoder
+// that hashed it while writing it would
+func written(t *testing.T, path string) JournalOutput {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return JournalOutput{Path: path, Size: int64(len(data)), XXHash: fmt.Sprintf("%016x", xxhash.Sum64(data))}
+}
@@ -0,0 +1,59 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Entry is a file of a list, with the output to write it to if the list
+// gives one
+type Entry struct {
+	Input  string
+	Output string
+}
+
+// ReadList reads a list of files, one per line, or separated by NUL bytes
+// when null is true, as find -print0 writes them. An entry is an input path,
+// or an input and an output path separated by a tab. Empty entries are
+// skipped.
+func ReadList(r io.Reader, null bool) ([]Entry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if null {
+		scanner.Split(splitNull)
+	}
+
+	var entries []Entry
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !null {
+			line = strings.TrimSuffix(line, "\r")
+		}
+		if line == "" {
+			continue
+		}
+		input, output, _ := strings.Cut(line, "\t")
+		if input == "" {
+			return nil, fmt.Errorf("invalid file list entry: %q (expected INPUT or INPUT<TAB>OUTPUT)", line)
+		}
+		entries = append(entries, Entry{Input: input, Output: output})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file list: %w", err)
+	}
+	return entries, nil
+}
+
+// splitNull is a bufio.SplitFunc for entries ending with a NUL byte
+func splitNull(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
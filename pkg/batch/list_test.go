@@ -0,0 +1,30 @@
+package batch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadList(t *testing.T) {
+	entries, err := ReadList(strings.NewReader("a.jpg\r\n\nphotos/b c.png\tout/b.webp\n"), false)
+	if err != nil {
+		t.Fatalf("ReadList failed: %v", err)
+	}
+	expected := []Entry{{Input: "a.jpg"}, {Input: "photos/b c.png", Output: "out/b.webp"}}
+	if len(entries) != len(expected) || entries[0] != expected[0] || entries[1] != expected[1] {
+		t.Errorf("Expected %+v, got %+v", expected, entries)
+	}
+
+	// find -print0 output, where names may contain newlines
+	entries, err = ReadList(strings.NewReader("./a\nb.jpg\x00./c.png\x00"), true)
+	if err != nil {
+		t.Fatalf("ReadList failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Input != "./a\nb.jpg" || entries[1].Input != "./c.png" {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+
+	if _, err := ReadList(strings.NewReader("\tout.png\n"), false); err == nil {
+		t.Error("Expected an error for an entry without an input")
+	}
+}
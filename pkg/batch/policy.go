@@ -0,0 +1,150 @@
+package batch
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// Action is what a batch does when a file fails
+type Action string
+
+const (
+	// ActionAbort stops the batch at the first failure
+	ActionAbort Action = "abort"
+	// ActionSkip goes on with the next file
+	ActionSkip Action = "skip"
+	// ActionRetry tries the file again, then goes on with the next one
+	ActionRetry Action = "retry"
+)
+
+// DefaultRetries is how many times ActionRetry tries a file again when no
+// count is given
+const DefaultRetries = 2
+
+// Policy is how a batch handles files that fail. The zero value aborts.
+type Policy struct {
+	Action  Action
+	Retries int // Attempts after the first one with ActionRetry
+}
+
+// ParsePolicy parses a policy in the form abort, skip, retry or retry:N
+func ParsePolicy(spec string) (Policy, error) {
+	name, count, hasCount := strings.Cut(strings.ToLower(strings.TrimSpace(spec)), ":")
+	switch Action(name) {
+	case ActionAbort, ActionSkip:
+		if !hasCount {
+			return Policy{Action: Action(name)}, nil
+		}
+	case ActionRetry:
+		if !hasCount {
+			return Policy{Action: ActionRetry, Retries: DefaultRetries}, nil
+		}
+		if n, err := strconv.Atoi(count); err == nil && n > 0 {
+			return Policy{Action: ActionRetry, Retries: n}, nil
+		}
+	}
+	return Policy{}, fmt.Errorf("invalid error policy: %s (expected skip, abort, retry or retry:N)", spec)
+}
+
+// Failure is a file of a batch that failed
+type Failure struct {
+	File     string // File the failure is reported for
+	Attempts int    // Number of times the file was tried
+	Err      error  // Error of the last attempt
+}
+
+func (f Failure) Error() string {
+	return fmt.Sprintf("failed to process %s: %v", f.File, f.Err)
+}
+
+func (f Failure) Unwrap() error {
+	return f.Err
+}
+
+// Errors is the error of a batch in which files failed
+type Errors struct {
+	Failures []Failure
+	Total    int  // Number of files attempted, including the failed ones
+	Aborted  bool // Whether the batch stopped at the last failure
+}
+
+func (e *Errors) Error() string {
+	if len(e.Failures) == 1 {
+		return e.Failures[0].Error()
+	}
+	return fmt.Sprintf("%d of %d files failed, first: %v", len(e.Failures), e.Total, e.Failures[0])
+}
+
+// Partial reports whether some files of the batch succeeded
+func (e *Errors) Partial() bool {
+	return len(e.Failures) < e.Total
+}
+
+// Unwrap returns the failures, so errors.Is and errors.As see their errors
+func (e *Errors) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f
+	}
+	return errs
+}
+
+// Runner runs the files of a batch one at a time under a policy, collecting
+// the files that fail
+type Runner struct {
+	Policy   Policy
+	failures []Failure
+	total    int
+}
+
+// Do runs fn for file, trying it again as the policy allows. It only returns
+// an error, the *Errors of the batch, when the batch must stop.
+func (r *Runner) Do(file string, fn func() error) error {
+	attempts := 1
+	if r.Policy.Action == ActionRetry {
+		attempts += r.Policy.Retries
+	}
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fn(); err == nil {
+			r.total++
+			return nil
+		}
+		if attempt < attempts {
+			slog.Warn("retrying file", "file", file, "attempt", attempt+1, "error", err)
+		}
+	}
+	return r.fail(Failure{File: file, Attempts: attempts, Err: err})
+}
+
+// Fail records that file failed before it could be run, such as when it
+// cannot be read, without trying it again. It returns an error when the
+// batch must stop, like Do.
+func (r *Runner) Fail(file string, err error) error {
+	return r.fail(Failure{File: file, Attempts: 1, Err: err})
+}
+
+func (r *Runner) fail(f Failure) error {
+	r.total++
+	r.failures = append(r.failures, f)
+	if r.Policy.Action == ActionSkip || r.Policy.Action == ActionRetry {
+		slog.Warn("skipping file", "file", f.File, "error", f.Err)
+		return nil
+	}
+	return &Errors{Failures: r.failures, Total: r.total, Aborted: true}
+}
+
+// Total returns the number of files run so far, including the failed ones
+func (r *Runner) Total() int {
+	return r.total
+}
+
+// Err returns the *Errors of the files that failed, or nil if none did
+func (r *Runner) Err() error {
+	if len(r.failures) == 0 {
+		return nil
+	}
+	return &Errors{Failures: r.failures, Total: r.total}
+}
@@ -0,0 +1,189 @@
+package bench
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"time"
+
+	nimimage "nim/pkg/image"
+)
+
+// Operations that can be benchmarked
+const (
+	OperationDecode = "decode" // Read and decode a file
+	OperationResize = "resize" // Shrink an image to half its size with the Lanczos filter
+	OperationEncode = "encode" // Encode an image in memory
+)
+
+// Operations lists the benchmark operations in the order they run
+var Operations = []string{OperationDecode, OperationResize, OperationEncode}
+
+// Case is one benchmark: an operation on a synthetic image of a size, in a
+// format for decoding and encoding
+type Case struct {
+	Operation string
+	Format    string // Empty for resize
+	Width     int
+	Height    int
+}
+
+// Result is the measurement of a case
+type Result struct {
+	Case
+	Ops          int           // Number of times the operation ran
+	Duration     time.Duration // Time they took
+	Allocs       uint64        // Heap allocations per operation
+	AllocBytes   uint64        // Bytes allocated per operation
+	EncodedBytes int           // Size of the encoded image, for decode and encode
+}
+
+// OpsPerSecond returns the number of operations per second
+func (r Result) OpsPerSecond() float64 {
+	return float64(r.Ops) / r.Duration.Seconds()
+}
+
+// MBPerSecond returns the megabytes of decoded 8-bit RGBA pixels handled per
+// second, which compares operations across image sizes
+func (r Result) MBPerSecond() float64 {
+	return r.OpsPerSecond() * float64(r.Width*r.Height*4) / 1e6
+}
+
+// Cases returns every combination of operations, formats and sizes. Resizing
+// does not depend on the format, so it has one case per size.
+func Cases(operations, formats []string, sizes []image.Point) []Case {
+	var cases []Case
+	for _, size := range sizes {
+		for _, operation := range operations {
+			if operation == OperationResize {
+				cases = append(cases, Case{Operation: operation, Width: size.X, Height: size.Y})
+				continue
+			}
+			for _, format := range formats {
+				cases = append(cases, Case{Operation: operation, Format: format, Width: size.X, Height: size.Y})
+			}
+		}
+	}
+	return cases
+}
+
+// Run runs a case over and over for at least duration, after one run to warm
+// up. options sets the encoder settings; its size, format and output
+// settings are replaced by the case.
+func Run(c Case, duration time.Duration, options nimimage.ProcessOptions) (Result, error) {
+	if !slices.Contains(Operations, c.Operation) {
+		return Result{}, fmt.Errorf("unknown benchmark operation: %s", c.Operation)
+	}
+	if c.Width <= 0 || c.Height <= 0 {
+		return Result{}, fmt.Errorf("invalid benchmark size: %dx%d", c.Width, c.Height)
+	}
+	img := Image(c.Width, c.Height)
+	options.OutputFormat = c.Format
+	options.Hooks = nimimage.Hooks{}
+
+	var op func() error
+	result := Result{Case: c}
+	switch c.Operation {
+	case OperationDecode:
+		// The file is written once, then read back
+		dir, err := os.MkdirTemp("", "nim-bench")
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "bench."+c.Format)
+		if err := nimimage.SaveImage(img, path, options); err != nil {
+			return Result{}, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to read benchmark file: %w", err)
+		}
+		result.EncodedBytes = int(info.Size())
+		op = func() error {
+			_, err := nimimage.OpenImageWithOptions(path, options)
+			return err
+		}
+	case OperationResize:
+		options.Width, options.Height = max(1, c.Width/2), max(1, c.Height/2)
+		options.ResizeMode = nimimage.ResizeModeFit
+		op = func() error {
+			_, err := nimimage.Resize(img, options)
+			return err
+		}
+	case OperationEncode:
+		op = func() error {
+			counter := &countingWriter{}
+			if err := nimimage.Encode(counter, img, options); err != nil {
+				return err
+			}
+			result.EncodedBytes = counter.n
+			return nil
+		}
+	}
+
+	if err := op(); err != nil {
+		return Result{}, fmt.Errorf("%s %s failed: %w", c.Operation, c.Format, err)
+	}
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for result.Ops == 0 || time.Since(start) < duration {
+		if err := op(); err != nil {
+			return Result{}, fmt.Errorf("%s %s failed: %w", c.Operation, c.Format, err)
+		}
+		result.Ops++
+	}
+	result.Duration = time.Since(start)
+	runtime.ReadMemStats(&after)
+	result.Allocs = (after.Mallocs - before.Mallocs) / uint64(result.Ops)
+	result.AllocBytes = (after.TotalAlloc - before.TotalAlloc) / uint64(result.Ops)
+	return result, nil
+}
+
+// Image returns the synthetic image the benchmarks use: smooth color
+// gradients, like skies, with fine detail, like foliage, so encoders do
+// realistic work. It is the same for a given size.
+func Image(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	seed := uint32(1)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// A small xorshift generator for the detail
+			seed ^= seed << 13
+			seed ^= seed >> 17
+			seed ^= seed << 5
+			fx, fy := float64(x)/float64(width), float64(y)/float64(height)
+			detail := float64(seed%32) - 16
+			if fx+fy > 1 {
+				detail /= 4
+			}
+			p := img.Pix[y*img.Stride+x*4:]
+			p[0] = channel(255*fx + detail)
+			p[1] = channel(128 + 100*math.Sin(6*fy+3*fx) + detail)
+			p[2] = channel(255*(1-fy) + detail)
+			p[3] = 255
+		}
+	}
+	return img
+}
+
+// channel clamps v to a byte
+func channel(v float64) uint8 {
+	return uint8(max(0, min(255, math.Round(v))))
+}
+
+// countingWriter counts the bytes written to it and discards them
+type countingWriter struct {
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
@@ -0,0 +1,54 @@
+package bench
+
+import (
+	"bytes"
+	"image"
+	"testing"
+	"time"
+
+	nimimage "nim/pkg/image"
+)
+
+func TestCases(t *testing.T) {
+	sizes := []image.Point{{64, 48}, {32, 32}}
+	cases := Cases(Operations, []string{"jpg", "png"}, sizes)
+	// Two decodes, one resize and two encodes per size
+	if len(cases) != 10 {
+		t.Fatalf("%d cases: %v", len(cases), cases)
+	}
+	if c := cases[2]; c.Operation != OperationResize || c.Format != "" || c.Width != 64 {
+		t.Errorf("third case: %+v", c)
+	}
+}
+
+func TestRun(t *testing.T) {
+	options := nimimage.DefaultOptions()
+	for _, c := range Cases(Operations, []string{"jpg", "png"}, []image.Point{{64, 48}}) {
+		result, err := Run(c, time.Millisecond, options)
+		if err != nil {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if result.Ops < 1 || result.OpsPerSecond() <= 0 || result.MBPerSecond() <= 0 {
+			t.Errorf("%+v: %+v", c, result)
+		}
+		if (c.Operation == OperationResize) != (result.EncodedBytes == 0) {
+			t.Errorf("%+v: encoded %d bytes", c, result.EncodedBytes)
+		}
+	}
+
+	for _, c := range []Case{{Operation: "rotate", Width: 8, Height: 8}, {Operation: OperationResize}, {Operation: OperationEncode, Format: "xyz", Width: 8, Height: 8}} {
+		if _, err := Run(c, time.Millisecond, options); err == nil {
+			t.Errorf("%+v: expected an error", c)
+		}
+	}
+}
+
+func TestImage(t *testing.T) {
+	a, b := Image(40, 30), Image(40, 30)
+	if !bytes.Equal(a.Pix, b.Pix) {
+		t.Error("the benchmark image differs between calls")
+	}
+	if !a.Opaque() || a.Pix[0] == a.Pix[len(a.Pix)-4] {
+		t.Error("expected an opaque gradient")
+	}
+}
@@ -0,0 +1,387 @@
+// Package card renders social cards, such as Open Graph and Twitter images,
+// from a template: a background image, color or gradient, a title and a
+// subtitle in TrueType or OpenType fonts, and a logo
+package card
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"gopkg.in/yaml.v3"
+	"nim/pkg/colorparse"
+	"nim/pkg/effect"
+	nimimage "nim/pkg/image"
+	"nim/pkg/resample"
+)
+
+// Default size of Open Graph images
+const (
+	DefaultWidth  = 1200
+	DefaultHeight = 630
+)
+
+// minScale is how far titles that do not fit are shrunk before they are cut
+const minScale = 0.6
+
+// Template describes a card. Paths of images and fonts are relative to the
+// template file.
+type Template struct {
+	Width      int        `yaml:"width"`
+	Height     int        `yaml:"height"`
+	Padding    int        `yaml:"padding"`
+	Align      string     `yaml:"align"` // left or center
+	Background Background `yaml:"background"`
+	Title      Text       `yaml:"title"`
+	Subtitle   Text       `yaml:"subtitle"`
+	Logo       Logo       `yaml:"logo"`
+}
+
+// Background is the image, gradient or color behind the text. An image
+// covers the card and takes precedence over a gradient, which takes
+// precedence over a color. Without any, the card has a dark blue gradient.
+type Background struct {
+	Image    string   `yaml:"image"`
+	Dim      float64  `yaml:"dim"` // Darkening of the image from 0 to 1, to keep text legible
+	Gradient []string `yaml:"gradient"`
+	Angle    float64  `yaml:"angle"` // Direction of the gradient in degrees, 0 from left to right, 90 from top to bottom
+	Color    string   `yaml:"color"`
+}
+
+// Text is a block of text, wrapped to the width of the card. If it needs
+// more than MaxLines lines, it is shrunk down to 60% of Size, then cut with
+// an ellipsis.
+type Text struct {
+	Text     string  `yaml:"text"`
+	Font     string  `yaml:"font"` // TrueType or OpenType file; Go Bold for titles and Go Regular for subtitles by default
+	Size     float64 `yaml:"size"` // Height of the font in pixels
+	Color    string  `yaml:"color"`
+	MaxLines int     `yaml:"max_lines"`
+}
+
+// Logo is an image in a corner of the card
+type Logo struct {
+	Image    string `yaml:"image"`
+	Width    int    `yaml:"width"`
+	Position string `yaml:"position"` // top-left, top-right, bottom-left or bottom-right
+}
+
+// Default returns the template used when none is given: white text on a
+// dark blue gradient
+func Default() Template {
+	return Template{
+		Width:    DefaultWidth,
+		Height:   DefaultHeight,
+		Padding:  80,
+		Align:    "left",
+		Title:    Text{Size: 72, Color: "#FFFFFF", MaxLines: 3},
+		Subtitle: Text{Size: 36, Color: "#CBD5E1", MaxLines: 2},
+		Logo:     Logo{Width: 160, Position: "bottom-right"},
+	}
+}
+
+// Load reads a template from a YAML or JSON file. Unset fields keep the
+// values of Default, and relative paths are resolved against the directory
+// of the file.
+func Load(path string) (Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Template{}, fmt.Errorf("failed to read card template: %w", err)
+	}
+	t := Default()
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&t); err != nil {
+		return Template{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	dir := filepath.Dir(path)
+	for _, p := range []*string{&t.Background.Image, &t.Title.Font, &t.Subtitle.Font, &t.Logo.Image} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	return t, nil
+}
+
+// Render draws the card described by t
+func Render(t Template) (*image.NRGBA, error) {
+	if t.Width <= 0 || t.Height <= 0 {
+		return nil, fmt.Errorf("invalid card size: %dx%d", t.Width, t.Height)
+	}
+	if t.Padding < 0 || 2*t.Padding >= min(t.Width, t.Height) {
+		return nil, fmt.Errorf("invalid padding: %d (expected 0 to less than half the card size)", t.Padding)
+	}
+	if t.Align != "" && t.Align != "left" && t.Align != "center" {
+		return nil, fmt.Errorf("invalid align: %s (expected left or center)", t.Align)
+	}
+
+	card, err := background(t.Background, t.Width, t.Height)
+	if err != nil {
+		return nil, err
+	}
+	area := image.Rect(t.Padding, t.Padding, t.Width-t.Padding, t.Height-t.Padding)
+
+	if t.Logo.Image != "" {
+		logo, err := nimimage.OpenImage(t.Logo.Image)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open logo: %w", err)
+		}
+		width := min(t.Logo.Width, area.Dx())
+		if width <= 0 {
+			return nil, fmt.Errorf("invalid logo width: %d", t.Logo.Width)
+		}
+		bounds := logo.Bounds()
+		scaled := resample.Resize(logo, width, max(1, int(math.Round(float64(bounds.Dy()*width)/float64(bounds.Dx())))))
+		size := scaled.Rect.Size()
+		var at image.Point
+		switch t.Logo.Position {
+		case "top-left":
+			at = area.Min
+		case "top-right":
+			at = image.Pt(area.Max.X-size.X, area.Min.Y)
+		case "bottom-left":
+			at = image.Pt(area.Min.X, area.Max.Y-size.Y)
+		case "bottom-right", "":
+			at = area.Max.Sub(size)
+		default:
+			return nil, fmt.Errorf("invalid logo position: %s (expected top-left, top-right, bottom-left or bottom-right)", t.Logo.Position)
+		}
+		draw.Draw(card, image.Rectangle{at, at.Add(size)}, scaled, image.Point{}, draw.Over)
+		// Keep the text clear of the logo
+		gap := t.Padding / 2
+		if strings.HasPrefix(t.Logo.Position, "top") {
+			area.Min.Y = min(at.Y+size.Y+gap, area.Max.Y)
+		} else {
+			area.Max.Y = max(at.Y-gap, area.Min.Y)
+		}
+	}
+
+	// Center the title and subtitle vertically in the area left
+	title, err := layout(t.Title, gobold.TTF, area.Dx())
+	if err != nil {
+		return nil, fmt.Errorf("invalid title: %w", err)
+	}
+	subtitle, err := layout(t.Subtitle, goregular.TTF, area.Dx())
+	if err != nil {
+		return nil, fmt.Errorf("invalid subtitle: %w", err)
+	}
+	gap := 0
+	if len(title.lines) > 0 && len(subtitle.lines) > 0 {
+		gap = int(t.Subtitle.Size * 0.6)
+	}
+	y := area.Min.Y + (area.Dy()-title.height()-gap-subtitle.height())/2
+	y = title.draw(card, area, t.Align, max(y, area.Min.Y))
+	subtitle.draw(card, area, t.Align, y+gap)
+	return card, nil
+}
+
+// background returns a card of the given size filled with b
+func background(b Background, width, height int) (*image.NRGBA, error) {
+	switch {
+	case b.Image != "":
+		img, err := nimimage.OpenImage(b.Image)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open background: %w", err)
+		}
+		if b.Dim < 0 || b.Dim > 1 {
+			return nil, fmt.Errorf("invalid background dim: %g (expected 0 to 1)", b.Dim)
+		}
+		card := effect.Flatten(resample.Fill(img, width, height), color.NRGBA{0, 0, 0, 255})
+		for i := range card.Pix {
+			if i%4 != 3 {
+				card.Pix[i] = uint8(float64(card.Pix[i])*(1-b.Dim) + 0.5)
+			}
+		}
+		return card, nil
+	case len(b.Gradient) > 0:
+		return Gradient(width, height, b.Gradient, b.Angle)
+	}
+	if b.Color == "" {
+		return Gradient(width, height, []string{"#1E3A8A", "#0F172A"}, 45)
+	}
+	c, err := colorparse.Parse(b.Color)
+	if err != nil {
+		return nil, err
+	}
+	card := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(card, card.Rect, image.NewUniform(c), image.Point{}, draw.Src)
+	return card, nil
+}
+
+// Gradient returns an image of a linear gradient through colors at evenly
+// spaced stops, in the direction of angle degrees
+func Gradient(width, height int, colors []string, angle float64) (*image.NRGBA, error) {
+	stops := make([]color.NRGBA, len(colors))
+	for i, value := range colors {
+		var err error
+		if stops[i], err = colorparse.Parse(value); err != nil {
+			return nil, err
+		}
+	}
+	if len(stops) == 1 {
+		stops = append(stops, stops[0])
+	}
+
+	// Project pixels on the direction, spanning the whole image from 0 to 1
+	dx, dy := math.Cos(angle*math.Pi/180), math.Sin(angle*math.Pi/180)
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, corner := range [][2]float64{{0, 0}, {float64(width), 0}, {0, float64(height)}, {float64(width), float64(height)}} {
+		p := corner[0]*dx + corner[1]*dy
+		lo, hi = min(lo, p), max(hi, p)
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			t := ((float64(x)+0.5)*dx + (float64(y)+0.5)*dy - lo) / (hi - lo)
+			pos := min(max(t, 0), 1) * float64(len(stops)-1)
+			i := min(int(pos), len(stops)-2)
+			f := pos - float64(i)
+			a, b := stops[i], stops[i+1]
+			p := img.Pix[y*img.Stride+x*4 : y*img.Stride+x*4+4 : y*img.Stride+x*4+4]
+			p[0] = uint8(float64(a.R)*(1-f) + float64(b.R)*f + 0.5)
+			p[1] = uint8(float64(a.G)*(1-f) + float64(b.G)*f + 0.5)
+			p[2] = uint8(float64(a.B)*(1-f) + float64(b.B)*f + 0.5)
+			p[3] = uint8(float64(a.A)*(1-f) + float64(b.A)*f + 0.5)
+		}
+	}
+	return img, nil
+}
+
+// block is a text wrapped into lines with the face it is drawn with
+type block struct {
+	face    font.Face
+	lines   []string
+	color   color.NRGBA
+	leading int
+}
+
+// height returns the height of the lines of b in pixels
+func (b block) height() int {
+	return len(b.lines) * b.leading
+}
+
+// draw draws the lines of b in area from y, and returns the y below them
+func (b block) draw(dst *image.NRGBA, area image.Rectangle, align string, y int) int {
+	if len(b.lines) == 0 {
+		return y
+	}
+	metrics := b.face.Metrics()
+	// Center the glyphs in the line height
+	baseline := (b.leading + (metrics.Ascent - metrics.Descent).Round()) / 2
+	d := font.Drawer{Dst: dst, Src: image.NewUniform(b.color), Face: b.face}
+	for _, line := range b.lines {
+		x := area.Min.X
+		if align == "center" {
+			x += (area.Dx() - d.MeasureString(line).Round()) / 2
+		}
+		d.Dot = fixed.P(x, y+baseline)
+		d.DrawString(line)
+		y += b.leading
+	}
+	return y
+}
+
+// layout wraps t into lines of at most width pixels, shrinking its font or
+// cutting it to fit t.MaxLines
+func layout(t Text, fallback []byte, width int) (block, error) {
+	text := strings.Join(strings.Fields(t.Text), " ")
+	if text == "" {
+		return block{}, nil
+	}
+	if t.Size <= 0 {
+		return block{}, fmt.Errorf("invalid font size: %g", t.Size)
+	}
+	c := color.NRGBA{255, 255, 255, 255}
+	if t.Color != "" {
+		var err error
+		if c, err = colorparse.Parse(t.Color); err != nil {
+			return block{}, err
+		}
+	}
+	data := fallback
+	if t.Font != "" {
+		var err error
+		if data, err = os.ReadFile(t.Font); err != nil {
+			return block{}, fmt.Errorf("failed to read font: %w", err)
+		}
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return block{}, fmt.Errorf("failed to parse font %s: %w", t.Font, err)
+	}
+
+	size := t.Size
+	for {
+		face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return block{}, err
+		}
+		lines := wrap(face, text, width)
+		fits := t.MaxLines <= 0 || len(lines) <= t.MaxLines
+		if fits || size*0.95 < t.Size*minScale {
+			if !fits {
+				lines = lines[:t.MaxLines]
+				lines[len(lines)-1] = ellipsize(face, lines[len(lines)-1], width)
+			}
+			return block{face: face, lines: lines, color: c, leading: int(math.Ceil(size * 1.2))}, nil
+		}
+		size *= 0.95
+	}
+}
+
+// wrap breaks text into lines of at most width pixels at spaces, or within
+// words that are wider than a line
+func wrap(face font.Face, text string, width int) []string {
+	limit := fixed.I(width)
+	var lines []string
+	line := ""
+	for _, word := range strings.Split(text, " ") {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if font.MeasureString(face, candidate) <= limit {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		// Break words that do not fit on a line of their own
+		line = ""
+		for _, r := range word {
+			if line != "" && font.MeasureString(face, line+string(r)) > limit {
+				lines = append(lines, line)
+				line = ""
+			}
+			line += string(r)
+		}
+	}
+	return append(lines, line)
+}
+
+// ellipsize ends line with an ellipsis that fits in width pixels
+func ellipsize(face font.Face, line string, width int) string {
+	runes := []rune(line)
+	for len(runes) > 0 {
+		cut := strings.TrimRightFunc(string(runes), func(r rune) bool { return unicode.IsSpace(r) || unicode.IsPunct(r) }) + "…"
+		if font.MeasureString(face, cut) <= fixed.I(width) {
+			return cut
+		}
+		runes = runes[:len(runes)-1]
+	}
+	return "…"
+}
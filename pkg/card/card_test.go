@@ -0,0 +1,152 @@
+package card
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	logo := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for i := range logo.Pix {
+		logo.Pix[i] = 255
+	}
+	f, err := os.Create(filepath.Join(dir, "logo.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, logo); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	template := filepath.Join(dir, "card.yaml")
+	yaml := `
+width: 600
+height: 300
+padding: 20
+background:
+  color: "#000000"
+title:
+  text: A title long enough to need more than a single line on this card
+  size: 40
+  max_lines: 2
+logo:
+  image: logo.png
+  width: 80
+  position: top-right
+`
+	if err := os.WriteFile(template, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := Load(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.Subtitle.Size != 36 {
+		t.Errorf("expected the default subtitle size, got %g", tmpl.Subtitle.Size)
+	}
+	img, err := Render(tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Rect.Dx() != 600 || img.Rect.Dy() != 300 {
+		t.Fatalf("expected 600x300, got %v", img.Rect.Size())
+	}
+	// The logo is scaled to 80x40 in the top-right corner of the padding
+	if c := img.NRGBAAt(540, 30); c != (color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("expected the logo at the top right, got %v", c)
+	}
+	if c := img.NRGBAAt(5, 5); c != (color.NRGBA{0, 0, 0, 255}) {
+		t.Errorf("expected the background color in the padding, got %v", c)
+	}
+	// The title is drawn in white below the logo
+	lit := 0
+	for y := 80; y < 280; y++ {
+		for x := 20; x < 580; x++ {
+			if img.NRGBAAt(x, y).R > 128 {
+				lit++
+			}
+		}
+	}
+	if lit < 1000 {
+		t.Errorf("expected the title to be drawn, got %d lit pixels", lit)
+	}
+
+	if _, err := Render(Template{Width: 100, Height: 100, Padding: 60}); err == nil {
+		t.Error("expected an error for padding larger than the card")
+	}
+	if _, err := Load(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing template")
+	}
+}
+
+func TestLayout(t *testing.T) {
+	text := Text{Text: "one two three four five six seven eight nine ten", Size: 40, MaxLines: 2}
+	b, err := layout(text, goregular.TTF, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", b.lines)
+	}
+	if !strings.HasSuffix(b.lines[1], "…") {
+		t.Errorf("expected the last line to end with an ellipsis, got %q", b.lines[1])
+	}
+	for _, line := range b.lines {
+		if w := font.MeasureString(b.face, line).Round(); w > 200 {
+			t.Errorf("line %q is %d pixels wide", line, w)
+		}
+	}
+
+	// Short text keeps its size
+	b, err = layout(Text{Text: "Hi", Size: 40, MaxLines: 1}, goregular.TTF, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.leading != 48 {
+		t.Errorf("expected a leading of 48, got %d", b.leading)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	f, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: 20, DPI: 72})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := wrap(face, "a supercalifragilisticexpialidocious word", 100)
+	for _, line := range lines {
+		if w := font.MeasureString(face, line).Round(); w > 100 {
+			t.Errorf("line %q is %d pixels wide", line, w)
+		}
+	}
+	if got := strings.Join(lines, ""); strings.ReplaceAll(got, " ", "") != "asupercalifragilisticexpialidociousword" {
+		t.Errorf("expected all letters to be kept, got %q", lines)
+	}
+}
+
+func TestGradient(t *testing.T) {
+	img, err := Gradient(100, 10, []string{"#000000", "#FFFFFF"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, r := img.NRGBAAt(0, 5).R, img.NRGBAAt(99, 5).R; l > 5 || r < 250 {
+		t.Errorf("expected black to white from left to right, got %d to %d", l, r)
+	}
+	if _, err := Gradient(10, 10, []string{"#GGGGGG"}, 0); err == nil {
+		t.Error("expected an error for an invalid color")
+	}
+}
@@ -0,0 +1,154 @@
+// Package colorparse parses the colors given to flags and recipe parameters:
+// hex colors, rgb() and rgba(), and the CSS named colors
+package colorparse
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Syntax describes the colors Parse accepts, for help and error messages
+const Syntax = "#RGB, #RGBA, #RRGGBB, #RRGGBBAA, rgb(R,G,B), rgba(R,G,B,A) or a CSS color name"
+
+// Parse parses a color given as:
+//
+//   - 3, 4, 6 or 8 hex digits, as #RGB, #RGBA, #RRGGBB or #RRGGBBAA; the #
+//     is optional
+//   - rgb(R,G,B) or rgba(R,G,B,A), where each channel is 0-255 or a
+//     percentage and the alpha is 0-1 or a percentage. Both take an alpha,
+//     and the channels may be separated by spaces with the alpha after a
+//     slash, as in rgb(255 128 0 / 50%).
+//   - a CSS color name such as rebeccapurple, or transparent
+//
+// Names and hex digits are case-insensitive.
+func Parse(s string) (color.NRGBA, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	if c, ok := names[value]; ok {
+		return c, nil
+	}
+	if args, ok := strings.CutPrefix(value, "rgba("); ok {
+		return parseRGB(s, args)
+	}
+	if args, ok := strings.CutPrefix(value, "rgb("); ok {
+		return parseRGB(s, args)
+	}
+	if c, ok := parseHex(strings.TrimPrefix(value, "#")); ok {
+		return c, nil
+	}
+	return color.NRGBA{}, fmt.Errorf("invalid color: %s (expected %s)", s, Syntax)
+}
+
+// ParseOpaque parses a color like Parse for uses without transparency, such
+// as the padding of JPEG output. Colors that are not fully opaque are
+// rejected.
+func ParseOpaque(s string) (color.NRGBA, error) {
+	c, err := Parse(s)
+	if err != nil {
+		return color.NRGBA{}, err
+	}
+	if c.A != 255 {
+		return color.NRGBA{}, fmt.Errorf("invalid color: %s (expected an opaque color)", s)
+	}
+	return c, nil
+}
+
+// Split splits a list at each sep outside parentheses, so lists separated by
+// commas can hold rgb() colors
+func Split(s string, sep byte) []string {
+	var fields []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth = max(depth-1, 0)
+		case sep:
+			if depth == 0 {
+				fields = append(fields, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(fields, s[start:])
+}
+
+// parseHex parses 3, 4, 6 or 8 hex digits
+func parseHex(hex string) (color.NRGBA, bool) {
+	switch len(hex) {
+	case 3, 4, 6, 8:
+	default:
+		return color.NRGBA{}, false
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, false
+	}
+	switch len(hex) {
+	case 3:
+		return color.NRGBA{uint8(v>>8&0xf) * 0x11, uint8(v>>4&0xf) * 0x11, uint8(v&0xf) * 0x11, 255}, true
+	case 4:
+		return color.NRGBA{uint8(v>>12&0xf) * 0x11, uint8(v>>8&0xf) * 0x11, uint8(v>>4&0xf) * 0x11, uint8(v&0xf) * 0x11}, true
+	case 6:
+		return color.NRGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, true
+	}
+	return color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, true
+}
+
+// parseRGB parses the arguments of rgb() or rgba(), after the opening
+// parenthesis, of the color s
+func parseRGB(s, args string) (color.NRGBA, error) {
+	invalid := fmt.Errorf("invalid color: %s (expected rgb(R,G,B) or rgba(R,G,B,A) with channels of 0-255 or 0%%-100%% and an alpha of 0-1 or 0%%-100%%)", s)
+	args, ok := strings.CutSuffix(args, ")")
+	if !ok {
+		return color.NRGBA{}, invalid
+	}
+
+	// Channels are separated by commas, or by spaces with the alpha after
+	// a slash
+	var fields []string
+	if strings.Contains(args, ",") {
+		fields = strings.Split(args, ",")
+	} else {
+		channels, alpha, slash := strings.Cut(args, "/")
+		fields = strings.Fields(channels)
+		if len(fields) != 3 {
+			return color.NRGBA{}, invalid
+		}
+		if slash {
+			fields = append(fields, alpha)
+		}
+	}
+	if len(fields) != 3 && len(fields) != 4 {
+		return color.NRGBA{}, invalid
+	}
+
+	c := color.NRGBA{A: 255}
+	for i, channel := range []*uint8{&c.R, &c.G, &c.B, &c.A} {
+		if i == len(fields) {
+			break
+		}
+		field := strings.TrimSpace(fields[i])
+		scale := 255.0
+		if i == 3 {
+			// The alpha is a fraction
+			scale = 1
+		}
+		if percent, ok := strings.CutSuffix(field, "%"); ok {
+			field, scale = percent, 100
+		}
+		// Only plain decimal numbers, without signs or exponents
+		if field == "" || strings.Trim(field, "0123456789.") != "" {
+			return color.NRGBA{}, invalid
+		}
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil || v > scale {
+			return color.NRGBA{}, invalid
+		}
+		*channel = uint8(math.Round(v / scale * 255))
+	}
+	return c, nil
+}
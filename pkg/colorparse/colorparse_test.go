@@ -0,0 +1,130 @@
+package colorparse
+
+import (
+	"image/color"
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for value, want := range map[string]color.NRGBA{
+		// Hex, with or without #, in either case
+		"#FF8000":   {255, 128, 0, 255},
+		"ff8000":    {255, 128, 0, 255},
+		"#fff":      {255, 255, 255, 255},
+		"#F80":      {255, 136, 0, 255},
+		"#f808":     {255, 136, 0, 136},
+		"#FF800080": {255, 128, 0, 128},
+		"00000000":  {0, 0, 0, 0},
+		" #abc ":    {170, 187, 204, 255},
+
+		// rgb() and rgba()
+		"rgb(255, 128, 0)":          {255, 128, 0, 255},
+		"rgb(255,128,0)":            {255, 128, 0, 255},
+		"RGB(255, 128, 0)":          {255, 128, 0, 255},
+		"rgba(255, 128, 0, 0.5)":    {255, 128, 0, 128},
+		"rgba(255, 128, 0, 50%)":    {255, 128, 0, 128},
+		"rgb(255, 128, 0, 0)":       {255, 128, 0, 0},
+		"rgba(0, 0, 0)":             {0, 0, 0, 255},
+		"rgb(100%, 50%, 0%)":        {255, 128, 0, 255},
+		"rgb(127.5, 0, 0)":          {128, 0, 0, 255},
+		"rgb(255 128 0)":            {255, 128, 0, 255},
+		"rgb(255 128 0 / 25%)":      {255, 128, 0, 64},
+		"rgba( 255  128 0 / .75 )":  {255, 128, 0, 191},
+		"rgba(255, 128, 0, 1)":      {255, 128, 0, 255},
+		"rgb(0%, 100%, 0%, 100%)":   {0, 255, 0, 255},
+		"rgba(10, 20, 30, 0.00001)": {10, 20, 30, 0},
+
+		// Names
+		"red":           {255, 0, 0, 255},
+		"RebeccaPurple": {102, 51, 153, 255},
+		"grey":          {128, 128, 128, 255},
+		"gray":          {128, 128, 128, 255},
+		"transparent":   {0, 0, 0, 0},
+		"white":         {255, 255, 255, 255},
+	} {
+		c, err := Parse(value)
+		if err != nil || c != want {
+			t.Errorf("%q: expected %v, got %v (%v)", value, want, c, err)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, value := range []string{
+		"", "#", "#ff", "#fffff", "#fffffff", "#fffffffff", "#GGG", "#12345G", "0x123456", "##fff", "+fff",
+		"rgb()", "rgb(1, 2)", "rgb(1, 2, 3, 4, 5)", "rgb(1, 2, 3", "rgb 1, 2, 3", "rgb(256, 0, 0)", "rgb(-1, 0, 0)",
+		"rgb(101%, 0, 0)", "rgba(0, 0, 0, 1.5)", "rgba(0, 0, 0, 101%)", "rgb(1e2, 0, 0)", "rgb(+1, 0, 0)",
+		"rgb(a, b, c)", "rgb(1,, 3)", "rgb(1 2 / 3)", "rgb(1 2 3 4)", "rgb(1 2 3 /)", "rgb(1, 2, 3 / 0.5)",
+		"rgb(NaN, 0, 0)", "rgb(Inf, 0, 0)", "rgb(1..2, 0, 0)", "rgb(%, 0, 0)",
+		"notacolor", "redd", "dark red",
+	} {
+		if c, err := Parse(value); err == nil {
+			t.Errorf("%q: expected an error, got %v", value, c)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	// The 148 CSS named colors and transparent
+	if len(names) != 149 {
+		t.Errorf("Expected 149 names, got %d", len(names))
+	}
+	for name, want := range names {
+		c, err := Parse(name)
+		if err != nil || c != want {
+			t.Errorf("%s: expected %v, got %v (%v)", name, want, c, err)
+		}
+		if name != "transparent" && want.A != 255 {
+			t.Errorf("%s: expected an opaque color", name)
+		}
+		// No name is also a hex color
+		if _, ok := parseHex(name); ok {
+			t.Errorf("%s: the name is also a hex color", name)
+		}
+	}
+	for name, want := range map[string]color.NRGBA{
+		"aliceblue":   {240, 248, 255, 255},
+		"cyan":        {0, 255, 255, 255},
+		"darkgreen":   {0, 100, 0, 255},
+		"lightyellow": {255, 255, 224, 255},
+		"yellowgreen": {154, 205, 50, 255},
+	} {
+		if names[name] != want {
+			t.Errorf("%s: expected %v, got %v", name, want, names[name])
+		}
+	}
+}
+
+func TestParseOpaque(t *testing.T) {
+	for _, value := range []string{"#fff", "navy", "rgb(1, 2, 3)", "rgba(1, 2, 3, 1)", "#000000ff"} {
+		if _, err := ParseOpaque(value); err != nil {
+			t.Errorf("%q: %v", value, err)
+		}
+	}
+	for _, value := range []string{"transparent", "#0008", "rgba(1, 2, 3, 0.5)", "#000000fe", "bogus"} {
+		if _, err := ParseOpaque(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	for value, want := range map[string][]string{
+		"":                          {""},
+		"#fff":                      {"#fff"},
+		"#fff,red":                  {"#fff", "red"},
+		"12,10,rgba(0, 0, 0, 0.5)":  {"12", "10", "rgba(0, 0, 0, 0.5)"},
+		"rgb(1,2,3),rgb(4,5,6),":    {"rgb(1,2,3)", "rgb(4,5,6)", ""},
+		"a)b,c":                     {"a)b", "c"},
+		"rgb(1,2,3":                 {"rgb(1,2,3"},
+		"size=10x10:pad=rgb(1,2,3)": {"size=10x10:pad=rgb(1,2,3)"},
+	} {
+		if got := Split(value, ','); !slices.Equal(got, want) {
+			t.Errorf("%q: expected %q, got %q", value, want, got)
+		}
+	}
+	if got := Split("10:rgb(1:2:3):x", ':'); !slices.Equal(got, []string{"10", "rgb(1:2:3)", "x"}) {
+		t.Errorf("Expected the colon inside parentheses to be kept, got %q", got)
+	}
+}
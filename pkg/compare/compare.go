@@ -0,0 +1,209 @@
+package compare
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// Result holds the difference metrics of two images of the same size
+type Result struct {
+	PSNR          float64 // Peak signal-to-noise ratio over the RGBA channels in dB; +Inf for identical images
+	SSIM          float64 // Mean structural similarity of the luma, from -1 to 1 for identical images
+	MeanDiff      float64 // Mean absolute difference per RGBA channel, from 0 to 255
+	ChangedPixels int     // Number of pixels that differ in any channel
+	Pixels        int     // Number of pixels compared
+}
+
+// SSIM constants for 8-bit values, from Wang et al., "Image Quality
+// Assessment: From Error Visibility to Structural Similarity"
+const (
+	ssimC1     = (0.01 * 255) * (0.01 * 255)
+	ssimC2     = (0.03 * 255) * (0.03 * 255)
+	ssimSigma  = 1.5
+	ssimRadius = 5
+)
+
+// Compare computes the difference metrics of two images, which must have the
+// same size
+func Compare(a, b image.Image) (Result, error) {
+	na, nb, err := prepare(a, b)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var sumSquares, sumAbs float64
+	changed := 0
+	for i := 0; i < len(na.Pix); i += 4 {
+		pixelChanged := false
+		for c := 0; c < 4; c++ {
+			d := float64(na.Pix[i+c]) - float64(nb.Pix[i+c])
+			sumSquares += d * d
+			sumAbs += math.Abs(d)
+			pixelChanged = pixelChanged || d != 0
+		}
+		if pixelChanged {
+			changed++
+		}
+	}
+
+	samples := float64(len(na.Pix))
+	result := Result{
+		PSNR:          math.Inf(1),
+		SSIM:          ssim(na, nb),
+		MeanDiff:      sumAbs / samples,
+		ChangedPixels: changed,
+		Pixels:        len(na.Pix) / 4,
+	}
+	if mse := sumSquares / samples; mse > 0 {
+		result.PSNR = 10 * math.Log10(255*255/mse)
+	}
+	return result, nil
+}
+
+// SSIM computes the mean structural similarity of the luma of two images,
+// which must have the same size. Identical images score 1.
+func SSIM(a, b image.Image) (float64, error) {
+	na, nb, err := prepare(a, b)
+	if err != nil {
+		return 0, err
+	}
+	return ssim(na, nb), nil
+}
+
+// prepare converts two images to NRGBA after checking their sizes match
+func prepare(a, b image.Image) (*image.NRGBA, *image.NRGBA, error) {
+	if a.Bounds().Dx() != b.Bounds().Dx() || a.Bounds().Dy() != b.Bounds().Dy() {
+		return nil, nil, fmt.Errorf("image sizes differ: %dx%d and %dx%d",
+			a.Bounds().Dx(), a.Bounds().Dy(), b.Bounds().Dx(), b.Bounds().Dy())
+	}
+	if a.Bounds().Empty() {
+		return nil, nil, fmt.Errorf("images are empty")
+	}
+	return imaging.Clone(a), imaging.Clone(b), nil
+}
+
+// ssim computes SSIM over a gaussian window. Transparent pixels are
+// composited over black, so a change in alpha alone still counts.
+func ssim(a, b *image.NRGBA) float64 {
+	w, h := a.Bounds().Dx(), a.Bounds().Dy()
+	x, y := luma(a), luma(b)
+
+	xx := make([]float64, len(x))
+	yy := make([]float64, len(x))
+	xy := make([]float64, len(x))
+	for i := range x {
+		xx[i] = x[i] * x[i]
+		yy[i] = y[i] * y[i]
+		xy[i] = x[i] * y[i]
+	}
+
+	kernel := gaussianKernel(ssimSigma, ssimRadius)
+	muX, muY := blur(x, w, h, kernel), blur(y, w, h, kernel)
+	sigmaXX, sigmaYY, sigmaXY := blur(xx, w, h, kernel), blur(yy, w, h, kernel), blur(xy, w, h, kernel)
+
+	var sum float64
+	for i := range x {
+		mx, my := muX[i], muY[i]
+		vx := sigmaXX[i] - mx*mx
+		vy := sigmaYY[i] - my*my
+		cov := sigmaXY[i] - mx*my
+		sum += ((2*mx*my + ssimC1) * (2*cov + ssimC2)) / ((mx*mx + my*my + ssimC1) * (vx + vy + ssimC2))
+	}
+	return sum / float64(len(x))
+}
+
+// luma returns the Rec. 601 luma of every pixel, premultiplied by alpha
+func luma(img *image.NRGBA) []float64 {
+	values := make([]float64, len(img.Pix)/4)
+	for i := range values {
+		p := img.Pix[i*4 : i*4+4]
+		values[i] = (0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])) * float64(p[3]) / 255
+	}
+	return values
+}
+
+// gaussianKernel returns a normalized 1D gaussian kernel of 2*radius+1 taps
+func gaussianKernel(sigma float64, radius int) []float64 {
+	kernel := make([]float64, 2*radius+1)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// blur convolves a w×h plane with a separable kernel, renormalizing the
+// weights at the edges
+func blur(plane []float64, w, h int, kernel []float64) []float64 {
+	radius := len(kernel) / 2
+	convolve := func(src, dst []float64, length, stride, count, step int) {
+		for line := 0; line < count; line++ {
+			base := line * step
+			for i := 0; i < length; i++ {
+				var sum, weight float64
+				for k := -radius; k <= radius; k++ {
+					j := i + k
+					if j < 0 || j >= length {
+						continue
+					}
+					sum += src[base+j*stride] * kernel[k+radius]
+					weight += kernel[k+radius]
+				}
+				dst[base+i*stride] = sum / weight
+			}
+		}
+	}
+
+	tmp := make([]float64, len(plane))
+	out := make([]float64, len(plane))
+	convolve(plane, tmp, w, 1, h, w) // Rows
+	convolve(tmp, out, h, w, w, 1)   // Columns
+	return out
+}
+
+// Diff returns an image that highlights where two images of the same size
+// differ: unchanged pixels are shown as a faded grayscale of a, and changed
+// pixels in red, brighter the larger the difference
+func Diff(a, b image.Image) (*image.NRGBA, error) {
+	na, nb, err := prepare(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, na.Bounds().Dx(), na.Bounds().Dy()))
+	for i := 0; i < len(na.Pix); i += 4 {
+		var d uint8
+		for c := 0; c < 4; c++ {
+			d = max(d, absDiff(na.Pix[i+c], nb.Pix[i+c]))
+		}
+
+		var px color.NRGBA
+		if d == 0 {
+			l := (0.299*float64(na.Pix[i]) + 0.587*float64(na.Pix[i+1]) + 0.114*float64(na.Pix[i+2])) * float64(na.Pix[i+3]) / 255
+			faded := uint8(191 + l/4)
+			px = color.NRGBA{faded, faded, faded, 255}
+		} else {
+			// Even the smallest difference stays clearly visible
+			px = color.NRGBA{uint8(128 + int(d)/2), 0, 0, 255}
+		}
+		out.Pix[i], out.Pix[i+1], out.Pix[i+2], out.Pix[i+3] = px.R, px.G, px.B, px.A
+	}
+	return out, nil
+}
+
+// absDiff returns the absolute difference of two channel values
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,100 @@
+package compare
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// gradient returns a horizontal gray gradient
+func gradient(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(x * 255 / (width - 1))
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func TestCompareIdentical(t *testing.T) {
+	img := gradient(32, 16)
+	result, err := Compare(img, imaging.Clone(img))
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+	if !math.IsInf(result.PSNR, 1) || math.Abs(result.SSIM-1) > 1e-9 || result.MeanDiff != 0 || result.ChangedPixels != 0 {
+		t.Errorf("Expected identical images, got %+v", result)
+	}
+	if result.Pixels != 32*16 {
+		t.Errorf("Expected %d pixels, got %d", 32*16, result.Pixels)
+	}
+}
+
+func TestCompareDifferent(t *testing.T) {
+	a := gradient(32, 16)
+
+	// A uniform offset of 10 in RGB gives an MSE of 75 over the four channels
+	b := imaging.AdjustFunc(a, func(c color.NRGBA) color.NRGBA {
+		return color.NRGBA{min(c.R, 245) + 10, min(c.G, 245) + 10, min(c.B, 245) + 10, c.A}
+	})
+	result, err := Compare(a, b)
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+	if result.PSNR < 25 || result.PSNR > 35 || result.SSIM > 1 || result.SSIM < 0.9 || result.MeanDiff == 0 {
+		t.Errorf("Expected a small difference, got %+v", result)
+	}
+
+	// Noise hurts structural similarity far more than a brightness shift
+	noisy := imaging.Clone(a)
+	for i := 0; i < len(noisy.Pix); i += 4 {
+		if (i/4)%2 == 0 {
+			noisy.Pix[i], noisy.Pix[i+1], noisy.Pix[i+2] = 255-noisy.Pix[i], 255-noisy.Pix[i+1], 255-noisy.Pix[i+2]
+		}
+	}
+	noise, err := Compare(a, noisy)
+	if err != nil {
+		t.Fatalf("Compare failed: %v", err)
+	}
+	if noise.SSIM >= result.SSIM || noise.ChangedPixels == 0 {
+		t.Errorf("Expected noise to lower SSIM below %f, got %+v", result.SSIM, noise)
+	}
+
+	if _, err := Compare(a, gradient(16, 16)); err == nil {
+		t.Errorf("Expected an error for images of different sizes")
+	}
+}
+
+func TestSSIMAlpha(t *testing.T) {
+	opaque := imaging.New(16, 16, color.NRGBA{200, 200, 200, 255})
+	transparent := imaging.New(16, 16, color.NRGBA{200, 200, 200, 0})
+	ssim, err := SSIM(opaque, transparent)
+	if err != nil {
+		t.Fatalf("SSIM failed: %v", err)
+	}
+	if ssim > 0.5 {
+		t.Errorf("Expected a change in alpha to lower SSIM, got %f", ssim)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := imaging.New(4, 4, color.NRGBA{255, 255, 255, 255})
+	b := imaging.Clone(a)
+	b.SetNRGBA(1, 2, color.NRGBA{0, 0, 0, 255})
+
+	diff, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	if c := diff.NRGBAAt(1, 2); c.R != 255 || c.G != 0 {
+		t.Errorf("Expected the changed pixel in red, got %v", c)
+	}
+	if c := diff.NRGBAAt(0, 0); c.R != c.G || c.R < 191 {
+		t.Errorf("Expected an unchanged pixel in faded gray, got %v", c)
+	}
+}
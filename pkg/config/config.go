@@ -0,0 +1,334 @@
+// Package config loads default flag values from YAML configuration files.
+// The files are read with yaml.v3, not viper: flags are not bound to
+// environment variables, and the only layers are the user file, the project
+// file and the command line.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of project-local configuration files
+const FileName = ".nim.yaml"
+
+// Config holds default flag values loaded from configuration files. Keys are
+// long flag names, such as quality or format.
+type Config struct {
+	Flags    map[string]string            // Defaults of the main command's flags
+	Commands map[string]map[string]string // Defaults of subcommand flags, by command name
+	Presets  map[string]map[string]string // User-defined presets, by name
+	Rules    []Rule                       // Flag values for batch inputs that match, in order
+}
+
+// PresetsKey is the top-level key user-defined presets are stored under
+const PresetsKey = "presets"
+
+// newConfig returns an empty Config
+func newConfig() Config {
+	return Config{Flags: map[string]string{}, Commands: map[string]map[string]string{}, Presets: map[string]map[string]string{}}
+}
+
+// UserPath returns the path of the user configuration file,
+// $XDG_CONFIG_HOME/nim/config.yaml or ~/.config/nim/config.yaml
+func UserPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find home directory: %w", err)
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "nim", "config.yaml"), nil
+}
+
+// ProjectPath returns the nearest .nim.yaml in dir or one of its parents, or
+// an empty string if there is none
+func ProjectPath(dir string) string {
+	for {
+		path := filepath.Join(dir, FileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// DefaultPaths returns the configuration files that exist in the order they
+// are applied: the user configuration, then the project configuration of the
+// working directory
+func DefaultPaths() []string {
+	var paths []string
+	if user, err := UserPath(); err == nil {
+		if _, err := os.Stat(user); err == nil {
+			paths = append(paths, user)
+		}
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if project := ProjectPath(wd); project != "" {
+			paths = append(paths, project)
+		}
+	}
+	return paths
+}
+
+// Load reads configuration files in order, with values of later files
+// overriding those of earlier ones
+func Load(paths ...string) (Config, error) {
+	config := newConfig()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to read configuration: %w", err)
+		}
+		file, err := Parse(data)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid configuration %s: %w", path, err)
+		}
+		config.merge(file)
+	}
+	return config, nil
+}
+
+// SidecarSuffix is added to the name of an image to name its sidecar file,
+// such as photo.jpg.nim.yaml
+const SidecarSuffix = ".nim.yaml"
+
+// SidecarPath returns the path of the sidecar file of the image at path
+func SidecarPath(path string) string {
+	return path + SidecarSuffix
+}
+
+// LoadSidecar reads the sidecar file of the image at path: flag values of
+// the main command that apply to this image only, such as a curated crop. It
+// returns nil if the image has no sidecar.
+func LoadSidecar(path string) (map[string]string, error) {
+	sidecar := SidecarPath(path)
+	data, err := os.ReadFile(sidecar)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sidecar: %w", err)
+	}
+	config, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sidecar %s: %w", sidecar, err)
+	}
+	if len(config.Commands) > 0 || len(config.Presets) > 0 || len(config.Rules) > 0 {
+		return nil, fmt.Errorf("invalid sidecar %s: only flag values of the main command are allowed", sidecar)
+	}
+	return config.Flags, nil
+}
+
+// Parse parses a YAML configuration. Top-level keys are defaults of the main
+// command, mappings hold the defaults of the subcommand they are named after,
+// the presets mapping holds named presets, and the rules list holds flag
+// values for batch inputs that match a pattern:
+//
+//	quality: 90
+//	format: webp
+//	pdf:
+//	  page-size: a4
+//	presets:
+//	  hero:
+//	    size: 1600x900
+//	    mode: fill
+//	rules:
+//	  - match: "**/photos/**"
+//	    set:
+//	      format: avif
+//	      quality: 60
+func Parse(data []byte) (Config, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return Config{}, err
+	}
+
+	config := newConfig()
+	for key, value := range doc {
+		if key == RulesKey {
+			rules, err := parseRules(value)
+			if err != nil {
+				return Config{}, err
+			}
+			config.Rules = rules
+			continue
+		}
+		if key == PresetsKey {
+			presets, ok := value.(map[string]any)
+			if !ok {
+				return Config{}, fmt.Errorf("%s: expected a mapping of preset names", key)
+			}
+			for name, preset := range presets {
+				section, ok := preset.(map[string]any)
+				if !ok {
+					return Config{}, fmt.Errorf("%s.%s: expected a mapping of flag values", key, name)
+				}
+				values, err := sectionValues(key+"."+name, section)
+				if err != nil {
+					return Config{}, err
+				}
+				config.Presets[name] = values
+			}
+			continue
+		}
+
+		if section, ok := value.(map[string]any); ok {
+			values, err := sectionValues(key, section)
+			if err != nil {
+				return Config{}, err
+			}
+			config.Commands[key] = values
+			continue
+		}
+
+		s, err := flagValue(value)
+		if err != nil {
+			return Config{}, fmt.Errorf("%s: %w", key, err)
+		}
+		config.Flags[key] = s
+	}
+	return config, nil
+}
+
+// sectionValues formats the flag values of a mapping
+func sectionValues(key string, section map[string]any) (map[string]string, error) {
+	values := map[string]string{}
+	for name, v := range section {
+		s, err := flagValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", key, name, err)
+		}
+		values[name] = s
+	}
+	return values, nil
+}
+
+// merge copies the values of other into c, replacing existing values. Presets
+// are replaced as a whole, and rules are added after the existing ones.
+func (c *Config) merge(other Config) {
+	c.Rules = append(c.Rules, other.Rules...)
+	for name, values := range other.Presets {
+		c.Presets[name] = values
+	}
+	for key, value := range other.Flags {
+		c.Flags[key] = value
+	}
+	for command, values := range other.Commands {
+		if c.Commands[command] == nil {
+			c.Commands[command] = map[string]string{}
+		}
+		for key, value := range values {
+			c.Commands[command][key] = value
+		}
+	}
+}
+
+// SavePreset adds a preset to the configuration file at path, replacing any
+// preset of the same name. The file is created if needed, and the rest of it,
+// including comments, is kept.
+func SavePreset(path, name string, values map[string]string) error {
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read configuration: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("invalid configuration %s: %w", path, err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("invalid configuration %s: expected a mapping", path)
+	}
+
+	presets := mappingValue(root, PresetsKey)
+	if presets == nil {
+		presets = &yaml.Node{Kind: yaml.MappingNode}
+		setMappingValue(root, PresetsKey, presets)
+	}
+	if presets.Kind != yaml.MappingNode {
+		return fmt.Errorf("invalid configuration %s: %s must be a mapping", path, PresetsKey)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	preset := &yaml.Node{Kind: yaml.MappingNode}
+	for _, key := range keys {
+		setMappingValue(preset, key, &yaml.Node{Kind: yaml.ScalarNode, Value: values[key]})
+	}
+	setMappingValue(presets, name, preset)
+
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create configuration folder: %w", err)
+	}
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		return fmt.Errorf("failed to write configuration: %w", err)
+	}
+	return nil
+}
+
+// mappingValue returns the value of key in a YAML mapping, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets the value of key in a YAML mapping, appending the key
+// if it is missing
+func setMappingValue(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+}
+
+// flagValue formats a YAML value the way it would be given on the command
+// line; lists become comma-separated values
+func flagValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", errors.New("missing value")
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := flagValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	case map[string]any:
+		return "", errors.New("unexpected mapping")
+	}
+	return fmt.Sprint(value), nil
+}
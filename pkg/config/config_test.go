@@ -0,0 +1,196 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	config, err := Parse([]byte(`
+quality: 90
+format: webp
+overwrite: true
+ico-sizes: [16, 32, 48]
+pdf:
+  page-size: a4
+  margin: 10mm
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	expected := map[string]string{"quality": "90", "format": "webp", "overwrite": "true", "ico-sizes": "16,32,48"}
+	for key, value := range expected {
+		if config.Flags[key] != value {
+			t.Errorf("Expected %s=%s, got %q", key, value, config.Flags[key])
+		}
+	}
+	if len(config.Flags) != len(expected) {
+		t.Errorf("Expected %d flags, got %v", len(expected), config.Flags)
+	}
+	if config.Commands["pdf"]["page-size"] != "a4" || config.Commands["pdf"]["margin"] != "10mm" {
+		t.Errorf("Unexpected pdf section: %v", config.Commands["pdf"])
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, doc := range []string{"quality: [", "quality:", "pdf:\n  margin:\n    top: 1"} {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("Expected an error for %q", doc)
+		}
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	dir := t.TempDir()
+	user := filepath.Join(dir, "config.yaml")
+	project := filepath.Join(dir, FileName)
+	os.WriteFile(user, []byte("quality: 80\nmode: fill\npdf:\n  margin: 5mm\n"), 0o644)
+	os.WriteFile(project, []byte("quality: 95\npdf:\n  page-size: letter\n"), 0o644)
+
+	config, err := Load(user, project)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if config.Flags["quality"] != "95" || config.Flags["mode"] != "fill" {
+		t.Errorf("Expected the project file to override the user file, got %v", config.Flags)
+	}
+	if config.Commands["pdf"]["margin"] != "5mm" || config.Commands["pdf"]["page-size"] != "letter" {
+		t.Errorf("Expected sections to be merged, got %v", config.Commands["pdf"])
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
+
+func TestLoadSidecar(t *testing.T) {
+	dir := t.TempDir()
+	photo := filepath.Join(dir, "photo.jpg")
+	os.WriteFile(SidecarPath(photo), []byte("crop: 1200x800+40+60\nrotate: 90\n"), 0o644)
+
+	values, err := LoadSidecar(photo)
+	if err != nil {
+		t.Fatalf("LoadSidecar failed: %v", err)
+	}
+	if values["crop"] != "1200x800+40+60" || values["rotate"] != "90" {
+		t.Errorf("Unexpected sidecar values: %v", values)
+	}
+
+	if values, err := LoadSidecar(filepath.Join(dir, "other.jpg")); err != nil || values != nil {
+		t.Errorf("Expected no values without a sidecar, got %v, %v", values, err)
+	}
+
+	// Sections of subcommands do not belong in a sidecar
+	bad := filepath.Join(dir, "bad.jpg")
+	os.WriteFile(SidecarPath(bad), []byte("pdf:\n  margin: 5mm\n"), 0o644)
+	if _, err := LoadSidecar(bad); err == nil {
+		t.Errorf("Expected an error for a subcommand section")
+	}
+}
+
+func TestProjectPath(t *testing.T) {
+	dir := t.TempDir()
+	nested := filepath.Join(dir, "assets", "icons")
+	os.MkdirAll(nested, 0o755)
+
+	if path := ProjectPath(nested); path != "" && filepath.Dir(path) != "/" {
+		// A .nim.yaml above the temporary directory would be found first
+		t.Skipf("Found an unrelated configuration: %s", path)
+	}
+
+	os.WriteFile(filepath.Join(dir, FileName), []byte("quality: 90\n"), 0o644)
+	if path := ProjectPath(nested); path != filepath.Join(dir, FileName) {
+		t.Errorf("Expected %s, got %s", filepath.Join(dir, FileName), path)
+	}
+}
+
+func TestUserPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/tmp/xdg")
+	path, err := UserPath()
+	if err != nil || path != "/tmp/xdg/nim/config.yaml" {
+		t.Errorf("Expected /tmp/xdg/nim/config.yaml, got %s (%v)", path, err)
+	}
+}
+
+func TestParsePresets(t *testing.T) {
+	config, err := Parse([]byte(`
+presets:
+  hero:
+    size: 1600x900
+    mode: fill
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	hero := config.Presets["hero"]
+	if hero["size"] != "1600x900" || hero["mode"] != "fill" {
+		t.Errorf("Unexpected preset: %v", hero)
+	}
+	if _, ok := config.Commands[PresetsKey]; ok {
+		t.Errorf("Expected presets not to be read as a command section")
+	}
+
+	if _, err := Parse([]byte("presets:\n  hero: 1\n")); err == nil {
+		t.Errorf("Expected an error for a preset that is not a mapping")
+	}
+}
+
+func TestSavePreset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nim", "config.yaml")
+
+	// The file and folder are created when missing
+	if err := SavePreset(path, "hero", map[string]string{"size": "1600x900", "mode": "fill"}); err != nil {
+		t.Fatalf("SavePreset failed: %v", err)
+	}
+
+	os.WriteFile(path, []byte("# Team defaults\nquality: 90\n\npresets:\n  hero:\n    size: 1600x900\n"), 0o644)
+	if err := SavePreset(path, "hero", map[string]string{"size": "1920x1080"}); err != nil {
+		t.Fatalf("SavePreset failed: %v", err)
+	}
+	if err := SavePreset(path, "card", map[string]string{"size": "600x400", "quality": "80"}); err != nil {
+		t.Fatalf("SavePreset failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "# Team defaults") {
+		t.Errorf("Expected comments to be kept:\n%s", data)
+	}
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if config.Flags["quality"] != "90" {
+		t.Errorf("Expected other values to be kept, got %v", config.Flags)
+	}
+	if config.Presets["hero"]["size"] != "1920x1080" || len(config.Presets["hero"]) != 1 {
+		t.Errorf("Expected hero to be replaced, got %v", config.Presets["hero"])
+	}
+	if config.Presets["card"]["quality"] != "80" {
+		t.Errorf("Expected card to be added, got %v", config.Presets["card"])
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	dir := t.TempDir()
+	user := filepath.Join(dir, "config.yaml")
+	project := filepath.Join(dir, FileName)
+	os.WriteFile(user, []byte("rules:\n  - match: '*.png'\n    set: {format: webp}\n"), 0o644)
+	os.WriteFile(project, []byte("rules:\n  - match: 'icons/*'\n    set: {format: png}\n"), 0o644)
+
+	config, err := Load(user, project)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(config.Rules) != 2 || config.Rules[0].Match != "*.png" || config.Rules[1].Match != "icons/*" {
+		t.Errorf("Expected the project rules after the user rules, got %+v", config.Rules)
+	}
+
+	image := filepath.Join(dir, "photo.jpg")
+	os.WriteFile(image+SidecarSuffix, []byte("rules:\n  - match: '*'\n    set: {format: png}\n"), 0o644)
+	if _, err := LoadSidecar(image); err == nil {
+		t.Errorf("Expected an error for rules in a sidecar")
+	}
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// RulesKey is the top-level key per-file rules are stored under
+const RulesKey = "rules"
+
+// Content values a rule can match on
+const (
+	ContentPhoto   = "photo"
+	ContentGraphic = "graphic"
+)
+
+// Rule sets flag values for the inputs of a batch that match it, such as
+// lossless PNG for icons and AVIF for photos:
+//
+//	rules:
+//	  - match: "**/icons/**"
+//	    set:
+//	      format: png
+//	  - match: "*.png"
+//	    transparent: true
+//	    set:
+//	      format: webp
+//
+// A pattern without a slash matches the name of the input, and one with a
+// slash its whole path; ** matches any number of folders. The conditions on
+// the content of the input are only checked when they are set.
+type Rule struct {
+	Match       string            // Glob the input path must match; empty matches every input
+	Transparent *bool             // Whether the input must have transparent pixels
+	Animated    *bool             // Whether the input must have several frames
+	Content     string            // Kind of picture the input must hold: photo or graphic
+	Set         map[string]string // Flag values for matching inputs
+}
+
+// Image is what a rule needs to know about the content of an input. Its
+// functions are only called for rules whose pattern matches.
+type Image struct {
+	Transparent func() (bool, error)
+	Animated    func() (bool, error)
+	Content     func() (string, error)
+}
+
+// Matches reports whether the input at name matches the rule
+func (r Rule) Matches(name string, img Image) (bool, error) {
+	if r.Match != "" && !MatchPath(r.Match, name) {
+		return false, nil
+	}
+	if r.Transparent != nil {
+		transparent, err := img.Transparent()
+		if err != nil || transparent != *r.Transparent {
+			return false, err
+		}
+	}
+	if r.Animated != nil {
+		animated, err := img.Animated()
+		if err != nil || animated != *r.Animated {
+			return false, err
+		}
+	}
+	if r.Content != "" {
+		content, err := img.Content()
+		if err != nil || content != r.Content {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// MatchPath reports whether name matches a glob pattern. A pattern without a
+// slash is matched against the base name; otherwise both are split into
+// path elements, and ** matches any number of them.
+func MatchPath(pattern, name string) bool {
+	name = filepath.ToSlash(filepath.Clean(name))
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchElements(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchElements matches path elements against the elements of a pattern
+func matchElements(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElements(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// parseRules parses the list of rules of a configuration
+func parseRules(value any) ([]Rule, error) {
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a list of rules", RulesKey)
+	}
+	rules := make([]Rule, 0, len(list))
+	for i, item := range list {
+		key := fmt.Sprintf("%s[%d]", RulesKey, i)
+		fields, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected a mapping", key)
+		}
+		var rule Rule
+		for name, v := range fields {
+			var err error
+			switch name {
+			case "match":
+				rule.Match, err = ruleString(v)
+				if err == nil {
+					_, err = path.Match(strings.ReplaceAll(rule.Match, "**", "*"), "")
+				}
+			case "transparent":
+				rule.Transparent, err = ruleBool(v)
+			case "animated":
+				rule.Animated, err = ruleBool(v)
+			case "content":
+				rule.Content, err = ruleString(v)
+				if err == nil && rule.Content != ContentPhoto && rule.Content != ContentGraphic {
+					err = fmt.Errorf("unknown content %q (expected %s or %s)", rule.Content, ContentPhoto, ContentGraphic)
+				}
+			case "set":
+				section, ok := v.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("%s.set: expected a mapping of flag values", key)
+				}
+				rule.Set, err = sectionValues(key+".set", section)
+				if err != nil {
+					return nil, err
+				}
+			default:
+				err = errors.New("unknown key (expected match, transparent, animated, content or set)")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", key, name, err)
+			}
+		}
+		if len(rule.Set) == 0 {
+			return nil, fmt.Errorf("%s: set is required", key)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ruleString returns a string field of a rule
+func ruleString(v any) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", errors.New("expected a string")
+	}
+	return s, nil
+}
+
+// ruleBool returns a boolean field of a rule
+func ruleBool(v any) (*bool, error) {
+	b, ok := v.(bool)
+	if !ok {
+		return nil, errors.New("expected true or false")
+	}
+	return &b, nil
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	config, err := Parse([]byte(`
+quality: 85
+rules:
+  - match: "**/icons/**"
+    set:
+      format: png
+  - match: "*.png"
+    transparent: true
+    animated: false
+    set:
+      format: webp
+      quality: 90
+  - content: photo
+    set:
+      format: avif
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(config.Rules) != 3 || len(config.Flags) != 1 {
+		t.Fatalf("Expected 3 rules and 1 flag, got %v and %v", config.Rules, config.Flags)
+	}
+	rule := config.Rules[1]
+	if rule.Match != "*.png" || !*rule.Transparent || *rule.Animated || rule.Set["quality"] != "90" {
+		t.Errorf("Unexpected rule %+v", rule)
+	}
+	if config.Rules[2].Content != ContentPhoto {
+		t.Errorf("Expected a photo rule, got %+v", config.Rules[2])
+	}
+
+	for _, doc := range []string{
+		"rules: webp",
+		"rules:\n  - match: '*.png'",
+		"rules:\n  - match: '*.png'\n    format: webp",
+		"rules:\n  - content: drawing\n    set: {format: png}",
+		"rules:\n  - transparent: yes please\n    set: {format: png}",
+		"rules:\n  - match: '[a'\n    set: {format: png}",
+	} {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("Expected an error for %q", doc)
+		}
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.png", "assets/icons/logo.png", true},
+		{"*.png", "logo.jpg", false},
+		{"**/icons/**", "assets/icons/logo.png", true},
+		{"**/icons/**", "icons/logo.png", true},
+		{"**/icons/**", "icons/small/logo.png", true},
+		{"**/icons/**", "/srv/site/icons/logo.png", true},
+		{"**/icons/**", "assets/iconset/logo.png", false},
+		{"photos/*.jpg", "photos/a.jpg", true},
+		{"photos/*.jpg", "./photos/a.jpg", true},
+		{"photos/*.jpg", "photos/2024/a.jpg", false},
+		{"photos/**/*.jpg", "photos/2024/06/a.jpg", true},
+		{"photos/**/*.jpg", "photos/a.jpg", true},
+	}
+	for _, tt := range tests {
+		if got := MatchPath(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("MatchPath(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	checked := 0
+	img := Image{
+		Transparent: func() (bool, error) { checked++; return true, nil },
+		Animated:    func() (bool, error) { checked++; return false, nil },
+		Content:     func() (string, error) { checked++; return ContentGraphic, nil },
+	}
+	yes, no := true, false
+
+	rule := Rule{Match: "*.png", Transparent: &yes, Animated: &no}
+	if ok, err := rule.Matches("logo.png", img); !ok || err != nil {
+		t.Errorf("Expected a transparent still PNG to match, got %v, %v", ok, err)
+	}
+	checked = 0
+	if ok, _ := rule.Matches("logo.jpg", img); ok || checked != 0 {
+		t.Errorf("Expected the content not to be checked when the pattern does not match")
+	}
+	if ok, _ := (Rule{Content: ContentPhoto}).Matches("logo.png", img); ok {
+		t.Errorf("Expected a graphic not to match a photo rule")
+	}
+
+	failing := Image{Transparent: func() (bool, error) { return false, errors.New("damaged") }}
+	if _, err := rule.Matches("logo.png", failing); err == nil {
+		t.Errorf("Expected the error of the content check")
+	}
+}
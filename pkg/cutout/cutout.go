@@ -0,0 +1,168 @@
+// Package cutout removes the background of images with a salient object
+// segmentation model in ONNX format, such as U²-Net or its small variant
+// U²-Netp, as used by rembg
+package cutout
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"nim/pkg/config"
+	"nim/pkg/effect"
+	"nim/pkg/onnx"
+	"nim/pkg/resample"
+)
+
+// ModelEnv is the environment variable that overrides DefaultModelPath
+const ModelEnv = "NIM_CUTOUT_MODEL"
+
+// defaultSize is the input size of models that do not declare one
+const defaultSize = 320
+
+// ImageNet statistics the models were trained with
+var (
+	mean = [3]float32{0.485, 0.456, 0.406}
+	std  = [3]float32{0.229, 0.224, 0.225}
+)
+
+// Options configure Cutout
+type Options struct {
+	Feather    float64      // Blur of the mask edge in pixels; 0 keeps it as predicted
+	Background *color.NRGBA // Color to put behind the subject instead of transparency, which may be translucent
+}
+
+// Model is a loaded segmentation model
+type Model struct {
+	model *onnx.Model
+	size  int
+}
+
+// DefaultModelPath returns the model file used when none is given:
+// $NIM_CUTOUT_MODEL, or models/u2net.onnx next to the user configuration
+// file
+func DefaultModelPath() (string, error) {
+	if path := os.Getenv(ModelEnv); path != "" {
+		return path, nil
+	}
+	user, err := config.UserPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(user), "models", "u2net.onnx"), nil
+}
+
+// Load loads the segmentation model at path. It takes one 3-channel image
+// and returns the mask as its first output.
+func Load(path string) (*Model, error) {
+	m, err := onnx.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Inputs) != 1 || len(m.Outputs) == 0 {
+		return nil, fmt.Errorf("model %s has %d inputs and %d outputs, expected one image in and a mask out", path, len(m.Inputs), len(m.Outputs))
+	}
+	size := defaultSize
+	if shape := m.InputShape(m.Inputs[0]); len(shape) == 4 && shape[2] > 0 && shape[2] == shape[3] {
+		size = shape[2]
+	}
+	return &Model{model: m, size: size}, nil
+}
+
+// Mask returns the predicted foreground of img, from 0 for background to 255
+// for the subject, at the size of img
+func (m *Model) Mask(img image.Image) (*image.Gray, error) {
+	start := time.Now()
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, fmt.Errorf("empty image")
+	}
+	scaled := resample.Resize(img, m.size, m.size)
+
+	// Scale by the brightest channel value, then normalize each channel
+	var brightest uint8 = 1
+	for i, v := range scaled.Pix {
+		if i%4 != 3 {
+			brightest = max(brightest, v)
+		}
+	}
+	plane := m.size * m.size
+	input := onnx.NewFloat([]int{1, 3, m.size, m.size}, nil)
+	for i := range plane {
+		for c := range 3 {
+			v := float32(scaled.Pix[i*4+c]) / float32(brightest)
+			input.Float[c*plane+i] = (v - mean[c]) / std[c]
+		}
+	}
+
+	outputs, err := m.model.Run(map[string]*onnx.Tensor{m.model.Inputs[0]: input})
+	if err != nil {
+		return nil, fmt.Errorf("failed to run model: %w", err)
+	}
+	pred := outputs[m.model.Outputs[0]]
+	if pred.Len() < plane || len(pred.Float) == 0 {
+		return nil, fmt.Errorf("model output of shape %v is not a %dx%d mask", pred.Shape, m.size, m.size)
+	}
+
+	// Stretch the prediction to the full range
+	values := pred.Float[:plane]
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	mask := image.NewGray(image.Rect(0, 0, m.size, m.size))
+	if hi > lo {
+		for i, v := range values {
+			mask.Pix[i] = uint8((v-lo)/(hi-lo)*255 + 0.5)
+		}
+	}
+
+	resized := resample.Resize(mask, bounds.Dx(), bounds.Dy())
+	out := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for i := range out.Pix {
+		out.Pix[i] = resized.Pix[i*4]
+	}
+	slog.Info("predicted mask", "size", fmt.Sprintf("%dx%d", m.size, m.size), "duration", time.Since(start))
+	return out, nil
+}
+
+// Cutout returns img with its background removed: transparent, or replaced
+// by options.Background
+func (m *Model) Cutout(img image.Image, options Options) (*image.NRGBA, error) {
+	mask, err := m.Mask(img)
+	if err != nil {
+		return nil, err
+	}
+	return Apply(img, mask, options), nil
+}
+
+// Apply makes the parts of img outside mask, which has the size of img,
+// transparent, feathering the edge of the mask and putting the result on the
+// background of options
+func Apply(img image.Image, mask *image.Gray, options Options) *image.NRGBA {
+	if options.Feather > 0 {
+		blurred := imaging.Blur(mask, options.Feather)
+		feathered := image.NewGray(mask.Rect)
+		for i := range feathered.Pix {
+			feathered.Pix[i] = blurred.Pix[i*4]
+		}
+		mask = feathered
+	}
+
+	out := imaging.Clone(img)
+	for y := range out.Rect.Dy() {
+		for x := range out.Rect.Dx() {
+			i := y*out.Stride + x*4 + 3
+			out.Pix[i] = uint8((uint16(out.Pix[i])*uint16(mask.Pix[y*mask.Stride+x]) + 127) / 255)
+		}
+	}
+	if options.Background != nil {
+		return effect.Underlay(out, *options.Background)
+	}
+	return out
+}
@@ -0,0 +1,56 @@
+package cutout
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// square returns a mask of size x size with a centered square of half its
+// size set
+func square(size int) *image.Gray {
+	mask := image.NewGray(image.Rect(0, 0, size, size))
+	for y := size / 4; y < size*3/4; y++ {
+		for x := size / 4; x < size*3/4; x++ {
+			mask.SetGray(x, y, color.Gray{255})
+		}
+	}
+	return mask
+}
+
+func TestApply(t *testing.T) {
+	img := imaging.New(40, 40, color.NRGBA{200, 100, 50, 255})
+	out := Apply(img, square(40), Options{})
+	if got := out.NRGBAAt(20, 20); got != (color.NRGBA{200, 100, 50, 255}) {
+		t.Errorf("expected the subject to be kept, got %v", got)
+	}
+	if got := out.NRGBAAt(2, 2).A; got != 0 {
+		t.Errorf("expected a transparent background, got alpha %d", got)
+	}
+
+	feathered := Apply(img, square(40), Options{Feather: 3})
+	if got := feathered.NRGBAAt(10, 20).A; got == 0 || got == 255 {
+		t.Errorf("expected a soft edge, got alpha %d", got)
+	}
+
+	white := color.NRGBA{255, 255, 255, 255}
+	flat := Apply(img, square(40), Options{Background: &white})
+	if got := flat.NRGBAAt(2, 2); got != white {
+		t.Errorf("expected the background color, got %v", got)
+	}
+}
+
+func TestDefaultModelPath(t *testing.T) {
+	t.Setenv(ModelEnv, "")
+	t.Setenv("XDG_CONFIG_HOME", "/config")
+	if path, err := DefaultModelPath(); err != nil || path != filepath.Join("/config", "nim", "models", "u2net.onnx") {
+		t.Errorf("unexpected default model path %q, %v", path, err)
+	}
+	t.Setenv(ModelEnv, "/models/u2netp.onnx")
+	if path, _ := DefaultModelPath(); path != "/models/u2netp.onnx" {
+		t.Errorf("expected the model of %s, got %q", ModelEnv, path)
+	}
+}
@@ -0,0 +1,257 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Request is a job sent by a client: nim's command-line arguments and the
+// directory relative paths in them are resolved against
+type Request struct {
+	Args []string `json:"args"`
+	Dir  string   `json:"dir"`
+}
+
+// frame is one message from the daemon to the client: output of the job, or
+// its exit code as the last message
+type frame struct {
+	Stdout []byte `json:"stdout,omitempty"`
+	Stderr []byte `json:"stderr,omitempty"`
+	Exit   *int   `json:"exit,omitempty"`
+}
+
+// ownerUID is the user whose clients the daemon serves: its own
+var ownerUID = os.Getuid()
+
+// Handler runs a request, writing its output to stdout and stderr, and
+// returns its exit code
+type Handler func(req Request, stdout, stderr io.Writer) int
+
+// DefaultSocket returns the socket path used when none is given: in
+// $XDG_RUNTIME_DIR if set, otherwise in a folder of the temporary directory
+// named after the user, which Listen creates only the user can enter
+func DefaultSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "nim-"+strconv.Itoa(os.Getuid())+".sock")
+	}
+	return filepath.Join(os.TempDir(), "nim-"+strconv.Itoa(os.Getuid()), "daemon.sock")
+}
+
+// Listen listens on the unix socket at path, which only the current user may
+// connect to: its folder is created private if missing and must not be
+// writable by other users, the socket is made readable and writable by its
+// owner only, and clients of other users are disconnected. A socket file
+// left behind by a daemon that is no longer running is replaced; a running
+// one is an error.
+func Listen(path string) (net.Listener, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create socket folder: %w", err)
+	}
+	if err := privateDir(dir); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("a daemon is already listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to restrict socket: %w", err)
+	}
+	return ownerListener{l}, nil
+}
+
+// ownerListener accepts only the clients that checkPeer lets through
+type ownerListener struct {
+	net.Listener
+}
+
+func (l ownerListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkPeer(conn); err != nil {
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+// Limits bound the jobs waiting for their turn, so that a burst of large
+// jobs is turned away instead of piling up. Zero values mean no limit.
+type Limits struct {
+	Queue   int           // Jobs that may wait while one runs
+	Timeout time.Duration // Time a job may wait before it is turned away
+
+	// Rejected, if set, is called with ErrQueueFull or ErrQueueTimeout for
+	// each job turned away
+	Rejected func(req Request, err error)
+}
+
+var (
+	// ErrQueueFull is the error of a job sent while the queue is full
+	ErrQueueFull = errors.New("the daemon is busy: too many jobs are waiting")
+	// ErrQueueTimeout is the error of a job that waited too long to run
+	ErrQueueTimeout = errors.New("the daemon is busy: the job waited too long to run")
+)
+
+// BusyExitCode is the exit code of jobs turned away by the limits, the
+// EX_TEMPFAIL of sysexits.h, so that callers know to retry later
+const BusyExitCode = 75
+
+// Serve accepts clients on l and runs their requests with handler until l is
+// closed. Requests are run one at a time, in the order they arrive, since
+// handlers share the state of the process; clients that connect meanwhile
+// wait for their turn.
+func Serve(l net.Listener, handler Handler) error {
+	return ServeWithLimits(l, handler, Limits{})
+}
+
+// ServeWithLimits is Serve with a bounded queue: jobs sent while limits.Queue
+// jobs are waiting, or that wait longer than limits.Timeout, are not run and
+// exit with BusyExitCode.
+func ServeWithLimits(l net.Listener, handler Handler, limits Limits) error {
+	turn := make(chan struct{}, 1)
+	var waiting atomic.Int64
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to accept client: %w", err)
+		}
+		go func() {
+			defer conn.Close()
+			var req Request
+			if err := json.NewDecoder(conn).Decode(&req); err != nil {
+				return
+			}
+			w := &frameWriter{encoder: json.NewEncoder(conn)}
+			if err := wait(turn, &waiting, limits); err != nil {
+				if limits.Rejected != nil {
+					limits.Rejected(req, err)
+				}
+				code := BusyExitCode
+				w.write(frame{Stderr: []byte("Error: " + err.Error() + "\n"), Exit: &code})
+				return
+			}
+			defer func() { <-turn }()
+			code := handler(req, w.stream(false), w.stream(true))
+			w.write(frame{Exit: &code})
+		}()
+	}
+}
+
+// wait waits for the turn of a job, within the limits. The turn is taken
+// when it returns nil.
+func wait(turn chan struct{}, waiting *atomic.Int64, limits Limits) error {
+	select {
+	case turn <- struct{}{}:
+		return nil
+	default:
+	}
+	if n := waiting.Add(1); limits.Queue > 0 && n > int64(limits.Queue) {
+		waiting.Add(-1)
+		return ErrQueueFull
+	}
+	defer waiting.Add(-1)
+	var timeout <-chan time.Time
+	if limits.Timeout > 0 {
+		timer := time.NewTimer(limits.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case turn <- struct{}{}:
+		return nil
+	case <-timeout:
+		return ErrQueueTimeout
+	}
+}
+
+// Run sends req to the daemon listening on the socket at path, which must be
+// in a folder only the current user can write to, copies the output of the
+// job to stdout and stderr as it arrives, and returns the exit code of the job
+func Run(path string, req Request, stdout, stderr io.Writer) (int, error) {
+	// A socket in a folder others can write to may not be the daemon's
+	if err := privateDir(filepath.Dir(path)); err != nil {
+		return 0, err
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to the daemon (is nim daemon running?): %w", err)
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return 0, fmt.Errorf("failed to send job: %w", err)
+	}
+
+	decoder := json.NewDecoder(conn)
+	for {
+		var f frame
+		if err := decoder.Decode(&f); err != nil {
+			return 0, fmt.Errorf("failed to read job output: %w", err)
+		}
+		stdout.Write(f.Stdout)
+		stderr.Write(f.Stderr)
+		if f.Exit != nil {
+			return *f.Exit, nil
+		}
+	}
+}
+
+// frameWriter sends output frames to a client. Write errors are ignored:
+// the job runs to completion even if the client goes away.
+type frameWriter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func (w *frameWriter) write(f frame) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.encoder.Encode(f)
+}
+
+// stream returns a writer that sends to the client's stdout, or its stderr
+func (w *frameWriter) stream(stderr bool) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		// p may be reused by the caller once Write returns
+		data := append([]byte(nil), p...)
+		if stderr {
+			w.write(frame{Stderr: data})
+		} else {
+			w.write(frame{Stdout: data})
+		}
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,203 @@
+package daemon
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// socket returns a socket path short enough for the unix socket limit
+func socket(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "nim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "d.sock")
+}
+
+func TestRun(t *testing.T) {
+	path := socket(t)
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	running := 0
+	var mu sync.Mutex
+	done := make(chan error)
+	go func() {
+		done <- Serve(l, func(req Request, stdout, stderr io.Writer) int {
+			mu.Lock()
+			running++
+			if running > 1 {
+				t.Error("requests ran concurrently")
+			}
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				running--
+				mu.Unlock()
+			}()
+			fmt.Fprintf(stdout, "%s in %s\n", strings.Join(req.Args, " "), req.Dir)
+			fmt.Fprintln(stderr, "warning")
+			return len(req.Args)
+		})
+	}()
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var stdout, stderr bytes.Buffer
+			args := []string{"in.jpg", "out.png", "-s", "10x10"}[:i+1]
+			code, err := Run(path, Request{Args: args, Dir: "/tmp"}, &stdout, &stderr)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if code != i+1 || stdout.String() != strings.Join(args, " ")+" in /tmp\n" || stderr.String() != "warning\n" {
+				t.Errorf("exit %d, stdout %q, stderr %q", code, stdout.String(), stderr.String())
+			}
+		}()
+	}
+	wg.Wait()
+
+	// A second daemon cannot take over the socket
+	if _, err := Listen(path); err == nil {
+		t.Error("expected an error for a socket in use")
+	}
+	l.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+	if _, err := Run(path, Request{}, io.Discard, io.Discard); err == nil {
+		t.Error("expected an error without a daemon")
+	}
+}
+
+func TestServeWithLimits(t *testing.T) {
+	path := socket(t)
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	started, release := make(chan struct{}), make(chan struct{})
+	var rejected []error
+	var mu sync.Mutex
+	limits := Limits{Queue: 1, Timeout: 200 * time.Millisecond, Rejected: func(req Request, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		rejected = append(rejected, err)
+	}}
+	go ServeWithLimits(l, func(req Request, stdout, stderr io.Writer) int {
+		if len(req.Args) > 0 && req.Args[0] == "slow" {
+			started <- struct{}{}
+			<-release
+		}
+		return 0
+	}, limits)
+
+	// A slow job runs, one waits and times out, and a third finds the
+	// queue full
+	run := func(args ...string) (int, string) {
+		var stderr bytes.Buffer
+		code, err := Run(path, Request{Args: args}, io.Discard, &stderr)
+		if err != nil {
+			t.Error(err)
+		}
+		return code, stderr.String()
+	}
+	go run("slow")
+	<-started
+	waited := make(chan int)
+	go func() {
+		code, _ := run("waits")
+		waited <- code
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if code, stderr := run("full"); code != BusyExitCode || !strings.Contains(stderr, ErrQueueFull.Error()) {
+		t.Errorf("expected a full queue, got exit %d, stderr %q", code, stderr)
+	}
+	if code := <-waited; code != BusyExitCode {
+		t.Errorf("expected the waiting job to time out, got exit %d", code)
+	}
+	close(release)
+
+	// Once the slow job is done, jobs run again
+	if code, _ := run("fast"); code != 0 {
+		t.Errorf("expected the job to run, got exit %d", code)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(rejected) != 2 || rejected[0] != ErrQueueFull || rejected[1] != ErrQueueTimeout {
+		t.Errorf("unexpected rejections: %v", rejected)
+	}
+}
+
+func TestListenStale(t *testing.T) {
+	path := socket(t)
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	l.Close()
+}
+
+func TestListenPermissions(t *testing.T) {
+	// A missing folder is created private, and the socket is the owner's
+	path := filepath.Join(filepath.Dir(socket(t)), "run", "d.sock")
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for file, want := range map[string]os.FileMode{filepath.Dir(path): 0o700, path: 0o600} {
+		if info, err := os.Stat(file); err != nil || info.Mode().Perm() != want {
+			t.Errorf("%s: expected mode %v, got %v (%v)", file, want, info.Mode().Perm(), err)
+		}
+	}
+
+	// Folders other users can write to are refused, by the daemon and
+	// clients alike
+	shared := filepath.Join(filepath.Dir(path), "shared")
+	os.Mkdir(shared, 0o777)
+	os.Chmod(shared, 0o777)
+	if _, err := Listen(filepath.Join(shared, "d.sock")); err == nil {
+		t.Error("Expected an error for a socket in a folder writable by others")
+	}
+	if _, err := Run(filepath.Join(shared, "d.sock"), Request{}, io.Discard, io.Discard); err == nil {
+		t.Error("Expected an error for a client of a socket in a folder writable by others")
+	}
+}
+
+func TestListenOtherUser(t *testing.T) {
+	path := socket(t)
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go Serve(l, func(req Request, stdout, stderr io.Writer) int {
+		t.Error("Expected the job of another user not to run")
+		return 0
+	})
+
+	// The daemon stands for another user, so this client is refused
+	owner := ownerUID
+	ownerUID = owner + 1
+	defer func() { ownerUID = owner }()
+	if _, err := Run(path, Request{Args: []string{"in.png", "out.png"}}, io.Discard, io.Discard); err == nil {
+		t.Error("Expected the client of another user to be disconnected")
+	}
+}
@@ -0,0 +1,40 @@
+//go:build linux || darwin
+
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// privateDir checks that only the current user can add or replace files in
+// dir, so no one else can put a socket of their own in place
+func privateDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check socket folder: %w", err)
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || int(stat.Uid) != os.Getuid() || info.Mode().Perm()&0o022 != 0 {
+		return fmt.Errorf("socket folder %s must belong to you and not be writable by others", dir)
+	}
+	return nil
+}
+
+// checkPeer refuses clients run by another user than the daemon's
+func checkPeer(conn net.Conn) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return fmt.Errorf("cannot check the user of the client")
+	}
+	uid, err := peerUID(sc)
+	if err != nil {
+		return fmt.Errorf("failed to check the user of the client: %w", err)
+	}
+	if uid != ownerUID {
+		return fmt.Errorf("client of user %d refused", uid)
+	}
+	return nil
+}
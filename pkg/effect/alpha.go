@@ -0,0 +1,46 @@
+package effect
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/disintegration/imaging"
+)
+
+// ExtractAlpha returns the alpha channel of img as a grayscale mask, white
+// where img is opaque and black where it is transparent. With invert, the
+// mask is the other way round.
+func ExtractAlpha(img image.Image, invert bool) *image.Gray {
+	src := imaging.Clone(img)
+	mask := image.NewGray(src.Rect)
+	for i := range mask.Pix {
+		a := src.Pix[i*4+3]
+		if invert {
+			a = 255 - a
+		}
+		mask.Pix[i] = a
+	}
+	return mask
+}
+
+// ApplyAlpha returns img with its alpha channel replaced by the luminance of
+// mask: opaque where the mask is white, transparent where it is black, or the
+// other way round with invert. A mask of another size is scaled to the size
+// of img first, as matting tools often work at a lower resolution.
+func ApplyAlpha(img, mask image.Image, invert bool) *image.NRGBA {
+	out := imaging.Clone(img)
+	if mask.Bounds().Size() != out.Rect.Size() {
+		mask = imaging.Resize(mask, out.Rect.Dx(), out.Rect.Dy(), imaging.Linear)
+	}
+	bounds := mask.Bounds()
+	for y := range out.Rect.Dy() {
+		for x := range out.Rect.Dx() {
+			a := color.GrayModel.Convert(mask.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y
+			if invert {
+				a = 255 - a
+			}
+			out.Pix[y*out.Stride+x*4+3] = a
+		}
+	}
+	return out
+}
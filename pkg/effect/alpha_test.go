@@ -0,0 +1,48 @@
+package effect
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestExtractAlpha(t *testing.T) {
+	src := imaging.New(2, 1, color.NRGBA{255, 0, 0, 255})
+	src.SetNRGBA(1, 0, color.NRGBA{0, 255, 0, 64})
+	mask := ExtractAlpha(src, false)
+	if mask.GrayAt(0, 0).Y != 255 || mask.GrayAt(1, 0).Y != 64 {
+		t.Errorf("expected the alpha values, got %v", mask.Pix)
+	}
+	if got := ExtractAlpha(src, true).GrayAt(1, 0).Y; got != 191 {
+		t.Errorf("expected the inverted alpha, got %d", got)
+	}
+}
+
+func TestApplyAlpha(t *testing.T) {
+	src := imaging.New(4, 2, color.NRGBA{200, 100, 50, 255})
+	mask := image.NewGray(image.Rect(0, 0, 4, 2))
+	mask.SetGray(1, 0, color.Gray{Y: 128})
+	mask.SetGray(2, 0, color.Gray{Y: 255})
+
+	img := ApplyAlpha(src, mask, false)
+	if got := img.NRGBAAt(0, 0); got != (color.NRGBA{200, 100, 50, 0}) {
+		t.Errorf("expected the color kept and transparent, got %v", got)
+	}
+	if img.NRGBAAt(1, 0).A != 128 || img.NRGBAAt(2, 0).A != 255 {
+		t.Errorf("expected the alpha of the mask, got %v", img.Pix)
+	}
+	if got := ApplyAlpha(src, mask, true).NRGBAAt(0, 0).A; got != 255 {
+		t.Errorf("expected the inverted mask, got %d", got)
+	}
+
+	// A round trip gives the mask back, and a smaller mask is scaled up
+	if back := ExtractAlpha(img, false); back.GrayAt(1, 0) != mask.GrayAt(1, 0) {
+		t.Errorf("expected the mask back, got %v", back.Pix)
+	}
+	small := imaging.New(2, 1, color.NRGBA{255, 255, 255, 255})
+	if got := ApplyAlpha(src, small, false); got.Bounds().Size() != src.Bounds().Size() || got.NRGBAAt(3, 1).A != 255 {
+		t.Errorf("expected the scaled mask, got %v", got.Pix)
+	}
+}
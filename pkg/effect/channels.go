@@ -0,0 +1,65 @@
+package effect
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/disintegration/imaging"
+)
+
+// Channels are the names of the channels of an RGBA image, in order
+var Channels = [4]string{"r", "g", "b", "a"}
+
+// SplitChannels returns the red, green, blue and alpha channels of img as
+// grayscale images. The color channels are not premultiplied by alpha.
+func SplitChannels(img image.Image) [4]*image.Gray {
+	src := imaging.Clone(img)
+	var planes [4]*image.Gray
+	for c := range planes {
+		planes[c] = image.NewGray(src.Rect)
+	}
+	for i := range src.Rect.Dx() * src.Rect.Dy() {
+		for c, plane := range planes {
+			plane.Pix[i] = src.Pix[i*4+c]
+		}
+	}
+	return planes
+}
+
+// MergeChannels combines grayscale planes into the red, green, blue and
+// alpha channels of an image; planes in color are read as their luminance.
+// Missing planes (nil) are black, or opaque for alpha, and the planes given
+// must all have the same size.
+func MergeChannels(planes [4]image.Image) (*image.NRGBA, error) {
+	var size image.Point
+	for c, plane := range planes {
+		if plane == nil {
+			continue
+		}
+		if size == (image.Point{}) {
+			size = plane.Bounds().Size()
+		} else if plane.Bounds().Size() != size {
+			return nil, fmt.Errorf("the %s plane is %dx%d, but the others are %dx%d",
+				Channels[c], plane.Bounds().Dx(), plane.Bounds().Dy(), size.X, size.Y)
+		}
+	}
+	if size == (image.Point{}) {
+		return nil, fmt.Errorf("no planes to merge")
+	}
+
+	out := imaging.New(size.X, size.Y, color.NRGBA{0, 0, 0, 255})
+	for c, plane := range planes {
+		if plane == nil {
+			continue
+		}
+		bounds := plane.Bounds()
+		for y := range size.Y {
+			for x := range size.X {
+				gray := color.GrayModel.Convert(plane.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray)
+				out.Pix[y*out.Stride+x*4+c] = gray.Y
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,48 @@
+package effect
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestSplitChannels(t *testing.T) {
+	src := imaging.New(3, 2, color.NRGBA{10, 20, 30, 40})
+	planes := SplitChannels(src)
+	for c, want := range []uint8{10, 20, 30, 40} {
+		if got := planes[c].GrayAt(2, 1).Y; got != want {
+			t.Errorf("channel %s: expected %d, got %d", Channels[c], want, got)
+		}
+	}
+
+	// Merging the planes gives the image back
+	merged, err := MergeChannels([4]image.Image{planes[0], planes[1], planes[2], planes[3]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := merged.NRGBAAt(1, 1); got != src.NRGBAAt(1, 1) {
+		t.Errorf("expected the image back, got %v", got)
+	}
+}
+
+func TestMergeChannels(t *testing.T) {
+	// Texture packing: roughness, metalness and ambient occlusion in RGB
+	roughness := imaging.New(4, 4, color.NRGBA{200, 200, 200, 255})
+	ao := imaging.New(4, 4, color.NRGBA{90, 90, 90, 255})
+	merged, err := MergeChannels([4]image.Image{roughness, nil, ao, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := merged.NRGBAAt(0, 0); got != (color.NRGBA{200, 0, 90, 255}) {
+		t.Errorf("expected missing planes black and opaque, got %v", got)
+	}
+
+	if _, err := MergeChannels([4]image.Image{roughness, imaging.New(2, 2, color.White)}); err == nil {
+		t.Error("expected an error for planes of different sizes")
+	}
+	if _, err := MergeChannels([4]image.Image{}); err == nil {
+		t.Error("expected an error without planes")
+	}
+}
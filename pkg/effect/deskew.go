@@ -0,0 +1,162 @@
+package effect
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// DeskewMode is what Deskew does with the corners that rotating exposes
+type DeskewMode string
+
+const (
+	// DeskewCrop crops the rotated image to the largest centered rectangle
+	// without exposed corners, scaled back to the size of the input
+	DeskewCrop DeskewMode = "crop"
+	// DeskewPad keeps all of the rotated image, growing the canvas and
+	// filling the corners with a background color
+	DeskewPad DeskewMode = "pad"
+)
+
+// ParseDeskewMode parses the name of a deskew mode
+func ParseDeskewMode(name string) (DeskewMode, error) {
+	switch m := DeskewMode(strings.ToLower(strings.TrimSpace(name))); m {
+	case DeskewCrop, DeskewPad:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid deskew mode: %s (expected crop or pad)", name)
+}
+
+// skewSize is the longest side SkewAngle analyzes; the angle does not depend
+// on the scale, so larger images are reduced to it first
+const skewSize = 800
+
+// skewStep is the precision of SkewAngle in degrees
+const skewStep = 0.1
+
+// SkewAngle detects how many degrees clockwise the lines of img are tilted,
+// from -maxAngle to maxAngle. Edges are found with a Sobel filter, and each
+// candidate angle is scored with a Hough transform: edges of horizontal
+// features such as text lines are projected across the angle, and edges of
+// vertical features such as page borders across the angle turned by 90
+// degrees. At the right angle the projections pile up on few lines, so the
+// angle whose projections have the largest sum of squared counts wins. It
+// returns 0 when img has too few edges to tell.
+func SkewAngle(img image.Image, maxAngle float64) float64 {
+	b := img.Bounds()
+	if max(b.Dx(), b.Dy()) > skewSize {
+		img = imaging.Fit(img, skewSize, skewSize, imaging.Box)
+	}
+	gray := imaging.Grayscale(img)
+	w, h := gray.Rect.Dx(), gray.Rect.Dy()
+	if w < 3 || h < 3 {
+		return 0
+	}
+	at := func(x, y int) float64 {
+		p := gray.Pix[y*gray.Stride+x*4:]
+		// Transparent pixels count as white paper
+		return (float64(p[0])*float64(p[3]) + 255*float64(255-p[3])) / 255
+	}
+
+	// Keep the strongest edges, split by the direction of their gradient
+	type point struct{ x, y float64 }
+	var horizontal, vertical []point
+	magnitudes := make([]float64, 0, (w-2)*(h-2))
+	gradients := make([][2]float64, 0, (w-2)*(h-2))
+	var sum float64
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			m := math.Hypot(gx, gy)
+			magnitudes = append(magnitudes, m)
+			gradients = append(gradients, [2]float64{gx, gy})
+			sum += m
+		}
+	}
+	threshold := max(4*sum/float64(len(magnitudes)), 64)
+	for i, m := range magnitudes {
+		if m < threshold {
+			continue
+		}
+		p := point{float64(1 + i%(w-2)), float64(1 + i/(w-2))}
+		if g := gradients[i]; math.Abs(g[1]) > math.Abs(g[0]) {
+			horizontal = append(horizontal, p)
+		} else {
+			vertical = append(vertical, p)
+		}
+	}
+	if len(horizontal)+len(vertical) < 50 {
+		return 0
+	}
+
+	// Lines are at distances from -(w+h) to w+h from the origin
+	offset := w + h
+	bins := make([]int, 2*offset+1)
+	score := func(points []point, sin, cos float64) float64 {
+		clear(bins)
+		for _, p := range points {
+			bins[offset+int(math.Round(p.x*sin+p.y*cos))]++
+		}
+		var s float64
+		for _, n := range bins {
+			s += float64(n) * float64(n)
+		}
+		return s
+	}
+	best, bestScore := 0.0, -1.0
+	steps := int(math.Round(maxAngle / skewStep))
+	for i := -steps; i <= steps; i++ {
+		angle := float64(i) * skewStep
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		// A horizontal line tilted clockwise by angle is at a constant
+		// distance along (-sin, cos), and a vertical one along (cos, sin)
+		s := score(horizontal, -sin, cos) + score(vertical, cos, sin)
+		// Ties go to the smaller angle
+		if s > bestScore || s == bestScore && math.Abs(angle) < math.Abs(best) {
+			best, bestScore = angle, s
+		}
+	}
+	return best
+}
+
+// Deskew levels img by rotating it by the angle SkewAngle detects, up to
+// maxAngle degrees either way. With DeskewCrop the result has the size of
+// img; with DeskewPad the canvas grows to fit and the corners are filled
+// with background.
+func Deskew(img image.Image, maxAngle float64, mode DeskewMode, background color.NRGBA) *image.NRGBA {
+	return straighten(img, SkewAngle(img, maxAngle), mode, background)
+}
+
+// straighten rotates img counterclockwise by a clockwise tilt in degrees,
+// cropping or padding the result as Deskew does
+func straighten(img image.Image, angle float64, mode DeskewMode, background color.NRGBA) *image.NRGBA {
+	if angle == 0 {
+		return imaging.Clone(img)
+	}
+	if mode == DeskewPad {
+		return imaging.Rotate(img, angle, background)
+	}
+	rotated := imaging.Rotate(img, angle, color.NRGBA{})
+
+	// The largest centered rectangle with the proportions of img that fits
+	// in the rotated image
+	b := img.Bounds()
+	w, h := float64(b.Dx()), float64(b.Dy())
+	sin, cos := math.Sincos(math.Abs(angle) * math.Pi / 180)
+	scale := min(w/(w*cos+h*sin), h/(w*sin+h*cos))
+	cw, ch := int(w*scale), int(h*scale)
+	if cw < 3 || ch < 3 {
+		return imaging.Clone(img)
+	}
+	x := (rotated.Rect.Dx() - cw) / 2
+	y := (rotated.Rect.Dy() - ch) / 2
+	// Trim a pixel more on each side, where the edge is interpolated with the
+	// transparent corners
+	cropped := imaging.Crop(rotated, image.Rect(x+1, y+1, x+cw-1, y+ch-1))
+	return imaging.Resize(cropped, b.Dx(), b.Dy(), imaging.Lanczos)
+}
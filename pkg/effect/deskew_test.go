@@ -0,0 +1,78 @@
+package effect
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// page returns a white page with rows of dashes like lines of text
+func page() *image.NRGBA {
+	img := imaging.New(400, 300, color.NRGBA{255, 255, 255, 255})
+	for y := 40; y < 260; y += 20 {
+		for x := 40; x < 360; x += 12 {
+			for dy := range 6 {
+				for dx := range 8 {
+					img.SetNRGBA(x+dx, y+dy, color.NRGBA{0, 0, 0, 255})
+				}
+			}
+		}
+	}
+	return img
+}
+
+func TestSkewAngle(t *testing.T) {
+	white := color.NRGBA{255, 255, 255, 255}
+	if angle := SkewAngle(page(), 15); angle != 0 {
+		t.Errorf("expected a level page, got %.1f degrees", angle)
+	}
+	for _, tilt := range []float64{3, -5.5} {
+		// imaging.Rotate turns counterclockwise
+		tilted := imaging.Rotate(page(), -tilt, white)
+		if angle := SkewAngle(tilted, 15); math.Abs(angle-tilt) > 0.25 {
+			t.Errorf("expected a tilt of %.1f degrees, got %.1f", tilt, angle)
+		}
+	}
+	if angle := SkewAngle(imaging.New(100, 100, white), 15); angle != 0 {
+		t.Errorf("expected no tilt for a blank image, got %.1f degrees", angle)
+	}
+}
+
+func TestDeskew(t *testing.T) {
+	white := color.NRGBA{255, 255, 255, 255}
+	tilted := imaging.Rotate(page(), -4, white)
+	b := tilted.Bounds()
+
+	cropped := Deskew(tilted, 15, DeskewCrop, white)
+	if cropped.Bounds().Size() != b.Size() {
+		t.Errorf("expected the cropped result at %v, got %v", b.Size(), cropped.Bounds().Size())
+	}
+	if angle := SkewAngle(cropped, 15); math.Abs(angle) > 0.25 {
+		t.Errorf("expected a level result, got %.1f degrees", angle)
+	}
+
+	padded := Deskew(tilted, 15, DeskewPad, color.NRGBA{255, 0, 0, 255})
+	if padded.Bounds().Dx() <= b.Dx() || padded.Bounds().Dy() <= b.Dy() {
+		t.Errorf("expected the padded canvas to grow from %v, got %v", b.Size(), padded.Bounds().Size())
+	}
+	if c := padded.NRGBAAt(0, 0); c != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("expected the corner in the background color, got %v", c)
+	}
+
+	// A tilt beyond the maximum is left alone
+	if angle := SkewAngle(tilted, 2); math.Abs(angle) > 2 {
+		t.Errorf("expected at most 2 degrees, got %.1f", angle)
+	}
+}
+
+func TestParseDeskewMode(t *testing.T) {
+	if mode, err := ParseDeskewMode(" Pad "); err != nil || mode != DeskewPad {
+		t.Errorf("expected pad, got %q, %v", mode, err)
+	}
+	if _, err := ParseDeskewMode("rotate"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
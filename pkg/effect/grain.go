@@ -0,0 +1,116 @@
+package effect
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Noise is the kind of noise grain adds
+type Noise string
+
+const (
+	// NoiseGaussian is independent noise per pixel, like fine film grain
+	NoiseGaussian Noise = "gaussian"
+	// NoisePerlin is smooth gradient noise that forms clumps of a given size,
+	// like coarse film grain
+	NoisePerlin Noise = "perlin"
+)
+
+// ParseNoise parses the name of a kind of noise
+func ParseNoise(name string) (Noise, error) {
+	switch n := Noise(strings.ToLower(strings.TrimSpace(name))); n {
+	case NoiseGaussian, NoisePerlin:
+		return n, nil
+	}
+	return "", fmt.Errorf("invalid noise: %s (expected gaussian or perlin)", name)
+}
+
+// Grain adds monochrome noise to img. Amount is from 0 (none) to 100, where
+// the noise has a standard deviation of 32 levels; small amounts such as 3 to
+// 5 hide the banding of smooth gradients in heavily compressed output. Size
+// is the size of perlin clumps in pixels. The noise only depends on the
+// position of each pixel, so the same image always gets the same grain.
+func Grain(img image.Image, amount float64, noise Noise, size float64) *image.NRGBA {
+	out := imaging.Clone(img)
+	sigma := amount / 100 * 32
+	if sigma <= 0 {
+		return out
+	}
+	size = max(size, 1)
+	for y := range out.Rect.Dy() {
+		row := out.Pix[y*out.Stride : y*out.Stride+out.Rect.Dx()*4]
+		for x := range out.Rect.Dx() {
+			var n float64
+			if noise == NoisePerlin {
+				// Two octaves, scaled to about the same spread as the gaussian
+				fx, fy := float64(x)/size, float64(y)/size
+				n = (perlin(fx, fy) + 0.5*perlin(2*fx+17.3, 2*fy+5.1)) * 2.5
+			} else {
+				n = gaussian(x, y)
+			}
+			offset := n * sigma
+			p := row[x*4 : x*4+3 : x*4+3]
+			for c := range p {
+				p[c] = clamp(float64(p[c]) + offset)
+			}
+		}
+	}
+	return out
+}
+
+// clamp rounds v to the nearest channel value
+func clamp(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v))))
+}
+
+// hash mixes a pixel position and a stream number into 64 random bits
+func hash(x, y, stream int) uint64 {
+	h := uint64(x)*0x9e3779b97f4a7c15 ^ uint64(y)*0xc2b2ae3d27d4eb4f ^ uint64(stream)*0x165667b19e3779f9
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// uniform returns a number in (0, 1) for a pixel position and stream
+func uniform(x, y, stream int) float64 {
+	return (float64(hash(x, y, stream)>>11) + 0.5) / (1 << 53)
+}
+
+// gaussian returns a normally distributed number for a pixel position, with
+// the Box-Muller transform
+func gaussian(x, y int) float64 {
+	u, v := uniform(x, y, 0), uniform(x, y, 1)
+	return math.Sqrt(-2*math.Log(u)) * math.Cos(2*math.Pi*v)
+}
+
+// perlin returns 2D gradient noise at a point, from about -1 to 1
+func perlin(x, y float64) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	ix, iy := int(x0), int(y0)
+
+	// dot returns the dot product of the gradient at a lattice point with the
+	// offset of the point from it
+	dot := func(gx, gy int, dx, dy float64) float64 {
+		angle := 2 * math.Pi * uniform(gx, gy, 2)
+		return math.Cos(angle)*dx + math.Sin(angle)*dy
+	}
+	fade := func(t float64) float64 {
+		return t * t * t * (t*(t*6-15) + 10)
+	}
+	lerp := func(a, b, t float64) float64 {
+		return a + (b-a)*t
+	}
+
+	u, v := fade(fx), fade(fy)
+	top := lerp(dot(ix, iy, fx, fy), dot(ix+1, iy, fx-1, fy), u)
+	bottom := lerp(dot(ix, iy+1, fx, fy-1), dot(ix+1, iy+1, fx-1, fy-1), u)
+	return lerp(top, bottom, v) * math.Sqrt2
+}
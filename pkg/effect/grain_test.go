@@ -0,0 +1,57 @@
+package effect
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// spread returns the mean and standard deviation of the red channel of img,
+// and the mean absolute difference of horizontal neighbors
+func spread(t *testing.T, noise Noise) (mean, std, neighbor float64) {
+	t.Helper()
+	src := imaging.New(128, 128, color.NRGBA{128, 128, 128, 200})
+	img := Grain(src, 10, noise, 4)
+	var sum, squares, diff float64
+	n := float64(len(img.Pix) / 4)
+	for i := 0; i < len(img.Pix); i += 4 {
+		v := float64(img.Pix[i])
+		sum += v
+		squares += v * v
+		if i%img.Stride != 0 {
+			diff += math.Abs(v - float64(img.Pix[i-4]))
+		}
+		if img.Pix[i+1] != img.Pix[i] || img.Pix[i+3] != 200 {
+			t.Fatalf("expected monochrome grain with the alpha kept, got %v", img.Pix[i:i+4])
+		}
+	}
+	mean = sum / n
+	return mean, math.Sqrt(squares/n - mean*mean), diff / n
+}
+
+func TestGrain(t *testing.T) {
+	mean, std, gaussianDiff := spread(t, NoiseGaussian)
+	if math.Abs(mean-128) > 0.5 || math.Abs(std-3.2) > 0.3 {
+		t.Errorf("expected gaussian grain around 128 with a deviation of 3.2, got %.2f and %.2f", mean, std)
+	}
+	mean, std, perlinDiff := spread(t, NoisePerlin)
+	if math.Abs(mean-128) > 1 || std < 1.5 || std > 6 {
+		t.Errorf("expected perlin grain around 128 with a deviation near 3.2, got %.2f and %.2f", mean, std)
+	}
+	if perlinDiff >= gaussianDiff*0.75 {
+		t.Errorf("expected perlin grain to be smoother than gaussian grain, got %.2f and %.2f", perlinDiff, gaussianDiff)
+	}
+
+	src := imaging.New(16, 16, color.NRGBA{40, 80, 120, 255})
+	if a, b := Grain(src, 20, NoiseGaussian, 1), Grain(src, 20, NoiseGaussian, 1); string(a.Pix) != string(b.Pix) {
+		t.Error("expected the same grain every time")
+	}
+	if got := Grain(src, 0, NoisePerlin, 2); string(got.Pix) != string(src.Pix) {
+		t.Error("expected amount 0 to change nothing")
+	}
+	if _, err := ParseNoise("pink"); err == nil {
+		t.Error("expected an error for an unknown noise")
+	}
+}
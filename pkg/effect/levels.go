@@ -0,0 +1,80 @@
+package effect
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"nim/pkg/histogram"
+)
+
+// Levels maps the levels of a channel: Black and White become 0 and 255,
+// stretching the levels between them, and Gamma bends the result, brightening
+// the midtones above 1. White may be above 255 to darken the channel.
+type Levels struct {
+	Black, White, Gamma float64
+}
+
+// Identity leaves a channel unchanged
+var Identity = Levels{Black: 0, White: 255, Gamma: 1}
+
+// lut returns the output level of each input level
+func (l Levels) lut() [256]uint8 {
+	var table [256]uint8
+	for v := range table {
+		t := min(max((float64(v)-l.Black)/(l.White-l.Black), 0), 1)
+		if l.Gamma != 1 {
+			t = math.Pow(t, 1/l.Gamma)
+		}
+		table[v] = uint8(t*255 + 0.5)
+	}
+	return table
+}
+
+// ApplyLevels maps the red, green and blue channels of img through their
+// levels. Alpha is kept.
+func ApplyLevels(img image.Image, red, green, blue Levels) *image.NRGBA {
+	out := imaging.Clone(img)
+	r, g, b := red.lut(), green.lut(), blue.lut()
+	for i := 0; i < len(out.Pix); i += 4 {
+		p := out.Pix[i : i+3 : i+3]
+		p[0], p[1], p[2] = r[p[0]], g[p[1]], b[p[2]]
+	}
+	return out
+}
+
+// AutoContrast stretches the levels of img so that a fraction clip (0-0.5) of
+// the pixels turn black and as many turn white. The channels are stretched
+// alike, so colors keep their hue; a flat image is returned unchanged.
+func AutoContrast(img image.Image, clip float64) *image.NRGBA {
+	h := histogram.Compute(img)
+	black := min(h.Red.Percentile(clip), h.Green.Percentile(clip), h.Blue.Percentile(clip))
+	white := max(h.Red.Percentile(1-clip), h.Green.Percentile(1-clip), h.Blue.Percentile(1-clip))
+	if white <= black {
+		return imaging.Clone(img)
+	}
+	l := Levels{Black: float64(black), White: float64(white), Gamma: 1}
+	return ApplyLevels(img, l, l, l)
+}
+
+// maxWhiteBalanceGain limits how much AutoWhiteBalance scales a channel,
+// so that images of mostly one color are not turned gray
+const maxWhiteBalanceGain = 2
+
+// AutoWhiteBalance removes a color cast from img by scaling each channel so
+// that its mean is the mean of all three (the gray world assumption), by at
+// most a factor of 2 either way
+func AutoWhiteBalance(img image.Image) *image.NRGBA {
+	h := histogram.Compute(img)
+	means := [3]float64{h.Red.Mean(), h.Green.Mean(), h.Blue.Mean()}
+	gray := (means[0] + means[1] + means[2]) / 3
+	var levels [3]Levels
+	for c, mean := range means {
+		levels[c] = Identity
+		if mean > 0 && gray > 0 {
+			gain := min(max(gray/mean, 1/maxWhiteBalanceGain), maxWhiteBalanceGain)
+			levels[c].White = 255 / gain
+		}
+	}
+	return ApplyLevels(img, levels[0], levels[1], levels[2])
+}
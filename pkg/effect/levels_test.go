@@ -0,0 +1,56 @@
+package effect
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestApplyLevels(t *testing.T) {
+	src := imaging.New(2, 1, color.NRGBA{20, 128, 235, 200})
+	stretch := Levels{Black: 20, White: 235, Gamma: 1}
+	got := ApplyLevels(src, stretch, Identity, stretch).NRGBAAt(0, 0)
+	if got != (color.NRGBA{0, 128, 255, 200}) {
+		t.Errorf("expected the red and blue channels stretched, got %v", got)
+	}
+	if got := ApplyLevels(src, Identity, Levels{0, 255, 2}, Identity).NRGBAAt(0, 0); got.G <= 128 {
+		t.Errorf("expected a gamma of 2 to brighten the midtones, got %v", got)
+	}
+}
+
+func TestAutoContrast(t *testing.T) {
+	// A washed-out gradient from 60 to 187
+	src := image.NewNRGBA(image.Rect(0, 0, 128, 1))
+	for x := range 128 {
+		src.SetNRGBA(x, 0, color.NRGBA{uint8(60 + x), uint8(60 + x), uint8(60 + x/2), 255})
+	}
+	img := AutoContrast(src, 0)
+	if first, last := img.NRGBAAt(0, 0), img.NRGBAAt(127, 0); first.R != 0 || last.R != 255 {
+		t.Errorf("expected the full range, got %v to %v", first, last)
+	}
+	if got := img.NRGBAAt(127, 0); got.B >= got.R {
+		t.Errorf("expected the channels stretched alike, got %v", got)
+	}
+
+	flat := imaging.New(4, 4, color.NRGBA{90, 90, 90, 255})
+	if got := AutoContrast(flat, 0.01).NRGBAAt(0, 0); got != flat.NRGBAAt(0, 0) {
+		t.Errorf("expected a flat image unchanged, got %v", got)
+	}
+}
+
+func TestAutoWhiteBalance(t *testing.T) {
+	// A gray card under warm light
+	src := imaging.New(4, 4, color.NRGBA{150, 120, 90, 255})
+	got := AutoWhiteBalance(src).NRGBAAt(0, 0)
+	if got.R != 120 || got.G != 120 || got.B != 120 {
+		t.Errorf("expected a neutral gray, got %v", got)
+	}
+
+	// The gain is limited
+	red := imaging.New(4, 4, color.NRGBA{240, 10, 10, 255})
+	if got := AutoWhiteBalance(red).NRGBAAt(0, 0); got.G > 20 {
+		t.Errorf("expected a limited gain, got %v", got)
+	}
+}
@@ -0,0 +1,78 @@
+package effect
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// Vignette darkens img towards its corners. Strength is how dark the corners
+// get, from 0 (unchanged) to 1 (black). Radius is where the darkening starts,
+// as a fraction of the distance from the center to the corners, from 0 to 1.
+func Vignette(img image.Image, strength, radius float64) *image.NRGBA {
+	out := imaging.Clone(img)
+	w, h := out.Rect.Dx(), out.Rect.Dy()
+	cx, cy := float64(w)/2, float64(h)/2
+	for y := range h {
+		dy := (float64(y) + 0.5 - cy) / cy
+		row := out.Pix[y*out.Stride : y*out.Stride+w*4]
+		for x := range w {
+			dx := (float64(x) + 0.5 - cx) / cx
+			// 1 at the corners of the image
+			d := math.Sqrt((dx*dx + dy*dy) / 2)
+			if d <= radius {
+				continue
+			}
+			t := min((d-radius)/(1-radius), 1)
+			factor := 1 - strength*t*t*(3-2*t)
+			p := row[x*4 : x*4+3 : x*4+3]
+			p[0] = uint8(float64(p[0])*factor + 0.5)
+			p[1] = uint8(float64(p[1])*factor + 0.5)
+			p[2] = uint8(float64(p[2])*factor + 0.5)
+		}
+	}
+	return out
+}
+
+// Shadow draws img over a drop shadow of its shape in color c, shifted by
+// offset and blurred with the sigma blur. The canvas grows to fit the shadow;
+// the new area is transparent.
+func Shadow(img image.Image, offset image.Point, blur float64, c color.NRGBA) *image.NRGBA {
+	src := imaging.Clone(img)
+	size := src.Rect.Size()
+	margin := int(math.Ceil(3 * blur))
+
+	// The image and its shadow with the blur around it, relative to the image
+	shadowRect := image.Rectangle{Max: size}.Add(offset).Inset(-margin)
+	canvas := image.Rectangle{Max: size}.Union(shadowRect)
+	origin := canvas.Min.Mul(-1)
+
+	// The blur is not premultiplied, so the transparent area has the shadow
+	// color too
+	shadow := imaging.New(canvas.Dx(), canvas.Dy(), color.NRGBA{c.R, c.G, c.B, 0})
+	for y := range size.Y {
+		for x := range size.X {
+			a := src.Pix[y*src.Stride+x*4+3]
+			i := shadow.PixOffset(origin.X+offset.X+x, origin.Y+offset.Y+y)
+			shadow.Pix[i+3] = uint8((int(a)*int(c.A) + 127) / 255)
+		}
+	}
+	if blur > 0 {
+		shadow = imaging.Blur(shadow, blur)
+	}
+	return imaging.Overlay(shadow, src, origin, 1)
+}
+
+// Flatten composites img over an opaque background color
+func Flatten(img image.Image, background color.NRGBA) *image.NRGBA {
+	background.A = 255
+	return Underlay(img, background)
+}
+
+// Underlay composites img over a background color, which may be translucent
+func Underlay(img image.Image, background color.NRGBA) *image.NRGBA {
+	bounds := img.Bounds()
+	return imaging.Overlay(imaging.New(bounds.Dx(), bounds.Dy(), background), img, image.Point{}, 1)
+}
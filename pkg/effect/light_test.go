@@ -0,0 +1,67 @@
+package effect
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestVignette(t *testing.T) {
+	src := imaging.New(100, 60, color.NRGBA{200, 200, 200, 255})
+	img := Vignette(src, 0.8, 0.5)
+	if got := img.NRGBAAt(50, 30); got != src.NRGBAAt(50, 30) {
+		t.Errorf("expected the center unchanged, got %v", got)
+	}
+	corner, edge := img.NRGBAAt(0, 0), img.NRGBAAt(99, 30)
+	if corner.R >= edge.R || edge.R >= 200 {
+		t.Errorf("expected the corners darker than the edges, got %v and %v", corner, edge)
+	}
+	if corner.A != 255 {
+		t.Errorf("expected alpha to be kept, got %v", corner)
+	}
+	if got := Vignette(src, 0, 0.5).NRGBAAt(0, 0); got != src.NRGBAAt(0, 0) {
+		t.Errorf("expected strength 0 to change nothing, got %v", got)
+	}
+}
+
+func TestShadow(t *testing.T) {
+	src := imaging.New(40, 30, color.NRGBA{255, 0, 0, 255})
+	img := Shadow(src, image.Pt(10, 5), 0, color.NRGBA{0, 0, 0, 255})
+	if img.Bounds() != image.Rect(0, 0, 50, 35) {
+		t.Fatalf("expected the canvas to grow to 50x35, got %v", img.Bounds())
+	}
+	if got := img.NRGBAAt(0, 0); got != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("expected the image at the top left, got %v", got)
+	}
+	if got := img.NRGBAAt(45, 32); got.A != 255 || got.R != 0 {
+		t.Errorf("expected the shadow at the bottom right, got %v", got)
+	}
+	if got := img.NRGBAAt(45, 2); got.A != 0 {
+		t.Errorf("expected the rest of the canvas transparent, got %v", got)
+	}
+
+	// A blurred shadow grows the canvas on every side, and fades out
+	blurred := Shadow(src, image.Pt(-4, 0), 2, color.NRGBA{0, 0, 0, 128})
+	if blurred.Bounds() != image.Rect(0, 0, 52, 42) {
+		t.Fatalf("expected room for the blur, got %v", blurred.Bounds())
+	}
+	if got := blurred.NRGBAAt(4, 21).A; got == 0 || got >= 128 {
+		t.Errorf("expected a faded shadow at the left edge, got alpha %d", got)
+	}
+
+	flat := Flatten(img, color.NRGBA{0, 255, 0, 255})
+	if got := flat.NRGBAAt(45, 2); got != (color.NRGBA{0, 255, 0, 255}) {
+		t.Errorf("expected the background color, got %v", got)
+	}
+
+	// Underlay keeps the alpha of the background
+	under := Underlay(img, color.NRGBA{0, 255, 0, 64})
+	if got := under.NRGBAAt(45, 2); got != (color.NRGBA{0, 255, 0, 64}) {
+		t.Errorf("expected the translucent background color, got %v", got)
+	}
+	if got := under.NRGBAAt(0, 0); got != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("expected the image over the background, got %v", got)
+	}
+}
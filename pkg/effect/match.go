@@ -0,0 +1,218 @@
+package effect
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"nim/pkg/histogram"
+)
+
+// MatchMethod is how MatchColors moves the colors of an image to those of a
+// reference
+type MatchMethod string
+
+const (
+	// MatchReinhard shifts and scales the lightness and the two color axes of
+	// CIE L*a*b* to the mean and spread of the reference (Reinhard et al.,
+	// 2001), a gentle change that keeps the contrast within the image
+	MatchReinhard MatchMethod = "reinhard"
+	// MatchHistogram maps the red, green and blue levels so that their
+	// histograms follow those of the reference, a closer match that also
+	// takes on its contrast and clipping
+	MatchHistogram MatchMethod = "histogram"
+)
+
+// ParseMatchMethod parses the name of a color matching method
+func ParseMatchMethod(name string) (MatchMethod, error) {
+	switch m := MatchMethod(strings.ToLower(strings.TrimSpace(name))); m {
+	case MatchReinhard, MatchHistogram:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid color matching method: %s (expected reinhard or histogram)", name)
+}
+
+// ColorReference holds what MatchColors needs of a reference image, so a
+// batch of images can be matched to it without measuring it again
+type ColorReference struct {
+	channels  [3]histogram.Channel // Red, green and blue levels
+	mean, std [3]float64           // Of L*, a* and b*
+	empty     bool
+}
+
+// NewColorReference measures the colors of a reference image. Transparent
+// pixels are left out.
+func NewColorReference(img image.Image) *ColorReference {
+	r := &ColorReference{}
+	r.channels = countLevels(img)
+	r.mean, r.std = labStats(img)
+	r.empty = r.channels[0].Total() == 0
+	return r
+}
+
+// MatchColors returns img with its colors moved to those of the reference by
+// the method. Strength (0-1) blends the result with the original colors.
+// Alpha is kept, and transparent pixels do not count.
+func MatchColors(img image.Image, ref *ColorReference, method MatchMethod, strength float64) *image.NRGBA {
+	strength = min(max(strength, 0), 1)
+	if ref.empty || strength == 0 {
+		return imaging.Clone(img)
+	}
+	if method == MatchHistogram {
+		return matchHistograms(img, ref, strength)
+	}
+
+	mean, std := labStats(img)
+	var scale [3]float64
+	for i := range scale {
+		scale[i] = 1
+		if std[i] > 1e-6 {
+			scale[i] = ref.std[i] / std[i]
+		}
+	}
+	return mapColors(img, func(c [3]float64) [3]float64 {
+		lab := toLab(c)
+		for i, v := range lab {
+			matched := (v-mean[i])*scale[i] + ref.mean[i]
+			lab[i] = v + (matched-v)*strength
+		}
+		return fromLab(lab)
+	})
+}
+
+// matchHistograms maps each color channel of img through the levels whose
+// cumulative share of the pixels is the same in the reference
+func matchHistograms(img image.Image, ref *ColorReference, strength float64) *image.NRGBA {
+	channels := countLevels(img)
+	var luts [3][256]uint8
+	for c := range luts {
+		src, dst := cumulative(&channels[c]), cumulative(&ref.channels[c])
+		level := 0
+		for v := range luts[c] {
+			for level < 255 && dst[level] < src[v] {
+				level++
+			}
+			luts[c][v] = uint8(math.Round(float64(v) + float64(level-v)*strength))
+		}
+	}
+	out := imaging.Clone(img)
+	for i := 0; i < len(out.Pix); i += 4 {
+		p := out.Pix[i : i+3 : i+3]
+		p[0], p[1], p[2] = luts[0][p[0]], luts[1][p[1]], luts[2][p[2]]
+	}
+	return out
+}
+
+// countLevels counts the red, green and blue levels of the pixels that are
+// not fully transparent
+func countLevels(img image.Image) [3]histogram.Channel {
+	src := imaging.Clone(img)
+	var channels [3]histogram.Channel
+	for i := 0; i < len(src.Pix); i += 4 {
+		if src.Pix[i+3] == 0 {
+			continue
+		}
+		channels[0][src.Pix[i]]++
+		channels[1][src.Pix[i+1]]++
+		channels[2][src.Pix[i+2]]++
+	}
+	return channels
+}
+
+// cumulative returns the share of the pixels at or below each level
+func cumulative(c *histogram.Channel) [256]float64 {
+	var out [256]float64
+	total := float64(c.Total())
+	if total == 0 {
+		return out
+	}
+	seen := 0
+	for level, n := range c {
+		seen += n
+		out[level] = float64(seen) / total
+	}
+	return out
+}
+
+// labStats returns the mean and standard deviation of the L*, a* and b* of
+// the pixels that are not fully transparent
+func labStats(img image.Image) (mean, std [3]float64) {
+	src := imaging.Clone(img)
+	var sum, squares [3]float64
+	n := 0
+	cache := make(map[[3]uint8][3]float64)
+	for i := 0; i < len(src.Pix); i += 4 {
+		p := src.Pix[i : i+4 : i+4]
+		if p[3] == 0 {
+			continue
+		}
+		key := [3]uint8{p[0], p[1], p[2]}
+		lab, ok := cache[key]
+		if !ok {
+			lab = toLab([3]float64{toLinear[p[0]], toLinear[p[1]], toLinear[p[2]]})
+			if len(cache) < 1<<16 {
+				cache[key] = lab
+			}
+		}
+		for c, v := range lab {
+			sum[c] += v
+			squares[c] += v * v
+		}
+		n++
+	}
+	if n == 0 {
+		return mean, std
+	}
+	for c := range mean {
+		mean[c] = sum[c] / float64(n)
+		std[c] = math.Sqrt(max(squares[c]/float64(n)-mean[c]*mean[c], 0))
+	}
+	return mean, std
+}
+
+// The D65 white point of sRGB in CIE XYZ
+const whiteX, whiteZ = 0.95047, 1.08883
+
+// rgbToXYZ and xyzToRGB convert linear sRGB to CIE XYZ and back
+var (
+	rgbToXYZ = [3][3]float64{
+		{0.4124564, 0.3575761, 0.1804375},
+		{0.2126729, 0.7151522, 0.0721750},
+		{0.0193339, 0.1191920, 0.9503041},
+	}
+	xyzToRGB = [3][3]float64{
+		{3.2404542, -1.5371385, -0.4985314},
+		{-0.9692660, 1.8760108, 0.0415560},
+		{0.0556434, -0.2040259, 1.0572252},
+	}
+)
+
+// toLab converts linear sRGB to CIE L*a*b*
+func toLab(c [3]float64) [3]float64 {
+	xyz := multiply(rgbToXYZ, c)
+	fx, fy, fz := labF(xyz[0]/whiteX), labF(xyz[1]), labF(xyz[2]/whiteZ)
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// fromLab converts CIE L*a*b* to linear sRGB
+func fromLab(lab [3]float64) [3]float64 {
+	fy := (lab[0] + 16) / 116
+	fx, fz := fy+lab[1]/500, fy-lab[2]/200
+	return multiply(xyzToRGB, [3]float64{labFInverse(fx) * whiteX, labFInverse(fy), labFInverse(fz) * whiteZ})
+}
+
+func labF(t float64) float64 {
+	if t > 216.0/24389 {
+		return math.Cbrt(t)
+	}
+	return t*24389/27/116 + 16.0/116
+}
+
+func labFInverse(t float64) float64 {
+	if t > 6.0/29 {
+		return t * t * t
+	}
+	return (t - 16.0/116) * 116 * 27 / 24389
+}
@@ -0,0 +1,103 @@
+package effect
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// gradient returns a 256x4 image whose red, green and blue levels run from
+// lo to hi
+func gradient(lo, hi int, tint color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 4))
+	for y := range 4 {
+		for x := range 256 {
+			v := lo + (hi-lo)*x/255
+			img.SetNRGBA(x, y, color.NRGBA{uint8(min(v+int(tint.R), 255)), uint8(min(v+int(tint.G), 255)), uint8(min(v+int(tint.B), 255)), 255})
+		}
+	}
+	return img
+}
+
+func TestMatchColorsReinhard(t *testing.T) {
+	// A warm, dark reference and a cool, bright target
+	ref := NewColorReference(gradient(20, 120, color.NRGBA{40, 10, 0, 0}))
+	target := gradient(100, 220, color.NRGBA{0, 10, 30, 0})
+	out := MatchColors(target, ref, MatchReinhard, 1)
+	mean, std := labStats(out)
+	for c := range mean {
+		if math.Abs(mean[c]-ref.mean[c]) > 1.5 || math.Abs(std[c]-ref.std[c]) > 1.5 {
+			t.Errorf("channel %d: expected %.1f±%.1f, got %.1f±%.1f", c, ref.mean[c], ref.std[c], mean[c], std[c])
+		}
+	}
+
+	// Half the strength lands in between
+	half, _ := labStats(MatchColors(target, ref, MatchReinhard, 0.5))
+	before, _ := labStats(target)
+	if want := (before[0] + ref.mean[0]) / 2; math.Abs(half[0]-want) > 1.5 {
+		t.Errorf("expected a lightness of %.1f at half strength, got %.1f", want, half[0])
+	}
+	if got := MatchColors(target, ref, MatchReinhard, 0); got.NRGBAAt(10, 1) != target.NRGBAAt(10, 1) {
+		t.Errorf("expected no change at zero strength, got %v", got.NRGBAAt(10, 1))
+	}
+}
+
+func TestMatchColorsHistogram(t *testing.T) {
+	ref := NewColorReference(gradient(50, 200, color.NRGBA{}))
+	out := MatchColors(gradient(0, 255, color.NRGBA{}), ref, MatchHistogram, 1)
+	if first, last := out.NRGBAAt(0, 0), out.NRGBAAt(255, 0); first.R != 50 || last.R != 200 || last.B != 200 {
+		t.Errorf("expected levels from 50 to 200, got %v to %v", first, last)
+	}
+	if mid := out.NRGBAAt(128, 0); mid.R < 120 || mid.R > 130 {
+		t.Errorf("expected the middle level near 125, got %v", mid)
+	}
+}
+
+func TestMatchColorsAlpha(t *testing.T) {
+	// Transparent pixels of the reference do not count, and alpha is kept
+	refImg := imaging.New(4, 4, color.NRGBA{255, 255, 255, 0})
+	for x := range 4 {
+		refImg.SetNRGBA(x, 0, color.NRGBA{200, 40, 40, 255})
+	}
+	ref := NewColorReference(refImg)
+	target := imaging.New(2, 2, color.NRGBA{40, 40, 200, 128})
+	for _, method := range []MatchMethod{MatchReinhard, MatchHistogram} {
+		got := MatchColors(target, ref, method, 1).NRGBAAt(0, 0)
+		if got.A != 128 || got.R < 190 || got.B > 50 {
+			t.Errorf("%s: expected a red pixel at alpha 128, got %v", method, got)
+		}
+	}
+
+	// A fully transparent reference changes nothing
+	empty := NewColorReference(imaging.New(2, 2, color.NRGBA{}))
+	if got := MatchColors(target, empty, MatchReinhard, 1).NRGBAAt(0, 0); got != target.NRGBAAt(0, 0) {
+		t.Errorf("expected no change, got %v", got)
+	}
+}
+
+func TestLab(t *testing.T) {
+	if white := toLab([3]float64{1, 1, 1}); math.Abs(white[0]-100) > 0.01 || math.Abs(white[1]) > 0.01 || math.Abs(white[2]) > 0.01 {
+		t.Errorf("expected white at L*=100, got %v", white)
+	}
+	for _, c := range [][3]float64{{0, 0, 0}, {0.2, 0.5, 0.9}, {1, 0, 0}, {0.001, 0.002, 0.003}} {
+		back := fromLab(toLab(c))
+		for i := range c {
+			if math.Abs(back[i]-c[i]) > 1e-6 {
+				t.Errorf("expected %v back, got %v", c, back)
+				break
+			}
+		}
+	}
+}
+
+func TestParseMatchMethod(t *testing.T) {
+	if m, err := ParseMatchMethod("Histogram"); err != nil || m != MatchHistogram {
+		t.Errorf("expected histogram, got %v, %v", m, err)
+	}
+	if _, err := ParseMatchMethod("lut"); err == nil {
+		t.Errorf("expected an error for an unknown method")
+	}
+}
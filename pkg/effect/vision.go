@@ -0,0 +1,140 @@
+// Package effect implements image effects that run after the resize, such
+// as color vision deficiency simulation
+package effect
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Deficiency is a kind of color vision deficiency
+type Deficiency string
+
+const (
+	// Protanopia is the absence of red-sensitive cones
+	Protanopia Deficiency = "protanopia"
+	// Deuteranopia is the absence of green-sensitive cones, the most common
+	// kind of color blindness
+	Deuteranopia Deficiency = "deuteranopia"
+	// Tritanopia is the absence of blue-sensitive cones
+	Tritanopia Deficiency = "tritanopia"
+)
+
+// simulations are the matrices of Machado, Oliveira and Fernandes (2009) for
+// full severity, which act on linear RGB
+var simulations = map[Deficiency][3][3]float64{
+	Protanopia: {
+		{0.152286, 1.052583, -0.204868},
+		{0.114503, 0.786281, 0.099216},
+		{-0.003882, -0.048116, 1.051998},
+	},
+	Deuteranopia: {
+		{0.367322, 0.860646, -0.227968},
+		{0.280085, 0.672501, 0.047413},
+		{-0.011820, 0.042940, 0.968881},
+	},
+	Tritanopia: {
+		{1.255528, -0.076749, -0.178779},
+		{-0.078411, 0.930809, 0.147602},
+		{0.004733, 0.691367, 0.303900},
+	},
+}
+
+// corrections move the color differences a deficiency hides into channels
+// that remain visible: the red error into green and blue for protanopia and
+// deuteranopia, the blue error into red and green for tritanopia
+var corrections = map[Deficiency][3][3]float64{
+	Protanopia:   {{0, 0, 0}, {0.7, 1, 0}, {0.7, 0, 1}},
+	Deuteranopia: {{0, 0, 0}, {0.7, 1, 0}, {0.7, 0, 1}},
+	Tritanopia:   {{1, 0, 0.7}, {0, 1, 0.7}, {0, 0, 0}},
+}
+
+// ParseDeficiency parses the name of a color vision deficiency
+func ParseDeficiency(name string) (Deficiency, error) {
+	d := Deficiency(strings.ToLower(strings.TrimSpace(name)))
+	if _, ok := simulations[d]; !ok {
+		return "", fmt.Errorf("invalid color vision deficiency: %s (expected protanopia, deuteranopia or tritanopia)", name)
+	}
+	return d, nil
+}
+
+// Simulate returns img as a person with the deficiency sees it
+func Simulate(img image.Image, d Deficiency) *image.NRGBA {
+	m := simulations[d]
+	return mapColors(img, func(c [3]float64) [3]float64 {
+		return multiply(m, c)
+	})
+}
+
+// Daltonize returns img with the colors a person with the deficiency cannot
+// tell apart shifted into ones they can (Fidaner, Lin and Ozguven, 2005)
+func Daltonize(img image.Image, d Deficiency) *image.NRGBA {
+	m, correction := simulations[d], corrections[d]
+	return mapColors(img, func(c [3]float64) [3]float64 {
+		seen := multiply(m, c)
+		lost := [3]float64{c[0] - seen[0], c[1] - seen[1], c[2] - seen[2]}
+		shift := multiply(correction, lost)
+		return [3]float64{c[0] + shift[0], c[1] + shift[1], c[2] + shift[2]}
+	})
+}
+
+// multiply returns the product of m and the column vector c
+func multiply(m [3][3]float64, c [3]float64) [3]float64 {
+	var out [3]float64
+	for i, row := range m {
+		out[i] = row[0]*c[0] + row[1]*c[1] + row[2]*c[2]
+	}
+	return out
+}
+
+// mapColors returns a copy of img with fn applied to the linear RGB of every
+// pixel. Alpha is kept.
+func mapColors(img image.Image, fn func([3]float64) [3]float64) *image.NRGBA {
+	out := imaging.Clone(img)
+	cache := make(map[[3]uint8][3]uint8)
+	for i := 0; i < len(out.Pix); i += 4 {
+		p := out.Pix[i : i+3 : i+3]
+		key := [3]uint8{p[0], p[1], p[2]}
+		mapped, ok := cache[key]
+		if !ok {
+			c := fn([3]float64{toLinear[p[0]], toLinear[p[1]], toLinear[p[2]]})
+			mapped = [3]uint8{fromLinear(c[0]), fromLinear(c[1]), fromLinear(c[2])}
+			if len(cache) < 1<<16 {
+				cache[key] = mapped
+			}
+		}
+		p[0], p[1], p[2] = mapped[0], mapped[1], mapped[2]
+	}
+	return out
+}
+
+// toLinear maps sRGB channel values to linear light
+var toLinear = func() (table [256]float64) {
+	for i := range table {
+		v := float64(i) / 255
+		if v <= 0.04045 {
+			table[i] = v / 12.92
+		} else {
+			table[i] = math.Pow((v+0.055)/1.055, 2.4)
+		}
+	}
+	return table
+}()
+
+// fromLinear converts linear light to an sRGB channel value, clamping values
+// out of range
+func fromLinear(v float64) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 1:
+		return 255
+	case v <= 0.0031308:
+		return uint8(v*12.92*255 + 0.5)
+	}
+	return uint8((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
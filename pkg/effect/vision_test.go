@@ -0,0 +1,60 @@
+package effect
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// distance returns the squared RGB distance of two colors
+func distance(a, b color.NRGBA) int {
+	dr, dg, db := int(a.R)-int(b.R), int(a.G)-int(b.G), int(a.B)-int(b.B)
+	return dr*dr + dg*dg + db*db
+}
+
+// swatches returns an image of one pixel per color
+func swatches(colors ...color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, len(colors), 1))
+	for x, c := range colors {
+		img.SetNRGBA(x, 0, c)
+	}
+	return img
+}
+
+func TestSimulate(t *testing.T) {
+	red, green := color.NRGBA{200, 40, 40, 255}, color.NRGBA{40, 160, 40, 128}
+	white := color.NRGBA{255, 255, 255, 255}
+	src := swatches(red, green, white)
+
+	for _, d := range []Deficiency{Protanopia, Deuteranopia} {
+		seen := Simulate(src, d)
+		if distance(seen.NRGBAAt(0, 0), seen.NRGBAAt(1, 0)) >= distance(red, green)/2 {
+			t.Errorf("%s: expected red %v and green %v to look alike", d, seen.NRGBAAt(0, 0), seen.NRGBAAt(1, 0))
+		}
+		if got := seen.NRGBAAt(1, 0).A; got != 128 {
+			t.Errorf("%s: expected alpha to be kept, got %d", d, got)
+		}
+		if got := seen.NRGBAAt(2, 0); distance(got, white) > 12 {
+			t.Errorf("%s: expected white to stay white, got %v", d, got)
+		}
+	}
+}
+
+func TestDaltonize(t *testing.T) {
+	src := swatches(color.NRGBA{200, 40, 40, 255}, color.NRGBA{40, 160, 40, 255})
+	before := Simulate(src, Deuteranopia)
+	after := Simulate(Daltonize(src, Deuteranopia), Deuteranopia)
+	if distance(after.NRGBAAt(0, 0), after.NRGBAAt(1, 0)) <= distance(before.NRGBAAt(0, 0), before.NRGBAAt(1, 0)) {
+		t.Errorf("expected daltonized red and green to be easier to tell apart: %v %v, were %v %v",
+			after.NRGBAAt(0, 0), after.NRGBAAt(1, 0), before.NRGBAAt(0, 0), before.NRGBAAt(1, 0))
+	}
+}
+
+func TestParseDeficiency(t *testing.T) {
+	if d, err := ParseDeficiency(" Tritanopia"); err != nil || d != Tritanopia {
+		t.Errorf("expected tritanopia, got %q, %v", d, err)
+	}
+	if _, err := ParseDeficiency("achromatopsia"); err == nil {
+		t.Error("expected an error for an unsupported deficiency")
+	}
+}
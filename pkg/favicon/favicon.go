@@ -0,0 +1,206 @@
+// Package favicon generates the set of icons a modern website needs from a
+// single source image
+package favicon
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	stdimage "image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"nim/pkg/image"
+)
+
+// MaskablePadding is the fraction of a maskable icon left free on each side,
+// keeping the image inside the safe zone that platforms never crop
+const MaskablePadding = 0.1
+
+// Options controls favicon generation
+type Options struct {
+	Background color.Color // Background of the Apple touch icon and maskable icons
+	Path       string      // URL path the files are served from, e.g. "/" or "/static/"
+	SVG        []byte      // Original SVG source, written as favicon.svg when set
+}
+
+// icon is a generated PNG icon
+type icon struct {
+	name     string
+	size     int
+	maskable bool // Padded onto the background for the manifest's maskable purpose
+	opaque   bool // Flattened onto the background without padding
+}
+
+var icons = []icon{
+	{name: "favicon-16x16.png", size: 16},
+	{name: "favicon-32x32.png", size: 32},
+	{name: "apple-touch-icon.png", size: 180, opaque: true},
+	{name: "icon-192.png", size: 192},
+	{name: "icon-512.png", size: 512},
+	{name: "icon-maskable-192.png", size: 192, maskable: true},
+	{name: "icon-maskable-512.png", size: 512, maskable: true},
+}
+
+// icoSizes are the frames of favicon.ico
+var icoSizes = []int{16, 32, 48}
+
+// Generate writes the favicon set for src into dir: favicon.ico, PNG icons,
+// an Apple touch icon, maskable icons, a web manifest fragment
+// (site.webmanifest) and an HTML snippet (favicon.html). It returns the names
+// of the files written.
+func Generate(src stdimage.Image, dir string, options Options) ([]string, error) {
+	if options.Background == nil {
+		options.Background = color.White
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output folder: %w", err)
+	}
+
+	var written []string
+	write := func(name string, encode func(*os.File) error) error {
+		file, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", name, err)
+		}
+		if err := encode(file); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		written = append(written, name)
+		return nil
+	}
+
+	err := write("favicon.ico", func(f *os.File) error {
+		return image.EncodeICO(f, src, icoSizes)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if options.SVG != nil {
+		err := write("favicon.svg", func(f *os.File) error {
+			_, err := f.Write(options.SVG)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Frames are resized largest first so smaller ones reuse them
+	sizes := make([]int, len(icons))
+	for i, icon := range icons {
+		sizes[i] = icon.size
+	}
+	// iOS shows transparency in touch icons as black
+	opaque := image.FlattenColor(color.NRGBAModel.Convert(options.Background).(color.NRGBA))
+	frames := make([]stdimage.Image, len(icons))
+	cascade := image.NewCascade(src)
+	for _, i := range image.Descending(sizes) {
+		switch icon := icons[i]; {
+		case icon.maskable:
+			frames[i] = cascade.PaddedIconFrame(icon.size, MaskablePadding, options.Background)
+		case icon.opaque:
+			frames[i] = cascade.PaddedIconFrame(icon.size, 0, opaque)
+		default:
+			frames[i] = cascade.IconFrame(icon.size)
+		}
+	}
+	for i, icon := range icons {
+		err := write(icon.name, func(f *os.File) error {
+			return image.Encode(f, frames[i], image.ProcessOptions{OutputFormat: "png"})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	manifest, err := Manifest(options.Path)
+	if err != nil {
+		return nil, err
+	}
+	err = write("site.webmanifest", func(f *os.File) error {
+		_, err := f.Write(manifest)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = write("favicon.html", func(f *os.File) error {
+		_, err := f.WriteString(HTML(options.Path, options.SVG != nil))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return written, nil
+}
+
+// Manifest returns a web app manifest fragment listing the icons, to be
+// merged into the site's manifest
+func Manifest(path string) ([]byte, error) {
+	type manifestIcon struct {
+		Src     string `json:"src"`
+		Sizes   string `json:"sizes"`
+		Type    string `json:"type"`
+		Purpose string `json:"purpose,omitempty"`
+	}
+
+	var entries []manifestIcon
+	for _, icon := range icons {
+		if icon.size < 192 || icon.opaque {
+			continue
+		}
+		entry := manifestIcon{
+			Src:   url(path, icon.name),
+			Sizes: fmt.Sprintf("%dx%d", icon.size, icon.size),
+			Type:  "image/png",
+		}
+		if icon.maskable {
+			entry.Purpose = "maskable"
+		}
+		entries = append(entries, entry)
+	}
+
+	data, err := json.MarshalIndent(map[string]any{"icons": entries}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// HTML returns the link tags that reference the favicon set
+func HTML(path string, svg bool) string {
+	var b strings.Builder
+	link := func(format, name string) {
+		b.WriteString("<link " + fmt.Sprintf(format, html.EscapeString(url(path, name))) + ">\n")
+	}
+	link(`rel="icon" href="%s" sizes="48x48"`, "favicon.ico")
+	if svg {
+		link(`rel="icon" href="%s" type="image/svg+xml"`, "favicon.svg")
+	}
+	link(`rel="icon" href="%s" type="image/png" sizes="32x32"`, "favicon-32x32.png")
+	link(`rel="icon" href="%s" type="image/png" sizes="16x16"`, "favicon-16x16.png")
+	link(`rel="apple-touch-icon" href="%s"`, "apple-touch-icon.png")
+	link(`rel="manifest" href="%s"`, "site.webmanifest")
+	return b.String()
+}
+
+// url joins the URL path the files are served from and a file name
+func url(path, name string) string {
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return path + name
+}
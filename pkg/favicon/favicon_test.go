@@ -0,0 +1,79 @@
+package favicon
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+
+	files, err := Generate(src, dir, Options{Background: color.Black, Path: "/static"})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if len(files) != len(icons)+3 {
+		t.Errorf("Expected %d files, got %v", len(icons)+3, files)
+	}
+
+	// The Apple touch icon is flattened onto the background
+	f, err := os.Open(filepath.Join(dir, "apple-touch-icon.png"))
+	if err != nil {
+		t.Fatalf("Missing apple-touch-icon.png: %v", err)
+	}
+	defer f.Close()
+	touch, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("Failed to decode apple-touch-icon.png: %v", err)
+	}
+	if touch.Bounds().Dx() != 180 {
+		t.Errorf("Expected a 180px Apple touch icon, got %v", touch.Bounds())
+	}
+	if _, _, _, a := touch.At(0, 0).RGBA(); a != 0xffff {
+		t.Errorf("Expected an opaque Apple touch icon")
+	}
+
+	snippet, _ := os.ReadFile(filepath.Join(dir, "favicon.html"))
+	if !strings.Contains(string(snippet), `href="/static/apple-touch-icon.png"`) {
+		t.Errorf("HTML snippet does not reference the Apple touch icon:\n%s", snippet)
+	}
+	if strings.Contains(string(snippet), "favicon.svg") {
+		t.Errorf("HTML snippet references an SVG icon that was not written")
+	}
+}
+
+func TestManifest(t *testing.T) {
+	data, err := Manifest("/")
+	if err != nil {
+		t.Fatalf("Manifest failed: %v", err)
+	}
+
+	var manifest struct {
+		Icons []struct {
+			Src, Sizes, Purpose string
+		}
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("Invalid manifest JSON: %v", err)
+	}
+	if len(manifest.Icons) != 4 {
+		t.Fatalf("Expected 4 manifest icons, got %d", len(manifest.Icons))
+	}
+	if manifest.Icons[2].Src != "/icon-maskable-192.png" || manifest.Icons[2].Purpose != "maskable" {
+		t.Errorf("Unexpected maskable icon entry: %+v", manifest.Icons[2])
+	}
+}
+
+func TestHTMLWithSVG(t *testing.T) {
+	snippet := HTML("", true)
+	if !strings.Contains(snippet, `<link rel="icon" href="/favicon.svg" type="image/svg+xml">`) {
+		t.Errorf("Expected an SVG icon link:\n%s", snippet)
+	}
+}
@@ -0,0 +1,137 @@
+package histogram
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/disintegration/imaging"
+)
+
+// Channel counts the pixels at each of the 256 levels of a channel
+type Channel [256]int
+
+// Histogram holds the per-channel histograms of an image
+type Histogram struct {
+	Red, Green, Blue, Alpha Channel
+	Luma                    Channel // Rec. 601 luma
+	Pixels                  int
+}
+
+// Compute counts the levels of every channel of an image. Color and luma
+// levels are counted as stored, whatever the alpha of the pixel.
+func Compute(img image.Image) Histogram {
+	src := imaging.Clone(img)
+	h := Histogram{Pixels: len(src.Pix) / 4}
+	for i := 0; i < len(src.Pix); i += 4 {
+		r, g, b, a := src.Pix[i], src.Pix[i+1], src.Pix[i+2], src.Pix[i+3]
+		h.Red[r]++
+		h.Green[g]++
+		h.Blue[b]++
+		h.Alpha[a]++
+		h.Luma[luma(r, g, b)]++
+	}
+	return h
+}
+
+// luma returns the Rec. 601 luma of a color, rounded to a level
+func luma(r, g, b uint8) uint8 {
+	return uint8((299*int(r) + 587*int(g) + 114*int(b) + 500) / 1000)
+}
+
+// Total returns the number of pixels counted
+func (c *Channel) Total() int {
+	total := 0
+	for _, n := range c {
+		total += n
+	}
+	return total
+}
+
+// Mean returns the mean level, or 0 for an empty channel
+func (c *Channel) Mean() float64 {
+	total, sum := 0, 0
+	for level, n := range c {
+		total += n
+		sum += level * n
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(sum) / float64(total)
+}
+
+// Percentile returns the lowest level at or below which at least p (0-1) of
+// the pixels lie
+func (c *Channel) Percentile(p float64) int {
+	target := p * float64(c.Total())
+	seen := 0
+	for level, n := range c {
+		seen += n
+		if seen > 0 && float64(seen) >= target {
+			return level
+		}
+	}
+	return 255
+}
+
+// Clipping returns the fractions of pixels at level 0 and at level 255,
+// which lost shadow or highlight detail when the photo was underexposed or
+// overexposed
+func (c *Channel) Clipping() (shadows, highlights float64) {
+	total := c.Total()
+	if total == 0 {
+		return 0, 0
+	}
+	return float64(c[0]) / float64(total), float64(c[255]) / float64(total)
+}
+
+// Render draws the red, green and blue histograms on a dark background,
+// added up where they overlap so levels shared by all three show white. Bars
+// are scaled to the highest count of any color level.
+func Render(h Histogram, width, height int) *image.NRGBA {
+	img := imaging.New(width, height, color.NRGBA{32, 32, 32, 255})
+	if width <= 0 || height <= 0 {
+		return img
+	}
+
+	peak := 0
+	for level := 0; level < 256; level++ {
+		peak = max(peak, h.Red[level], h.Green[level], h.Blue[level])
+	}
+	if peak == 0 {
+		return img
+	}
+
+	// bar returns the height of the bar of a channel in column x, from the
+	// highest count of the levels the column covers
+	bar := func(c *Channel, x int) int {
+		first := x * 256 / width
+		last := max(first, (x+1)*256/width-1)
+		count := 0
+		for level := first; level <= min(last, 255); level++ {
+			count = max(count, c[level])
+		}
+		return (count*height + peak - 1) / peak
+	}
+
+	for x := 0; x < width; x++ {
+		r, g, b := bar(&h.Red, x), bar(&h.Green, x), bar(&h.Blue, x)
+		for y := 0; y < height; y++ {
+			fromBottom := height - y
+			var px [3]uint8
+			covered := false
+			for i, top := range [3]int{r, g, b} {
+				if fromBottom <= top {
+					px[i] = 220
+					covered = true
+				} else {
+					px[i] = 32
+				}
+			}
+			if covered {
+				img.SetNRGBA(x, y, color.NRGBA{px[0], px[1], px[2], 255})
+			}
+		}
+	}
+	return img
+}
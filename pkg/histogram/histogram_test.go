@@ -0,0 +1,84 @@
+package histogram
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestCompute(t *testing.T) {
+	img := imaging.New(4, 2, color.NRGBA{255, 0, 0, 255})
+	img.SetNRGBA(0, 0, color.NRGBA{0, 0, 0, 0})
+	img.SetNRGBA(1, 0, color.NRGBA{255, 255, 255, 255})
+
+	h := Compute(img)
+	if h.Pixels != 8 {
+		t.Fatalf("Expected 8 pixels, got %d", h.Pixels)
+	}
+	if h.Red[255] != 7 || h.Red[0] != 1 {
+		t.Errorf("Unexpected red histogram: %d at 0, %d at 255", h.Red[0], h.Red[255])
+	}
+	if h.Green[255] != 1 || h.Blue[0] != 7 {
+		t.Errorf("Unexpected green or blue histogram")
+	}
+	if h.Alpha[0] != 1 || h.Alpha[255] != 7 {
+		t.Errorf("Unexpected alpha histogram: %d at 0, %d at 255", h.Alpha[0], h.Alpha[255])
+	}
+	if h.Luma[76] != 6 || h.Luma[255] != 1 || h.Luma[0] != 1 {
+		t.Errorf("Unexpected luma histogram: %d red, %d white, %d black", h.Luma[76], h.Luma[255], h.Luma[0])
+	}
+}
+
+func TestStatistics(t *testing.T) {
+	var c Channel
+	c[10] = 1
+	c[20] = 2
+	c[255] = 1
+
+	if c.Total() != 4 {
+		t.Errorf("Expected a total of 4, got %d", c.Total())
+	}
+	if mean := c.Mean(); math.Abs(mean-76.25) > 1e-9 {
+		t.Errorf("Expected a mean of 76.25, got %g", mean)
+	}
+	if median := c.Percentile(0.5); median != 20 {
+		t.Errorf("Expected a median of 20, got %d", median)
+	}
+	if low := c.Percentile(0); low != 10 {
+		t.Errorf("Expected the 0th percentile at 10, got %d", low)
+	}
+	if shadows, highlights := c.Clipping(); shadows != 0 || highlights != 0.25 {
+		t.Errorf("Expected 0 and 0.25 clipped, got %g and %g", shadows, highlights)
+	}
+
+	var empty Channel
+	if empty.Mean() != 0 {
+		t.Errorf("Expected a mean of 0 for an empty channel")
+	}
+	if shadows, highlights := empty.Clipping(); shadows != 0 || highlights != 0 {
+		t.Errorf("Expected no clipping for an empty channel")
+	}
+}
+
+func TestRender(t *testing.T) {
+	img := imaging.New(10, 10, color.NRGBA{255, 255, 255, 255})
+	out := Render(Compute(img), 256, 100)
+	if out.Bounds().Dx() != 256 || out.Bounds().Dy() != 100 {
+		t.Fatalf("Unexpected size: %v", out.Bounds())
+	}
+
+	// All channels peak at 255: a full-height white bar on the right only
+	if c := out.NRGBAAt(255, 0); c.R != 220 || c.G != 220 || c.B != 220 {
+		t.Errorf("Expected a white bar at level 255, got %v", c)
+	}
+	if c := out.NRGBAAt(0, 99); c.R != 32 || c.G != 32 || c.B != 32 {
+		t.Errorf("Expected the background at level 0, got %v", c)
+	}
+
+	// Narrower renders still show every level
+	if c := Render(Compute(img), 64, 10).NRGBAAt(63, 5); c.R != 220 {
+		t.Errorf("Expected level 255 in the last column, got %v", c)
+	}
+}
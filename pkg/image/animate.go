@@ -0,0 +1,229 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+// AnimationFormats are the output formats that keep every frame of animated
+// inputs
+var AnimationFormats = []string{"webp", "avif"}
+
+// AnimationEncoder encodes frames into an animated WebP or AVIF. Each frame
+// is encoded at options.Quality, or at the quality chosen for it when
+// options.TargetSSIM is set (see AutoQuality).
+type AnimationEncoder struct {
+	format  string
+	options ProcessOptions
+	loops   int
+	size    image.Point
+	webp    *webpAnimEncoder
+	frames  []avifFrame // Frames of AVIF output, encoded at the end
+}
+
+// avifFrame is a frame of AVIF output waiting to be encoded
+type avifFrame struct {
+	img     *image.NRGBA
+	delay   time.Duration
+	options ProcessOptions
+}
+
+// NewAnimationEncoder returns an encoder for options.OutputFormat, which is
+// one of AnimationFormats, playing loops times or forever for 0. It must be
+// closed.
+func NewAnimationEncoder(loops int, options ProcessOptions) (*AnimationEncoder, error) {
+	format := strings.ToLower(options.OutputFormat)
+	if !slices.Contains(AnimationFormats, format) {
+		return nil, fmt.Errorf("animations cannot be encoded as %s (expected %s)", format, strings.Join(AnimationFormats, " or "))
+	}
+	options.OutputFormat = format
+	return &AnimationEncoder{format: format, options: options, loops: loops}, nil
+}
+
+// Add encodes img as the next frame, shown for delay, with the options of
+// the encoder, which SetOptions changes. Every frame must have the size of
+// the first.
+func (e *AnimationEncoder) Add(img image.Image, delay time.Duration) error {
+	frame := imaging.Clone(img)
+	if e.size == (image.Point{}) {
+		e.size = frame.Rect.Size()
+	} else if frame.Rect.Size() != e.size {
+		return fmt.Errorf("frame size %dx%d differs from the animation size %dx%d", frame.Rect.Dx(), frame.Rect.Dy(), e.size.X, e.size.Y)
+	}
+
+	if e.format == "avif" {
+		e.frames = append(e.frames, avifFrame{frame, delay, e.options})
+		return nil
+	}
+	if e.webp == nil {
+		enc, err := newWebPAnimEncoder(e.size, e.loops)
+		if err != nil {
+			return err
+		}
+		e.webp = enc
+	}
+	options, err := AutoQuality(frame, "", e.options)
+	if err != nil {
+		return err
+	}
+	return e.webp.add(frame, delay, options.Quality, options.WebP)
+}
+
+// Encode writes the animation of the frames added to w
+func (e *AnimationEncoder) Encode(w io.Writer) error {
+	var data []byte
+	var err error
+	switch {
+	case e.size == (image.Point{}):
+		return fmt.Errorf("the animation has no frames")
+	case e.format == "avif":
+		data, err = e.encodeAVIF()
+	default:
+		data, err = e.webp.assemble()
+	}
+	if err != nil {
+		return withKind(ErrEncode, fmt.Errorf("failed to encode animation: %w", err))
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// encodeAVIF encodes each frame as an AVIF of its own and joins them into an
+// image sequence
+func (e *AnimationEncoder) encodeAVIF() ([]byte, error) {
+	// The encoder leaves out the alpha of opaque images, but a sequence with
+	// alpha needs it in every frame; a pixel of opaque frames is made barely
+	// transparent to keep it
+	alpha := slices.ContainsFunc(e.frames, func(f avifFrame) bool { return !f.img.Opaque() })
+	stills := make([]avifStill, len(e.frames))
+	delays := make([]time.Duration, len(e.frames))
+	for i, f := range e.frames {
+		if alpha && f.img.Opaque() {
+			f.img.Pix[3] = 254
+		}
+		options, err := AutoQuality(f.img, "", f.options)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := EncodeAVIF(&buf, f.img, options.Quality, options.AVIF); err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i+1, err)
+		}
+		if stills[i], err = readAVIFStill(buf.Bytes()); err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i+1, err)
+		}
+		delays[i] = f.delay
+	}
+	return muxAVIS(stills, delays, e.loops)
+}
+
+// SetOptions changes the quality and encoder options of the frames added
+// next. The output format stays the same.
+func (e *AnimationEncoder) SetOptions(options ProcessOptions) {
+	options.OutputFormat = e.format
+	e.options = options
+}
+
+// Close frees the encoder
+func (e *AnimationEncoder) Close() {
+	if e.webp != nil {
+		e.webp.close()
+	}
+	e.frames = nil
+}
+
+// OpenAnimation reads an animated GIF, WebP or PNG file to convert all its
+// frames. It returns nil for still images and other formats.
+func OpenAnimation(path string) (*Animation, error) {
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	switch format {
+	case "gif", "png", "webp":
+	default:
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return ReadAnimation(data, format)
+}
+
+// ProcessAnimation converts every frame of an animation read from inputPath
+// into an animated WebP or AVIF at outputPath, like Process. transform
+// processes each frame; nil applies the crop and resize of options (see
+// Transform). Every frame must come out the same size.
+func ProcessAnimation(a *Animation, inputPath, outputPath string, options ProcessOptions, transform func(image.Image, ProcessOptions) (*image.NRGBA, ProcessOptions, error)) (Result, error) {
+	start := time.Now()
+	if transform == nil {
+		transform = func(img image.Image, options ProcessOptions) (*image.NRGBA, ProcessOptions, error) {
+			result, err := Transform(img, options)
+			return result, options, err
+		}
+	}
+	if options.MaxBytes > 0 {
+		return Result{}, fmt.Errorf("a size limit cannot be used with animated output")
+	}
+	options.OutputFormat = outputFormat(outputPath, options)
+	enc, err := NewAnimationEncoder(a.Loops, options)
+	if err != nil {
+		return Result{}, err
+	}
+	defer enc.Close()
+
+	// The frames are decoded, transformed and encoded in a single stage,
+	// without reporting the stages of each frame
+	defer options.Hooks.Start(StageEncode)()
+	progress := newProgressCounter(options.Hooks, StageEncode, a.Len())
+	frameOptions := options
+	frameOptions.Hooks = Hooks{}
+	done := 0
+	err = a.Frames(func(img *image.NRGBA, delay time.Duration) error {
+		progress.set(done)
+		result, frameOptions, err := transform(img, frameOptions)
+		if err != nil {
+			return err
+		}
+		// An encode step of the frame sets its quality
+		enc.SetOptions(frameOptions)
+		done++
+		return enc.Add(result, delay)
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	progress.set(done)
+
+	out, err := createOutput(outputPath, options)
+	if err != nil {
+		return Result{}, err
+	}
+	defer out.Close()
+	w := getWriter(out)
+	defer putWriter(w)
+	if err := enc.Encode(w); err != nil {
+		return Result{}, err
+	}
+	if err := w.Flush(); err != nil {
+		return Result{}, fmt.Errorf("failed to write %s: %w", outputPath, err)
+	}
+	written, digest, err := out.Commit()
+	if err != nil {
+		return Result{}, err
+	}
+	slog.Info("wrote animation", "file", written, "format", options.OutputFormat, "frames", a.Len(), "hash", digest, "duration", time.Since(start))
+
+	// Rectangles stand in for the canvas and the frames
+	result, err := NewResult(inputPath, image.Rectangle{Max: a.Size}, written, image.Rectangle{Max: enc.size}, options, start)
+	result.Hash = digest
+	return result, err
+}
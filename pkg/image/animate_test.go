@@ -0,0 +1,222 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadAnimation(t *testing.T) {
+	for format, data := range map[string][]byte{"gif": testGIF(t), "png": testAPNG(t), "webp": testWebP(t)} {
+		a, err := ReadAnimation(data, format)
+		if err != nil || a == nil {
+			t.Fatalf("%s: failed to read the animation: %v", format, err)
+		}
+		if a.Len() != 3 || a.Size != image.Pt(8, 8) || a.Loops != 0 {
+			t.Errorf("%s: expected 3 frames of 8x8 looping forever, got %d of %v playing %d times", format, a.Len(), a.Size, a.Loops)
+		}
+		var delays []time.Duration
+		a.Frames(func(img *image.NRGBA, delay time.Duration) error {
+			delays = append(delays, delay)
+			return nil
+		})
+		if len(delays) != 3 || delays[0] != 100*time.Millisecond {
+			t.Errorf("%s: expected 3 delays of 100ms, got %v", format, delays)
+		}
+	}
+
+	// The GIF loop count is the number of repeats after the first play
+	g, _ := gif.DecodeAll(bytes.NewReader(testGIF(t)))
+	g.LoopCount = 2
+	var buf bytes.Buffer
+	gif.EncodeAll(&buf, g)
+	if a, _ := ReadAnimation(buf.Bytes(), "gif"); a == nil || a.Loops != 3 {
+		t.Errorf("Expected 3 plays, got %v", a)
+	}
+
+	buf.Reset()
+	png.Encode(&buf, solid(image.Rect(0, 0, 2, 2), blue))
+	if a, err := ReadAnimation(buf.Bytes(), "png"); a != nil || err != nil {
+		t.Errorf("Expected no animation for a still image, got %v (%v)", a, err)
+	}
+}
+
+func TestAnimationEncoderWebP(t *testing.T) {
+	a, err := ReadAnimation(testGIF(t), "gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := DefaultOptions()
+	options.OutputFormat = "webp"
+	options.WebP.Lossless = true
+	enc, err := NewAnimationEncoder(2, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+	err = a.Frames(func(img *image.NRGBA, delay time.Duration) error {
+		return enc.Add(img, delay)
+	})
+	if err != nil {
+		t.Fatalf("Failed to add the frames: %v", err)
+	}
+	if err := enc.Add(solid(image.Rect(0, 0, 4, 4), red), time.Second); err == nil {
+		t.Error("Expected an error for a frame of another size")
+	}
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	out, err := ReadAnimation(buf.Bytes(), "webp")
+	if err != nil || out == nil || out.Len() != 3 || out.Loops != 2 {
+		t.Fatalf("Expected 3 frames playing twice, got %v (%v)", out, err)
+	}
+	img, err := DecodeFrame(buf.Bytes(), "webp", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := img.NRGBAAt(1, 1); c != green {
+		t.Errorf("Expected green at (1,1) of frame 2, got %v", c)
+	}
+	if c := img.NRGBAAt(6, 6); c != red {
+		t.Errorf("Expected red at (6,6) of frame 2, got %v", c)
+	}
+
+	options.OutputFormat = "gif"
+	if _, err := NewAnimationEncoder(0, options); err == nil {
+		t.Error("Expected an error for GIF output")
+	}
+}
+
+// testAVIF returns a still AVIF with made-up AV1 data, with its color item
+// followed by an alpha item when alpha is set
+func testAVIF(color, alpha []byte) []byte {
+	ispe := append(make([]byte, 4), 0, 0, 0, 8, 0, 0, 0, 8)
+	av1C := box("av1C", []byte{0x81, 0x00, 0x0c, 0x00})
+	ftyp := box("ftyp", []byte("avif\x00\x00\x00\x00mif1avif"))
+
+	items := [][]byte{color}
+	if alpha != nil {
+		items = append(items, alpha)
+	}
+	build := func(start int) []byte {
+		iloc := []byte{0, 0, 0, 0, 0x44, 0x00, 0, byte(len(items))}
+		offset := start
+		for i, data := range items {
+			iloc = append(iloc, 0, byte(i+1), 0, 0, 0, 1)
+			iloc = binary.BigEndian.AppendUint32(iloc, uint32(offset))
+			iloc = binary.BigEndian.AppendUint32(iloc, uint32(len(data)))
+			offset += len(data)
+		}
+		ipco := box("ipco", box("ispe", ispe), av1C, box("auxC", []byte("\x00\x00\x00\x00"+avifAlphaURN+"\x00")))
+		ipma := []byte{0, 0, 0, 0, 0, 0, 0, byte(len(items)), 0, 1, 2, 0x01, 0x82}
+		contents := [][]byte{{0, 0, 0, 0}, box("pitm", []byte{0, 0, 0, 0, 0, 1}), box("iloc", iloc)}
+		if alpha != nil {
+			ipma = append(ipma, 0, 2, 3, 0x01, 0x82, 0x03)
+			contents = append(contents, box("iref", []byte{0, 0, 0, 0}, box("auxl", []byte{0, 2, 0, 1, 0, 1})))
+		}
+		return box("meta", append(contents, box("iprp", ipco, box("ipma", ipma)))...)
+	}
+	start := len(ftyp) + len(build(0)) + 8
+	return append(append(ftyp, build(start)...), box("mdat", items...)...)
+}
+
+func TestMuxAVIS(t *testing.T) {
+	var frames []avifStill
+	for _, data := range []string{"frame1", "frame2", "frame3"} {
+		still, err := readAVIFStill(testAVIF([]byte(data), []byte(data+"-alpha")))
+		if err != nil {
+			t.Fatalf("Failed to read the still AVIF: %v", err)
+		}
+		if string(still.color.data) != data || still.alpha == nil || string(still.alpha.data) != data+"-alpha" {
+			t.Fatalf("Expected the color and alpha of %s, got %+v", data, still)
+		}
+		frames = append(frames, still)
+	}
+	delays := []time.Duration{100 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond}
+	out, err := muxAVIS(frames, delays, 0)
+	if err != nil {
+		t.Fatalf("Failed to mux: %v", err)
+	}
+
+	// The first frame is the still image of the sequence
+	still, err := readAVIFStill(out)
+	if err != nil {
+		t.Fatalf("Failed to read the sequence as a still: %v", err)
+	}
+	if string(still.color.data) != "frame1" || still.alpha == nil || string(still.alpha.data) != "frame1-alpha" {
+		t.Errorf("Expected frame 1 as the still image, got %+v", still)
+	}
+
+	// A color and an alpha track hold every frame
+	var tracks, samples int
+	walkBoxes(out, func(kind string, body []byte) bool {
+		if kind == "moov" {
+			walkBoxes(body, func(kind string, body []byte) bool {
+				if kind == "trak" {
+					tracks++
+				}
+				return true
+			})
+		}
+		return true
+	})
+	if tracks != 2 {
+		t.Errorf("Expected 2 tracks, got %d", tracks)
+	}
+	for _, data := range []string{"frame1", "frame2", "frame3", "frame1-alpha", "frame3-alpha"} {
+		if bytes.Contains(out, []byte(data)) {
+			samples++
+		}
+	}
+	if samples != 5 || !bytes.HasPrefix(out[4:], []byte("ftypavis")) {
+		t.Error("Expected an AVIF image sequence with the data of every frame")
+	}
+
+	frames[1].alpha = nil
+	if _, err := muxAVIS(frames, delays, 0); err == nil {
+		t.Error("Expected an error for frames with and without alpha")
+	}
+}
+
+func TestProcessAnimation(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "anim.gif")
+	os.WriteFile(input, testGIF(t), 0o644)
+	output := filepath.Join(dir, "anim.webp")
+
+	options := DefaultOptions()
+	options.Width, options.Height = 4, 4
+	options.WebP.Lossless = true
+	if _, err := Process(input, output, options); err != nil {
+		t.Fatalf("Failed to process the animation: %v", err)
+	}
+	data, _ := os.ReadFile(output)
+	a, err := ReadAnimation(data, "webp")
+	if err != nil || a == nil || a.Len() != 3 || a.Size != image.Pt(4, 4) {
+		t.Fatalf("Expected 3 frames of 4x4, got %v (%v)", a, err)
+	}
+
+	// A frame picks a still image
+	options.Frame = 2
+	if _, err := Process(input, output, options); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(output)
+	if a, _ := ReadAnimation(data, "webp"); a != nil {
+		t.Error("Expected a still image for --frame")
+	}
+
+	options.Frame = 0
+	options.MaxBytes = 1000
+	if _, err := Process(input, output, options); err == nil {
+		t.Error("Expected an error for a size limit")
+	}
+}
@@ -0,0 +1,439 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chai2010/webp"
+)
+
+// Frame selections for ProcessOptions.Frame besides frame numbers
+const (
+	// FrameMiddle is the middle frame of an animation, a good poster image
+	FrameMiddle = -1
+	// FrameLast is the last frame of an animation
+	FrameLast = -2
+)
+
+// ParseFrame parses a frame of an animation: a number starting at 1, first,
+// middle or last
+func ParseFrame(s string) (int, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "first":
+		return 1, nil
+	case "middle":
+		return FrameMiddle, nil
+	case "last":
+		return FrameLast, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid frame: %s (expected a number from 1, first, middle or last)", s)
+	}
+	return n, nil
+}
+
+// Disposal of the area of a frame before the next frame is drawn
+const (
+	disposeNone       = iota // Leave the frame on the canvas
+	disposeBackground        // Clear the area of the frame to transparent
+	disposePrevious          // Restore the canvas from before the frame
+)
+
+// animationFrame is a frame of an animation as it is stored, covering part
+// of the canvas
+type animationFrame struct {
+	rect    image.Rectangle             // Area of the canvas the frame covers
+	decode  func() (image.Image, error) // Decodes the pixels of the frame
+	delay   time.Duration               // How long the frame is shown
+	blend   bool                        // Draw the frame over the canvas instead of replacing its area
+	dispose int                         // What happens to the area of the frame after it is shown
+}
+
+// readAnimation reads the canvas size and the frames of an animated GIF,
+// WebP or PNG. Inputs that are not animated give a single frame.
+func readAnimation(data []byte, format string) (image.Point, []animationFrame, error) {
+	var size image.Point
+	var frames []animationFrame
+	var err error
+	switch format {
+	case "gif":
+		size, frames, err = readGIFFrames(data)
+	case "png":
+		size, frames, err = readAPNGFrames(data)
+	case "webp":
+		size, frames, err = readWebPFrames(data)
+	default:
+		return image.Point{}, nil, fmt.Errorf("frames cannot be selected from %s input (expected GIF, WebP or PNG)", format)
+	}
+	if err != nil {
+		return image.Point{}, nil, err
+	}
+	if frames == nil {
+		// A still image is its only frame
+		decode := func() (image.Image, error) {
+			if format == "webp" {
+				return webp.Decode(bytes.NewReader(data))
+			}
+			return png.Decode(bytes.NewReader(data))
+		}
+		img, err := decode()
+		if err != nil {
+			return image.Point{}, nil, err
+		}
+		b := img.Bounds()
+		frames = []animationFrame{{rect: image.Rectangle{Max: b.Size()}, decode: func() (image.Image, error) { return img, nil }}}
+		size = b.Size()
+	}
+	return size, frames, nil
+}
+
+// DecodeFrame decodes frame n (1-based, or FrameMiddle or FrameLast) of an
+// animated GIF, WebP or PNG, as it is shown: drawn over the frames before it
+// on the full canvas
+func DecodeFrame(data []byte, format string, n int) (*image.NRGBA, error) {
+	size, frames, err := readAnimation(data, format)
+	if err != nil {
+		return nil, err
+	}
+	index := n - 1
+	switch n {
+	case FrameMiddle:
+		index = len(frames) / 2
+	case FrameLast:
+		index = len(frames) - 1
+	}
+	if index < 0 || index >= len(frames) {
+		return nil, fmt.Errorf("frame %d is out of range (expected 1 to %d)", n, len(frames))
+	}
+
+	var shown *image.NRGBA
+	err = composite(size, frames[:index+1], func(i int, canvas *image.NRGBA) error {
+		shown = canvas
+		return nil
+	})
+	return shown, err
+}
+
+// composite draws frames in turn on a canvas of a size, calling fn with the
+// canvas as each frame is shown. The canvas is reused for the next frame.
+func composite(size image.Point, frames []animationFrame, fn func(i int, canvas *image.NRGBA) error) error {
+	canvas := image.NewNRGBA(image.Rectangle{Max: size})
+	var previous []byte
+	for i, f := range frames {
+		img, err := f.decode()
+		if err != nil {
+			return fmt.Errorf("failed to decode frame %d: %w", i+1, err)
+		}
+		if f.dispose == disposePrevious {
+			previous = bytes.Clone(canvas.Pix)
+		}
+		op := draw.Over
+		if !f.blend {
+			op = draw.Src
+		}
+		draw.Draw(canvas, f.rect, img, img.Bounds().Min, op)
+		if err := fn(i, canvas); err != nil {
+			return err
+		}
+		if i == len(frames)-1 {
+			break
+		}
+		switch f.dispose {
+		case disposeBackground:
+			draw.Draw(canvas, f.rect, image.Transparent, image.Point{}, draw.Src)
+		case disposePrevious:
+			copy(canvas.Pix, previous)
+		}
+	}
+	return nil
+}
+
+// Animation is an animated GIF, WebP or PNG read to convert all its frames
+type Animation struct {
+	Size   image.Point // Size of the canvas
+	Loops  int         // Times the animation plays; 0 loops forever
+	frames []animationFrame
+}
+
+// ReadAnimation reads the frames of an animated GIF, WebP or PNG. It returns
+// nil for still images and other formats.
+func ReadAnimation(data []byte, format string) (*Animation, error) {
+	switch format {
+	case "gif", "png", "webp":
+	default:
+		return nil, nil
+	}
+	size, frames, err := readAnimation(data, format)
+	if err != nil || len(frames) < 2 {
+		return nil, withKind(ErrDecode, err)
+	}
+	return &Animation{Size: size, Loops: loopCount(data, format), frames: frames}, nil
+}
+
+// Len returns the number of frames
+func (a *Animation) Len() int {
+	return len(a.frames)
+}
+
+// Frames calls fn with each frame as it is shown, drawn on the full canvas,
+// and how long it is shown. The canvas is reused, so fn must not keep it.
+func (a *Animation) Frames(fn func(img *image.NRGBA, delay time.Duration) error) error {
+	return composite(a.Size, a.frames, func(i int, canvas *image.NRGBA) error {
+		delay := a.frames[i].delay
+		// Browsers show frames of less than 20 ms for 100 ms
+		if delay < 20*time.Millisecond {
+			delay = 100 * time.Millisecond
+		}
+		return fn(canvas, delay)
+	})
+}
+
+// loopCount returns the times an animated GIF, WebP or PNG plays, or 0 if
+// it loops forever
+func loopCount(data []byte, format string) int {
+	switch format {
+	case "gif":
+		// The NETSCAPE2.0 extension repeats the animation; without it, it
+		// plays once
+		i := bytes.Index(data, []byte("NETSCAPE2.0"))
+		if i < 0 || i+16 > len(data) || data[i+11] != 3 || data[i+12] != 1 {
+			return 1
+		}
+		if n := int(binary.LittleEndian.Uint16(data[i+13:])); n > 0 {
+			return n + 1
+		}
+		return 0
+	case "webp":
+		chunks, err := readWebPChunks(data)
+		if err != nil {
+			return 0
+		}
+		for _, c := range chunks {
+			if c.id == "ANIM" && len(c.data) >= 6 {
+				return int(binary.LittleEndian.Uint16(c.data[4:]))
+			}
+		}
+	case "png":
+		if i := bytes.Index(data, []byte("acTL")); i >= 0 && i+12 <= len(data) {
+			return int(binary.BigEndian.Uint32(data[i+8:]))
+		}
+	}
+	return 0
+}
+
+// readGIFFrames reads the frames of a GIF
+func readGIFFrames(data []byte) (image.Point, []animationFrame, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return image.Point{}, nil, err
+	}
+	size := image.Pt(g.Config.Width, g.Config.Height)
+	frames := make([]animationFrame, len(g.Image))
+	for i, img := range g.Image {
+		size.X, size.Y = max(size.X, img.Rect.Max.X), max(size.Y, img.Rect.Max.Y)
+		frames[i] = animationFrame{
+			rect:   img.Rect,
+			decode: func() (image.Image, error) { return img, nil },
+			delay:  time.Duration(g.Delay[i]) * 10 * time.Millisecond,
+			blend:  true,
+		}
+		if i < len(g.Disposal) {
+			switch g.Disposal[i] {
+			case gif.DisposalBackground:
+				frames[i].dispose = disposeBackground
+			case gif.DisposalPrevious:
+				frames[i].dispose = disposePrevious
+			}
+		}
+	}
+	return size, frames, nil
+}
+
+// readAPNGFrames reads the frames of an animated PNG, or none for a still
+// PNG. Each frame is decoded as a PNG of its own, made of the header of the
+// file with the size of the frame and the image data of the frame.
+func readAPNGFrames(data []byte) (image.Point, []animationFrame, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if len(data) < 8 || string(data[:8]) != signature {
+		return image.Point{}, nil, fmt.Errorf("not a PNG file")
+	}
+	type apngFrame struct {
+		animationFrame
+		data []byte
+	}
+	var header, ihdr []byte
+	var frames []*apngFrame
+	animated, seenData := false, false
+	for pos := 8; pos+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		kind := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) {
+			return image.Point{}, nil, fmt.Errorf("truncated PNG chunk")
+		}
+		chunk := data[pos+8 : pos+8+length]
+		switch kind {
+		case "IHDR":
+			if length != 13 {
+				return image.Point{}, nil, fmt.Errorf("invalid PNG header")
+			}
+			ihdr = chunk
+		case "acTL":
+			animated = true
+		case "fcTL":
+			if length != 26 {
+				return image.Point{}, nil, fmt.Errorf("invalid APNG frame control chunk")
+			}
+			w, h := int(binary.BigEndian.Uint32(chunk[4:])), int(binary.BigEndian.Uint32(chunk[8:]))
+			x, y := int(binary.BigEndian.Uint32(chunk[12:])), int(binary.BigEndian.Uint32(chunk[16:]))
+			num, den := binary.BigEndian.Uint16(chunk[20:]), binary.BigEndian.Uint16(chunk[22:])
+			if den == 0 {
+				den = 100
+			}
+			f := &apngFrame{animationFrame: animationFrame{
+				rect:    image.Rect(x, y, x+w, y+h),
+				delay:   time.Duration(num) * time.Second / time.Duration(den),
+				dispose: int(chunk[24]),
+				blend:   chunk[25] == 1,
+			}}
+			if f.dispose > disposePrevious {
+				return image.Point{}, nil, fmt.Errorf("invalid APNG disposal: %d", f.dispose)
+			}
+			frames = append(frames, f)
+		case "IDAT":
+			// The default image is the first frame when a frame control
+			// chunk comes before it
+			seenData = true
+			if len(frames) > 0 {
+				frames[len(frames)-1].data = append(frames[len(frames)-1].data, chunk...)
+			}
+		case "fdAT":
+			if len(frames) > 0 && length >= 4 {
+				frames[len(frames)-1].data = append(frames[len(frames)-1].data, chunk[4:]...)
+			}
+		case "IEND":
+		default:
+			if !seenData {
+				header = appendPNGChunk(header, kind, chunk)
+			}
+		}
+		pos += 12 + length
+	}
+	if !animated || len(frames) == 0 {
+		return image.Point{}, nil, nil
+	}
+	if ihdr == nil {
+		return image.Point{}, nil, fmt.Errorf("missing PNG header")
+	}
+
+	size := image.Pt(int(binary.BigEndian.Uint32(ihdr)), int(binary.BigEndian.Uint32(ihdr[4:])))
+	list := make([]animationFrame, len(frames))
+	for i, f := range frames {
+		if i == 0 && f.dispose == disposePrevious {
+			f.dispose = disposeBackground
+		}
+		frameHeader := bytes.Clone(ihdr)
+		binary.BigEndian.PutUint32(frameHeader, uint32(f.rect.Dx()))
+		binary.BigEndian.PutUint32(frameHeader[4:], uint32(f.rect.Dy()))
+		file := appendPNGChunk([]byte(signature), "IHDR", frameHeader)
+		file = append(file, header...)
+		file = appendPNGChunk(file, "IDAT", f.data)
+		file = appendPNGChunk(file, "IEND", nil)
+		f.decode = func() (image.Image, error) { return png.Decode(bytes.NewReader(file)) }
+		list[i] = f.animationFrame
+	}
+	return size, list, nil
+}
+
+// appendPNGChunk appends a PNG chunk with its length and checksum
+func appendPNGChunk(b []byte, kind string, data []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	start := len(b)
+	b = append(b, kind...)
+	b = append(b, data...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b[start:]))
+}
+
+// readWebPFrames reads the frames of an animated WebP, or none for a still
+// WebP. Each frame is decoded as a WebP of its own, made of its bitstream
+// and, for lossy frames with transparency, its alpha chunk.
+func readWebPFrames(data []byte) (image.Point, []animationFrame, error) {
+	chunks, err := readWebPChunks(data)
+	if err != nil {
+		return image.Point{}, nil, err
+	}
+	var size image.Point
+	var frames []animationFrame
+	for _, c := range chunks {
+		switch c.id {
+		case "VP8X":
+			if len(c.data) < 10 {
+				return image.Point{}, nil, fmt.Errorf("truncated WebP chunk")
+			}
+			size = image.Pt(1+uint24(c.data[4:]), 1+uint24(c.data[7:]))
+		case "ANMF":
+			if len(c.data) < 16 {
+				return image.Point{}, nil, fmt.Errorf("truncated WebP chunk")
+			}
+			x, y := 2*uint24(c.data), 2*uint24(c.data[3:])
+			w, h := 1+uint24(c.data[6:]), 1+uint24(c.data[9:])
+			flags := c.data[15]
+			sub, err := readWebPChunks(append([]byte("RIFF\x00\x00\x00\x00WEBP"), c.data[16:]...))
+			if err != nil {
+				return image.Point{}, nil, err
+			}
+			var still []webpChunk
+			for _, s := range sub {
+				switch s.id {
+				case "ALPH":
+					header := make([]byte, 10)
+					header[0] = 0x10 // Alpha
+					putUint24(header[4:], w-1)
+					putUint24(header[7:], h-1)
+					still = append(still, webpChunk{"VP8X", header}, s)
+				case "VP8 ", "VP8L":
+					still = append(still, s)
+				}
+			}
+			frame := writeWebPChunks(still)
+			f := animationFrame{
+				rect:   image.Rect(x, y, x+w, y+h),
+				delay:  time.Duration(uint24(c.data[12:])) * time.Millisecond,
+				blend:  flags&0x02 == 0,
+				decode: func() (image.Image, error) { return decodeWebPFrame(frame) },
+			}
+			if flags&0x01 != 0 {
+				f.dispose = disposeBackground
+			}
+			frames = append(frames, f)
+		}
+	}
+	return size, frames, nil
+}
+
+// decodeWebPFrame decodes a frame of an animated WebP
+func decodeWebPFrame(data []byte) (image.Image, error) {
+	img, err := webp.DecodeRGBA(data)
+	if err != nil {
+		return nil, err
+	}
+	// The samples are not premultiplied
+	return &image.NRGBA{Pix: img.Pix, Stride: img.Stride, Rect: img.Rect}, nil
+}
+
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
@@ -0,0 +1,189 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+var (
+	red   = color.NRGBA{255, 0, 0, 255}
+	green = color.NRGBA{0, 255, 0, 255}
+	blue  = color.NRGBA{0, 0, 255, 255}
+)
+
+// solid returns an image of one color covering rect
+func solid(rect image.Rectangle, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(rect)
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+// testGIF returns a 3-frame GIF: a red canvas, a green square on it that is
+// disposed to the background, and a blue square
+func testGIF(t *testing.T) []byte {
+	palette := color.Palette{color.Transparent, red, green, blue}
+	frame := func(rect image.Rectangle, index uint8) *image.Paletted {
+		img := image.NewPaletted(rect, palette)
+		for i := range img.Pix {
+			img.Pix[i] = index
+		}
+		return img
+	}
+	g := &gif.GIF{
+		Image:    []*image.Paletted{frame(image.Rect(0, 0, 8, 8), 1), frame(image.Rect(0, 0, 4, 4), 2), frame(image.Rect(4, 4, 8, 8), 3)},
+		Delay:    []int{10, 10, 10},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone},
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testAPNG returns an APNG with the same frames as testGIF
+func testAPNG(t *testing.T) []byte {
+	idat := func(img image.Image) []byte {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		var out []byte
+		for pos := 8; pos < len(data); {
+			length := int(binary.BigEndian.Uint32(data[pos:]))
+			if string(data[pos+4:pos+8]) == "IDAT" {
+				out = append(out, data[pos+8:pos+8+length]...)
+			}
+			pos += 12 + length
+		}
+		return out
+	}
+	fctl := func(seq int, rect image.Rectangle, dispose byte) []byte {
+		b := make([]byte, 26)
+		binary.BigEndian.PutUint32(b, uint32(seq))
+		binary.BigEndian.PutUint32(b[4:], uint32(rect.Dx()))
+		binary.BigEndian.PutUint32(b[8:], uint32(rect.Dy()))
+		binary.BigEndian.PutUint32(b[12:], uint32(rect.Min.X))
+		binary.BigEndian.PutUint32(b[16:], uint32(rect.Min.Y))
+		binary.BigEndian.PutUint16(b[20:], 1)
+		binary.BigEndian.PutUint16(b[22:], 10)
+		b[24], b[25] = dispose, 1
+		return b
+	}
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr, 8)
+	binary.BigEndian.PutUint32(ihdr[4:], 8)
+	ihdr[8], ihdr[9] = 8, 2 // 8-bit RGB, as png.Encode writes opaque images
+
+	out := appendPNGChunk([]byte("\x89PNG\r\n\x1a\n"), "IHDR", ihdr)
+	out = appendPNGChunk(out, "acTL", []byte{0, 0, 0, 3, 0, 0, 0, 0})
+	out = appendPNGChunk(out, "fcTL", fctl(0, image.Rect(0, 0, 8, 8), 0))
+	out = appendPNGChunk(out, "IDAT", idat(solid(image.Rect(0, 0, 8, 8), red)))
+	out = appendPNGChunk(out, "fcTL", fctl(1, image.Rect(0, 0, 4, 4), 1))
+	out = appendPNGChunk(out, "fdAT", append([]byte{0, 0, 0, 2}, idat(solid(image.Rect(0, 0, 4, 4), green))...))
+	out = appendPNGChunk(out, "fcTL", fctl(3, image.Rect(4, 4, 8, 8), 0))
+	out = appendPNGChunk(out, "fdAT", append([]byte{0, 0, 0, 4}, idat(solid(image.Rect(0, 0, 4, 4), blue))...))
+	return appendPNGChunk(out, "IEND", nil)
+}
+
+// testWebP returns an animated WebP with the same frames as testGIF
+func testWebP(t *testing.T) []byte {
+	anmf := func(rect image.Rectangle, c color.NRGBA, flags byte) webpChunk {
+		var buf bytes.Buffer
+		if err := EncodeWebP(&buf, solid(image.Rect(0, 0, rect.Dx(), rect.Dy()), c), 100, WebPOptions{Lossless: true}); err != nil {
+			t.Fatal(err)
+		}
+		chunks, err := readWebPChunks(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := make([]byte, 16)
+		putUint24(header, rect.Min.X/2)
+		putUint24(header[3:], rect.Min.Y/2)
+		putUint24(header[6:], rect.Dx()-1)
+		putUint24(header[9:], rect.Dy()-1)
+		putUint24(header[12:], 100)
+		header[15] = flags
+		data := header
+		for _, c := range chunks {
+			data = append(data, writeWebPChunks([]webpChunk{c})[12:]...)
+		}
+		return webpChunk{"ANMF", data}
+	}
+	vp8x := make([]byte, 10)
+	vp8x[0] = 0x02 | 0x10 // Animation and alpha
+	putUint24(vp8x[4:], 7)
+	putUint24(vp8x[7:], 7)
+	return writeWebPChunks([]webpChunk{
+		{"VP8X", vp8x},
+		{"ANIM", make([]byte, 6)},
+		anmf(image.Rect(0, 0, 8, 8), red, 0x02),
+		anmf(image.Rect(0, 0, 4, 4), green, 0x01),
+		anmf(image.Rect(4, 4, 8, 8), blue, 0),
+	})
+}
+
+func TestDecodeFrame(t *testing.T) {
+	transparent := color.NRGBA{}
+	for format, data := range map[string][]byte{"gif": testGIF(t), "png": testAPNG(t), "webp": testWebP(t)} {
+		// Pixels at (1,1), in the green square, and (6,6), in the blue one
+		for _, test := range []struct {
+			frame           int
+			inGreen, inBlue color.NRGBA
+		}{
+			{1, red, red},
+			{2, green, red},
+			{FrameMiddle, green, red},
+			{3, transparent, blue},
+			{FrameLast, transparent, blue},
+		} {
+			img, err := DecodeFrame(data, format, test.frame)
+			if err != nil {
+				t.Fatalf("%s: failed to decode frame %d: %v", format, test.frame, err)
+			}
+			if img.Bounds() != image.Rect(0, 0, 8, 8) {
+				t.Errorf("%s: expected the full canvas, got %v", format, img.Bounds())
+			}
+			if c := img.NRGBAAt(1, 1); c != test.inGreen {
+				t.Errorf("%s: frame %d: expected %v at (1,1), got %v", format, test.frame, test.inGreen, c)
+			}
+			if c := img.NRGBAAt(6, 6); c != test.inBlue {
+				t.Errorf("%s: frame %d: expected %v at (6,6), got %v", format, test.frame, test.inBlue, c)
+			}
+		}
+		if _, err := DecodeFrame(data, format, 4); err == nil {
+			t.Errorf("%s: expected an error for a frame out of range", format)
+		}
+	}
+
+	// A still PNG is its only frame
+	var buf bytes.Buffer
+	png.Encode(&buf, solid(image.Rect(0, 0, 2, 2), blue))
+	if img, err := DecodeFrame(buf.Bytes(), "png", FrameMiddle); err != nil || img.NRGBAAt(0, 0) != blue {
+		t.Errorf("Expected the still image, got %v", err)
+	}
+	if _, err := DecodeFrame(buf.Bytes(), "png", 2); err == nil {
+		t.Error("Expected an error for frame 2 of a still image")
+	}
+}
+
+func TestParseFrame(t *testing.T) {
+	for s, want := range map[string]int{"first": 1, "Middle": FrameMiddle, "last": FrameLast, "12": 12} {
+		if n, err := ParseFrame(s); err != nil || n != want {
+			t.Errorf("%s: expected %d, got %d (%v)", s, want, n, err)
+		}
+	}
+	for _, s := range []string{"0", "-1", "mid"} {
+		if _, err := ParseFrame(s); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
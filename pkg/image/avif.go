@@ -0,0 +1,123 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+
+	"github.com/gen2brain/avif"
+)
+
+// Chroma subsampling of AVIF output
+const (
+	AVIFChroma420 = "420" // Color at half the width and height
+	AVIFChroma422 = "422" // Color at half the width
+	AVIFChroma444 = "444" // Color at full resolution
+)
+
+// DefaultAVIFSpeed is the encoder speed used when AVIFOptions.Speed is 0
+const DefaultAVIFSpeed = 8
+
+// AVIFOptions controls AVIF output beyond ProcessOptions.Quality
+type AVIFOptions struct {
+	Speed        int    // Encoder speed from 1 (slowest, smallest files) to 10 (fastest); 0 uses DefaultAVIFSpeed
+	Chroma       string // Chroma subsampling (AVIFChroma420, AVIFChroma422 or AVIFChroma444); empty uses 4:2:0
+	AlphaQuality int    // Quality of the alpha channel from 1 to 100; 0 uses the image quality
+	Lossless     bool   // Encode at quality 100 with full-resolution color; colors still round through YCbCr
+	Color        string // Color space label (AVIFColorSRGB or AVIFColorKeep); empty is sRGB (see KeepColor)
+	CICP         *CICP  // Color space the output is labeled with instead of sRGB; set by KeepColor
+	Threads      int    // CPUs the system libavif may encode on, on Linux; 0 is all. The built-in encoder runs on one.
+}
+
+// EncodeAVIF writes img as an AVIF at a quality from 1 to 100 with options
+func EncodeAVIF(w io.Writer, img image.Image, quality int, options AVIFOptions) error {
+	if options.Speed < 0 || options.Speed > 10 {
+		return fmt.Errorf("invalid AVIF speed: %d (expected 1-10)", options.Speed)
+	}
+	if options.AlphaQuality < 0 || options.AlphaQuality > 100 {
+		return fmt.Errorf("invalid AVIF alpha quality: %d (expected 1-100, or 0 for the image quality)", options.AlphaQuality)
+	}
+	if writeOptions.Reproducible && avif.Dynamic() == nil {
+		// libavif encodes on every CPU, and its output depends on how many
+		return withKind(ErrUnsupportedFormat, errors.New("AVIF output is not reproducible with the system libavif: build nim with -tags nodynamic"))
+	}
+
+	encoder := avif.Options{
+		Quality:      quality,
+		QualityAlpha: options.AlphaQuality,
+		Speed:        options.Speed,
+	}
+	switch options.Chroma {
+	case "", AVIFChroma420:
+		encoder.ChromaSubsampling = image.YCbCrSubsampleRatio420
+	case AVIFChroma422:
+		encoder.ChromaSubsampling = image.YCbCrSubsampleRatio422
+	case AVIFChroma444:
+		encoder.ChromaSubsampling = image.YCbCrSubsampleRatio444
+	default:
+		return fmt.Errorf("invalid AVIF chroma subsampling: %s (expected 420, 422, or 444)", options.Chroma)
+	}
+	if encoder.Speed == 0 {
+		encoder.Speed = DefaultAVIFSpeed
+	}
+	if encoder.QualityAlpha == 0 {
+		encoder.QualityAlpha = quality
+	}
+	if options.Lossless {
+		encoder.Quality, encoder.QualityAlpha = 100, 100
+		encoder.ChromaSubsampling = image.YCbCrSubsampleRatio444
+	}
+	if options.Threads < 0 {
+		return fmt.Errorf("invalid AVIF thread count: %d (expected 0 or more)", options.Threads)
+	}
+	encode := func(w io.Writer) error {
+		if options.Threads == 0 || avif.Dynamic() != nil {
+			return avif.Encode(w, img, encoder)
+		}
+		return onCPUs(options.Threads, func() error { return avif.Encode(w, img, encoder) })
+	}
+	if options.CICP == nil {
+		return encode(w)
+	}
+
+	// The encoder labels its output sRGB, so the label is replaced after
+	var buf bytes.Buffer
+	if err := encode(&buf); err != nil {
+		return err
+	}
+	data, err := SetCICP(buf.Bytes(), *options.CICP)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// KeepColor prepares options for writing an image decoded from inputPath to
+// outputPath. With AVIFColorKeep, AVIF output is labeled with the color
+// space of an AVIF or HEIF input, such as BT.2020 primaries with the PQ or
+// HLG transfer of HDR photos; the pixels pass through unchanged, at 8 bits.
+// Otherwise a wide-gamut or HDR input is written as if it were sRGB, which
+// is logged as a warning.
+func KeepColor(inputPath, outputPath string, options ProcessOptions) (ProcessOptions, error) {
+	switch options.AVIF.Color {
+	case "", AVIFColorSRGB, AVIFColorKeep:
+	default:
+		return options, fmt.Errorf("invalid AVIF color space: %s (expected srgb or keep)", options.AVIF.Color)
+	}
+	c, ok := ReadCICP(inputPath)
+	if !ok || !c.HDR() && !c.WideGamut() {
+		return options, nil
+	}
+	if options.AVIF.Color == AVIFColorKeep && outputFormat(outputPath, options) == "avif" {
+		options.AVIF.CICP = &c
+		slog.Info("keeping color space", "file", inputPath, "cicp", c.String())
+		return options, nil
+	}
+	slog.Warn("wide-gamut or HDR input written as sRGB; write AVIF with --avif-color keep to keep its color space",
+		"file", inputPath, "cicp", c.String())
+	return options, nil
+}
@@ -0,0 +1,74 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/gen2brain/avif"
+	"nim/pkg/compare"
+)
+
+// encodeAVIF encodes img and decodes the result, returning it with the size
+// of the file
+func encodeAVIF(t *testing.T, img image.Image, quality int, options AVIFOptions) (image.Image, int) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := EncodeAVIF(&buf, img, quality, options); err != nil {
+		t.Fatalf("%+v: encode failed: %v", options, err)
+	}
+	size := buf.Len()
+	decoded, err := avif.Decode(&buf)
+	if err != nil {
+		t.Fatalf("%+v: decode failed: %v", options, err)
+	}
+	return decoded, size
+}
+
+func TestEncodeAVIFOptions(t *testing.T) {
+	img := noise(64, 64)
+
+	_, sub := encodeAVIF(t, img, 60, AVIFOptions{Chroma: AVIFChroma420})
+	_, full := encodeAVIF(t, img, 60, AVIFOptions{Chroma: AVIFChroma444})
+	if sub >= full {
+		t.Errorf("4:2:0 gives %d bytes, 4:4:4 gives %d", sub, full)
+	}
+	for _, speed := range []int{1, 10} {
+		if decoded, _ := encodeAVIF(t, img, 60, AVIFOptions{Speed: speed}); decoded.Bounds() != img.Bounds() {
+			t.Errorf("speed %d: decoded as %v", speed, decoded.Bounds())
+		}
+	}
+
+	for _, options := range []AVIFOptions{{Speed: 11}, {Chroma: "411"}, {AlphaQuality: 101}} {
+		if err := EncodeAVIF(&bytes.Buffer{}, img, 60, options); err == nil {
+			t.Errorf("%+v: expected an error", options)
+		}
+	}
+}
+
+func TestEncodeAVIFAlphaQuality(t *testing.T) {
+	img := noise(64, 64)
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			c := img.NRGBAAt(x, y)
+			c.A = c.G
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	_, low := encodeAVIF(t, img, 60, AVIFOptions{AlphaQuality: 10})
+	_, high := encodeAVIF(t, img, 60, AVIFOptions{AlphaQuality: 100})
+	if low >= high {
+		t.Errorf("alpha quality 10 gives %d bytes, 100 gives %d", low, high)
+	}
+}
+
+func TestEncodeAVIFLossless(t *testing.T) {
+	img := gradient(64, 48)
+	lossy, _ := encodeAVIF(t, img, 30, AVIFOptions{})
+	lossless, _ := encodeAVIF(t, img, 30, AVIFOptions{Lossless: true})
+	a, _ := compare.Compare(img, lossy)
+	b, _ := compare.Compare(img, lossless)
+	if b.PSNR <= a.PSNR || b.PSNR < 40 {
+		t.Errorf("lossless PSNR %.1f dB, quality 30 %.1f dB", b.PSNR, a.PSNR)
+	}
+}
@@ -0,0 +1,547 @@
+package image
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// avifAlphaURN is the type of the auxiliary images and tracks that hold alpha
+const avifAlphaURN = "urn:mpeg:mpegB:cicp:systems:auxiliary:alpha"
+
+// avifItem is an image item of a still AVIF: its AV1 data and its property
+// boxes, such as av1C and colr
+type avifItem struct {
+	data       []byte
+	properties [][]byte
+	essential  []bool
+}
+
+// property returns the property box of a type, or nil
+func (item avifItem) property(kind string) []byte {
+	for _, p := range item.properties {
+		if string(p[4:8]) == kind {
+			return p
+		}
+	}
+	return nil
+}
+
+// avifStill is a still AVIF split into its color image and, if it has
+// transparency, its alpha image
+type avifStill struct {
+	color avifItem
+	alpha *avifItem
+}
+
+// eachBox calls fn with the type, the whole box and the contents of each ISO
+// base media box in data, until fn returns false. Boxes with a 64-bit or open
+// size are left out, as AVIF encoders do not write them in metadata.
+func eachBox(data []byte, fn func(kind string, box, body []byte) bool) {
+	for len(data) >= 8 {
+		size := int(binary.BigEndian.Uint32(data))
+		if size < 8 || size > len(data) {
+			return
+		}
+		if !fn(string(data[4:8]), data[:size], data[8:size]) {
+			return
+		}
+		data = data[size:]
+	}
+}
+
+// readAVIFStill splits a still AVIF into its color and alpha images
+func readAVIFStill(data []byte) (avifStill, error) {
+	var meta []byte
+	eachBox(data, func(kind string, box, body []byte) bool {
+		if kind == "meta" && len(body) >= 4 {
+			// meta is a full box, with a version and flags before its children
+			meta = body[4:]
+			return false
+		}
+		return true
+	})
+	if meta == nil {
+		return avifStill{}, fmt.Errorf("the AVIF has no meta box")
+	}
+
+	var primary, alpha uint32
+	var locations map[uint32][]byte
+	var properties [][]byte
+	associations := map[uint32][]uint16{}
+	var err error
+	eachBox(meta, func(kind string, box, body []byte) bool {
+		if len(body) < 4 {
+			return true
+		}
+		version := body[0]
+		switch kind {
+		case "pitm":
+			primary, _ = readItemID(body[4:], version)
+		case "iloc":
+			locations, err = readItemLocations(body, data)
+		case "iprp":
+			eachBox(body, func(kind string, box, body []byte) bool {
+				switch kind {
+				case "ipco":
+					eachBox(body, func(kind string, box, body []byte) bool {
+						properties = append(properties, box)
+						return true
+					})
+				case "ipma":
+					readItemProperties(body, associations)
+				}
+				return true
+			})
+		case "iref":
+			// The alpha image refers to the color image it belongs to
+			eachBox(body[4:], func(kind string, box, body []byte) bool {
+				if kind == "auxl" {
+					alpha, _ = readItemID(body, version)
+				}
+				return true
+			})
+		}
+		return err == nil
+	})
+	if err != nil {
+		return avifStill{}, err
+	}
+
+	item := func(id uint32) (avifItem, error) {
+		data, ok := locations[id]
+		if !ok {
+			return avifItem{}, fmt.Errorf("the AVIF has no data for item %d", id)
+		}
+		item := avifItem{data: data}
+		for _, index := range associations[id] {
+			i := int(index&0x7fff) - 1
+			if i < 0 || i >= len(properties) {
+				return avifItem{}, fmt.Errorf("invalid AVIF property index %d", i+1)
+			}
+			item.properties = append(item.properties, properties[i])
+			item.essential = append(item.essential, index&0x8000 != 0)
+		}
+		if item.property("av1C") == nil || item.property("ispe") == nil {
+			return avifItem{}, fmt.Errorf("the AVIF image has no av1C or ispe property")
+		}
+		return item, nil
+	}
+	var still avifStill
+	if still.color, err = item(primary); err != nil {
+		return avifStill{}, err
+	}
+	if alpha != 0 {
+		a, err := item(alpha)
+		if err != nil {
+			return avifStill{}, err
+		}
+		still.alpha = &a
+	}
+	return still, nil
+}
+
+// readItemID reads an item ID of 16 bits in version 0 boxes and 32 bits in
+// later versions
+func readItemID(b []byte, version byte) (uint32, int) {
+	if version == 0 && len(b) >= 2 {
+		return uint32(binary.BigEndian.Uint16(b)), 2
+	}
+	if version > 0 && len(b) >= 4 {
+		return binary.BigEndian.Uint32(b), 4
+	}
+	return 0, len(b)
+}
+
+// readItemLocations reads an iloc box, returning the data of each item in
+// file
+func readItemLocations(body, file []byte) (map[uint32][]byte, error) {
+	invalid := fmt.Errorf("invalid AVIF item locations")
+	if len(body) < 8 {
+		return nil, invalid
+	}
+	version := body[0]
+	offsetSize, lengthSize := int(body[4]>>4), int(body[4]&0x0f)
+	baseSize, indexSize := int(body[5]>>4), int(body[5]&0x0f)
+	if version == 0 {
+		indexSize = 0
+	}
+	pos := 6
+	read := func(size int) (uint64, bool) {
+		if pos+size > len(body) {
+			return 0, false
+		}
+		var v uint64
+		for _, b := range body[pos : pos+size] {
+			v = v<<8 | uint64(b)
+		}
+		pos += size
+		return v, true
+	}
+	countSize, idSize := 2, 2
+	if version == 2 {
+		countSize, idSize = 4, 4
+	}
+	count, ok := read(countSize)
+	if !ok {
+		return nil, invalid
+	}
+	locations := map[uint32][]byte{}
+	for range count {
+		id, ok := read(idSize)
+		if !ok {
+			return nil, invalid
+		}
+		if version > 0 {
+			method, ok := read(2)
+			if !ok {
+				return nil, invalid
+			}
+			if method&0x0f != 0 {
+				return nil, fmt.Errorf("AVIF items stored in the metadata are not supported")
+			}
+		}
+		_, ok1 := read(2) // Data reference index
+		base, ok2 := read(baseSize)
+		extents, ok3 := read(2)
+		if !ok1 || !ok2 || !ok3 {
+			return nil, invalid
+		}
+		var data []byte
+		for range extents {
+			_, ok1 := read(indexSize)
+			offset, ok2 := read(offsetSize)
+			length, ok3 := read(lengthSize)
+			start := base + offset
+			if !ok1 || !ok2 || !ok3 || start > uint64(len(file)) || length > uint64(len(file))-start {
+				return nil, invalid
+			}
+			if length == 0 {
+				length = uint64(len(file)) - start
+			}
+			data = append(data, file[start:start+length]...)
+		}
+		locations[uint32(id)] = data
+	}
+	return locations, nil
+}
+
+// readItemProperties reads an ipma box into the property indexes of each
+// item, with the essential flag in the top bit
+func readItemProperties(body []byte, associations map[uint32][]uint16) {
+	if len(body) < 8 {
+		return
+	}
+	version, wide := body[0], body[3]&1 != 0
+	count := int(binary.BigEndian.Uint32(body[4:]))
+	b := body[8:]
+	for range count {
+		id, n := readItemID(b, min(version, 1))
+		b = b[n:]
+		if len(b) < 1 {
+			return
+		}
+		entries := int(b[0])
+		b = b[1:]
+		for range entries {
+			var index uint16
+			if wide {
+				if len(b) < 2 {
+					return
+				}
+				index, b = binary.BigEndian.Uint16(b), b[2:]
+			} else {
+				if len(b) < 1 {
+					return
+				}
+				index, b = uint16(b[0]&0x80)<<8|uint16(b[0]&0x7f), b[1:]
+			}
+			associations[id] = append(associations[id], index)
+		}
+	}
+}
+
+// appendBox appends an ISO base media box of a type with contents
+func appendBox(b []byte, kind string, contents ...[]byte) []byte {
+	size := 8
+	for _, c := range contents {
+		size += len(c)
+	}
+	b = binary.BigEndian.AppendUint32(b, uint32(size))
+	b = append(b, kind...)
+	for _, c := range contents {
+		b = append(b, c...)
+	}
+	return b
+}
+
+// fullBox returns the version and flags that start a full box
+func fullBox(version byte, flags uint32) []byte {
+	return []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+}
+
+// avisTimescale is the number of ticks per second of AVIF image sequences
+const avisTimescale = 1000
+
+// muxAVIS joins still AVIF frames, each shown for its delay, into an AVIF
+// image sequence that plays loops times, or forever for 0. The frames must
+// have the same size and settings. The first frame is also the still image
+// of the file, for viewers without animation.
+func muxAVIS(frames []avifStill, delays []time.Duration, loops int) ([]byte, error) {
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("the animation has no frames")
+	}
+	alpha := frames[0].alpha != nil
+	for i, f := range frames {
+		if (f.alpha != nil) != alpha {
+			return nil, fmt.Errorf("frame %d has alpha unlike the first frame, or the other way around", i+1)
+		}
+	}
+	var total uint64
+	ticks := make([]uint32, len(delays))
+	for i, d := range delays {
+		ticks[i] = uint32(max(1, d.Milliseconds()*avisTimescale/1000))
+		total += uint64(ticks[i])
+	}
+
+	ftyp := appendBox(nil, "ftyp", []byte("avis"), make([]byte, 4), []byte("avifavismsf1iso8mif1miaf"))
+
+	// The samples are laid out frame by frame, color then alpha, after the
+	// mdat header; the metadata is built twice, once to learn its size
+	build := func(start uint64) ([]byte, []byte, error) {
+		var colorOffsets, alphaOffsets []uint64
+		offset := start
+		for _, f := range frames {
+			colorOffsets = append(colorOffsets, offset)
+			offset += uint64(len(f.color.data))
+			if alpha {
+				alphaOffsets = append(alphaOffsets, offset)
+				offset += uint64(len(f.alpha.data))
+			}
+		}
+		if offset > 1<<32-1 {
+			return nil, nil, fmt.Errorf("the animation is larger than 4 GB")
+		}
+		meta := avisMeta(frames[0], colorOffsets[0], alphaOffsets)
+		moov := avisMovie(frames, ticks, total, loops, colorOffsets, alphaOffsets)
+		return meta, moov, nil
+	}
+	meta, moov, err := build(0)
+	if err != nil {
+		return nil, err
+	}
+	start := uint64(len(ftyp) + len(meta) + len(moov) + 8)
+	if meta, moov, err = build(start); err != nil {
+		return nil, err
+	}
+
+	out := append(ftyp, meta...)
+	out = append(out, moov...)
+	size := 8
+	for _, f := range frames {
+		size += len(f.color.data)
+		if alpha {
+			size += len(f.alpha.data)
+		}
+	}
+	out = binary.BigEndian.AppendUint32(out, uint32(size))
+	out = append(out, "mdat"...)
+	for _, f := range frames {
+		out = append(out, f.color.data...)
+		if alpha {
+			out = append(out, f.alpha.data...)
+		}
+	}
+	return out, nil
+}
+
+// avisMeta returns the meta box of an image sequence, with the first frame
+// as its primary image and the alpha of the frame, if any, as an auxiliary
+// image. The data of the frame is at the offsets given.
+func avisMeta(first avifStill, colorOffset uint64, alphaOffsets []uint64) []byte {
+	items := []avifItem{first.color}
+	offsets := []uint64{colorOffset}
+	if first.alpha != nil {
+		items = append(items, *first.alpha)
+		offsets = append(offsets, alphaOffsets[0])
+	}
+
+	// iloc version 0 with 4-byte offsets and lengths and no base offset
+	iloc := append(fullBox(0, 0), 0x44, 0x00)
+	iloc = binary.BigEndian.AppendUint16(iloc, uint16(len(items)))
+	iinf := binary.BigEndian.AppendUint16(fullBox(0, 0), uint16(len(items)))
+	var ipco []byte
+	ipma := binary.BigEndian.AppendUint32(fullBox(0, 0), uint32(len(items)))
+	index := 0
+	for i, item := range items {
+		id := uint16(i + 1)
+		iloc = binary.BigEndian.AppendUint16(iloc, id)
+		iloc = append(iloc, 0, 0, 0, 1) // Data reference index and extent count
+		iloc = binary.BigEndian.AppendUint32(iloc, uint32(offsets[i]))
+		iloc = binary.BigEndian.AppendUint32(iloc, uint32(len(item.data)))
+
+		infe := binary.BigEndian.AppendUint16(fullBox(2, 0), id)
+		infe = append(infe, 0, 0) // Protection index
+		infe = append(infe, "av01\x00"...)
+		iinf = appendBox(iinf, "infe", infe)
+
+		ipma = binary.BigEndian.AppendUint16(ipma, id)
+		ipma = append(ipma, byte(len(item.properties)))
+		for j, p := range item.properties {
+			ipco = append(ipco, p...)
+			index++
+			entry := byte(index)
+			if item.essential[j] {
+				entry |= 0x80
+			}
+			ipma = append(ipma, entry)
+		}
+	}
+
+	hdlr := append(fullBox(0, 0), make([]byte, 4)...)
+	hdlr = append(hdlr, "pict"...)
+	hdlr = append(hdlr, make([]byte, 13)...)
+	meta := appendBox(nil, "hdlr", hdlr)
+	meta = appendBox(meta, "pitm", fullBox(0, 0), []byte{0, 1})
+	meta = appendBox(meta, "iloc", iloc)
+	meta = appendBox(meta, "iinf", iinf)
+	if first.alpha != nil {
+		// The alpha image (2) is an auxiliary image of the color image (1)
+		meta = appendBox(meta, "iref", fullBox(0, 0), appendBox(nil, "auxl", []byte{0, 2, 0, 1, 0, 1}))
+	}
+	meta = appendBox(meta, "iprp", appendBox(nil, "ipco", ipco), appendBox(nil, "ipma", ipma))
+	return appendBox(nil, "meta", fullBox(0, 0), meta)
+}
+
+// avisMovie returns the moov box of an image sequence: a track of the color
+// images and, for frames with alpha, a track of the alpha images
+func avisMovie(frames []avifStill, ticks []uint32, total uint64, loops int, colorOffsets, alphaOffsets []uint64) []byte {
+	// Infinite loops have an indefinite duration
+	duration := total * uint64(max(loops, 1))
+	if loops == 0 {
+		duration = 1<<64 - 1
+	}
+	matrix := []byte{0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x40, 0, 0, 0}
+
+	tracks := 1
+	if alphaOffsets != nil {
+		tracks = 2
+	}
+	mvhd := append(fullBox(1, 0), make([]byte, 16)...) // Creation and modification times
+	mvhd = binary.BigEndian.AppendUint32(mvhd, avisTimescale)
+	mvhd = binary.BigEndian.AppendUint64(mvhd, duration)
+	mvhd = append(mvhd, 0, 1, 0, 0, 1, 0) // Rate and volume
+	mvhd = append(mvhd, make([]byte, 10)...)
+	mvhd = append(mvhd, matrix...)
+	mvhd = append(mvhd, make([]byte, 24)...)
+	mvhd = binary.BigEndian.AppendUint32(mvhd, uint32(tracks+1))
+	moov := appendBox(nil, "mvhd", mvhd)
+
+	ispe := frames[0].color.property("ispe")
+	width, height := binary.BigEndian.Uint32(ispe[12:]), binary.BigEndian.Uint32(ispe[16:])
+
+	track := func(id uint32, handler string, items []avifItem, offsets []uint64) []byte {
+		tkhd := append(fullBox(1, 1), make([]byte, 16)...) // Enabled
+		tkhd = binary.BigEndian.AppendUint32(tkhd, id)
+		tkhd = append(tkhd, make([]byte, 4)...)
+		tkhd = binary.BigEndian.AppendUint64(tkhd, duration)
+		tkhd = append(tkhd, make([]byte, 16)...) // Layer, group and volume
+		tkhd = append(tkhd, matrix...)
+		tkhd = binary.BigEndian.AppendUint32(tkhd, width<<16)
+		tkhd = binary.BigEndian.AppendUint32(tkhd, height<<16)
+		trak := appendBox(nil, "tkhd", tkhd)
+		if handler == "auxv" {
+			trak = appendBox(trak, "tref", appendBox(nil, "auxl", []byte{0, 0, 0, 1}))
+		}
+
+		// The edit list repeats the frames unless the animation plays once
+		var repeat uint32
+		if loops != 1 {
+			repeat = 1
+		}
+		elst := append(fullBox(1, repeat), 0, 0, 0, 1)
+		elst = binary.BigEndian.AppendUint64(elst, total)
+		elst = append(elst, make([]byte, 8)...) // Media time
+		elst = append(elst, 0, 1, 0, 0)         // Rate
+		trak = appendBox(trak, "edts", appendBox(nil, "elst", elst))
+
+		mdhd := append(fullBox(1, 0), make([]byte, 16)...)
+		mdhd = binary.BigEndian.AppendUint32(mdhd, avisTimescale)
+		mdhd = binary.BigEndian.AppendUint64(mdhd, total)
+		mdhd = append(mdhd, 0x55, 0xc4, 0, 0) // Undetermined language
+		hdlr := append(fullBox(0, 0), make([]byte, 4)...)
+		hdlr = append(hdlr, handler...)
+		hdlr = append(hdlr, make([]byte, 13)...)
+
+		// The sample entry has the size and the coding settings of the
+		// first frame; every frame is a key frame
+		entry := make([]byte, 6, 78)
+		entry = append(entry, 0, 1) // Data reference index
+		entry = append(entry, make([]byte, 16)...)
+		entry = binary.BigEndian.AppendUint16(entry, uint16(width))
+		entry = binary.BigEndian.AppendUint16(entry, uint16(height))
+		entry = append(entry, 0, 0x48, 0, 0, 0, 0x48, 0, 0) // 72 dpi
+		entry = append(entry, 0, 0, 0, 0, 0, 1)             // Frame count
+		entry = append(entry, make([]byte, 32)...)          // Compressor name
+		entry = append(entry, 0, 0x18, 0xff, 0xff)          // Depth
+		entry = append(entry, items[0].property("av1C")...)
+		if colr := items[0].property("colr"); colr != nil {
+			entry = append(entry, colr...)
+		}
+		// Intra frames only, which refer to no other frame
+		entry = appendBox(entry, "ccst", fullBox(0, 0), []byte{0xc0, 0, 0, 0})
+		if handler == "auxv" {
+			entry = appendBox(entry, "auxi", fullBox(0, 0), []byte(avifAlphaURN+"\x00"))
+		}
+		stsd := appendBox(binary.BigEndian.AppendUint32(fullBox(0, 0), 1), "av01", entry)
+
+		var stts []byte
+		runs := 0
+		for i := 0; i < len(ticks); {
+			j := i
+			for j < len(ticks) && ticks[j] == ticks[i] {
+				j++
+			}
+			stts = binary.BigEndian.AppendUint32(stts, uint32(j-i))
+			stts = binary.BigEndian.AppendUint32(stts, ticks[i])
+			runs++
+			i = j
+		}
+		stsz := append(fullBox(0, 0), make([]byte, 4)...)
+		stsz = binary.BigEndian.AppendUint32(stsz, uint32(len(items)))
+		stco := binary.BigEndian.AppendUint32(fullBox(0, 0), uint32(len(items)))
+		for i, item := range items {
+			stsz = binary.BigEndian.AppendUint32(stsz, uint32(len(item.data)))
+			stco = binary.BigEndian.AppendUint32(stco, uint32(offsets[i]))
+		}
+		stbl := appendBox(nil, "stsd", stsd)
+		stbl = appendBox(stbl, "stts", binary.BigEndian.AppendUint32(fullBox(0, 0), uint32(runs)), stts)
+		stbl = appendBox(stbl, "stsc", fullBox(0, 0), []byte{0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1})
+		stbl = appendBox(stbl, "stsz", stsz)
+		stbl = appendBox(stbl, "stco", stco)
+
+		dref := appendBox(binary.BigEndian.AppendUint32(fullBox(0, 0), 1), "url ", fullBox(0, 1))
+		minf := appendBox(nil, "vmhd", fullBox(0, 1), make([]byte, 8))
+		minf = appendBox(minf, "dinf", appendBox(nil, "dref", dref))
+		minf = appendBox(minf, "stbl", stbl)
+		mdia := appendBox(nil, "mdhd", mdhd)
+		mdia = appendBox(mdia, "hdlr", hdlr)
+		mdia = appendBox(mdia, "minf", minf)
+		trak = appendBox(trak, "mdia", mdia)
+		return appendBox(nil, "trak", trak)
+	}
+
+	colors := make([]avifItem, len(frames))
+	for i, f := range frames {
+		colors[i] = f.color
+	}
+	moov = append(moov, track(1, "pict", colors, colorOffsets)...)
+	if alphaOffsets != nil {
+		alphas := make([]avifItem, len(frames))
+		for i, f := range frames {
+			alphas[i] = *f.alpha
+		}
+		moov = append(moov, track(2, "auxv", alphas, alphaOffsets)...)
+	}
+	return appendBox(nil, "moov", moov)
+}
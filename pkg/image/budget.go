@@ -0,0 +1,150 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+
+	"nim/pkg/resample"
+)
+
+// MinBudgetQuality is the lowest quality FitBytes encodes at; below it, the
+// image is made smaller instead, which looks better than heavy artifacts
+const MinBudgetQuality = 30
+
+// byteUnits are the suffixes ParseByteSize accepts, with their multipliers
+var byteUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	// Longest suffixes first, so "KB" is not read as "B"
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30},
+	{"kb", 1000}, {"mb", 1000 * 1000}, {"gb", 1000 * 1000 * 1000},
+	{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	{"b", 1},
+}
+
+// ParseByteSize parses a size in bytes such as 200KB, 1.5MB or 512KiB. KB, MB
+// and GB are powers of 1000, KiB, MiB and GiB powers of 1024, and a number
+// without a unit is in bytes.
+func ParseByteSize(size string) (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, multiplier = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.multiplier
+			break
+		}
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v <= 0 || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("invalid byte size: %s (expected e.g. 200KB or 1.5MB)", size)
+	}
+	return int64(v * float64(multiplier)), nil
+}
+
+// lossyFormat reports whether format has a quality setting FitBytes can
+// lower, which lossless WebP and AVIF output do not
+func lossyFormat(format string, options ProcessOptions) bool {
+	switch format {
+	case "jpg", "jpeg":
+		return true
+	case "avif":
+		return !options.AVIF.Lossless
+	case "webp":
+		return !options.WebP.lossless()
+	}
+	return false
+}
+
+// countingWriter counts the bytes written to it and discards them
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// encodedSize returns the size of img encoded with options
+func encodedSize(img image.Image, options ProcessOptions) (int64, error) {
+	var w countingWriter
+	if err := Encode(&w, img, options); err != nil {
+		return 0, err
+	}
+	return w.n, nil
+}
+
+// FitBytes makes img encode to at most options.MaxBytes in the format
+// SaveImage would write to outputPath. For JPEG, WebP and AVIF it first
+// searches for the highest quality up to options.Quality that fits; when
+// even MinBudgetQuality is too large, or for lossless formats, the image is
+// scaled down until it fits. It returns the image and options to save with.
+// Options without MaxBytes are returned unchanged.
+func FitBytes(img image.Image, outputPath string, options ProcessOptions) (image.Image, ProcessOptions, error) {
+	if options.MaxBytes <= 0 {
+		return img, options, nil
+	}
+	options.OutputFormat = outputFormat(outputPath, options)
+	lossy := lossyFormat(options.OutputFormat, options)
+	if options.Quality <= 0 || options.Quality > 100 {
+		options.Quality = 100
+	}
+	lowest := options.Quality
+	if lossy {
+		lowest = min(MinBudgetQuality, options.Quality)
+	}
+
+	for {
+		// Binary search for the highest quality that fits
+		size, err := encodedSize(img, options)
+		if err != nil {
+			return nil, options, err
+		}
+		if size <= options.MaxBytes {
+			return img, options, nil
+		}
+		low, high := lowest, options.Quality-1
+		best := 0
+		for low <= high {
+			quality := (low + high) / 2
+			trial := options
+			trial.Quality = quality
+			if size, err = encodedSize(img, trial); err != nil {
+				return nil, options, err
+			}
+			if size <= options.MaxBytes {
+				best, low = quality, quality+1
+			} else {
+				high = quality - 1
+			}
+		}
+		if best > 0 {
+			options.Quality = best
+			slog.Info("fitted output to byte budget", "max_bytes", options.MaxBytes, "quality", best,
+				"size", fmt.Sprintf("%dx%d", img.Bounds().Dx(), img.Bounds().Dy()))
+			return img, options, nil
+		}
+
+		// Too large even at the lowest quality: shrink the area in proportion
+		// to the overshoot, a little more so the next round is likely to fit
+		smallest := options
+		smallest.Quality = lowest
+		if size, err = encodedSize(img, smallest); err != nil {
+			return nil, options, err
+		}
+		scale := min(0.9, math.Sqrt(float64(options.MaxBytes)/float64(size))*0.95)
+		w := int(float64(img.Bounds().Dx()) * scale)
+		h := int(float64(img.Bounds().Dy()) * scale)
+		if w < 1 || h < 1 {
+			return nil, options, fmt.Errorf("cannot encode image in %d bytes as %s", options.MaxBytes, options.OutputFormat)
+		}
+		slog.Debug("scaling down to fit byte budget", "max_bytes", options.MaxBytes, "bytes", size, "to", fmt.Sprintf("%dx%d", w, h))
+		img = resample.Resize(img, w, h)
+	}
+}
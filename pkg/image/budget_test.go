@@ -0,0 +1,111 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"math/rand"
+	"testing"
+)
+
+// noise returns an image of random pixels, which compresses poorly
+func noise(w, h int) *image.NRGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rng.Intn(256))
+		if i%4 == 3 {
+			img.Pix[i] = 255
+		}
+	}
+	return img
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"200KB":   200000,
+		"200 kb":  200000,
+		"1.5MB":   1500000,
+		"512KiB":  512 * 1024,
+		"2MiB":    2 << 20,
+		"1G":      1000000000,
+		"4096":    4096,
+		"100B":    100,
+		"250k":    250000,
+		" 3 MB ":  3000000,
+		"0.5 KiB": 512,
+	}
+	for input, expected := range tests {
+		got, err := ParseByteSize(input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", input, err)
+		} else if got != expected {
+			t.Errorf("%q: expected %d, got %d", input, expected, got)
+		}
+	}
+
+	for _, input := range []string{"", "KB", "-1KB", "0", "ten", "5 TB"} {
+		if _, err := ParseByteSize(input); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+func TestFitBytes(t *testing.T) {
+	img := noise(128, 128)
+	options := DefaultOptions()
+
+	full, err := encodedSize(img, ProcessOptions{OutputFormat: "jpg", Quality: 85})
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	// Without a budget nothing changes
+	fitted, fittedOptions, err := FitBytes(img, "out.jpg", options)
+	if err != nil || fitted != image.Image(img) || fittedOptions.Quality != 85 {
+		t.Errorf("Expected the image and options unchanged without MaxBytes")
+	}
+
+	// A budget met by lowering the quality keeps the size
+	options.MaxBytes = full * 3 / 4
+	fitted, fittedOptions, err = FitBytes(img, "out.jpg", options)
+	if err != nil {
+		t.Fatalf("FitBytes failed: %v", err)
+	}
+	if fitted.Bounds().Dx() != 128 || fittedOptions.Quality >= 85 || fittedOptions.Quality < MinBudgetQuality {
+		t.Errorf("Expected a lower quality at full size, got quality %d at %v", fittedOptions.Quality, fitted.Bounds())
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, fitted, fittedOptions); err != nil || int64(buf.Len()) > options.MaxBytes {
+		t.Errorf("Expected at most %d bytes, got %d (%v)", options.MaxBytes, buf.Len(), err)
+	}
+
+	// A tight budget also shrinks the image
+	options.MaxBytes = 3000
+	fitted, fittedOptions, err = FitBytes(img, "out.jpg", options)
+	if err != nil {
+		t.Fatalf("FitBytes failed: %v", err)
+	}
+	buf.Reset()
+	if err := Encode(&buf, fitted, fittedOptions); err != nil || int64(buf.Len()) > options.MaxBytes {
+		t.Errorf("Expected at most %d bytes, got %d (%v)", options.MaxBytes, buf.Len(), err)
+	}
+	if fitted.Bounds().Dx() >= 128 {
+		t.Errorf("Expected a smaller image, got %v", fitted.Bounds())
+	}
+
+	// Lossless formats are only scaled
+	options.MaxBytes = 20000
+	fitted, fittedOptions, err = FitBytes(img, "out.png", options)
+	if err != nil {
+		t.Fatalf("FitBytes failed: %v", err)
+	}
+	if fittedOptions.OutputFormat != "png" || fitted.Bounds().Dx() >= 128 {
+		t.Errorf("Expected a smaller PNG, got %s at %v", fittedOptions.OutputFormat, fitted.Bounds())
+	}
+
+	// Budgets no image fits in fail
+	options.MaxBytes = 10
+	if _, _, err := FitBytes(image.NewNRGBA(image.Rect(0, 0, 4, 4)), "out.png", options); err == nil {
+		t.Errorf("Expected an error for an impossible budget")
+	}
+}
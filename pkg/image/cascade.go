@@ -0,0 +1,124 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"log/slog"
+	"math"
+	"slices"
+
+	"github.com/disintegration/imaging"
+	"nim/pkg/resample"
+)
+
+// cascadeRatio is how much larger than a target an intermediate resize has
+// to be to stand in for the source. The Lanczos filter spans three source
+// pixels on each side, so shrinking by at least 2x from an intermediate is
+// visually the same as shrinking from the source.
+const cascadeRatio = 2
+
+// Cascade resizes one decoded source to several smaller sizes, reusing
+// earlier resizes as the source of later ones. Resizing largest to smallest
+// makes each step shrink an image only a few times larger than its output,
+// instead of the full source every time.
+type Cascade struct {
+	src     image.Image
+	resized []*image.NRGBA
+}
+
+// NewCascade returns a cascade of resizes of src
+func NewCascade(src image.Image) *Cascade {
+	return &Cascade{src: src}
+}
+
+// Resize resizes the source to width x height, where 0 keeps the aspect
+// ratio of the source, like resample.Resize
+func (c *Cascade) Resize(width, height int) *image.NRGBA {
+	srcW, srcH := c.src.Bounds().Dx(), c.src.Bounds().Dy()
+	if width < 0 || height < 0 || width == 0 && height == 0 || srcW <= 0 || srcH <= 0 {
+		return &image.NRGBA{}
+	}
+	// Sizes follow the source aspect ratio, not an intermediate one
+	if width == 0 {
+		width = int(math.Max(1, math.Floor(float64(height)*float64(srcW)/float64(srcH)+0.5)))
+	}
+	if height == 0 {
+		height = int(math.Max(1, math.Floor(float64(width)*float64(srcH)/float64(srcW)+0.5)))
+	}
+
+	resized := resample.Resize(c.source(width, height), width, height)
+	if width < srcW && height < srcH {
+		c.resized = append(c.resized, resized)
+	}
+	return resized
+}
+
+// Fit shrinks the source to fit in width x height, like resample.Fit
+func (c *Cascade) Fit(width, height int) *image.NRGBA {
+	srcW, srcH := c.src.Bounds().Dx(), c.src.Bounds().Dy()
+	if width <= 0 || height <= 0 || srcW <= 0 || srcH <= 0 {
+		return &image.NRGBA{}
+	}
+	if srcW <= width && srcH <= height {
+		return imaging.Clone(c.src)
+	}
+	if float64(srcW)/float64(srcH) > float64(width)/float64(height) {
+		return c.Resize(width, int(float64(width)/(float64(srcW)/float64(srcH))))
+	}
+	return c.Resize(int(float64(height)*(float64(srcW)/float64(srcH))), height)
+}
+
+// IconFrame is IconFrame of the source, resized through the cascade
+func (c *Cascade) IconFrame(size int) *image.NRGBA {
+	bounds := c.src.Bounds()
+	if bounds.Dx() == size && bounds.Dy() == size {
+		return imaging.Clone(c.src)
+	}
+	resized := c.Fit(size, size)
+	if bounds.Dx() < size && bounds.Dy() < size {
+		// Fit never enlarges, so scale small sources up explicitly
+		if bounds.Dx() >= bounds.Dy() {
+			resized = c.Resize(size, 0)
+		} else {
+			resized = c.Resize(0, size)
+		}
+	}
+	return imaging.PasteCenter(imaging.New(size, size, color.Transparent), resized)
+}
+
+// PaddedIconFrame is PaddedIconFrame of the source, resized through the
+// cascade
+func (c *Cascade) PaddedIconFrame(size int, padding float64, background color.Color) *image.NRGBA {
+	inner := max(int(math.Round(float64(size)*(1-2*padding))), 1)
+	return imaging.OverlayCenter(imaging.New(size, size, background), c.IconFrame(inner), 1)
+}
+
+// source returns the smallest earlier resize at least cascadeRatio times
+// width x height, or the source if there is none
+func (c *Cascade) source(width, height int) image.Image {
+	var best *image.NRGBA
+	for _, img := range c.resized {
+		w, h := img.Bounds().Dx(), img.Bounds().Dy()
+		if w >= cascadeRatio*width && h >= cascadeRatio*height && (best == nil || w < best.Bounds().Dx()) {
+			best = img
+		}
+	}
+	if best == nil {
+		return c.src
+	}
+	slog.Debug("resizing from intermediate", "from", best.Bounds().Size(), "to", image.Pt(width, height))
+	return best
+}
+
+// Descending returns the indexes of sizes from the largest size to the
+// smallest, the order to resize them in through a cascade
+func Descending(sizes []int) []int {
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return sizes[b] - sizes[a]
+	})
+	return order
+}
@@ -0,0 +1,65 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+
+	"nim/pkg/compare"
+	"nim/pkg/resample"
+)
+
+func TestCascade(t *testing.T) {
+	src := gradient(800, 600)
+	cascade := NewCascade(src)
+	for _, width := range []int{640, 320, 160, 100, 40} {
+		got := cascade.Resize(width, 0)
+		expected := resample.Resize(src, width, 0)
+		if got.Rect != expected.Rect {
+			t.Fatalf("%dw: size %v, expected %v", width, got.Rect, expected.Rect)
+		}
+		if result, _ := compare.Compare(expected, got); result.PSNR < 35 {
+			t.Errorf("%dw: PSNR %.1f dB against resizing the source", width, result.PSNR)
+		}
+	}
+	// Later sizes resize from the smallest earlier one at least twice as large
+	if from := cascade.source(150, 100); from.Bounds().Dx() != 320 {
+		t.Errorf("150x100 resizes from %v, expected the 320px intermediate", from.Bounds())
+	}
+	if from := cascade.source(700, 500); from != image.Image(src) {
+		t.Errorf("700x500 resizes from %v, expected the source", from.Bounds())
+	}
+	// Enlargements never become sources
+	enlarged := NewCascade(src)
+	enlarged.Resize(1600, 0)
+	if len(enlarged.resized) != 0 {
+		t.Error("expected no intermediates")
+	}
+}
+
+func TestCascadeIconFrame(t *testing.T) {
+	src := gradient(300, 200)
+	cascade := NewCascade(src)
+	for _, size := range []int{256, 64, 16} {
+		got := cascade.IconFrame(size)
+		expected := IconFrame(src, size)
+		if got.Rect != expected.Rect {
+			t.Fatalf("%d: size %v, expected %v", size, got.Rect, expected.Rect)
+		}
+		if result, _ := compare.Compare(expected, got); result.PSNR < 30 {
+			t.Errorf("%d: PSNR %.1f dB against resizing the source", size, result.PSNR)
+		}
+	}
+	// Padding is left in the background color
+	padded := cascade.PaddedIconFrame(100, 0.1, color.White)
+	if c := padded.NRGBAAt(2, 50); c != (color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("padding is %v", c)
+	}
+}
+
+func TestDescending(t *testing.T) {
+	if got := Descending([]int{320, 1280, 640, 1280}); !slices.Equal(got, []int{1, 3, 2, 0}) {
+		t.Errorf("got %v", got)
+	}
+}
@@ -0,0 +1,161 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CICP are the coding-independent code points of ITU-T H.273 that describe
+// the color space of an image. AVIF and HEIF files store them in an nclx
+// color box.
+type CICP struct {
+	Primaries uint16 // Color primaries, such as CICPPrimariesBT2020
+	Transfer  uint16 // Transfer characteristics, such as CICPTransferPQ
+	Matrix    uint16 // Matrix coefficients between RGB and YCbCr
+	FullRange bool   // Whether YCbCr values use the full range instead of the video range
+}
+
+// Code points of the color spaces nim reports
+const (
+	CICPPrimariesBT709  = 1  // sRGB and HD video
+	CICPPrimariesBT2020 = 9  // Wide gamut of UHD and HDR video
+	CICPPrimariesP3     = 12 // Display P3
+	CICPTransferSRGB    = 13 // The sRGB curve
+	CICPTransferPQ      = 16 // Perceptual quantizer (SMPTE ST 2084) of HDR10
+	CICPTransferHLG     = 18 // Hybrid log-gamma of HDR broadcasts
+)
+
+// Color spaces of AVIF output (see AVIFOptions.Color)
+const (
+	// AVIFColorSRGB labels AVIF output as sRGB
+	AVIFColorSRGB = "srgb"
+	// AVIFColorKeep labels AVIF output with the primaries and transfer of an
+	// AVIF or HEIF input, so wide-gamut and HDR pixels are shown as they were
+	AVIFColorKeep = "keep"
+)
+
+// HDR reports whether c has an HDR transfer, PQ or HLG
+func (c CICP) HDR() bool {
+	return c.Transfer == CICPTransferPQ || c.Transfer == CICPTransferHLG
+}
+
+// WideGamut reports whether c has primaries wider than sRGB
+func (c CICP) WideGamut() bool {
+	return c.Primaries == CICPPrimariesBT2020 || c.Primaries == CICPPrimariesP3
+}
+
+// String returns c as PRIMARIES/TRANSFER/MATRIX, with the names of the code
+// points nim knows
+func (c CICP) String() string {
+	name := func(v uint16, names map[uint16]string) string {
+		if n, ok := names[v]; ok {
+			return n
+		}
+		return fmt.Sprint(v)
+	}
+	primaries := map[uint16]string{CICPPrimariesBT709: "bt709", CICPPrimariesBT2020: "bt2020", CICPPrimariesP3: "p3"}
+	transfers := map[uint16]string{CICPTransferSRGB: "srgb", CICPTransferPQ: "pq", CICPTransferHLG: "hlg"}
+	return fmt.Sprintf("%s/%s/%d", name(c.Primaries, primaries), name(c.Transfer, transfers), c.Matrix)
+}
+
+// ReadCICP reads the color space of an AVIF or HEIF file. It returns false
+// for other files, and for files without an nclx color box, such as those
+// with only an ICC profile.
+func ReadCICP(path string) (CICP, bool) {
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")) {
+	case "avif", "heic", "heif":
+	default:
+		return CICP{}, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return CICP{}, false
+	}
+	body := nclxBox(data)
+	if body == nil {
+		return CICP{}, false
+	}
+	return CICP{
+		Primaries: binary.BigEndian.Uint16(body[4:]),
+		Transfer:  binary.BigEndian.Uint16(body[6:]),
+		Matrix:    binary.BigEndian.Uint16(body[8:]),
+		FullRange: body[10]&0x80 != 0,
+	}, true
+}
+
+// SetCICP returns a copy of an AVIF file labeled with the primaries and
+// transfer of c. The matrix and range are kept, since they describe how the
+// encoder stored the pixels.
+func SetCICP(data []byte, c CICP) ([]byte, error) {
+	out := bytes.Clone(data)
+	body := nclxBox(out)
+	if body == nil {
+		return nil, fmt.Errorf("the AVIF has no nclx color box")
+	}
+	binary.BigEndian.PutUint16(body[4:], c.Primaries)
+	binary.BigEndian.PutUint16(body[6:], c.Transfer)
+	return out, nil
+}
+
+// nclxBox returns the contents of the first nclx color box of an AVIF or
+// HEIF file, in meta/iprp/ipco, or nil. The contents are a slice of data.
+func nclxBox(data []byte) []byte {
+	var found []byte
+	walkBoxes(data, func(kind string, body []byte) bool {
+		if kind != "meta" || len(body) < 4 {
+			return true
+		}
+		// meta is a full box, with a version and flags before its children
+		walkBoxes(body[4:], func(kind string, body []byte) bool {
+			if kind != "iprp" {
+				return true
+			}
+			walkBoxes(body, func(kind string, body []byte) bool {
+				if kind != "ipco" {
+					return true
+				}
+				walkBoxes(body, func(kind string, body []byte) bool {
+					if kind == "colr" && len(body) >= 11 && string(body[:4]) == "nclx" {
+						found = body
+						return false
+					}
+					return true
+				})
+				return false
+			})
+			return false
+		})
+		return false
+	})
+	return found
+}
+
+// walkBoxes calls fn with the type and contents of each ISO base media box
+// in data, until fn returns false or a box is truncated
+func walkBoxes(data []byte, fn func(kind string, body []byte) bool) {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data))
+		kind := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return
+			}
+			size, header = binary.BigEndian.Uint64(data[8:]), 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return
+		}
+		if !fn(kind, data[header:size]) {
+			return
+		}
+		data = data[size:]
+	}
+}
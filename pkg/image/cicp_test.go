@@ -0,0 +1,110 @@
+package image
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// box returns an ISO base media box of a type with contents
+func box(kind string, contents ...[]byte) []byte {
+	var body []byte
+	for _, c := range contents {
+		body = append(body, c...)
+	}
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(b, kind...), body...)
+}
+
+// heifWithColor returns the boxes of a HEIF file with an nclx color box
+func heifWithColor(c CICP) []byte {
+	nclx := []byte("nclx")
+	nclx = binary.BigEndian.AppendUint16(nclx, c.Primaries)
+	nclx = binary.BigEndian.AppendUint16(nclx, c.Transfer)
+	nclx = binary.BigEndian.AppendUint16(nclx, c.Matrix)
+	if c.FullRange {
+		nclx = append(nclx, 0x80)
+	} else {
+		nclx = append(nclx, 0)
+	}
+	ipco := box("ipco", box("ispe", make([]byte, 12)), box("colr", nclx))
+	meta := box("meta", []byte{0, 0, 0, 0}, box("hdlr", make([]byte, 24)), box("iprp", ipco, box("ipma", make([]byte, 8))))
+	return append(box("ftyp", []byte("heic\x00\x00\x00\x00mif1heic")), meta...)
+}
+
+func TestReadCICP(t *testing.T) {
+	hdr := CICP{Primaries: CICPPrimariesBT2020, Transfer: CICPTransferPQ, Matrix: 9, FullRange: true}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "photo.heic")
+	os.WriteFile(path, heifWithColor(hdr), 0o644)
+
+	c, ok := ReadCICP(path)
+	if !ok || c != hdr {
+		t.Fatalf("Expected %v, got %v (%v)", hdr, c, ok)
+	}
+	if !c.HDR() || !c.WideGamut() || c.String() != "bt2020/pq/9" {
+		t.Errorf("Expected a wide-gamut HDR color space, got %s", c)
+	}
+
+	// Files without a color box, and other formats, have none
+	os.WriteFile(filepath.Join(dir, "plain.avif"), box("ftyp", []byte("avif")), 0o644)
+	if _, ok := ReadCICP(filepath.Join(dir, "plain.avif")); ok {
+		t.Error("Expected no color space without a color box")
+	}
+	os.WriteFile(filepath.Join(dir, "photo.png"), heifWithColor(hdr), 0o644)
+	if _, ok := ReadCICP(filepath.Join(dir, "photo.png")); ok {
+		t.Error("Expected no color space for a PNG")
+	}
+}
+
+func TestSetCICP(t *testing.T) {
+	srgb := CICP{Primaries: CICPPrimariesBT709, Transfer: CICPTransferSRGB, Matrix: 6, FullRange: true}
+	data := heifWithColor(srgb)
+	hlg := CICP{Primaries: CICPPrimariesBT2020, Transfer: CICPTransferHLG, Matrix: 9}
+	out, err := SetCICP(data, hlg)
+	if err != nil {
+		t.Fatalf("Failed to set the color space: %v", err)
+	}
+	if body := nclxBox(data); binary.BigEndian.Uint16(body[6:]) != CICPTransferSRGB {
+		t.Error("Expected the input to be left alone")
+	}
+
+	// The primaries and transfer change; the matrix and range do not
+	body := nclxBox(out)
+	want := CICP{Primaries: CICPPrimariesBT2020, Transfer: CICPTransferHLG, Matrix: 6}
+	if got := (CICP{binary.BigEndian.Uint16(body[4:]), binary.BigEndian.Uint16(body[6:]), binary.BigEndian.Uint16(body[8:]), false}); got != want {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if body[10] != 0x80 {
+		t.Error("Expected the full range flag to be kept")
+	}
+
+	if _, err := SetCICP(box("ftyp", []byte("avif")), hlg); err == nil {
+		t.Error("Expected an error without a color box")
+	}
+}
+
+func TestKeepColor(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "photo.heic")
+	os.WriteFile(input, heifWithColor(CICP{Primaries: CICPPrimariesBT2020, Transfer: CICPTransferPQ, Matrix: 9}), 0o644)
+
+	options := DefaultOptions()
+	options.AVIF.Color = AVIFColorKeep
+	kept, err := KeepColor(input, "out.avif", options)
+	if err != nil || kept.AVIF.CICP == nil || kept.AVIF.CICP.Transfer != CICPTransferPQ {
+		t.Errorf("Expected the PQ transfer to be kept, got %v (%v)", kept.AVIF.CICP, err)
+	}
+	if kept, _ := KeepColor(input, "out.png", options); kept.AVIF.CICP != nil {
+		t.Error("Expected no color space for PNG output")
+	}
+	options.AVIF.Color = AVIFColorSRGB
+	if kept, _ := KeepColor(input, "out.avif", options); kept.AVIF.CICP != nil {
+		t.Error("Expected no color space for sRGB output")
+	}
+	options.AVIF.Color = "p3"
+	if _, err := KeepColor(input, "out.avif", options); err == nil {
+		t.Error("Expected an error for an unknown color space")
+	}
+}
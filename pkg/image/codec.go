@@ -0,0 +1,53 @@
+package image
+
+import (
+	"image"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Codec describes an image format that OpenImage and Encode can handle in
+// addition to the built-in formats. Either Decode or Encode may be nil when
+// the format is read-only or write-only.
+type Codec struct {
+	Name       string                                                           // Human-readable format name
+	Extensions []string                                                         // File extensions without the leading dot
+	Decode     func(r io.Reader, options ProcessOptions) (image.Image, error)   // Decodes an image
+	Encode     func(w io.Writer, img image.Image, options ProcessOptions) error // Encodes an image
+	CGO        bool                                                             // Whether the codec links a C library through cgo
+	Tools      []string                                                         // External programs decoding needs, any one of which will do
+	Note       string                                                           // Limitations of this build, if any
+}
+
+// codecs maps lowercase file extensions to registered codecs
+var codecs = make(map[string]*Codec)
+
+// RegisterCodec makes a format available by its file extensions. Registering
+// an extension again replaces the previous codec.
+func RegisterCodec(codec Codec) {
+	c := &codec
+	for _, ext := range codec.Extensions {
+		codecs[strings.ToLower(ext)] = c
+	}
+}
+
+// LookupCodec returns the codec registered for a file extension
+func LookupCodec(ext string) (*Codec, bool) {
+	codec, ok := codecs[strings.ToLower(strings.TrimPrefix(ext, "."))]
+	return codec, ok
+}
+
+// Codecs returns all registered codecs sorted by name
+func Codecs() []*Codec {
+	seen := make(map[*Codec]bool)
+	var list []*Codec
+	for _, codec := range codecs {
+		if !seen[codec] {
+			seen[codec] = true
+			list = append(list, codec)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
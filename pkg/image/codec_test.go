@@ -0,0 +1,46 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"testing"
+)
+
+func TestRegisterCodec(t *testing.T) {
+	var encoded bool
+	RegisterCodec(Codec{
+		Name:       "Test",
+		Extensions: []string{"TST", "test"},
+		Encode: func(w io.Writer, img image.Image, options ProcessOptions) error {
+			encoded = true
+			_, err := fmt.Fprintf(w, "%dx%d", img.Bounds().Dx(), img.Bounds().Dy())
+			return err
+		},
+	})
+	defer delete(codecs, "tst")
+	defer delete(codecs, "test")
+
+	for _, ext := range []string{"tst", ".TST", "test"} {
+		if _, ok := LookupCodec(ext); !ok {
+			t.Errorf("Expected codec for %q", ext)
+		}
+	}
+
+	var buf bytes.Buffer
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	if err := Encode(&buf, img, ProcessOptions{OutputFormat: "tst"}); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if !encoded || buf.String() != "3x2" {
+		t.Errorf("Expected the registered encoder to be used, got %q", buf.String())
+	}
+}
+
+func TestCodecWithoutEncoder(t *testing.T) {
+	err := Encode(io.Discard, image.NewNRGBA(image.Rect(0, 0, 1, 1)), ProcessOptions{OutputFormat: "psd"})
+	if err == nil {
+		t.Errorf("Expected an error when encoding a read-only format")
+	}
+}
@@ -0,0 +1,65 @@
+package image
+
+import (
+	"image"
+	"image/color"
+)
+
+// Content is the kind of picture an image holds
+type Content string
+
+const (
+	ContentPhoto   Content = "photo"   // Camera shots and renders with smooth gradients and noise
+	ContentGraphic Content = "graphic" // Logos, icons, diagrams and screenshots with flat colors
+)
+
+// classifySamples is the largest number of samples along each side of an
+// image ClassifyContent looks at
+const classifySamples = 128
+
+// ClassifyContent tells photos from graphics by sampling img on a grid:
+// graphics have few distinct colors, or the same color in most neighboring
+// samples, while photos have noise and gradients everywhere
+func ClassifyContent(img image.Image) Content {
+	b := img.Bounds()
+	cols, rows := min(b.Dx(), classifySamples), min(b.Dy(), classifySamples)
+	if cols == 0 || rows == 0 {
+		return ContentGraphic
+	}
+
+	colors := make(map[color.NRGBA]struct{})
+	flat, pairs := 0, 0
+	above, row := make([]color.NRGBA, cols), make([]color.NRGBA, cols)
+	for j := range rows {
+		y := b.Min.Y + j*b.Dy()/rows
+		for i := range cols {
+			x := b.Min.X + i*b.Dx()/cols
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			colors[c] = struct{}{}
+			if i > 0 {
+				pairs++
+				if c == row[i-1] {
+					flat++
+				}
+			}
+			if j > 0 {
+				pairs++
+				if c == above[i] {
+					flat++
+				}
+			}
+			row[i] = c
+		}
+		above, row = row, above
+	}
+
+	if len(colors) <= 256 || (pairs > 0 && flat*2 > pairs) {
+		return ContentGraphic
+	}
+	return ContentPhoto
+}
+
+// HasTransparency reports whether any pixel of img is not fully opaque
+func HasTransparency(img image.Image) bool {
+	return !isOpaque(img)
+}
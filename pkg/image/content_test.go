@@ -0,0 +1,63 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestClassifyContent(t *testing.T) {
+	// A gradient with sensor noise, like a sky in a photo
+	photo := image.NewNRGBA(image.Rect(0, 0, 400, 300))
+	rng := rand.New(rand.NewPCG(1, 2))
+	for y := range 300 {
+		for x := range 400 {
+			n := rng.IntN(9) - 4
+			photo.SetNRGBA(x, y, color.NRGBA{uint8(x*200/400 + 20 + n), uint8(y*200/300 + 20 - n), uint8(120 + n), 255})
+		}
+	}
+	if got := ClassifyContent(photo); got != ContentPhoto {
+		t.Errorf("Expected a photo, got %s", got)
+	}
+
+	// A logo: flat shapes with smooth edges, so more than 256 colors
+	logo := image.NewNRGBA(image.Rect(0, 0, 400, 300))
+	for y := range 300 {
+		for x := range 400 {
+			c := color.NRGBA{255, 255, 255, 255}
+			if d := (x-200)*(x-200) + (y-150)*(y-150); d < 100*100 {
+				c = color.NRGBA{200, 30, 40, 255}
+			}
+			if x > 20 && x < 60 {
+				c = color.NRGBA{uint8(y % 256), uint8(x), uint8(255 - y%256), 255}
+			}
+			logo.SetNRGBA(x, y, c)
+		}
+	}
+	if got := ClassifyContent(logo); got != ContentGraphic {
+		t.Errorf("Expected a graphic, got %s", got)
+	}
+	if got := ClassifyContent(image.NewGray(image.Rect(0, 0, 0, 0))); got != ContentGraphic {
+		t.Errorf("Expected an empty image to be a graphic, got %s", got)
+	}
+}
+
+func TestHasTransparency(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for y := range 4 {
+		for x := range 4 {
+			img.SetNRGBA(x, y, color.NRGBA{10, 20, 30, 255})
+		}
+	}
+	if HasTransparency(img) {
+		t.Errorf("Expected an opaque image")
+	}
+	img.SetNRGBA(3, 3, color.NRGBA{10, 20, 30, 128})
+	if !HasTransparency(img) {
+		t.Errorf("Expected a transparent pixel to be found")
+	}
+	if HasTransparency(image.NewGray(image.Rect(0, 0, 4, 4))) {
+		t.Errorf("Expected a gray image to be opaque")
+	}
+}
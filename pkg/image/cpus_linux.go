@@ -0,0 +1,35 @@
+package image
+
+import (
+	"fmt"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// onCPUs runs f with the calling thread, and the threads it starts, allowed
+// on at most n of the CPUs the process may run on. The system libavif starts
+// one encoding thread per CPU; pinned to n CPUs, they use no more than that.
+func onCPUs(n int, f func() error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var all unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &all); err != nil {
+		return fmt.Errorf("failed to read the CPU affinity: %w", err)
+	}
+	if n >= all.Count() {
+		return f()
+	}
+	var set unix.CPUSet
+	for cpu := 0; set.Count() < n; cpu++ {
+		if all.IsSet(cpu) {
+			set.Set(cpu)
+		}
+	}
+	if err := unix.SchedSetaffinity(0, &set); err != nil {
+		return fmt.Errorf("failed to limit the AVIF encoder to %d CPUs: %w", n, err)
+	}
+	defer unix.SchedSetaffinity(0, &all)
+	return f()
+}
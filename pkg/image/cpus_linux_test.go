@@ -0,0 +1,34 @@
+package image
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestOnCPUs(t *testing.T) {
+	var before unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &before); err != nil {
+		t.Fatal(err)
+	}
+	err := onCPUs(1, func() error {
+		var set unix.CPUSet
+		if err := unix.SchedGetaffinity(0, &set); err != nil {
+			return err
+		}
+		if set.Count() != 1 {
+			t.Errorf("Expected 1 CPU, got %d", set.Count())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var after unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &after); err != nil {
+		t.Fatal(err)
+	}
+	if after.Count() != before.Count() {
+		t.Errorf("Expected the affinity to be restored to %d CPUs, got %d", before.Count(), after.Count())
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package image
+
+import "fmt"
+
+// onCPUs runs f on at most n CPUs, which only Linux supports
+func onCPUs(n int, f func() error) error {
+	return fmt.Errorf("limiting the AVIF encoder to %d CPUs is only supported on Linux", n)
+}
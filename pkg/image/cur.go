@@ -0,0 +1,50 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/sergeymakinen/go-ico/cur"
+)
+
+func init() {
+	RegisterCodec(Codec{
+		Name:       "Windows cursor",
+		Extensions: []string{"cur"},
+		Decode: func(r io.Reader, options ProcessOptions) (image.Image, error) {
+			return cur.Decode(r)
+		},
+		Encode: func(w io.Writer, img image.Image, options ProcessOptions) error {
+			return EncodeCUR(w, img, options.Hotspot)
+		},
+	})
+}
+
+// EncodeCUR writes img as a Windows cursor with the given hotspot, the
+// pixel that is the pointer's click position
+func EncodeCUR(w io.Writer, img image.Image, hotspot image.Point) error {
+	bounds := img.Bounds()
+	if !hotspot.In(image.Rect(0, 0, bounds.Dx(), bounds.Dy())) {
+		return fmt.Errorf("hotspot %d,%d is outside the %dx%d cursor", hotspot.X, hotspot.Y, bounds.Dx(), bounds.Dy())
+	}
+
+	var buf bytes.Buffer
+	if err := cur.Encode(&buf, img); err != nil {
+		return err
+	}
+
+	// The encoder always writes a 0,0 hotspot; it is stored in place of the
+	// color planes and bit count of the single directory entry
+	data := buf.Bytes()
+	if len(data) < 22 {
+		return fmt.Errorf("invalid cursor data")
+	}
+	binary.LittleEndian.PutUint16(data[10:], uint16(hotspot.X))
+	binary.LittleEndian.PutUint16(data[12:], uint16(hotspot.Y))
+
+	_, err := w.Write(data)
+	return err
+}
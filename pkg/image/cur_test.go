@@ -0,0 +1,38 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/sergeymakinen/go-ico/cur"
+)
+
+func TestEncodeCUR(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	img.SetNRGBA(5, 7, color.NRGBA{R: 255, A: 255})
+
+	var buf bytes.Buffer
+	if err := EncodeCUR(&buf, img, image.Pt(5, 7)); err != nil {
+		t.Fatalf("EncodeCUR failed: %v", err)
+	}
+
+	decoded, err := cur.DecodeAll(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to decode cursor: %v", err)
+	}
+	if len(decoded.Hotspot) != 1 || decoded.Hotspot[0] != (cur.Hotspot{X: 5, Y: 7}) {
+		t.Errorf("Expected hotspot 5,7, got %v", decoded.Hotspot)
+	}
+	if _, _, _, a := decoded.Cursor[0].At(5, 7).RGBA(); a != 0xffff {
+		t.Errorf("Expected an opaque pixel at the hotspot")
+	}
+}
+
+func TestEncodeCURHotspotOutside(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	if err := EncodeCUR(&bytes.Buffer{}, img, image.Pt(16, 0)); err == nil {
+		t.Fatalf("Expected an error for a hotspot outside the cursor")
+	}
+}
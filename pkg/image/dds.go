@@ -0,0 +1,258 @@
+package image
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+)
+
+func init() {
+	RegisterCodec(Codec{
+		Name:       "DirectDraw Surface",
+		Extensions: []string{"dds"},
+		Decode: func(r io.Reader, options ProcessOptions) (image.Image, error) {
+			return DecodeDDS(r)
+		},
+	})
+}
+
+// DDS pixel format flags
+const (
+	ddsAlphaPixels = 0x1
+	ddsFourCC      = 0x4
+	ddsRGB         = 0x40
+	ddsLuminance   = 0x20000
+)
+
+// DXGI formats accepted in DX10 headers
+const (
+	dxgiR8G8B8A8     = 28
+	dxgiR8G8B8A8SRGB = 29
+	dxgiBC1          = 71
+	dxgiBC1SRGB      = 72
+	dxgiBC2          = 74
+	dxgiBC2SRGB      = 75
+	dxgiBC3          = 77
+	dxgiBC3SRGB      = 78
+	dxgiB8G8R8A8     = 87
+	dxgiB8G8R8A8SRGB = 91
+)
+
+// ddsMasks holds the channel bit masks of an uncompressed DDS surface
+type ddsMasks struct {
+	bitCount   int
+	r, g, b, a uint32
+}
+
+// DecodeDDS decodes the top-level surface of a DirectDraw Surface texture.
+// DXT1 (BC1), DXT3 (BC2), DXT5 (BC3) and uncompressed RGB(A) and luminance
+// surfaces are supported; mipmaps below the first level are ignored.
+func DecodeDDS(r io.Reader) (image.Image, error) {
+	le := binary.LittleEndian
+	var header [128]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || string(header[:4]) != "DDS " || le.Uint32(header[4:]) != 124 {
+		return nil, fmt.Errorf("not a DDS file")
+	}
+	height := int(le.Uint32(header[12:]))
+	width := int(le.Uint32(header[16:]))
+	if width <= 0 || height <= 0 || width > 1<<16 || height > 1<<16 {
+		return nil, fmt.Errorf("invalid DDS dimensions")
+	}
+
+	pfFlags := le.Uint32(header[80:])
+	fourCC := string(header[84:88])
+	masks := ddsMasks{
+		bitCount: int(le.Uint32(header[88:])),
+		r:        le.Uint32(header[92:]),
+		g:        le.Uint32(header[96:]),
+		b:        le.Uint32(header[100:]),
+		a:        le.Uint32(header[104:]),
+	}
+	if pfFlags&ddsAlphaPixels == 0 {
+		masks.a = 0
+	}
+
+	// Map DX10 headers onto the legacy formats
+	if pfFlags&ddsFourCC != 0 && fourCC == "DX10" {
+		var dx10 [20]byte
+		if _, err := io.ReadFull(r, dx10[:]); err != nil {
+			return nil, fmt.Errorf("failed to read DDS DX10 header: %w", err)
+		}
+		switch le.Uint32(dx10[:]) {
+		case dxgiBC1, dxgiBC1SRGB:
+			fourCC = "DXT1"
+		case dxgiBC2, dxgiBC2SRGB:
+			fourCC = "DXT3"
+		case dxgiBC3, dxgiBC3SRGB:
+			fourCC = "DXT5"
+		case dxgiR8G8B8A8, dxgiR8G8B8A8SRGB:
+			pfFlags = ddsRGB
+			masks = ddsMasks{32, 0xff, 0xff00, 0xff0000, 0xff000000}
+		case dxgiB8G8R8A8, dxgiB8G8R8A8SRGB:
+			pfFlags = ddsRGB
+			masks = ddsMasks{32, 0xff0000, 0xff00, 0xff, 0xff000000}
+		default:
+			return nil, fmt.Errorf("unsupported DDS DXGI format: %d", le.Uint32(dx10[:]))
+		}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	if pfFlags&ddsFourCC != 0 {
+		blockSize := 16
+		switch fourCC {
+		case "DXT1":
+			blockSize = 8
+		case "DXT2", "DXT3", "DXT4", "DXT5":
+		default:
+			return nil, fmt.Errorf("unsupported DDS compression: %q", fourCC)
+		}
+
+		blocksX, blocksY := (width+3)/4, (height+3)/4
+		data := make([]byte, blocksX*blocksY*blockSize)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("failed to read DDS data: %w", err)
+		}
+
+		var block [16]color.NRGBA
+		for by := 0; by < blocksY; by++ {
+			for bx := 0; bx < blocksX; bx++ {
+				b := data[(by*blocksX+bx)*blockSize:]
+				switch fourCC {
+				case "DXT1":
+					decodeBC1(b, &block, true)
+				case "DXT2", "DXT3":
+					decodeBC1(b[8:], &block, false)
+					for i := range block {
+						block[i].A = (b[i/2] >> (4 * (i % 2)) & 0x0f) * 17
+					}
+				default:
+					decodeBC1(b[8:], &block, false)
+					decodeBC3Alpha(b, &block)
+				}
+				for i, c := range block {
+					x, y := bx*4+i%4, by*4+i/4
+					if x < width && y < height {
+						img.SetNRGBA(x, y, c)
+					}
+				}
+			}
+		}
+		return img, nil
+	}
+
+	if pfFlags&(ddsRGB|ddsLuminance) == 0 || masks.bitCount%8 != 0 || masks.bitCount < 8 || masks.bitCount > 32 {
+		return nil, fmt.Errorf("unsupported DDS pixel format")
+	}
+	bytesPerPixel := masks.bitCount / 8
+	row := make([]byte, width*bytesPerPixel)
+	for y := 0; y < height; y++ {
+		if _, err := io.ReadFull(r, row); err != nil {
+			return nil, fmt.Errorf("failed to read DDS data: %w", err)
+		}
+		for x := 0; x < width; x++ {
+			var v uint32
+			for i := 0; i < bytesPerPixel; i++ {
+				v |= uint32(row[x*bytesPerPixel+i]) << (8 * i)
+			}
+			c := color.NRGBA{
+				R: ddsChannel(v, masks.r),
+				G: ddsChannel(v, masks.g),
+				B: ddsChannel(v, masks.b),
+				A: 255,
+			}
+			if pfFlags&ddsLuminance != 0 {
+				c.G, c.B = c.R, c.R
+			}
+			if masks.a != 0 {
+				c.A = ddsChannel(v, masks.a)
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img, nil
+}
+
+// ddsChannel extracts a channel by its bit mask and scales it to 8 bits
+func ddsChannel(v, mask uint32) uint8 {
+	if mask == 0 {
+		return 0
+	}
+	shift := bits.TrailingZeros32(mask)
+	top := mask >> shift
+	return uint8((v & mask >> shift) * 255 / top)
+}
+
+// decodeBC1 decodes the color part of a BC1/BC2/BC3 block. With punchThrough,
+// blocks whose first color is not greater than the second use 1-bit alpha.
+func decodeBC1(b []byte, block *[16]color.NRGBA, punchThrough bool) {
+	c0 := binary.LittleEndian.Uint16(b)
+	c1 := binary.LittleEndian.Uint16(b[2:])
+	var palette [4]color.NRGBA
+	palette[0] = rgb565(c0)
+	palette[1] = rgb565(c1)
+	mix := func(a, b uint8, wa, wb, d int) uint8 {
+		return uint8((int(a)*wa + int(b)*wb) / d)
+	}
+	if c0 > c1 || !punchThrough {
+		for i, w := range [][2]int{{2, 1}, {1, 2}} {
+			palette[2+i] = color.NRGBA{
+				R: mix(palette[0].R, palette[1].R, w[0], w[1], 3),
+				G: mix(palette[0].G, palette[1].G, w[0], w[1], 3),
+				B: mix(palette[0].B, palette[1].B, w[0], w[1], 3),
+				A: 255,
+			}
+		}
+	} else {
+		palette[2] = color.NRGBA{
+			R: mix(palette[0].R, palette[1].R, 1, 1, 2),
+			G: mix(palette[0].G, palette[1].G, 1, 1, 2),
+			B: mix(palette[0].B, palette[1].B, 1, 1, 2),
+			A: 255,
+		}
+		palette[3] = color.NRGBA{}
+	}
+
+	indices := binary.LittleEndian.Uint32(b[4:])
+	for i := range block {
+		block[i] = palette[indices>>(2*i)&3]
+	}
+}
+
+// decodeBC3Alpha decodes the interpolated alpha part of a BC3 block
+func decodeBC3Alpha(b []byte, block *[16]color.NRGBA) {
+	a0, a1 := int(b[0]), int(b[1])
+	var alpha [8]uint8
+	alpha[0], alpha[1] = uint8(a0), uint8(a1)
+	if a0 > a1 {
+		for i := 1; i <= 6; i++ {
+			alpha[1+i] = uint8(((7-i)*a0 + i*a1) / 7)
+		}
+	} else {
+		for i := 1; i <= 4; i++ {
+			alpha[1+i] = uint8(((5-i)*a0 + i*a1) / 5)
+		}
+		alpha[6], alpha[7] = 0, 255
+	}
+
+	var indices uint64
+	for i := 0; i < 6; i++ {
+		indices |= uint64(b[2+i]) << (8 * i)
+	}
+	for i := range block {
+		block[i].A = alpha[indices>>(3*i)&7]
+	}
+}
+
+// rgb565 expands a 16-bit RGB565 color
+func rgb565(v uint16) color.NRGBA {
+	r, g, b := v>>11&0x1f, v>>5&0x3f, v&0x1f
+	return color.NRGBA{
+		R: uint8(r<<3 | r>>2),
+		G: uint8(g<<2 | g>>4),
+		B: uint8(b<<3 | b>>2),
+		A: 255,
+	}
+}
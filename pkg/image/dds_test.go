@@ -0,0 +1,86 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"testing"
+)
+
+// buildDDS creates a DDS file with a legacy header
+func buildDDS(width, height int, pfFlags uint32, fourCC string, masks ddsMasks, data []byte) []byte {
+	header := make([]byte, 128)
+	le := binary.LittleEndian
+	copy(header, "DDS ")
+	le.PutUint32(header[4:], 124)
+	le.PutUint32(header[12:], uint32(height))
+	le.PutUint32(header[16:], uint32(width))
+	le.PutUint32(header[76:], 32)
+	le.PutUint32(header[80:], pfFlags)
+	copy(header[84:], fourCC)
+	le.PutUint32(header[88:], uint32(masks.bitCount))
+	le.PutUint32(header[92:], masks.r)
+	le.PutUint32(header[96:], masks.g)
+	le.PutUint32(header[100:], masks.b)
+	le.PutUint32(header[104:], masks.a)
+	return append(header, data...)
+}
+
+func TestDecodeDDSDXT1(t *testing.T) {
+	// Red and blue endpoints; the first row uses indices 0,1,2,3
+	block := []byte{0x00, 0xf8, 0x1f, 0x00, 0xe4, 0, 0, 0}
+	img, err := DecodeDDS(bytes.NewReader(buildDDS(4, 4, ddsFourCC, "DXT1", ddsMasks{}, block)))
+	if err != nil {
+		t.Fatalf("DecodeDDS failed: %v", err)
+	}
+
+	expected := []color.NRGBA{
+		{255, 0, 0, 255},
+		{0, 0, 255, 255},
+		{170, 0, 85, 255},
+		{85, 0, 170, 255},
+	}
+	for x, c := range expected {
+		if got := img.At(x, 0); got != c {
+			t.Errorf("Pixel %d: expected %v, got %v", x, c, got)
+		}
+	}
+	// Index 0 everywhere else
+	if got := img.At(3, 3); got != expected[0] {
+		t.Errorf("Expected %v, got %v", expected[0], got)
+	}
+}
+
+func TestDecodeDDSDXT5(t *testing.T) {
+	// Alpha endpoints 255 and 0, with the first pixel using index 1 (alpha 0)
+	alpha := []byte{255, 0, 0x01, 0, 0, 0, 0, 0}
+	colors := []byte{0xe0, 0x07, 0xe0, 0x07, 0, 0, 0, 0}
+	img, err := DecodeDDS(bytes.NewReader(buildDDS(4, 4, ddsFourCC, "DXT5", ddsMasks{}, append(alpha, colors...))))
+	if err != nil {
+		t.Fatalf("DecodeDDS failed: %v", err)
+	}
+	if got := img.At(0, 0).(color.NRGBA); got.A != 0 || got.G != 255 {
+		t.Errorf("Expected transparent green, got %v", got)
+	}
+	if got := img.At(1, 0).(color.NRGBA); got.A != 255 {
+		t.Errorf("Expected opaque pixel, got %v", got)
+	}
+}
+
+func TestDecodeDDSUncompressed(t *testing.T) {
+	masks := ddsMasks{32, 0xff0000, 0xff00, 0xff, 0xff000000}
+	data := []byte{10, 20, 30, 40, 50, 60, 70, 80}
+	img, err := DecodeDDS(bytes.NewReader(buildDDS(2, 1, ddsRGB|ddsAlphaPixels, "", masks, data)))
+	if err != nil {
+		t.Fatalf("DecodeDDS failed: %v", err)
+	}
+	if got := img.At(1, 0); got != (color.NRGBA{70, 60, 50, 80}) {
+		t.Errorf("Unexpected pixel %v", got)
+	}
+}
+
+func TestDecodeDDSUnsupported(t *testing.T) {
+	if _, err := DecodeDDS(bytes.NewReader(buildDDS(4, 4, ddsFourCC, "ATI2", ddsMasks{}, make([]byte, 16)))); err == nil {
+		t.Errorf("Expected an error for an unsupported compression")
+	}
+}
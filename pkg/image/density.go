@@ -0,0 +1,125 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// DensityFormats are the output formats SetDensity can tag
+var DensityFormats = []string{"jpg", "jpeg", "png", "tiff", "tif"}
+
+// SetDensity returns a JPEG, PNG or TIFF file with its physical resolution
+// set to dpi dots per inch: the JFIF density of JPEGs, the pHYs chunk of
+// PNGs, and the resolution tags of every TIFF page
+func SetDensity(data []byte, dpi float64) ([]byte, error) {
+	if !(dpi > 0 && dpi <= 65535) {
+		return nil, fmt.Errorf("invalid density: %g (expected 1-65535 dpi)", dpi)
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		return setJPEGDensity(data, dpi), nil
+	case bytes.HasPrefix(data, pngSignature):
+		return setPNGDensity(data, dpi)
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return setTIFFDensity(data, dpi)
+	}
+	return nil, fmt.Errorf("cannot set the density: not a JPEG, PNG or TIFF file")
+}
+
+// setJPEGDensity replaces the JFIF segment following the start of image, or
+// inserts one
+func setJPEGDensity(data []byte, dpi float64) []byte {
+	density := uint16(max(1, math.Round(dpi)))
+	jfif := []byte{0xFF, 0xE0, 0, 16, 'J', 'F', 'I', 'F', 0, 1, 2, 1, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(jfif[12:], density)
+	binary.BigEndian.PutUint16(jfif[14:], density)
+
+	rest := data[2:]
+	if length, ok := jfifLength(data); ok {
+		rest = data[2+length:]
+	}
+	out := make([]byte, 0, len(data)+len(jfif))
+	out = append(out, 0xFF, 0xD8)
+	out = append(out, jfif...)
+	return append(out, rest...)
+}
+
+// setPNGDensity writes a pHYs chunk after the IHDR chunk, dropping any
+// other pHYs chunk
+func setPNGDensity(data []byte, dpi float64) ([]byte, error) {
+	perMeter := uint32(math.Round(dpi / 0.0254))
+	var phys [9]byte
+	binary.BigEndian.PutUint32(phys[0:], perMeter)
+	binary.BigEndian.PutUint32(phys[4:], perMeter)
+	phys[8] = 1 // Unit: meter
+
+	var out bytes.Buffer
+	w := bufio.NewWriter(&out)
+	w.Write(pngSignature)
+	for offset := len(pngSignature); offset < len(data); {
+		if offset+12 > len(data) {
+			return nil, fmt.Errorf("truncated PNG chunk")
+		}
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		end := offset + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, fmt.Errorf("truncated PNG chunk")
+		}
+		switch name := string(data[offset+4 : offset+8]); name {
+		case "pHYs":
+		case "IHDR":
+			w.Write(data[offset:end])
+			writePNGChunk(w, "pHYs", phys[:])
+		default:
+			w.Write(data[offset:end])
+		}
+		offset = end
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// setTIFFDensity rewrites the XResolution and YResolution values of every
+// page and sets their unit to inches
+func setTIFFDensity(data []byte, dpi float64) ([]byte, error) {
+	bo, pages, err := tiffPages(data)
+	if err != nil {
+		return nil, err
+	}
+	// Fractional densities are stored in thousandths
+	numerator, denominator := uint32(math.Round(dpi)), uint32(1)
+	if dpi != math.Round(dpi) {
+		numerator, denominator = uint32(math.Round(dpi*1000)), 1000
+	}
+
+	out := bytes.Clone(data)
+	for _, offset := range pages {
+		found := false
+		count := int(bo.Uint16(out[offset:]))
+		for i := 0; i < count; i++ {
+			entry := out[int(offset)+2+i*12:]
+			tag, kind := bo.Uint16(entry), bo.Uint16(entry[2:])
+			switch {
+			case (tag == 282 || tag == 283) && kind == 5: // XResolution, YResolution: RATIONAL
+				value := int(bo.Uint32(entry[8:]))
+				if value+8 > len(out) {
+					return nil, fmt.Errorf("invalid TIFF resolution offset: %d", value)
+				}
+				bo.PutUint32(out[value:], numerator)
+				bo.PutUint32(out[value+4:], denominator)
+				found = true
+			case tag == 296 && kind == 3: // ResolutionUnit: SHORT
+				bo.PutUint16(entry[8:], 2) // Inch
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("TIFF page has no resolution tags")
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,103 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestSetDensityJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, gradient(16, 16), nil)
+	data, err := SetDensity(buf.Bytes(), 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Setting it again replaces the JFIF segment
+	if data, err = SetDensity(data, 299.6); err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != buf.Len()+18 {
+		t.Errorf("%d bytes added, expected one 18-byte segment", len(data)-buf.Len())
+	}
+	if string(data[6:11]) != "JFIF\x00" || data[13] != 1 {
+		t.Fatalf("no JFIF segment in dots per inch: % x", data[:20])
+	}
+	if x, y := binary.BigEndian.Uint16(data[14:]), binary.BigEndian.Uint16(data[16:]); x != 300 || y != 300 {
+		t.Errorf("density %dx%d, expected 300x300", x, y)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSetDensityPNG(t *testing.T) {
+	var buf bytes.Buffer
+	EncodePNG(&buf, gradient(16, 16), PNGOptions{})
+	data, err := SetDensity(buf.Bytes(), 72)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err = SetDensity(data, 300); err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("pHYs")); n != 1 {
+		t.Fatalf("%d pHYs chunks", n)
+	}
+	// pHYs follows the 33 bytes of the signature and IHDR
+	if name := string(data[37:41]); name != "pHYs" {
+		t.Fatalf("%s chunk follows IHDR", name)
+	}
+	if x := binary.BigEndian.Uint32(data[41:]); x != 11811 || data[49] != 1 {
+		t.Errorf("%d pixels per unit %d, expected 11811 per meter", x, data[49])
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSetDensityTIFF(t *testing.T) {
+	var buf bytes.Buffer
+	EncodeTIFF(&buf, gradient(16, 16), TIFFOptions{})
+	data, err := SetDensity(buf.Bytes(), 150.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bo, pages, _ := tiffPages(data)
+	entries := data[pages[0]+2:]
+	found := 0
+	for i := 0; i < int(bo.Uint16(data[pages[0]:])); i++ {
+		entry := entries[i*12:]
+		if tag := bo.Uint16(entry); tag == 282 || tag == 283 {
+			value := bo.Uint32(entry[8:])
+			if n, d := bo.Uint32(data[value:]), bo.Uint32(data[value+4:]); n != 150500 || d != 1000 {
+				t.Errorf("tag %d: %d/%d, expected 150500/1000", tag, n, d)
+			}
+			found++
+		}
+	}
+	if found != 2 {
+		t.Errorf("%d resolution tags", found)
+	}
+	if _, err := DecodeTIFFPage(bytes.NewReader(data), 1); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSetDensityErrors(t *testing.T) {
+	var buf bytes.Buffer
+	EncodePNG(&buf, gradient(4, 4), PNGOptions{})
+	for _, dpi := range []float64{0, -1, 70000} {
+		if _, err := SetDensity(buf.Bytes(), dpi); err == nil {
+			t.Errorf("%g dpi: expected an error", dpi)
+		}
+	}
+	if _, err := SetDensity([]byte("GIF89a"), 300); err == nil {
+		t.Error("GIF: expected an error")
+	}
+	if _, err := SetDensity(buf.Bytes()[:40], 300); err == nil {
+		t.Error("truncated PNG: expected an error")
+	}
+}
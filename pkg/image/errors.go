@@ -0,0 +1,43 @@
+package image
+
+import "errors"
+
+// The kinds of errors Process and the functions it calls can fail with, for
+// callers that handle them differently, such as the exit codes of nim. Check
+// them with errors.Is.
+var (
+	// ErrUnsupportedFormat is a format nim cannot read or write
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	// ErrDecode is an input that could not be decoded
+	ErrDecode = errors.New("decode error")
+	// ErrEncode is an output that could not be encoded
+	ErrEncode = errors.New("encode error")
+)
+
+// kindError is an error of one of the kinds above that keeps its message
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// withKind marks err as an error of the given kind. Errors that already have
+// a kind keep it, so the first failure decides.
+func withKind(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, k := range []error{ErrUnsupportedFormat, ErrDecode, ErrEncode} {
+		if errors.Is(err, k) {
+			return err
+		}
+	}
+	return &kindError{kind: kind, err: err}
+}
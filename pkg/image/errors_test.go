@@ -0,0 +1,77 @@
+package image
+
+import (
+	"errors"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestErrorKinds(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.png")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, noiseAlpha(40, 30))
+	f.Close()
+	corrupt := filepath.Join(dir, "corrupt.png")
+	os.WriteFile(corrupt, []byte("\x89PNG\r\n\x1a\nnot a png"), 0o644)
+	unknown := filepath.Join(dir, "in.xyz")
+	os.WriteFile(unknown, []byte("data"), 0o644)
+
+	options := DefaultOptions()
+	options.Width, options.Height = 20, 20
+	streamed := options
+	streamed.MaxMemory = 1
+	for name, test := range map[string]struct {
+		input, output string
+		options       ProcessOptions
+		kind          error
+		message       string
+	}{
+		"unsupported input":  {unknown, "out.png", options, ErrUnsupportedFormat, "unsupported image format: xyz"},
+		"unsupported output": {input, "out.xyz", options, ErrUnsupportedFormat, "unsupported output format: xyz"},
+		"decoder only":       {input, "out.jxl", options, ErrUnsupportedFormat, "encoding to JXL format is not supported"},
+		"corrupt input":      {corrupt, "out.png", options, ErrDecode, "failed to decode image"},
+		"corrupt animation":  {corrupt, "out.webp", options, ErrDecode, "failed to"},
+		"corrupt streamed":   {corrupt, "out.png", streamed, ErrDecode, "failed to"},
+	} {
+		_, err := Process(test.input, filepath.Join(dir, test.output), test.options)
+		if !errors.Is(err, test.kind) {
+			t.Errorf("%s: expected %v, got %v", name, test.kind, err)
+		} else if !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s: expected the message %q, got %q", name, test.message, err)
+		}
+	}
+
+	// A missing input is not a decode error
+	if _, err := Process(filepath.Join(dir, "missing.png"), filepath.Join(dir, "out.png"), options); !errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrDecode) {
+		t.Errorf("Expected a missing file, got %v", err)
+	}
+
+	// Errors of the encoders, including writing, are encode errors
+	options.OutputFormat = "png"
+	if err := Encode(failingWriter{}, noiseAlpha(4, 4), options); !errors.Is(err, ErrEncode) {
+		t.Errorf("Expected an encode error, got %v", err)
+	}
+
+	// The first kind is kept
+	err = withKind(ErrEncode, withKind(ErrDecode, errors.New("bad")))
+	if !errors.Is(err, ErrDecode) || errors.Is(err, ErrEncode) || err.Error() != "bad" {
+		t.Errorf("Expected a decode error, got %v", err)
+	}
+	if withKind(ErrDecode, nil) != nil {
+		t.Errorf("Expected no error")
+	}
+}
@@ -0,0 +1,196 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EXIF is the metadata of a photo that output paths can be built from
+type EXIF struct {
+	Date  time.Time // When the photo was taken, or zero if unknown
+	Make  string
+	Model string
+	Lens  string
+	ISO   int
+}
+
+// Camera returns the brand and model of the camera, such as "NIKON Z 6_2"
+// for the make "NIKON CORPORATION", without repeating the brand when the
+// model already starts with it
+func (e EXIF) Camera() string {
+	brand, _, _ := strings.Cut(e.Make, " ")
+	if brand == "" || strings.HasPrefix(strings.ToLower(e.Model), strings.ToLower(brand)) {
+		return e.Model
+	}
+	return strings.TrimSpace(brand + " " + e.Model)
+}
+
+// exifHeadSize is how much of a file ReadEXIF reads; EXIF data comes before
+// the image data in JPEG files, and near the start in TIFF-based RAW files
+const exifHeadSize = 1 << 20
+
+// ReadEXIF reads the EXIF metadata of a JPEG, TIFF or TIFF-based RAW file
+// (DNG, CR2, NEF, ARW). Files without EXIF data give an empty EXIF.
+func ReadEXIF(path string) (EXIF, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return EXIF{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, exifHeadSize))
+	if err != nil {
+		return EXIF{}, fmt.Errorf("failed to read file: %w", err)
+	}
+	return ParseEXIF(data), nil
+}
+
+// ParseEXIF returns the EXIF metadata at the start of a JPEG, TIFF or
+// TIFF-based RAW file. Missing fields are left empty.
+func ParseEXIF(data []byte) EXIF {
+	var tiff []byte
+	var bo binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		if start, end := exifSegment(data); start >= 0 {
+			tiff, bo = exifTiff(data[start:end])
+		}
+	case bytes.HasPrefix(data, []byte("II*\x00")):
+		tiff, bo = data, binary.LittleEndian
+	case bytes.HasPrefix(data, []byte("MM\x00*")):
+		tiff, bo = data, binary.BigEndian
+	}
+	if len(tiff) < 8 {
+		return EXIF{}
+	}
+
+	var e EXIF
+	var dateTime, dateOriginal string
+	var exifIFD uint32
+	exifEntries(tiff, bo, bo.Uint32(tiff[4:]), func(entry []byte) {
+		switch bo.Uint16(entry) {
+		case 0x010F: // Make
+			e.Make = tiffString(tiff, bo, entry)
+		case 0x0110: // Model
+			e.Model = tiffString(tiff, bo, entry)
+		case 0x0132: // DateTime
+			dateTime = tiffString(tiff, bo, entry)
+		case 0x8769: // ExifIFD
+			if values := tiffValues(tiff, bo, entry); len(values) > 0 {
+				exifIFD = values[0]
+			}
+		}
+	})
+	if exifIFD > 0 {
+		exifEntries(tiff, bo, exifIFD, func(entry []byte) {
+			switch bo.Uint16(entry) {
+			case 0x9003: // DateTimeOriginal
+				dateOriginal = tiffString(tiff, bo, entry)
+			case 0x8827: // ISOSpeedRatings
+				if values := tiffValues(tiff, bo, entry); len(values) > 0 {
+					e.ISO = int(values[0])
+				}
+			case 0xA434: // LensModel
+				e.Lens = tiffString(tiff, bo, entry)
+			}
+		})
+	}
+
+	// The time the photo was taken, rather than when it was last edited
+	for _, value := range []string{dateOriginal, dateTime} {
+		if date, err := time.Parse("2006:01:02 15:04:05", value); err == nil {
+			e.Date = date
+			break
+		}
+	}
+	return e
+}
+
+// tiffString returns the ASCII value of a TIFF entry, or "" if it is not one
+func tiffString(data []byte, bo binary.ByteOrder, entry []byte) string {
+	if bo.Uint16(entry[2:]) != 2 {
+		return ""
+	}
+	count := int(bo.Uint32(entry[4:]))
+	raw := entry[8:12]
+	if count > 4 {
+		offset := int(bo.Uint32(entry[8:]))
+		if count > 1024 || offset < 0 || offset+count > len(data) {
+			return ""
+		}
+		raw = data[offset : offset+count]
+	} else if count >= 0 {
+		raw = raw[:count]
+	}
+	if i := bytes.IndexByte(raw, 0); i >= 0 {
+		raw = raw[:i]
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+// exifPlaceholder matches {exif.FIELD} in an output path, or
+// {exif.FIELD:FORMAT} with a Go time layout for dates
+var exifPlaceholder = regexp.MustCompile(`\{exif\.(\w+)(?::([^}]*))?\}`)
+
+// EXIFUnknown replaces EXIF placeholders whose field is missing from a file
+const EXIFUnknown = "unknown"
+
+// HasEXIFPlaceholder reports whether an output path contains {exif.FIELD}
+func HasEXIFPlaceholder(path string) bool {
+	return exifPlaceholder.MatchString(path)
+}
+
+// ExpandEXIF replaces the EXIF placeholders in path with the fields of e:
+// {exif.date} (2006-01-02, or {exif.date:LAYOUT} with a Go time layout, which
+// may contain slashes to make folders), {exif.camera}, {exif.make},
+// {exif.model}, {exif.lens} and {exif.iso}. Missing fields become
+// EXIFUnknown, and slashes in text fields become dashes.
+func ExpandEXIF(path string, e EXIF) (string, error) {
+	var err error
+	expanded := exifPlaceholder.ReplaceAllStringFunc(path, func(match string) string {
+		groups := exifPlaceholder.FindStringSubmatch(match)
+		field, layout := groups[1], groups[2]
+		if layout != "" && field != "date" {
+			err = fmt.Errorf("invalid placeholder: %s (only exif.date takes a format)", match)
+			return match
+		}
+
+		var value string
+		switch field {
+		case "date":
+			if e.Date.IsZero() {
+				return EXIFUnknown
+			}
+			if layout == "" {
+				layout = "2006-01-02"
+			}
+			return e.Date.Format(layout)
+		case "camera":
+			value = e.Camera()
+		case "make":
+			value = e.Make
+		case "model":
+			value = e.Model
+		case "lens":
+			value = e.Lens
+		case "iso":
+			if e.ISO > 0 {
+				value = strconv.Itoa(e.ISO)
+			}
+		default:
+			err = fmt.Errorf("invalid placeholder: %s (expected exif.date, exif.camera, exif.make, exif.model, exif.lens or exif.iso)", match)
+			return match
+		}
+		if value == "" {
+			return EXIFUnknown
+		}
+		return strings.NewReplacer("/", "-", "\\", "-").Replace(value)
+	})
+	return expanded, err
+}
@@ -0,0 +1,110 @@
+package image
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// tiffEntry is a tag of a test TIFF structure with its encoded value
+type tiffEntry struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte
+}
+
+func asciiEntry(tag uint16, s string) tiffEntry {
+	return tiffEntry{tag, 2, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+// buildTIFF returns a little-endian TIFF structure with ifd0, and exif as the
+// EXIF IFD
+func buildTIFF(ifd0, exif []tiffEntry) []byte {
+	le := binary.LittleEndian
+	data := []byte("II*\x00\x08\x00\x00\x00")
+	writeIFD := func(entries []tiffEntry) {
+		start := len(data)
+		extra := start + 2 + len(entries)*12 + 4
+		var values []byte
+		data = le.AppendUint16(data, uint16(len(entries)))
+		for _, e := range entries {
+			data = le.AppendUint16(data, e.tag)
+			data = le.AppendUint16(data, e.typ)
+			data = le.AppendUint32(data, e.count)
+			if len(e.value) <= 4 {
+				data = append(data, append(e.value, make([]byte, 4-len(e.value))...)...)
+			} else {
+				data = le.AppendUint32(data, uint32(extra+len(values)))
+				values = append(values, e.value...)
+			}
+		}
+		data = append(le.AppendUint32(data, 0), values...)
+	}
+	if exif != nil {
+		// The EXIF IFD follows IFD0 and its values
+		size := 8 + 2 + (len(ifd0)+1)*12 + 4
+		for _, e := range ifd0 {
+			if len(e.value) > 4 {
+				size += len(e.value)
+			}
+		}
+		ifd0 = append(ifd0, tiffEntry{0x8769, 4, 1, le.AppendUint32(nil, uint32(size))})
+	}
+	writeIFD(ifd0)
+	if exif != nil {
+		writeIFD(exif)
+	}
+	return data
+}
+
+func TestParseEXIF(t *testing.T) {
+	data := buildTIFF(
+		[]tiffEntry{asciiEntry(0x010F, "Canon"), asciiEntry(0x0110, "Canon EOS R5"), asciiEntry(0x0132, "2024:06:01 10:00:00")},
+		[]tiffEntry{asciiEntry(0x9003, "2023:12:24 18:30:05"), {0x8827, 3, 1, []byte{0x90, 0x01}}, asciiEntry(0xA434, "RF24-105mm F4 L IS USM")},
+	)
+	e := ParseEXIF(data)
+	if want := time.Date(2023, 12, 24, 18, 30, 5, 0, time.UTC); !e.Date.Equal(want) {
+		t.Errorf("date %v, expected the original date %v", e.Date, want)
+	}
+	if e.Camera() != "Canon EOS R5" || e.ISO != 400 || e.Lens != "RF24-105mm F4 L IS USM" {
+		t.Errorf("unexpected EXIF: %+v", e)
+	}
+
+	// The same structure in a JPEG APP1 segment
+	segment := append([]byte("Exif\x00\x00"), data...)
+	jpeg := append([]byte{0xFF, 0xD8, 0xFF, 0xE1, byte((len(segment) + 2) >> 8), byte(len(segment) + 2)}, segment...)
+	if got := ParseEXIF(append(jpeg, 0xFF, 0xD9)); got != e {
+		t.Errorf("JPEG EXIF %+v, expected %+v", got, e)
+	}
+
+	if got := ParseEXIF([]byte("GIF89a")); got != (EXIF{}) {
+		t.Errorf("expected no EXIF, got %+v", got)
+	}
+}
+
+func TestExpandEXIF(t *testing.T) {
+	e := EXIF{Date: time.Date(2023, 12, 24, 18, 30, 5, 0, time.UTC), Make: "NIKON CORPORATION", Model: "NIKON Z 6_2", ISO: 800}
+	tests := map[string]string{
+		"{exif.date:2006/01}/{name}.jpg": "2023/12/{name}.jpg",
+		"{exif.date}-{exif.iso}.webp":    "2023-12-24-800.webp",
+		"{exif.camera}/a.jpg":            "NIKON Z 6_2/a.jpg",
+		"{exif.model}-{exif.lens}.jpg":   "NIKON Z 6_2-unknown.jpg",
+		"photo.jpg":                      "photo.jpg",
+	}
+	for template, want := range tests {
+		if got, err := ExpandEXIF(template, e); err != nil || got != want {
+			t.Errorf("ExpandEXIF(%q) = %q, %v; expected %q", template, got, err, want)
+		}
+	}
+	if camera := (EXIF{Make: "OLYMPUS IMAGING CORP.", Model: "E-M1"}).Camera(); camera != "OLYMPUS E-M1" {
+		t.Errorf("expected the brand before the model, got %q", camera)
+	}
+	if got, _ := ExpandEXIF("{exif.date:2006}/{exif.model}.jpg", EXIF{Model: "A/B"}); got != "unknown/A-B.jpg" {
+		t.Errorf("expected unknown fields and no slashes, got %q", got)
+	}
+	for _, template := range []string{"{exif.gps}.jpg", "{exif.model:x}.jpg"} {
+		if _, err := ExpandEXIF(template, e); err == nil {
+			t.Errorf("expected an error for %q", template)
+		}
+	}
+}
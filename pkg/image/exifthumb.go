@@ -0,0 +1,202 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// Largest size of the thumbnails EmbedEXIFThumbnail is given by EncodeJPEG,
+// the size the EXIF spec recommends
+const (
+	EXIFThumbnailWidth  = 160
+	EXIFThumbnailHeight = 120
+)
+
+// ExtractEXIFThumbnail returns the JPEG thumbnail embedded in the EXIF data
+// of a JPEG file, or the smallest JPEG preview embedded in a TIFF-based RAW
+// file (DNG, CR2, NEF, ARW). Decoding it is much faster than decoding the
+// whole image.
+func ExtractEXIFThumbnail(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		start, end := exifSegment(data)
+		if start < 0 {
+			return nil, fmt.Errorf("no EXIF thumbnail: the JPEG has no EXIF data")
+		}
+		tiff, bo := exifTiff(data[start:end])
+		ifd1 := exifNextIFD(tiff, bo, bo.Uint32(tiff[4:]))
+		var offset, length uint32
+		exifEntries(tiff, bo, ifd1, func(entry []byte) {
+			values := tiffValues(tiff, bo, entry)
+			if len(values) == 0 {
+				return
+			}
+			switch bo.Uint16(entry) {
+			case 0x0201: // JPEGInterchangeFormat
+				offset = values[0]
+			case 0x0202: // JPEGInterchangeFormatLength
+				length = values[0]
+			}
+		})
+		if ifd1 == 0 || length < 2 || uint64(offset)+uint64(length) > uint64(len(tiff)) ||
+			!bytes.HasPrefix(tiff[offset:], []byte{0xFF, 0xD8}) {
+			return nil, fmt.Errorf("no EXIF thumbnail found")
+		}
+		return bytes.Clone(tiff[offset : offset+length]), nil
+
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		blobs, err := findEmbeddedJPEGs(data)
+		if err != nil {
+			return nil, err
+		}
+		// Lossless JPEG raw data is skipped because the standard decoder
+		// rejects it
+		sort.Slice(blobs, func(i, j int) bool { return blobs[i].length < blobs[j].length })
+		for _, blob := range blobs {
+			preview := data[blob.offset : blob.offset+blob.length]
+			if _, err := jpeg.DecodeConfig(bytes.NewReader(preview)); err == nil {
+				return bytes.Clone(preview), nil
+			}
+		}
+		return nil, fmt.Errorf("no embedded JPEG preview found")
+	}
+	return nil, fmt.Errorf("no EXIF thumbnail: not a JPEG or TIFF-based RAW file")
+}
+
+// EmbedEXIFThumbnail returns a JPEG file with thumb, itself a JPEG, as its
+// EXIF thumbnail. An EXIF segment is added if there is none; otherwise the
+// thumbnail is appended to it and replaces any earlier one, whose bytes are
+// left unreferenced. The EXIF data must stay below 64KB.
+func EmbedEXIFThumbnail(data, thumb []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte{0xFF, 0xD8}) {
+		return nil, fmt.Errorf("cannot embed a thumbnail: not a JPEG file")
+	}
+	if !bytes.HasPrefix(thumb, []byte{0xFF, 0xD8}) {
+		return nil, fmt.Errorf("cannot embed a thumbnail: the thumbnail is not a JPEG")
+	}
+
+	// Without EXIF data, start from an empty IFD0
+	start, end := exifSegment(data)
+	var tiff []byte
+	var bo binary.ByteOrder = binary.LittleEndian
+	if start >= 0 {
+		tiff, bo = exifTiff(data[start:end])
+		tiff = bytes.Clone(tiff)
+	} else {
+		start, end = 2, 2
+		if length, ok := jfifLength(data); ok {
+			start, end = 2+length, 2+length
+		}
+		tiff = []byte("II*\x00\x08\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	}
+	ifd0 := bo.Uint32(tiff[4:])
+	if uint64(ifd0)+2 > uint64(len(tiff)) {
+		return nil, fmt.Errorf("invalid EXIF IFD offset: %d", ifd0)
+	}
+	next := int(ifd0) + 2 + int(bo.Uint16(tiff[ifd0:]))*12
+	if next+4 > len(tiff) {
+		return nil, fmt.Errorf("truncated EXIF IFD")
+	}
+
+	// IFD1 with the compression and location of the thumbnail, word aligned
+	if len(tiff)%2 == 1 {
+		tiff = append(tiff, 0)
+	}
+	ifd1 := len(tiff)
+	bo.PutUint32(tiff[next:], uint32(ifd1))
+	ifd := make([]byte, 2+3*12+4)
+	bo.PutUint16(ifd, 3)
+	for i, entry := range [][3]uint32{
+		{0x0103, 3, 6},                       // Compression: JPEG, SHORT
+		{0x0201, 4, uint32(ifd1 + len(ifd))}, // JPEGInterchangeFormat, LONG
+		{0x0202, 4, uint32(len(thumb))},      // JPEGInterchangeFormatLength, LONG
+	} {
+		e := ifd[2+i*12:]
+		bo.PutUint16(e, uint16(entry[0]))
+		bo.PutUint16(e[2:], uint16(entry[1]))
+		bo.PutUint32(e[4:], 1)
+		if entry[1] == 3 {
+			bo.PutUint16(e[8:], uint16(entry[2]))
+		} else {
+			bo.PutUint32(e[8:], entry[2])
+		}
+	}
+	tiff = append(append(tiff, ifd...), thumb...)
+
+	length := 2 + 6 + len(tiff)
+	if length > 0xFFFF {
+		return nil, fmt.Errorf("EXIF thumbnail too large: %d bytes of EXIF data (at most 65533)", length-2)
+	}
+	segment := append([]byte{0xFF, 0xE1, byte(length >> 8), byte(length)}, "Exif\x00\x00"...)
+	segment = append(segment, tiff...)
+
+	out := make([]byte, 0, len(data)-(end-start)+len(segment))
+	out = append(out, data[:start]...)
+	out = append(out, segment...)
+	return append(out, data[end:]...), nil
+}
+
+// Thumbnail scales img down to fit within width x height, keeping its aspect
+// ratio. Smaller images are not enlarged, and no padding is added.
+func Thumbnail(img image.Image, width, height int) *image.NRGBA {
+	return imaging.Fit(img, width, height, imaging.Lanczos)
+}
+
+// exifThumbnail encodes a thumbnail of img for EmbedEXIFThumbnail
+func exifThumbnail(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	thumb := Thumbnail(img, EXIFThumbnailWidth, EXIFThumbnailHeight)
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 75}); err != nil {
+		return nil, fmt.Errorf("failed to encode EXIF thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// exifSegment returns the start and end of the APP1 EXIF segment of a JPEG
+// file, or -1 if there is none before the image data
+func exifSegment(data []byte) (int, int) {
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) {
+			break
+		}
+		if tiff, _ := exifTiff(data[pos:end]); tiff != nil {
+			return pos, end
+		}
+		pos = end
+	}
+	return -1, -1
+}
+
+// jfifLength returns the length of a JFIF segment right after the start of
+// image, which must stay first
+func jfifLength(data []byte) (int, bool) {
+	if len(data) < 11 || data[2] != 0xFF || data[3] != 0xE0 || string(data[6:11]) != "JFIF\x00" {
+		return 0, false
+	}
+	length := 2 + int(binary.BigEndian.Uint16(data[4:]))
+	return length, 2+length <= len(data)
+}
+
+// exifNextIFD returns the offset of the IFD that follows the IFD at offset,
+// or 0
+func exifNextIFD(tiff []byte, bo binary.ByteOrder, offset uint32) uint32 {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return 0
+	}
+	next := int(offset) + 2 + int(bo.Uint16(tiff[offset:]))*12
+	if next+4 > len(tiff) {
+		return 0
+	}
+	return bo.Uint32(tiff[next:])
+}
@@ -0,0 +1,99 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestEncodeJPEGThumbnail(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeJPEG(&buf, gradient(640, 480), 80, JPEGOptions{Thumbnail: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	data, err := ExtractEXIFThumbnail(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumb, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("thumbnail decode failed: %v", err)
+	}
+	if size := thumb.Bounds().Size(); size != image.Pt(EXIFThumbnailWidth, EXIFThumbnailHeight) {
+		t.Errorf("thumbnail of %v", size)
+	}
+
+	// The JFIF segment --density writes stays first
+	tagged, err := SetDensity(buf.Bytes(), 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExtractEXIFThumbnail(tagged); err != nil {
+		t.Errorf("after SetDensity: %v", err)
+	}
+}
+
+func TestEmbedEXIFThumbnail(t *testing.T) {
+	data := encodeJPEG(t, gradient(64, 48), false)
+	if _, err := ExtractEXIFThumbnail(data); err == nil {
+		t.Error("expected an error without EXIF data")
+	}
+
+	// An existing EXIF segment keeps its IFD0 and gets the new thumbnail
+	exif := []byte{0xFF, 0xE1, 0, 34, 'E', 'x', 'i', 'f', 0, 0,
+		'M', 'M', 0, 42, 0, 0, 0, 8,
+		0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, 6, 0, 0,
+		0, 0, 0, 0}
+	data = append(append([]byte{0xFF, 0xD8}, exif...), data[2:]...)
+	for _, size := range []int{8, 20} {
+		thumb := encodeJPEG(t, gradient(size, size), false)
+		var err error
+		if data, err = EmbedEXIFThumbnail(data, thumb); err != nil {
+			t.Fatal(err)
+		}
+		extracted, err := ExtractEXIFThumbnail(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(extracted, thumb) {
+			t.Errorf("%dx%d: extracted %d bytes, expected %d", size, size, len(extracted), len(thumb))
+		}
+	}
+	start, end := exifSegment(data)
+	if orientation := exifTag(data[start:end], 0x0112, 0); orientation != 6 {
+		t.Errorf("orientation %d, expected 6", orientation)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("decode failed: %v", err)
+	}
+
+	large := encodeJPEG(t, noise(512, 512), false)
+	if _, err := EmbedEXIFThumbnail(data, large); err == nil {
+		t.Error("expected an error for a thumbnail over 64KB")
+	}
+	if _, err := EmbedEXIFThumbnail(data, []byte("not a JPEG")); err == nil {
+		t.Error("expected an error for a thumbnail that is not a JPEG")
+	}
+}
+
+func TestExtractEXIFThumbnailRaw(t *testing.T) {
+	small, _ := createTestImage(16, 12, color.RGBA{255, 0, 0, 255})
+	large, _ := createTestImage(64, 48, color.RGBA{0, 0, 255, 255})
+	data, err := ExtractEXIFThumbnail(buildRawFile(t, large, small))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The smallest preview wins
+	if config, err := jpeg.DecodeConfig(bytes.NewReader(data)); err != nil || config.Width != 16 {
+		t.Errorf("preview %dx%d, %v; expected 16x12", config.Width, config.Height, err)
+	}
+
+	if _, err := ExtractEXIFThumbnail([]byte("GIF89a")); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,346 @@
+package image
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"sort"
+)
+
+// OpenEXR compression methods
+const (
+	exrCompressionNone = 0
+	exrCompressionRLE  = 1
+	exrCompressionZIPS = 2
+	exrCompressionZIP  = 3
+	exrCompressionPIZ  = 4
+)
+
+// OpenEXR channel pixel types
+const (
+	exrPixelUint  = 0
+	exrPixelHalf  = 1
+	exrPixelFloat = 2
+)
+
+func init() {
+	RegisterCodec(Codec{
+		Name:       "OpenEXR",
+		Extensions: []string{"exr"},
+		Decode: func(r io.Reader, options ProcessOptions) (image.Image, error) {
+			img, err := DecodeEXR(r)
+			if err != nil {
+				return nil, err
+			}
+			return ToneMap(img, options.HDR)
+		},
+	})
+}
+
+var exrCompressionNames = []string{"none", "RLE", "ZIPS", "ZIP", "PIZ", "PXR24", "B44", "B44A", "DWAA", "DWAB"}
+
+// exrChannel describes one channel of an OpenEXR image
+type exrChannel struct {
+	name      string
+	pixelType int32
+}
+
+// size returns the number of bytes per sample
+func (c exrChannel) size() int {
+	if c.pixelType == exrPixelHalf {
+		return 2
+	}
+	return 4
+}
+
+// DecodeEXR decodes a single-part scanline OpenEXR image. Uncompressed, RLE,
+// ZIPS and ZIP compression are supported, which covers the defaults of most
+// renderers; tiled, deep and multi-part files are rejected.
+func DecodeEXR(r io.Reader) (*FloatImage, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EXR file: %w", err)
+	}
+	if len(data) < 8 || binary.LittleEndian.Uint32(data) != 20000630 {
+		return nil, fmt.Errorf("not an OpenEXR file")
+	}
+	flags := binary.LittleEndian.Uint32(data[4:]) >> 8
+	if flags&0x02 != 0 {
+		return nil, fmt.Errorf("tiled OpenEXR images are not supported")
+	}
+	if flags&0x18 != 0 {
+		return nil, fmt.Errorf("deep and multi-part OpenEXR images are not supported")
+	}
+
+	// Header attributes
+	pos := 8
+	readString := func() (string, error) {
+		end := bytes.IndexByte(data[pos:], 0)
+		if end < 0 {
+			return "", fmt.Errorf("truncated EXR header")
+		}
+		s := string(data[pos : pos+end])
+		pos += end + 1
+		return s, nil
+	}
+
+	var channels []exrChannel
+	var window image.Rectangle
+	compression := -1
+	for {
+		name, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			break
+		}
+		if _, err := readString(); err != nil {
+			return nil, err
+		}
+		if pos+4 > len(data) {
+			return nil, fmt.Errorf("truncated EXR header")
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos:]))
+		pos += 4
+		if size < 0 || pos+size > len(data) {
+			return nil, fmt.Errorf("truncated EXR header")
+		}
+		value := data[pos : pos+size]
+		pos += size
+
+		switch name {
+		case "channels":
+			for len(value) > 1 {
+				end := bytes.IndexByte(value, 0)
+				if end < 0 || len(value) < end+17 {
+					return nil, fmt.Errorf("invalid EXR channel list")
+				}
+				channels = append(channels, exrChannel{
+					name:      string(value[:end]),
+					pixelType: int32(binary.LittleEndian.Uint32(value[end+1:])),
+				})
+				xSampling := binary.LittleEndian.Uint32(value[end+9:])
+				ySampling := binary.LittleEndian.Uint32(value[end+13:])
+				if xSampling != 1 || ySampling != 1 {
+					return nil, fmt.Errorf("subsampled EXR channels are not supported")
+				}
+				value = value[end+17:]
+			}
+		case "compression":
+			if len(value) != 1 {
+				return nil, fmt.Errorf("invalid EXR compression attribute")
+			}
+			compression = int(value[0])
+		case "dataWindow":
+			if len(value) != 16 {
+				return nil, fmt.Errorf("invalid EXR data window")
+			}
+			xMin := int(int32(binary.LittleEndian.Uint32(value)))
+			yMin := int(int32(binary.LittleEndian.Uint32(value[4:])))
+			xMax := int(int32(binary.LittleEndian.Uint32(value[8:])))
+			yMax := int(int32(binary.LittleEndian.Uint32(value[12:])))
+			window = image.Rect(xMin, yMin, xMax+1, yMax+1)
+		}
+	}
+
+	if len(channels) == 0 || window.Empty() {
+		return nil, fmt.Errorf("EXR file has no channels or an empty data window")
+	}
+	for _, c := range channels {
+		if c.pixelType < exrPixelUint || c.pixelType > exrPixelFloat {
+			return nil, fmt.Errorf("invalid EXR pixel type for channel %s", c.name)
+		}
+	}
+	// Channels are stored in alphabetical order
+	sort.Slice(channels, func(i, j int) bool { return channels[i].name < channels[j].name })
+
+	var linesPerBlock int
+	switch compression {
+	case exrCompressionNone, exrCompressionRLE, exrCompressionZIPS:
+		linesPerBlock = 1
+	case exrCompressionZIP:
+		linesPerBlock = 16
+	default:
+		name := fmt.Sprint(compression)
+		if compression >= 0 && compression < len(exrCompressionNames) {
+			name = exrCompressionNames[compression]
+		}
+		return nil, fmt.Errorf("unsupported EXR compression: %s", name)
+	}
+
+	width, height := window.Dx(), window.Dy()
+	lineSize := 0
+	for _, c := range channels {
+		lineSize += c.size() * width
+	}
+
+	img := NewFloatImage(image.Rect(0, 0, width, height))
+	// Images without alpha are opaque
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 1
+	}
+
+	blocks := (height + linesPerBlock - 1) / linesPerBlock
+	if pos+blocks*8 > len(data) {
+		return nil, fmt.Errorf("truncated EXR offset table")
+	}
+	for b := 0; b < blocks; b++ {
+		offset := int(binary.LittleEndian.Uint64(data[pos+b*8:]))
+		if offset < 0 || offset+8 > len(data) {
+			return nil, fmt.Errorf("invalid EXR chunk offset")
+		}
+		y := int(int32(binary.LittleEndian.Uint32(data[offset:]))) - window.Min.Y
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		if y < 0 || y >= height || size < 0 || offset+8+size > len(data) {
+			return nil, fmt.Errorf("invalid EXR chunk")
+		}
+		lines := min(linesPerBlock, height-y)
+		chunk := data[offset+8 : offset+8+size]
+
+		// Chunks that would not shrink are stored uncompressed
+		if compression != exrCompressionNone && size < lines*lineSize {
+			var err error
+			chunk, err = exrDecompress(chunk, compression, lines*lineSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(chunk) < lines*lineSize {
+			return nil, fmt.Errorf("truncated EXR chunk")
+		}
+
+		for line := 0; line < lines; line++ {
+			row := chunk[line*lineSize:]
+			pix := img.Pix[(y+line)*img.Stride:]
+			for _, c := range channels {
+				target := exrChannelIndex(c.name)
+				for x := 0; x < width; x++ {
+					var v float32
+					switch c.pixelType {
+					case exrPixelHalf:
+						v = halfToFloat(binary.LittleEndian.Uint16(row[x*2:]))
+					case exrPixelFloat:
+						v = math.Float32frombits(binary.LittleEndian.Uint32(row[x*4:]))
+					default:
+						v = float32(binary.LittleEndian.Uint32(row[x*4:]))
+					}
+					switch target {
+					case -1:
+					case 4: // Luminance
+						pix[x*4], pix[x*4+1], pix[x*4+2] = v, v, v
+					default:
+						pix[x*4+target] = v
+					}
+				}
+				row = row[c.size()*width:]
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// exrChannelIndex maps a channel name to its sample index in a FloatImage
+// pixel, 4 for luminance, or -1 for channels that are ignored
+func exrChannelIndex(name string) int {
+	switch name {
+	case "R":
+		return 0
+	case "G":
+		return 1
+	case "B":
+		return 2
+	case "A":
+		return 3
+	case "Y":
+		return 4
+	}
+	return -1
+}
+
+// exrDecompress decompresses an RLE or ZIP chunk and reverses the byte
+// predictor and interleaving applied before compression
+func exrDecompress(chunk []byte, compression, expected int) ([]byte, error) {
+	var tmp []byte
+	switch compression {
+	case exrCompressionRLE:
+		tmp = make([]byte, 0, expected)
+		for i := 0; i < len(chunk); {
+			count := int(int8(chunk[i]))
+			i++
+			if count < 0 {
+				n := -count
+				if i+n > len(chunk) {
+					return nil, fmt.Errorf("corrupt EXR RLE data")
+				}
+				tmp = append(tmp, chunk[i:i+n]...)
+				i += n
+			} else {
+				if i >= len(chunk) {
+					return nil, fmt.Errorf("corrupt EXR RLE data")
+				}
+				for n := 0; n <= count; n++ {
+					tmp = append(tmp, chunk[i])
+				}
+				i++
+			}
+		}
+	case exrCompressionZIPS, exrCompressionZIP:
+		zr, err := zlib.NewReader(bytes.NewReader(chunk))
+		if err != nil {
+			return nil, fmt.Errorf("corrupt EXR ZIP data: %w", err)
+		}
+		tmp, err = io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt EXR ZIP data: %w", err)
+		}
+	}
+	if len(tmp) != expected {
+		return nil, fmt.Errorf("corrupt EXR chunk: expected %d bytes, got %d", expected, len(tmp))
+	}
+
+	// Undo the delta predictor
+	for i := 1; i < len(tmp); i++ {
+		tmp[i] = byte(int(tmp[i-1]) + int(tmp[i]) - 128)
+	}
+
+	// De-interleave: the first half holds even bytes, the second half odd bytes
+	out := make([]byte, len(tmp))
+	half := (len(tmp) + 1) / 2
+	for i := range out {
+		if i%2 == 0 {
+			out[i] = tmp[i/2]
+		} else {
+			out[i] = tmp[half+i/2]
+		}
+	}
+	return out, nil
+}
+
+// halfToFloat converts an IEEE 754 half-precision value to float32
+func halfToFloat(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h) & 0x3ff
+
+	switch {
+	case exp == 0 && mant == 0:
+		return math.Float32frombits(sign)
+	case exp == 0:
+		// Subnormal: normalize the mantissa
+		for mant&0x400 == 0 {
+			mant <<= 1
+			exp--
+		}
+		exp++
+		mant &= 0x3ff
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	}
+	return math.Float32frombits(sign | (exp+112)<<23 | mant<<13)
+}
@@ -0,0 +1,135 @@
+package image
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// buildEXR creates a scanline OpenEXR file with float R, G and B channels set
+// to the given color, stored uncompressed or with ZIPS compression
+func buildEXR(t *testing.T, width, height int, rgb [3]float32, compression byte) []byte {
+	t.Helper()
+	le := binary.LittleEndian
+
+	var header bytes.Buffer
+	attribute := func(name, typ string, value []byte) {
+		header.WriteString(name + "\x00" + typ + "\x00")
+		binary.Write(&header, le, int32(len(value)))
+		header.Write(value)
+	}
+
+	var chlist bytes.Buffer
+	for _, name := range []string{"B", "G", "R"} {
+		chlist.WriteString(name + "\x00")
+		binary.Write(&chlist, le, []int32{exrPixelFloat, 0, 1, 1})
+	}
+	chlist.WriteByte(0)
+	attribute("channels", "chlist", chlist.Bytes())
+	attribute("compression", "compression", []byte{compression})
+	window := new(bytes.Buffer)
+	binary.Write(window, le, []int32{0, 0, int32(width - 1), int32(height - 1)})
+	attribute("dataWindow", "box2i", window.Bytes())
+	attribute("displayWindow", "box2i", window.Bytes())
+	attribute("lineOrder", "lineOrder", []byte{0})
+	header.WriteByte(0)
+
+	// One scanline per chunk: B, G, R planes
+	var line bytes.Buffer
+	for _, v := range []float32{rgb[2], rgb[1], rgb[0]} {
+		for x := 0; x < width; x++ {
+			binary.Write(&line, le, math.Float32bits(v))
+		}
+	}
+	chunk := line.Bytes()
+	if compression == exrCompressionZIPS {
+		// Interleave, apply the predictor, then deflate
+		tmp := make([]byte, len(chunk))
+		half := (len(chunk) + 1) / 2
+		for i, b := range chunk {
+			if i%2 == 0 {
+				tmp[i/2] = b
+			} else {
+				tmp[half+i/2] = b
+			}
+		}
+		for i := len(tmp) - 1; i > 0; i-- {
+			tmp[i] = byte(int(tmp[i]) - int(tmp[i-1]) + 128)
+		}
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		zw.Write(tmp)
+		zw.Close()
+		chunk = compressed.Bytes()
+	}
+
+	var file bytes.Buffer
+	binary.Write(&file, le, uint32(20000630))
+	binary.Write(&file, le, uint32(2))
+	file.Write(header.Bytes())
+	chunkStart := file.Len() + height*8
+	for y := 0; y < height; y++ {
+		binary.Write(&file, le, uint64(chunkStart+y*(8+len(chunk))))
+	}
+	for y := 0; y < height; y++ {
+		binary.Write(&file, le, int32(y))
+		binary.Write(&file, le, int32(len(chunk)))
+		file.Write(chunk)
+	}
+	return file.Bytes()
+}
+
+func TestDecodeEXR(t *testing.T) {
+	testCases := []struct {
+		name        string
+		compression byte
+	}{
+		{"Uncompressed", exrCompressionNone},
+		{"ZIPS", exrCompressionZIPS},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := buildEXR(t, 64, 4, [3]float32{2.5, 0.5, 0}, tc.compression)
+			img, err := DecodeEXR(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("DecodeEXR failed: %v", err)
+			}
+			if img.Rect.Dx() != 64 || img.Rect.Dy() != 4 {
+				t.Fatalf("Expected 64x4, got %dx%d", img.Rect.Dx(), img.Rect.Dy())
+			}
+			i := img.PixOffset(63, 3)
+			if got := img.Pix[i : i+4]; got[0] != 2.5 || got[1] != 0.5 || got[2] != 0 || got[3] != 1 {
+				t.Errorf("Unexpected pixel value %v", got)
+			}
+		})
+	}
+}
+
+func TestDecodeEXRUnsupported(t *testing.T) {
+	data := buildEXR(t, 4, 4, [3]float32{1, 1, 1}, exrCompressionPIZ)
+	if _, err := DecodeEXR(bytes.NewReader(data)); err == nil {
+		t.Errorf("Expected an error for PIZ compression")
+	}
+	if _, err := DecodeEXR(bytes.NewReader([]byte("not an exr file"))); err == nil {
+		t.Errorf("Expected an error for a non-EXR file")
+	}
+}
+
+func TestHalfToFloat(t *testing.T) {
+	testCases := map[uint16]float32{
+		0x0000: 0,
+		0x3C00: 1,
+		0xC000: -2,
+		0x3800: 0.5,
+		0x7BFF: 65504,
+		0x0001: float32(math.Ldexp(1, -24)),
+	}
+	for h, expected := range testCases {
+		if got := halfToFloat(h); got != expected {
+			t.Errorf("halfToFloat(%#04x) = %v, expected %v", h, got, expected)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package image
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+)
+
+func init() {
+	RegisterCodec(Codec{
+		Name:       "farbfeld",
+		Extensions: []string{"ff", "farbfeld"},
+		Decode: func(r io.Reader, options ProcessOptions) (image.Image, error) {
+			return DecodeFarbfeld(r)
+		},
+		Encode: func(w io.Writer, img image.Image, options ProcessOptions) error {
+			return EncodeFarbfeld(w, img)
+		},
+	})
+}
+
+// DecodeFarbfeld decodes a farbfeld image: a magic string, the dimensions,
+// then big-endian 16-bit non-premultiplied RGBA samples
+func DecodeFarbfeld(r io.Reader) (*image.NRGBA64, error) {
+	var header [16]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || string(header[:8]) != "farbfeld" {
+		return nil, fmt.Errorf("not a farbfeld file")
+	}
+	width := int(binary.BigEndian.Uint32(header[8:]))
+	height := int(binary.BigEndian.Uint32(header[12:]))
+	if width <= 0 || height <= 0 || width > 1<<20 || height > 1<<20 {
+		return nil, fmt.Errorf("invalid farbfeld dimensions: %dx%d", width, height)
+	}
+
+	// The pixel layout matches image.NRGBA64 exactly
+	img := image.NewNRGBA64(image.Rect(0, 0, width, height))
+	if _, err := io.ReadFull(r, img.Pix); err != nil {
+		return nil, fmt.Errorf("failed to read farbfeld data: %w", err)
+	}
+	return img, nil
+}
+
+// EncodeFarbfeld writes img as a farbfeld image
+func EncodeFarbfeld(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	src, ok := img.(*image.NRGBA64)
+	if !ok || b.Min != (image.Point{}) || src.Stride != b.Dx()*8 {
+		src = image.NewNRGBA64(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	}
+
+	bw := bufio.NewWriter(w)
+	var header [16]byte
+	copy(header[:], "farbfeld")
+	binary.BigEndian.PutUint32(header[8:], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(header[12:], uint32(b.Dy()))
+	bw.Write(header[:])
+	bw.Write(src.Pix[:b.Dy()*src.Stride])
+	return bw.Flush()
+}
@@ -0,0 +1,57 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFarbfeldRoundTrip(t *testing.T) {
+	img := image.NewNRGBA64(image.Rect(0, 0, 3, 2))
+	img.SetNRGBA64(0, 0, color.NRGBA64{0x1234, 0x5678, 0x9abc, 0xffff})
+	img.SetNRGBA64(2, 1, color.NRGBA64{0xffff, 0, 0x8000, 0x4000})
+
+	var buf bytes.Buffer
+	if err := EncodeFarbfeld(&buf, img); err != nil {
+		t.Fatalf("EncodeFarbfeld failed: %v", err)
+	}
+	if buf.Len() != 16+3*2*8 {
+		t.Fatalf("Unexpected file size %d", buf.Len())
+	}
+
+	decoded, err := DecodeFarbfeld(&buf)
+	if err != nil {
+		t.Fatalf("DecodeFarbfeld failed: %v", err)
+	}
+	if !bytes.Equal(decoded.Pix, img.Pix) {
+		t.Errorf("Round trip changed pixel data")
+	}
+}
+
+func TestEncodeFarbfeldConvertsImages(t *testing.T) {
+	// 8-bit images with an offset origin are converted
+	img := image.NewNRGBA(image.Rect(5, 5, 7, 6))
+	img.SetNRGBA(6, 5, color.NRGBA{255, 0, 0, 128})
+
+	var buf bytes.Buffer
+	if err := EncodeFarbfeld(&buf, img); err != nil {
+		t.Fatalf("EncodeFarbfeld failed: %v", err)
+	}
+	decoded, err := DecodeFarbfeld(&buf)
+	if err != nil {
+		t.Fatalf("DecodeFarbfeld failed: %v", err)
+	}
+	if got := decoded.NRGBA64At(1, 0); got != (color.NRGBA64{0xffff, 0, 0, 0x8080}) {
+		t.Errorf("Unexpected pixel %v", got)
+	}
+}
+
+func TestDecodeFarbfeldInvalid(t *testing.T) {
+	if _, err := DecodeFarbfeld(bytes.NewReader([]byte("farbfelt\x00\x00\x00\x01\x00\x00\x00\x01"))); err == nil {
+		t.Errorf("Expected an error for a bad magic string")
+	}
+	if _, err := DecodeFarbfeld(bytes.NewReader([]byte("farbfeld\x00\x00\x00\x02\x00\x00\x00\x02short"))); err == nil {
+		t.Errorf("Expected an error for truncated pixel data")
+	}
+}
@@ -0,0 +1,112 @@
+package image
+
+import (
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Format describes how this build of nim supports an image format
+type Format struct {
+	Name       string   // Human-readable format name
+	Extensions []string // File extensions without the leading dot
+	Read       bool     // Whether the format can be decoded
+	Write      bool     // Whether the format can be encoded
+	CGO        bool     // Whether support links a C library through cgo
+	Tools      []string // External programs decoding needs, any one of which will do
+	Enabled    bool     // Whether the requirements are met by this binary and PATH
+	Note       string   // Limitations, or the missing requirement when disabled
+}
+
+// builtinFormats are the formats OpenImageWithOptions and Encode handle
+// without the codec registry
+var builtinFormats = []Format{
+	{Name: "JPEG", Extensions: []string{"jpg", "jpeg"}, Read: true, Write: true},
+	{Name: "PNG", Extensions: []string{"png"}, Read: true, Write: true},
+	{Name: "GIF", Extensions: []string{"gif"}, Read: true, Write: true, Note: "first frame only"},
+	{Name: "BMP", Extensions: []string{"bmp"}, Read: true, Write: true},
+	{Name: "TIFF", Extensions: []string{"tiff", "tif"}, Read: true, Write: true},
+	{Name: "WebP", Extensions: []string{"webp"}, Read: true, Write: true, CGO: true},
+	{Name: "AVIF", Extensions: []string{"avif"}, Read: true, Write: true},
+	{Name: "ICO", Extensions: []string{"ico"}, Read: true, Write: true},
+	{Name: "ICNS", Extensions: []string{"icns"}, Read: true, Write: true},
+	{Name: "HEIF", Extensions: []string{"heic", "heif"}, Read: true, CGO: true, Note: "no Go encoder is available"},
+	{Name: "JPEG XL", Extensions: []string{"jxl"}, Read: true, Note: "no Go encoder is available"},
+}
+
+// opaqueFormats are the output formats that cannot store transparency
+var opaqueFormats = []string{"jpg", "jpeg", "pbm", "pgm", "ppm", "pnm", "pdf"}
+
+// SupportsAlpha reports whether output in a format, given by its extension,
+// keeps transparent pixels. Unknown formats are assumed to.
+func SupportsAlpha(format string) bool {
+	return !slices.Contains(opaqueFormats, strings.ToLower(strings.TrimPrefix(format, ".")))
+}
+
+// Formats returns the built-in and registered formats sorted by name. A
+// format is enabled when nim was built with cgo if it needs it, and when one
+// of the tools it needs is found in PATH.
+func Formats() []Format {
+	formats := slices.Clone(builtinFormats)
+	for _, codec := range Codecs() {
+		formats = append(formats, Format{
+			Name:       codec.Name,
+			Extensions: codec.Extensions,
+			Read:       codec.Decode != nil,
+			Write:      codec.Encode != nil,
+			CGO:        codec.CGO,
+			Tools:      codec.Tools,
+			Note:       codec.Note,
+		})
+	}
+
+	for i, format := range formats {
+		formats[i].Enabled = true
+		if format.CGO && !cgoEnabled {
+			formats[i].Enabled = false
+			formats[i].Note = "requires a build with cgo"
+		} else if len(format.Tools) > 0 && !anyInstalled(format.Tools) {
+			formats[i].Enabled = false
+			note := "reading requires " + orList(format.Tools) + " in PATH"
+			if format.Note != "" {
+				note += "; " + format.Note
+			}
+			formats[i].Note = note
+		}
+	}
+	sort.Slice(formats, func(i, j int) bool {
+		return strings.ToLower(formats[i].Name) < strings.ToLower(formats[j].Name)
+	})
+	return formats
+}
+
+// anyInstalled reports whether any of the programs is found in PATH
+func anyInstalled(programs []string) bool {
+	for _, program := range programs {
+		if _, err := exec.LookPath(program); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// orList joins names as "a, b or c"
+func orList(names []string) string {
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// ReadableExtensions returns the file extensions of the formats this binary
+// can decode
+func ReadableExtensions() []string {
+	var extensions []string
+	for _, format := range Formats() {
+		if format.Read && format.Enabled {
+			extensions = append(extensions, format.Extensions...)
+		}
+	}
+	return extensions
+}
@@ -0,0 +1,77 @@
+package image
+
+import (
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFormats(t *testing.T) {
+	formats := Formats()
+
+	byName := make(map[string]Format)
+	for i, format := range formats {
+		byName[format.Name] = format
+		if i > 0 && strings.ToLower(formats[i-1].Name) > strings.ToLower(format.Name) {
+			t.Errorf("Expected formats sorted by name, got %s before %s", formats[i-1].Name, format.Name)
+		}
+	}
+
+	// Built-in formats and registered codecs are both listed
+	for _, name := range []string{"JPEG", "PNG", "WebP", "HEIF", "PDF", "Camera RAW", "TGA"} {
+		if _, ok := byName[name]; !ok {
+			t.Errorf("Expected %s to be listed", name)
+		}
+	}
+
+	if jpeg := byName["JPEG"]; !jpeg.Read || !jpeg.Write || !jpeg.Enabled || jpeg.CGO {
+		t.Errorf("Unexpected JPEG support: %+v", jpeg)
+	}
+	if heif := byName["HEIF"]; !heif.Read || heif.Write || !heif.CGO || heif.Enabled != cgoEnabled {
+		t.Errorf("Unexpected HEIF support: %+v", heif)
+	}
+	if psd := byName["Photoshop"]; !psd.Read || psd.Write {
+		t.Errorf("Expected Photoshop to be read-only: %+v", psd)
+	}
+
+	// PDF decoding needs one of the renderers in PATH
+	pdf := byName["PDF"]
+	if !slices.Equal(pdf.Tools, []string{"pdftoppm", "mutool", "gs"}) {
+		t.Errorf("Unexpected PDF tools: %v", pdf.Tools)
+	}
+	installed := false
+	for _, tool := range pdf.Tools {
+		if _, err := exec.LookPath(tool); err == nil {
+			installed = true
+		}
+	}
+	if pdf.Enabled != installed {
+		t.Errorf("Expected PDF enabled to be %v, got %+v", installed, pdf)
+	}
+	if !pdf.Enabled && !strings.Contains(pdf.Note, "pdftoppm, mutool or gs") {
+		t.Errorf("Expected the note to name the missing tools, got %q", pdf.Note)
+	}
+}
+
+func TestReadableExtensions(t *testing.T) {
+	extensions := ReadableExtensions()
+	for _, ext := range []string{"jpg", "png", "psd", "svg"} {
+		if !slices.Contains(extensions, ext) {
+			t.Errorf("Expected %s to be readable, got %v", ext, extensions)
+		}
+	}
+	for _, format := range Formats() {
+		if !format.Enabled && slices.Contains(extensions, format.Extensions[0]) {
+			t.Errorf("Expected disabled format %s not to be readable", format.Name)
+		}
+	}
+}
+
+func TestSupportsAlpha(t *testing.T) {
+	for format, want := range map[string]bool{"png": true, ".WEBP": true, "jpg": false, "JPEG": false, "ppm": false, "": true} {
+		if got := SupportsAlpha(format); got != want {
+			t.Errorf("SupportsAlpha(%q) = %v, expected %v", format, got, want)
+		}
+	}
+}
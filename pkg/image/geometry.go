@@ -0,0 +1,82 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"nim/pkg/colorparse"
+)
+
+// ParseSize parses a size in the form WIDTHxHEIGHT
+func ParseSize(size string) (int, int, error) {
+	parts := strings.Split(size, "x")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid size format: %s (expected WIDTHxHEIGHT)", size)
+	}
+
+	w, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid width in size: %s", parts[0])
+	}
+
+	h, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid height in size: %s", parts[1])
+	}
+
+	return w, h, nil
+}
+
+// ParseHexColor parses a color, such as #RRGGBB, #RRGGBBAA, rgb(R,G,B),
+// transparent or a CSS color name (see colorparse.Parse)
+func ParseHexColor(value string) (color.NRGBA, error) {
+	return colorparse.Parse(value)
+}
+
+// FlattenColor composites c over white, as viewers show transparency, for
+// outputs that cannot store it
+func FlattenColor(c color.NRGBA) color.NRGBA {
+	over := func(v uint8) uint8 {
+		return uint8((int(v)*int(c.A) + 255*(255-int(c.A)) + 127) / 255)
+	}
+	return color.NRGBA{over(c.R), over(c.G), over(c.B), 255}
+}
+
+// ParseGeometry parses a region in the form WIDTHxHEIGHT+X+Y. The offset is
+// optional and defaults to the top-left corner.
+func ParseGeometry(geometry string) (image.Rectangle, error) {
+	invalid := fmt.Errorf("invalid region: %s (expected WIDTHxHEIGHT+X+Y)", geometry)
+
+	size, offset, _ := strings.Cut(geometry, "+")
+	w, h, ok := strings.Cut(size, "x")
+	if !ok {
+		return image.Rectangle{}, invalid
+	}
+	width, err := strconv.Atoi(w)
+	if err != nil || width <= 0 {
+		return image.Rectangle{}, invalid
+	}
+	height, err := strconv.Atoi(h)
+	if err != nil || height <= 0 {
+		return image.Rectangle{}, invalid
+	}
+
+	x, y := 0, 0
+	if offset != "" {
+		xs, ys, ok := strings.Cut(offset, "+")
+		if !ok {
+			return image.Rectangle{}, invalid
+		}
+		if x, err = strconv.Atoi(xs); err != nil || x < 0 {
+			return image.Rectangle{}, invalid
+		}
+		if y, err = strconv.Atoi(ys); err != nil || y < 0 {
+			return image.Rectangle{}, invalid
+		}
+	}
+
+	return image.Rect(x, y, x+width, y+height), nil
+}
@@ -0,0 +1,71 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	w, h, err := ParseSize("1024x768")
+	if err != nil || w != 1024 || h != 768 {
+		t.Errorf("Expected 1024x768, got %dx%d (%v)", w, h, err)
+	}
+	for _, invalid := range []string{"1024", "1024x", "x768", "axb", "1x2x3"} {
+		if _, _, err := ParseSize(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestParseHexColor(t *testing.T) {
+	for _, value := range []string{"#FF8000", "ff8000", "#ff8000ff", "rgb(255, 128, 0)"} {
+		c, err := ParseHexColor(value)
+		if err != nil || c != (color.NRGBA{255, 128, 0, 255}) {
+			t.Errorf("%s: expected {255 128 0 255}, got %v (%v)", value, c, err)
+		}
+	}
+	// The alpha is kept
+	for value, expected := range map[string]color.NRGBA{
+		"transparent": {0, 0, 0, 0},
+		"#FF800080":   {255, 128, 0, 128},
+	} {
+		if c, err := ParseHexColor(value); err != nil || c != expected {
+			t.Errorf("%s: expected %v, got %v (%v)", value, expected, c, err)
+		}
+	}
+	for _, invalid := range []string{"#GGGGGG", ""} {
+		if _, err := ParseHexColor(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestFlattenColor(t *testing.T) {
+	for c, expected := range map[color.NRGBA]color.NRGBA{
+		{255, 0, 0, 255}: {255, 0, 0, 255},
+		{0, 0, 0, 0}:     {255, 255, 255, 255},
+		{0, 0, 0, 128}:   {127, 127, 127, 255},
+	} {
+		if got := FlattenColor(c); got != expected {
+			t.Errorf("%v: expected %v, got %v", c, expected, got)
+		}
+	}
+}
+
+func TestParseGeometry(t *testing.T) {
+	tests := map[string]image.Rectangle{
+		"400x300+10+20": image.Rect(10, 20, 410, 320),
+		"400x300":       image.Rect(0, 0, 400, 300),
+	}
+	for geometry, expected := range tests {
+		if rect, err := ParseGeometry(geometry); err != nil || rect != expected {
+			t.Errorf("%s: expected %v, got %v (%v)", geometry, expected, rect, err)
+		}
+	}
+	for _, invalid := range []string{"400", "0x300", "400x300+10", "400x300+-1+0", "400x300+a+b"} {
+		if _, err := ParseGeometry(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
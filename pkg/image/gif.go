@@ -0,0 +1,111 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"slices"
+)
+
+// GIFOptions controls the palette of GIF output
+type GIFOptions struct {
+	Colors  int  // Size of a palette chosen from the image colors, from 2 to 256; 0 uses the fixed 256-color Plan 9 palette
+	Nearest bool // Map each pixel to the nearest palette color instead of dithering
+}
+
+// EncodeGIF writes img as a single-frame GIF with options
+func EncodeGIF(w io.Writer, img image.Image, options GIFOptions) error {
+	encoder := &gif.Options{NumColors: 256}
+	if options.Colors != 0 {
+		if options.Colors < 2 || options.Colors > 256 {
+			return fmt.Errorf("invalid GIF palette size: %d (expected 2-256)", options.Colors)
+		}
+		encoder.NumColors = options.Colors
+		encoder.Quantizer = medianCut{}
+	}
+	if options.Nearest {
+		encoder.Drawer = draw.Src
+	}
+	return gif.Encode(w, img, encoder)
+}
+
+// medianCut is a draw.Quantizer that splits the colors of an image at the
+// median of their widest channel until the palette is full, and uses the
+// mean color of each part
+type medianCut struct{}
+
+func (medianCut) Quantize(p color.Palette, m image.Image) color.Palette {
+	// Sample large images on a grid of at most 65536 pixels
+	b := m.Bounds()
+	step := 1
+	for (b.Dx()/step)*(b.Dy()/step) > 1<<16 {
+		step++
+	}
+	var pixels [][3]uint8
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			r, g, b, _ := m.At(x, y).RGBA()
+			pixels = append(pixels, [3]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)})
+		}
+	}
+	if len(pixels) == 0 {
+		return p
+	}
+
+	boxes := [][][3]uint8{pixels}
+	for len(boxes) < cap(p)-len(p) {
+		best, channel, width := -1, 0, 0
+		for i, box := range boxes {
+			for c := 0; c < 3; c++ {
+				lo, hi := 255, 0
+				for _, px := range box {
+					lo, hi = min(lo, int(px[c])), max(hi, int(px[c]))
+				}
+				if hi-lo > width {
+					best, channel, width = i, c, hi-lo
+				}
+			}
+		}
+		if best < 0 {
+			break // Every box holds a single color
+		}
+		box := boxes[best]
+		slices.SortFunc(box, func(a, b [3]uint8) int { return int(a[channel]) - int(b[channel]) })
+		boxes[best] = box[:len(box)/2]
+		boxes = append(boxes, box[len(box)/2:])
+	}
+
+	for _, box := range boxes {
+		var sum [3]int
+		for _, px := range box {
+			for c := range sum {
+				sum[c] += int(px[c])
+			}
+		}
+		n := len(box)
+		p = append(p, color.RGBA{uint8((sum[0] + n/2) / n), uint8((sum[1] + n/2) / n), uint8((sum[2] + n/2) / n), 255})
+	}
+	return p
+}
+
+// OptimizeGIF re-encodes every frame of a GIF with the same palettes, delays
+// and disposal, dropping comments and other extensions except the loop
+// count. The original data is returned if it cannot be made smaller.
+func OptimizeGIF(data []byte) ([]byte, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode GIF: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		return nil, fmt.Errorf("failed to encode GIF: %w", err)
+	}
+	if buf.Len() < len(data) {
+		return buf.Bytes(), nil
+	}
+	return data, nil
+}
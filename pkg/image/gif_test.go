@@ -0,0 +1,98 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// encodeGIF encodes img and decodes the result
+func encodeGIF(t *testing.T, img image.Image, options GIFOptions) *image.Paletted {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := EncodeGIF(&buf, img, options); err != nil {
+		t.Fatalf("%+v: encode failed: %v", options, err)
+	}
+	decoded, err := gif.Decode(&buf)
+	if err != nil {
+		t.Fatalf("%+v: decode failed: %v", options, err)
+	}
+	return decoded.(*image.Paletted)
+}
+
+func TestEncodeGIFColors(t *testing.T) {
+	// Four colors that are far from the Plan 9 palette survive exactly
+	colors := []color.NRGBA{{13, 77, 201, 255}, {250, 130, 7, 255}, {90, 90, 90, 255}, {3, 200, 99, 255}}
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			img.SetNRGBA(x, y, colors[(x/4+y/4)%4])
+		}
+	}
+	decoded := encodeGIF(t, img, GIFOptions{Colors: 4})
+	if len(decoded.Palette) > 4 {
+		t.Errorf("palette of %d colors, expected at most 4", len(decoded.Palette))
+	}
+	if !sameColors(img, decoded) {
+		t.Error("pixels changed")
+	}
+	if sameColors(img, encodeGIF(t, img, GIFOptions{})) {
+		t.Error("expected the Plan 9 palette to change pixels")
+	}
+
+	for _, n := range []int{1, 257} {
+		if err := EncodeGIF(&bytes.Buffer{}, img, GIFOptions{Colors: n}); err == nil {
+			t.Errorf("%d colors: expected an error", n)
+		}
+	}
+}
+
+func TestEncodeGIFNearest(t *testing.T) {
+	// A flat color between two palette entries is dithered into both, or
+	// mapped to one
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for i := 0; i < len(img.Pix); i += 4 {
+		copy(img.Pix[i:], []uint8{100, 100, 100, 255})
+	}
+	count := func(p *image.Paletted) int {
+		seen := map[uint8]bool{}
+		for _, i := range p.Pix {
+			seen[i] = true
+		}
+		return len(seen)
+	}
+	if n := count(encodeGIF(t, img, GIFOptions{})); n < 2 {
+		t.Errorf("dithered output uses %d colors", n)
+	}
+	if n := count(encodeGIF(t, img, GIFOptions{Nearest: true})); n != 1 {
+		t.Errorf("nearest output uses %d colors", n)
+	}
+}
+
+func TestOptimizeGIF(t *testing.T) {
+	var buf bytes.Buffer
+	EncodeGIF(&buf, gradient(32, 32), GIFOptions{Colors: 16})
+	// A comment extension before the trailer
+	data := append(bytes.Clone(buf.Bytes()[:buf.Len()-1]), 0x21, 0xFE, 5, 'h', 'e', 'l', 'l', 'o', 0, 0x3B)
+
+	optimized, err := OptimizeGIF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(optimized) >= len(data) {
+		t.Errorf("optimized to %d bytes from %d", len(optimized), len(data))
+	}
+	a, _ := gif.Decode(bytes.NewReader(data))
+	b, err := gif.Decode(bytes.NewReader(optimized))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameColors(a, b) {
+		t.Error("pixels changed")
+	}
+	if _, err := OptimizeGIF([]byte("GIF89a")); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,60 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Grid tiles images into a contact sheet with the given number of columns.
+// Each cell is as large as the biggest image; smaller images are centered
+// and the remaining space is filled with padColor.
+func Grid(images []image.Image, columns int, padColor color.NRGBA) *image.NRGBA {
+	if columns <= 0 || columns > len(images) {
+		columns = len(images)
+	}
+
+	cellWidth, cellHeight := 0, 0
+	for _, img := range images {
+		cellWidth = max(cellWidth, img.Bounds().Dx())
+		cellHeight = max(cellHeight, img.Bounds().Dy())
+	}
+
+	rows := (len(images) + columns - 1) / columns
+	sheet := imaging.New(cellWidth*columns, cellHeight*rows, padColor)
+
+	for i, img := range images {
+		x := (i%columns)*cellWidth + (cellWidth-img.Bounds().Dx())/2
+		y := (i/columns)*cellHeight + (cellHeight-img.Bounds().Dy())/2
+		sheet = imaging.Paste(sheet, img, image.Pt(x, y))
+	}
+
+	return sheet
+}
+
+// ParseGrid parses a grid layout in the form ROWSxCOLUMNS, such as 2x3
+func ParseGrid(grid string) (rows, columns int, err error) {
+	r, c, ok := strings.Cut(strings.ToLower(grid), "x")
+	rows, rowErr := strconv.Atoi(r)
+	columns, columnErr := strconv.Atoi(c)
+	if !ok || rowErr != nil || columnErr != nil || rows <= 0 || columns <= 0 {
+		return 0, 0, fmt.Errorf("invalid grid: %s (expected ROWSxCOLUMNS, e.g., 2x3)", grid)
+	}
+	return rows, columns, nil
+}
+
+// GridCell returns cell n, numbered from 1 row by row, of a width x height
+// image divided into a uniform grid, the inverse of Grid. The region is
+// relative to the top-left corner, as Crop takes it. When the size does not
+// divide evenly, cells differ by a pixel at most.
+func GridCell(width, height, rows, columns, n int) image.Rectangle {
+	row, column := (n-1)/columns, (n-1)%columns
+	return image.Rect(
+		column*width/columns, row*height/rows,
+		(column+1)*width/columns, (row+1)*height/rows,
+	)
+}
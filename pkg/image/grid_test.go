@@ -0,0 +1,68 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestGrid(t *testing.T) {
+	red, _ := createTestImage(20, 10, color.RGBA{255, 0, 0, 255})
+	blue, _ := createTestImage(10, 10, color.RGBA{0, 0, 255, 255})
+
+	sheet := Grid([]image.Image{red, blue, red}, 2, color.NRGBA{0, 0, 0, 255})
+
+	if sheet.Bounds().Dx() != 40 || sheet.Bounds().Dy() != 20 {
+		t.Fatalf("Expected 40x20 sheet, got %dx%d", sheet.Bounds().Dx(), sheet.Bounds().Dy())
+	}
+
+	// The smaller image is centered in its cell
+	if c := sheet.NRGBAAt(25, 5); c.B != 255 {
+		t.Errorf("Expected blue at (25,5), got %v", c)
+	}
+	if c := sheet.NRGBAAt(21, 5); c.B != 0 || c.R != 0 {
+		t.Errorf("Expected padding at (21,5), got %v", c)
+	}
+	// The empty last cell is padding
+	if c := sheet.NRGBAAt(30, 15); c.R != 0 || c.B != 0 {
+		t.Errorf("Expected padding at (30,15), got %v", c)
+	}
+}
+
+func TestGridCell(t *testing.T) {
+	tests := []struct {
+		n    int
+		want image.Rectangle
+	}{
+		{1, image.Rect(0, 0, 33, 25)},
+		{2, image.Rect(33, 0, 66, 25)},
+		{3, image.Rect(66, 0, 100, 25)},
+		{4, image.Rect(0, 25, 33, 50)},
+		{6, image.Rect(66, 25, 100, 50)},
+	}
+	for _, tt := range tests {
+		if got := GridCell(100, 50, 2, 3, tt.n); got != tt.want {
+			t.Errorf("cell %d: expected %v, got %v", tt.n, tt.want, got)
+		}
+	}
+
+	// Cells of a contact sheet are its images
+	red, _ := createTestImage(20, 10, color.RGBA{255, 0, 0, 255})
+	blue, _ := createTestImage(20, 10, color.RGBA{0, 0, 255, 255})
+	sheet := Grid([]image.Image{red, blue, red, blue}, 2, color.NRGBA{0, 0, 0, 255})
+	cell := GridCell(sheet.Bounds().Dx(), sheet.Bounds().Dy(), 2, 2, 2)
+	if cell != image.Rect(20, 0, 40, 10) || sheet.NRGBAAt(cell.Min.X, cell.Min.Y).B != 255 {
+		t.Errorf("expected the blue image in cell 2, got %v", cell)
+	}
+}
+
+func TestParseGrid(t *testing.T) {
+	if rows, columns, err := ParseGrid("4X8"); err != nil || rows != 4 || columns != 8 {
+		t.Errorf("expected 4 rows and 8 columns, got %d, %d, %v", rows, columns, err)
+	}
+	for _, grid := range []string{"", "4", "0x2", "2x-1", "axb"} {
+		if _, _, err := ParseGrid(grid); err == nil {
+			t.Errorf("expected an error for %q", grid)
+		}
+	}
+}
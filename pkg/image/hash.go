@@ -0,0 +1,174 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// Content hash algorithms accepted in ProcessOptions.Hash
+const (
+	// HashSHA256 is the SHA-256 digest of the output
+	HashSHA256 = "sha256"
+	// HashXXHash is the 64-bit xxHash of the output, much faster than SHA-256
+	// and enough to tell files apart for cache busting
+	HashXXHash = "xxhash"
+)
+
+// hashPlaceholder matches {hash} in an output path, or {hash:N} to keep the
+// first N hex digits of the hash
+var hashPlaceholder = regexp.MustCompile(`\{hash(?::(\d+))?\}`)
+
+// HasHashPlaceholder reports whether an output path contains {hash}, which
+// is replaced by the content hash of the output once it is written
+func HasHashPlaceholder(path string) bool {
+	return hashPlaceholder.MatchString(path)
+}
+
+// ExpandHash replaces {hash} in path with digest, and {hash:N} with its first
+// N hex digits
+func ExpandHash(path, digest string) string {
+	return hashPlaceholder.ReplaceAllStringFunc(path, func(match string) string {
+		n, err := strconv.Atoi(hashPlaceholder.FindStringSubmatch(match)[1])
+		if err != nil || n >= len(digest) {
+			return digest
+		}
+		return digest[:max(n, 1)]
+	})
+}
+
+// newHash returns a hash of the algorithm, or nil for an empty one
+func newHash(algorithm string) (hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "":
+		return nil, nil
+	case HashSHA256:
+		return sha256.New(), nil
+	case HashXXHash:
+		return xxhash.New(), nil
+	}
+	return nil, fmt.Errorf("invalid hash algorithm: %s (expected sha256 or xxhash)", algorithm)
+}
+
+// ValidateHash checks a content hash algorithm
+func ValidateHash(algorithm string) error {
+	_, err := newHash(algorithm)
+	return err
+}
+
+// outputFile is an output being written, hashed as it is written. Outputs
+// are written to a temporary file in the same directory and renamed over
+// their path once complete, so an interrupted run never leaves a truncated
+// file behind; outputs with {hash} in their path are named once the hash is
+// known.
+type outputFile struct {
+	file *os.File
+	hash hash.Hash
+	w    io.Writer
+	path string
+	temp bool // Whether file is a temporary file that replaces path
+}
+
+// createOutput creates the output file for path, hashing its contents with
+// options.Hash. {hash} in the path implies SHA-256 without options.Hash.
+func createOutput(path string, options ProcessOptions) (*outputFile, error) {
+	algorithm := options.Hash
+	templated := HasHashPlaceholder(path)
+	if templated && algorithm == "" {
+		algorithm = HashSHA256
+	}
+	h, err := newHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	var file *os.File
+	temp := true
+	if templated {
+		file, err = os.CreateTemp(filepath.Dir(path), ".nim-*"+filepath.Ext(path))
+	} else {
+		file, temp, err = createTemp(path)
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		// Report the output rather than the temporary file it is written to
+		err = &fs.PathError{Op: "create", Path: path, Err: pathErr.Err}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+
+	out := &outputFile{file: file, hash: h, w: file, path: path, temp: temp}
+	if h != nil {
+		out.w = io.MultiWriter(file, h)
+	}
+	return out, nil
+}
+
+// Write writes to the file and the hash
+func (f *outputFile) Write(p []byte) (int, error) {
+	return f.w.Write(p)
+}
+
+// Seek moves the write position of a file that is not hashed. Hashed files
+// must be written in order, so streamed TIFF output, whose header is patched
+// at the end, cannot be hashed.
+func (f *outputFile) Seek(offset int64, whence int) (int64, error) {
+	if f.hash != nil {
+		return 0, errors.New("content hashes cannot be computed for streamed TIFF output")
+	}
+	return f.file.Seek(offset, whence)
+}
+
+// Commit closes the file and moves it to its final path. It returns the path
+// with {hash} expanded, and the hex digest of the contents, or an empty one
+// when no hash was asked for.
+func (f *outputFile) Commit() (string, string, error) {
+	var err error
+	if f.temp && writeOptions.Fsync != "" && writeOptions.Fsync != FsyncNone {
+		err = f.file.Sync()
+	}
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		f.Close()
+		return "", "", fmt.Errorf("failed to write %s: %w", f.path, err)
+	}
+	var digest string
+	if f.hash != nil {
+		digest = hex.EncodeToString(f.hash.Sum(nil))
+	}
+	if !f.temp {
+		return f.path, digest, nil
+	}
+
+	// The same contents give the same name, so an existing file is replaced
+	path := ExpandHash(f.path, digest)
+	if err := replace(f.file.Name(), path); err != nil {
+		f.Close()
+		return "", "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, digest, nil
+}
+
+// Close closes the file, and removes the temporary file if it was not
+// committed
+func (f *outputFile) Close() error {
+	err := f.file.Close()
+	if f.temp {
+		os.Remove(f.file.Name())
+	}
+	return err
+}
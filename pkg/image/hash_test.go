@@ -0,0 +1,75 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+func TestExpandHash(t *testing.T) {
+	digest := "0123456789abcdef"
+	tests := map[string]string{
+		"logo.{hash}.png":   "logo.0123456789abcdef.png",
+		"logo.{hash:8}.png": "logo.01234567.png",
+		"{hash:99}/a.png":   "0123456789abcdef/a.png",
+		"logo.png":          "logo.png",
+	}
+	for template, want := range tests {
+		if got := ExpandHash(template, digest); got != want {
+			t.Errorf("ExpandHash(%q) = %q, expected %q", template, got, want)
+		}
+	}
+}
+
+func TestWriteImageHash(t *testing.T) {
+	dir := t.TempDir()
+	img := gradient(32, 32)
+
+	path, digest, err := WriteImage(img, filepath.Join(dir, "plain.png"), ProcessOptions{Hash: HashSHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if digest != hex.EncodeToString(sum[:]) {
+		t.Errorf("digest %s does not match the file contents", digest)
+	}
+
+	// {hash} names the file after its contents, and leaves no temporary file
+	path, xxdigest, err := WriteImage(img, filepath.Join(dir, "logo.{hash:8}.png"), ProcessOptions{Hash: HashXXHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(path) != "logo."+xxdigest[:8]+".png" {
+		t.Errorf("wrote %s, expected the hash in the name", path)
+	}
+	h := xxhash.New()
+	h.Write(data)
+	if xxdigest != hex.EncodeToString(h.Sum(nil)) {
+		t.Errorf("xxhash digest %s does not match the file contents", xxdigest)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("expected 2 files, got %d", len(entries))
+	}
+
+	// Without an algorithm, {hash} uses SHA-256
+	path, digest, err = WriteImage(img, filepath.Join(dir, "{hash}.png"), ProcessOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(path) != hex.EncodeToString(sum[:])+".png" {
+		t.Errorf("wrote %s, expected the SHA-256 of the PNG as its name", path)
+	}
+
+	if _, _, err := WriteImage(img, filepath.Join(dir, "x.png"), ProcessOptions{Hash: "md5"}); err == nil {
+		t.Error("expected an error for an unknown hash algorithm")
+	}
+}
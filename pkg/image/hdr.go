@@ -0,0 +1,278 @@
+package image
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Tone mapping operators accepted in HDROptions.ToneMap
+const (
+	// ToneMapReinhard compresses highlights with the Reinhard operator x/(1+x)
+	ToneMapReinhard = "reinhard"
+	// ToneMapACES applies the ACES filmic curve (Narkowicz approximation)
+	ToneMapACES = "aces"
+	// ToneMapClamp clips values above 1.0
+	ToneMapClamp = "clamp"
+)
+
+func init() {
+	RegisterCodec(Codec{
+		Name:       "Radiance HDR",
+		Extensions: []string{"hdr"},
+		Decode: func(r io.Reader, options ProcessOptions) (image.Image, error) {
+			img, err := DecodeRadiance(r)
+			if err != nil {
+				return nil, err
+			}
+			return ToneMap(img, options.HDR)
+		},
+	})
+}
+
+// HDROptions controls how high dynamic range inputs (EXR, Radiance HDR) are
+// tone-mapped to 8-bit
+type HDROptions struct {
+	ToneMap  string  // Tone mapping operator: reinhard, aces, or clamp
+	Exposure float64 // Exposure adjustment in stops, applied before tone mapping
+}
+
+// FloatImage is an image with linear-light RGBA samples stored as float32.
+// It is the decoded form of HDR inputs before tone mapping.
+type FloatImage struct {
+	Pix    []float32
+	Stride int
+	Rect   image.Rectangle
+}
+
+// NewFloatImage returns a new FloatImage with the given bounds
+func NewFloatImage(r image.Rectangle) *FloatImage {
+	return &FloatImage{
+		Pix:    make([]float32, 4*r.Dx()*r.Dy()),
+		Stride: 4 * r.Dx(),
+		Rect:   r,
+	}
+}
+
+// ColorModel returns the color model of the image
+func (f *FloatImage) ColorModel() color.Model { return color.NRGBA64Model }
+
+// Bounds returns the image bounds
+func (f *FloatImage) Bounds() image.Rectangle { return f.Rect }
+
+// At returns the pixel at (x, y), clamped to [0, 1] and sRGB encoded
+func (f *FloatImage) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(f.Rect)) {
+		return color.NRGBA64{}
+	}
+	i := f.PixOffset(x, y)
+	return color.NRGBA64{
+		R: uint16(linearToSRGB(float64(f.Pix[i+0])) * 65535),
+		G: uint16(linearToSRGB(float64(f.Pix[i+1])) * 65535),
+		B: uint16(linearToSRGB(float64(f.Pix[i+2])) * 65535),
+		A: uint16(math.Min(math.Max(float64(f.Pix[i+3]), 0), 1) * 65535),
+	}
+}
+
+// PixOffset returns the index of the first sample of the pixel at (x, y)
+func (f *FloatImage) PixOffset(x, y int) int {
+	return (y-f.Rect.Min.Y)*f.Stride + (x-f.Rect.Min.X)*4
+}
+
+// ToneMap converts a linear HDR image to an 8-bit sRGB image
+func ToneMap(src *FloatImage, options HDROptions) (*image.NRGBA, error) {
+	var curve func(float64) float64
+	switch strings.ToLower(options.ToneMap) {
+	case "", ToneMapReinhard:
+		curve = func(x float64) float64 { return x / (1 + x) }
+	case ToneMapACES:
+		curve = func(x float64) float64 {
+			return (x * (2.51*x + 0.03)) / (x*(2.43*x+0.59) + 0.14)
+		}
+	case ToneMapClamp:
+		curve = func(x float64) float64 { return x }
+	default:
+		return nil, fmt.Errorf("unknown tone mapping operator: %s (expected reinhard, aces, or clamp)", options.ToneMap)
+	}
+
+	gain := math.Pow(2, options.Exposure)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			si := y*src.Stride + x*4
+			di := y*dst.Stride + x*4
+			for c := 0; c < 3; c++ {
+				v := math.Max(float64(src.Pix[si+c])*gain, 0)
+				dst.Pix[di+c] = uint8(math.Round(linearToSRGB(curve(v)) * 255))
+			}
+			dst.Pix[di+3] = uint8(math.Round(math.Min(math.Max(float64(src.Pix[si+3]), 0), 1) * 255))
+		}
+	}
+
+	return dst, nil
+}
+
+// linearToSRGB applies the sRGB transfer function to a linear value, clamping it to [0, 1]
+func linearToSRGB(v float64) float64 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 1:
+		return 1
+	case v <= 0.0031308:
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// DecodeRadiance decodes a Radiance RGBE (.hdr) image
+func DecodeRadiance(r io.Reader) (*FloatImage, error) {
+	br := bufio.NewReader(r)
+
+	// Header: magic line, variables, then an empty line
+	magic, err := br.ReadString('\n')
+	if err != nil || !(strings.HasPrefix(magic, "#?RADIANCE") || strings.HasPrefix(magic, "#?RGBE")) {
+		return nil, fmt.Errorf("not a Radiance HDR file")
+	}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read HDR header: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if format, ok := strings.CutPrefix(line, "FORMAT="); ok && format != "32-bit_rle_rgbe" {
+			return nil, fmt.Errorf("unsupported HDR pixel format: %s", format)
+		}
+	}
+
+	// Resolution string; only the standard top-to-bottom, left-to-right orientation is supported
+	resolution, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HDR resolution: %w", err)
+	}
+	fields := strings.Fields(resolution)
+	if len(fields) != 4 || fields[0] != "-Y" || fields[2] != "+X" {
+		return nil, fmt.Errorf("unsupported HDR orientation: %s", strings.TrimSpace(resolution))
+	}
+	height, err1 := strconv.Atoi(fields[1])
+	width, err2 := strconv.Atoi(fields[3])
+	if err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid HDR resolution: %s", strings.TrimSpace(resolution))
+	}
+
+	img := NewFloatImage(image.Rect(0, 0, width, height))
+	scanline := make([]byte, width*4)
+	for y := 0; y < height; y++ {
+		if err := readRGBEScanline(br, scanline); err != nil {
+			return nil, fmt.Errorf("failed to read HDR scanline %d: %w", y, err)
+		}
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < width; x++ {
+			e := scanline[x*4+3]
+			if e == 0 {
+				row[x*4+3] = 1
+				continue
+			}
+			f := math.Ldexp(1, int(e)-136)
+			row[x*4+0] = float32((float64(scanline[x*4+0]) + 0.5) * f)
+			row[x*4+1] = float32((float64(scanline[x*4+1]) + 0.5) * f)
+			row[x*4+2] = float32((float64(scanline[x*4+2]) + 0.5) * f)
+			row[x*4+3] = 1
+		}
+	}
+
+	return img, nil
+}
+
+// readRGBEScanline reads one scanline of RGBE pixels in flat, old-style RLE or
+// new-style (per-component) RLE encoding
+func readRGBEScanline(br *bufio.Reader, dst []byte) error {
+	width := len(dst) / 4
+	head, err := br.Peek(4)
+	if err != nil {
+		return err
+	}
+
+	// New-style RLE starts with 2, 2 and the scanline width
+	if width >= 8 && width < 32768 && head[0] == 2 && head[1] == 2 && head[2]&0x80 == 0 {
+		if int(head[2])<<8|int(head[3]) != width {
+			return fmt.Errorf("scanline width mismatch")
+		}
+		br.Discard(4)
+		for c := 0; c < 4; c++ {
+			for x := 0; x < width; {
+				count, err := br.ReadByte()
+				if err != nil {
+					return err
+				}
+				if count > 128 {
+					// Run of a single value
+					n := int(count) - 128
+					if x+n > width {
+						return fmt.Errorf("run exceeds scanline")
+					}
+					v, err := br.ReadByte()
+					if err != nil {
+						return err
+					}
+					for ; n > 0; n-- {
+						dst[x*4+c] = v
+						x++
+					}
+				} else {
+					// Literal values
+					n := int(count)
+					if n == 0 || x+n > width {
+						return fmt.Errorf("invalid literal run")
+					}
+					for ; n > 0; n-- {
+						v, err := br.ReadByte()
+						if err != nil {
+							return err
+						}
+						dst[x*4+c] = v
+						x++
+					}
+				}
+			}
+		}
+		return nil
+	}
+
+	// Flat pixels, where (1, 1, 1, n) repeats the previous pixel
+	shift := 0
+	for x := 0; x < width; {
+		var pixel [4]byte
+		if _, err := io.ReadFull(br, pixel[:]); err != nil {
+			return err
+		}
+		if pixel[0] == 1 && pixel[1] == 1 && pixel[2] == 1 {
+			if x == 0 {
+				return fmt.Errorf("run without a previous pixel")
+			}
+			n := int(pixel[3]) << shift
+			if x+n > width {
+				return fmt.Errorf("run exceeds scanline")
+			}
+			for ; n > 0; n-- {
+				copy(dst[x*4:x*4+4], dst[(x-1)*4:x*4])
+				x++
+			}
+			shift += 8
+			continue
+		}
+		copy(dst[x*4:x*4+4], pixel[:])
+		x++
+		shift = 0
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"testing"
+)
+
+// buildRadiance creates a Radiance HDR file with every pixel set to the given
+// RGBE value. Scanlines of 8 pixels or more use new-style RLE.
+func buildRadiance(width, height int, rgbe [4]byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y %d +X %d\n", height, width)
+	for y := 0; y < height; y++ {
+		if width < 8 {
+			for x := 0; x < width; x++ {
+				buf.Write(rgbe[:])
+			}
+			continue
+		}
+		buf.Write([]byte{2, 2, byte(width >> 8), byte(width)})
+		for c := 0; c < 4; c++ {
+			for remaining := width; remaining > 0; {
+				n := min(remaining, 127)
+				buf.Write([]byte{byte(128 + n), rgbe[c]})
+				remaining -= n
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeRadiance(t *testing.T) {
+	// Mantissa 128 with exponent 129 encodes 1.0
+	for _, width := range []int{4, 200} {
+		img, err := DecodeRadiance(bytes.NewReader(buildRadiance(width, 3, [4]byte{128, 64, 0, 129})))
+		if err != nil {
+			t.Fatalf("DecodeRadiance(%d wide) failed: %v", width, err)
+		}
+		if img.Rect.Dx() != width || img.Rect.Dy() != 3 {
+			t.Fatalf("Expected %dx3, got %dx%d", width, img.Rect.Dx(), img.Rect.Dy())
+		}
+		i := img.PixOffset(width-1, 2)
+		r, g, b := img.Pix[i], img.Pix[i+1], img.Pix[i+2]
+		if r < 0.99 || r > 1.01 || g < 0.49 || g > 0.51 || b > 0.01 {
+			t.Errorf("Unexpected pixel value (%f, %f, %f)", r, g, b)
+		}
+	}
+}
+
+func TestDecodeRadianceInvalid(t *testing.T) {
+	if _, err := DecodeRadiance(bytes.NewReader([]byte("P6\n1 1\n255\n"))); err == nil {
+		t.Errorf("Expected an error for a non-HDR file")
+	}
+
+	truncated := buildRadiance(10, 10, [4]byte{1, 2, 3, 128})
+	if _, err := DecodeRadiance(bytes.NewReader(truncated[:len(truncated)-20])); err == nil {
+		t.Errorf("Expected an error for a truncated file")
+	}
+}
+
+func TestToneMap(t *testing.T) {
+	img := NewFloatImage(image.Rect(0, 0, 2, 1))
+	copy(img.Pix, []float32{4, 4, 4, 1, 0.18, 0.18, 0.18, 1})
+
+	testCases := []struct {
+		name     string
+		options  HDROptions
+		expected uint8 // Expected value of the bright pixel
+	}{
+		{"Clamp", HDROptions{ToneMap: ToneMapClamp}, 255},
+		{"Reinhard", HDROptions{ToneMap: ToneMapReinhard}, 231},
+		{"ACES", HDROptions{ToneMap: ToneMapACES}, 252},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ToneMap(img, tc.options)
+			if err != nil {
+				t.Fatalf("ToneMap failed: %v", err)
+			}
+			if c := result.NRGBAAt(0, 0); c.R != tc.expected || c.A != 255 {
+				t.Errorf("Expected bright pixel %d, got %v", tc.expected, c)
+			}
+			if c := result.NRGBAAt(1, 0); c.R >= result.NRGBAAt(0, 0).R {
+				t.Errorf("Expected mid-gray to map below the highlight, got %v", c)
+			}
+		})
+	}
+
+	// Exposure brightens before tone mapping
+	normal, _ := ToneMap(img, HDROptions{})
+	brighter, _ := ToneMap(img, HDROptions{Exposure: 2})
+	if brighter.NRGBAAt(1, 0).R <= normal.NRGBAAt(1, 0).R {
+		t.Errorf("Expected exposure to brighten the image")
+	}
+
+	if _, err := ToneMap(img, HDROptions{ToneMap: "filmic"}); err == nil {
+		t.Errorf("Expected an error for an unknown operator")
+	}
+}
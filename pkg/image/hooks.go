@@ -0,0 +1,65 @@
+package image
+
+import "time"
+
+// Hooks are called as Process works, so applications embedding nim can show
+// their own progress. Each may be nil. They run on the goroutine doing the
+// work, which waits for them.
+type Hooks struct {
+	// OnStageStart is called as each stage starts: StageDecode, an
+	// operation, StageEncode, or a step of a pipeline
+	OnStageStart func(stage string)
+	// OnStageEnd is called as each stage ends, whether or not it succeeded,
+	// with the time it took
+	OnStageEnd func(stage string, elapsed time.Duration)
+	// OnProgress is called with the percentage of a stage done, from 0 to
+	// 100, for stages where it is known: the rows of streamed images and the
+	// frames of animations. It is called when the whole percentage changes.
+	OnProgress func(stage string, percent float64)
+}
+
+// Start calls OnStageStart for a stage and returns the function that ends
+// it, calling OnStageEnd
+func (h Hooks) Start(stage string) func() {
+	if h.OnStageStart != nil {
+		h.OnStageStart(stage)
+	}
+	start := time.Now()
+	return func() {
+		if h.OnStageEnd != nil {
+			h.OnStageEnd(stage, time.Since(start))
+		}
+	}
+}
+
+// Progress calls OnProgress with done out of total as a percentage
+func (h Hooks) Progress(stage string, done, total int) {
+	if h.OnProgress != nil && total > 0 {
+		h.OnProgress(stage, float64(done)*100/float64(total))
+	}
+}
+
+// progressCounter reports the progress of a stage over total steps,
+// calling OnProgress only when the whole percentage changes
+type progressCounter struct {
+	hooks   Hooks
+	stage   string
+	total   int
+	percent int
+}
+
+// newProgressCounter returns a counter for a stage of total steps
+func newProgressCounter(hooks Hooks, stage string, total int) *progressCounter {
+	return &progressCounter{hooks: hooks, stage: stage, total: total, percent: -1}
+}
+
+// set reports that done steps of the stage are done
+func (c *progressCounter) set(done int) {
+	if c.hooks.OnProgress == nil || c.total <= 0 {
+		return
+	}
+	if percent := done * 100 / c.total; percent != c.percent {
+		c.percent = percent
+		c.hooks.Progress(c.stage, done, c.total)
+	}
+}
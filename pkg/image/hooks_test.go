@@ -0,0 +1,61 @@
+package image
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHooksProgress(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.png")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, noiseAlpha(300, 200))
+	f.Close()
+
+	// Streaming reports the rows read while resizing; the small output is
+	// encoded whole
+	var stages, ended []string
+	var percents []float64
+	options := ProcessOptions{Width: 100, Height: 100, ResizeMode: ResizeModeFit, MaxMemory: 300 * 200}
+	options.Hooks = Hooks{
+		OnStageStart: func(stage string) { stages = append(stages, stage) },
+		OnStageEnd:   func(stage string, elapsed time.Duration) { ended = append(ended, stage) },
+		OnProgress: func(stage string, percent float64) {
+			if stage != OperationResize {
+				t.Errorf("Expected progress of the resize, got %s", stage)
+			}
+			percents = append(percents, percent)
+		},
+	}
+	if _, err := Process(input, filepath.Join(dir, "out.png"), options); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{StageDecode, OperationResize, StageEncode}; !slices.Equal(stages, want) || !slices.Equal(ended, want) {
+		t.Errorf("Expected stages %v, got %v ending as %v", want, stages, ended)
+	}
+	if len(percents) != 101 || percents[0] != 0 || percents[100] != 100 || !slices.IsSorted(percents) {
+		t.Errorf("Expected each percentage from 0 to 100 once, got %v", percents)
+	}
+
+	// Animations report their frames
+	input = filepath.Join(dir, "anim.gif")
+	os.WriteFile(input, testGIF(t), 0o644)
+	stages, ended, percents = nil, nil, nil
+	options = DefaultOptions()
+	options.Width, options.Height = 4, 4
+	options.Hooks.OnProgress = func(stage string, percent float64) { percents = append(percents, percent) }
+	options.Hooks.OnStageStart = func(stage string) { stages = append(stages, stage) }
+	if _, err := Process(input, filepath.Join(dir, "out.webp"), options); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(stages, []string{StageEncode}) || len(percents) != 4 || percents[3] != 100 {
+		t.Errorf("Expected the progress of 3 frames in one stage, got %v and %v", stages, percents)
+	}
+}
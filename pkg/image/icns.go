@@ -0,0 +1,144 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// icnsIcons is the Apple icon family: every point size at 1x and 2x, with
+// the OSType of its ICNS entry
+var icnsIcons = []struct {
+	osType string
+	points int
+	scale  int
+}{
+	{"icp4", 16, 1},
+	{"ic11", 16, 2},
+	{"icp5", 32, 1},
+	{"ic12", 32, 2},
+	{"ic07", 128, 1},
+	{"ic13", 128, 2},
+	{"ic08", 256, 1},
+	{"ic14", 256, 2},
+	{"ic09", 512, 1},
+	{"ic10", 512, 2},
+}
+
+// iconsetName returns the file name iconutil expects for an icon
+func iconsetName(points, scale int) string {
+	if scale == 1 {
+		return fmt.Sprintf("icon_%dx%d.png", points, points)
+	}
+	return fmt.Sprintf("icon_%dx%d@%dx.png", points, points, scale)
+}
+
+// icnsFrames resizes img to every pixel size of the icon family
+func icnsFrames(img image.Image) (map[int][]byte, error) {
+	sizes := make([]int, len(icnsIcons))
+	for i, icon := range icnsIcons {
+		sizes[i] = icon.points * icon.scale
+	}
+	frames := make(map[int][]byte)
+	cascade := NewCascade(img)
+	for _, i := range Descending(sizes) {
+		size := sizes[i]
+		if _, ok := frames[size]; ok {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, cascade.IconFrame(size)); err != nil {
+			return nil, err
+		}
+		frames[size] = buf.Bytes()
+	}
+	return frames, nil
+}
+
+// EncodeICNS writes a macOS icon with the complete icon family, 16 to 1024
+// px including the @2x variants, each resized from img
+func EncodeICNS(w io.Writer, img image.Image) error {
+	frames, err := icnsFrames(img)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	for _, icon := range icnsIcons {
+		data := frames[icon.points*icon.scale]
+		body.WriteString(icon.osType)
+		binary.Write(&body, binary.BigEndian, uint32(len(data)+8))
+		body.Write(data)
+	}
+
+	var header [8]byte
+	copy(header[:], "icns")
+	binary.BigEndian.PutUint32(header[4:], uint32(body.Len()+8))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(body.Bytes())
+	return err
+}
+
+// WriteIconset writes the icon family as PNG files into an .iconset folder
+// that iconutil can compile into an ICNS file
+func WriteIconset(dir string, img image.Image) error {
+	frames, err := icnsFrames(img)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create iconset folder: %w", err)
+	}
+	for _, icon := range icnsIcons {
+		path := filepath.Join(dir, iconsetName(icon.points, icon.scale))
+		if err := os.WriteFile(path, frames[icon.points*icon.scale], 0o644); err != nil {
+			return fmt.Errorf("failed to write iconset file: %w", err)
+		}
+	}
+	return nil
+}
+
+// DecodeICNS decodes the largest PNG or JPEG icon of a macOS ICNS file.
+// Legacy RLE and JPEG 2000 entries are skipped.
+func DecodeICNS(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ICNS file: %w", err)
+	}
+	if len(data) < 8 || string(data[:4]) != "icns" {
+		return nil, fmt.Errorf("not an ICNS file")
+	}
+	end := min(int(binary.BigEndian.Uint32(data[4:])), len(data))
+
+	var best []byte
+	bestSize := 0
+	for pos := 8; pos+8 <= end; {
+		length := int(binary.BigEndian.Uint32(data[pos+4:]))
+		if length < 8 || pos+length > end {
+			return nil, fmt.Errorf("invalid ICNS entry %q", data[pos:pos+4])
+		}
+		entry := data[pos+8 : pos+length]
+		pos += length
+
+		config, _, err := image.DecodeConfig(bytes.NewReader(entry))
+		if err != nil {
+			continue
+		}
+		if size := config.Width * config.Height; size > bestSize {
+			best, bestSize = entry, size
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no PNG or JPEG icons found in ICNS file")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(best))
+	return img, err
+}
@@ -0,0 +1,60 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodeICNS(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 300, 200))
+
+	var buf bytes.Buffer
+	if err := EncodeICNS(&buf, src); err != nil {
+		t.Fatalf("EncodeICNS failed: %v", err)
+	}
+	data := buf.Bytes()
+	if int(binary.BigEndian.Uint32(data[4:])) != len(data) {
+		t.Fatalf("ICNS length does not match the file size")
+	}
+
+	// Every member of the icon family is present
+	var types []string
+	for pos := 8; pos < len(data); pos += int(binary.BigEndian.Uint32(data[pos+4:])) {
+		types = append(types, string(data[pos:pos+4]))
+	}
+	if len(types) != len(icnsIcons) {
+		t.Fatalf("Expected %d icons, got %v", len(icnsIcons), types)
+	}
+
+	// The largest icon is decoded
+	img, err := DecodeICNS(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeICNS failed: %v", err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 1024, 1024) {
+		t.Errorf("Expected the 1024x1024 icon, got %v", img.Bounds())
+	}
+}
+
+func TestWriteIconset(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "App.iconset")
+	if err := WriteIconset(dir, image.NewNRGBA(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatalf("WriteIconset failed: %v", err)
+	}
+
+	for _, name := range []string{"icon_16x16.png", "icon_16x16@2x.png", "icon_512x512@2x.png"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Missing %s: %v", name, err)
+		}
+	}
+}
+
+func TestDecodeICNSInvalid(t *testing.T) {
+	if _, err := DecodeICNS(bytes.NewReader([]byte("icns\x00\x00\x00\x08"))); err == nil {
+		t.Fatalf("Expected an error for an ICNS file without icons")
+	}
+}
@@ -0,0 +1,46 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+
+	"github.com/sergeymakinen/go-ico"
+)
+
+// DefaultIcoSizes are the frame sizes of ICO output when ProcessOptions.IcoSizes is empty
+var DefaultIcoSizes = []int{16, 24, 32, 48, 64, 128, 256}
+
+// EncodeICO writes a multi-resolution icon with one square frame per size,
+// each resized from img so Windows can pick a sharp frame at every scale
+func EncodeICO(w io.Writer, img image.Image, sizes []int) error {
+	if len(sizes) == 0 {
+		sizes = DefaultIcoSizes
+	}
+
+	for _, size := range sizes {
+		if size < 1 || size > 256 {
+			return fmt.Errorf("invalid ICO size: %d (must be between 1 and 256)", size)
+		}
+	}
+	// Frames are resized largest first so smaller ones reuse them
+	frames := make([]image.Image, len(sizes))
+	cascade := NewCascade(img)
+	for _, i := range Descending(sizes) {
+		frames[i] = cascade.IconFrame(sizes[i])
+	}
+	return ico.EncodeAll(w, frames)
+}
+
+// IconFrame resizes img to fit a size x size square, centered on a
+// transparent background so non-square sources keep their aspect ratio
+func IconFrame(img image.Image, size int) *image.NRGBA {
+	return NewCascade(img).IconFrame(size)
+}
+
+// PaddedIconFrame resizes img to fit a size x size square, leaving padding
+// (a fraction of size) free on every side, and flattens it onto background
+func PaddedIconFrame(img image.Image, size int, padding float64, background color.Color) *image.NRGBA {
+	return NewCascade(img).PaddedIconFrame(size, padding, background)
+}
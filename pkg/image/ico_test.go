@@ -0,0 +1,63 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/sergeymakinen/go-ico"
+)
+
+func TestEncodeICO(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 512, 256))
+
+	var buf bytes.Buffer
+	if err := EncodeICO(&buf, src, nil); err != nil {
+		t.Fatalf("EncodeICO failed: %v", err)
+	}
+
+	frames, err := ico.DecodeAll(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to decode icon: %v", err)
+	}
+	if len(frames) != len(DefaultIcoSizes) {
+		t.Fatalf("Expected %d frames, got %d", len(DefaultIcoSizes), len(frames))
+	}
+	for i, frame := range frames {
+		size := DefaultIcoSizes[i]
+		if frame.Bounds().Dx() != size || frame.Bounds().Dy() != size {
+			t.Errorf("Frame %d: expected %dx%d, got %v", i, size, size, frame.Bounds())
+		}
+	}
+}
+
+func TestEncodeICOInvalidSize(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	if err := EncodeICO(&bytes.Buffer{}, src, []int{16, 512}); err == nil {
+		t.Fatalf("Expected an error for a 512px frame")
+	}
+}
+
+func TestIconFrame(t *testing.T) {
+	// Small, non-square sources are scaled up and centered
+	frame := IconFrame(image.NewNRGBA(image.Rect(0, 0, 8, 4)), 32)
+	if frame.Bounds() != image.Rect(0, 0, 32, 32) {
+		t.Fatalf("Expected 32x32, got %v", frame.Bounds())
+	}
+}
+
+func TestPaddedIconFrame(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	for i := range src.Pix {
+		src.Pix[i] = 255
+	}
+
+	frame := PaddedIconFrame(src, 100, 0.1, color.NRGBA{B: 255, A: 255})
+	if c := frame.NRGBAAt(5, 5); c != (color.NRGBA{B: 255, A: 255}) {
+		t.Errorf("Expected the background in the padding, got %v", c)
+	}
+	if c := frame.NRGBAAt(50, 50); c != (color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("Expected the image in the center, got %v", c)
+	}
+}
@@ -0,0 +1,712 @@
+package image
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"math/bits"
+	"slices"
+
+	"github.com/disintegration/imaging"
+)
+
+// jpegQuant are the quantization tables of section K.1 of the JPEG spec in
+// zig-zag order: luminance, then chrominance
+var jpegQuant = [2][64]byte{
+	{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	},
+	{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+// jpegZigzag maps zig-zag positions to positions in a block in row order
+var jpegZigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// jpegHuffman is a Huffman table: the number of codes of each length from 1
+// to 16 bits, and the symbols in order of their codes
+type jpegHuffman struct {
+	counts  [16]byte
+	symbols []byte
+}
+
+// jpegHuffmanTables are the typical Huffman tables of section K.3 of the
+// JPEG spec: luminance DC and AC, then chrominance DC and AC. Besides run/size pairs, the AC tables hold EOB (0x00) and ZRL
+// (0xF0), which is all a progressive scan without EOB runs needs.
+var jpegHuffmanTables = [4]jpegHuffman{
+	{
+		[16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+			0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+			0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+			0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+			0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+			0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+			0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+			0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+			0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+			0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+			0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+	{
+		[16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	},
+	{
+		[16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+			0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+			0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+			0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+			0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+			0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+			0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+			0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+			0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+			0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+			0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		},
+	},
+}
+
+// jpegCode is the Huffman code of a symbol
+type jpegCode struct {
+	code   uint32
+	length uint
+}
+
+// codes assigns the canonical codes of a table to its symbols
+func (h *jpegHuffman) codes() [256]jpegCode {
+	var codes [256]jpegCode
+	code, k := uint32(0), 0
+	for length, count := range h.counts {
+		for i := 0; i < int(count); i++ {
+			codes[h.symbols[k]] = jpegCode{code, uint(length + 1)}
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return codes
+}
+
+// jpegComponent is a color component of a JPEG image, with its quantized
+// coefficients in zig-zag order
+type jpegComponent struct {
+	id               byte
+	h, v             int // Horizontal and vertical sampling factors
+	quant            int // Quantization table
+	table            int // 0 for luminance, 1 for chrominance Huffman tables
+	blocksW, blocksH int // Blocks in interleaved scans, padded to whole MCUs
+	scanW, scanH     int // Blocks in scans of this component alone
+	blocks           [][64]int32
+}
+
+// jpegFrame is a JPEG image as the quantized DCT coefficients of its
+// components
+type jpegFrame struct {
+	width, height int
+	components    []*jpegComponent
+	quant         [4][64]int32 // Quantization tables in zig-zag order
+	segments      [][]byte     // APPn and COM segments to copy, with their markers
+}
+
+// mcuSize returns the size of an MCU in pixels
+func (f *jpegFrame) mcuSize() (int, int) {
+	if len(f.components) == 1 {
+		return 8, 8
+	}
+	hMax, vMax := 1, 1
+	for _, c := range f.components {
+		hMax, vMax = max(hMax, c.h), max(vMax, c.v)
+	}
+	return 8 * hMax, 8 * vMax
+}
+
+// layout sets the block counts of the components from the frame size and
+// their sampling factors, and allocates their blocks
+func (f *jpegFrame) layout() {
+	mcuW, mcuH := f.mcuSize()
+	mcusW, mcusH := (f.width+mcuW-1)/mcuW, (f.height+mcuH-1)/mcuH
+	for _, c := range f.components {
+		if len(f.components) == 1 {
+			c.h, c.v = 1, 1
+		}
+		c.blocksW, c.blocksH = mcusW*c.h, mcusH*c.v
+		// The component is sampled at h/hMax of the image width, rounded up
+		compW := (f.width*c.h*8 + mcuW - 1) / mcuW
+		compH := (f.height*c.v*8 + mcuH - 1) / mcuH
+		c.scanW, c.scanH = (compW+7)/8, (compH+7)/8
+		c.blocks = blockPool.get(c.blocksW * c.blocksH)
+	}
+}
+
+// release returns the blocks of the components to the pool once the frame
+// is no longer used
+func (f *jpegFrame) release() {
+	for _, c := range f.components {
+		blockPool.put(c.blocks)
+		c.blocks = nil
+	}
+}
+
+// eachMCUBlock calls fn for every block of components in the order of an
+// interleaved scan, or of a scan of a single component, with the index of the
+// component and block. mcuDone is called after each MCU.
+func (f *jpegFrame) eachMCUBlock(components []*jpegComponent, fn func(c *jpegComponent, block int), mcuDone func()) {
+	if len(components) == 1 {
+		c := components[0]
+		for by := 0; by < c.scanH; by++ {
+			for bx := 0; bx < c.scanW; bx++ {
+				fn(c, by*c.blocksW+bx)
+				mcuDone()
+			}
+		}
+		return
+	}
+
+	first := components[0]
+	mcusW, mcusH := first.blocksW/first.h, first.blocksH/first.v
+	for my := 0; my < mcusH; my++ {
+		for mx := 0; mx < mcusW; mx++ {
+			for _, c := range components {
+				for dy := 0; dy < c.v; dy++ {
+					for dx := 0; dx < c.h; dx++ {
+						fn(c, (my*c.v+dy)*c.blocksW+mx*c.h+dx)
+					}
+				}
+			}
+			mcuDone()
+		}
+	}
+}
+
+// jpegBitWriter writes Huffman-coded bits, stuffing a zero byte after each
+// 0xFF byte as entropy-coded segments require. With counts set, it counts
+// the symbols coded with each table instead of writing anything.
+type jpegBitWriter struct {
+	w      *bufio.Writer
+	bits   uint32
+	n      uint
+	codes  *[4][256]jpegCode
+	counts *[4][256]int
+}
+
+func (b *jpegBitWriter) write(value uint32, n uint) {
+	if b.counts != nil {
+		return
+	}
+	b.bits = b.bits<<n | value&(1<<n-1)
+	b.n += n
+	for b.n >= 8 {
+		c := byte(b.bits >> (b.n - 8))
+		b.w.WriteByte(c)
+		if c == 0xFF {
+			b.w.WriteByte(0)
+		}
+		b.n -= 8
+	}
+	b.bits &= 1<<b.n - 1
+}
+
+// writeSymbol writes the Huffman code of a symbol of a table
+func (b *jpegBitWriter) writeSymbol(table, symbol int) {
+	if b.counts != nil {
+		b.counts[table][symbol]++
+		return
+	}
+	c := b.codes[table][symbol]
+	b.write(c.code, c.length)
+}
+
+// flush pads the last byte with one bits, ending a scan
+func (b *jpegBitWriter) flush() {
+	if b.n > 0 {
+		b.write(0xFF, 8-b.n)
+	}
+}
+
+// writeValue writes the Huffman code of a symbol combined with a value
+// category, then the low bits of the value
+func (b *jpegBitWriter) writeValue(table, run int, v int32) {
+	abs := v
+	if abs < 0 {
+		abs = -abs
+		v--
+	}
+	size := uint(bits.Len32(uint32(abs)))
+	b.writeSymbol(table, run<<4|int(size))
+	if size > 0 {
+		b.write(uint32(v), size)
+	}
+}
+
+// writeAC writes the coefficients start to end of a block as run/size
+// symbols, ending with EOB unless the last one is non-zero
+func (b *jpegBitWriter) writeAC(table int, block *[64]int32, start, end int) {
+	run := 0
+	for k := start; k <= end; k++ {
+		if block[k] == 0 {
+			run++
+			continue
+		}
+		for ; run > 15; run -= 16 {
+			b.writeSymbol(table, 0xF0)
+		}
+		b.writeValue(table, run, block[k])
+		run = 0
+	}
+	if run > 0 {
+		b.writeSymbol(table, 0x00)
+	}
+}
+
+// optimalJPEGHuffman builds a Huffman table for the symbol counts with codes
+// of at most 16 bits, following section K.2 of the JPEG spec
+func optimalJPEGHuffman(counts *[256]int) jpegHuffman {
+	// A reserved symbol keeps any code from being all one bits
+	var freq [257]int
+	copy(freq[:], counts[:])
+	freq[256] = 1
+	var size [257]int
+	var others [257]int
+	for i := range others {
+		others[i] = -1
+	}
+	least := func(exclude int) int {
+		best := -1
+		for i, f := range freq {
+			if f > 0 && i != exclude && (best < 0 || f <= freq[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	for {
+		c1 := least(-1)
+		c2 := least(c1)
+		if c2 < 0 {
+			break
+		}
+		freq[c1] += freq[c2]
+		freq[c2] = 0
+		for size[c1]++; others[c1] >= 0; size[c1]++ {
+			c1 = others[c1]
+		}
+		others[c1] = c2
+		for size[c2]++; others[c2] >= 0; size[c2]++ {
+			c2 = others[c2]
+		}
+	}
+
+	// Count the codes of each length, then shorten those beyond 16 bits
+	var lengths [33]int
+	for _, n := range size {
+		if n > 0 {
+			lengths[n]++
+		}
+	}
+	for i := 32; i > 16; i-- {
+		for lengths[i] > 0 {
+			j := i - 2
+			for lengths[j] == 0 {
+				j--
+			}
+			lengths[i] -= 2
+			lengths[i-1]++
+			lengths[j+1] += 2
+			lengths[j]--
+		}
+	}
+	for i := 16; i > 0; i-- {
+		if lengths[i] > 0 {
+			lengths[i]-- // The reserved symbol
+			break
+		}
+	}
+
+	var h jpegHuffman
+	for i := range h.counts {
+		h.counts[i] = byte(lengths[i+1])
+	}
+	for n := 1; n <= 32; n++ {
+		for symbol := 0; symbol < 256; symbol++ {
+			if size[symbol] == n {
+				h.symbols = append(h.symbols, byte(symbol))
+			}
+		}
+	}
+	return h
+}
+
+// JPEGOptions controls JPEG output beyond ProcessOptions.Quality
+type JPEGOptions struct {
+	Progressive bool // Write progressive instead of baseline JPEG (see EncodeProgressiveJPEG)
+	Thumbnail   bool // Embed an EXIF thumbnail of the image (see EmbedEXIFThumbnail)
+}
+
+// EncodeJPEG writes img as a JPEG at a quality from 1 to 100 with options
+func EncodeJPEG(w io.Writer, img image.Image, quality int, options JPEGOptions) error {
+	if options.Thumbnail {
+		buf := getBuffer()
+		defer putBuffer(buf)
+		options.Thumbnail = false
+		if err := EncodeJPEG(buf, img, quality, options); err != nil {
+			return err
+		}
+		thumb, err := exifThumbnail(img)
+		if err != nil {
+			return err
+		}
+		data, err := EmbedEXIFThumbnail(buf.Bytes(), thumb)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	if options.Progressive {
+		return EncodeProgressiveJPEG(w, img, quality)
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+}
+
+// EncodeProgressiveJPEG writes img as a progressive JPEG at a quality from 1
+// to 100, with the quantization of image/jpeg. The DC coefficients come in
+// the first scan, so a decoder can show a blurry preview of the whole image
+// early; the details of the luma and chroma follow in further scans.
+// Grayscale images are written with one component, others as YCbCr 4:2:0.
+// Like image/jpeg, transparent pixels are composited over black.
+func EncodeProgressiveJPEG(w io.Writer, img image.Image, quality int) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= 0 || height <= 0 || width > 65535 || height > 65535 {
+		return fmt.Errorf("invalid JPEG size: %dx%d", width, height)
+	}
+
+	// Scale the quantization tables like image/jpeg
+	quality = max(1, min(100, quality))
+	scale := 200 - quality*2
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	frame := &jpegFrame{width: width, height: height}
+	for t := range jpegQuant {
+		for k := range jpegQuant[t] {
+			frame.quant[t][k] = int32(max(1, min(255, (int(jpegQuant[t][k])*scale+50)/100)))
+		}
+	}
+
+	if _, ok := img.(*image.Gray); ok {
+		frame.components = []*jpegComponent{{id: 1, h: 1, v: 1}}
+	} else {
+		frame.components = []*jpegComponent{
+			{id: 1, h: 2, v: 2},
+			{id: 2, h: 1, v: 1, quant: 1, table: 1},
+			{id: 3, h: 1, v: 1, quant: 1, table: 1},
+		}
+	}
+	frame.layout()
+	defer frame.release()
+	jpegTransformPixels(img, frame)
+	return writeJPEG(w, frame, true, false)
+}
+
+// writeJPEG writes a frame as a baseline JPEG with a single scan, or as a
+// progressive JPEG. The Huffman tables are the typical ones, or with optimize
+// built from the symbol counts of the frame, which takes a second pass.
+func writeJPEG(w io.Writer, f *jpegFrame, progressive, optimize bool) error {
+	bw := bufio.NewWriter(w)
+	bw.Write([]byte{0xFF, 0xD8})
+	for _, segment := range f.segments {
+		bw.Write(segment)
+	}
+
+	// Quantization tables, with 16-bit values if any is beyond 8 bits
+	var quantTables []int
+	for _, c := range f.components {
+		if !slices.Contains(quantTables, c.quant) {
+			quantTables = append(quantTables, c.quant)
+		}
+	}
+	for _, t := range quantTables {
+		precision := 0
+		for _, q := range f.quant[t] {
+			if q > 255 {
+				precision = 1
+			}
+		}
+		writeJPEGMarker(bw, 0xDB, 1+64*(1+precision), func() {
+			bw.WriteByte(byte(precision<<4 | t))
+			for _, q := range f.quant[t] {
+				if precision == 1 {
+					bw.WriteByte(byte(q >> 8))
+				}
+				bw.WriteByte(byte(q))
+			}
+		})
+	}
+
+	// Frame header: baseline (SOF0) or progressive (SOF2)
+	marker := byte(0xC0)
+	if progressive {
+		marker = 0xC2
+	}
+	writeJPEGMarker(bw, marker, 6+3*len(f.components), func() {
+		bw.Write([]byte{8, byte(f.height >> 8), byte(f.height), byte(f.width >> 8), byte(f.width), byte(len(f.components))})
+		for _, c := range f.components {
+			bw.Write([]byte{c.id, byte(c.h<<4 | c.v), byte(c.quant)})
+		}
+	})
+
+	// Huffman tables: luminance, and chrominance if used
+	tables := 1
+	for _, c := range f.components {
+		tables = max(tables, c.table+1)
+	}
+	huffman := jpegHuffmanTables
+	if optimize {
+		var counts [4][256]int
+		writeJPEGScans(bufio.NewWriter(io.Discard), f, progressive, &jpegBitWriter{counts: &counts})
+		for i := 0; i < 2*tables; i++ {
+			if slices.Max(counts[i][:]) == 0 {
+				counts[i][0] = 1 // Decoders reject empty tables
+			}
+			huffman[i] = optimalJPEGHuffman(&counts[i])
+		}
+	}
+	var codes [4][256]jpegCode
+	length := 0
+	for i := 0; i < 2*tables; i++ {
+		length += 17 + len(huffman[i].symbols)
+		codes[i] = huffman[i].codes()
+	}
+	writeJPEGMarker(bw, 0xC4, length, func() {
+		for i := 0; i < 2*tables; i++ {
+			// Class (0 for DC, 1 for AC) and destination
+			bw.WriteByte(byte(i%2<<4 | i/2))
+			bw.Write(huffman[i].counts[:])
+			bw.Write(huffman[i].symbols)
+		}
+	})
+
+	writeJPEGScans(bw, f, progressive, &jpegBitWriter{w: bw, codes: &codes})
+	bw.Write([]byte{0xFF, 0xD9})
+	return bw.Flush()
+}
+
+// writeJPEGScans writes the scans of a frame with coder
+func writeJPEGScans(bw *bufio.Writer, f *jpegFrame, progressive bool, coder *jpegBitWriter) {
+	predictors := make(map[*jpegComponent]int32)
+	encode := func(end int) func(c *jpegComponent, block int) {
+		return func(c *jpegComponent, block int) {
+			b := &c.blocks[block]
+			coder.writeValue(2*c.table, 0, b[0]-predictors[c])
+			predictors[c] = b[0]
+			if end > 0 {
+				coder.writeAC(2*c.table+1, b, 1, end)
+			}
+		}
+	}
+
+	if !progressive {
+		writeJPEGScan(bw, f.components, 0, 63)
+		f.eachMCUBlock(f.components, encode(63), func() {})
+		coder.flush()
+		return
+	}
+
+	// The DC coefficients of all components, interleaved
+	writeJPEGScan(bw, f.components, 0, 0)
+	f.eachMCUBlock(f.components, encode(0), func() {})
+	coder.flush()
+
+	// The AC coefficients, one component and band at a time: the lowest
+	// luma frequencies first, then the chroma, then the luma details
+	type band struct{ component, start, end int }
+	bands := []band{{0, 1, 5}}
+	for i := 1; i < len(f.components); i++ {
+		bands = append(bands, band{i, 1, 63})
+	}
+	bands = append(bands, band{0, 6, 63})
+	for _, b := range bands {
+		c := f.components[b.component]
+		writeJPEGScan(bw, []*jpegComponent{c}, b.start, b.end)
+		f.eachMCUBlock([]*jpegComponent{c}, func(c *jpegComponent, block int) {
+			coder.writeAC(2*c.table+1, &c.blocks[block], b.start, b.end)
+		}, func() {})
+		coder.flush()
+	}
+}
+
+// writeJPEGMarker writes a marker segment with a payload of length bytes
+func writeJPEGMarker(w *bufio.Writer, marker byte, length int, payload func()) {
+	w.Write([]byte{0xFF, marker, byte((length + 2) >> 8), byte(length + 2)})
+	payload()
+}
+
+// writeJPEGScan writes the header of a scan of the coefficients start to end
+// of components, at full precision
+func writeJPEGScan(w *bufio.Writer, components []*jpegComponent, start, end int) {
+	writeJPEGMarker(w, 0xDA, 4+2*len(components), func() {
+		w.WriteByte(byte(len(components)))
+		for _, c := range components {
+			w.Write([]byte{c.id, byte(c.table<<4 | c.table)})
+		}
+		w.Write([]byte{byte(start), byte(end), 0})
+	})
+}
+
+// jpegTransformPixels converts an image to the components of a frame, gray
+// or YCbCr, and stores their quantized DCT coefficients
+func jpegTransformPixels(img image.Image, f *jpegFrame) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if gray, ok := img.(*image.Gray); ok {
+		jpegBlocks(f.components[0], width, height, 1, &f.quant[0], func(x, y int) float64 {
+			return float64(gray.GrayAt(bounds.Min.X+x, bounds.Min.Y+y).Y)
+		})
+		return
+	}
+
+	// Full-resolution planes, composited over black
+	src := imaging.Clone(img)
+	planes := [3][]float64{floatPool.get(width * height), floatPool.get(width * height), floatPool.get(width * height)}
+	defer func() {
+		for _, plane := range planes {
+			floatPool.put(plane)
+		}
+	}()
+	for i := 0; i < width*height; i++ {
+		p := src.Pix[i*4 : i*4+4]
+		a := float64(p[3]) / 255
+		r, g, b := float64(p[0])*a, float64(p[1])*a, float64(p[2])*a
+		planes[0][i] = 0.299*r + 0.587*g + 0.114*b
+		planes[1][i] = -0.168736*r - 0.331264*g + 0.5*b + 128
+		planes[2][i] = 0.5*r - 0.418688*g - 0.081312*b + 128
+	}
+
+	for i, c := range f.components {
+		plane := planes[i]
+		factor := 3 - c.h // 1 for luma, 2 for subsampled chroma
+		jpegBlocks(c, width, height, factor, &f.quant[c.quant], func(x, y int) float64 {
+			// Average the factor x factor pixels a sample covers
+			var sum float64
+			for dy := 0; dy < factor; dy++ {
+				for dx := 0; dx < factor; dx++ {
+					sum += plane[min(y*factor+dy, height-1)*width+min(x*factor+dx, width-1)]
+				}
+			}
+			return sum / float64(factor*factor)
+		})
+	}
+}
+
+// jpegCosines holds cos((2x+1)uπ/16), scaled by C(u)/2 so the 2D DCT is a
+// sum of products
+var jpegCosines = func() (c [8][8]float64) {
+	for x := 0; x < 8; x++ {
+		for u := 0; u < 8; u++ {
+			scale := 0.5
+			if u == 0 {
+				scale = 0.5 / math.Sqrt2
+			}
+			c[x][u] = scale * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+	return c
+}()
+
+// jpegBlocks transforms and quantizes the blocks of a component. sample
+// returns the component at a position in its own resolution, which is the
+// image size divided by factor; positions beyond it repeat the last row and
+// column.
+func jpegBlocks(c *jpegComponent, width, height, factor int, quant *[64]int32, sample func(x, y int) float64) {
+	lastX := (width+factor-1)/factor - 1
+	lastY := (height+factor-1)/factor - 1
+	var pixels, rows [64]float64
+	for by := 0; by < c.blocksH; by++ {
+		for bx := 0; bx < c.blocksW; bx++ {
+			for y := 0; y < 8; y++ {
+				for x := 0; x < 8; x++ {
+					pixels[y*8+x] = sample(min(bx*8+x, lastX), min(by*8+y, lastY)) - 128
+				}
+			}
+
+			// Separable DCT: rows, then columns
+			for y := 0; y < 8; y++ {
+				for u := 0; u < 8; u++ {
+					var sum float64
+					for x := 0; x < 8; x++ {
+						sum += pixels[y*8+x] * jpegCosines[x][u]
+					}
+					rows[y*8+u] = sum
+				}
+			}
+			block := &c.blocks[by*c.blocksW+bx]
+			for k, natural := range jpegZigzag {
+				v, u := natural/8, natural%8
+				var sum float64
+				for y := 0; y < 8; y++ {
+					sum += rows[y*8+u] * jpegCosines[y][v]
+				}
+				block[k] = int32(math.Round(sum / float64(quant[k])))
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"nim/pkg/compare"
+)
+
+// gradient returns an image with smooth color changes and some edges
+func gradient(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{uint8(x * 255 / w), uint8(y * 255 / h), uint8((x + y) % 64 * 4), 255}
+			if (x/10+y/10)%2 == 0 {
+				c.B = 255 - c.B
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestEncodeProgressiveJPEG(t *testing.T) {
+	// Sizes that are and are not whole MCUs
+	for _, size := range [][2]int{{64, 48}, {37, 21}, {1, 1}, {17, 300}} {
+		img := gradient(size[0], size[1])
+
+		var buf bytes.Buffer
+		if err := EncodeProgressiveJPEG(&buf, img, 90); err != nil {
+			t.Fatalf("%v: encode failed: %v", size, err)
+		}
+		if !bytes.Contains(buf.Bytes()[:200], []byte{0xFF, 0xC2}) {
+			t.Errorf("%v: expected a progressive (SOF2) frame", size)
+		}
+
+		decoded, err := jpeg.Decode(&buf)
+		if err != nil {
+			t.Fatalf("%v: decode failed: %v", size, err)
+		}
+		if decoded.Bounds().Dx() != size[0] || decoded.Bounds().Dy() != size[1] {
+			t.Fatalf("%v: decoded as %v", size, decoded.Bounds())
+		}
+
+		// Close to what the baseline encoder produces at the same quality
+		var baseline bytes.Buffer
+		jpeg.Encode(&baseline, img, &jpeg.Options{Quality: 90})
+		reference, _ := jpeg.Decode(&baseline)
+		progressive, _ := compare.Compare(img, decoded)
+		expected, _ := compare.Compare(img, reference)
+		if progressive.PSNR < expected.PSNR-1.5 {
+			t.Errorf("%v: PSNR %.1f dB, baseline %.1f dB", size, progressive.PSNR, expected.PSNR)
+		}
+	}
+}
+
+func TestEncodeProgressiveJPEGGray(t *testing.T) {
+	img := imaging.Grayscale(gradient(40, 30))
+	gray := image.NewGray(img.Bounds())
+	for i := range gray.Pix {
+		gray.Pix[i] = img.Pix[i*4]
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeProgressiveJPEG(&buf, gray, 75); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	decoded, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if _, ok := decoded.(*image.Gray); !ok {
+		t.Errorf("Expected a grayscale JPEG, got %T", decoded)
+	}
+	if result, _ := compare.Compare(gray, decoded); result.PSNR < 30 {
+		t.Errorf("Expected a PSNR above 30 dB, got %.1f", result.PSNR)
+	}
+}
+
+func TestEncodeProgressiveJPEGQuality(t *testing.T) {
+	img := gradient(128, 128)
+	var low, high bytes.Buffer
+	EncodeProgressiveJPEG(&low, img, 20)
+	EncodeProgressiveJPEG(&high, img, 95)
+	if low.Len() >= high.Len() {
+		t.Errorf("Expected quality 20 to be smaller than 95, got %d and %d bytes", low.Len(), high.Len())
+	}
+
+	if err := EncodeProgressiveJPEG(&low, image.NewNRGBA(image.Rect(0, 0, 0, 0)), 90); err == nil {
+		t.Errorf("Expected an error for an empty image")
+	}
+}
+
+func TestEncodeJPEG(t *testing.T) {
+	img := gradient(32, 32)
+	for _, progressive := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := EncodeJPEG(&buf, img, 80, JPEGOptions{Progressive: progressive}); err != nil {
+			t.Fatal(err)
+		}
+		if sof2 := bytes.Contains(buf.Bytes()[:200], []byte{0xFF, 0xC2}); sof2 != progressive {
+			t.Errorf("progressive %v: SOF2 frame %v", progressive, sof2)
+		}
+	}
+}
+
+func TestOptimalJPEGHuffman(t *testing.T) {
+	// Fibonacci counts would give codes far longer than 16 bits
+	var counts [256]int
+	a, b := 1, 1
+	for i := 0; i < 40; i++ {
+		counts[i] = a
+		a, b = b, a+b
+	}
+	h := optimalJPEGHuffman(&counts)
+	if len(h.symbols) != 40 {
+		t.Fatalf("%d symbols, expected 40", len(h.symbols))
+	}
+	// The codes must fit in 16 bits and leave the all-ones code unused
+	space := 0
+	for i, n := range h.counts {
+		space += int(n) << (15 - i)
+	}
+	if space >= 1<<16 {
+		t.Errorf("codes fill %d of %d", space, 1<<16)
+	}
+	codes := h.codes()
+	if codes[39].length > codes[0].length {
+		t.Errorf("most frequent symbol has %d bits, least %d", codes[39].length, codes[0].length)
+	}
+}
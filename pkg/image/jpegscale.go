@@ -0,0 +1,270 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// jpegScaledCosines holds cos((2x+1)uπ/2n) for the n x n inverse DCTs that
+// decode a block to 8, 4, 2 or 1 pixels across, indexed by n and scaled by
+// C(u)/2 like jpegCosines so the average of the block is kept
+var jpegScaledCosines = func() (c [9][8][8]float64) {
+	for n := 1; n <= 8; n *= 2 {
+		for x := 0; x < n; x++ {
+			for u := 0; u < n; u++ {
+				scale := 0.5
+				if u == 0 {
+					scale = 0.5 / math.Sqrt2
+				}
+				c[n][x][u] = scale * math.Cos(float64(2*x+1)*float64(u)*math.Pi/float64(2*n))
+			}
+		}
+	}
+	return c
+}()
+
+// DecodeJPEGScaled decodes a baseline or progressive JPEG at 1/scale of its
+// size, scale being 1, 2, 4 or 8, by running a smaller inverse DCT on the
+// lowest frequencies of each block. This is several times faster than
+// decoding the whole image and shrinking it. Gray, YCbCr and RGB JPEGs are
+// supported, but not CMYK.
+func DecodeJPEGScaled(r io.Reader, scale int) (*image.NRGBA, error) {
+	if !slices.Contains([]int{1, 2, 4, 8}, scale) {
+		return nil, fmt.Errorf("invalid JPEG scale: %d (expected 1, 2, 4 or 8)", scale)
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, fmt.Errorf("failed to read JPEG: %w", err)
+	}
+	return decodeJPEGScaled(buf.Bytes(), scale)
+}
+
+// decodeJPEGScaled decodes JPEG data like DecodeJPEGScaled
+func decodeJPEGScaled(data []byte, scale int) (*image.NRGBA, error) {
+	f, err := readJPEGFrame(data)
+	if err != nil {
+		return nil, err
+	}
+	defer f.release()
+	if len(f.components) != 1 && len(f.components) != 3 {
+		return nil, fmt.Errorf("unsupported JPEG: %d components", len(f.components))
+	}
+
+	// Subsampled components keep more of each block, so every component is
+	// decoded at the output resolution up to its full resolution
+	width, height := (f.width+scale-1)/scale, (f.height+scale-1)/scale
+	mcuW, mcuH := f.mcuSize()
+	planes := make([]jpegPlane, len(f.components))
+	for i, c := range f.components {
+		nx, ny := min(8, mcuW/c.h/scale), min(8, mcuH/c.v/scale)
+		planes[i] = jpegPlane{
+			pix:    jpegScaledPlane(c, &f.quant[c.quant], nx, ny),
+			stride: c.blocksW * nx,
+			// Plane samples per output pixel, and the last one in the image
+			rx: float64(nx*c.h*scale) / float64(mcuW),
+			ry: float64(ny*c.v*scale) / float64(mcuH),
+		}
+		planes[i].lastX = int(math.Ceil(float64(width)*planes[i].rx)) - 1
+		planes[i].lastY = int(math.Ceil(float64(height)*planes[i].ry)) - 1
+		defer bytePool.put(planes[i].pix)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	rgb := jpegRGB(f)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var s [3]uint8
+			for i, plane := range planes {
+				s[i] = plane.at(x, y)
+			}
+			p := dst.Pix[y*dst.Stride+x*4:]
+			switch {
+			case len(f.components) == 1:
+				p[0], p[1], p[2] = s[0], s[0], s[0]
+			case rgb:
+				p[0], p[1], p[2] = s[0], s[1], s[2]
+			default:
+				p[0], p[1], p[2] = color.YCbCrToRGB(s[0], s[1], s[2])
+			}
+			p[3] = 255
+		}
+	}
+	return dst, nil
+}
+
+// jpegPlane is a decoded component, with rx x ry of its samples per pixel
+// of the image
+type jpegPlane struct {
+	pix          []uint8
+	stride       int
+	rx, ry       float64
+	lastX, lastY int
+}
+
+// at returns the component at pixel x, y of the image. Components at a lower
+// resolution are interpolated between their four nearest samples like the
+// fancy upsampling of libjpeg, so color edges do not turn into steps.
+func (p *jpegPlane) at(x, y int) uint8 {
+	if p.rx == 1 && p.ry == 1 {
+		return p.pix[y*p.stride+x]
+	}
+	fx := (float64(x)+0.5)*p.rx - 0.5
+	fy := (float64(y)+0.5)*p.ry - 0.5
+	x0, y0 := int(math.Floor(fx)), int(math.Floor(fy))
+	tx, ty := fx-float64(x0), fy-float64(y0)
+	sample := func(sx, sy int) float64 {
+		return float64(p.pix[max(0, min(sy, p.lastY))*p.stride+max(0, min(sx, p.lastX))])
+	}
+	top := sample(x0, y0)*(1-tx) + sample(x0+1, y0)*tx
+	bottom := sample(x0, y0+1)*(1-tx) + sample(x0+1, y0+1)*tx
+	return uint8(math.Round(top*(1-ty) + bottom*ty))
+}
+
+// jpegScaledPlane dequantizes the blocks of a component and transforms the
+// lowest nx x ny coefficients of each back to nx x ny pixels. The plane comes
+// from bytePool.
+func jpegScaledPlane(c *jpegComponent, quant *[64]int32, nx, ny int) []uint8 {
+	stride := c.blocksW * nx
+	plane := bytePool.get(stride * c.blocksH * ny)
+	cx, cy := &jpegScaledCosines[nx], &jpegScaledCosines[ny]
+	var coefficients, rows [64]float64
+	for b, block := range c.blocks {
+		for k, natural := range jpegZigzag {
+			if v, u := natural/8, natural%8; u < nx && v < ny {
+				coefficients[v*8+u] = float64(block[k] * quant[k])
+			}
+		}
+
+		// Separable inverse DCT: rows, then columns
+		for v := 0; v < ny; v++ {
+			for x := 0; x < nx; x++ {
+				var sum float64
+				for u := 0; u < nx; u++ {
+					sum += coefficients[v*8+u] * cx[x][u]
+				}
+				rows[v*8+x] = sum
+			}
+		}
+		bx, by := b%c.blocksW, b/c.blocksW
+		for y := 0; y < ny; y++ {
+			row := plane[(by*ny+y)*stride+bx*nx:]
+			for x := 0; x < nx; x++ {
+				var sum float64
+				for v := 0; v < ny; v++ {
+					sum += rows[v*8+x] * cy[y][v]
+				}
+				row[x] = uint8(max(0, min(255, math.Round(sum+128))))
+			}
+		}
+	}
+	return plane
+}
+
+// jpegRGB reports whether the three components of a JPEG are RGB instead of
+// YCbCr: with an Adobe segment that says so, or with R, G and B as their IDs
+func jpegRGB(f *jpegFrame) bool {
+	for _, segment := range f.segments {
+		if segment[1] == 0xEE && len(segment) >= 16 && bytes.HasPrefix(segment[4:], []byte("Adobe")) {
+			return segment[15] == 0
+		}
+	}
+	c := f.components
+	return len(c) == 3 && c[0].id == 'R' && c[1].id == 'G' && c[2].id == 'B'
+}
+
+// JPEGDecodeScale returns the largest of 1, 2, 4 and 8 that a width x height
+// JPEG can be shrunk by on decode (see DecodeJPEGScaled) before the resize
+// in options. At least twice the resolution the resize needs is kept, so it
+// still filters the result. Inputs cropped before resizing are not shrunk.
+func JPEGDecodeScale(width, height int, options ProcessOptions) int {
+	if options.Width <= 0 || options.Height <= 0 || width <= 0 || height <= 0 {
+		return 1
+	}
+	order := options.Order
+	if len(order) == 0 {
+		order = DefaultOrder
+	}
+	// The resize applies to the rotated image
+	if options.Rotate%180 != 0 {
+		width, height = height, width
+	}
+	resize := slices.Index(order, OperationResize)
+	if resize < 0 || !options.Crop.Empty() && slices.Index(order, OperationCrop) < resize {
+		return 1
+	}
+
+	// Size of the source after the resize, before any padding or cropping
+	needW, needH := float64(options.Width), float64(options.Height)
+	switch ratioW, ratioH := needW/float64(width), needH/float64(height); options.ResizeMode {
+	case ResizeModeFit:
+		ratio := min(ratioW, ratioH)
+		needW, needH = float64(width)*ratio, float64(height)*ratio
+	case ResizeModeFill, ResizeModeLiquid:
+		ratio := max(ratioW, ratioH)
+		needW, needH = float64(width)*ratio, float64(height)*ratio
+	case ResizeModeStretch:
+	default:
+		return 1
+	}
+
+	scale := 1
+	for next := 2; next <= 8; next *= 2 {
+		if float64((width+next-1)/next) < 2*needW || float64((height+next-1)/next) < 2*needH {
+			break
+		}
+		scale = next
+	}
+	return scale
+}
+
+// openJPEGScaled decodes a JPEG input at the scale JPEGDecodeScale picks for
+// options, returning the image and the full size of the input. It returns a
+// nil image if the input is not a JPEG, needs no scaling or cannot be decoded
+// this way, so the caller decodes it in full.
+func openJPEGScaled(filename string, options ProcessOptions) (image.Image, image.Point) {
+	if ext := strings.ToLower(filepath.Ext(filename)); ext != ".jpg" && ext != ".jpeg" {
+		return nil, image.Point{}
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, image.Point{}
+	}
+	defer file.Close()
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if _, err := buf.ReadFrom(file); err != nil {
+		return nil, image.Point{}
+	}
+	data := buf.Bytes()
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, image.Point{}
+	}
+	scale := JPEGDecodeScale(config.Width, config.Height, options)
+	if scale == 1 {
+		return nil, image.Point{}
+	}
+
+	defer options.Hooks.Start(StageDecode)()
+	start := time.Now()
+	img, err := decodeJPEGScaled(data, scale)
+	if err != nil {
+		slog.Debug("decoding the full JPEG", "file", filename, "reason", err)
+		return nil, image.Point{}
+	}
+	slog.Info("decoded image", "file", filename, "format", "jpeg", "size", fmt.Sprintf("%dx%d", config.Width, config.Height),
+		"scale", fmt.Sprintf("1/%d", scale), "duration", time.Since(start))
+	return img, image.Pt(config.Width, config.Height)
+}
@@ -0,0 +1,69 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"nim/pkg/compare"
+)
+
+func TestDecodeJPEGScaled(t *testing.T) {
+	gray := imaging.Grayscale(gradient(64, 48))
+	for name, img := range map[string]image.Image{"color": gradient(64, 48), "gray": image.Image(gray)} {
+		for _, progressive := range []bool{false, true} {
+			data := encodeJPEG(t, img, progressive)
+			for _, scale := range []int{1, 2, 4, 8} {
+				decoded, err := DecodeJPEGScaled(bytes.NewReader(data), scale)
+				if err != nil {
+					t.Fatal(err)
+				}
+				size := image.Pt(64/scale, 48/scale)
+				if decoded.Bounds().Size() != size {
+					t.Fatalf("%s 1/%d: decoded as %v, expected %v", name, scale, decoded.Bounds().Size(), size)
+				}
+				// Close to shrinking the image with a box filter; at full size, the
+				// chroma edges of the gradient lose the most
+				shrunk := imaging.Resize(img, size.X, size.Y, imaging.Box)
+				result, err := compare.Compare(shrunk, decoded)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if limit := map[int]float64{1: 24, 2: 30, 4: 30, 8: 30}[scale]; result.PSNR < limit {
+					t.Errorf("%s, progressive %v, 1/%d: PSNR %.1f dB", name, progressive, scale, result.PSNR)
+				}
+			}
+		}
+	}
+
+	data := encodeJPEG(t, gradient(16, 16), false)
+	if _, err := DecodeJPEGScaled(bytes.NewReader(data), 3); err == nil {
+		t.Error("expected an error for scale 3")
+	}
+}
+
+func TestJPEGDecodeScale(t *testing.T) {
+	fit := ProcessOptions{Width: 300, Height: 300, ResizeMode: ResizeModeFit}
+	for _, test := range []struct {
+		width, height int
+		options       ProcessOptions
+		scale         int
+	}{
+		{6000, 4000, fit, 8},
+		{2400, 1600, fit, 4},
+		{1200, 800, fit, 2},
+		{1000, 800, fit, 1},
+		{6000, 4000, ProcessOptions{Width: 300, Height: 300, ResizeMode: ResizeModeFill}, 4},
+		{6000, 4000, ProcessOptions{Width: 1000, Height: 100, ResizeMode: ResizeModeStretch}, 2},
+		{6000, 4000, ProcessOptions{Width: 300, Height: 300, ResizeMode: ResizeModeFit, Crop: image.Rect(0, 0, 100, 100)}, 1},
+		{6000, 4000, ProcessOptions{Width: 300, Height: 300, ResizeMode: ResizeModeFit, Crop: image.Rect(0, 0, 100, 100),
+			Order: []string{OperationResize, OperationCrop}}, 8},
+		{6000, 4000, ProcessOptions{ResizeMode: ResizeModeFit}, 1},
+	} {
+		if scale := JPEGDecodeScale(test.width, test.height, test.options); scale != test.scale {
+			t.Errorf("%dx%d to %dx%d %s: scale %d, expected %d", test.width, test.height,
+				test.options.Width, test.options.Height, test.options.ResizeMode, scale, test.scale)
+		}
+	}
+}
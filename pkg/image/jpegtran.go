@@ -0,0 +1,823 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"slices"
+)
+
+// JPEGTransform describes a lossless transform of a JPEG: the quantized DCT
+// coefficients are moved and sign-flipped instead of decoded and encoded
+// again, so the image quality is preserved exactly, like jpegtran does
+type JPEGTransform struct {
+	AutoOrient  bool            // Apply the EXIF orientation first and reset it
+	Rotate      int             // Clockwise rotation in degrees: 0, 90, 180 or 270
+	FlipH       bool            // Mirror left to right, after rotating
+	FlipV       bool            // Mirror top to bottom, after rotating
+	Crop        image.Rectangle // Region to keep, after rotating and flipping; empty keeps all
+	Progressive bool            // Write a progressive instead of a baseline JPEG
+}
+
+// jpegOrientation maps source to destination coordinates relative to the
+// image center, as the matrix of a transpose followed by flips
+type jpegOrientation [2][2]int
+
+var jpegIdentity = jpegOrientation{{1, 0}, {0, 1}}
+
+// then returns the orientation of o followed by next
+func (o jpegOrientation) then(next jpegOrientation) jpegOrientation {
+	var m jpegOrientation
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			m[i][j] = next[i][0]*o[0][j] + next[i][1]*o[1][j]
+		}
+	}
+	return m
+}
+
+// transposed reports whether the orientation swaps the axes
+func (o jpegOrientation) transposed() bool {
+	return o[0][0] == 0
+}
+
+// flips reports whether the orientation mirrors the destination x and y
+// axes after the transpose
+func (o jpegOrientation) flips() (bool, bool) {
+	return o[0][0]+o[0][1] < 0, o[1][0]+o[1][1] < 0
+}
+
+// exifOrientations maps the EXIF orientation values to the transform that
+// displays an image upright
+var exifOrientations = map[int]jpegOrientation{
+	1: jpegIdentity,
+	2: {{-1, 0}, {0, 1}},  // Mirrored horizontally
+	3: {{-1, 0}, {0, -1}}, // Rotated 180°
+	4: {{1, 0}, {0, -1}},  // Mirrored vertically
+	5: {{0, 1}, {1, 0}},   // Transposed
+	6: {{0, -1}, {1, 0}},  // Rotated 90° clockwise
+	7: {{0, -1}, {-1, 0}}, // Transversed
+	8: {{0, 1}, {-1, 0}},  // Rotated 90° counterclockwise
+}
+
+// orientation returns the rotation and flips of t after the EXIF orientation
+func (t JPEGTransform) orientation(exif int) (jpegOrientation, error) {
+	o := jpegIdentity
+	if t.AutoOrient {
+		if e, ok := exifOrientations[exif]; ok {
+			o = e
+		}
+	}
+	switch t.Rotate {
+	case 0:
+	case 90:
+		o = o.then(exifOrientations[6])
+	case 180:
+		o = o.then(exifOrientations[3])
+	case 270:
+		o = o.then(exifOrientations[8])
+	default:
+		return o, fmt.Errorf("invalid rotation: %d (expected 0, 90, 180 or 270)", t.Rotate)
+	}
+	if t.FlipH {
+		o = o.then(exifOrientations[2])
+	}
+	if t.FlipV {
+		o = o.then(exifOrientations[4])
+	}
+	return o, nil
+}
+
+// TransformJPEG rotates, flips and crops a JPEG without re-encoding it.
+// Partial MCUs (8 or 16 pixel blocks) at the right or bottom edge that a
+// flip would move to the left or top are trimmed, and crops must start on
+// the MCU grid. APPn and COM segments such as EXIF are copied; with
+// AutoOrient, the EXIF orientation and pixel dimensions are updated to match.
+func TransformJPEG(r io.Reader, w io.Writer, t JPEGTransform) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read JPEG: %w", err)
+	}
+	src, err := readJPEGFrame(data)
+	if err != nil {
+		return err
+	}
+	defer src.release()
+
+	o, err := t.orientation(exifOrientation(src.segments))
+	if err != nil {
+		return err
+	}
+	dst, err := transformJPEGFrame(src, o, t.Crop)
+	if err != nil {
+		return err
+	}
+	defer dst.release()
+	if t.AutoOrient {
+		for _, segment := range dst.segments {
+			updateEXIF(segment, dst.width, dst.height)
+		}
+	}
+	return writeJPEG(w, dst, t.Progressive, false)
+}
+
+// OptimizeJPEG losslessly recompresses a JPEG with Huffman tables built for
+// its coefficients, as a baseline or a progressive JPEG, whichever is
+// smaller. Comments, XMP and other metadata are dropped; the JFIF, ICC
+// profile and Adobe segments, which affect how the pixels are shown, are
+// kept, and so is EXIF data that rotates the image. The original data is
+// returned if it cannot be made smaller.
+func OptimizeJPEG(data []byte) ([]byte, error) {
+	frame, err := readJPEGFrame(data)
+	if err != nil {
+		return nil, err
+	}
+	defer frame.release()
+	rotated := exifOrientation(frame.segments) != 1
+	frame.segments = slices.DeleteFunc(frame.segments, func(segment []byte) bool {
+		switch {
+		case segment[1] == 0xE0 && bytes.HasPrefix(segment[4:], []byte("JFIF\x00")),
+			segment[1] == 0xE2 && bytes.HasPrefix(segment[4:], []byte("ICC_PROFILE\x00")),
+			segment[1] == 0xEE && bytes.HasPrefix(segment[4:], []byte("Adobe")):
+			return false
+		case rotated:
+			tiff, _ := exifTiff(segment)
+			return tiff == nil
+		}
+		return true
+	})
+
+	best := data
+	for _, progressive := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := writeJPEG(&buf, frame, progressive, true); err != nil {
+			return nil, err
+		}
+		if buf.Len() < len(best) {
+			best = buf.Bytes()
+		}
+	}
+	return best, nil
+}
+
+// transformJPEGFrame moves and sign-flips the coefficient blocks of a frame,
+// then crops it
+func transformJPEGFrame(src *jpegFrame, o jpegOrientation, crop image.Rectangle) (*jpegFrame, error) {
+	transpose := o.transposed()
+	flipX, flipY := o.flips()
+
+	dst := &jpegFrame{width: src.width, height: src.height, quant: src.quant, segments: src.segments}
+	for _, c := range src.components {
+		d := *c
+		if transpose {
+			d.h, d.v = c.v, c.h
+		}
+		d.blocks = nil
+		dst.components = append(dst.components, &d)
+	}
+	if transpose {
+		dst.width, dst.height = src.height, src.width
+	}
+
+	// Trim partial MCUs that a flip would move to the leading edge
+	mcuW, mcuH := dst.mcuSize()
+	full := [2]int{dst.width, dst.height}
+	if flipX && dst.width%mcuW != 0 {
+		dst.width -= dst.width % mcuW
+		slog.Info("trimmed partial MCU column", "width", dst.width)
+	}
+	if flipY && dst.height%mcuH != 0 {
+		dst.height -= dst.height % mcuH
+		slog.Info("trimmed partial MCU row", "height", dst.height)
+	}
+	if dst.width == 0 || dst.height == 0 {
+		return nil, fmt.Errorf("image is smaller than one %dx%d MCU and cannot be flipped losslessly", mcuW, mcuH)
+	}
+	trimmed := [2]int{dst.width, dst.height}
+
+	// Crop to whole MCUs at the top left
+	var offsetX, offsetY int
+	if !crop.Empty() {
+		if !crop.In(image.Rect(0, 0, dst.width, dst.height)) {
+			return nil, fmt.Errorf("crop region %dx%d+%d+%d is outside the %dx%d image",
+				crop.Dx(), crop.Dy(), crop.Min.X, crop.Min.Y, dst.width, dst.height)
+		}
+		if crop.Min.X%mcuW != 0 || crop.Min.Y%mcuH != 0 {
+			return nil, fmt.Errorf("crop offset +%d+%d is not on the %dx%d MCU grid: lossless crops must start at multiples of it",
+				crop.Min.X, crop.Min.Y, mcuW, mcuH)
+		}
+		offsetX, offsetY = crop.Min.X/mcuW, crop.Min.Y/mcuH
+		dst.width, dst.height = crop.Dx(), crop.Dy()
+	}
+	dst.layout()
+
+	for ci, d := range dst.components {
+		s := src.components[ci]
+		// Blocks of the component across the image before cropping: whole
+		// MCUs on flipped axes, and the padded source blocks on others
+		blocksW := (full[0] + mcuW - 1) / mcuW * d.h
+		if flipX {
+			blocksW = trimmed[0] / mcuW * d.h
+		}
+		blocksH := (full[1] + mcuH - 1) / mcuH * d.v
+		if flipY {
+			blocksH = trimmed[1] / mcuH * d.v
+		}
+
+		for by := 0; by < d.blocksH; by++ {
+			for bx := 0; bx < d.blocksW; bx++ {
+				x, y := bx+offsetX*d.h, by+offsetY*d.v
+				if x >= blocksW || y >= blocksH {
+					continue
+				}
+				if flipX {
+					x = blocksW - 1 - x
+				}
+				if flipY {
+					y = blocksH - 1 - y
+				}
+				if transpose {
+					x, y = y, x
+				}
+				if x >= s.blocksW || y >= s.blocksH {
+					continue
+				}
+				transformJPEGBlock(&s.blocks[y*s.blocksW+x], &d.blocks[by*d.blocksW+bx], transpose, flipX, flipY)
+			}
+		}
+	}
+	return dst, nil
+}
+
+// transformJPEGBlock transposes and flips the coefficients of a block.
+// Transposing swaps the horizontal and vertical frequencies, and mirroring
+// negates the odd frequencies along the mirrored axis.
+func transformJPEGBlock(src, dst *[64]int32, transpose, flipX, flipY bool) {
+	var natural [64]int32
+	for k, n := range jpegZigzag {
+		natural[n] = src[k]
+	}
+	for k, n := range jpegZigzag {
+		v, u := n/8, n%8
+		if transpose {
+			u, v = v, u
+		}
+		c := natural[v*8+u]
+		if flipX && n%8%2 == 1 {
+			c = -c
+		}
+		if flipY && n/8%2 == 1 {
+			c = -c
+		}
+		dst[k] = c
+	}
+}
+
+// exifOrientation returns the orientation in the EXIF segment among
+// segments, or 1 if there is none
+func exifOrientation(segments [][]byte) int {
+	for _, segment := range segments {
+		if orientation := exifTag(segment, 0x0112, 0); orientation > 0 {
+			return orientation
+		}
+	}
+	return 1
+}
+
+// exifTiff returns the TIFF structure of an APP1 EXIF segment with its byte
+// order, or nil
+func exifTiff(segment []byte) ([]byte, binary.ByteOrder) {
+	if len(segment) < 4+6+8 || segment[1] != 0xE1 || string(segment[4:10]) != "Exif\x00\x00" {
+		return nil, nil
+	}
+	tiff := segment[10:]
+	switch string(tiff[:2]) {
+	case "II":
+		return tiff, binary.LittleEndian
+	case "MM":
+		return tiff, binary.BigEndian
+	}
+	return nil, nil
+}
+
+// exifEntries calls fn with each 12-byte entry of the IFD at offset
+func exifEntries(tiff []byte, bo binary.ByteOrder, offset uint32, fn func(entry []byte)) {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return
+	}
+	count := int(bo.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		start := int(offset) + 2 + i*12
+		if start+12 > len(tiff) {
+			return
+		}
+		fn(tiff[start : start+12])
+	}
+}
+
+// exifTag returns the SHORT or LONG value of a tag in IFD0, or in the EXIF
+// IFD if ifd is 0x8769, or 0 if it is missing
+func exifTag(segment []byte, tag uint16, ifd uint16) int {
+	tiff, bo := exifTiff(segment)
+	if tiff == nil {
+		return 0
+	}
+	value := 0
+	visit := func(offset uint32) {
+		exifEntries(tiff, bo, offset, func(entry []byte) {
+			if bo.Uint16(entry) == tag {
+				if values := tiffValues(tiff, bo, entry); len(values) > 0 {
+					value = int(values[0])
+				}
+			}
+		})
+	}
+	ifd0 := bo.Uint32(tiff[4:])
+	if ifd == 0 {
+		visit(ifd0)
+	} else if exif := exifTag(segment, ifd, 0); exif > 0 {
+		visit(uint32(exif))
+	}
+	return value
+}
+
+// updateEXIF resets the orientation in an EXIF segment to upright and sets
+// the pixel dimensions, in place. Other segments are left alone.
+func updateEXIF(segment []byte, width, height int) {
+	tiff, bo := exifTiff(segment)
+	if tiff == nil {
+		return
+	}
+	set := func(entry []byte, value int) {
+		switch bo.Uint16(entry[2:]) {
+		case 3: // SHORT
+			bo.PutUint16(entry[8:], uint16(value))
+		case 4: // LONG
+			bo.PutUint32(entry[8:], uint32(value))
+		}
+	}
+	exifEntries(tiff, bo, bo.Uint32(tiff[4:]), func(entry []byte) {
+		if bo.Uint16(entry) == 0x0112 {
+			set(entry, 1)
+		}
+	})
+	if exif := exifTag(segment, 0x8769, 0); exif > 0 {
+		exifEntries(tiff, bo, uint32(exif), func(entry []byte) {
+			switch bo.Uint16(entry) {
+			case 0xA002: // PixelXDimension
+				set(entry, width)
+			case 0xA003: // PixelYDimension
+				set(entry, height)
+			}
+		})
+	}
+}
+
+// readJPEGFrame reads the quantized coefficients of a baseline or
+// progressive JPEG, without the inverse DCT
+func readJPEGFrame(data []byte) (*jpegFrame, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, fmt.Errorf("not a JPEG file")
+	}
+
+	f := &jpegFrame{}
+	var tables [2][4]*jpegHuffmanDecoder // DC and AC tables
+	restart, scans := 0, 0
+	pos := 2
+	for {
+		if pos >= len(data) || data[pos] != 0xFF {
+			if scans > 0 {
+				// Tolerate a missing EOI after the scans, like most decoders
+				return f, nil
+			}
+			return nil, fmt.Errorf("corrupt JPEG: missing marker")
+		}
+		for pos < len(data) && data[pos] == 0xFF {
+			pos++
+		}
+		if pos >= len(data) {
+			continue
+		}
+		marker := data[pos]
+		pos++
+		if marker == 0xD9 { // EOI
+			if scans == 0 {
+				return nil, fmt.Errorf("corrupt JPEG: no image data")
+			}
+			return f, nil
+		}
+		if marker == 0x01 || marker >= 0xD0 && marker <= 0xD7 {
+			continue
+		}
+
+		if pos+2 > len(data) {
+			return nil, fmt.Errorf("corrupt JPEG: truncated segment")
+		}
+		length := int(data[pos])<<8 | int(data[pos+1])
+		if length < 2 || pos+length > len(data) {
+			return nil, fmt.Errorf("corrupt JPEG: truncated segment")
+		}
+		start := pos - 2
+		p := data[pos+2 : pos+length]
+		pos += length
+
+		switch {
+		case marker >= 0xE0 && marker <= 0xEF, marker == 0xFE: // APPn, COM
+			f.segments = append(f.segments, slices.Clone(data[start:pos]))
+		case marker == 0xDB: // DQT
+			for len(p) > 0 {
+				precision, table := p[0]>>4, p[0]&15
+				size := 64 * (1 + int(precision))
+				if table > 3 || precision > 1 || len(p) < 1+size {
+					return nil, fmt.Errorf("corrupt JPEG: invalid quantization table")
+				}
+				for k := range 64 {
+					if precision == 0 {
+						f.quant[table][k] = int32(p[1+k])
+					} else {
+						f.quant[table][k] = int32(p[1+2*k])<<8 | int32(p[2+2*k])
+					}
+				}
+				p = p[1+size:]
+			}
+		case marker == 0xC4: // DHT
+			for len(p) > 0 {
+				class, table := p[0]>>4, p[0]&15
+				if class > 1 || table > 3 || len(p) < 17 {
+					return nil, fmt.Errorf("corrupt JPEG: invalid Huffman table")
+				}
+				var h jpegHuffman
+				copy(h.counts[:], p[1:17])
+				total := 0
+				for _, n := range h.counts {
+					total += int(n)
+				}
+				if total > 256 || len(p) < 17+total {
+					return nil, fmt.Errorf("corrupt JPEG: invalid Huffman table")
+				}
+				h.symbols = p[17 : 17+total]
+				tables[class][table] = newJPEGHuffmanDecoder(&h)
+				p = p[17+total:]
+			}
+		case marker == 0xDD: // DRI
+			if len(p) < 2 {
+				return nil, fmt.Errorf("corrupt JPEG: invalid restart interval")
+			}
+			restart = int(p[0])<<8 | int(p[1])
+		case marker == 0xC0, marker == 0xC1, marker == 0xC2: // SOF0, SOF1, SOF2
+			if err := f.readSOF(p); err != nil {
+				return nil, err
+			}
+		case marker >= 0xC3 && marker <= 0xCF && marker != 0xC8 && marker != 0xCC:
+			return nil, fmt.Errorf("unsupported JPEG coding process: SOF%d", marker-0xC0)
+		case marker == 0xDA: // SOS
+			if f.components == nil {
+				return nil, fmt.Errorf("corrupt JPEG: scan before frame header")
+			}
+			end, err := f.readScan(data, pos, p, &tables, restart)
+			if err != nil {
+				return nil, err
+			}
+			pos = end
+			scans++
+		}
+	}
+}
+
+// readSOF reads a frame header and allocates the coefficient blocks
+func (f *jpegFrame) readSOF(p []byte) error {
+	if f.components != nil {
+		return fmt.Errorf("unsupported JPEG: multiple frames")
+	}
+	if len(p) < 6 {
+		return fmt.Errorf("corrupt JPEG: invalid frame header")
+	}
+	if p[0] != 8 {
+		return fmt.Errorf("unsupported JPEG precision: %d bits", p[0])
+	}
+	f.height = int(p[1])<<8 | int(p[2])
+	f.width = int(p[3])<<8 | int(p[4])
+	if f.width == 0 || f.height == 0 {
+		return fmt.Errorf("invalid JPEG dimensions")
+	}
+	count := int(p[5])
+	if count == 0 || count > 4 || len(p) < 6+3*count {
+		return fmt.Errorf("corrupt JPEG: invalid frame header")
+	}
+	for i := range count {
+		c := p[6+3*i:]
+		h, v, quant := int(c[1]>>4), int(c[1]&15), int(c[2])
+		if h < 1 || h > 4 || v < 1 || v > 4 || quant > 3 {
+			return fmt.Errorf("corrupt JPEG: invalid component %d", c[0])
+		}
+		table := 0
+		if i > 0 {
+			table = 1
+		}
+		f.components = append(f.components, &jpegComponent{id: c[0], h: h, v: v, quant: quant, table: table})
+	}
+	f.layout()
+	return nil
+}
+
+// readScan decodes the entropy-coded segment after a scan header at pos,
+// returning the position of the next marker
+func (f *jpegFrame) readScan(data []byte, pos int, p []byte, tables *[2][4]*jpegHuffmanDecoder, restart int) (int, error) {
+	if len(p) < 1 || len(p) < 4+2*int(p[0]) {
+		return 0, fmt.Errorf("corrupt JPEG: invalid scan header")
+	}
+	count := int(p[0])
+	components := make([]*jpegComponent, count)
+	dc := make([]*jpegHuffmanDecoder, count)
+	ac := make([]*jpegHuffmanDecoder, count)
+	for i := range count {
+		id, selectors := p[1+2*i], p[2+2*i]
+		for _, c := range f.components {
+			if c.id == id {
+				components[i] = c
+			}
+		}
+		if components[i] == nil || selectors>>4 > 3 || selectors&15 > 3 {
+			return 0, fmt.Errorf("corrupt JPEG: invalid scan component %d", id)
+		}
+		dc[i] = tables[0][selectors>>4]
+		ac[i] = tables[1][selectors&15]
+	}
+	ss, se := int(p[1+2*count]), int(p[2+2*count])
+	ah, al := uint(p[3+2*count]>>4), uint(p[3+2*count]&15)
+	if ss > se || se > 63 || al > 13 {
+		return 0, fmt.Errorf("corrupt JPEG: invalid spectral selection")
+	}
+
+	r := &jpegBitReader{data: data, pos: pos}
+	predictors := make([]int32, count)
+	eobrun, mcus := 0, 0
+	var err error
+	decode := func(h *jpegHuffmanDecoder) byte {
+		if h == nil {
+			err = fmt.Errorf("corrupt JPEG: missing Huffman table")
+			return 0
+		}
+		symbol, ok := h.decode(r)
+		if !ok {
+			err = fmt.Errorf("corrupt JPEG: invalid Huffman code")
+		}
+		return symbol
+	}
+
+	f.eachMCUBlock(components, func(c *jpegComponent, block int) {
+		if err != nil {
+			return
+		}
+		b := &c.blocks[block]
+		i := slices.Index(components, c)
+		if ss == 0 {
+			if ah == 0 {
+				size := decode(dc[i])
+				predictors[i] += r.receive(uint(size))
+				b[0] = predictors[i] << al
+			} else if r.read(1) == 1 {
+				b[0] |= 1 << al
+			}
+		}
+		if se == 0 {
+			return
+		}
+		if ah == 0 {
+			eobrun = r.decodeAC(b, max(ss, 1), se, al, eobrun, func() byte { return decode(ac[i]) })
+		} else {
+			eobrun = r.refineAC(b, ss, se, al, eobrun, func() byte { return decode(ac[i]) })
+		}
+		if eobrun < 0 {
+			err = fmt.Errorf("corrupt JPEG: coefficient out of range")
+		}
+	}, func() {
+		mcus++
+		if restart > 0 && mcus%restart == 0 {
+			r.restart()
+			clear(predictors)
+			eobrun = 0
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return r.nextMarker(), nil
+}
+
+// jpegLookupBits is the length of the codes jpegHuffmanDecoder looks up at
+// once; longer codes, which are rare, are decoded bit by bit
+const jpegLookupBits = 9
+
+// jpegHuffmanDecoder decodes canonical Huffman codes by their length
+type jpegHuffmanDecoder struct {
+	symbols []byte
+	maxcode [17]int32                   // Largest code of each length, or -1
+	offset  [17]int32                   // Index of the symbol of a code minus the code
+	lookup  [1 << jpegLookupBits]uint16 // Length<<8 | symbol of the short codes starting with each bit pattern, or 0
+}
+
+func newJPEGHuffmanDecoder(h *jpegHuffman) *jpegHuffmanDecoder {
+	d := &jpegHuffmanDecoder{symbols: h.symbols}
+	code, k := int32(0), int32(0)
+	for length := 1; length <= 16; length++ {
+		n := int32(h.counts[length-1])
+		d.offset[length] = k - code
+		d.maxcode[length] = -1
+		if n > 0 {
+			d.maxcode[length] = code + n - 1
+		}
+		if length <= jpegLookupBits {
+			for i := int32(0); i < n && int(k+i) < len(h.symbols); i++ {
+				shift := jpegLookupBits - length
+				first := int(code+i) << shift
+				for j := range 1 << shift {
+					d.lookup[first+j] = uint16(length)<<8 | uint16(h.symbols[k+i])
+				}
+			}
+		}
+		code = (code + n) << 1
+		k += n
+	}
+	return d
+}
+
+func (d *jpegHuffmanDecoder) decode(r *jpegBitReader) (byte, bool) {
+	if r.n < jpegLookupBits {
+		r.fill()
+	}
+	if entry := d.lookup[r.bits>>(32-jpegLookupBits)]; entry != 0 {
+		r.bits <<= entry >> 8
+		r.n -= uint(entry >> 8)
+		return byte(entry), true
+	}
+	code := int32(0)
+	for length := 1; length <= 16; length++ {
+		code = code<<1 | int32(r.read(1))
+		if code <= d.maxcode[length] {
+			i := code + d.offset[length]
+			if i < 0 || int(i) >= len(d.symbols) {
+				return 0, false
+			}
+			return d.symbols[i], true
+		}
+	}
+	return 0, false
+}
+
+// jpegBitReader reads the bits of an entropy-coded segment, removing the
+// zero bytes stuffed after 0xFF. At a marker, it reads zeros.
+type jpegBitReader struct {
+	data   []byte
+	pos    int
+	bits   uint32 // Buffered bits, most significant first
+	n      uint
+	marker bool
+}
+
+func (r *jpegBitReader) fill() {
+	for r.n <= 24 {
+		var c byte
+		if !r.marker && r.pos < len(r.data) {
+			c = r.data[r.pos]
+			if c == 0xFF && r.pos+1 < len(r.data) && r.data[r.pos+1] == 0 {
+				r.pos += 2
+			} else if c == 0xFF {
+				r.marker, c = true, 0
+			} else {
+				r.pos++
+			}
+		}
+		r.bits |= uint32(c) << (24 - r.n)
+		r.n += 8
+	}
+}
+
+func (r *jpegBitReader) read(n uint) int32 {
+	if n == 0 {
+		return 0
+	}
+	if r.n < n {
+		r.fill()
+	}
+	v := r.bits >> (32 - n)
+	r.bits <<= n
+	r.n -= n
+	return int32(v)
+}
+
+// receive reads a value of a size category, extending its sign
+func (r *jpegBitReader) receive(size uint) int32 {
+	v := r.read(size)
+	if size > 0 && v < 1<<(size-1) {
+		v -= 1<<size - 1
+	}
+	return v
+}
+
+// decodeAC reads the coefficients start to end of a block in a sequential
+// or first progressive scan, returning the remaining blocks of an end of
+// band run, or -1 if the data is corrupt
+func (r *jpegBitReader) decodeAC(b *[64]int32, start, end int, al uint, eobrun int, decode func() byte) int {
+	if eobrun > 0 {
+		return eobrun - 1
+	}
+	for k := start; k <= end; k++ {
+		rs := decode()
+		run, size := int(rs>>4), uint(rs&15)
+		if size == 0 {
+			if run < 15 {
+				return 1<<run - 1 + int(r.read(uint(run)))
+			}
+			k += 15
+			continue
+		}
+		k += run
+		if k > 63 {
+			return -1
+		}
+		b[k] = r.receive(size) << al
+	}
+	return 0
+}
+
+// refineAC reads the next bit of the coefficients start to end of a block
+// in a successive approximation scan, like libjpeg's decode_mcu_AC_refine
+func (r *jpegBitReader) refineAC(b *[64]int32, start, end int, al uint, eobrun int, decode func() byte) int {
+	p1, m1 := int32(1)<<al, int32(-1)<<al
+	refine := func(c *int32) {
+		if r.read(1) == 1 && *c&p1 == 0 {
+			if *c >= 0 {
+				*c += p1
+			} else {
+				*c += m1
+			}
+		}
+	}
+
+	k := start
+	if eobrun == 0 {
+		for ; k <= end; k++ {
+			rs := decode()
+			run, size := int(rs>>4), rs&15
+			var value int32
+			if size != 0 {
+				value = m1
+				if r.read(1) == 1 {
+					value = p1
+				}
+			} else if run != 15 {
+				eobrun = 1 << run
+				if run > 0 {
+					eobrun += int(r.read(uint(run)))
+				}
+				break
+			}
+			// Skip run zero coefficients, refining the non-zero ones
+			for ; k <= end; k++ {
+				if b[k] != 0 {
+					refine(&b[k])
+				} else if run == 0 {
+					break
+				} else {
+					run--
+				}
+			}
+			if value != 0 && k <= end {
+				b[k] = value
+			}
+		}
+	}
+	if eobrun > 0 {
+		for ; k <= end; k++ {
+			if b[k] != 0 {
+				refine(&b[k])
+			}
+		}
+		eobrun--
+	}
+	return eobrun
+}
+
+// restart skips to the end of a restart interval, dropping the padding
+// bits and the RSTn marker
+func (r *jpegBitReader) restart() {
+	r.bits, r.n, r.marker = 0, 0, false
+	r.pos = r.nextMarker()
+	if r.pos+1 < len(r.data) && r.data[r.pos+1] >= 0xD0 && r.data[r.pos+1] <= 0xD7 {
+		r.pos += 2
+	}
+}
+
+// nextMarker returns the position of the next marker
+func (r *jpegBitReader) nextMarker() int {
+	for i := r.pos; i+1 < len(r.data); i++ {
+		if r.data[i] == 0xFF && r.data[i+1] != 0 && r.data[i+1] != 0xFF {
+			return i
+		}
+	}
+	return len(r.data)
+}
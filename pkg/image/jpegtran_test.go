@@ -0,0 +1,239 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"nim/pkg/compare"
+)
+
+// encodeJPEG returns img as a baseline or progressive JPEG
+func encodeJPEG(t *testing.T, img image.Image, progressive bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	if progressive {
+		err = EncodeProgressiveJPEG(&buf, img, 90)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	}
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// transformJPEG applies a lossless transform and decodes the result
+func transformJPEG(t *testing.T, data []byte, transform JPEGTransform) ([]byte, image.Image) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := TransformJPEG(bytes.NewReader(data), &buf, transform); err != nil {
+		t.Fatalf("transform failed: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	return buf.Bytes(), img
+}
+
+func samePixels(a, b image.Image) bool {
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return false
+	}
+	ba, bb := a.Bounds(), b.Bounds()
+	for y := 0; y < ba.Dy(); y++ {
+		for x := 0; x < ba.Dx(); x++ {
+			if a.At(ba.Min.X+x, ba.Min.Y+y) != b.At(bb.Min.X+x, bb.Min.Y+y) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestTransformJPEGIdentity(t *testing.T) {
+	for _, progressive := range []bool{false, true} {
+		for _, size := range [][2]int{{64, 48}, {37, 21}} {
+			data := encodeJPEG(t, gradient(size[0], size[1]), progressive)
+			original, _ := jpeg.Decode(bytes.NewReader(data))
+
+			// The coefficients are copied as they are
+			_, img := transformJPEG(t, data, JPEGTransform{})
+			if !samePixels(original, img) {
+				t.Errorf("progressive %v, %v: pixels changed", progressive, size)
+			}
+			_, img = transformJPEG(t, data, JPEGTransform{Progressive: !progressive})
+			if !samePixels(original, img) {
+				t.Errorf("progressive %v, %v: pixels changed when converting", progressive, size)
+			}
+		}
+	}
+}
+
+func TestTransformJPEGRoundTrip(t *testing.T) {
+	data := encodeJPEG(t, gradient(64, 48), false)
+	original, _ := jpeg.Decode(bytes.NewReader(data))
+
+	for _, steps := range [][]JPEGTransform{
+		{{Rotate: 90}, {Rotate: 270}},
+		{{Rotate: 180}, {Rotate: 180}},
+		{{FlipH: true}, {FlipH: true}},
+		{{Rotate: 90, FlipV: true}, {Rotate: 90, FlipV: true}},
+	} {
+		current := data
+		var img image.Image
+		for _, step := range steps {
+			current, img = transformJPEG(t, current, step)
+		}
+		if !samePixels(original, img) {
+			t.Errorf("%+v: pixels changed", steps)
+		}
+	}
+}
+
+func TestTransformJPEGRotate(t *testing.T) {
+	for _, gray := range []bool{false, true} {
+		var src image.Image = gradient(64, 48)
+		if gray {
+			src = imaging.Grayscale(src)
+			gray := image.NewGray(src.Bounds())
+			for y := 0; y < 48; y++ {
+				for x := 0; x < 64; x++ {
+					gray.Set(x, y, src.At(x, y))
+				}
+			}
+			src = gray
+		}
+		data := encodeJPEG(t, src, false)
+		original, _ := jpeg.Decode(bytes.NewReader(data))
+
+		for _, tc := range []struct {
+			transform JPEGTransform
+			expected  image.Image
+		}{
+			{JPEGTransform{Rotate: 90}, imaging.Rotate270(original)},
+			{JPEGTransform{Rotate: 180}, imaging.Rotate180(original)},
+			{JPEGTransform{Rotate: 270}, imaging.Rotate90(original)},
+			{JPEGTransform{FlipH: true}, imaging.FlipH(original)},
+			{JPEGTransform{FlipV: true}, imaging.FlipV(original)},
+		} {
+			_, img := transformJPEG(t, data, tc.transform)
+			if img.Bounds().Size() != tc.expected.Bounds().Size() {
+				t.Fatalf("gray %v, %+v: size %v, expected %v", gray, tc.transform, img.Bounds().Size(), tc.expected.Bounds().Size())
+			}
+			// Only the rounding of the decoder differs
+			result, _ := compare.Compare(tc.expected, img)
+			if result.PSNR < 40 {
+				t.Errorf("gray %v, %+v: PSNR %.1f dB", gray, tc.transform, result.PSNR)
+			}
+		}
+	}
+}
+
+func TestTransformJPEGTrim(t *testing.T) {
+	data := encodeJPEG(t, gradient(37, 21), false)
+
+	// Flipping drops the partial 16x16 MCUs at the right and bottom
+	_, img := transformJPEG(t, data, JPEGTransform{Rotate: 180})
+	if size := img.Bounds().Size(); size != image.Pt(32, 16) {
+		t.Errorf("rotated 180° to %v, expected 32x16", size)
+	}
+	_, img = transformJPEG(t, data, JPEGTransform{Rotate: 90})
+	if size := img.Bounds().Size(); size != image.Pt(16, 37) {
+		t.Errorf("rotated 90° to %v, expected 16x37", size)
+	}
+
+	var buf bytes.Buffer
+	small := encodeJPEG(t, gradient(10, 10), false)
+	if err := TransformJPEG(bytes.NewReader(small), &buf, JPEGTransform{FlipH: true}); err == nil {
+		t.Error("expected an error flipping an image smaller than an MCU")
+	}
+}
+
+func TestTransformJPEGCrop(t *testing.T) {
+	data := encodeJPEG(t, gradient(64, 48), false)
+	original, _ := jpeg.Decode(bytes.NewReader(data))
+
+	_, img := transformJPEG(t, data, JPEGTransform{Crop: image.Rect(16, 16, 56, 40)})
+	if size := img.Bounds().Size(); size != image.Pt(40, 24) {
+		t.Fatalf("cropped to %v, expected 40x24", size)
+	}
+	result, _ := compare.Compare(imaging.Crop(original, image.Rect(16, 16, 56, 40)), img)
+	if result.PSNR < 40 {
+		t.Errorf("PSNR %.1f dB", result.PSNR)
+	}
+
+	var buf bytes.Buffer
+	for _, crop := range []image.Rectangle{image.Rect(8, 0, 32, 32), image.Rect(0, 0, 80, 16)} {
+		if err := TransformJPEG(bytes.NewReader(data), &buf, JPEGTransform{Crop: crop}); err == nil {
+			t.Errorf("%v: expected an error", crop)
+		}
+	}
+}
+
+func TestTransformJPEGAutoOrient(t *testing.T) {
+	data := encodeJPEG(t, gradient(64, 48), false)
+	original, _ := jpeg.Decode(bytes.NewReader(data))
+
+	// APP1 EXIF with IFD0 holding only the orientation: rotate 90° clockwise
+	exif := []byte{0xFF, 0xE1, 0, 34, 'E', 'x', 'i', 'f', 0, 0,
+		'M', 'M', 0, 42, 0, 0, 0, 8,
+		0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, 6, 0, 0,
+		0, 0, 0, 0}
+	data = append(append([]byte{0xFF, 0xD8}, exif...), data[2:]...)
+
+	out, img := transformJPEG(t, data, JPEGTransform{AutoOrient: true})
+	result, _ := compare.Compare(imaging.Rotate270(original), img)
+	if result.PSNR < 40 {
+		t.Errorf("PSNR %.1f dB", result.PSNR)
+	}
+	frame, err := readJPEGFrame(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orientation := exifOrientation(frame.segments); orientation != 1 {
+		t.Errorf("orientation %d, expected 1", orientation)
+	}
+
+	// Without AutoOrient the orientation is kept
+	out, _ = transformJPEG(t, data, JPEGTransform{})
+	frame, _ = readJPEGFrame(out)
+	if orientation := exifOrientation(frame.segments); orientation != 6 {
+		t.Errorf("orientation %d, expected 6", orientation)
+	}
+}
+
+func TestOptimizeJPEG(t *testing.T) {
+	for _, progressive := range []bool{false, true} {
+		data := encodeJPEG(t, gradient(64, 48), progressive)
+		comment := []byte{0xFF, 0xFE, 0, 7, 'h', 'e', 'l', 'l', 'o'}
+		data = append(append([]byte{0xFF, 0xD8}, comment...), data[2:]...)
+
+		optimized, err := OptimizeJPEG(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(optimized) >= len(data) {
+			t.Errorf("progressive %v: optimized to %d bytes from %d", progressive, len(optimized), len(data))
+		}
+		if bytes.Contains(optimized, []byte("hello")) {
+			t.Errorf("progressive %v: comment kept", progressive)
+		}
+		a, _ := jpeg.Decode(bytes.NewReader(data))
+		b, err := jpeg.Decode(bytes.NewReader(optimized))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !samePixels(a, b) {
+			t.Errorf("progressive %v: pixels changed", progressive)
+		}
+	}
+
+	if _, err := OptimizeJPEG([]byte("not a JPEG")); err == nil {
+		t.Error("expected an error")
+	}
+}
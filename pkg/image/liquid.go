@@ -0,0 +1,178 @@
+package image
+
+import (
+	"image"
+
+	"github.com/disintegration/imaging"
+	"nim/pkg/resample"
+)
+
+// Liquid resizes img to width x height by seam carving. It is scaled to cover
+// the target like ResizeModeFill, then instead of cropping the longer side,
+// the connected seams of pixels with the least detail are removed from it one
+// at a time, so subjects near the edges are kept and the background between
+// them shrinks. This works best for moderate changes of aspect ratio: once
+// the flat areas are used up, seams run through the subjects and distort
+// them.
+func Liquid(img image.Image, width, height int) *image.NRGBA {
+	srcW, srcH := img.Bounds().Dx(), img.Bounds().Dy()
+	if width <= 0 || height <= 0 || srcW <= 0 || srcH <= 0 {
+		return &image.NRGBA{}
+	}
+	var scaled *image.NRGBA
+	if float64(srcW)/float64(srcH) < float64(width)/float64(height) {
+		scaled = resample.Resize(img, width, 0)
+	} else {
+		scaled = resample.Resize(img, 0, height)
+	}
+	// Rounding can leave the other side a pixel short
+	if scaled.Rect.Dx() < width || scaled.Rect.Dy() < height {
+		scaled = resample.Resize(scaled, max(width, scaled.Rect.Dx()), max(height, scaled.Rect.Dy()))
+	}
+
+	if scaled.Rect.Dx() > width {
+		scaled = carveColumns(scaled, scaled.Rect.Dx()-width)
+	}
+	if scaled.Rect.Dy() > height {
+		scaled = imaging.Transpose(carveColumns(imaging.Transpose(scaled), scaled.Rect.Dy()-height))
+	}
+	return scaled
+}
+
+// carver removes vertical seams from an image. Pixels, their luma and their
+// energy are kept in rows of the current width, which shrinks by one with
+// every seam.
+type carver struct {
+	width, height int
+	pix           []uint8
+	luma          []int32
+	energy        []int32
+	cost          []int32
+	seam          []int
+}
+
+// carveColumns returns img with n vertical seams removed
+func carveColumns(img *image.NRGBA, n int) *image.NRGBA {
+	c := newCarver(img)
+	for range n {
+		c.findSeam()
+		c.removeSeam()
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, c.width, c.height))
+	copy(out.Pix, c.pix[:c.width*c.height*4])
+	return out
+}
+
+// newCarver copies img into a carver and computes its energy
+func newCarver(img *image.NRGBA) *carver {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	c := &carver{
+		width:  width,
+		height: height,
+		pix:    make([]uint8, width*height*4),
+		luma:   make([]int32, width*height),
+		energy: make([]int32, width*height),
+		cost:   make([]int32, width*height),
+		seam:   make([]int, height),
+	}
+	for y := range height {
+		copy(c.pix[y*width*4:(y+1)*width*4], img.Pix[y*img.Stride:y*img.Stride+width*4])
+	}
+	for i := range c.luma {
+		p := c.pix[i*4 : i*4+4 : i*4+4]
+		// Transparent pixels count as dark, so their edges are kept
+		c.luma[i] = (299*int32(p[0]) + 587*int32(p[1]) + 114*int32(p[2])) * int32(p[3]) / 255000
+	}
+	for y := range height {
+		for x := range width {
+			c.updateEnergy(x, y)
+		}
+	}
+	return c
+}
+
+// updateEnergy computes the energy of a pixel: the sum of its horizontal and
+// vertical luma gradients
+func (c *carver) updateEnergy(x, y int) {
+	at := func(x, y int) int32 {
+		x = min(max(x, 0), c.width-1)
+		y = min(max(y, 0), c.height-1)
+		return c.luma[y*c.width+x]
+	}
+	c.energy[y*c.width+x] = abs32(at(x+1, y)-at(x-1, y)) + abs32(at(x, y+1)-at(x, y-1))
+}
+
+// findSeam finds the connected top-to-bottom path of the least total energy
+// by dynamic programming
+func (c *carver) findSeam() {
+	w := c.width
+	copy(c.cost[:w], c.energy[:w])
+	for y := 1; y < c.height; y++ {
+		above, row := c.cost[(y-1)*w:y*w], c.cost[y*w:(y+1)*w]
+		for x := range w {
+			best := above[x]
+			if x > 0 && above[x-1] < best {
+				best = above[x-1]
+			}
+			if x < w-1 && above[x+1] < best {
+				best = above[x+1]
+			}
+			row[x] = c.energy[y*w+x] + best
+		}
+	}
+
+	last := c.cost[(c.height-1)*w : c.height*w]
+	x := 0
+	for i, v := range last {
+		if v < last[x] {
+			x = i
+		}
+	}
+	c.seam[c.height-1] = x
+	for y := c.height - 2; y >= 0; y-- {
+		above := c.cost[y*w : (y+1)*w]
+		next := x
+		if x > 0 && above[x-1] < above[next] {
+			next = x - 1
+		}
+		if x < w-1 && above[x+1] < above[next] {
+			next = x + 1
+		}
+		x = next
+		c.seam[y] = x
+	}
+}
+
+// removeSeam removes the pixels of the seam, shifting the rest of each row
+// left and packing the rows to the new width, then updates the energy of the
+// pixels that were next to the seam
+func (c *carver) removeSeam() {
+	w := c.width
+	for y := range c.height {
+		x := c.seam[y]
+		src, dst := y*w, y*(w-1)
+		copy(c.pix[dst*4:], c.pix[src*4:(src+x)*4])
+		copy(c.pix[(dst+x)*4:], c.pix[(src+x+1)*4:(src+w)*4])
+		copy(c.luma[dst:], c.luma[src:src+x])
+		copy(c.luma[dst+x:], c.luma[src+x+1:src+w])
+		copy(c.energy[dst:], c.energy[src:src+x])
+		copy(c.energy[dst+x:], c.energy[src+x+1:src+w])
+	}
+	c.width--
+	// The seam moves by at most one column per row, so the vertical
+	// gradients it changed are within two columns of it
+	for y := range c.height {
+		for x := max(c.seam[y]-2, 0); x < min(c.seam[y]+2, c.width); x++ {
+			c.updateEnergy(x, y)
+		}
+	}
+}
+
+// abs32 returns the absolute value of v
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,64 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// dark counts the pixels of img darker than mid gray
+func dark(img *image.NRGBA) int {
+	n := 0
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i] < 128 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLiquid(t *testing.T) {
+	// Two dark squares near the edges of a flat background, which cropping
+	// would cut off
+	src := imaging.New(200, 100, color.NRGBA{240, 240, 240, 255})
+	for _, x := range []int{5, 165} {
+		for y := 35; y < 65; y++ {
+			for dx := range 30 {
+				src.SetNRGBA(x+dx, y, color.NRGBA{20, 20, 20, 255})
+			}
+		}
+	}
+
+	carved := Liquid(src, 120, 100)
+	if size := carved.Bounds().Size(); size != image.Pt(120, 100) {
+		t.Fatalf("expected 120x100, got %v", size)
+	}
+	if got, want := dark(carved), dark(src); got < want*95/100 {
+		t.Errorf("expected the squares to be kept, got %d of %d dark pixels", got, want)
+	}
+	if got := dark(imaging.Fill(src, 120, 100, imaging.Center, imaging.Lanczos)); got > dark(src)/2 {
+		t.Errorf("expected fill to crop the squares, got %d dark pixels", got)
+	}
+
+	tall := Liquid(imaging.Rotate90(src), 100, 120)
+	if size := tall.Bounds().Size(); size != image.Pt(100, 120) {
+		t.Fatalf("expected 100x120, got %v", size)
+	}
+	if got, want := dark(tall), dark(src); got < want*95/100 {
+		t.Errorf("expected the squares to be kept when carving rows, got %d of %d dark pixels", got, want)
+	}
+}
+
+func TestLiquidResizeMode(t *testing.T) {
+	options := DefaultOptions()
+	options.Width, options.Height, options.ResizeMode = 40, 40, ResizeModeLiquid
+	resized, err := Resize(gradient(90, 60), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := resized.Bounds().Size(); size != image.Pt(40, 40) {
+		t.Errorf("expected 40x40, got %v", size)
+	}
+}
@@ -0,0 +1,327 @@
+package image
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	RegisterCodec(Codec{
+		Name:       "Netpbm",
+		Extensions: []string{"pbm", "pgm", "ppm", "pnm"},
+		Decode: func(r io.Reader, options ProcessOptions) (image.Image, error) {
+			return DecodeNetpbm(r)
+		},
+		Encode: func(w io.Writer, img image.Image, options ProcessOptions) error {
+			return EncodeNetpbm(w, img, netpbmFormat(options.OutputFormat), options.NetpbmPlain)
+		},
+	})
+}
+
+// netpbmFormat maps an output extension to a Netpbm magic number. PNM picks
+// PPM, since it can represent any image.
+func netpbmFormat(ext string) byte {
+	switch strings.ToLower(ext) {
+	case "pbm":
+		return '4'
+	case "pgm":
+		return '5'
+	}
+	return '6'
+}
+
+// DecodeNetpbm decodes a PBM, PGM or PPM image in plain (ASCII) or raw
+// (binary) form, including 16-bit samples
+func DecodeNetpbm(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+
+	var magic [2]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil || magic[0] != 'P' || magic[1] < '1' || magic[1] > '6' {
+		return nil, fmt.Errorf("not a Netpbm file")
+	}
+	kind := magic[1]
+	plain := kind <= '3'
+	if !plain {
+		kind -= 3
+	}
+
+	width, err := readNetpbmInt(br)
+	if err != nil {
+		return nil, err
+	}
+	height, err := readNetpbmInt(br)
+	if err != nil {
+		return nil, err
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid Netpbm dimensions: %dx%d", width, height)
+	}
+	maxval := 1
+	if kind != '1' {
+		if maxval, err = readNetpbmInt(br); err != nil {
+			return nil, err
+		}
+		if maxval <= 0 || maxval > 65535 {
+			return nil, fmt.Errorf("invalid Netpbm maximum value: %d", maxval)
+		}
+	}
+	if !plain {
+		// Exactly one whitespace character separates the header from raw data
+		if _, err := br.ReadByte(); err != nil {
+			return nil, fmt.Errorf("failed to read Netpbm header: %w", err)
+		}
+	}
+
+	channels := 1
+	if kind == '3' {
+		channels = 3
+	}
+	samples := make([]int, width*height*channels)
+
+	switch {
+	case kind == '1' && plain:
+		// Plain PBM digits may be written without separators
+		for i := range samples {
+			b, err := skipNetpbmSpace(br)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read Netpbm data: %w", err)
+			}
+			if b != '0' && b != '1' {
+				return nil, fmt.Errorf("invalid PBM sample: %q", b)
+			}
+			samples[i] = int(b - '0')
+		}
+	case plain:
+		for i := range samples {
+			if samples[i], err = readNetpbmInt(br); err != nil {
+				return nil, err
+			}
+		}
+	case kind == '1':
+		row := make([]byte, (width+7)/8)
+		for y := 0; y < height; y++ {
+			if _, err := io.ReadFull(br, row); err != nil {
+				return nil, fmt.Errorf("failed to read Netpbm data: %w", err)
+			}
+			for x := 0; x < width; x++ {
+				samples[y*width+x] = int(row[x/8]>>(7-x%8)) & 1
+			}
+		}
+	default:
+		size := 1
+		if maxval > 255 {
+			size = 2
+		}
+		raw := make([]byte, len(samples)*size)
+		if _, err := io.ReadFull(br, raw); err != nil {
+			return nil, fmt.Errorf("failed to read Netpbm data: %w", err)
+		}
+		for i := range samples {
+			if size == 2 {
+				samples[i] = int(raw[i*2])<<8 | int(raw[i*2+1])
+			} else {
+				samples[i] = int(raw[i])
+			}
+		}
+	}
+
+	for _, v := range samples {
+		if v > maxval {
+			return nil, fmt.Errorf("Netpbm sample %d exceeds maximum value %d", v, maxval)
+		}
+	}
+
+	// In PBM files 1 is black
+	if kind == '1' {
+		img := image.NewGray(image.Rect(0, 0, width, height))
+		for i, v := range samples {
+			img.Pix[i] = uint8(255 * (1 - v))
+		}
+		return img, nil
+	}
+
+	scale := func(v int) uint16 { return uint16(v * 65535 / maxval) }
+	if maxval > 255 {
+		if kind == '2' {
+			img := image.NewGray16(image.Rect(0, 0, width, height))
+			for i, v := range samples {
+				img.SetGray16(i%width, i/width, color.Gray16{Y: scale(v)})
+			}
+			return img, nil
+		}
+		img := image.NewNRGBA64(image.Rect(0, 0, width, height))
+		for i := 0; i < width*height; i++ {
+			img.SetNRGBA64(i%width, i/width, color.NRGBA64{
+				R: scale(samples[i*3]), G: scale(samples[i*3+1]), B: scale(samples[i*3+2]), A: 0xffff,
+			})
+		}
+		return img, nil
+	}
+
+	if kind == '2' {
+		img := image.NewGray(image.Rect(0, 0, width, height))
+		for i, v := range samples {
+			img.Pix[i] = uint8(scale(v) >> 8)
+		}
+		return img, nil
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < width*height; i++ {
+		img.Pix[i*4+0] = uint8(scale(samples[i*3]) >> 8)
+		img.Pix[i*4+1] = uint8(scale(samples[i*3+1]) >> 8)
+		img.Pix[i*4+2] = uint8(scale(samples[i*3+2]) >> 8)
+		img.Pix[i*4+3] = 255
+	}
+	return img, nil
+}
+
+// skipNetpbmSpace returns the next byte that is not whitespace or part of a comment
+func skipNetpbmSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\n', '\r', '\v', '\f':
+		case '#':
+			if _, err := br.ReadString('\n'); err != nil {
+				return 0, err
+			}
+		default:
+			return b, nil
+		}
+	}
+}
+
+// readNetpbmInt reads a decimal number, skipping leading whitespace and comments
+func readNetpbmInt(br *bufio.Reader) (int, error) {
+	b, err := skipNetpbmSpace(br)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read Netpbm number: %w", err)
+	}
+	digits := []byte{b}
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read Netpbm number: %w", err)
+		}
+		if b < '0' || b > '9' {
+			br.UnreadByte()
+			break
+		}
+		digits = append(digits, b)
+	}
+	n, err := strconv.Atoi(string(digits))
+	if err != nil {
+		return 0, fmt.Errorf("invalid Netpbm number: %q", digits)
+	}
+	return n, nil
+}
+
+// EncodeNetpbm writes img as PBM ('4'), PGM ('5') or PPM ('6'), in plain
+// (ASCII) form when plain is set. 16-bit images keep 16-bit samples in PGM
+// and PPM output; PBM output thresholds at 50% gray.
+func EncodeNetpbm(w io.Writer, img image.Image, format byte, plain bool) error {
+	if format < '4' || format > '6' {
+		return fmt.Errorf("invalid Netpbm format: P%c", format)
+	}
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+
+	deep := false
+	switch img.(type) {
+	case *image.Gray16, *image.NRGBA64, *image.RGBA64:
+		deep = format != '4'
+	}
+	maxval := 255
+	if deep {
+		maxval = 65535
+	}
+
+	bw := bufio.NewWriter(w)
+	magic := format
+	if plain {
+		magic -= 3
+	}
+	fmt.Fprintf(bw, "P%c\n%d %d\n", magic, width, height)
+	if format != '4' {
+		fmt.Fprintf(bw, "%d\n", maxval)
+	}
+
+	// Flatten transparency against white so the output matches what viewers show
+	src := image.NewNRGBA64(image.Rect(0, 0, width, height))
+	draw.Draw(src, src.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Over)
+
+	column := 0
+	writeSample := func(v int) {
+		if plain {
+			s := strconv.Itoa(v)
+			// Keep plain lines under the 70 character limit
+			if column+len(s)+1 > 70 {
+				bw.WriteByte('\n')
+				column = 0
+			} else if column > 0 {
+				bw.WriteByte(' ')
+				column++
+			}
+			bw.WriteString(s)
+			column += len(s)
+		} else if deep {
+			bw.WriteByte(byte(v >> 8))
+			bw.WriteByte(byte(v))
+		} else {
+			bw.WriteByte(byte(v))
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		var bits, nbits byte
+		for x := 0; x < width; x++ {
+			c := src.NRGBA64At(x, y)
+			switch format {
+			case '4':
+				gray := color.Gray16Model.Convert(c).(color.Gray16).Y
+				black := byte(0)
+				if gray < 0x8000 {
+					black = 1
+				}
+				if plain {
+					writeSample(int(black))
+					continue
+				}
+				bits = bits<<1 | black
+				nbits++
+				if nbits == 8 {
+					bw.WriteByte(bits)
+					bits, nbits = 0, 0
+				}
+			case '5':
+				gray := int(color.Gray16Model.Convert(c).(color.Gray16).Y)
+				writeSample(gray * maxval / 65535)
+			default:
+				writeSample(int(c.R) * maxval / 65535)
+				writeSample(int(c.G) * maxval / 65535)
+				writeSample(int(c.B) * maxval / 65535)
+			}
+		}
+		if nbits > 0 {
+			bw.WriteByte(bits << (8 - nbits))
+		}
+	}
+	if plain {
+		bw.WriteByte('\n')
+	}
+
+	return bw.Flush()
+}
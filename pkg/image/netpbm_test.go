@@ -0,0 +1,93 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestNetpbmRoundTrip(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 11, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 11; x++ {
+			v := uint8(0)
+			if (x+y)%2 == 0 {
+				v = 255
+			}
+			img.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+		}
+	}
+
+	for _, format := range []byte{'4', '5', '6'} {
+		for _, plain := range []bool{false, true} {
+			var buf bytes.Buffer
+			if err := EncodeNetpbm(&buf, img, format, plain); err != nil {
+				t.Fatalf("EncodeNetpbm(P%c, plain=%v) failed: %v", format, plain, err)
+			}
+			decoded, err := DecodeNetpbm(&buf)
+			if err != nil {
+				t.Fatalf("DecodeNetpbm(P%c, plain=%v) failed: %v", format, plain, err)
+			}
+			for y := 0; y < 3; y++ {
+				for x := 0; x < 11; x++ {
+					want, _, _, _ := img.At(x, y).RGBA()
+					got, _, _, _ := decoded.At(x, y).RGBA()
+					if got != want {
+						t.Fatalf("P%c plain=%v pixel (%d,%d): expected %d, got %d", format, plain, x, y, want, got)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestNetpbm16Bit(t *testing.T) {
+	img := image.NewGray16(image.Rect(0, 0, 2, 1))
+	img.SetGray16(0, 0, color.Gray16{Y: 0x1234})
+	img.SetGray16(1, 0, color.Gray16{Y: 0xfedc})
+
+	var buf bytes.Buffer
+	if err := EncodeNetpbm(&buf, img, '5', false); err != nil {
+		t.Fatalf("EncodeNetpbm failed: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "P5\n2 1\n65535\n") {
+		t.Fatalf("Expected a 16-bit header, got %q", buf.String()[:14])
+	}
+	decoded, err := DecodeNetpbm(&buf)
+	if err != nil {
+		t.Fatalf("DecodeNetpbm failed: %v", err)
+	}
+	if y, _, _, _ := decoded.At(0, 0).RGBA(); y != 0x1234 {
+		t.Errorf("Expected 0x1234, got %#x", y)
+	}
+}
+
+func TestDecodeNetpbmPlain(t *testing.T) {
+	// Comments, a small maxval and packed PBM digits
+	ppm := "P3\n# comment\n2 1 # size\n15\n15 0 0  0 15 0\n"
+	img, err := DecodeNetpbm(strings.NewReader(ppm))
+	if err != nil {
+		t.Fatalf("DecodeNetpbm failed: %v", err)
+	}
+	if got := img.At(1, 0); got != (color.NRGBA{0, 255, 0, 255}) {
+		t.Errorf("Expected green, got %v", got)
+	}
+
+	pbm, err := DecodeNetpbm(strings.NewReader("P1\n3 1\n101"))
+	if err != nil {
+		t.Fatalf("DecodeNetpbm failed: %v", err)
+	}
+	if got := pbm.At(1, 0); got != (color.Gray{255}) {
+		t.Errorf("Expected white, got %v", got)
+	}
+}
+
+func TestDecodeNetpbmInvalid(t *testing.T) {
+	for _, data := range []string{"P7\n1 1\n255\n", "P2\n1 1\n10\n11\n", "P6\n2 2\n255\nabc"} {
+		if _, err := DecodeNetpbm(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected an error for %q", data)
+		}
+	}
+}
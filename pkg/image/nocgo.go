@@ -0,0 +1,6 @@
+//go:build !cgo
+
+package image
+
+// cgoEnabled reports whether nim was built with cgo
+const cgoEnabled = false
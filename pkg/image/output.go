@@ -0,0 +1,210 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OverwritePolicy defines what happens when an output file already exists
+type OverwritePolicy string
+
+const (
+	// OverwriteFail refuses to replace an existing output file
+	OverwriteFail OverwritePolicy = "fail"
+	// OverwriteAlways replaces existing output files
+	OverwriteAlways OverwritePolicy = "overwrite"
+	// OverwriteSkip leaves existing output files alone and skips the output
+	OverwriteSkip OverwritePolicy = "skip"
+	// OverwriteRename writes to the first free name with a -1, -2, ... suffix
+	OverwriteRename OverwritePolicy = "rename"
+)
+
+// ErrOutputExists is returned by ResolveOutput when the output file exists
+// and the policy does not allow replacing it
+var ErrOutputExists = errors.New("output file already exists")
+
+// ErrOutputSkipped is returned by ResolveOutput when the output file exists
+// and the policy is OverwriteSkip
+var ErrOutputSkipped = errors.New("output file already exists, skipped")
+
+// ResolveOutput applies an overwrite policy to an output path and returns
+// the path to write to. An empty policy behaves like OverwriteFail.
+func ResolveOutput(path string, policy OverwritePolicy) (string, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return path, nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to check output file: %w", err)
+	}
+
+	switch policy {
+	case OverwriteAlways:
+		return path, nil
+	case OverwriteSkip:
+		return "", fmt.Errorf("%s: %w", path, ErrOutputSkipped)
+	case OverwriteRename:
+		ext := filepath.Ext(path)
+		base := strings.TrimSuffix(path, ext)
+		for i := 1; ; i++ {
+			candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+			if _, err := os.Stat(candidate); errors.Is(err, os.ErrNotExist) {
+				return candidate, nil
+			} else if err != nil {
+				return "", fmt.Errorf("failed to check output file: %w", err)
+			}
+		}
+	case "", OverwriteFail:
+		return "", fmt.Errorf("%s: %w", path, ErrOutputExists)
+	}
+	return "", fmt.Errorf("unknown overwrite policy: %s", policy)
+}
+
+// SameFile reports whether two paths refer to the same existing file
+func SameFile(a, b string) bool {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(infoA, infoB)
+}
+
+// Fsync is what is flushed to disk before an output file is in place
+type Fsync string
+
+const (
+	// FsyncNone leaves flushing to the operating system
+	FsyncNone Fsync = "none"
+	// FsyncFile flushes the contents of an output before it is renamed into
+	// place, so a crash never leaves an empty or partial file at the path
+	FsyncFile Fsync = "file"
+	// FsyncFull also flushes the folder after the rename, so the new name
+	// survives a power loss
+	FsyncFull Fsync = "full"
+)
+
+// ParseFsync parses an fsync mode
+func ParseFsync(name string) (Fsync, error) {
+	switch f := Fsync(strings.ToLower(strings.TrimSpace(name))); f {
+	case FsyncNone, FsyncFile, FsyncFull:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid fsync mode: %s (expected none, file or full)", name)
+}
+
+// WriteOptions control how output files replace what is at their path
+type WriteOptions struct {
+	Fsync  Fsync  // What is flushed to disk before an output is in place; empty is FsyncNone
+	Backup string // Suffix of a copy kept of a file an output replaces, such as ~; empty keeps none
+
+	// Reproducible refuses encoders whose output is not the same on every
+	// machine: AVIF with the system libavif, and codec plugins
+	Reproducible bool
+}
+
+var writeOptions WriteOptions
+
+// SetWriteOptions sets how every output file is written from now on
+func SetWriteOptions(o WriteOptions) {
+	writeOptions = o
+}
+
+// WriteFile writes an output file with write, such as a PDF or a multi-page
+// TIFF, the way images are written: to a temporary file that replaces path
+// only once write succeeds
+func WriteFile(path string, write func(w io.Writer) error) error {
+	out, err := createOutput(path, ProcessOptions{})
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if err := write(out); err != nil {
+		return err
+	}
+	_, _, err = out.Commit()
+	return err
+}
+
+// createTemp creates the temporary file an output for path is written to,
+// in the same folder so it can be renamed over path. Paths that exist but
+// are not regular files, such as /dev/stdout, cannot be replaced and are
+// opened directly; temp is then false.
+func createTemp(path string) (file *os.File, temp bool, err error) {
+	if info, err := os.Stat(path); err == nil && !info.Mode().IsRegular() {
+		file, err = os.Create(path)
+		return file, false, err
+	}
+	file, err = os.CreateTemp(filepath.Dir(path), ".nim-*"+filepath.Ext(path))
+	return file, true, err
+}
+
+// replace renames the complete temporary file tmp over path. A file already
+// at path keeps its permissions, and a copy of it is kept first with
+// --backup. A symbolic link at path is followed, so the file it points to
+// is replaced rather than the link.
+func replace(tmp, path string) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	mode := fs.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+		if writeOptions.Backup != "" {
+			if err := backup(path, path+writeOptions.Backup); err != nil {
+				return fmt.Errorf("failed to back up %s: %w", path, err)
+			}
+		}
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if writeOptions.Fsync == FsyncFull {
+		dir, err := os.Open(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		defer dir.Close()
+		return dir.Sync()
+	}
+	return nil
+}
+
+// backup keeps a copy of path at to, replacing an older one. The copy is a
+// hard link where the file system allows, since path is about to be
+// replaced by a rename rather than changed.
+func backup(path, to string) error {
+	if err := os.Remove(to); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if os.Link(path, to) == nil {
+		return nil
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,194 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/gen2brain/avif"
+)
+
+func TestResolveOutput(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "out.png")
+	os.WriteFile(existing, nil, 0o644)
+	os.WriteFile(filepath.Join(dir, "out-1.png"), nil, 0o644)
+	missing := filepath.Join(dir, "new.png")
+
+	// Paths that do not exist are used as-is under every policy
+	for _, policy := range []OverwritePolicy{OverwriteFail, OverwriteAlways, OverwriteSkip, OverwriteRename} {
+		if path, err := ResolveOutput(missing, policy); err != nil || path != missing {
+			t.Errorf("%s: expected %s, got %s (%v)", policy, missing, path, err)
+		}
+	}
+
+	if _, err := ResolveOutput(existing, OverwriteFail); !errors.Is(err, ErrOutputExists) {
+		t.Errorf("fail: expected ErrOutputExists, got %v", err)
+	}
+	if _, err := ResolveOutput(existing, ""); !errors.Is(err, ErrOutputExists) {
+		t.Errorf("default: expected ErrOutputExists, got %v", err)
+	}
+	if path, err := ResolveOutput(existing, OverwriteAlways); err != nil || path != existing {
+		t.Errorf("overwrite: expected %s, got %s (%v)", existing, path, err)
+	}
+	if _, err := ResolveOutput(existing, OverwriteSkip); !errors.Is(err, ErrOutputSkipped) {
+		t.Errorf("skip: expected ErrOutputSkipped, got %v", err)
+	}
+	if path, err := ResolveOutput(existing, OverwriteRename); err != nil || path != filepath.Join(dir, "out-2.png") {
+		t.Errorf("rename: expected out-2.png, got %s (%v)", path, err)
+	}
+}
+
+func TestSameFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.png")
+	os.WriteFile(path, nil, 0o644)
+
+	if !SameFile(path, filepath.Join(dir, ".", "a.png")) {
+		t.Errorf("Expected equivalent paths to be the same file")
+	}
+	if SameFile(path, filepath.Join(dir, "b.png")) {
+		t.Errorf("Expected a missing file not to match")
+	}
+}
+
+func TestWriteFileMissingFolder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "out.png")
+	err := WriteFile(path, func(w io.Writer) error { return nil })
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) || pathErr.Path != path || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected an error for %s, got %v", path, err)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.pdf")
+	os.WriteFile(path, []byte("old"), 0o600)
+
+	// A failed write leaves the old file and no temporary file
+	failed := errors.New("failed")
+	err := WriteFile(path, func(w io.Writer) error {
+		w.Write([]byte("partial"))
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Expected the write error, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "old" {
+		t.Errorf("Expected the old contents after a failed write, got %q", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the output in the folder, got %d files", len(entries))
+	}
+
+	SetWriteOptions(WriteOptions{Fsync: FsyncFull, Backup: "~"})
+	defer SetWriteOptions(WriteOptions{})
+	link := filepath.Join(dir, "link.pdf")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+	err = WriteFile(link, func(w io.Writer) error {
+		_, err := w.Write([]byte("new"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("Expected the file behind the link to be replaced, got %q", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the permissions to be kept, got %v", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(path + "~"); string(data) != "old" {
+		t.Errorf("Expected a backup of the old contents, got %q", data)
+	}
+	if info, _ := os.Lstat(link); info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected the link to be kept")
+	}
+}
+
+func TestParseFsync(t *testing.T) {
+	if f, err := ParseFsync("Full"); err != nil || f != FsyncFull {
+		t.Errorf("Expected full, got %q (%v)", f, err)
+	}
+	if _, err := ParseFsync("always"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+// encodeTwice encodes img as format with one CPU and then with all of them
+func encodeTwice(t *testing.T, img image.Image, format string) ([]byte, []byte, error) {
+	t.Helper()
+	var bufs [2]bytes.Buffer
+	for i, procs := range []int{1, runtime.NumCPU() + 1} {
+		prev := runtime.GOMAXPROCS(procs)
+		err := Encode(&bufs[i], img, ProcessOptions{OutputFormat: format, Quality: 80})
+		runtime.GOMAXPROCS(prev)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return bufs[0].Bytes(), bufs[1].Bytes(), nil
+}
+
+func TestReproducibleEncode(t *testing.T) {
+	SetWriteOptions(WriteOptions{Reproducible: true})
+	defer SetWriteOptions(WriteOptions{})
+
+	img := noise(64, 48)
+	for _, format := range []string{"jpg", "png", "gif", "bmp", "tiff", "webp", "ico", "icns"} {
+		a, b, err := encodeTwice(t, img, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if !bytes.Equal(a, b) {
+			t.Errorf("%s: encoding twice gave different bytes", format)
+		}
+	}
+}
+
+func TestReproducibleAVIF(t *testing.T) {
+	SetWriteOptions(WriteOptions{Reproducible: true})
+	defer SetWriteOptions(WriteOptions{})
+
+	a, b, err := encodeTwice(t, noise(64, 48), "avif")
+	if avif.Dynamic() == nil {
+		// The system libavif depends on the number of CPUs, so it is refused
+		if !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("Expected ErrUnsupportedFormat with the system libavif, got %v", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Errorf("Encoding twice gave different bytes")
+	}
+}
+
+func TestReproducibleCodecPlugin(t *testing.T) {
+	RegisterCodec(Codec{
+		Name:       "Test",
+		Extensions: []string{"tst"},
+		Encode: func(w io.Writer, img image.Image, options ProcessOptions) error {
+			return nil
+		},
+	})
+	defer delete(codecs, "tst")
+	SetWriteOptions(WriteOptions{Reproducible: true})
+	defer SetWriteOptions(WriteOptions{})
+
+	err := Encode(io.Discard, noise(4, 4), ProcessOptions{OutputFormat: "tst"})
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Expected ErrUnsupportedFormat for a codec plugin, got %v", err)
+	}
+}
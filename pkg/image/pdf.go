@@ -0,0 +1,144 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"nim/pkg/pdf"
+)
+
+// DefaultDPI is the resolution PDF pages are rendered at when ProcessOptions.DPI is unset
+const DefaultDPI = 150
+
+func init() {
+	RegisterCodec(Codec{
+		Name:       "PDF",
+		Extensions: []string{"pdf"},
+		Decode:     DecodePDF,
+		Encode: func(w io.Writer, img image.Image, options ProcessOptions) error {
+			return EncodePDF(w, []image.Image{img}, options)
+		},
+		Tools: pdfRendererNames(),
+		Note:  "writing needs no external tool",
+	})
+}
+
+// pdfRendererNames returns the names of the PDF renderers in the order they
+// are tried
+func pdfRendererNames() []string {
+	names := make([]string, len(pdfRenderers))
+	for i, renderer := range pdfRenderers {
+		names[i] = renderer.name
+	}
+	return names
+}
+
+// pdfRenderer is an external tool that can rasterize a PDF page to PNG on stdout
+type pdfRenderer struct {
+	name string
+	args func(path string, page int, dpi string) []string
+}
+
+// pdfRenderers are tried in order; the first one found in PATH is used
+var pdfRenderers = []pdfRenderer{
+	{"pdftoppm", func(path string, page int, dpi string) []string {
+		p := strconv.Itoa(page)
+		return []string{"-png", "-r", dpi, "-f", p, "-l", p, "-singlefile", path}
+	}},
+	{"mutool", func(path string, page int, dpi string) []string {
+		return []string{"draw", "-q", "-F", "png", "-r", dpi, "-o", "-", path, strconv.Itoa(page)}
+	}},
+	{"gs", func(path string, page int, dpi string) []string {
+		p := strconv.Itoa(page)
+		return []string{"-q", "-dNOPAUSE", "-dBATCH", "-dSAFER", "-sDEVICE=pngalpha",
+			"-r" + dpi, "-dFirstPage=" + p, "-dLastPage=" + p, "-sOutputFile=-", path}
+	}},
+}
+
+// DecodePDF renders page options.Page (1-based, defaulting to the first page)
+// of a PDF at options.DPI. Rendering is delegated to pdftoppm (poppler),
+// mutool (MuPDF) or gs (Ghostscript), whichever is installed first.
+func DecodePDF(r io.Reader, options ProcessOptions) (image.Image, error) {
+	page := options.Page
+	if page == 0 {
+		page = 1
+	}
+	if page < 1 {
+		return nil, fmt.Errorf("invalid PDF page: %d", page)
+	}
+	dpi := options.DPI
+	if dpi == 0 {
+		dpi = DefaultDPI
+	}
+	if dpi < 0 {
+		return nil, fmt.Errorf("invalid PDF resolution: %g dpi", dpi)
+	}
+
+	var renderer *pdfRenderer
+	for i := range pdfRenderers {
+		if _, err := exec.LookPath(pdfRenderers[i].name); err == nil {
+			renderer = &pdfRenderers[i]
+			break
+		}
+	}
+	if renderer == nil {
+		return nil, fmt.Errorf("no PDF renderer found in PATH: install pdftoppm (poppler), mutool (MuPDF) or gs (Ghostscript)")
+	}
+
+	// The renderers read from a file, so copy the input to a temporary one
+	tmp, err := os.CreateTemp("", "nim-*.pdf")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(renderer.name, renderer.args(tmp.Name(), page, strconv.FormatFloat(dpi, 'f', -1, 64))...)
+	slog.Debug("rendering PDF page", "renderer", renderer.name, "page", page, "dpi", dpi, "args", cmd.Args[1:])
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed to render page %d: %w: %s", renderer.name, page, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if stdout.Len() == 0 {
+		// Some renderers exit successfully when the page does not exist
+		return nil, fmt.Errorf("page %d not found in PDF", page)
+	}
+
+	img, err := png.Decode(&stdout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode rendered page: %w", err)
+	}
+	return img, nil
+}
+
+// EncodePDF writes images as the pages of a PDF using the layout in
+// options.PDF. JPEG quality and, for pages sized to their image, the
+// resolution default to options.Quality and options.DPI.
+func EncodePDF(w io.Writer, images []image.Image, options ProcessOptions) error {
+	layout := options.PDF
+	if layout.Quality == 0 {
+		layout.Quality = options.Quality
+	}
+	if layout.DPI == 0 {
+		layout.DPI = options.DPI
+	}
+	if layout.DPI == 0 {
+		layout.DPI = DefaultDPI
+	}
+	return pdf.Write(w, images, layout)
+}
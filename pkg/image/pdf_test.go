@@ -0,0 +1,71 @@
+package image
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeRenderer installs a pdftoppm stand-in that records its arguments and
+// writes a 3x2 PNG to stdout
+func fakeRenderer(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported on Windows")
+	}
+	dir := t.TempDir()
+
+	page, err := os.Create(filepath.Join(dir, "page.png"))
+	if err != nil {
+		t.Fatalf("Failed to create page: %v", err)
+	}
+	png.Encode(page, image.NewNRGBA(image.Rect(0, 0, 3, 2)))
+	page.Close()
+
+	script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "args") + "\ncat " + page.Name() + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "pdftoppm"), []byte(script), 0o755); err != nil {
+		t.Fatalf("Failed to write renderer: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestDecodePDF(t *testing.T) {
+	dir := fakeRenderer(t)
+
+	options := DefaultOptions()
+	options.Page = 3
+	options.DPI = 300
+	img, err := DecodePDF(strings.NewReader("%PDF-1.7"), options)
+	if err != nil {
+		t.Fatalf("DecodePDF failed: %v", err)
+	}
+	if img.Bounds().Dx() != 3 || img.Bounds().Dy() != 2 {
+		t.Errorf("Expected 3x2, got %v", img.Bounds())
+	}
+
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if !strings.Contains(string(args), "-r 300 -f 3 -l 3") {
+		t.Errorf("Unexpected renderer arguments: %s", args)
+	}
+}
+
+func TestDecodePDFNoRenderer(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	_, err := DecodePDF(strings.NewReader("%PDF-1.7"), DefaultOptions())
+	if err == nil || !strings.Contains(err.Error(), "no PDF renderer") {
+		t.Fatalf("Expected a missing renderer error, got %v", err)
+	}
+}
+
+func TestDecodePDFInvalidPage(t *testing.T) {
+	options := DefaultOptions()
+	options.Page = -1
+	if _, err := DecodePDF(strings.NewReader("%PDF-1.7"), options); err == nil {
+		t.Fatalf("Expected an error for page -1")
+	}
+}
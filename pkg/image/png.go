@@ -0,0 +1,662 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// PNG filter strategies accepted in PNGOptions.Filter
+const (
+	// PNGFilterAdaptive picks the filter with the smallest sum of absolute
+	// differences for each row, like image/png and libpng
+	PNGFilterAdaptive = "adaptive"
+	// PNGFilterNone stores rows unfiltered
+	PNGFilterNone = "none"
+	// PNGFilterSub predicts each byte from the pixel to its left
+	PNGFilterSub = "sub"
+	// PNGFilterUp predicts each byte from the pixel above
+	PNGFilterUp = "up"
+	// PNGFilterAverage predicts each byte from the mean of left and above
+	PNGFilterAverage = "average"
+	// PNGFilterPaeth predicts each byte with the Paeth predictor
+	PNGFilterPaeth = "paeth"
+)
+
+// Compression levels of PNGOptions.Compression besides 1 to 9
+const (
+	// PNGCompressionNone stores the image data without compressing it
+	PNGCompressionNone = -1
+	// PNGCompressionDefault uses zlib level 6
+	PNGCompressionDefault = 0
+	// PNGCompressionFast uses zlib level 1
+	PNGCompressionFast = 1
+	// PNGCompressionBest uses zlib level 9
+	PNGCompressionBest = 9
+)
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+var pngFilters = []string{PNGFilterNone, PNGFilterSub, PNGFilterUp, PNGFilterAverage, PNGFilterPaeth}
+
+// PNGOptions controls how PNG outputs are compressed
+type PNGOptions struct {
+	Compression int    // zlib level from 1 (fast) to 9 (best), or PNGCompressionNone; 0 uses the default
+	Filter      string // Filter strategy: adaptive, none, sub, up, average, or paeth
+	Reduce      bool   // Store as grayscale or palette, with fewer bits, when no color is lost
+	Interlace   bool   // Write Adam7 interlaced rows, for progressive display while loading
+	Optimize    bool   // Keep the smallest of many filter, compression and color type choices; slow
+}
+
+// ParsePNGCompression parses a PNG compression level: default, none, fast,
+// best, or a zlib level from 0 (none) to 9
+func ParsePNGCompression(level string) (int, error) {
+	switch strings.ToLower(level) {
+	case "", "default":
+		return PNGCompressionDefault, nil
+	case "none", "0":
+		return PNGCompressionNone, nil
+	case "fast":
+		return PNGCompressionFast, nil
+	case "best":
+		return PNGCompressionBest, nil
+	}
+	n, err := strconv.Atoi(level)
+	if err != nil || n < 0 || n > 9 {
+		return 0, fmt.Errorf("invalid PNG compression: %s (expected default, none, fast, best, or 0-9)", level)
+	}
+	return n, nil
+}
+
+// PNG color types
+const (
+	pngGray      = 0
+	pngRGB       = 2
+	pngPalette   = 3
+	pngGrayAlpha = 4
+	pngRGBA      = 6
+)
+
+// pngEncoder holds an image in the color type and bit depth it is written in
+type pngEncoder struct {
+	width, height int
+	colorType     byte
+	depth         int
+	nrgba         *image.NRGBA   // Pixels of 8-bit color types
+	nrgba64       *image.NRGBA64 // Pixels of 16-bit color types
+	palette       []color.NRGBA
+	indices       []byte // Palette indices, one byte per pixel
+}
+
+// EncodePNG writes img as a PNG with the compression, filters and color type
+// reduction of options. Without Reduce, the color type follows the image like
+// image/png does: grayscale, palette, RGB when opaque, or RGBA, with 16 bits
+// per sample for 16-bit images. With Optimize, the compression, filter and
+// color type settings are searched instead, and the pixels are unchanged.
+func EncodePNG(w io.Writer, img image.Image, options PNGOptions) error {
+	level, err := pngLevel(options.Compression)
+	if err != nil {
+		return err
+	}
+	filter := strings.ToLower(options.Filter)
+	switch filter {
+	case "":
+		filter = PNGFilterAdaptive
+	case PNGFilterAdaptive, PNGFilterNone, PNGFilterSub, PNGFilterUp, PNGFilterAverage, PNGFilterPaeth:
+	default:
+		return fmt.Errorf("unknown PNG filter: %s (expected adaptive, none, sub, up, average, or paeth)", options.Filter)
+	}
+
+	b := img.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 || int64(b.Dx()) >= 1<<31 || int64(b.Dy()) >= 1<<31 {
+		return fmt.Errorf("invalid PNG size: %dx%d", b.Dx(), b.Dy())
+	}
+	if !options.Optimize {
+		e := newPNGEncoder(img, options.Reduce)
+		// Filters rarely help palette and low bit depth images, as libpng finds
+		if filter == PNGFilterAdaptive && (e.colorType == pngPalette || e.depth < 8) {
+			filter = PNGFilterNone
+		}
+		return e.encode(w, level, filter, options.Interlace)
+	}
+
+	// Try the reduced and the plain color type with every filter at the best
+	// level, and Huffman coding alone, which can win on noisy photos
+	encoders := []*pngEncoder{newPNGEncoder(img, true)}
+	if plain := newPNGEncoder(img, false); plain.colorType != encoders[0].colorType || plain.depth != encoders[0].depth {
+		encoders = append(encoders, plain)
+	}
+	// The smallest result so far is kept, and the other buffer reused
+	var best *bytes.Buffer
+	buf := getBuffer()
+	defer func() {
+		putBuffer(buf)
+		if best != nil {
+			putBuffer(best)
+		}
+	}()
+	try := func(e *pngEncoder, level int, filter string) error {
+		buf.Reset()
+		if err := e.encode(buf, level, filter, options.Interlace); err != nil {
+			return err
+		}
+		if best == nil {
+			best, buf = buf, getBuffer()
+		} else if buf.Len() < best.Len() {
+			best, buf = buf, best
+		}
+		return nil
+	}
+	for _, e := range encoders {
+		for _, filter := range append([]string{PNGFilterAdaptive}, pngFilters...) {
+			if err := try(e, zlib.BestCompression, filter); err != nil {
+				return err
+			}
+		}
+		if err := try(e, zlib.HuffmanOnly, PNGFilterAdaptive); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(best.Bytes())
+	return err
+}
+
+// OptimizePNG losslessly recompresses a PNG file with EncodePNG's Optimize
+// search, dropping ancillary chunks such as text, timestamps and color
+// profiles, and interlacing. It returns data itself if that is no larger.
+func OptimizePNG(data []byte) ([]byte, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode PNG: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := EncodePNG(&buf, img, PNGOptions{Optimize: true}); err != nil {
+		return nil, err
+	}
+	if buf.Len() >= len(data) {
+		return data, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// encode writes the PNG signature, the critical chunks and the image data.
+// No ancillary chunks are written.
+func (e *pngEncoder) encode(w io.Writer, level int, filter string, interlace bool) error {
+	bw := bufio.NewWriter(w)
+	bw.Write(pngSignature)
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:], uint32(e.width))
+	binary.BigEndian.PutUint32(header[4:], uint32(e.height))
+	header[8], header[9] = byte(e.depth), e.colorType
+	if interlace {
+		header[12] = 1
+	}
+	writePNGChunk(bw, "IHDR", header)
+
+	if e.colorType == pngPalette {
+		plte := make([]byte, 0, 3*len(e.palette))
+		trns := make([]byte, 0, len(e.palette))
+		for _, c := range e.palette {
+			plte = append(plte, c.R, c.G, c.B)
+			trns = append(trns, c.A)
+		}
+		writePNGChunk(bw, "PLTE", plte)
+		// Decoders take missing entries at the end as opaque
+		for len(trns) > 0 && trns[len(trns)-1] == 0xFF {
+			trns = trns[:len(trns)-1]
+		}
+		if len(trns) > 0 {
+			writePNGChunk(bw, "tRNS", trns)
+		}
+	}
+
+	if err := e.writeIDAT(bw, level, filter, interlace); err != nil {
+		return err
+	}
+	writePNGChunk(bw, "IEND", nil)
+	return bw.Flush()
+}
+
+// pngLevel maps PNGOptions.Compression to a zlib level
+func pngLevel(compression int) (int, error) {
+	switch {
+	case compression == PNGCompressionNone:
+		return zlib.NoCompression, nil
+	case compression == PNGCompressionDefault:
+		return zlib.DefaultCompression, nil
+	case compression >= 1 && compression <= 9:
+		return compression, nil
+	}
+	return 0, fmt.Errorf("invalid PNG compression level: %d", compression)
+}
+
+// newPNGEncoder picks the color type and bit depth of img
+func newPNGEncoder(img image.Image, reduce bool) *pngEncoder {
+	b := img.Bounds()
+	e := &pngEncoder{width: b.Dx(), height: b.Dy(), depth: 8}
+
+	deep := false
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		deep = true
+	}
+
+	if !reduce {
+		switch src := img.(type) {
+		case *image.Paletted:
+			if len(src.Palette) <= 256 {
+				e.colorType, e.depth = pngPalette, paletteDepth(len(src.Palette))
+				for _, c := range src.Palette {
+					e.palette = append(e.palette, color.NRGBAModel.Convert(c).(color.NRGBA))
+				}
+				e.indices = make([]byte, 0, e.width*e.height)
+				for y := 0; y < e.height; y++ {
+					start := src.PixOffset(b.Min.X, b.Min.Y+y)
+					e.indices = append(e.indices, src.Pix[start:start+e.width]...)
+				}
+				return e
+			}
+		case *image.Gray:
+			e.colorType, e.nrgba = pngGray, imaging.Clone(img)
+			return e
+		case *image.Gray16:
+			e.colorType, e.depth, e.nrgba64 = pngGray, 16, toNRGBA64(img)
+			return e
+		}
+		opaque := isOpaque(img)
+		e.colorType = pngRGBA
+		if opaque {
+			e.colorType = pngRGB
+		}
+		if deep {
+			e.depth, e.nrgba64 = 16, toNRGBA64(img)
+		} else {
+			e.nrgba = imaging.Clone(img)
+		}
+		return e
+	}
+
+	// Only keep 16 bits per sample when some sample needs them
+	if deep {
+		deepImg := toNRGBA64(img)
+		for i := 0; i < len(deepImg.Pix); i += 2 {
+			if deepImg.Pix[i] != deepImg.Pix[i+1] {
+				e.depth, e.nrgba64 = 16, deepImg
+				break
+			}
+		}
+	}
+	if e.depth == 16 {
+		gray, opaque := true, true
+		pix := e.nrgba64.Pix
+		for i := 0; i < len(pix); i += 8 {
+			gray = gray && pix[i] == pix[i+2] && pix[i+1] == pix[i+3] && pix[i] == pix[i+4] && pix[i+1] == pix[i+5]
+			opaque = opaque && pix[i+6] == 0xFF && pix[i+7] == 0xFF
+		}
+		e.colorType = pngColorType(gray, opaque)
+		return e
+	}
+
+	e.nrgba = imaging.Clone(img)
+	pix := e.nrgba.Pix
+	gray, opaque := true, true
+	colors := make(map[color.NRGBA]byte)
+	for i := 0; i < len(pix); i += 4 {
+		c := color.NRGBA{pix[i], pix[i+1], pix[i+2], pix[i+3]}
+		gray = gray && c.R == c.G && c.G == c.B
+		opaque = opaque && c.A == 0xFF
+		if len(colors) <= 256 {
+			colors[c] = 0 // Indices are assigned by usePalette
+		}
+	}
+
+	// Opaque gray images may fit in 1, 2 or 4 bits without a palette
+	if gray && opaque {
+		e.colorType = pngGray
+		if len(colors) > 16 {
+			return e
+		}
+		for _, depth := range []int{1, 2, 4} {
+			step := byte(255 / (1<<depth - 1))
+			exact := true
+			for c := range colors {
+				exact = exact && c.R%step == 0
+			}
+			if exact {
+				e.depth = depth
+				return e
+			}
+		}
+		// A palette with fewer bits beats 8-bit gray
+		e.usePalette(colors)
+		return e
+	}
+	if len(colors) <= 256 {
+		e.usePalette(colors)
+		return e
+	}
+	e.colorType = pngColorType(gray, opaque)
+	return e
+}
+
+// usePalette stores the image as indices into colors
+func (e *pngEncoder) usePalette(colors map[color.NRGBA]byte) {
+	e.colorType, e.depth = pngPalette, paletteDepth(len(colors))
+	e.palette = make([]color.NRGBA, len(colors))
+	// Translucent entries come first, so the tRNS chunk is short, and the
+	// order does not depend on the map
+	order := make([]color.NRGBA, 0, len(colors))
+	for c := range colors {
+		order = append(order, c)
+	}
+	key := func(c color.NRGBA) uint32 {
+		return uint32(c.A)<<24 | uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+	}
+	slices.SortFunc(order, func(a, b color.NRGBA) int {
+		return cmp.Compare(key(a), key(b))
+	})
+	for i, c := range order {
+		colors[c] = byte(i)
+		e.palette[i] = c
+	}
+	pix := e.nrgba.Pix
+	e.indices = make([]byte, e.width*e.height)
+	for i := range e.indices {
+		p := pix[4*i : 4*i+4 : 4*i+4]
+		e.indices[i] = colors[color.NRGBA{p[0], p[1], p[2], p[3]}]
+	}
+	e.nrgba = nil
+}
+
+func pngColorType(gray, opaque bool) byte {
+	switch {
+	case gray && opaque:
+		return pngGray
+	case gray:
+		return pngGrayAlpha
+	case opaque:
+		return pngRGB
+	}
+	return pngRGBA
+}
+
+// paletteDepth returns the fewest bits per index for a palette of n colors
+func paletteDepth(n int) int {
+	switch {
+	case n <= 2:
+		return 1
+	case n <= 4:
+		return 2
+	case n <= 16:
+		return 4
+	}
+	return 8
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xFFFF {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func toNRGBA64(img image.Image) *image.NRGBA64 {
+	b := img.Bounds()
+	dst := image.NewNRGBA64(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			dst.Set(x, y, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// bitsPerPixel returns the bits of one pixel in the color type and depth
+func (e *pngEncoder) bitsPerPixel() int {
+	channels := map[byte]int{pngGray: 1, pngRGB: 3, pngPalette: 1, pngGrayAlpha: 2, pngRGBA: 4}[e.colorType]
+	return channels * e.depth
+}
+
+// row packs the pixels x0, x0+dx, ... of row y into dst
+func (e *pngEncoder) row(dst []byte, y, x0, dx int) []byte {
+	dst = dst[:0]
+	if e.depth < 8 {
+		var acc byte
+		n := 0
+		for x := x0; x < e.width; x += dx {
+			var v byte
+			if e.colorType == pngPalette {
+				v = e.indices[y*e.width+x]
+			} else {
+				v = e.nrgba.Pix[y*e.nrgba.Stride+4*x] / byte(255/(1<<e.depth-1))
+			}
+			acc = acc<<e.depth | v
+			n += e.depth
+			if n == 8 {
+				dst = append(dst, acc)
+				acc, n = 0, 0
+			}
+		}
+		if n > 0 {
+			dst = append(dst, acc<<(8-n))
+		}
+		return dst
+	}
+
+	switch {
+	case e.colorType == pngPalette:
+		for x := x0; x < e.width; x += dx {
+			dst = append(dst, e.indices[y*e.width+x])
+		}
+	case e.depth == 16:
+		pix := e.nrgba64.Pix[y*e.nrgba64.Stride:]
+		for x := x0; x < e.width; x += dx {
+			p := pix[8*x : 8*x+8]
+			switch e.colorType {
+			case pngGray:
+				dst = append(dst, p[0], p[1])
+			case pngGrayAlpha:
+				dst = append(dst, p[0], p[1], p[6], p[7])
+			case pngRGB:
+				dst = append(dst, p[:6]...)
+			default:
+				dst = append(dst, p...)
+			}
+		}
+	default:
+		pix := e.nrgba.Pix[y*e.nrgba.Stride:]
+		for x := x0; x < e.width; x += dx {
+			p := pix[4*x : 4*x+4]
+			switch e.colorType {
+			case pngGray:
+				dst = append(dst, p[0])
+			case pngGrayAlpha:
+				dst = append(dst, p[0], p[3])
+			case pngRGB:
+				dst = append(dst, p[:3]...)
+			default:
+				dst = append(dst, p...)
+			}
+		}
+	}
+	return dst
+}
+
+// pngPass is the pixels x0, x0+dx, ... of the rows y0, y0+dy, ...
+type pngPass struct {
+	x0, y0, dx, dy int
+}
+
+// adam7Passes are the passes of an interlaced PNG, which fill in an 8x8 grid
+// of pixels so the image appears coarse first and sharpens as it loads
+var adam7Passes = []pngPass{
+	{0, 0, 8, 8},
+	{4, 0, 8, 8},
+	{0, 4, 4, 8},
+	{2, 0, 4, 4},
+	{0, 2, 2, 4},
+	{1, 0, 2, 2},
+	{0, 1, 1, 2},
+}
+
+// writeIDAT filters and compresses the rows into IDAT chunks, in the Adam7
+// passes if interlace is set
+func (e *pngEncoder) writeIDAT(w *bufio.Writer, level int, filter string, interlace bool) error {
+	chunks := bufio.NewWriterSize(pngChunkWriter{w}, 1<<15)
+	zw, err := zlib.NewWriterLevel(chunks, level)
+	if err != nil {
+		return fmt.Errorf("failed to compress PNG data: %w", err)
+	}
+
+	bpp := max(1, e.bitsPerPixel()/8)
+	passes := []pngPass{{0, 0, 1, 1}}
+	if interlace {
+		passes = adam7Passes
+	}
+	var f pngFilterer
+	var cur, prev []byte
+	for _, pass := range passes {
+		// Each pass is a small image of its own, filtered without the rows
+		// of other passes
+		if pass.x0 >= e.width {
+			continue
+		}
+		prev = prev[:0]
+		for y := pass.y0; y < e.height; y += pass.dy {
+			cur = e.row(cur, y, pass.x0, pass.dx)
+			if len(prev) == 0 {
+				prev = append(prev, make([]byte, len(cur))...)
+			}
+			if _, err := zw.Write(f.filter(filter, cur, prev, bpp)); err != nil {
+				return fmt.Errorf("failed to compress PNG data: %w", err)
+			}
+			cur, prev = prev[:0], cur
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress PNG data: %w", err)
+	}
+	return chunks.Flush()
+}
+
+// pngFilterer filters rows, reusing its buffers
+type pngFilterer struct {
+	out [5][]byte
+}
+
+// filter returns the row with its filter type byte, filtered by a named
+// filter or the adaptive choice
+func (f *pngFilterer) filter(name string, cur, prev []byte, bpp int) []byte {
+	if name != PNGFilterAdaptive {
+		for t, n := range pngFilters {
+			if n == name {
+				f.out[t] = pngFilterRow(f.out[t], cur, prev, bpp, byte(t))
+				return f.out[t]
+			}
+		}
+	}
+
+	best, bestSum := 0, -1
+	for t := range pngFilters {
+		f.out[t] = pngFilterRow(f.out[t], cur, prev, bpp, byte(t))
+		sum := 0
+		for _, v := range f.out[t][1:] {
+			sum += min(int(v), 256-int(v))
+		}
+		if bestSum < 0 || sum < bestSum {
+			best, bestSum = t, sum
+		}
+	}
+	return f.out[best]
+}
+
+// pngFilterRow filters cur with the filter type t into dst
+func pngFilterRow(dst, cur, prev []byte, bpp int, t byte) []byte {
+	dst = append(dst[:0], t)
+	for i, c := range cur {
+		var a, b, ab byte
+		if i >= bpp {
+			a, ab = cur[i-bpp], prev[i-bpp]
+		}
+		b = prev[i]
+		switch t {
+		case 1:
+			c -= a
+		case 2:
+			c -= b
+		case 3:
+			c -= byte((int(a) + int(b)) / 2)
+		case 4:
+			c -= paeth(a, b, ab)
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+// paeth returns whichever of the left, above and upper left bytes is closest
+// to left + above - upper left
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// pngChunkWriter writes each Write as an IDAT chunk
+type pngChunkWriter struct {
+	w *bufio.Writer
+}
+
+func (c pngChunkWriter) Write(p []byte) (int, error) {
+	writePNGChunk(c.w, "IDAT", p)
+	return len(p), nil
+}
+
+func writePNGChunk(w *bufio.Writer, name string, data []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	w.Write(length[:])
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(name))
+	crc.Write(data)
+	w.WriteString(name)
+	w.Write(data)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	w.Write(sum[:])
+}
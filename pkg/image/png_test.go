@@ -0,0 +1,231 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// encodePNG encodes img and decodes the result, returning it with the color
+// type and bit depth of the file
+func encodePNG(t *testing.T, img image.Image, options PNGOptions) (image.Image, byte, byte, int) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := EncodePNG(&buf, img, options); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	data := buf.Bytes()
+	decoded, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("%+v: decode failed: %v", options, err)
+	}
+	// IHDR follows the 8-byte signature and the chunk length and type
+	return decoded, data[25], data[24], len(data)
+}
+
+// sameColors reports whether two images have the same non-premultiplied
+// colors
+func sameColors(a, b image.Image) bool {
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return false
+	}
+	ba, bb := a.Bounds(), b.Bounds()
+	for y := 0; y < ba.Dy(); y++ {
+		for x := 0; x < ba.Dx(); x++ {
+			ca := color.NRGBA64Model.Convert(a.At(ba.Min.X+x, ba.Min.Y+y))
+			cb := color.NRGBA64Model.Convert(b.At(bb.Min.X+x, bb.Min.Y+y))
+			if ca != cb {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestEncodePNGFilters(t *testing.T) {
+	img := gradient(37, 21)
+	img.SetNRGBA(3, 4, color.NRGBA{10, 20, 30, 128})
+	for _, filter := range []string{"", PNGFilterAdaptive, PNGFilterNone, PNGFilterSub, PNGFilterUp, PNGFilterAverage, PNGFilterPaeth} {
+		for _, level := range []int{PNGCompressionNone, PNGCompressionDefault, PNGCompressionFast, PNGCompressionBest} {
+			decoded, colorType, _, _ := encodePNG(t, img, PNGOptions{Compression: level, Filter: filter})
+			if colorType != pngRGBA {
+				t.Errorf("filter %q: color type %d, expected RGBA", filter, colorType)
+			}
+			if !sameColors(img, decoded) {
+				t.Errorf("filter %q, level %d: pixels changed", filter, level)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := EncodePNG(&buf, img, PNGOptions{Filter: "best"}); err == nil {
+		t.Error("expected an error for an unknown filter")
+	}
+}
+
+func TestEncodePNGCompression(t *testing.T) {
+	img := gradient(200, 200)
+	_, _, _, none := encodePNG(t, img, PNGOptions{Compression: PNGCompressionNone})
+	_, _, _, fast := encodePNG(t, img, PNGOptions{Compression: PNGCompressionFast})
+	_, _, _, best := encodePNG(t, img, PNGOptions{Compression: PNGCompressionBest})
+	if !(best <= fast && fast < none) {
+		t.Errorf("sizes: none %d, fast %d, best %d", none, fast, best)
+	}
+
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	if _, _, _, size := encodePNG(t, img, PNGOptions{}); size > buf.Len()*105/100 {
+		t.Errorf("default size %d, image/png %d", size, buf.Len())
+	}
+}
+
+func TestEncodePNGReduce(t *testing.T) {
+	gray := image.NewNRGBA(image.Rect(0, 0, 30, 20))
+	bw := image.NewNRGBA(image.Rect(0, 0, 30, 20))
+	few := image.NewNRGBA(image.Rect(0, 0, 30, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 30; x++ {
+			v := uint8(x * 8)
+			gray.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+			v = uint8((x + y) % 2 * 255)
+			bw.SetNRGBA(x, y, color.NRGBA{v, v, v, 255})
+			few.SetNRGBA(x, y, color.NRGBA{uint8(x % 3 * 100), 50, 0, uint8(255 - y%2*255)})
+		}
+	}
+	deep := image.NewNRGBA64(image.Rect(0, 0, 4, 4))
+	deep.SetNRGBA64(1, 1, color.NRGBA64{1, 2, 3, 0xFFFF})
+
+	for _, tc := range []struct {
+		name      string
+		img       image.Image
+		colorType byte
+		depth     byte
+	}{
+		{"gray", gray, pngGray, 8},
+		{"black and white", bw, pngGray, 1},
+		{"few colors", few, pngPalette, 4},
+		{"gradient", gradient(40, 40), pngRGB, 8},
+		{"16-bit", deep, pngRGBA, 16},
+		{"8-bit in 16", image.NewNRGBA64(image.Rect(0, 0, 4, 4)), pngPalette, 1},
+	} {
+		decoded, colorType, depth, _ := encodePNG(t, tc.img, PNGOptions{Reduce: true})
+		if colorType != tc.colorType || depth != tc.depth {
+			t.Errorf("%s: color type %d at %d bits, expected %d at %d bits", tc.name, colorType, depth, tc.colorType, tc.depth)
+		}
+		if !sameColors(tc.img, decoded) {
+			t.Errorf("%s: pixels changed", tc.name)
+		}
+	}
+
+	// Without Reduce, the color type follows the image
+	if _, colorType, _, _ := encodePNG(t, gray, PNGOptions{}); colorType != pngRGB {
+		t.Errorf("color type %d, expected RGB", colorType)
+	}
+}
+
+func TestParsePNGCompression(t *testing.T) {
+	for input, expected := range map[string]int{
+		"":        PNGCompressionDefault,
+		"default": PNGCompressionDefault,
+		"none":    PNGCompressionNone,
+		"0":       PNGCompressionNone,
+		"fast":    PNGCompressionFast,
+		"BEST":    PNGCompressionBest,
+		"4":       4,
+	} {
+		if level, err := ParsePNGCompression(input); err != nil || level != expected {
+			t.Errorf("%q: got %d, %v; expected %d", input, level, err, expected)
+		}
+	}
+	for _, input := range []string{"10", "-1", "max"} {
+		if _, err := ParsePNGCompression(input); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+func TestEncodePNGInterlace(t *testing.T) {
+	deep := image.NewNRGBA64(image.Rect(0, 0, 9, 9))
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 9; x++ {
+			deep.SetNRGBA64(x, y, color.NRGBA64{uint16(x * 7001), uint16(y * 7001), 3, 0xFFFF})
+		}
+	}
+	bw := image.NewGray(image.Rect(0, 0, 11, 3))
+	for x := 0; x < 11; x += 2 {
+		bw.SetGray(x, 1, color.Gray{255})
+	}
+
+	// Sizes smaller than the 8x8 grid leave some passes empty
+	for _, img := range []image.Image{gradient(1, 1), gradient(3, 5), gradient(37, 21), deep, bw} {
+		for _, reduce := range []bool{false, true} {
+			var buf bytes.Buffer
+			if err := EncodePNG(&buf, img, PNGOptions{Interlace: true, Reduce: reduce}); err != nil {
+				t.Fatalf("encode failed: %v", err)
+			}
+			if method := buf.Bytes()[28]; method != 1 {
+				t.Errorf("%v: interlace method %d, expected 1", img.Bounds(), method)
+			}
+			decoded, err := png.Decode(&buf)
+			if err != nil {
+				t.Fatalf("%v: decode failed: %v", img.Bounds(), err)
+			}
+			if !sameColors(img, decoded) {
+				t.Errorf("%v, reduce %v: pixels changed", img.Bounds(), reduce)
+			}
+		}
+	}
+}
+
+func TestEncodePNGOptimize(t *testing.T) {
+	few := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			few.SetNRGBA(x, y, color.NRGBA{uint8(x / 16 * 60), uint8(y / 16 * 60), 0, 255})
+		}
+	}
+	for _, img := range []image.Image{gradient(64, 48), few, imaging.Grayscale(gradient(30, 30))} {
+		decoded, _, _, optimized := encodePNG(t, img, PNGOptions{Optimize: true})
+		if !sameColors(img, decoded) {
+			t.Errorf("%v: pixels changed", img.Bounds())
+		}
+		for _, options := range []PNGOptions{{}, {Reduce: true}, {Compression: PNGCompressionBest, Reduce: true}} {
+			if _, _, _, size := encodePNG(t, img, options); optimized > size {
+				t.Errorf("%v: optimized to %d bytes, %+v gives %d", img.Bounds(), optimized, options, size)
+			}
+		}
+	}
+}
+
+func TestOptimizePNG(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.NoCompression}
+	encoder.Encode(&buf, gradient(40, 40))
+	original := buf.Bytes()
+
+	optimized, err := OptimizePNG(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(optimized) >= len(original) {
+		t.Errorf("optimized to %d bytes from %d", len(optimized), len(original))
+	}
+	a, _ := png.Decode(bytes.NewReader(original))
+	b, _ := png.Decode(bytes.NewReader(optimized))
+	if !sameColors(a, b) {
+		t.Error("pixels changed")
+	}
+
+	// Files that cannot be made smaller are returned as they are
+	again, err := OptimizePNG(optimized)
+	if err != nil || !bytes.Equal(again, optimized) {
+		t.Errorf("optimized again to %d bytes from %d: %v", len(again), len(optimized), err)
+	}
+	if _, err := OptimizePNG([]byte("not a PNG")); err == nil {
+		t.Error("expected an error")
+	}
+}
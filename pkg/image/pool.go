@@ -0,0 +1,71 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+)
+
+// Encoded data, output writers and the large working buffers of the JPEG
+// codec are reused across images, so a batch of many files allocates them
+// once instead of per file. sync.Pool drops idle buffers at garbage
+// collection, so a single huge image does not keep its memory.
+
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// getBuffer returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns a buffer to the pool; its bytes must no longer be used
+func putBuffer(buf *bytes.Buffer) {
+	bufferPool.Put(buf)
+}
+
+var writerPool = sync.Pool{New: func() any { return bufio.NewWriterSize(nil, 64<<10) }}
+
+// getWriter returns a pooled buffered writer to w
+func getWriter(w io.Writer) *bufio.Writer {
+	bw := writerPool.Get().(*bufio.Writer)
+	bw.Reset(w)
+	return bw
+}
+
+// putWriter returns a writer to the pool without flushing it
+func putWriter(bw *bufio.Writer) {
+	bw.Reset(nil)
+	writerPool.Put(bw)
+}
+
+// slicePool reuses slices of T, such as pixel planes and DCT blocks
+type slicePool[T any] struct {
+	pool sync.Pool
+}
+
+// get returns a zeroed slice of n elements, reusing a pooled one with room
+// for them
+func (p *slicePool[T]) get(n int) []T {
+	if s, ok := p.pool.Get().(*[]T); ok && cap(*s) >= n {
+		slice := (*s)[:n]
+		clear(slice)
+		return slice
+	}
+	return make([]T, n)
+}
+
+// put returns a slice to the pool; it must no longer be used
+func (p *slicePool[T]) put(s []T) {
+	if cap(s) > 0 {
+		p.pool.Put(&s)
+	}
+}
+
+var (
+	blockPool slicePool[[64]int32]
+	bytePool  slicePool[byte]
+	floatPool slicePool[float64]
+)
@@ -0,0 +1,54 @@
+package image
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestSlicePool(t *testing.T) {
+	var pool slicePool[byte]
+	s := pool.get(16)
+	for i := range s {
+		s[i] = 0xFF
+	}
+	pool.put(s)
+	// Reused slices come back cleared, and small ones are not reused for
+	// larger requests
+	for _, n := range []int{8, 16, 32} {
+		s := pool.get(n)
+		if len(s) != n {
+			t.Fatalf("get(%d) returned %d elements", n, len(s))
+		}
+		if slices.ContainsFunc(s, func(b byte) bool { return b != 0 }) {
+			t.Errorf("get(%d) returned %v", n, s)
+		}
+		pool.put(s)
+	}
+}
+
+func TestPooledJPEG(t *testing.T) {
+	// Encoding and decoding one image after another must not leak pooled
+	// coefficients or planes from the previous image into the next
+	first, second := gradient(64, 48), noiseAlpha(64, 48)
+	fresh := encodeJPEG(t, second, true)
+	encodeJPEG(t, first, true)
+	if again := encodeJPEG(t, second, true); !bytes.Equal(fresh, again) {
+		t.Error("progressive JPEG differs after encoding another image")
+	}
+
+	decoded, err := DecodeJPEGScaled(bytes.NewReader(fresh), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeJPEGScaled(bytes.NewReader(encodeJPEG(t, first, false)), 2); err != nil {
+		t.Fatal(err)
+	}
+	again, err := DecodeJPEGScaled(bytes.NewReader(fresh), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Pix, again.Pix) {
+		t.Error("scaled decode differs after decoding another image")
+	}
+}
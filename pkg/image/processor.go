@@ -1,26 +1,29 @@
 package image
 
 import (
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
-	"image/gif"
-	"image/jpeg"
-	"image/png"
+	_ "image/png" // Decoder for image.Decode; PNG output uses EncodePNG
 	"io"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/chai2010/webp"
 	"github.com/disintegration/imaging"
 	"github.com/gen2brain/avif"
-	"github.com/jackmordaunt/icns"
 	"github.com/jdeng/goheif"
 	"github.com/kpfaulkner/jxl-go"
 	"github.com/sergeymakinen/go-bmp"
 	"github.com/sergeymakinen/go-ico"
-	"golang.org/x/image/tiff"
+	"nim/pkg/pdf"
+	"nim/pkg/resample"
 )
 
 // ResizeMode defines how the image should be resized
@@ -33,16 +36,65 @@ const (
 	ResizeModeFill ResizeMode = "fill"
 	// ResizeModeStretch resizes the image to the specified dimensions without maintaining aspect ratio
 	ResizeModeStretch ResizeMode = "stretch"
+	// ResizeModeLiquid resizes the image to the specified dimensions by seam
+	// carving, removing the least detailed parts instead of cropping
+	ResizeModeLiquid ResizeMode = "liquid"
 )
 
+// Operation names accepted in ProcessOptions.Order
+const (
+	// OperationCrop crops the image to ProcessOptions.Crop
+	OperationCrop = "crop"
+	// OperationResize resizes the image according to the resize mode
+	OperationResize = "resize"
+)
+
+// Stages reported to ProcessOptions.Hooks besides the operation names
+const (
+	// StageDecode is reported before the input is decoded
+	StageDecode = "decode"
+	// StageEncode is reported before the output is encoded
+	StageEncode = "encode"
+	// StageRotate is reported before the input is rotated
+	StageRotate = "rotate"
+)
+
+// DefaultOrder is the order operations run in when ProcessOptions.Order is empty
+var DefaultOrder = []string{OperationCrop, OperationResize}
+
 // ProcessOptions contains all options for image processing
 type ProcessOptions struct {
-	Width      int        // Target width
-	Height     int        // Target height
-	ResizeMode ResizeMode // How to resize the image
-	Quality    int        // Output quality (1-100, only for JPEG)
-	OutputFormat string   // Output format (jpg, png, gif)
-	PadColor   [3]uint8   // RGB color to use for padding
+	Width        int             // Target width
+	Height       int             // Target height
+	ResizeMode   ResizeMode      // How to resize the image
+	Quality      int             // Quality of JPEG, lossy WebP and AVIF output (1-100)
+	OutputFormat string          // Output format (jpg, png, gif)
+	PadColor     color.NRGBA     // Color to use for padding; flattened onto white for formats without alpha
+	Raw          RawOptions      // How camera RAW inputs are developed
+	HDR          HDROptions      // How HDR inputs are tone-mapped
+	NetpbmPlain  bool            // Write plain (ASCII) instead of raw Netpbm output
+	JPEG         JPEGOptions     // Encoding of JPEG output
+	PNG          PNGOptions      // Compression of PNG output
+	WebP         WebPOptions     // Lossless mode, effort and alpha of WebP output
+	AVIF         AVIFOptions     // Speed, chroma subsampling and alpha of AVIF output
+	GIF          GIFOptions      // Palette of GIF output
+	TIFF         TIFFOptions     // Compression of TIFF output
+	Page         int             // Page of multi-page inputs such as PDF or TIFF to read (1-based); 0 reads the first page
+	Frame        int             // Frame of animated GIF, WebP and PNG inputs to read (1-based, FrameMiddle or FrameLast), composited as it is shown; 0 reads the stored first image
+	DPI          float64         // Resolution vector documents such as PDF are rendered at; 0 uses DefaultDPI
+	PDF          pdf.Options     // Page layout of PDF output
+	Hotspot      image.Point     // Click position of cursor (.cur) output
+	IcoSizes     []int           // Frame sizes of ICO output; defaults to DefaultIcoSizes
+	Rotate       int             // Clockwise rotation in degrees (0, 90, 180 or 270), applied right after decoding
+	Crop         image.Rectangle // Region to crop; empty disables cropping
+	Order        []string        // Order operations run in; defaults to DefaultOrder
+	Density      float64         // Physical resolution written into JPEG, PNG and TIFF output in dots per inch; 0 writes none
+	TargetSSIM   float64         // SSIM the quality is chosen to keep per image; 0 uses Quality (see AutoQuality)
+	MaxBytes     int64           // Largest size of the output file; 0 disables the limit (see FitBytes)
+	MaxMemory    int64           // Largest decoded PNG or TIFF input Process holds in memory; larger ones are streamed (see ProcessStreaming); 0 disables streaming
+	BestEffort   bool            // Recover what can be decoded from truncated or corrupt JPEG, PNG and GIF inputs, filling the rest with PadColor (see Recovered)
+	Hash         string          // Content hash of the output to compute while it is written (sha256, xxhash); empty computes none unless the output path has {hash}
+	Hooks        Hooks           `json:"-"` // Called as each stage (decode, an operation, encode) starts and ends, and with its progress
 }
 
 // DefaultOptions returns the default processing options
@@ -53,14 +105,53 @@ func DefaultOptions() ProcessOptions {
 		ResizeMode:   ResizeModeFit,
 		Quality:      85,
 		OutputFormat: "",
-		PadColor:     [3]uint8{255, 255, 255}, // White
+		PadColor:     color.NRGBA{255, 255, 255, 255}, // White
 	}
 }
 
 // OpenImage opens an image file and decodes it based on its format
 func OpenImage(filename string) (image.Image, error) {
+	return OpenImageWithOptions(filename, DefaultOptions())
+}
+
+// DecodeFunc decodes the image file at path
+type DecodeFunc func(path string, options ProcessOptions) (image.Image, error)
+
+// decoder replaces the built-in decoders when set
+var decoder DecodeFunc
+
+// SetDecoder makes OpenImageWithOptions and Process decode every input with
+// d, such as a decoder running in a sandboxed process. Process then skips
+// reduced-scale JPEG decoding and streaming, which read the file themselves.
+// A nil d restores the built-in decoders.
+func SetDecoder(d DecodeFunc) {
+	decoder = d
+}
+
+// DecoderSet reports whether a decoder set by SetDecoder replaces the
+// built-in ones, so callers must not read inputs themselves
+func DecoderSet() bool {
+	return decoder != nil
+}
+
+// OpenImageWithOptions opens an image file and decodes it based on its format,
+// using the decoder-related settings in options (such as RAW development)
+func OpenImageWithOptions(filename string, options ProcessOptions) (image.Image, error) {
+	defer options.Hooks.Start(StageDecode)()
+	start := time.Now()
+	if decoder != nil {
+		img, err := decoder(filename, options)
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+			// Like the built-in decoders, files that cannot be read are
+			// not decode errors
+			return nil, err
+		}
+		return img, withKind(ErrDecode, err)
+	}
+
 	// Get file extension
 	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	slog.Debug("detected input format", "file", filename, "format", ext)
 
 	// Open the file
 	file, err := os.Open(filename)
@@ -69,12 +160,33 @@ func OpenImage(filename string) (image.Image, error) {
 	}
 	defer file.Close()
 
+	// A selected frame of an animation is composited from the frames
+	// before it
+	if options.Frame != 0 {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		img, err := DecodeFrame(data, ext, options.Frame)
+		if err != nil {
+			return nil, withKind(ErrDecode, fmt.Errorf("failed to decode image: %w", err))
+		}
+		slog.Info("decoded frame", "file", filename, "format", ext, "frame", options.Frame, "duration", time.Since(start))
+		return img, nil
+	}
+
 	// Decode the image based on its format
 	var img image.Image
 	switch ext {
-	case "jpg", "jpeg", "png", "gif", "bmp", "tiff", "tif":
+	case "jpg", "jpeg", "png", "gif", "bmp":
 		// Use imaging library for standard formats
-		return imaging.Open(filename)
+		img, err = imaging.Open(filename)
+	case "tiff", "tif":
+		if options.Page <= 1 {
+			img, err = imaging.Open(filename)
+			break
+		}
+		img, err = DecodeTIFFPage(file, options.Page)
 	case "webp":
 		img, err = webp.Decode(file)
 	case "avif":
@@ -82,7 +194,7 @@ func OpenImage(filename string) (image.Image, error) {
 	case "ico":
 		img, err = ico.Decode(file)
 	case "icns":
-		img, err = icns.Decode(file)
+		img, err = DecodeICNS(file)
 	case "heic", "heif":
 		img, err = goheif.Decode(file)
 	case "jxl":
@@ -94,103 +206,379 @@ func OpenImage(filename string) (image.Image, error) {
 	case "jp2":
 		// JP2 is not directly supported by any Go library
 		// We could potentially use an external tool or library for this
-		return nil, fmt.Errorf("JPEG 2000 (.jp2) format is not supported for decoding")
+		return nil, withKind(ErrUnsupportedFormat, fmt.Errorf("JPEG 2000 (.jp2) format is not supported for decoding"))
 	default:
-		return nil, fmt.Errorf("unsupported image format: %s", ext)
+		codec, ok := LookupCodec(ext)
+		if !ok || codec.Decode == nil {
+			return nil, withKind(ErrUnsupportedFormat, fmt.Errorf("unsupported image format: %s", ext))
+		}
+		img, err = codec.Decode(file, options)
 	}
 
+	if err != nil && options.BestEffort {
+		img, err = recoverImage(filename, ext, err, options)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode image: %w", err)
+		return nil, withKind(ErrDecode, fmt.Errorf("failed to decode image: %w", err))
 	}
 
+	bounds := img.Bounds()
+	slog.Info("decoded image", "file", filename, "format", ext, "size", fmt.Sprintf("%dx%d", bounds.Dx(), bounds.Dy()), "duration", time.Since(start))
 	return img, nil
 }
 
+// Result describes an output file written from an input image
+type Result struct {
+	Input          string        // Input path
+	Output         string        // Output path
+	InputFormat    string        // Input format, from the input file extension
+	OutputFormat   string        // Output format
+	OriginalWidth  int           // Width of the decoded input
+	OriginalHeight int           // Height of the decoded input
+	Width          int           // Width of the output
+	Height         int           // Height of the output
+	Bytes          int64         // Size of the output file
+	Hash           string        // Hex content hash of the output file, if one was computed
+	Recovery       *Recovery     // How much of a damaged input best-effort decoding recovered; nil for intact inputs
+	Duration       time.Duration // Time taken since the input was opened
+}
+
 // ProcessImage processes an image according to the provided options
 func ProcessImage(inputPath, outputPath string, options ProcessOptions) error {
-	// Open the input file using our custom function that supports more formats
-	src, err := OpenImage(inputPath)
+	_, err := Process(inputPath, outputPath, options)
+	return err
+}
+
+// Process processes an image like ProcessImage and describes the output
+func Process(inputPath, outputPath string, options ProcessOptions) (Result, error) {
+	start := time.Now()
+	if _, stream := StreamingSize(inputPath, options); stream && decoder == nil {
+		return ProcessStreaming(inputPath, outputPath, options)
+	}
+
+	// Animated inputs keep their frames in animated WebP and AVIF output,
+	// unless a frame is selected
+	if options.Frame == 0 && decoder == nil && slices.Contains(AnimationFormats, outputFormat(outputPath, options)) {
+		a, err := OpenAnimation(inputPath)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to open image: %w", err)
+		}
+		if a != nil {
+			return ProcessAnimation(a, inputPath, outputPath, options, nil)
+		}
+	}
+
+	// Large JPEGs are shrunk while decoding when the resize allows it;
+	// other inputs use our custom function that supports more formats
+	var src image.Image
+	var size image.Point
+	if decoder == nil {
+		src, size = openJPEGScaled(inputPath, options)
+	}
+	if src == nil {
+		var err error
+		if src, err = OpenImageWithOptions(inputPath, options); err != nil {
+			return Result{}, fmt.Errorf("failed to open image: %w", err)
+		}
+		size = src.Bounds().Size()
+	}
+
+	options.OutputFormat = outputFormat(outputPath, options)
+	transformed, err := Transform(src, options)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if options, err = KeepColor(inputPath, outputPath, options); err != nil {
+		return Result{}, err
+	}
+	options, err = AutoQuality(transformed, outputPath, options)
+	if err != nil {
+		return Result{}, err
+	}
+	result, options, err := FitBytes(transformed, outputPath, options)
+	if err != nil {
+		return Result{}, err
+	}
+
+	written, digest, err := WriteImage(result, outputPath, options)
 	if err != nil {
-		return fmt.Errorf("failed to open image: %w", err)
+		return Result{}, err
 	}
+	described, err := NewResult(inputPath, src, written, result, options, start)
+	described.OriginalWidth, described.OriginalHeight = size.X, size.Y
+	described.Hash = digest
+	return described, err
+}
 
-	// Determine output format if not specified
-	if options.OutputFormat == "" {
-		options.OutputFormat = strings.TrimPrefix(filepath.Ext(outputPath), ".")
-		if options.OutputFormat == "" {
-			// Default to JPEG if no extension is provided
-			options.OutputFormat = "jpg"
+// NewResult describes img, written to output from src, which was opened from
+// input at start
+func NewResult(input string, src image.Image, output string, img image.Image, options ProcessOptions, start time.Time) (Result, error) {
+	info, err := os.Stat(output)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read output file: %w", err)
+	}
+
+	var recovery *Recovery
+	if r, ok := Recovered(src); ok {
+		recovery = &r
+	}
+	return Result{
+		Input:          input,
+		Output:         output,
+		InputFormat:    strings.ToLower(strings.TrimPrefix(filepath.Ext(input), ".")),
+		OutputFormat:   outputFormat(output, options),
+		OriginalWidth:  src.Bounds().Dx(),
+		OriginalHeight: src.Bounds().Dy(),
+		Width:          img.Bounds().Dx(),
+		Height:         img.Bounds().Dy(),
+		Bytes:          info.Size(),
+		Recovery:       recovery,
+		Duration:       time.Since(start),
+	}, nil
+}
+
+// Transform applies the crop and resize operations to an image in the order
+// given by options.Order. Cropping before resizing selects a region of the
+// source, while cropping after resizing selects a region of the resized image.
+func Transform(src image.Image, options ProcessOptions) (*image.NRGBA, error) {
+	order := options.Order
+	if len(order) == 0 {
+		order = DefaultOrder
+	}
+
+	img := src
+	if options.Rotate != 0 {
+		end := options.Hooks.Start(StageRotate)
+		img = Rotate(img, options.Rotate)
+		end()
+	}
+	for _, operation := range order {
+		var err error
+		switch operation {
+		case OperationCrop:
+			if options.Crop.Empty() {
+				continue
+			}
+			end := options.Hooks.Start(operation)
+			slog.Info("cropping", "region", fmt.Sprintf("%dx%d+%d+%d", options.Crop.Dx(), options.Crop.Dy(), options.Crop.Min.X, options.Crop.Min.Y))
+			img, err = Crop(img, options.Crop)
+			end()
+		case OperationResize:
+			end := options.Hooks.Start(operation)
+			img, err = Resize(img, options)
+			end()
+		default:
+			return nil, fmt.Errorf("unknown operation: %s", operation)
+		}
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	// Resize the image according to the specified mode
+	if nrgba, ok := img.(*image.NRGBA); ok {
+		return nrgba, nil
+	}
+	return imaging.Clone(img), nil
+}
+
+// ParseRotation parses a clockwise rotation in degrees, a multiple of 90,
+// into 0, 90, 180 or 270. Negative angles turn counterclockwise.
+func ParseRotation(degrees int) (int, error) {
+	if degrees%90 != 0 {
+		return 0, fmt.Errorf("invalid rotation: %d (expected a multiple of 90 degrees)", degrees)
+	}
+	return (degrees%360 + 360) % 360, nil
+}
+
+// Rotate turns img clockwise by degrees: 90, 180 or 270. Other angles
+// return img unchanged.
+func Rotate(img image.Image, degrees int) image.Image {
+	// imaging rotates counterclockwise
+	switch degrees {
+	case 90:
+		return imaging.Rotate270(img)
+	case 180:
+		return imaging.Rotate180(img)
+	case 270:
+		return imaging.Rotate90(img)
+	}
+	return img
+}
+
+// Crop cuts the given region out of an image. The region is relative to the
+// top-left corner of the image and must lie within its bounds.
+func Crop(src image.Image, rect image.Rectangle) (*image.NRGBA, error) {
+	bounds := src.Bounds()
+	if !rect.In(image.Rect(0, 0, bounds.Dx(), bounds.Dy())) {
+		return nil, fmt.Errorf("crop region %dx%d+%d+%d is outside the %dx%d image",
+			rect.Dx(), rect.Dy(), rect.Min.X, rect.Min.Y, bounds.Dx(), bounds.Dy())
+	}
+
+	return imaging.Crop(src, rect.Add(bounds.Min)), nil
+}
+
+// Resize resizes an image according to the specified mode
+func Resize(src image.Image, options ProcessOptions) (*image.NRGBA, error) {
+	start := time.Now()
 	var resized *image.NRGBA
 	switch options.ResizeMode {
 	case ResizeModeFit:
-		resized = imaging.Fit(src, options.Width, options.Height, imaging.Lanczos)
+		resized = resample.Fit(src, options.Width, options.Height)
 		// If padding is needed, create a new image with the target dimensions and paste the resized image in the center
 		if resized.Bounds().Dx() < options.Width || resized.Bounds().Dy() < options.Height {
-			bgColor := color.RGBA{
-				R: options.PadColor[0],
-				G: options.PadColor[1],
-				B: options.PadColor[2],
-				A: 255,
-			}
-			bg := imaging.New(options.Width, options.Height, bgColor)
+			pad := padColor(options)
+			slog.Debug("padding to target size", "fitted", fmt.Sprintf("%dx%d", resized.Bounds().Dx(), resized.Bounds().Dy()), "color", fmt.Sprintf("#%02X%02X%02X%02X", pad.R, pad.G, pad.B, pad.A))
+			bg := imaging.New(options.Width, options.Height, pad)
 			resized = imaging.PasteCenter(bg, resized)
 		}
 	case ResizeModeFill:
-		resized = imaging.Fill(src, options.Width, options.Height, imaging.Center, imaging.Lanczos)
+		resized = resample.Fill(src, options.Width, options.Height)
 	case ResizeModeStretch:
-		resized = imaging.Resize(src, options.Width, options.Height, imaging.Lanczos)
+		resized = resample.Resize(src, options.Width, options.Height)
+	case ResizeModeLiquid:
+		resized = Liquid(src, options.Width, options.Height)
 	default:
-		return fmt.Errorf("unknown resize mode: %s", options.ResizeMode)
+		return nil, fmt.Errorf("unknown resize mode: %s", options.ResizeMode)
 	}
 
+	slog.Info("resized image", "mode", options.ResizeMode,
+		"from", fmt.Sprintf("%dx%d", src.Bounds().Dx(), src.Bounds().Dy()),
+		"to", fmt.Sprintf("%dx%d", resized.Bounds().Dx(), resized.Bounds().Dy()),
+		"duration", time.Since(start))
+	return resized, nil
+}
+
+// SaveImage writes an already processed image to outputPath. The output format
+// is taken from options.OutputFormat, or from the output file extension if unset.
+func SaveImage(img image.Image, outputPath string, options ProcessOptions) error {
+	_, _, err := WriteImage(img, outputPath, options)
+	return err
+}
+
+// WriteImage writes an image like SaveImage, hashing the encoded data with
+// options.Hash as it is written. It returns the path written, with {hash}
+// replaced by the hash, and the hex digest, which is empty without a hash.
+func WriteImage(img image.Image, outputPath string, options ProcessOptions) (string, string, error) {
+	options.OutputFormat = outputFormat(outputPath, options)
+
+	defer options.Hooks.Start(StageEncode)()
+	start := time.Now()
+
 	// Create the output file
-	out, err := os.Create(outputPath)
+	out, err := createOutput(outputPath, options)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return "", "", err
 	}
 	defer out.Close()
 
+	w := getWriter(out)
+	defer putWriter(w)
+	if err := Encode(w, img, options); err != nil {
+		return "", "", err
+	}
+	if err := w.Flush(); err != nil {
+		return "", "", fmt.Errorf("failed to write %s: %w", outputPath, err)
+	}
+	written, digest, err := out.Commit()
+	if err != nil {
+		return "", "", err
+	}
+	slog.Info("wrote image", "file", written, "format", options.OutputFormat, "hash", digest, "duration", time.Since(start))
+	return written, digest, nil
+}
+
+// outputFormat returns options.OutputFormat, or the format given by the
+// extension of outputPath if unset
+func outputFormat(outputPath string, options ProcessOptions) string {
+	if options.OutputFormat != "" {
+		return strings.ToLower(options.OutputFormat)
+	}
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(outputPath), "."))
+	if format == "" {
+		// Default to JPEG if no extension is provided
+		format = "jpg"
+	}
+	return format
+}
+
+// padColor returns options.PadColor, flattened onto white when
+// options.OutputFormat cannot store transparency
+func padColor(options ProcessOptions) color.NRGBA {
+	if options.OutputFormat != "" && !SupportsAlpha(options.OutputFormat) {
+		return FlattenColor(options.PadColor)
+	}
+	return options.PadColor
+}
+
+// Encode writes img to w in options.OutputFormat
+func Encode(w io.Writer, img image.Image, options ProcessOptions) error {
+	if options.Density > 0 && slices.Contains(DensityFormats, strings.ToLower(options.OutputFormat)) {
+		// Tag the encoded file with the density
+		buf := getBuffer()
+		defer putBuffer(buf)
+		density := options.Density
+		options.Density = 0
+		if err := Encode(buf, img, options); err != nil {
+			return err
+		}
+		data, err := SetDensity(buf.Bytes(), density)
+		if err != nil {
+			return withKind(ErrEncode, fmt.Errorf("failed to encode image: %w", err))
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	slog.Info("encoding image", "format", strings.ToLower(options.OutputFormat), "quality", options.Quality,
+		"size", fmt.Sprintf("%dx%d", img.Bounds().Dx(), img.Bounds().Dy()))
+	var err error
 	// Save the image in the specified format
 	switch strings.ToLower(options.OutputFormat) {
 	case "jpg", "jpeg":
-		err = jpeg.Encode(out, resized, &jpeg.Options{Quality: options.Quality})
+		err = EncodeJPEG(w, img, options.Quality, options.JPEG)
 	case "png":
-		err = png.Encode(out, resized)
+		err = EncodePNG(w, img, options.PNG)
 	case "gif":
-		err = gif.Encode(out, resized, nil)
+		err = EncodeGIF(w, img, options.GIF)
 	case "bmp":
-		err = bmp.Encode(out, resized)
+		err = bmp.Encode(w, img)
 	case "tiff", "tif":
-		err = tiff.Encode(out, resized, &tiff.Options{Compression: tiff.Deflate, Predictor: true})
+		err = EncodeTIFF(w, img, options.TIFF)
 	case "webp":
-		err = webp.Encode(out, resized, &webp.Options{Lossless: false, Quality: float32(options.Quality)})
+		err = EncodeWebP(w, img, options.Quality, options.WebP)
 	case "avif":
-		err = avif.Encode(out, resized, avif.Options{Quality: options.Quality, Speed: 8})
+		err = EncodeAVIF(w, img, options.Quality, options.AVIF)
 	case "ico":
-		err = ico.Encode(out, resized)
+		err = EncodeICO(w, img, options.IcoSizes)
 	case "icns":
-		// Use the resized image directly for ICNS encoding
-		err = icns.Encode(out, resized)
+		err = EncodeICNS(w, img)
 	case "heic", "heif":
 		// The goheif library (github.com/jdeng/goheif) only supports decoding HEIC/HEIF images, not encoding
 		// There is no Go library available that supports encoding to HEIC/HEIF format
-		return fmt.Errorf("encoding to %s format is not supported: the goheif library only provides decoding capability", options.OutputFormat)
+		return withKind(ErrUnsupportedFormat, fmt.Errorf("encoding to %s format is not supported: the goheif library only provides decoding capability", options.OutputFormat))
 	case "jxl":
 		// The jxl-go library (github.com/kpfaulkner/jxl-go) only supports decoding JXL images, not encoding
-		return fmt.Errorf("encoding to JXL format is not supported: the jxl-go library only provides decoding capability")
+		return withKind(ErrUnsupportedFormat, fmt.Errorf("encoding to JXL format is not supported: the jxl-go library only provides decoding capability"))
 	case "jp2":
 		// There's no Go library for JP2 encoding
-		return fmt.Errorf("encoding to JPEG 2000 format is not supported: no Go library available for JP2 encoding")
+		return withKind(ErrUnsupportedFormat, fmt.Errorf("encoding to JPEG 2000 format is not supported: no Go library available for JP2 encoding"))
 	default:
-		return fmt.Errorf("unsupported output format: %s", options.OutputFormat)
+		codec, ok := LookupCodec(options.OutputFormat)
+		if !ok {
+			return withKind(ErrUnsupportedFormat, fmt.Errorf("unsupported output format: %s", options.OutputFormat))
+		}
+		if codec.Encode == nil {
+			return withKind(ErrUnsupportedFormat, fmt.Errorf("encoding to %s format is not supported", codec.Name))
+		}
+		if writeOptions.Reproducible {
+			return withKind(ErrUnsupportedFormat, fmt.Errorf("%s output of a codec plugin is not reproducible", codec.Name))
+		}
+		err = codec.Encode(w, img, options)
 	}
 
 	if err != nil {
-		return fmt.Errorf("failed to encode image: %w", err)
+		return withKind(ErrEncode, fmt.Errorf("failed to encode image: %w", err))
 	}
 
 	return nil
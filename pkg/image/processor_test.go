@@ -8,7 +8,9 @@ import (
 	"image/png"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 )
 
 // createTestImage creates a test image with the given dimensions and color
@@ -75,7 +77,7 @@ func TestProcessImage(t *testing.T) {
 				ResizeMode:   ResizeModeFit,
 				Quality:      90,
 				OutputFormat: "png",
-				PadColor:     [3]uint8{255, 255, 255},
+				PadColor:     color.NRGBA{255, 255, 255, 255},
 			},
 		},
 		{
@@ -86,7 +88,7 @@ func TestProcessImage(t *testing.T) {
 				ResizeMode:   ResizeModeFill,
 				Quality:      90,
 				OutputFormat: "jpg",
-				PadColor:     [3]uint8{0, 0, 0},
+				PadColor:     color.NRGBA{0, 0, 0, 255},
 			},
 		},
 		{
@@ -97,7 +99,7 @@ func TestProcessImage(t *testing.T) {
 				ResizeMode:   ResizeModeStretch,
 				Quality:      90,
 				OutputFormat: "png",
-				PadColor:     [3]uint8{0, 255, 0},
+				PadColor:     color.NRGBA{0, 255, 0, 255},
 			},
 		},
 	}
@@ -122,4 +124,166 @@ func TestProcessImage(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestTransformOrder(t *testing.T) {
+	img, err := createTestImage(200, 100, color.RGBA{255, 0, 0, 255})
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	options := ProcessOptions{
+		Width:      100,
+		Height:     50,
+		ResizeMode: ResizeModeStretch,
+		Crop:       image.Rect(0, 0, 40, 40),
+	}
+
+	testCases := []struct {
+		name           string
+		order          []string
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{"Default order crops first", nil, 100, 50},
+		{"Crop then resize", []string{OperationCrop, OperationResize}, 100, 50},
+		{"Resize then crop", []string{OperationResize, OperationCrop}, 40, 40},
+		{"Crop only", []string{OperationCrop}, 40, 40},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			options.Order = tc.order
+			result, err := Transform(img, options)
+			if err != nil {
+				t.Fatalf("Transform failed: %v", err)
+			}
+			if result.Bounds().Dx() != tc.expectedWidth || result.Bounds().Dy() != tc.expectedHeight {
+				t.Errorf("Expected %dx%d, got %dx%d", tc.expectedWidth, tc.expectedHeight,
+					result.Bounds().Dx(), result.Bounds().Dy())
+			}
+		})
+	}
+
+	options.Order = []string{"rotate"}
+	if _, err := Transform(img, options); err == nil {
+		t.Errorf("Expected an error for an unknown operation")
+	}
+}
+
+func TestTransformRotate(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	img.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+
+	// The crop region is in the rotated image: the top-left corner turns to
+	// the top right
+	options := ProcessOptions{Rotate: 90, Crop: image.Rect(10, 0, 20, 10), Order: []string{OperationCrop}}
+	result, err := Transform(img, options)
+	if err != nil {
+		t.Fatalf("Transform failed: %v", err)
+	}
+	if result.Bounds().Dx() != 10 || result.Bounds().Dy() != 10 || result.NRGBAAt(9, 0).R != 255 {
+		t.Errorf("Expected the red corner at the top right of the crop, got %v", result.Bounds())
+	}
+
+	for degrees, want := range map[int]int{0: 0, 90: 90, -90: 270, 450: 90} {
+		if got, err := ParseRotation(degrees); err != nil || got != want {
+			t.Errorf("ParseRotation(%d): expected %d, got %d, %v", degrees, want, got, err)
+		}
+	}
+	if _, err := ParseRotation(45); err == nil {
+		t.Errorf("Expected an error for 45 degrees")
+	}
+}
+
+func TestCropOutOfBounds(t *testing.T) {
+	img, err := createTestImage(50, 50, color.RGBA{0, 0, 255, 255})
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	if _, err := Crop(img, image.Rect(40, 40, 60, 60)); err == nil {
+		t.Errorf("Expected an error for a crop region outside the image")
+	}
+}
+
+func TestProcessImageProgress(t *testing.T) {
+	img, err := createTestImage(50, 50, color.RGBA{0, 255, 0, 255})
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+	inputPath, err := saveTestImage(img, "png")
+	if err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+	defer os.Remove(inputPath)
+
+	var stages, ended []string
+	options := DefaultOptions()
+	options.Width, options.Height = 20, 20
+	options.Crop = image.Rect(0, 0, 40, 40)
+	options.Hooks.OnStageStart = func(stage string) { stages = append(stages, stage) }
+	options.Hooks.OnStageEnd = func(stage string, elapsed time.Duration) { ended = append(ended, stage) }
+
+	if err := ProcessImage(inputPath, filepath.Join(t.TempDir(), "out.png"), options); err != nil {
+		t.Fatalf("ProcessImage failed: %v", err)
+	}
+	if !slices.Equal(stages, ended) {
+		t.Errorf("Expected every stage to end in order, got %v and %v", stages, ended)
+	}
+
+	expected := []string{StageDecode, OperationCrop, OperationResize, StageEncode}
+	if len(stages) != len(expected) {
+		t.Fatalf("Expected stages %v, got %v", expected, stages)
+	}
+	for i := range expected {
+		if stages[i] != expected[i] {
+			t.Errorf("Expected stages %v, got %v", expected, stages)
+			break
+		}
+	}
+}
+
+func TestProcess(t *testing.T) {
+	img, err := createTestImage(120, 60, color.RGBA{0, 0, 255, 255})
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+	inputPath, err := saveTestImage(img, "png")
+	if err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+	defer os.Remove(inputPath)
+
+	options := DefaultOptions()
+	options.Width, options.Height = 40, 40
+	options.ResizeMode = ResizeModeFill
+	outputPath := filepath.Join(t.TempDir(), "out.JPG")
+
+	result, err := Process(inputPath, outputPath, options)
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to stat output: %v", err)
+	}
+	expected := Result{
+		Input:          inputPath,
+		Output:         outputPath,
+		InputFormat:    "png",
+		OutputFormat:   "jpg",
+		OriginalWidth:  120,
+		OriginalHeight: 60,
+		Width:          40,
+		Height:         40,
+		Bytes:          info.Size(),
+		Duration:       result.Duration,
+	}
+	if result != expected {
+		t.Errorf("Expected %+v, got %+v", expected, result)
+	}
+	if result.Duration <= 0 {
+		t.Errorf("Expected a positive duration, got %s", result.Duration)
+	}
+}
@@ -0,0 +1,272 @@
+package image
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Photoshop color modes
+const (
+	psdModeBitmap    = 0
+	psdModeGrayscale = 1
+	psdModeIndexed   = 2
+	psdModeRGB       = 3
+	psdModeCMYK      = 4
+	psdModeDuotone   = 8
+)
+
+func init() {
+	RegisterCodec(Codec{
+		Name:       "Photoshop",
+		Extensions: []string{"psd", "psb"},
+		Decode: func(r io.Reader, options ProcessOptions) (image.Image, error) {
+			return DecodePSD(r)
+		},
+	})
+}
+
+// DecodePSD decodes the flattened composite image of a Photoshop PSD or PSB
+// file. Layers are not rendered; the composite is what Photoshop stores when
+// "Maximize compatibility" is enabled, which is the default.
+func DecodePSD(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	be := binary.BigEndian
+
+	var header [26]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil || string(header[:4]) != "8BPS" {
+		return nil, fmt.Errorf("not a Photoshop file")
+	}
+	version := be.Uint16(header[4:])
+	if version != 1 && version != 2 {
+		return nil, fmt.Errorf("unsupported Photoshop file version: %d", version)
+	}
+	psb := version == 2
+	channels := int(be.Uint16(header[12:]))
+	height := int(be.Uint32(header[14:]))
+	width := int(be.Uint32(header[18:]))
+	depth := int(be.Uint16(header[22:]))
+	mode := int(be.Uint16(header[24:]))
+	if width <= 0 || height <= 0 || channels <= 0 {
+		return nil, fmt.Errorf("invalid Photoshop image dimensions")
+	}
+	if depth != 1 && depth != 8 && depth != 16 {
+		return nil, fmt.Errorf("unsupported Photoshop bit depth: %d", depth)
+	}
+
+	colorChannels := 0
+	switch mode {
+	case psdModeBitmap, psdModeGrayscale, psdModeIndexed, psdModeDuotone:
+		colorChannels = 1
+	case psdModeRGB:
+		colorChannels = 3
+	case psdModeCMYK:
+		colorChannels = 4
+	default:
+		return nil, fmt.Errorf("unsupported Photoshop color mode: %d", mode)
+	}
+	if channels < colorChannels {
+		return nil, fmt.Errorf("Photoshop file has %d channels, expected at least %d", channels, colorChannels)
+	}
+
+	// Color mode data holds the palette of indexed images
+	colorData, err := readPSDSection(br, false)
+	if err != nil {
+		return nil, err
+	}
+	if mode == psdModeIndexed && len(colorData) < 768 {
+		return nil, fmt.Errorf("invalid Photoshop palette")
+	}
+
+	// Image resources and layer data are not needed for the composite
+	if _, err := readPSDSection(br, false); err != nil {
+		return nil, err
+	}
+	if _, err := readPSDSection(br, psb); err != nil {
+		return nil, err
+	}
+
+	// Only decode color channels plus an optional alpha channel
+	used := min(channels, colorChannels+1)
+	if mode == psdModeBitmap || mode == psdModeIndexed {
+		used = colorChannels
+	}
+
+	rowSize := (width*depth + 7) / 8
+	planes, err := readPSDPlanes(br, channels, used, height, rowSize, psb)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := func(plane []byte, i int) uint16 {
+		if depth == 16 {
+			return be.Uint16(plane[i*2:])
+		}
+		v := uint16(plane[i])
+		return v<<8 | v
+	}
+
+	img := image.NewNRGBA64(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			c := color.NRGBA64{A: 0xffff}
+			switch mode {
+			case psdModeBitmap:
+				// Set bits are black
+				if planes[0][y*rowSize+x/8]&(0x80>>(x%8)) == 0 {
+					c.R, c.G, c.B = 0xffff, 0xffff, 0xffff
+				}
+			case psdModeIndexed:
+				index := int(planes[0][y*rowSize+x])
+				c.R = uint16(colorData[index]) * 0x101
+				c.G = uint16(colorData[256+index]) * 0x101
+				c.B = uint16(colorData[512+index]) * 0x101
+			case psdModeGrayscale, psdModeDuotone:
+				v := sample(planes[0], i)
+				c.R, c.G, c.B = v, v, v
+			case psdModeRGB:
+				c.R, c.G, c.B = sample(planes[0], i), sample(planes[1], i), sample(planes[2], i)
+			case psdModeCMYK:
+				// Photoshop stores CMYK inverted, so 0xffff means no ink
+				k := uint32(sample(planes[3], i))
+				c.R = uint16(uint32(sample(planes[0], i)) * k / 0xffff)
+				c.G = uint16(uint32(sample(planes[1], i)) * k / 0xffff)
+				c.B = uint16(uint32(sample(planes[2], i)) * k / 0xffff)
+			}
+			if used > colorChannels {
+				c.A = sample(planes[colorChannels], i)
+			}
+			img.SetNRGBA64(x, y, c)
+		}
+	}
+
+	return img, nil
+}
+
+// readPSDSection reads a length-prefixed section. PSB files use 64-bit
+// lengths for the layer and mask section.
+func readPSDSection(r io.Reader, long bool) ([]byte, error) {
+	var length uint64
+	if long {
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return nil, fmt.Errorf("failed to read Photoshop section: %w", err)
+		}
+	} else {
+		var length32 uint32
+		if err := binary.Read(r, binary.BigEndian, &length32); err != nil {
+			return nil, fmt.Errorf("failed to read Photoshop section: %w", err)
+		}
+		length = uint64(length32)
+	}
+
+	// Small sections are returned, larger ones (layer data) are skipped
+	if length > 1<<16 {
+		if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil {
+			return nil, fmt.Errorf("failed to skip Photoshop section: %w", err)
+		}
+		return nil, nil
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("failed to read Photoshop section: %w", err)
+	}
+	return data, nil
+}
+
+// readPSDPlanes reads the planar composite image data, decoding the first
+// used channels and stopping there
+func readPSDPlanes(r io.Reader, channels, used, height, rowSize int, psb bool) ([][]byte, error) {
+	var compression uint16
+	if err := binary.Read(r, binary.BigEndian, &compression); err != nil {
+		return nil, fmt.Errorf("failed to read Photoshop image data: %w", err)
+	}
+
+	planes := make([][]byte, used)
+	for i := range planes {
+		planes[i] = make([]byte, height*rowSize)
+	}
+
+	switch compression {
+	case 0:
+		for _, plane := range planes {
+			if _, err := io.ReadFull(r, plane); err != nil {
+				return nil, fmt.Errorf("failed to read Photoshop image data: %w", err)
+			}
+		}
+	case 1:
+		// Byte counts of every row of every channel precede the PackBits data
+		counts := make([]int, channels*height)
+		for i := range counts {
+			if psb {
+				var n uint32
+				if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+					return nil, fmt.Errorf("failed to read Photoshop row lengths: %w", err)
+				}
+				counts[i] = int(n)
+			} else {
+				var n uint16
+				if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+					return nil, fmt.Errorf("failed to read Photoshop row lengths: %w", err)
+				}
+				counts[i] = int(n)
+			}
+		}
+
+		var packed []byte
+		for c, plane := range planes {
+			for y := 0; y < height; y++ {
+				n := counts[c*height+y]
+				if cap(packed) < n {
+					packed = make([]byte, n)
+				}
+				packed = packed[:n]
+				if _, err := io.ReadFull(r, packed); err != nil {
+					return nil, fmt.Errorf("failed to read Photoshop image data: %w", err)
+				}
+				if err := unpackBits(packed, plane[y*rowSize:(y+1)*rowSize]); err != nil {
+					return nil, err
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Photoshop image compression: %d", compression)
+	}
+
+	return planes, nil
+}
+
+// unpackBits decodes PackBits run-length encoded data into dst
+func unpackBits(src, dst []byte) error {
+	n := 0
+	for i := 0; i < len(src) && n < len(dst); {
+		header := int(int8(src[i]))
+		i++
+		switch {
+		case header >= 0:
+			count := header + 1
+			if i+count > len(src) || n+count > len(dst) {
+				return fmt.Errorf("corrupt PackBits data")
+			}
+			n += copy(dst[n:], src[i:i+count])
+			i += count
+		case header > -128:
+			count := -header + 1
+			if i >= len(src) || n+count > len(dst) {
+				return fmt.Errorf("corrupt PackBits data")
+			}
+			for ; count > 0; count-- {
+				dst[n] = src[i]
+				n++
+			}
+			i++
+		}
+	}
+	if n != len(dst) {
+		return fmt.Errorf("corrupt PackBits data: expected %d bytes, got %d", len(dst), n)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// buildPSD creates a PSD file with the given color mode, depth and planar
+// channel data, optionally PackBits compressed as literal runs
+func buildPSD(width, height, depth, mode int, planes [][]byte, rle bool) []byte {
+	be := binary.BigEndian
+	var buf bytes.Buffer
+	buf.WriteString("8BPS")
+	binary.Write(&buf, be, uint16(1))
+	buf.Write(make([]byte, 6))
+	binary.Write(&buf, be, uint16(len(planes)))
+	binary.Write(&buf, be, uint32(height))
+	binary.Write(&buf, be, uint32(width))
+	binary.Write(&buf, be, uint16(depth))
+	binary.Write(&buf, be, uint16(mode))
+	binary.Write(&buf, be, uint32(0)) // Color mode data
+	binary.Write(&buf, be, uint32(4)) // Image resources
+	buf.WriteString("junk")
+	binary.Write(&buf, be, uint32(0)) // Layer and mask information
+
+	rowSize := len(planes[0]) / height
+	if !rle {
+		binary.Write(&buf, be, uint16(0))
+		for _, plane := range planes {
+			buf.Write(plane)
+		}
+		return buf.Bytes()
+	}
+
+	binary.Write(&buf, be, uint16(1))
+	var rows [][]byte
+	for _, plane := range planes {
+		for y := 0; y < height; y++ {
+			// Encode each row as a run of its first byte when uniform, literal otherwise
+			row := plane[y*rowSize : (y+1)*rowSize]
+			if bytes.Count(row, row[:1]) == len(row) {
+				rows = append(rows, []byte{byte(int8(1 - len(row))), row[0]})
+			} else {
+				rows = append(rows, append([]byte{byte(len(row) - 1)}, row...))
+			}
+		}
+	}
+	for _, row := range rows {
+		binary.Write(&buf, be, uint16(len(row)))
+	}
+	for _, row := range rows {
+		buf.Write(row)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodePSD(t *testing.T) {
+	red := bytes.Repeat([]byte{200}, 12)
+	green := []byte{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 110}
+	blue := bytes.Repeat([]byte{5}, 12)
+	alpha := bytes.Repeat([]byte{128}, 12)
+
+	for _, rle := range []bool{false, true} {
+		data := buildPSD(4, 3, 8, psdModeRGB, [][]byte{red, green, blue, alpha}, rle)
+		img, err := DecodePSD(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("DecodePSD (rle=%v) failed: %v", rle, err)
+		}
+		if img.Bounds().Dx() != 4 || img.Bounds().Dy() != 3 {
+			t.Fatalf("Expected 4x3, got %v", img.Bounds())
+		}
+		r, g, b, a := img.At(1, 2).RGBA()
+		// RGBA() is alpha-premultiplied
+		if a>>8 != 128 || r*0xffff/a>>8 != 200 || g*0xffff/a>>8 != 90 || b*0xffff/a>>8 != 5 {
+			t.Errorf("Unexpected pixel (rle=%v): %d %d %d %d", rle, r>>8, g>>8, b>>8, a>>8)
+		}
+	}
+}
+
+func TestDecodePSDGray16(t *testing.T) {
+	plane := []byte{0x12, 0x34, 0xff, 0xff}
+	img, err := DecodePSD(bytes.NewReader(buildPSD(2, 1, 16, psdModeGrayscale, [][]byte{plane}, false)))
+	if err != nil {
+		t.Fatalf("DecodePSD failed: %v", err)
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r != 0x1234 {
+		t.Errorf("Expected 16-bit sample 0x1234, got %#x", r)
+	}
+}
+
+func TestDecodePSDInvalid(t *testing.T) {
+	if _, err := DecodePSD(bytes.NewReader([]byte("GIF89a"))); err == nil {
+		t.Errorf("Expected an error for a non-PSD file")
+	}
+
+	data := buildPSD(4, 3, 8, psdModeRGB, [][]byte{make([]byte, 12), make([]byte, 12), make([]byte, 12)}, true)
+	if _, err := DecodePSD(bytes.NewReader(data[:len(data)-4])); err == nil {
+		t.Errorf("Expected an error for truncated image data")
+	}
+}
+
+func TestUnpackBits(t *testing.T) {
+	dst := make([]byte, 7)
+	// Literal run of 3, then a repeat run of 4
+	if err := unpackBits([]byte{2, 1, 2, 3, 0xfd, 9}, dst); err != nil {
+		t.Fatalf("unpackBits failed: %v", err)
+	}
+	if !bytes.Equal(dst, []byte{1, 2, 3, 9, 9, 9, 9}) {
+		t.Errorf("Unexpected output %v", dst)
+	}
+	if err := unpackBits([]byte{0xfd, 9}, make([]byte, 7)); err == nil {
+		t.Errorf("Expected an error for short data")
+	}
+}
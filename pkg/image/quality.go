@@ -0,0 +1,109 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/chai2010/webp"
+	"github.com/gen2brain/avif"
+	"nim/pkg/compare"
+)
+
+// DefaultTargetSSIM is the similarity "--quality auto" aims for
+const DefaultTargetSSIM = 0.95
+
+// ParseQuality parses a quality setting: a number from 1 to 100, or "auto"
+// with an optional target such as "auto:ssim=0.97". It returns the quality
+// and the target SSIM, which is 0 for a fixed quality. Auto settings return
+// the default quality for formats without a quality search.
+func ParseQuality(setting string) (int, float64, error) {
+	s := strings.ToLower(strings.TrimSpace(setting))
+	if s == "auto" || strings.HasPrefix(s, "auto:") {
+		target := DefaultTargetSSIM
+		if params, ok := strings.CutPrefix(s, "auto:"); ok {
+			metric, value, ok := strings.Cut(params, "=")
+			if !ok || metric != "ssim" {
+				return 0, 0, fmt.Errorf("invalid quality: %s (expected auto or auto:ssim=TARGET)", setting)
+			}
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil || v <= 0 || v >= 1 {
+				return 0, 0, fmt.Errorf("invalid SSIM target: %s (expected a number between 0 and 1)", value)
+			}
+			target = v
+		}
+		return DefaultOptions().Quality, target, nil
+	}
+
+	q, err := strconv.Atoi(s)
+	if err != nil || q < 1 || q > 100 {
+		return 0, 0, fmt.Errorf("invalid quality: %s (expected 1-100 or auto)", setting)
+	}
+	return q, 0, nil
+}
+
+// decodeLossy decodes data encoded in a lossy format
+func decodeLossy(data []byte, format string) (image.Image, error) {
+	switch format {
+	case "jpg", "jpeg":
+		return jpeg.Decode(bytes.NewReader(data))
+	case "webp":
+		return webp.Decode(bytes.NewReader(data))
+	case "avif":
+		return avif.Decode(bytes.NewReader(data))
+	}
+	return nil, fmt.Errorf("unsupported lossy format: %s", format)
+}
+
+// AutoQuality chooses the lowest quality at which img, encoded as JPEG, WebP
+// or AVIF for outputPath, keeps an SSIM of at least options.TargetSSIM with
+// img. Simple images get low qualities and detailed ones high qualities. It
+// returns options with the quality set, or unchanged without a target or for
+// other formats.
+func AutoQuality(img image.Image, outputPath string, options ProcessOptions) (ProcessOptions, error) {
+	format := outputFormat(outputPath, options)
+	if options.TargetSSIM <= 0 || !lossyFormat(format, options) {
+		return options, nil
+	}
+
+	// similarity encodes and decodes img at a quality and compares the result
+	similarity := func(quality int) (float64, error) {
+		trial := options
+		trial.OutputFormat, trial.Quality = format, quality
+		buf := getBuffer()
+		defer putBuffer(buf)
+		if err := Encode(buf, img, trial); err != nil {
+			return 0, err
+		}
+		decoded, err := decodeLossy(buf.Bytes(), format)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decode %s at quality %d: %w", format, quality, err)
+		}
+		return compare.SSIM(img, decoded)
+	}
+
+	// Binary search for the lowest quality that meets the target, assuming
+	// similarity grows with quality; 100 is used if none does
+	low, high := 1, 100
+	for low < high {
+		quality := (low + high) / 2
+		ssim, err := similarity(quality)
+		if err != nil {
+			return options, err
+		}
+		slog.Debug("tried quality", "format", format, "quality", quality, "ssim", ssim)
+		if ssim >= options.TargetSSIM {
+			high = quality
+		} else {
+			low = quality + 1
+		}
+	}
+
+	slog.Info("chose quality", "format", format, "quality", low, "target_ssim", options.TargetSSIM)
+	options.Quality = low
+	return options, nil
+}
@@ -0,0 +1,90 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"nim/pkg/compare"
+)
+
+func TestParseQuality(t *testing.T) {
+	tests := []struct {
+		input   string
+		quality int
+		target  float64
+	}{
+		{"90", 90, 0},
+		{"1", 1, 0},
+		{"auto", 85, DefaultTargetSSIM},
+		{"AUTO", 85, DefaultTargetSSIM},
+		{"auto:ssim=0.98", 85, 0.98},
+	}
+	for _, test := range tests {
+		quality, target, err := ParseQuality(test.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.input, err)
+		} else if quality != test.quality || target != test.target {
+			t.Errorf("%q: expected %d and %g, got %d and %g", test.input, test.quality, test.target, quality, target)
+		}
+	}
+
+	for _, input := range []string{"", "0", "101", "high", "auto:", "auto:psnr=40", "auto:ssim=1", "auto:ssim=x"} {
+		if _, _, err := ParseQuality(input); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+func TestAutoQuality(t *testing.T) {
+	options := DefaultOptions()
+
+	// Without a target the quality is kept
+	if got, err := AutoQuality(noise(64, 64), "out.jpg", options); err != nil || got.Quality != 85 {
+		t.Errorf("Expected quality 85 without a target, got %d (%v)", got.Quality, err)
+	}
+
+	// A flat image needs a much lower quality than noise for the same target
+	options.TargetSSIM = 0.95
+	flat, err := AutoQuality(imaging.New(64, 64, color.NRGBA{90, 120, 200, 255}), "out.jpg", options)
+	if err != nil {
+		t.Fatalf("AutoQuality failed: %v", err)
+	}
+	noisy, err := AutoQuality(noise(64, 64), "out.jpg", options)
+	if err != nil {
+		t.Fatalf("AutoQuality failed: %v", err)
+	}
+	if flat.Quality >= noisy.Quality {
+		t.Errorf("Expected a lower quality for a flat image, got %d and %d for noise", flat.Quality, noisy.Quality)
+	}
+
+	// The chosen quality meets the target
+	ssim, err := encodedSSIM(noise(64, 64), noisy)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if noisy.Quality < 100 && ssim < options.TargetSSIM {
+		t.Errorf("Expected an SSIM of at least %g at quality %d, got %g", options.TargetSSIM, noisy.Quality, ssim)
+	}
+
+	// Lossless formats have no quality to choose
+	if got, err := AutoQuality(noise(64, 64), "out.png", options); err != nil || got.Quality != 85 {
+		t.Errorf("Expected PNG options unchanged, got quality %d (%v)", got.Quality, err)
+	}
+}
+
+// encodedSSIM encodes img as JPEG with options and compares the decoded result
+func encodedSSIM(img image.Image, options ProcessOptions) (float64, error) {
+	options.OutputFormat = "jpg"
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, options); err != nil {
+		return 0, err
+	}
+	decoded, err := decodeLossy(buf.Bytes(), "jpg")
+	if err != nil {
+		return 0, err
+	}
+	return compare.SSIM(img, decoded)
+}
@@ -0,0 +1,213 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// RawOptions controls how camera RAW files (DNG, CR2, NEF, ARW) are developed.
+// WhiteBalance and Demosaic require a build with LibRaw (-tags libraw); without
+// it the embedded JPEG preview is used and only Exposure is applied.
+type RawOptions struct {
+	WhiteBalance string  // White balance: camera, auto, or daylight
+	Exposure     float64 // Exposure correction in stops
+	Demosaic     string  // Demosaic algorithm: linear, vng, ppg, or ahd
+	HalfSize     bool    // Develop at half resolution for faster proofs
+}
+
+func init() {
+	RegisterCodec(Codec{
+		Name:       "Camera RAW",
+		Extensions: []string{"dng", "cr2", "nef", "arw"},
+		Decode: func(r io.Reader, options ProcessOptions) (image.Image, error) {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return nil, err
+			}
+			return decodeRaw(data, options.Raw)
+		},
+		CGO:  libRawEnabled,
+		Note: rawNote,
+	})
+}
+
+// tiffBlob is a byte range inside a TIFF-based file
+type tiffBlob struct {
+	offset int
+	length int
+}
+
+// ExtractRawPreview returns the largest decodable JPEG preview embedded in a
+// TIFF-based RAW file. Cameras store a full-size or near full-size preview in
+// DNG, CR2, NEF and ARW files, which makes this a fast path for proofs.
+func ExtractRawPreview(data []byte) (image.Image, error) {
+	blobs, err := findEmbeddedJPEGs(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Try the largest preview first; lossless JPEG raw data is skipped because
+	// the standard decoder rejects it
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].length > blobs[j].length })
+	for _, blob := range blobs {
+		img, err := jpeg.Decode(bytes.NewReader(data[blob.offset : blob.offset+blob.length]))
+		if err == nil {
+			return img, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no embedded JPEG preview found")
+}
+
+// findEmbeddedJPEGs walks every IFD of a TIFF structure, including SubIFDs and
+// the EXIF IFD, and collects JPEG streams referenced by it
+func findEmbeddedJPEGs(data []byte) ([]tiffBlob, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("file too short to be a RAW image")
+	}
+
+	var bo binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a TIFF-based RAW file")
+	}
+
+	var blobs []tiffBlob
+	addBlob := func(offset, length uint32) {
+		if length > 2 && uint64(offset)+uint64(length) <= uint64(len(data)) &&
+			data[offset] == 0xFF && data[offset+1] == 0xD8 {
+			blobs = append(blobs, tiffBlob{offset: int(offset), length: int(length)})
+		}
+	}
+
+	visited := make(map[uint32]bool)
+	queue := []uint32{bo.Uint32(data[4:8])}
+	for len(queue) > 0 {
+		offset := queue[0]
+		queue = queue[1:]
+		if offset == 0 || visited[offset] || uint64(offset)+2 > uint64(len(data)) {
+			continue
+		}
+		visited[offset] = true
+
+		count := int(bo.Uint16(data[offset:]))
+		end := int(offset) + 2 + count*12
+		if end+4 > len(data) {
+			continue
+		}
+
+		var jpegOffset, jpegLength, compression uint32
+		var stripOffsets, stripCounts []uint32
+		for i := 0; i < count; i++ {
+			entry := data[int(offset)+2+i*12:]
+			values := tiffValues(data, bo, entry)
+			if len(values) == 0 {
+				continue
+			}
+			switch bo.Uint16(entry) {
+			case 0x0103: // Compression
+				compression = values[0]
+			case 0x0111: // StripOffsets
+				stripOffsets = values
+			case 0x0117: // StripByteCounts
+				stripCounts = values
+			case 0x0201: // JPEGInterchangeFormat
+				jpegOffset = values[0]
+			case 0x0202: // JPEGInterchangeFormatLength
+				jpegLength = values[0]
+			case 0x014A, 0x8769: // SubIFDs, Exif IFD
+				queue = append(queue, values...)
+			}
+		}
+
+		if jpegOffset != 0 {
+			addBlob(jpegOffset, jpegLength)
+		}
+		// Old-style (6) and new-style (7) JPEG compression stored as a single strip
+		if (compression == 6 || compression == 7) && len(stripOffsets) == 1 && len(stripCounts) == 1 {
+			addBlob(stripOffsets[0], stripCounts[0])
+		}
+
+		queue = append(queue, bo.Uint32(data[end:]))
+	}
+
+	return blobs, nil
+}
+
+// tiffValues reads the SHORT, LONG or IFD values of a 12-byte IFD entry
+func tiffValues(data []byte, bo binary.ByteOrder, entry []byte) []uint32 {
+	var size int
+	switch bo.Uint16(entry[2:]) {
+	case 3: // SHORT
+		size = 2
+	case 4, 13: // LONG, IFD
+		size = 4
+	default:
+		return nil
+	}
+
+	count := int(bo.Uint32(entry[4:]))
+	if count <= 0 || count > 1024 {
+		return nil
+	}
+
+	raw := entry[8:12]
+	if count*size > 4 {
+		offset := int(bo.Uint32(entry[8:]))
+		if offset < 0 || offset+count*size > len(data) {
+			return nil
+		}
+		raw = data[offset : offset+count*size]
+	}
+
+	values := make([]uint32, count)
+	for i := range values {
+		if size == 2 {
+			values[i] = uint32(bo.Uint16(raw[i*2:]))
+		} else {
+			values[i] = bo.Uint32(raw[i*4:])
+		}
+	}
+	return values
+}
+
+// applyExposure brightens or darkens an image by the given number of stops,
+// scaling intensities in linear light
+func applyExposure(img image.Image, stops float64) *image.NRGBA {
+	gain := math.Pow(2, stops)
+	var lut [256]uint8
+	for i := range lut {
+		v := float64(i) / 255
+		// sRGB to linear
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		v = math.Min(v*gain, 1)
+		// Linear to sRGB
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+		lut[i] = uint8(math.Round(v * 255))
+	}
+
+	return imaging.AdjustFunc(img, func(c color.NRGBA) color.NRGBA {
+		return color.NRGBA{R: lut[c.R], G: lut[c.G], B: lut[c.B], A: c.A}
+	})
+}
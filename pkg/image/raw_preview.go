@@ -0,0 +1,27 @@
+//go:build !cgo || !libraw
+
+package image
+
+import (
+	"fmt"
+	"image"
+)
+
+// libRawEnabled reports whether RAW files are developed with LibRaw
+const libRawEnabled = false
+
+// rawNote describes the limits of RAW decoding without LibRaw
+const rawNote = "embedded previews only; build with -tags libraw to develop RAW data"
+
+// decodeRaw uses the embedded JPEG preview when nim is built without LibRaw
+func decodeRaw(data []byte, options RawOptions) (image.Image, error) {
+	img, err := ExtractRawPreview(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w (build with -tags libraw for full RAW decoding)", err)
+	}
+
+	if options.Exposure != 0 {
+		return applyExposure(img, options.Exposure), nil
+	}
+	return img, nil
+}
@@ -0,0 +1,92 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// buildRawFile creates a minimal little-endian TIFF structure with one IFD per
+// preview, each referencing its JPEG through JPEGInterchangeFormat tags
+func buildRawFile(t *testing.T, previews ...image.Image) []byte {
+	t.Helper()
+
+	var jpegs [][]byte
+	for _, preview := range previews {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, preview, nil); err != nil {
+			t.Fatalf("Failed to encode preview: %v", err)
+		}
+		jpegs = append(jpegs, buf.Bytes())
+	}
+
+	const ifdSize = 2 + 2*12 + 4
+	le := binary.LittleEndian
+	data := []byte{'I', 'I', 42, 0, 8, 0, 0, 0}
+	dataOffset := 8 + ifdSize*len(jpegs)
+	for i, j := range jpegs {
+		ifd := make([]byte, ifdSize)
+		le.PutUint16(ifd, 2)
+		le.PutUint16(ifd[2:], 0x0201)
+		le.PutUint16(ifd[4:], 4)
+		le.PutUint32(ifd[6:], 1)
+		le.PutUint32(ifd[10:], uint32(dataOffset))
+		le.PutUint16(ifd[14:], 0x0202)
+		le.PutUint16(ifd[16:], 4)
+		le.PutUint32(ifd[18:], 1)
+		le.PutUint32(ifd[22:], uint32(len(j)))
+		if i < len(jpegs)-1 {
+			le.PutUint32(ifd[26:], uint32(8+ifdSize*(i+1)))
+		}
+		data = append(data, ifd...)
+		dataOffset += len(j)
+	}
+	for _, j := range jpegs {
+		data = append(data, j...)
+	}
+	return data
+}
+
+func TestExtractRawPreview(t *testing.T) {
+	small, _ := createTestImage(16, 12, color.RGBA{255, 0, 0, 255})
+	large, _ := createTestImage(64, 48, color.RGBA{0, 0, 255, 255})
+
+	img, err := ExtractRawPreview(buildRawFile(t, small, large))
+	if err != nil {
+		t.Fatalf("ExtractRawPreview failed: %v", err)
+	}
+
+	// The largest preview wins
+	if img.Bounds().Dx() != 64 || img.Bounds().Dy() != 48 {
+		t.Errorf("Expected 64x48 preview, got %dx%d", img.Bounds().Dx(), img.Bounds().Dy())
+	}
+}
+
+func TestExtractRawPreviewInvalid(t *testing.T) {
+	if _, err := ExtractRawPreview([]byte("not a raw file")); err == nil {
+		t.Errorf("Expected an error for a non-TIFF file")
+	}
+
+	// A valid TIFF header without previews
+	empty := []byte{'I', 'I', 42, 0, 8, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if _, err := ExtractRawPreview(empty); err == nil {
+		t.Errorf("Expected an error for a file without previews")
+	}
+}
+
+func TestApplyExposure(t *testing.T) {
+	img, _ := createTestImage(2, 2, color.RGBA{64, 128, 0, 255})
+
+	brighter := applyExposure(img, 1).NRGBAAt(0, 0)
+	if brighter.R <= 64 || brighter.G <= 128 || brighter.B != 0 {
+		t.Errorf("Expected +1 EV to brighten, got %v", brighter)
+	}
+
+	darker := applyExposure(img, -1).NRGBAAt(0, 0)
+	if darker.R >= 64 || darker.G >= 128 {
+		t.Errorf("Expected -1 EV to darken, got %v", darker)
+	}
+}
@@ -0,0 +1,325 @@
+package image
+
+import (
+	"bytes"
+	"compress/lzw"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// Recovery describes an input that best-effort decoding recovered from a
+// truncated or corrupt file
+type Recovery struct {
+	Error  string `json:"error"`  // Decoding error that was recovered from
+	Rows   int    `json:"rows"`   // Rows decoded from the file; the others are filled with the pad color
+	Height int    `json:"height"` // Height of the image
+}
+
+// recoveredImage is an image partly filled in by best-effort decoding
+type recoveredImage struct {
+	*image.NRGBA
+	recovery Recovery
+}
+
+// Recovered reports whether img was recovered from a damaged file by
+// ProcessOptions.BestEffort decoding, and how much of it was
+func Recovered(img image.Image) (Recovery, bool) {
+	if r, ok := img.(*recoveredImage); ok {
+		return r.recovery, true
+	}
+	return Recovery{}, false
+}
+
+// WithRecovery returns img marked as recovered by best-effort decoding, for
+// decoders that recover images elsewhere, such as in a sandboxed process
+func WithRecovery(img *image.NRGBA, recovery Recovery) image.Image {
+	return &recoveredImage{img, recovery}
+}
+
+// recoverImage decodes as much of a damaged JPEG, PNG or GIF file as it can
+// after cause made the regular decoder fail. Rows it cannot decode are filled
+// with the pad color. It returns cause when nothing could be recovered.
+func recoverImage(filename, ext string, cause error, options ProcessOptions) (image.Image, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, cause
+	}
+	pad := options.PadColor
+
+	var img *image.NRGBA
+	var rows int
+	switch ext {
+	case "jpg", "jpeg":
+		img, rows, err = recoverJPEG(data, pad)
+	case "png":
+		img, rows, err = recoverPNG(data, pad)
+	case "gif":
+		img, rows, err = recoverGIF(data, pad)
+	default:
+		return nil, cause
+	}
+	if err != nil || rows == 0 {
+		slog.Debug("best-effort decoding recovered nothing", "file", filename, "reason", err)
+		return nil, cause
+	}
+
+	height := img.Bounds().Dy()
+	slog.Warn("recovered damaged image", "file", filename, "rows", fmt.Sprintf("%d/%d", rows, height), "error", cause)
+	return &recoveredImage{img, Recovery{Error: cause.Error(), Rows: rows, Height: height}}, nil
+}
+
+// fillRows sets rows y0 to y1 of img, counted from its top, to c
+func fillRows(img *image.NRGBA, y0, y1 int, c color.NRGBA) {
+	for y := y0; y < y1; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+img.Rect.Dx()*4]
+		for i := 0; i < len(row); i += 4 {
+			row[i], row[i+1], row[i+2], row[i+3] = c.R, c.G, c.B, c.A
+		}
+	}
+}
+
+// recoverPNG decodes the rows of a non-interlaced PNG up to the first one
+// that is truncated or corrupt
+func recoverPNG(data []byte, pad color.NRGBA) (*image.NRGBA, int, error) {
+	d, err := newPNGRowReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, err
+	}
+	size := d.size()
+	img := image.NewNRGBA(image.Rectangle{Max: size})
+	rows := 0
+	for ; rows < size.Y; rows++ {
+		if err := d.read(img.Pix[rows*img.Stride : rows*img.Stride+size.X*4]); err != nil {
+			break
+		}
+	}
+	fillRows(img, rows, size.Y, pad)
+	return img, rows, nil
+}
+
+// Errors the JPEG decoder returns when a scan ends early
+var (
+	jpegShortData = jpeg.FormatError("short Huffman data")
+	jpegMissingFF = jpeg.FormatError("missing 0xff00 sequence")
+)
+
+// recoverJPEG decodes the entropy-coded data of a JPEG up to where it is
+// truncated or corrupt. The decoder cannot stop early, so the data is cut
+// there and padded with filler bits until the scan is complete. Rows from
+// the first one that two different fillers decode differently are damaged.
+func recoverJPEG(data []byte, pad color.NRGBA) (*image.NRGBA, int, error) {
+	data = bytes.TrimSuffix(data, []byte{0xff, 0xd9})
+	start, err := jpegScanStart(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// decode decodes the first n bytes of data followed by filler, growing the
+	// filler until it completes the scan. A trailing 0xff would start a marker
+	// with the filler, so it is left out.
+	decode := func(n int, filler byte) (image.Image, error) {
+		for n > start && data[n-1] == 0xff {
+			n--
+		}
+		for size := max(n, 1<<16); size <= 64*max(len(data), 1<<20); size *= 4 {
+			buf := make([]byte, n+size+2)
+			copy(buf, data[:n])
+			for i := n; i < n+size; i++ {
+				buf[i] = filler
+			}
+			buf[n+size], buf[n+size+1] = 0xff, 0xd9
+			img, err := jpeg.Decode(bytes.NewReader(buf))
+			if err != jpegShortData && err != jpegMissingFF {
+				return img, err
+			}
+		}
+		return nil, jpegShortData
+	}
+
+	// Corrupt data fails to decode even when padded, so keep the longest
+	// prefix that decodes
+	n := len(data)
+	if _, err := decode(n, 0); err != nil {
+		if _, err := decode(start, 0); err != nil {
+			return nil, 0, err
+		}
+		n = start + sort.Search(len(data)-start, func(i int) bool {
+			_, err := decode(start+i+1, 0)
+			return err != nil
+		})
+	}
+
+	first, err := decode(n, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	img := imaging.Clone(first)
+	for _, filler := range []byte{0x55, 0xaa, 0x33} {
+		second, err := decode(n, filler)
+		if err != nil {
+			continue
+		}
+		other := imaging.Clone(second)
+		rows := 0
+		for ; rows < img.Rect.Dy(); rows++ {
+			i := rows * img.Stride
+			if !bytes.Equal(img.Pix[i:i+img.Stride], other.Pix[i:i+other.Stride]) {
+				break
+			}
+		}
+		fillRows(img, rows, img.Rect.Dy(), pad)
+		return img, rows, nil
+	}
+	return nil, 0, errors.New("failed to locate the damaged JPEG data")
+}
+
+// jpegScanStart returns the offset of the entropy-coded data of the first
+// scan of a JPEG, after the headers
+func jpegScanStart(data []byte) (int, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return 0, errors.New("not a JPEG file")
+	}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xff {
+			return 0, errors.New("corrupt JPEG headers")
+		}
+		marker := data[pos+1]
+		if marker == 0xff {
+			pos++
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		pos += 2 + length
+		if marker == 0xda {
+			if pos > len(data) {
+				break
+			}
+			return pos, nil
+		}
+	}
+	return 0, errors.New("truncated JPEG headers")
+}
+
+// recoverGIF decodes the first frame of a GIF, which is what the decoder
+// reads, up to where its image data is truncated or corrupt
+func recoverGIF(data []byte, pad color.NRGBA) (*image.NRGBA, int, error) {
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return nil, 0, errors.New("not a GIF file")
+	}
+	pos := 13
+	var global color.Palette
+	if flags := data[10]; flags&0x80 != 0 {
+		global, pos = gifPalette(data, pos, flags)
+	}
+
+	transparent := -1
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // Extension
+			if pos+7 <= len(data) && data[pos+1] == 0xf9 && data[pos+2] == 4 && data[pos+3]&1 != 0 {
+				transparent = int(data[pos+6])
+			}
+			pos += 2
+			for pos < len(data) && data[pos] != 0 {
+				pos += 1 + int(data[pos])
+			}
+			pos++
+		case 0x2c: // Image descriptor
+			if pos+11 > len(data) {
+				return nil, 0, errors.New("truncated GIF image descriptor")
+			}
+			left := int(binary.LittleEndian.Uint16(data[pos+1:]))
+			top := int(binary.LittleEndian.Uint16(data[pos+3:]))
+			width := int(binary.LittleEndian.Uint16(data[pos+5:]))
+			height := int(binary.LittleEndian.Uint16(data[pos+7:]))
+			flags := data[pos+9]
+			pos += 10
+			palette := global
+			if flags&0x80 != 0 {
+				palette, pos = gifPalette(data, pos, flags)
+			}
+			if len(palette) == 0 || width == 0 || height == 0 || pos >= len(data) {
+				return nil, 0, errors.New("corrupt GIF image descriptor")
+			}
+			litWidth := int(data[pos])
+			if litWidth < 2 || litWidth > 8 {
+				return nil, 0, fmt.Errorf("invalid GIF code size %d", litWidth)
+			}
+			pos++
+
+			var compressed bytes.Buffer
+			for pos < len(data) && data[pos] != 0 {
+				end := min(pos+1+int(data[pos]), len(data))
+				compressed.Write(data[pos+1 : end])
+				pos = end
+			}
+			pix := make([]byte, width*height)
+			n, _ := io.ReadFull(lzw.NewReader(&compressed, lzw.LSB, litWidth), pix)
+
+			img := image.NewNRGBA(image.Rect(left, top, left+width, top+height))
+			order := gifRowOrder(height, flags&0x40 != 0)
+			rows := n / width
+			for i, y := range order {
+				if i >= rows {
+					fillRows(img, y, y+1, pad)
+					continue
+				}
+				for x := range width {
+					index := int(pix[i*width+x])
+					c := color.NRGBA{A: 255}
+					if index == transparent {
+						c = color.NRGBA{}
+					} else if index < len(palette) {
+						c = color.NRGBAModel.Convert(palette[index]).(color.NRGBA)
+					}
+					img.SetNRGBA(left+x, top+y, c)
+				}
+			}
+			return img, rows, nil
+		default:
+			return nil, 0, fmt.Errorf("corrupt GIF: invalid block 0x%02x", data[pos])
+		}
+	}
+	return nil, 0, errors.New("truncated GIF: no image data")
+}
+
+// gifPalette reads the color table at pos whose size is in flags, and returns
+// the position after it
+func gifPalette(data []byte, pos int, flags byte) (color.Palette, int) {
+	size := 1 << (flags&7 + 1)
+	palette := make(color.Palette, 0, size)
+	for i := 0; i < size && pos+3 <= len(data); i++ {
+		palette = append(palette, color.RGBA{data[pos], data[pos+1], data[pos+2], 255})
+		pos += 3
+	}
+	return palette, pos
+}
+
+// gifRowOrder returns the rows of a GIF frame in the order they are stored:
+// top to bottom, or in the four passes of an interlaced frame
+func gifRowOrder(height int, interlaced bool) []int {
+	order := make([]int, 0, height)
+	if !interlaced {
+		for y := range height {
+			order = append(order, y)
+		}
+		return order
+	}
+	for _, pass := range [][2]int{{0, 8}, {4, 8}, {2, 4}, {1, 2}} {
+		for y := pass[0]; y < height; y += pass[1] {
+			order = append(order, y)
+		}
+	}
+	return order
+}
@@ -0,0 +1,78 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBestEffort(t *testing.T) {
+	src := gradient(64, 48)
+	tests := map[string]func(io.Writer, image.Image) error{
+		"png": png.Encode,
+		"jpg": func(w io.Writer, img image.Image) error { return jpeg.Encode(w, img, &jpeg.Options{Quality: 90}) },
+		"gif": func(w io.Writer, img image.Image) error { return gif.Encode(w, img, nil) },
+	}
+	for ext, encode := range tests {
+		t.Run(ext, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encode(&buf, src); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "truncated."+ext)
+			os.WriteFile(path, buf.Bytes()[:buf.Len()*6/10], 0o644)
+
+			if _, err := OpenImageWithOptions(path, DefaultOptions()); err == nil {
+				t.Fatal("expected the truncated file to fail to decode")
+			}
+			options := DefaultOptions()
+			options.BestEffort = true
+			options.PadColor = color.NRGBA{255, 0, 255, 255}
+			img, err := OpenImageWithOptions(path, options)
+			if err != nil {
+				t.Fatalf("best-effort decoding failed: %v", err)
+			}
+			recovery, ok := Recovered(img)
+			if !ok {
+				t.Fatal("expected the image to be marked as recovered")
+			}
+			if recovery.Height != 48 || recovery.Rows == 0 || recovery.Rows >= 48 || recovery.Error == "" {
+				t.Errorf("unexpected recovery %+v", recovery)
+			}
+			if got := color.NRGBAModel.Convert(img.At(10, 47)); got != (color.NRGBA{255, 0, 255, 255}) {
+				t.Errorf("expected the missing rows in the pad color, got %v", got)
+			}
+			if got := color.NRGBAModel.Convert(img.At(10, 0)).(color.NRGBA); got.R == 255 && got.B == 255 {
+				t.Errorf("expected the first row to be decoded, got %v", got)
+			}
+		})
+	}
+}
+
+func TestBestEffortCorruptJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, gradient(64, 64), &jpeg.Options{Quality: 90})
+	data := buf.Bytes()
+	start, err := jpegScanStart(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A marker in the middle of the scan makes the decoder fail
+	mid := start + (len(data)-start)/2
+	data[mid], data[mid+1] = 0xff, 0xc4
+
+	img, rows, err := recoverJPEG(data, color.NRGBA{A: 255})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows == 0 || rows >= 64 || img.Bounds().Dy() != 64 {
+		t.Errorf("expected part of the rows to be recovered, got %d", rows)
+	}
+}
@@ -0,0 +1,538 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+
+	"nim/pkg/resample"
+)
+
+// StreamFormats are the input and output formats ProcessStreaming reads and
+// writes a row at a time
+var StreamFormats = []string{"png", "tiff", "tif"}
+
+// rowReader reads the rows of an image from top to bottom
+type rowReader interface {
+	// size returns the dimensions of the image
+	size() image.Point
+	// opaque reports whether every pixel of the image is opaque
+	opaque() bool
+	// read fills row with the next row as 8-bit NRGBA
+	read(row []byte) error
+}
+
+// rowWriter writes the rows of an image from top to bottom
+type rowWriter interface {
+	// write writes the next row, as 8-bit NRGBA
+	write(row []byte) error
+	// close finishes the file after the last row
+	close() error
+}
+
+// openRowReader opens a PNG or TIFF input for reading a row at a time. The
+// file is closed with the returned closer.
+func openRowReader(filename string, options ProcessOptions) (rowReader, io.Closer, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	var r rowReader
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), ".")); ext {
+	case "png":
+		r, err = newPNGRowReader(file)
+	case "tiff", "tif":
+		r, err = newTIFFRowReader(file, options.Page)
+	default:
+		err = fmt.Errorf("%s images cannot be streamed (expected PNG or TIFF)", ext)
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, withKind(ErrDecode, err)
+	}
+	return r, file, nil
+}
+
+// RowReader reads an image a row at a time, from top to bottom, as 8-bit
+// NRGBA
+type RowReader struct {
+	r      rowReader
+	closer io.Closer
+}
+
+// OpenRows opens an image to read it a row at a time. PNG and TIFF inputs are
+// decoded as their rows are read, so they may be larger than memory; other
+// formats, and every input with a decoder set by SetDecoder, are decoded
+// whole first.
+func OpenRows(filename string, options ProcessOptions) (*RowReader, error) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if decoder == nil && options.Frame == 0 && slices.Contains(StreamFormats, ext) {
+		endDecode := options.Hooks.Start(StageDecode)
+		r, closer, err := openRowReader(filename, options)
+		endDecode()
+		if err != nil {
+			return nil, err
+		}
+		return &RowReader{r: r, closer: closer}, nil
+	}
+	img, err := OpenImageWithOptions(filename, options)
+	if err != nil {
+		return nil, err
+	}
+	return &RowReader{r: &imageRowReader{img: imaging.Clone(img)}}, nil
+}
+
+// Size returns the dimensions of the image
+func (r *RowReader) Size() image.Point {
+	return r.r.size()
+}
+
+// Opaque reports whether every pixel of the image is opaque
+func (r *RowReader) Opaque() bool {
+	return r.r.opaque()
+}
+
+// Read fills row, 4 bytes per pixel, with the next row
+func (r *RowReader) Read(row []byte) error {
+	return r.r.read(row)
+}
+
+// Close closes the file of the image
+func (r *RowReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// StreamingSize returns the size of a PNG or TIFF input if decoding all of it
+// would take more than options.MaxMemory, so ProcessStreaming should be used
+// instead, or false otherwise
+func StreamingSize(filename string, options ProcessOptions) (image.Point, bool) {
+	if options.MaxMemory <= 0 || options.Rotate != 0 || options.Frame != 0 {
+		return image.Point{}, false
+	}
+	r, closer, err := openRowReader(filename, options)
+	if err != nil {
+		return image.Point{}, false
+	}
+	defer closer.Close()
+	size := r.size()
+	return size, int64(size.X)*int64(size.Y)*4 > options.MaxMemory
+}
+
+// ProcessStreaming crops and resizes a PNG or TIFF input like Process, but
+// reads, resizes and writes it a row at a time, so images far larger than
+// memory can be processed. Outputs that fit in options.MaxMemory are encoded
+// like Process does, in any format; larger ones are written a row at a time
+// too, as PNG or TIFF. Automatic quality and byte budgets, which encode the
+// output more than once, are not supported, and 16-bit inputs are read as
+// 8-bit.
+func ProcessStreaming(inputPath, outputPath string, options ProcessOptions) (Result, error) {
+	start := time.Now()
+	if options.TargetSSIM > 0 || options.MaxBytes > 0 {
+		return Result{}, fmt.Errorf("automatic quality and byte budgets are not supported when streaming")
+	}
+	endDecode := options.Hooks.Start(StageDecode)
+	r, closer, err := openRowReader(inputPath, options)
+	endDecode()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to open image: %w", err)
+	}
+	defer closer.Close()
+	size := r.size()
+
+	format := outputFormat(outputPath, options)
+	options.OutputFormat = format
+	plan, err := planStream(size, options)
+	if err != nil {
+		return Result{}, err
+	}
+	slog.Info("streaming image", "file", inputPath, "size", fmt.Sprintf("%dx%d", size.X, size.Y),
+		"resized", fmt.Sprintf("%dx%d", plan.resized.X, plan.resized.Y), "output", fmt.Sprintf("%dx%d", plan.output.Dx(), plan.output.Dy()))
+
+	buffered := int64(plan.output.Dx())*int64(plan.output.Dy())*4 <= options.MaxMemory
+	if !buffered && !slices.Contains(StreamFormats, format) {
+		return Result{}, fmt.Errorf("the %dx%d output does not fit in --max-memory: write it as PNG or TIFF",
+			plan.output.Dx(), plan.output.Dy())
+	}
+
+	out, err := createOutput(outputPath, options)
+	if err != nil {
+		return Result{}, err
+	}
+	defer out.Close()
+
+	// Small outputs are collected and encoded whole, with every option
+	var w rowWriter
+	var collected *image.NRGBA
+	if buffered {
+		collected = image.NewNRGBA(image.Rectangle{Max: plan.output.Size()})
+		w = &imageRowWriter{img: collected}
+	} else if opaque := r.opaque() && plan.pad.A == 255; format == "png" {
+		w, err = newPNGRowWriter(out, plan.output.Size(), opaque, options)
+	} else {
+		w, err = newTIFFRowWriter(out, plan.output.Size(), opaque, options)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	// The rows are decoded, resized and written together
+	endResize := options.Hooks.Start(OperationResize)
+	err = plan.run(r, w, newProgressCounter(options.Hooks, OperationResize, plan.source.Max.Y))
+	endResize()
+	if err != nil {
+		return Result{}, err
+	}
+	if collected != nil {
+		endEncode := options.Hooks.Start(StageEncode)
+		err := Encode(out, collected, options)
+		endEncode()
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	outputPath, digest, err := out.Commit()
+	if err != nil {
+		return Result{}, err
+	}
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read output file: %w", err)
+	}
+	slog.Info("wrote image", "file", outputPath, "format", format, "duration", time.Since(start))
+
+	return Result{
+		Input:          inputPath,
+		Output:         outputPath,
+		InputFormat:    strings.ToLower(strings.TrimPrefix(filepath.Ext(inputPath), ".")),
+		OutputFormat:   format,
+		OriginalWidth:  size.X,
+		OriginalHeight: size.Y,
+		Width:          plan.output.Dx(),
+		Height:         plan.output.Dy(),
+		Bytes:          info.Size(),
+		Hash:           digest,
+		Duration:       time.Since(start),
+	}, nil
+}
+
+// streamPlan describes the crop and resize operations of ProcessStreaming as
+// windows on the rows of the source and of the resized image
+type streamPlan struct {
+	source  image.Rectangle // Region of the source that is resized
+	resized image.Point     // Size the source region is resized to
+	canvas  image.Point     // Size after padding, with the resized image centered
+	output  image.Rectangle // Region of the canvas that is written
+	pad     color.NRGBA
+}
+
+// planStream works out the windows that crop and resize an image of size
+// like Transform does
+func planStream(size image.Point, options ProcessOptions) (streamPlan, error) {
+	plan := streamPlan{source: image.Rectangle{Max: size}, pad: padColor(options)}
+	order := options.Order
+	if len(order) == 0 {
+		order = DefaultOrder
+	}
+	resized := false
+	for _, operation := range order {
+		switch operation {
+		case OperationCrop:
+			if options.Crop.Empty() {
+				continue
+			}
+			// Before the resize, the crop selects part of the source, and
+			// after it, part of the padded canvas
+			area := plan.source.Size()
+			if resized {
+				area = plan.canvas
+				if !plan.output.Empty() {
+					area = plan.output.Size()
+				}
+			}
+			if !options.Crop.In(image.Rectangle{Max: area}) {
+				return plan, fmt.Errorf("crop region %dx%d+%d+%d is outside the %dx%d image",
+					options.Crop.Dx(), options.Crop.Dy(), options.Crop.Min.X, options.Crop.Min.Y, area.X, area.Y)
+			}
+			if resized {
+				plan.output = options.Crop.Add(plan.output.Min)
+			} else {
+				plan.source = options.Crop.Add(plan.source.Min)
+			}
+		case OperationResize:
+			if err := plan.resize(options); err != nil {
+				return plan, err
+			}
+			resized = true
+		default:
+			return plan, fmt.Errorf("unknown operation: %s", operation)
+		}
+	}
+	if !resized {
+		plan.resized = plan.source.Size()
+		plan.canvas = plan.resized
+	}
+	if plan.output.Empty() {
+		plan.output = image.Rectangle{Max: plan.canvas}
+	}
+	return plan, nil
+}
+
+// resize sets the resized and canvas sizes of the plan like Resize does,
+// narrowing the source to the center for ResizeModeFill
+func (p *streamPlan) resize(options ProcessOptions) error {
+	src := p.source.Size()
+	width, height := options.Width, options.Height
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid size: %dx%d", width, height)
+	}
+	switch options.ResizeMode {
+	case ResizeModeFit:
+		// imaging.Fit truncates the other side
+		p.resized = src
+		if src.X > width || src.Y > height {
+			if src.X*height > src.Y*width {
+				p.resized = image.Pt(width, max(1, int(float64(width)*float64(src.Y)/float64(src.X))))
+			} else {
+				p.resized = image.Pt(max(1, int(float64(height)*float64(src.X)/float64(src.Y))), height)
+			}
+		}
+		p.canvas = image.Pt(max(width, p.resized.X), max(height, p.resized.Y))
+	case ResizeModeFill:
+		p.resized = image.Pt(width, height)
+		p.canvas = p.resized
+		if src.X >= 100 && src.Y >= 100 {
+			// Like imaging.Fill, the centered part of the source with the
+			// aspect ratio of the output is resized
+			crop := src
+			if src.X*height < src.Y*width {
+				crop.Y = int(max(1, float64(src.X)*float64(height)/float64(width)) + 0.5)
+			} else {
+				crop.X = int(max(1, float64(src.Y)*float64(width)/float64(height)) + 0.5)
+			}
+			min := p.source.Min.Add(src.Sub(crop).Div(2))
+			p.source = image.Rectangle{Min: min, Max: min.Add(crop)}
+			break
+		}
+		// and small sources are resized before the center is cropped
+		if src.X*height < src.Y*width {
+			p.resized.Y = max(1, int(math.Floor(float64(width)*float64(src.Y)/float64(src.X)+0.5)))
+		} else {
+			p.resized.X = max(1, int(math.Floor(float64(height)*float64(src.X)/float64(src.Y)+0.5)))
+		}
+		p.canvas = p.resized
+		min := p.canvas.Sub(image.Pt(width, height)).Div(2)
+		p.output = image.Rectangle{Min: min, Max: min.Add(image.Pt(width, height))}
+	case ResizeModeStretch:
+		p.resized = image.Pt(width, height)
+		p.canvas = p.resized
+	case ResizeModeLiquid:
+		return fmt.Errorf("liquid resizing is not supported when streaming")
+	default:
+		return fmt.Errorf("unknown resize mode: %s", options.ResizeMode)
+	}
+	return nil
+}
+
+// run reads the source rows from r, resizes, pads and crops them, and writes
+// the output rows to w, counting the source rows read in progress
+func (p *streamPlan) run(r rowReader, w rowWriter, progress *progressCounter) error {
+	size := r.size()
+	canvasY := 0
+	offset := p.canvas.Sub(p.resized).Div(2)
+	canvasRow := make([]byte, p.canvas.X*4)
+	padRow := make([]byte, p.canvas.X*4)
+	for i := 0; i < len(padRow); i += 4 {
+		copy(padRow[i:], []byte{p.pad.R, p.pad.G, p.pad.B, p.pad.A})
+	}
+
+	// Rows of the canvas outside the output window are dropped
+	emit := func(row []byte) error {
+		y := canvasY
+		canvasY++
+		if y < p.output.Min.Y || y >= p.output.Max.Y {
+			return nil
+		}
+		return w.write(row[p.output.Min.X*4 : p.output.Max.X*4])
+	}
+	padding := func(rows int) error {
+		for range rows {
+			if err := emit(padRow); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	place := func(row []byte) error {
+		copy(canvasRow, padRow)
+		copy(canvasRow[offset.X*4:], row)
+		return emit(canvasRow)
+	}
+
+	if err := padding(offset.Y); err != nil {
+		return err
+	}
+	var resizer *streamResizer
+	if p.resized != p.source.Size() {
+		resizer = newStreamResizer(p.source.Size(), p.resized, place)
+	}
+	row := make([]byte, size.X*4)
+	for y := 0; y < p.source.Max.Y; y++ {
+		progress.set(y)
+		if err := r.read(row); err != nil {
+			return withKind(ErrDecode, fmt.Errorf("failed to decode image: %w", err))
+		}
+		if y < p.source.Min.Y {
+			continue
+		}
+		window := row[p.source.Min.X*4 : p.source.Max.X*4]
+		var err error
+		if resizer != nil {
+			err = resizer.push(window)
+		} else {
+			err = place(window)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := padding(p.canvas.Y - offset.Y - p.resized.Y); err != nil {
+		return err
+	}
+	progress.set(p.source.Max.Y)
+	return w.close()
+}
+
+// streamResizer resizes an image a row at a time. Each source row is resized
+// horizontally and added to the resized rows whose filters cover it, and a
+// resized row is finished once its last source row is added, so only a few
+// rows are kept whatever the image size. Like imaging, the horizontal pass
+// is rounded to 8 bits before the vertical one.
+type streamResizer struct {
+	horizontal, vertical resample.Weights
+	y                    int         // Next source row
+	first                int         // First resized row not yet finished
+	pending              [][]float64 // Premultiplied sums of the rows from first
+	free                 [][]float64
+	sums                 []float64 // Premultiplied sums of the source row resized horizontally
+	row                  []byte    // The same, as 8-bit NRGBA
+	out                  []byte
+	emit                 func(row []byte) error
+}
+
+// newStreamResizer returns a resizer from src to dst that passes the resized
+// rows to emit. Dimensions that keep their size are not filtered.
+func newStreamResizer(src, dst image.Point, emit func(row []byte) error) *streamResizer {
+	s := &streamResizer{emit: emit}
+	if src.X != dst.X {
+		s.horizontal = resample.Lanczos(dst.X, src.X)
+		s.sums = make([]float64, dst.X*4)
+		s.row = make([]byte, dst.X*4)
+	}
+	if src.Y != dst.Y {
+		s.vertical = resample.Lanczos(dst.Y, src.Y)
+		s.out = make([]byte, dst.X*4)
+	}
+	return s
+}
+
+// push adds the next source row, as 8-bit NRGBA
+func (s *streamResizer) push(src []byte) error {
+	row := src
+	if s.row != nil {
+		resample.DotRow(s.sums, src, s.horizontal)
+		resample.Store(s.row, s.sums)
+		row = s.row
+	}
+	if s.out == nil {
+		return s.emit(row)
+	}
+
+	y := s.y
+	s.y++
+	for i := s.first; i < len(s.vertical.Start) && s.vertical.Start[i] <= y; i++ {
+		if i-s.first == len(s.pending) {
+			s.pending = append(s.pending, s.newSum())
+		}
+		weights := s.vertical.Values[i]
+		if k := y - s.vertical.Start[i]; k < len(weights) {
+			resample.Accumulate(s.pending[i-s.first], row, weights[k])
+		}
+	}
+
+	// Finish the rows whose last source row this was
+	for s.first < len(s.vertical.Start) && s.vertical.Start[s.first]+len(s.vertical.Values[s.first]) <= y+1 {
+		sum := s.pending[0]
+		resample.Store(s.out, sum)
+		s.free = append(s.free, sum)
+		s.pending = s.pending[1:]
+		s.first++
+		if err := s.emit(s.out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newSum returns a cleared row of sums, reusing a finished one if possible
+func (s *streamResizer) newSum() []float64 {
+	if n := len(s.free); n > 0 {
+		sum := s.free[n-1]
+		s.free = s.free[:n-1]
+		clear(sum)
+		return sum
+	}
+	return make([]float64, len(s.out))
+}
+
+// imageRowReader reads the rows of a decoded image
+type imageRowReader struct {
+	img *image.NRGBA
+	y   int
+}
+
+func (r *imageRowReader) size() image.Point {
+	return r.img.Rect.Size()
+}
+
+func (r *imageRowReader) opaque() bool {
+	return r.img.Opaque()
+}
+
+func (r *imageRowReader) read(row []byte) error {
+	if r.y >= r.img.Rect.Dy() {
+		return io.ErrUnexpectedEOF
+	}
+	start := r.y * r.img.Stride
+	copy(row, r.img.Pix[start:start+r.img.Rect.Dx()*4])
+	r.y++
+	return nil
+}
+
+// imageRowWriter collects rows into an image
+type imageRowWriter struct {
+	img *image.NRGBA
+	y   int
+}
+
+func (w *imageRowWriter) write(row []byte) error {
+	copy(w.img.Pix[w.y*w.img.Stride:], row)
+	w.y++
+	return nil
+}
+
+func (w *imageRowWriter) close() error {
+	return nil
+}
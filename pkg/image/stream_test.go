@@ -0,0 +1,107 @@
+package image
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"nim/pkg/compare"
+)
+
+func TestProcessStreaming(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.png")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, noiseAlpha(300, 200))
+	f.Close()
+
+	for name, options := range map[string]ProcessOptions{
+		"fit":         {Width: 100, Height: 100, ResizeMode: ResizeModeFit, PadColor: color.NRGBA{255, 0, 0, 255}},
+		"fill":        {Width: 50, Height: 80, ResizeMode: ResizeModeFill},
+		"stretch":     {Width: 320, Height: 40, ResizeMode: ResizeModeStretch},
+		"crop first":  {Width: 40, Height: 40, ResizeMode: ResizeModeFit, Crop: image.Rect(10, 20, 110, 70)},
+		"crop second": {Width: 100, Height: 100, ResizeMode: ResizeModeFit, Crop: image.Rect(0, 10, 60, 90), Order: []string{OperationResize, OperationCrop}},
+		"crop only":   {Width: 100, Height: 100, Crop: image.Rect(5, 5, 25, 15), Order: []string{OperationCrop}},
+	} {
+		for _, format := range []string{"png", "tiff", "gif"} {
+			expected := filepath.Join(dir, "expected."+format)
+			if _, err := Process(input, expected, options); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			// A limit below the input streams it; the GIF output is small
+			// enough to be encoded whole
+			options.MaxMemory = 300 * 200
+			output := filepath.Join(dir, "out."+format)
+			result, err := Process(input, output, options)
+			options.MaxMemory = 0
+			if err != nil {
+				t.Fatalf("%s to %s: %v", name, format, err)
+			}
+			a, _ := OpenImage(expected)
+			b, _ := OpenImage(output)
+			if result.OriginalWidth != 300 || result.Width != b.Bounds().Dx() || result.Height != b.Bounds().Dy() {
+				t.Errorf("%s to %s: result %+v", name, format, result)
+			}
+			diff, err := compare.Compare(a, b)
+			if err != nil {
+				t.Fatalf("%s to %s: %v", name, format, err)
+			}
+			if diff.PSNR < 40 {
+				t.Errorf("%s to %s: PSNR %.1f dB", name, format, diff.PSNR)
+			}
+		}
+	}
+
+	options := ProcessOptions{Width: 100, Height: 100, ResizeMode: ResizeModeFit, MaxMemory: 1000, MaxBytes: 1000}
+	if _, err := Process(input, filepath.Join(dir, "out.jpg"), options); err == nil {
+		t.Error("expected an error for a byte budget")
+	}
+	options = ProcessOptions{Width: 1000, Height: 1000, ResizeMode: ResizeModeStretch, MaxMemory: 1000}
+	if _, err := Process(input, filepath.Join(dir, "out.jpg"), options); err == nil {
+		t.Error("expected an error for a large JPEG output")
+	}
+}
+
+func TestOpenRows(t *testing.T) {
+	dir := t.TempDir()
+	src := noiseAlpha(30, 20)
+	for _, name := range []string{"in.png", "in.bmp"} {
+		input := filepath.Join(dir, name)
+		f, err := os.Create(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Encode(f, src, ProcessOptions{OutputFormat: filepath.Ext(name)[1:]}); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		// PNG is streamed, BMP is decoded whole; both read the same rows
+		r, err := OpenRows(input, DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Size() != image.Pt(30, 20) {
+			t.Errorf("%s: expected 30x20, got %v", name, r.Size())
+		}
+		row := make([]byte, 30*4)
+		for y := range 20 {
+			if err := r.Read(row); err != nil {
+				t.Fatalf("%s: row %d: %v", name, y, err)
+			}
+			if want := src.Pix[y*src.Stride : y*src.Stride+30*4]; string(row) != string(want) {
+				t.Fatalf("%s: row %d differs", name, y)
+			}
+		}
+		if err := r.Read(row); err == nil {
+			t.Errorf("%s: expected an error after the last row", name)
+		}
+		r.Close()
+	}
+}
@@ -0,0 +1,369 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"slices"
+	"strings"
+)
+
+// pngRowReader decodes the rows of a PNG as they are read, with no more of
+// the file in memory than two rows
+type pngRowReader struct {
+	width, height int
+	depth         int
+	colorType     byte
+	palette       [][4]byte
+	transparent   []byte // tRNS value of gray and RGB images, at their depth
+	zr            io.ReadCloser
+	cur, prev     []byte
+	bpp           int // Bytes per complete pixel, at least 1
+}
+
+func newPNGRowReader(r io.Reader) (*pngRowReader, error) {
+	br := bufio.NewReader(r)
+	var signature [8]byte
+	if _, err := io.ReadFull(br, signature[:]); err != nil || !bytes.Equal(signature[:], pngSignature) {
+		return nil, fmt.Errorf("not a PNG file")
+	}
+
+	d := &pngRowReader{}
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return nil, fmt.Errorf("truncated PNG chunk")
+		}
+		length, name := binary.BigEndian.Uint32(header[:]), string(header[4:])
+		if name == "IDAT" {
+			if d.width == 0 {
+				return nil, fmt.Errorf("corrupt PNG: image data before the header")
+			}
+			zr, err := zlib.NewReader(&pngIDATReader{r: br, remaining: length})
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress PNG data: %w", err)
+			}
+			d.zr = zr
+			return d, nil
+		}
+		if length > 1<<24 {
+			return nil, fmt.Errorf("PNG %s chunk too large: %d bytes", name, length)
+		}
+		data := make([]byte, length+4) // With the CRC
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, fmt.Errorf("truncated PNG chunk")
+		}
+		data = data[:length]
+		switch name {
+		case "IHDR":
+			if err := d.readHeader(data); err != nil {
+				return nil, err
+			}
+		case "PLTE":
+			for i := 0; i+3 <= len(data); i += 3 {
+				d.palette = append(d.palette, [4]byte{data[i], data[i+1], data[i+2], 255})
+			}
+		case "tRNS":
+			if d.colorType == pngPalette {
+				for i, a := range data {
+					if i < len(d.palette) {
+						d.palette[i][3] = a
+					}
+				}
+			} else {
+				d.transparent = data
+			}
+		case "IEND":
+			return nil, fmt.Errorf("corrupt PNG: no image data")
+		}
+	}
+}
+
+// readHeader reads the IHDR chunk and allocates the rows
+func (d *pngRowReader) readHeader(data []byte) error {
+	if len(data) < 13 {
+		return fmt.Errorf("corrupt PNG: invalid header")
+	}
+	d.width = int(binary.BigEndian.Uint32(data[0:]))
+	d.height = int(binary.BigEndian.Uint32(data[4:]))
+	d.depth, d.colorType = int(data[8]), data[9]
+	if d.width <= 0 || d.height <= 0 || d.width > math.MaxInt32/8 {
+		return fmt.Errorf("invalid PNG dimensions: %dx%d", d.width, d.height)
+	}
+	if data[12] != 0 {
+		return fmt.Errorf("interlaced PNGs cannot be streamed")
+	}
+	channels := map[byte]int{pngGray: 1, pngRGB: 3, pngPalette: 1, pngGrayAlpha: 2, pngRGBA: 4}[d.colorType]
+	valid := map[byte][]int{
+		pngGray: {1, 2, 4, 8, 16}, pngRGB: {8, 16}, pngPalette: {1, 2, 4, 8}, pngGrayAlpha: {8, 16}, pngRGBA: {8, 16},
+	}[d.colorType]
+	if channels == 0 || !slices.Contains(valid, d.depth) {
+		return fmt.Errorf("unsupported PNG color type %d with %d bits", d.colorType, d.depth)
+	}
+	bits := channels * d.depth
+	d.bpp = max(1, bits/8)
+	d.cur = make([]byte, 1+(d.width*bits+7)/8)
+	d.prev = make([]byte, len(d.cur))
+	return nil
+}
+
+func (d *pngRowReader) size() image.Point {
+	return image.Pt(d.width, d.height)
+}
+
+func (d *pngRowReader) opaque() bool {
+	switch d.colorType {
+	case pngGrayAlpha, pngRGBA:
+		return false
+	case pngPalette:
+		for _, c := range d.palette {
+			if c[3] != 255 {
+				return false
+			}
+		}
+		return true
+	}
+	return d.transparent == nil
+}
+
+func (d *pngRowReader) read(row []byte) error {
+	if _, err := io.ReadFull(d.zr, d.cur); err != nil {
+		return fmt.Errorf("truncated PNG data: %w", err)
+	}
+	if err := pngUnfilterRow(d.cur[1:], d.prev[1:], d.bpp, d.cur[0]); err != nil {
+		return err
+	}
+	d.cur, d.prev = d.prev, d.cur
+	data := d.prev[1:]
+
+	sample16 := func(i int) uint16 { return binary.BigEndian.Uint16(data[i*2:]) }
+	for x := 0; x < d.width; x++ {
+		p := row[x*4 : x*4+4]
+		switch {
+		case d.depth < 8:
+			// Packed samples, most significant bits first
+			perByte := 8 / d.depth
+			v := int(data[x/perByte]>>(8-d.depth*(x%perByte+1))) & (1<<d.depth - 1)
+			if d.colorType == pngPalette {
+				copy(p, d.paletteColor(v))
+				continue
+			}
+			g := byte(v * 255 / (1<<d.depth - 1))
+			p[0], p[1], p[2], p[3] = g, g, g, 255
+			if len(d.transparent) >= 2 && int(binary.BigEndian.Uint16(d.transparent)) == v {
+				p[3] = 0
+			}
+		case d.colorType == pngPalette:
+			copy(p, d.paletteColor(int(data[x])))
+		case d.colorType == pngGray:
+			g, v := data[x*d.bpp], 0
+			if d.depth == 16 {
+				v = int(sample16(x))
+			} else {
+				v = int(g)
+			}
+			p[0], p[1], p[2], p[3] = g, g, g, 255
+			if len(d.transparent) >= 2 && int(binary.BigEndian.Uint16(d.transparent)) == v {
+				p[3] = 0
+			}
+		case d.colorType == pngRGB:
+			step := d.depth / 8
+			i := x * d.bpp
+			p[0], p[1], p[2], p[3] = data[i], data[i+step], data[i+2*step], 255
+			if len(d.transparent) >= 6 {
+				match := true
+				for c := range 3 {
+					v := int(data[i+c*step])
+					if d.depth == 16 {
+						v = int(sample16(x*3 + c))
+					}
+					match = match && int(binary.BigEndian.Uint16(d.transparent[c*2:])) == v
+				}
+				if match {
+					p[3] = 0
+				}
+			}
+		case d.colorType == pngGrayAlpha:
+			step := d.depth / 8
+			i := x * d.bpp
+			p[0], p[1], p[2], p[3] = data[i], data[i], data[i], data[i+step]
+		default:
+			step := d.depth / 8
+			i := x * d.bpp
+			p[0], p[1], p[2], p[3] = data[i], data[i+step], data[i+2*step], data[i+3*step]
+		}
+	}
+	return nil
+}
+
+// paletteColor returns a palette entry, or opaque black for indices beyond
+// the palette
+func (d *pngRowReader) paletteColor(i int) []byte {
+	if i < len(d.palette) {
+		return d.palette[i][:]
+	}
+	return []byte{0, 0, 0, 255}
+}
+
+// pngUnfilterRow reverses the filter type t of a row in place, given the
+// previous unfiltered row
+func pngUnfilterRow(cur, prev []byte, bpp int, t byte) error {
+	switch t {
+	case 0:
+	case 1:
+		for i := bpp; i < len(cur); i++ {
+			cur[i] += cur[i-bpp]
+		}
+	case 2:
+		for i := range cur {
+			cur[i] += prev[i]
+		}
+	case 3:
+		for i := range cur {
+			var a int
+			if i >= bpp {
+				a = int(cur[i-bpp])
+			}
+			cur[i] += byte((a + int(prev[i])) / 2)
+		}
+	case 4:
+		for i := range cur {
+			var a, c byte
+			if i >= bpp {
+				a, c = cur[i-bpp], prev[i-bpp]
+			}
+			cur[i] += paeth(a, prev[i], c)
+		}
+	default:
+		return fmt.Errorf("corrupt PNG: invalid filter type %d", t)
+	}
+	return nil
+}
+
+// pngIDATReader reads the data of consecutive IDAT chunks as one stream
+type pngIDATReader struct {
+	r         *bufio.Reader
+	remaining uint32 // Bytes left in the current chunk
+	done      bool
+}
+
+func (r *pngIDATReader) Read(p []byte) (int, error) {
+	for r.remaining == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		// Skip the CRC and read the next chunk header
+		var header [12]byte
+		if _, err := io.ReadFull(r.r, header[:]); err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if string(header[8:]) != "IDAT" {
+			r.done = true
+			return 0, io.EOF
+		}
+		r.remaining = binary.BigEndian.Uint32(header[4:])
+	}
+	n, err := r.r.Read(p[:min(len(p), int(r.remaining))])
+	r.remaining -= uint32(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// pngRowWriter encodes rows as an 8-bit RGB or RGBA PNG as they are written
+type pngRowWriter struct {
+	w       *bufio.Writer
+	chunks  *bufio.Writer
+	zw      *zlib.Writer
+	filter  string
+	f       pngFilterer
+	opaque  bool
+	cur     []byte
+	prev    []byte
+	bpp     int
+	written int
+	height  int
+}
+
+func newPNGRowWriter(w io.Writer, size image.Point, opaque bool, options ProcessOptions) (*pngRowWriter, error) {
+	if options.PNG.Reduce || options.PNG.Interlace || options.PNG.Optimize {
+		return nil, fmt.Errorf("PNG color reduction, interlacing and optimization need the whole image: they cannot be streamed")
+	}
+	level, err := pngLevel(options.PNG.Compression)
+	if err != nil {
+		return nil, err
+	}
+	filter := strings.ToLower(options.PNG.Filter)
+	if filter == "" {
+		filter = PNGFilterAdaptive
+	}
+	if filter != PNGFilterAdaptive && !slices.Contains(pngFilters, filter) {
+		return nil, fmt.Errorf("invalid PNG filter: %s (expected adaptive, none, sub, up, average, or paeth)", options.PNG.Filter)
+	}
+
+	pw := &pngRowWriter{w: bufio.NewWriter(w), filter: filter, opaque: opaque, bpp: 4, height: size.Y}
+	if opaque {
+		pw.bpp = 3
+	}
+	pw.cur = make([]byte, size.X*pw.bpp)
+	pw.prev = make([]byte, size.X*pw.bpp)
+
+	var header [13]byte
+	binary.BigEndian.PutUint32(header[0:], uint32(size.X))
+	binary.BigEndian.PutUint32(header[4:], uint32(size.Y))
+	header[8], header[9] = 8, pngRGBA
+	if opaque {
+		header[9] = pngRGB
+	}
+	pw.w.Write(pngSignature)
+	writePNGChunk(pw.w, "IHDR", header[:])
+	if options.Density > 0 {
+		perMeter := uint32(math.Round(options.Density / 0.0254))
+		var phys [9]byte
+		binary.BigEndian.PutUint32(phys[0:], perMeter)
+		binary.BigEndian.PutUint32(phys[4:], perMeter)
+		phys[8] = 1 // Unit: meter
+		writePNGChunk(pw.w, "pHYs", phys[:])
+	}
+	pw.chunks = bufio.NewWriterSize(pngChunkWriter{pw.w}, 1<<15)
+	if pw.zw, err = zlib.NewWriterLevel(pw.chunks, level); err != nil {
+		return nil, fmt.Errorf("failed to compress PNG data: %w", err)
+	}
+	return pw, nil
+}
+
+func (w *pngRowWriter) write(row []byte) error {
+	if w.opaque {
+		for x := 0; x*4 < len(row); x++ {
+			copy(w.cur[x*3:x*3+3], row[x*4:])
+		}
+	} else {
+		copy(w.cur, row)
+	}
+	if _, err := w.zw.Write(w.f.filter(w.filter, w.cur, w.prev, w.bpp)); err != nil {
+		return fmt.Errorf("failed to compress PNG data: %w", err)
+	}
+	w.cur, w.prev = w.prev, w.cur
+	w.written++
+	return nil
+}
+
+func (w *pngRowWriter) close() error {
+	if w.written != w.height {
+		return fmt.Errorf("wrote %d of %d PNG rows", w.written, w.height)
+	}
+	if err := w.zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress PNG data: %w", err)
+	}
+	if err := w.chunks.Flush(); err != nil {
+		return err
+	}
+	writePNGChunk(w.w, "IEND", nil)
+	return w.w.Flush()
+}
@@ -0,0 +1,118 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// readRows reads every row of r into an image
+func readRows(t *testing.T, r rowReader) *image.NRGBA {
+	t.Helper()
+	img := image.NewNRGBA(image.Rectangle{Max: r.size()})
+	for y := 0; y < img.Rect.Dy(); y++ {
+		if err := r.read(img.Pix[y*img.Stride : (y+1)*img.Stride]); err != nil {
+			t.Fatalf("row %d: %v", y, err)
+		}
+	}
+	return img
+}
+
+func TestPNGRowReader(t *testing.T) {
+	src := gradient(37, 21)
+	two := image.NewPaletted(src.Rect, color.Palette{color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 255, 80}})
+	for i := range two.Pix {
+		two.Pix[i] = uint8(i % 3 % 2)
+	}
+	images := map[string]image.Image{
+		"rgb":     src,
+		"rgba":    noiseAlpha(37, 21),
+		"gray":    imaging.Grayscale(src),
+		"gray16":  image.NewGray16(src.Rect),
+		"rgba64":  toNRGBA64(noiseAlpha(37, 21)),
+		"palette": two,
+	}
+	for name, img := range images {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		r, err := newPNGRowReader(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !sameColors8(readRows(t, r), img) {
+			t.Errorf("%s: rows differ from the image", name)
+		}
+		if opaque := r.opaque(); opaque != isOpaque(img) {
+			t.Errorf("%s: opaque %v", name, opaque)
+		}
+	}
+
+	var buf bytes.Buffer
+	EncodePNG(&buf, src, PNGOptions{Interlace: true})
+	if _, err := newPNGRowReader(&buf); err == nil {
+		t.Error("expected an error for an interlaced PNG")
+	}
+}
+
+func TestPNGRowWriter(t *testing.T) {
+	for _, img := range []*image.NRGBA{gradient(37, 21), noiseAlpha(37, 21)} {
+		var buf bytes.Buffer
+		options := ProcessOptions{PNG: PNGOptions{Filter: PNGFilterPaeth}, Density: 300}
+		w, err := newPNGRowWriter(&buf, img.Rect.Size(), isOpaque(img), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < img.Rect.Dy(); y++ {
+			if err := w.write(img.Pix[y*img.Stride : (y+1)*img.Stride]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.close(); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := png.Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameColors(img, decoded) {
+			t.Error("decoded PNG differs")
+		}
+		if !bytes.Contains(buf.Bytes(), []byte("pHYs")) {
+			t.Error("no pHYs chunk")
+		}
+	}
+
+	if _, err := newPNGRowWriter(&bytes.Buffer{}, image.Pt(4, 4), true, ProcessOptions{PNG: PNGOptions{Interlace: true}}); err == nil {
+		t.Error("expected an error for interlaced output")
+	}
+}
+
+// noiseAlpha returns noise with random alpha
+func noiseAlpha(w, h int) *image.NRGBA {
+	img := noise(w, h)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = img.Pix[i-1] ^ img.Pix[i-3]
+	}
+	return img
+}
+
+// sameColors8 reports whether two images have the same 8-bit
+// non-premultiplied colors, ignoring the color of transparent pixels
+func sameColors8(a, b image.Image) bool {
+	na, nb := imaging.Clone(a), imaging.Clone(b)
+	if na.Rect.Size() != nb.Rect.Size() {
+		return false
+	}
+	for i := 0; i < len(na.Pix); i += 4 {
+		if na.Pix[i+3] != nb.Pix[i+3] || na.Pix[i+3] != 0 && !bytes.Equal(na.Pix[i:i+3], nb.Pix[i:i+3]) {
+			return false
+		}
+	}
+	return true
+}
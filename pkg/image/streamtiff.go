@@ -0,0 +1,639 @@
+package image
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	"golang.org/x/image/tiff/lzw"
+)
+
+// TIFF tags read and written a row at a time
+const (
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffPhotometric     = 262
+	tiffStripOffsets    = 273
+	tiffSamplesPerPixel = 277
+	tiffRowsPerStrip    = 278
+	tiffStripByteCounts = 279
+	tiffXResolution     = 282
+	tiffYResolution     = 283
+	tiffPlanarConfig    = 284
+	tiffResolutionUnit  = 296
+	tiffPredictor       = 317
+	tiffColorMap        = 320
+	tiffTileWidth       = 322
+	tiffTileLength      = 323
+	tiffTileOffsets     = 324
+	tiffTileByteCounts  = 325
+	tiffExtraSamples    = 338
+)
+
+// tiffRowReader decodes the rows of a striped or tiled TIFF page as they are
+// read, classic or BigTIFF, keeping one strip reader or one row of tiles in
+// memory
+type tiffRowReader struct {
+	r             io.ReaderAt
+	bo            binary.ByteOrder
+	width, height int
+	bits          int
+	samples       int
+	alpha         int // ExtraSamples value of the fourth or second sample: 1 premultiplied, 2 straight, 0 none
+	photometric   int
+	compression   int
+	predictor     int
+	colorMap      []uint16
+	blockW        int // Tile size, or the image width and rows per strip
+	blockH        int
+	offsets       []uint64
+	counts        []uint64
+	tiled         bool
+
+	y      int
+	strip  io.Reader // Decompressed data of the current strip
+	tiles  []byte    // Decoded row of tiles
+	tilesY int       // First image row in tiles
+	raw    []byte
+}
+
+// newTIFFRowReader reads the IFD of a page (starting at 1, or 0 for the
+// first) of a TIFF file
+func newTIFFRowReader(r io.ReaderAt, page int) (*tiffRowReader, error) {
+	var header [16]byte
+	if _, err := r.ReadAt(header[:8], 0); err != nil {
+		return nil, fmt.Errorf("not a TIFF file")
+	}
+	d := &tiffRowReader{r: r, tilesY: -1}
+	switch string(header[:2]) {
+	case "II":
+		d.bo = binary.LittleEndian
+	case "MM":
+		d.bo = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a TIFF file")
+	}
+
+	// BigTIFF has 8-byte offsets and counts, and 20-byte IFD entries
+	big := false
+	var offset uint64
+	switch d.bo.Uint16(header[2:]) {
+	case 42:
+		offset = uint64(d.bo.Uint32(header[4:]))
+	case 43:
+		if _, err := r.ReadAt(header[:16], 0); err != nil {
+			return nil, fmt.Errorf("truncated BigTIFF header")
+		}
+		big, offset = true, d.bo.Uint64(header[8:])
+	default:
+		return nil, fmt.Errorf("not a TIFF file")
+	}
+	for range max(1, page) - 1 {
+		next, err := d.nextIFD(offset, big)
+		if err != nil {
+			return nil, err
+		}
+		if next == 0 {
+			return nil, fmt.Errorf("page %d not found in the TIFF file", page)
+		}
+		offset = next
+	}
+
+	tags, err := d.readIFD(offset, big)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.setup(tags); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// nextIFD returns the offset of the IFD that follows the one at offset
+func (d *tiffRowReader) nextIFD(offset uint64, big bool) (uint64, error) {
+	count, entrySize, countSize, offsetSize := d.ifdLayout(offset, big)
+	if count < 0 {
+		return 0, fmt.Errorf("invalid TIFF IFD offset: %d", offset)
+	}
+	buf := make([]byte, offsetSize)
+	if _, err := d.r.ReadAt(buf, int64(offset)+int64(countSize)+int64(count*entrySize)); err != nil {
+		return 0, fmt.Errorf("truncated TIFF IFD")
+	}
+	if big {
+		return d.bo.Uint64(buf), nil
+	}
+	return uint64(d.bo.Uint32(buf)), nil
+}
+
+// ifdLayout returns the entry count of the IFD at offset and the sizes of
+// its entries, count and next IFD offset, or a negative count
+func (d *tiffRowReader) ifdLayout(offset uint64, big bool) (int, int, int, int) {
+	if big {
+		var buf [8]byte
+		if _, err := d.r.ReadAt(buf[:], int64(offset)); err != nil || d.bo.Uint64(buf[:]) > 1<<16 {
+			return -1, 0, 0, 0
+		}
+		return int(d.bo.Uint64(buf[:])), 20, 8, 8
+	}
+	var buf [2]byte
+	if _, err := d.r.ReadAt(buf[:], int64(offset)); err != nil {
+		return -1, 0, 0, 0
+	}
+	return int(d.bo.Uint16(buf[:])), 12, 2, 4
+}
+
+// readIFD returns the values of the integer tags of the IFD at offset
+func (d *tiffRowReader) readIFD(offset uint64, big bool) (map[uint16][]uint64, error) {
+	count, entrySize, countSize, valueSize := d.ifdLayout(offset, big)
+	if count < 0 {
+		return nil, fmt.Errorf("invalid TIFF IFD offset: %d", offset)
+	}
+	entries := make([]byte, count*entrySize)
+	if _, err := d.r.ReadAt(entries, int64(offset)+int64(countSize)); err != nil {
+		return nil, fmt.Errorf("truncated TIFF IFD")
+	}
+
+	tags := make(map[uint16][]uint64)
+	for i := range count {
+		entry := entries[i*entrySize:]
+		tag, kind := d.bo.Uint16(entry), d.bo.Uint16(entry[2:])
+		var n uint64
+		value := entry[8:]
+		if big {
+			n = d.bo.Uint64(entry[4:])
+			value = entry[12:]
+		} else {
+			n = uint64(d.bo.Uint32(entry[4:]))
+		}
+		size := map[uint16]uint64{1: 1, 3: 2, 4: 4, 16: 8}[kind] // BYTE, SHORT, LONG, LONG8
+		if size == 0 || n > 1<<28 {
+			continue
+		}
+		data := value[:valueSize]
+		if n*size > uint64(valueSize) {
+			var at uint64
+			if big {
+				at = d.bo.Uint64(value)
+			} else {
+				at = uint64(d.bo.Uint32(value))
+			}
+			data = make([]byte, n*size)
+			if _, err := d.r.ReadAt(data, int64(at)); err != nil {
+				return nil, fmt.Errorf("truncated TIFF tag %d", tag)
+			}
+		}
+		values := make([]uint64, n)
+		for j := range values {
+			switch size {
+			case 1:
+				values[j] = uint64(data[j])
+			case 2:
+				values[j] = uint64(d.bo.Uint16(data[j*2:]))
+			case 4:
+				values[j] = uint64(d.bo.Uint32(data[j*4:]))
+			case 8:
+				values[j] = d.bo.Uint64(data[j*8:])
+			}
+		}
+		tags[tag] = values
+	}
+	return tags, nil
+}
+
+// setup checks the layout of the page and reads its strip or tile locations
+func (d *tiffRowReader) setup(tags map[uint16][]uint64) error {
+	first := func(tag uint16, fallback int) int {
+		if v := tags[tag]; len(v) > 0 {
+			return int(v[0])
+		}
+		return fallback
+	}
+	d.width, d.height = first(tiffImageWidth, 0), first(tiffImageLength, 0)
+	if d.width <= 0 || d.height <= 0 || d.width > math.MaxInt32/8 {
+		return fmt.Errorf("invalid TIFF dimensions: %dx%d", d.width, d.height)
+	}
+	d.bits, d.samples = first(tiffBitsPerSample, 1), first(tiffSamplesPerPixel, 1)
+	d.photometric, d.compression = first(tiffPhotometric, 1), first(tiffCompression, 1)
+	d.predictor = first(tiffPredictor, 1)
+	if first(tiffPlanarConfig, 1) != 1 {
+		return fmt.Errorf("planar TIFFs cannot be streamed")
+	}
+	if extra := tags[tiffExtraSamples]; len(extra) > 0 {
+		d.alpha = int(extra[0])
+	}
+
+	switch {
+	case (d.photometric == 0 || d.photometric == 1) && d.samples >= 1 && d.samples <= 2:
+		if d.samples == 1 && d.bits != 1 && d.bits != 2 && d.bits != 4 && d.bits != 8 && d.bits != 16 ||
+			d.samples == 2 && d.bits != 8 && d.bits != 16 {
+			return fmt.Errorf("unsupported TIFF: %d-bit grayscale", d.bits)
+		}
+	case d.photometric == 2 && d.samples >= 3 && d.samples <= 4:
+		if d.bits != 8 && d.bits != 16 {
+			return fmt.Errorf("unsupported TIFF: %d-bit RGB", d.bits)
+		}
+	case d.photometric == 3 && d.samples == 1:
+		d.colorMap = make([]uint16, len(tags[tiffColorMap]))
+		for i, v := range tags[tiffColorMap] {
+			d.colorMap[i] = uint16(v)
+		}
+		if d.bits > 8 || len(d.colorMap) < 3<<d.bits {
+			return fmt.Errorf("unsupported TIFF: invalid color map")
+		}
+	default:
+		return fmt.Errorf("unsupported TIFF: photometric interpretation %d with %d samples", d.photometric, d.samples)
+	}
+	switch d.compression {
+	case 1, 5, 8, 32946: // None, LZW, Deflate
+	default:
+		return fmt.Errorf("unsupported TIFF compression: %d", d.compression)
+	}
+	if d.predictor != 1 && (d.predictor != 2 || d.bits < 8) {
+		return fmt.Errorf("unsupported TIFF predictor: %d", d.predictor)
+	}
+
+	if _, ok := tags[tiffTileWidth]; ok {
+		if d.bits < 8 {
+			return fmt.Errorf("unsupported TIFF: %d-bit tiles", d.bits)
+		}
+		d.tiled = true
+		d.blockW, d.blockH = first(tiffTileWidth, 0), first(tiffTileLength, 0)
+		d.offsets, d.counts = tags[tiffTileOffsets], tags[tiffTileByteCounts]
+	} else {
+		d.blockW, d.blockH = d.width, min(d.height, first(tiffRowsPerStrip, d.height))
+		d.offsets, d.counts = tags[tiffStripOffsets], tags[tiffStripByteCounts]
+	}
+	if d.blockW <= 0 || d.blockH <= 0 {
+		return fmt.Errorf("invalid TIFF tile size: %dx%d", d.blockW, d.blockH)
+	}
+	across := (d.width + d.blockW - 1) / d.blockW
+	down := (d.height + d.blockH - 1) / d.blockH
+	if len(d.offsets) < across*down || len(d.counts) < across*down {
+		return fmt.Errorf("corrupt TIFF: missing strip or tile offsets")
+	}
+	d.raw = make([]byte, d.rowBytes(d.blockW))
+	return nil
+}
+
+// rowBytes returns the size of a row of width pixels
+func (d *tiffRowReader) rowBytes(width int) int {
+	return (width*d.bits*d.samples + 7) / 8
+}
+
+func (d *tiffRowReader) size() image.Point {
+	return image.Pt(d.width, d.height)
+}
+
+func (d *tiffRowReader) opaque() bool {
+	return d.alpha == 0
+}
+
+// block returns a reader of the decompressed data of strip or tile i
+func (d *tiffRowReader) block(i int) (io.Reader, error) {
+	r := io.NewSectionReader(d.r, int64(d.offsets[i]), int64(d.counts[i]))
+	switch d.compression {
+	case 5:
+		return lzw.NewReader(bufio.NewReader(r), lzw.MSB, 8), nil
+	case 8, 32946:
+		zr, err := zlib.NewReader(bufio.NewReader(r))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress TIFF data: %w", err)
+		}
+		return zr, nil
+	}
+	return bufio.NewReader(r), nil
+}
+
+func (d *tiffRowReader) read(row []byte) error {
+	if d.y >= d.height {
+		return io.EOF
+	}
+	raw := d.raw
+	if d.tiled {
+		if d.y >= d.tilesY+d.blockH || d.tilesY < 0 {
+			if err := d.readTiles(); err != nil {
+				return err
+			}
+		}
+		stride := d.rowBytes(d.blockW) * ((d.width + d.blockW - 1) / d.blockW)
+		raw = d.tiles[(d.y-d.tilesY)*stride:]
+	} else {
+		if d.y%d.blockH == 0 {
+			var err error
+			if d.strip, err = d.block(d.y / d.blockH); err != nil {
+				return err
+			}
+		}
+		if _, err := io.ReadFull(d.strip, raw); err != nil {
+			return fmt.Errorf("truncated TIFF strip: %w", err)
+		}
+		d.unpredict(raw)
+	}
+	d.y++
+	d.convert(raw, row)
+	return nil
+}
+
+// readTiles decodes the row of tiles holding row d.y, side by side
+func (d *tiffRowReader) readTiles() error {
+	across := (d.width + d.blockW - 1) / d.blockW
+	tileRow := d.rowBytes(d.blockW)
+	stride := tileRow * across
+	if d.tiles == nil {
+		d.tiles = make([]byte, stride*d.blockH)
+	}
+	d.tilesY = d.y / d.blockH * d.blockH
+	for tx := range across {
+		r, err := d.block(d.y/d.blockH*across + tx)
+		if err != nil {
+			return err
+		}
+		for ty := range d.blockH {
+			dst := d.tiles[ty*stride+tx*tileRow : ty*stride+(tx+1)*tileRow]
+			if _, err := io.ReadFull(r, dst); err != nil {
+				// The last row of tiles may stop at the image height
+				if d.tilesY+ty >= d.height {
+					break
+				}
+				return fmt.Errorf("truncated TIFF tile: %w", err)
+			}
+			d.unpredict(dst)
+		}
+	}
+	return nil
+}
+
+// unpredict reverses horizontal differencing, the TIFF predictor 2
+func (d *tiffRowReader) unpredict(raw []byte) {
+	if d.predictor != 2 {
+		return
+	}
+	if d.bits == 16 {
+		for i := d.samples * 2; i+1 < len(raw); i += 2 {
+			d.bo.PutUint16(raw[i:], d.bo.Uint16(raw[i:])+d.bo.Uint16(raw[i-d.samples*2:]))
+		}
+		return
+	}
+	for i := d.samples; i < len(raw); i++ {
+		raw[i] += raw[i-d.samples]
+	}
+}
+
+// convert turns a row of samples into 8-bit NRGBA
+func (d *tiffRowReader) convert(raw, row []byte) {
+	sample := func(x, s int) uint8 {
+		i := x*d.samples + s
+		switch d.bits {
+		case 16:
+			return uint8(d.bo.Uint16(raw[i*2:]) >> 8)
+		case 8:
+			return raw[i]
+		}
+		// Packed samples, most significant bits first
+		perByte := 8 / d.bits
+		v := int(raw[i/perByte]>>(8-d.bits*(i%perByte+1))) & (1<<d.bits - 1)
+		if d.photometric == 3 {
+			return uint8(v)
+		}
+		return uint8(v * 255 / (1<<d.bits - 1))
+	}
+
+	for x := 0; x < d.width; x++ {
+		p := row[x*4 : x*4+4]
+		switch d.photometric {
+		case 0, 1:
+			g := sample(x, 0)
+			if d.photometric == 0 {
+				g = 255 - g
+			}
+			p[0], p[1], p[2], p[3] = g, g, g, 255
+			if d.samples == 2 && d.alpha != 0 {
+				p[3] = sample(x, 1)
+			}
+		case 2:
+			p[0], p[1], p[2], p[3] = sample(x, 0), sample(x, 1), sample(x, 2), 255
+			if d.samples == 4 && d.alpha != 0 {
+				p[3] = sample(x, 3)
+			}
+		case 3:
+			i, n := int(sample(x, 0)), len(d.colorMap)/3
+			p[0], p[1], p[2], p[3] = uint8(d.colorMap[i]>>8), uint8(d.colorMap[n+i]>>8), uint8(d.colorMap[2*n+i]>>8), 255
+		}
+		// Premultiplied colors are divided by alpha
+		if d.alpha == 1 && p[3] != 0 && p[3] != 255 {
+			for c := range 3 {
+				p[c] = uint8(min(255, (int(p[c])*255+int(p[3])/2)/int(p[3])))
+			}
+		}
+	}
+}
+
+// tiffRowWriter encodes rows as an 8-bit RGB or RGBA TIFF in strips as they
+// are written. The IFD follows the strips, and BigTIFF is used for outputs
+// that may not fit in 4GB.
+type tiffRowWriter struct {
+	w         io.WriteSeeker
+	bw        *bufio.Writer
+	width     int
+	height    int
+	samples   int
+	deflate   bool
+	big       bool
+	density   float64
+	rowsStrip int
+	strip     []byte // Rows of the current strip
+	rows      int
+	offset    uint64 // Position of the next strip
+	offsets   []uint64
+	counts    []uint64
+}
+
+func newTIFFRowWriter(w io.WriteSeeker, size image.Point, opaque bool, options ProcessOptions) (*tiffRowWriter, error) {
+	tw := &tiffRowWriter{w: w, bw: bufio.NewWriter(w), width: size.X, height: size.Y, samples: 4, density: options.Density}
+	switch options.TIFF.Compression {
+	case "", TIFFCompressionDeflate:
+		tw.deflate = true
+	case TIFFCompressionNone:
+	default:
+		return nil, fmt.Errorf("invalid TIFF compression: %s (expected deflate or none)", options.TIFF.Compression)
+	}
+	if opaque {
+		tw.samples = 3
+	}
+	rowBytes := size.X * tw.samples
+	tw.big = int64(rowBytes)*int64(size.Y) > math.MaxUint32-1<<20
+	tw.rowsStrip = max(1, min(size.Y, 1<<16/rowBytes))
+
+	// The header, with the IFD offset filled in by close
+	header := []byte("II*\x00\x00\x00\x00\x00")
+	if tw.big {
+		header = []byte("II+\x00\x08\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	}
+	if _, err := tw.bw.Write(header); err != nil {
+		return nil, err
+	}
+	tw.offset = uint64(len(header))
+	return tw, nil
+}
+
+func (w *tiffRowWriter) write(row []byte) error {
+	if w.samples == 3 {
+		for x := 0; x < w.width; x++ {
+			w.strip = append(w.strip, row[x*4:x*4+3]...)
+		}
+	} else {
+		w.strip = append(w.strip, row[:w.width*4]...)
+	}
+	w.rows++
+	if w.rows%w.rowsStrip == 0 || w.rows == w.height {
+		return w.flushStrip()
+	}
+	return nil
+}
+
+// flushStrip writes the buffered rows as a strip
+func (w *tiffRowWriter) flushStrip() error {
+	data := w.strip
+	if w.deflate {
+		var buf countingWriter
+		zw := zlib.NewWriter(io.MultiWriter(w.bw, &buf))
+		if _, err := zw.Write(data); err != nil {
+			return fmt.Errorf("failed to compress TIFF data: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("failed to compress TIFF data: %w", err)
+		}
+		w.offsets, w.counts = append(w.offsets, w.offset), append(w.counts, uint64(buf.n))
+		w.offset += uint64(buf.n)
+	} else {
+		if _, err := w.bw.Write(data); err != nil {
+			return err
+		}
+		w.offsets, w.counts = append(w.offsets, w.offset), append(w.counts, uint64(len(data)))
+		w.offset += uint64(len(data))
+	}
+	w.strip = w.strip[:0]
+	return nil
+}
+
+func (w *tiffRowWriter) close() error {
+	if w.rows != w.height {
+		return fmt.Errorf("wrote %d of %d TIFF rows", w.rows, w.height)
+	}
+	// Word-aligned IFD, with its arrays and values after it
+	if w.offset%2 == 1 {
+		w.bw.WriteByte(0)
+		w.offset++
+	}
+	ifd := w.offset
+	type entry struct {
+		tag, kind uint16
+		values    []uint64
+	}
+	long := uint16(4)
+	if w.big {
+		long = 16
+	}
+	compression := uint64(1)
+	if w.deflate {
+		compression = 8
+	}
+	bits := []uint64{8, 8, 8, 8}[:w.samples]
+	// Resolutions in thousandths
+	dpi := w.density
+	if dpi <= 0 {
+		dpi = 72
+	}
+	resolution := []uint64{uint64(math.Round(dpi * 1000)), 1000}
+	entries := []entry{
+		{tiffImageWidth, long, []uint64{uint64(w.width)}},
+		{tiffImageLength, long, []uint64{uint64(w.height)}},
+		{tiffBitsPerSample, 3, bits},
+		{tiffCompression, 3, []uint64{compression}},
+		{tiffPhotometric, 3, []uint64{2}},
+		{tiffStripOffsets, long, w.offsets},
+		{tiffSamplesPerPixel, 3, []uint64{uint64(w.samples)}},
+		{tiffRowsPerStrip, long, []uint64{uint64(w.rowsStrip)}},
+		{tiffStripByteCounts, long, w.counts},
+		{tiffXResolution, 5, resolution},
+		{tiffYResolution, 5, resolution},
+		{tiffPlanarConfig, 3, []uint64{1}},
+		{tiffResolutionUnit, 3, []uint64{2}},
+	}
+	if w.samples == 4 {
+		entries = append(entries, entry{tiffExtraSamples, 3, []uint64{2}})
+	}
+
+	entrySize, countSize, slot := 12, 2, 4
+	if w.big {
+		entrySize, countSize, slot = 20, 8, 8
+	}
+	var out, extra []byte
+	bo := binary.LittleEndian
+	put := func(b []byte, size int, v uint64) []byte {
+		switch size {
+		case 2:
+			return bo.AppendUint16(b, uint16(v))
+		case 4:
+			return bo.AppendUint32(b, uint32(v))
+		}
+		return bo.AppendUint64(b, v)
+	}
+	out = put(out, countSize, uint64(len(entries)))
+	extraAt := ifd + uint64(countSize+len(entries)*entrySize+slot)
+	for _, e := range entries {
+		out = bo.AppendUint16(out, e.tag)
+		out = bo.AppendUint16(out, e.kind)
+		count := uint64(len(e.values))
+		if e.kind == 5 { // RATIONAL: numerator and denominator
+			count = 1
+		}
+		out = put(out, slot, count)
+		size := map[uint16]int{3: 2, 4: 4, 5: 4, 16: 8}[e.kind]
+		var value []byte
+		for _, v := range e.values {
+			value = put(value, size, v)
+		}
+		if len(value) <= slot {
+			out = append(out, value...)
+			out = append(out, make([]byte, slot-len(value))...)
+			continue
+		}
+		out = put(out, slot, extraAt+uint64(len(extra)))
+		extra = append(extra, value...)
+		if len(extra)%2 == 1 {
+			extra = append(extra, 0)
+		}
+	}
+	out = put(out, slot, 0) // No next IFD
+	out = append(out, extra...)
+	if _, err := w.bw.Write(out); err != nil {
+		return err
+	}
+	if err := w.bw.Flush(); err != nil {
+		return err
+	}
+
+	// Point the header at the IFD
+	var at []byte
+	position := int64(4)
+	if w.big {
+		position, at = 8, bo.AppendUint64(nil, ifd)
+	} else {
+		at = bo.AppendUint32(nil, uint32(ifd))
+	}
+	if _, err := w.w.Seek(position, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(at); err != nil {
+		return err
+	}
+	_, err := w.w.Seek(0, io.SeekEnd)
+	return err
+}
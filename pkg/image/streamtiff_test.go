@@ -0,0 +1,201 @@
+package image
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/tiff"
+)
+
+// testTIFF builds a little-endian TIFF page from tags with LONG values and
+// the data of its strips or tiles, whose offsets and counts it adds
+func testTIFF(tags map[uint16][]uint32, blocks [][]byte, tiled bool) []byte {
+	bo := binary.LittleEndian
+	data := []byte("II*\x00\x00\x00\x00\x00")
+	var offsets, counts []uint32
+	for _, block := range blocks {
+		offsets, counts = append(offsets, uint32(len(data))), append(counts, uint32(len(block)))
+		data = append(data, block...)
+	}
+	tags = maps.Clone(tags)
+	if tiled {
+		tags[tiffTileOffsets], tags[tiffTileByteCounts] = offsets, counts
+	} else {
+		tags[tiffStripOffsets], tags[tiffStripByteCounts] = offsets, counts
+	}
+
+	ids := make([]uint16, 0, len(tags))
+	for tag := range tags {
+		ids = append(ids, tag)
+	}
+	slices.Sort(ids)
+	ifd := uint32(len(data))
+	bo.PutUint32(data[4:], ifd)
+	extra := ifd + 2 + uint32(len(ids))*12 + 4
+	var values []byte
+	data = bo.AppendUint16(data, uint16(len(ids)))
+	for _, tag := range ids {
+		data = bo.AppendUint16(data, tag)
+		data = bo.AppendUint16(data, 4)
+		data = bo.AppendUint32(data, uint32(len(tags[tag])))
+		if len(tags[tag]) == 1 {
+			data = bo.AppendUint32(data, tags[tag][0])
+			continue
+		}
+		data = bo.AppendUint32(data, extra+uint32(len(values)))
+		for _, v := range tags[tag] {
+			values = bo.AppendUint32(values, v)
+		}
+	}
+	data = bo.AppendUint32(data, 0)
+	return append(data, values...)
+}
+
+// tiffLZW compresses data with TIFF LZW using literal codes only, clearing
+// the table often enough that codes stay 9 bits wide
+func tiffLZW(data []byte) []byte {
+	var out []byte
+	var bits uint32
+	var n uint
+	emit := func(code uint32) {
+		bits, n = bits<<9|code, n+9
+		for n >= 8 {
+			out = append(out, byte(bits>>(n-8)))
+			n -= 8
+		}
+	}
+	for i, b := range data {
+		if i%200 == 0 {
+			emit(256) // Clear
+		}
+		emit(uint32(b))
+	}
+	emit(257) // End of information
+	if n > 0 {
+		out = append(out, byte(bits<<(8-n)))
+	}
+	return out
+}
+
+func TestTIFFRowReader(t *testing.T) {
+	src := gradient(37, 21)
+	for name, img := range map[string]image.Image{
+		"rgba":   noiseAlpha(37, 21),
+		"gray":   imaging.Grayscale(src),
+		"gray16": image.NewGray16(src.Rect),
+		"rgba64": toNRGBA64(src),
+	} {
+		for _, compression := range []tiff.CompressionType{tiff.Uncompressed, tiff.Deflate} {
+			var buf bytes.Buffer
+			if err := tiff.Encode(&buf, img, &tiff.Options{Compression: compression}); err != nil {
+				t.Fatal(err)
+			}
+			r, err := newTIFFRowReader(bytes.NewReader(buf.Bytes()), 0)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if !sameColors8(readRows(t, r), img) {
+				t.Errorf("%s, compression %d: rows differ from the image", name, compression)
+			}
+		}
+	}
+
+	// RGB tiles of 16x16 with the horizontal predictor, LZW and deflate
+	tiles := func(compress func([]byte) []byte) [][]byte {
+		var blocks [][]byte
+		for ty := 0; ty < 21; ty += 16 {
+			for tx := 0; tx < 37; tx += 16 {
+				tile := make([]byte, 16*16*3)
+				for y := 0; y < 16; y++ {
+					for x := 0; x < 16; x++ {
+						c := src.NRGBAAt(min(tx+x, 36), min(ty+y, 20))
+						copy(tile[(y*16+x)*3:], []byte{c.R, c.G, c.B})
+					}
+					for i := 16*3 - 1; i >= 3; i-- {
+						tile[y*16*3+i] -= tile[y*16*3+i-3]
+					}
+				}
+				blocks = append(blocks, compress(tile))
+			}
+		}
+		return blocks
+	}
+	deflate := func(data []byte) []byte {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		return buf.Bytes()
+	}
+	for compression, compress := range map[uint32]func([]byte) []byte{5: tiffLZW, 8: deflate} {
+		data := testTIFF(map[uint16][]uint32{
+			tiffImageWidth: {37}, tiffImageLength: {21}, tiffBitsPerSample: {8, 8, 8}, tiffCompression: {compression},
+			tiffPhotometric: {2}, tiffSamplesPerPixel: {3}, tiffPredictor: {2}, tiffTileWidth: {16}, tiffTileLength: {16},
+		}, tiles(compress), true)
+		r, err := newTIFFRowReader(bytes.NewReader(data), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameColors8(readRows(t, r), src) || !r.opaque() {
+			t.Errorf("compression %d: tiles differ from the image", compression)
+		}
+	}
+
+	// Bilevel strips, white is zero
+	data := testTIFF(map[uint16][]uint32{
+		tiffImageWidth: {10}, tiffImageLength: {2}, tiffBitsPerSample: {1}, tiffPhotometric: {0}, tiffRowsPerStrip: {1},
+	}, [][]byte{{0b10100000, 0}, {0xFF, 0xC0}}, false)
+	r, err := newTIFFRowReader(bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := readRows(t, r)
+	if img.Pix[0] != 0 || img.Pix[4] != 255 || img.Pix[10*4] != 0 {
+		t.Errorf("bilevel rows: %v", img.Pix)
+	}
+
+	if _, err := newTIFFRowReader(bytes.NewReader(multiPageTIFF(t)), 4); err == nil {
+		t.Error("expected an error for a page past the end")
+	}
+}
+
+func TestTIFFRowWriter(t *testing.T) {
+	for _, img := range []*image.NRGBA{gradient(37, 21), noiseAlpha(37, 21)} {
+		for _, compression := range []string{TIFFCompressionDeflate, TIFFCompressionNone} {
+			f, err := os.Create(filepath.Join(t.TempDir(), "out.tif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			w, err := newTIFFRowWriter(f, img.Rect.Size(), isOpaque(img), ProcessOptions{TIFF: TIFFOptions{Compression: compression}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for y := 0; y < img.Rect.Dy(); y++ {
+				if err := w.write(img.Pix[y*img.Stride : (y+1)*img.Stride]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.close(); err != nil {
+				t.Fatal(err)
+			}
+			f.Seek(0, io.SeekStart)
+			decoded, err := tiff.Decode(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameColors8(img, decoded) {
+				t.Errorf("%s: decoded TIFF differs", compression)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package image
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+const testSVG = `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 20 10" width="20" height="10">
+<rect x="0" y="0" width="10" height="10" fill="#ff0000"/>
+<rect x="10" y="0" width="10" height="10" fill="#0000ff"/>
+</svg>`
+
+func TestDecodeSVG(t *testing.T) {
+	options := DefaultOptions()
+	options.Width, options.Height = 200, 200
+
+	img, err := DecodeSVG(strings.NewReader(testSVG), options)
+	if err != nil {
+		t.Fatalf("DecodeSVG failed: %v", err)
+	}
+
+	// Rendered at the fitted target size rather than the intrinsic 20x10
+	if img.Bounds() != image.Rect(0, 0, 200, 100) {
+		t.Fatalf("Expected 200x100, got %v", img.Bounds())
+	}
+	if r, g, b, _ := img.At(50, 50).RGBA(); r>>8 != 255 || g != 0 || b != 0 {
+		t.Errorf("Expected red on the left, got %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+	if r, g, b, _ := img.At(150, 50).RGBA(); r != 0 || g != 0 || b>>8 != 255 {
+		t.Errorf("Expected blue on the right, got %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestSVGTargetSize(t *testing.T) {
+	tests := []struct {
+		mode          ResizeMode
+		width, height int
+		crop          image.Rectangle
+		wantW, wantH  int
+	}{
+		{ResizeModeFit, 200, 200, image.Rectangle{}, 200, 100},
+		{ResizeModeFill, 200, 200, image.Rectangle{}, 400, 200},
+		{ResizeModeStretch, 200, 200, image.Rectangle{}, 200, 200},
+		{ResizeModeFit, 0, 0, image.Rectangle{}, 20, 10},
+		{ResizeModeFit, 200, 200, image.Rect(0, 0, 5, 5), 20, 10},
+	}
+
+	for _, tt := range tests {
+		options := ProcessOptions{Width: tt.width, Height: tt.height, ResizeMode: tt.mode, Crop: tt.crop}
+		w, h := svgTargetSize(20, 10, options)
+		if w != tt.wantW || h != tt.wantH {
+			t.Errorf("%s %dx%d: expected %dx%d, got %dx%d", tt.mode, tt.width, tt.height, tt.wantW, tt.wantH, w, h)
+		}
+	}
+}
+
+func TestDecodeSVGInvalid(t *testing.T) {
+	if _, err := DecodeSVG(strings.NewReader("not svg"), DefaultOptions()); err == nil {
+		t.Fatalf("Expected an error for invalid SVG")
+	}
+}
@@ -0,0 +1,244 @@
+package image
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+)
+
+func init() {
+	RegisterCodec(Codec{
+		Name:       "TGA",
+		Extensions: []string{"tga"},
+		Decode: func(r io.Reader, options ProcessOptions) (image.Image, error) {
+			return DecodeTGA(r)
+		},
+		Encode: func(w io.Writer, img image.Image, options ProcessOptions) error {
+			return EncodeTGA(w, img)
+		},
+	})
+}
+
+// TGA image types
+const (
+	tgaColorMapped    = 1
+	tgaTrueColor      = 2
+	tgaGrayscale      = 3
+	tgaRLEColorMapped = 9
+	tgaRLETrueColor   = 10
+	tgaRLEGrayscale   = 11
+)
+
+// DecodeTGA decodes a Truevision TGA image. Color-mapped, true-color and
+// grayscale images are supported, both uncompressed and run-length encoded.
+func DecodeTGA(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	le := binary.LittleEndian
+
+	var header [18]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read TGA header: %w", err)
+	}
+	idLength := int(header[0])
+	colorMapType := header[1]
+	imageType := header[2]
+	mapFirst := int(le.Uint16(header[3:]))
+	mapLength := int(le.Uint16(header[5:]))
+	mapDepth := int(header[7])
+	width := int(le.Uint16(header[12:]))
+	height := int(le.Uint16(header[14:]))
+	depth := int(header[16])
+	descriptor := header[17]
+
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("invalid TGA dimensions")
+	}
+	rle := imageType >= tgaRLEColorMapped
+	baseType := imageType
+	if rle {
+		baseType -= 8
+	}
+
+	// Validate the pixel format
+	switch {
+	case baseType == tgaColorMapped && colorMapType == 1 && depth == 8:
+	case baseType == tgaTrueColor && (depth == 15 || depth == 16 || depth == 24 || depth == 32):
+	case baseType == tgaGrayscale && (depth == 8 || depth == 16):
+	default:
+		return nil, fmt.Errorf("unsupported TGA image type %d with %d bits per pixel", imageType, depth)
+	}
+	alphaBits := descriptor & 0x0f
+
+	if _, err := br.Discard(idLength); err != nil {
+		return nil, fmt.Errorf("failed to read TGA header: %w", err)
+	}
+
+	// Read the color map
+	var palette []color.NRGBA
+	if colorMapType == 1 {
+		entrySize := (mapDepth + 7) / 8
+		if entrySize < 2 || entrySize > 4 {
+			return nil, fmt.Errorf("unsupported TGA color map depth: %d", mapDepth)
+		}
+		raw := make([]byte, mapLength*entrySize)
+		if _, err := io.ReadFull(br, raw); err != nil {
+			return nil, fmt.Errorf("failed to read TGA color map: %w", err)
+		}
+		palette = make([]color.NRGBA, mapFirst+mapLength)
+		for i := 0; i < mapLength; i++ {
+			palette[mapFirst+i] = tgaColor(raw[i*entrySize:(i+1)*entrySize], mapDepth, mapDepth == 32)
+		}
+	}
+
+	// Read the pixel data, expanding RLE packets
+	bytesPerPixel := (depth + 7) / 8
+	pixels := make([]byte, width*height*bytesPerPixel)
+	if rle {
+		for n := 0; n < len(pixels); {
+			packet, err := br.ReadByte()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read TGA pixel data: %w", err)
+			}
+			count := int(packet&0x7f) + 1
+			if n+count*bytesPerPixel > len(pixels) {
+				return nil, fmt.Errorf("corrupt TGA RLE data")
+			}
+			if packet&0x80 != 0 {
+				if _, err := io.ReadFull(br, pixels[n:n+bytesPerPixel]); err != nil {
+					return nil, fmt.Errorf("failed to read TGA pixel data: %w", err)
+				}
+				for i := 1; i < count; i++ {
+					copy(pixels[n+i*bytesPerPixel:], pixels[n:n+bytesPerPixel])
+				}
+			} else if _, err := io.ReadFull(br, pixels[n:n+count*bytesPerPixel]); err != nil {
+				return nil, fmt.Errorf("failed to read TGA pixel data: %w", err)
+			}
+			n += count * bytesPerPixel
+		}
+	} else if _, err := io.ReadFull(br, pixels); err != nil {
+		return nil, fmt.Errorf("failed to read TGA pixel data: %w", err)
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	rightToLeft := descriptor&0x10 != 0
+	topToBottom := descriptor&0x20 != 0
+	for y := 0; y < height; y++ {
+		dy := y
+		if !topToBottom {
+			dy = height - 1 - y
+		}
+		for x := 0; x < width; x++ {
+			dx := x
+			if rightToLeft {
+				dx = width - 1 - x
+			}
+			p := pixels[(y*width+x)*bytesPerPixel:]
+			var c color.NRGBA
+			switch baseType {
+			case tgaColorMapped:
+				if int(p[0]) >= len(palette) {
+					return nil, fmt.Errorf("TGA color index %d out of range", p[0])
+				}
+				c = palette[p[0]]
+			case tgaGrayscale:
+				c = color.NRGBA{p[0], p[0], p[0], 255}
+				if depth == 16 && alphaBits > 0 {
+					c.A = p[1]
+				}
+			default:
+				c = tgaColor(p[:bytesPerPixel], depth, alphaBits > 0)
+			}
+			img.SetNRGBA(dx, dy, c)
+		}
+	}
+
+	return img, nil
+}
+
+// tgaColor converts a little-endian BGR(A) or 15/16-bit ARGB1555 TGA pixel
+func tgaColor(p []byte, depth int, useAlpha bool) color.NRGBA {
+	switch depth {
+	case 15, 16:
+		v := binary.LittleEndian.Uint16(p)
+		c := color.NRGBA{
+			R: uint8((v >> 10 & 0x1f) * 255 / 31),
+			G: uint8((v >> 5 & 0x1f) * 255 / 31),
+			B: uint8((v & 0x1f) * 255 / 31),
+			A: 255,
+		}
+		if depth == 16 && useAlpha && v&0x8000 == 0 {
+			c.A = 0
+		}
+		return c
+	case 24:
+		return color.NRGBA{p[2], p[1], p[0], 255}
+	}
+	c := color.NRGBA{p[2], p[1], p[0], 255}
+	if useAlpha {
+		c.A = p[3]
+	}
+	return c
+}
+
+// EncodeTGA writes img as a run-length encoded 32-bit TGA image with a
+// top-left origin
+func EncodeTGA(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	if b.Dx() > 0xffff || b.Dy() > 0xffff {
+		return fmt.Errorf("image too large for TGA: %dx%d", b.Dx(), b.Dy())
+	}
+	src := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	bw := bufio.NewWriter(w)
+	header := make([]byte, 18)
+	header[2] = tgaRLETrueColor
+	binary.LittleEndian.PutUint16(header[12:], uint16(b.Dx()))
+	binary.LittleEndian.PutUint16(header[14:], uint16(b.Dy()))
+	header[16] = 32
+	header[17] = 0x28 // 8 alpha bits, top-left origin
+	bw.Write(header)
+
+	pixel := func(row []byte, x int) [4]byte {
+		return [4]byte{row[x*4+2], row[x*4+1], row[x*4], row[x*4+3]}
+	}
+	for y := 0; y < src.Rect.Dy(); y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+src.Rect.Dx()*4]
+		width := src.Rect.Dx()
+		for x := 0; x < width; {
+			// Count identical pixels for a run packet
+			run := 1
+			for x+run < width && run < 128 && pixel(row, x+run) == pixel(row, x) {
+				run++
+			}
+			if run > 1 {
+				p := pixel(row, x)
+				bw.WriteByte(byte(0x80 | (run - 1)))
+				bw.Write(p[:])
+				x += run
+				continue
+			}
+
+			// Otherwise emit raw pixels until the next run starts
+			raw := 1
+			for x+raw < width && raw < 128 && (x+raw+1 >= width || pixel(row, x+raw) != pixel(row, x+raw+1)) {
+				raw++
+			}
+			bw.WriteByte(byte(raw - 1))
+			for i := 0; i < raw; i++ {
+				p := pixel(row, x+i)
+				bw.Write(p[:])
+			}
+			x += raw
+		}
+	}
+
+	// TGA 2.0 footer without extension or developer areas
+	bw.Write(make([]byte, 8))
+	bw.WriteString("TRUEVISION-XFILE.\x00")
+	return bw.Flush()
+}
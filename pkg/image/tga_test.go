@@ -0,0 +1,73 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestTGARoundTrip(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 300, 3))
+	for x := 0; x < 300; x++ {
+		img.SetNRGBA(x, 0, color.NRGBA{255, 0, 0, 255})                 // A single long run
+		img.SetNRGBA(x, 1, color.NRGBA{uint8(x), uint8(x / 2), 7, 128}) // No runs
+		img.SetNRGBA(x, 2, color.NRGBA{0, 0, uint8(x / 3), 0})          // Short runs
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeTGA(&buf, img); err != nil {
+		t.Fatalf("EncodeTGA failed: %v", err)
+	}
+	decoded, err := DecodeTGA(&buf)
+	if err != nil {
+		t.Fatalf("DecodeTGA failed: %v", err)
+	}
+
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 300; x++ {
+			if got, want := decoded.At(x, y), img.At(x, y); got != want {
+				t.Fatalf("Pixel (%d,%d): expected %v, got %v", x, y, want, got)
+			}
+		}
+	}
+}
+
+func TestDecodeTGABottomUp24(t *testing.T) {
+	// Uncompressed 24-bit 2x2 image with the default bottom-left origin
+	data := []byte{0, 0, tgaTrueColor, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 2, 0, 24, 0}
+	data = append(data,
+		0, 0, 255, 0, 255, 0, // Bottom row: red, green
+		255, 0, 0, 255, 255, 255, // Top row: blue, white
+	)
+
+	img, err := DecodeTGA(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeTGA failed: %v", err)
+	}
+	expected := map[image.Point]color.NRGBA{
+		{0, 0}: {0, 0, 255, 255},
+		{1, 0}: {255, 255, 255, 255},
+		{0, 1}: {255, 0, 0, 255},
+		{1, 1}: {0, 255, 0, 255},
+	}
+	for p, c := range expected {
+		if got := img.At(p.X, p.Y); got != c {
+			t.Errorf("Pixel %v: expected %v, got %v", p, c, got)
+		}
+	}
+}
+
+func TestDecodeTGAInvalid(t *testing.T) {
+	// Unsupported image type
+	data := []byte{0, 0, 32, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 1, 0, 24, 0, 1, 2, 3}
+	if _, err := DecodeTGA(bytes.NewReader(data)); err == nil {
+		t.Errorf("Expected an error for an unsupported image type")
+	}
+
+	// RLE run that overflows the image
+	data = []byte{0, 0, tgaRLETrueColor, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 1, 0, 24, 0, 0x85, 1, 2, 3}
+	if _, err := DecodeTGA(bytes.NewReader(data)); err == nil {
+		t.Errorf("Expected an error for a corrupt RLE packet")
+	}
+}
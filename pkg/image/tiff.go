@@ -0,0 +1,195 @@
+package image
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+
+	"golang.org/x/image/tiff"
+)
+
+// TIFFPageCount returns the number of pages of a TIFF file
+func TIFFPageCount(r io.Reader) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read TIFF file: %w", err)
+	}
+	_, pages, err := tiffPages(data)
+	if err != nil {
+		return 0, err
+	}
+	return len(pages), nil
+}
+
+// DecodeTIFFPage decodes a page (starting at 1) of a multi-page TIFF file
+func DecodeTIFFPage(r io.Reader, page int) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TIFF file: %w", err)
+	}
+	bo, pages, err := tiffPages(data)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 || page > len(pages) {
+		return nil, fmt.Errorf("page %d not found: the TIFF file has %d pages", page, len(pages))
+	}
+
+	// The decoder reads the first IFD, so point the header at the requested page
+	bo.PutUint32(data[4:], pages[page-1])
+	return tiff.Decode(bytes.NewReader(data))
+}
+
+// tiffPages returns the byte order and the offsets of the top-level IFDs,
+// one per page, of a TIFF file
+func tiffPages(data []byte) (binary.ByteOrder, []uint32, error) {
+	if len(data) < 8 {
+		return nil, nil, fmt.Errorf("not a TIFF file")
+	}
+	var bo binary.ByteOrder
+	switch string(data[:4]) {
+	case "II*\x00":
+		bo = binary.LittleEndian
+	case "MM\x00*":
+		bo = binary.BigEndian
+	default:
+		return nil, nil, fmt.Errorf("not a TIFF file")
+	}
+
+	var pages []uint32
+	visited := make(map[uint32]bool)
+	for offset := bo.Uint32(data[4:]); offset != 0; {
+		if visited[offset] || uint64(offset)+2 > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("invalid TIFF IFD offset: %d", offset)
+		}
+		visited[offset] = true
+		pages = append(pages, offset)
+
+		next := int(offset) + 2 + int(bo.Uint16(data[offset:]))*12
+		if next+4 > len(data) {
+			return nil, nil, fmt.Errorf("truncated TIFF IFD")
+		}
+		offset = bo.Uint32(data[next:])
+	}
+	if len(pages) == 0 {
+		return nil, nil, fmt.Errorf("TIFF file has no pages")
+	}
+	return bo, pages, nil
+}
+
+// Compression of TIFF output
+const (
+	TIFFCompressionDeflate = "deflate"
+	TIFFCompressionNone    = "none"
+)
+
+// TIFFOptions controls TIFF output
+type TIFFOptions struct {
+	Compression string // TIFFCompressionDeflate or TIFFCompressionNone; empty uses Deflate
+}
+
+// EncodeTIFF writes img as a single-page TIFF with options
+func EncodeTIFF(w io.Writer, img image.Image, options TIFFOptions) error {
+	encoder := &tiff.Options{}
+	switch options.Compression {
+	case "", TIFFCompressionDeflate:
+		encoder.Compression = tiff.Deflate
+	case TIFFCompressionNone:
+		encoder.Compression = tiff.Uncompressed
+	default:
+		return fmt.Errorf("invalid TIFF compression: %s (expected deflate or none)", options.Compression)
+	}
+	return tiff.Encode(w, img, encoder)
+}
+
+// EncodeMultiPageTIFF writes images as the pages of a single TIFF file. Pages
+// are stored as 8-bit RGBA with Deflate compression.
+func EncodeMultiPageTIFF(w io.Writer, images []image.Image) error {
+	if len(images) == 0 {
+		return fmt.Errorf("no images to write")
+	}
+
+	le := binary.LittleEndian
+	var buf bytes.Buffer
+	buf.WriteString("II*\x00\x00\x00\x00\x00")
+	// Position of the pointer to the next IFD, patched once it is written
+	nextPointer := 4
+
+	for i, img := range images {
+		bounds := img.Bounds()
+		width, height := bounds.Dx(), bounds.Dy()
+		nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+
+		// Strip data with the horizontal differencing predictor
+		rows := make([]byte, 0, len(nrgba.Pix))
+		for y := 0; y < height; y++ {
+			row := nrgba.Pix[y*nrgba.Stride : y*nrgba.Stride+width*4]
+			for x := 0; x < width*4; x++ {
+				if x < 4 {
+					rows = append(rows, row[x])
+				} else {
+					rows = append(rows, row[x]-row[x-4])
+				}
+			}
+		}
+		var strip bytes.Buffer
+		zw := zlib.NewWriter(&strip)
+		zw.Write(rows)
+		zw.Close()
+
+		stripOffset := buf.Len()
+		buf.Write(strip.Bytes())
+		if buf.Len()%2 == 1 {
+			buf.WriteByte(0)
+		}
+		bitsOffset := buf.Len()
+		buf.Write([]byte{8, 0, 8, 0, 8, 0, 8, 0})
+
+		// Link the previous IFD (or the header) to this one
+		le.PutUint32(buf.Bytes()[nextPointer:], uint32(buf.Len()))
+
+		const short, long = 3, 4
+		entries := []struct {
+			tag, kind uint16
+			count     uint32
+			value     uint32
+		}{
+			{254, long, 1, 2},                                    // NewSubfileType: page of a multi-page image
+			{256, long, 1, uint32(width)},                        // ImageWidth
+			{257, long, 1, uint32(height)},                       // ImageLength
+			{258, short, 4, uint32(bitsOffset)},                  // BitsPerSample
+			{259, short, 1, 8},                                   // Compression: Deflate
+			{262, short, 1, 2},                                   // PhotometricInterpretation: RGB
+			{273, long, 1, uint32(stripOffset)},                  // StripOffsets
+			{277, short, 1, 4},                                   // SamplesPerPixel
+			{278, long, 1, uint32(height)},                       // RowsPerStrip
+			{279, long, 1, uint32(strip.Len())},                  // StripByteCounts
+			{284, short, 1, 1},                                   // PlanarConfiguration: chunky
+			{297, short, 2, uint32(i) | uint32(len(images))<<16}, // PageNumber
+			{317, short, 1, 2},                                   // Predictor: horizontal differencing
+			{338, short, 1, 2},                                   // ExtraSamples: unassociated alpha
+		}
+
+		var ifd [12]byte
+		le.PutUint16(ifd[:2], uint16(len(entries)))
+		buf.Write(ifd[:2])
+		for _, e := range entries {
+			le.PutUint16(ifd[0:], e.tag)
+			le.PutUint16(ifd[2:], e.kind)
+			le.PutUint32(ifd[4:], e.count)
+			// In little-endian order SHORT values end up left-justified, as required
+			le.PutUint32(ifd[8:], e.value)
+			buf.Write(ifd[:])
+		}
+		nextPointer = buf.Len()
+		buf.Write([]byte{0, 0, 0, 0})
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,117 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// multiPageTIFF encodes three solid pages of increasing width
+func multiPageTIFF(t *testing.T) []byte {
+	colors := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 128}, {0, 0, 255, 255}}
+	pages := make([]image.Image, len(colors))
+	for i, c := range colors {
+		img := image.NewNRGBA(image.Rect(0, 0, 4+i, 3))
+		for y := 0; y < 3; y++ {
+			for x := 0; x < 4+i; x++ {
+				img.SetNRGBA(x, y, c)
+			}
+		}
+		pages[i] = img
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeMultiPageTIFF(&buf, pages); err != nil {
+		t.Fatalf("EncodeMultiPageTIFF failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestMultiPageTIFF(t *testing.T) {
+	data := multiPageTIFF(t)
+
+	count, err := TIFFPageCount(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("TIFFPageCount failed: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("Expected 3 pages, got %d", count)
+	}
+
+	img, err := DecodeTIFFPage(bytes.NewReader(data), 2)
+	if err != nil {
+		t.Fatalf("DecodeTIFFPage failed: %v", err)
+	}
+	if img.Bounds().Dx() != 5 {
+		t.Errorf("Expected page 2 to be 5 pixels wide, got %d", img.Bounds().Dx())
+	}
+	if c := color.NRGBAModel.Convert(img.At(4, 2)).(color.NRGBA); c != (color.NRGBA{0, 255, 0, 128}) {
+		t.Errorf("Expected translucent green, got %v", c)
+	}
+
+	if _, err := DecodeTIFFPage(bytes.NewReader(data), 4); err == nil {
+		t.Errorf("Expected an error for a page past the end")
+	}
+}
+
+func TestOpenImageTIFFPage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pages.tiff")
+	if err := os.WriteFile(path, multiPageTIFF(t), 0o644); err != nil {
+		t.Fatalf("Failed to write TIFF: %v", err)
+	}
+
+	// The first page is read by default
+	options := DefaultOptions()
+	img, err := OpenImageWithOptions(path, options)
+	if err != nil {
+		t.Fatalf("Failed to open TIFF: %v", err)
+	}
+	if img.Bounds().Dx() != 4 {
+		t.Errorf("Expected the first page, got width %d", img.Bounds().Dx())
+	}
+
+	options.Page = 3
+	img, err = OpenImageWithOptions(path, options)
+	if err != nil {
+		t.Fatalf("Failed to open TIFF page 3: %v", err)
+	}
+	if img.Bounds().Dx() != 6 {
+		t.Errorf("Expected the third page, got width %d", img.Bounds().Dx())
+	}
+}
+
+func TestEncodeTIFF(t *testing.T) {
+	// A flat image compresses well
+	flat := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	var deflate, none bytes.Buffer
+	if err := EncodeTIFF(&deflate, flat, TIFFOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncodeTIFF(&none, flat, TIFFOptions{Compression: TIFFCompressionNone}); err != nil {
+		t.Fatal(err)
+	}
+	if deflate.Len() >= none.Len() {
+		t.Errorf("deflate gives %d bytes, none gives %d", deflate.Len(), none.Len())
+	}
+
+	for _, compression := range []string{TIFFCompressionDeflate, TIFFCompressionNone} {
+		img := gradient(37, 21)
+		var buf bytes.Buffer
+		if err := EncodeTIFF(&buf, img, TIFFOptions{Compression: compression}); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeTIFFPage(&buf, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameColors(img, decoded) {
+			t.Errorf("%s: pixels changed", compression)
+		}
+	}
+	if err := EncodeTIFF(&bytes.Buffer{}, flat, TIFFOptions{Compression: "jpeg"}); err == nil {
+		t.Error("expected an error")
+	}
+}
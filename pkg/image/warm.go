@@ -0,0 +1,35 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/chai2010/webp"
+	"github.com/gen2brain/avif"
+)
+
+// Warm sets up the codecs that initialize themselves on first use, such as
+// the AVIF encoder and decoder compiled from WebAssembly, by encoding and
+// decoding a tiny image in each format, so the first image a long-running
+// process handles is as fast as the rest
+func Warm() error {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for _, codec := range []struct {
+		format string
+		decode func(io.Reader) (image.Image, error)
+	}{
+		{"avif", avif.Decode},
+		{"webp", webp.Decode},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, img, ProcessOptions{OutputFormat: codec.format, Quality: 85}); err != nil {
+			return fmt.Errorf("failed to warm up %s: %w", codec.format, err)
+		}
+		if _, err := codec.decode(&buf); err != nil {
+			return fmt.Errorf("failed to warm up %s: %w", codec.format, err)
+		}
+	}
+	return nil
+}
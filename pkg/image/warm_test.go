@@ -0,0 +1,9 @@
+package image
+
+import "testing"
+
+func TestWarm(t *testing.T) {
+	if err := Warm(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,467 @@
+package image
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+
+// The libwebp 1.4.0 encoder API, which github.com/chai2010/webp compiles in
+// but does not expose beyond lossless, quality and exact
+
+#define WEBP_ENCODER_ABI_VERSION 0x020f
+
+typedef struct WebPPicture WebPPicture;
+typedef struct WebPAuxStats WebPAuxStats;
+typedef int (*WebPWriterFunction)(const uint8_t* data, size_t data_size, const WebPPicture* picture);
+typedef int (*WebPProgressHook)(int percent, const WebPPicture* picture);
+
+typedef struct WebPConfig {
+	int lossless;
+	float quality;
+	int method;
+	int image_hint;
+	int target_size;
+	float target_PSNR;
+	int segments;
+	int sns_strength;
+	int filter_strength;
+	int filter_sharpness;
+	int filter_type;
+	int autofilter;
+	int alpha_compression;
+	int alpha_filtering;
+	int alpha_quality;
+	int pass;
+	int show_compressed;
+	int preprocessing;
+	int partitions;
+	int partition_limit;
+	int emulate_jpeg_size;
+	int thread_level;
+	int low_memory;
+	int near_lossless;
+	int exact;
+	int use_delta_palette;
+	int use_sharp_yuv;
+	int qmin;
+	int qmax;
+} WebPConfig;
+
+typedef struct WebPMemoryWriter {
+	uint8_t* mem;
+	size_t size;
+	size_t max_size;
+	uint32_t pad[1];
+} WebPMemoryWriter;
+
+struct WebPPicture {
+	int use_argb;
+	int colorspace;
+	int width, height;
+	uint8_t *y, *u, *v;
+	int y_stride, uv_stride;
+	uint8_t* a;
+	int a_stride;
+	uint32_t pad1[2];
+	uint32_t* argb;
+	int argb_stride;
+	uint32_t pad2[3];
+	WebPWriterFunction writer;
+	void* custom_ptr;
+	int extra_info_type;
+	uint8_t* extra_info;
+	WebPAuxStats* stats;
+	int error_code;
+	WebPProgressHook progress_hook;
+	void* user_data;
+	uint32_t pad3[3];
+	uint8_t *pad4, *pad5;
+	uint32_t pad6[8];
+	void* memory_;
+	void* memory_argb_;
+	void* pad7[2];
+};
+
+int WebPConfigInitInternal(WebPConfig*, int, float, int);
+int WebPValidateConfig(const WebPConfig*);
+int WebPPictureInitInternal(WebPPicture*, int);
+int WebPPictureImportRGBA(WebPPicture*, const uint8_t*, int);
+void WebPPictureFree(WebPPicture*);
+void WebPMemoryWriterInit(WebPMemoryWriter*);
+void WebPMemoryWriterClear(WebPMemoryWriter*);
+int WebPMemoryWrite(const uint8_t*, size_t, const WebPPicture*);
+int WebPEncode(const WebPConfig*, WebPPicture*);
+
+static int nimWebPConfigInit(WebPConfig* config, float quality) {
+	return WebPConfigInitInternal(config, 0, quality, WEBP_ENCODER_ABI_VERSION);
+}
+
+// nimWebPEncode encodes RGBA pixels into writer, returning 0 or a libwebp
+// error code
+static int nimWebPEncode(const WebPConfig* config, const uint8_t* rgba, int width, int height, int stride, WebPMemoryWriter* writer) {
+	WebPPicture picture;
+	if (!WebPPictureInitInternal(&picture, WEBP_ENCODER_ABI_VERSION)) {
+		return 4; // VP8_ENC_ERROR_INVALID_CONFIGURATION
+	}
+	picture.use_argb = config->lossless;
+	picture.width = width;
+	picture.height = height;
+	if (!WebPPictureImportRGBA(&picture, rgba, stride)) {
+		WebPPictureFree(&picture);
+		return 1; // VP8_ENC_ERROR_OUT_OF_MEMORY
+	}
+	WebPMemoryWriterInit(writer);
+	picture.writer = WebPMemoryWrite;
+	picture.custom_ptr = writer;
+	int ok = WebPEncode(config, &picture);
+	int code = picture.error_code;
+	WebPPictureFree(&picture);
+	return ok ? 0 : code;
+}
+
+// The libwebp 1.4.0 animation encoder, which github.com/chai2010/webp also
+// compiles in
+
+#define WEBP_MUX_ABI_VERSION 0x0109
+
+typedef struct WebPData {
+	const uint8_t* bytes;
+	size_t size;
+} WebPData;
+
+typedef struct WebPAnimEncoderOptions {
+	uint32_t bgcolor;
+	int loop_count;
+	int minimize_size;
+	int kmin;
+	int kmax;
+	int allow_mixed;
+	int verbose;
+	uint32_t padding[4];
+} WebPAnimEncoderOptions;
+
+typedef struct WebPAnimEncoder WebPAnimEncoder;
+
+int WebPAnimEncoderOptionsInitInternal(WebPAnimEncoderOptions*, int);
+WebPAnimEncoder* WebPAnimEncoderNewInternal(int, int, const WebPAnimEncoderOptions*, int);
+int WebPAnimEncoderAdd(WebPAnimEncoder*, WebPPicture*, int, const WebPConfig*);
+int WebPAnimEncoderAssemble(WebPAnimEncoder*, WebPData*);
+const char* WebPAnimEncoderGetError(WebPAnimEncoder*);
+void WebPAnimEncoderDelete(WebPAnimEncoder*);
+void WebPFree(void*);
+
+// nimWebPAnimEncoderNew returns an animation encoder for a canvas that plays
+// loops times, or forever for 0
+static WebPAnimEncoder* nimWebPAnimEncoderNew(int width, int height, int loops) {
+	WebPAnimEncoderOptions options;
+	if (!WebPAnimEncoderOptionsInitInternal(&options, WEBP_MUX_ABI_VERSION)) {
+		return NULL;
+	}
+	options.loop_count = loops;
+	options.bgcolor = 0; // Transparent
+	return WebPAnimEncoderNewInternal(width, height, &options, WEBP_MUX_ABI_VERSION);
+}
+
+// nimWebPAnimEncoderAdd adds RGBA pixels as the frame shown from timestamp,
+// in milliseconds
+static int nimWebPAnimEncoderAdd(WebPAnimEncoder* enc, const WebPConfig* config, const uint8_t* rgba, int width, int height, int stride, int timestamp) {
+	WebPPicture picture;
+	if (!WebPPictureInitInternal(&picture, WEBP_ENCODER_ABI_VERSION)) {
+		return 0;
+	}
+	picture.use_argb = 1;
+	picture.width = width;
+	picture.height = height;
+	if (!WebPPictureImportRGBA(&picture, rgba, stride)) {
+		WebPPictureFree(&picture);
+		return 0;
+	}
+	int ok = WebPAnimEncoderAdd(enc, &picture, timestamp, config);
+	WebPPictureFree(&picture);
+	return ok;
+}
+
+// nimWebPAnimEncoderAssemble ends the animation at timestamp and returns the
+// file, which the caller frees with WebPFree
+static int nimWebPAnimEncoderAssemble(WebPAnimEncoder* enc, int timestamp, WebPData* data) {
+	if (!WebPAnimEncoderAdd(enc, NULL, timestamp, NULL)) {
+		return 0;
+	}
+	data->bytes = NULL;
+	data->size = 0;
+	return WebPAnimEncoderAssemble(enc, data);
+}
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"slices"
+	"time"
+	"unsafe"
+
+	"github.com/chai2010/webp"
+	"github.com/disintegration/imaging"
+)
+
+// WebPOptions controls WebP output beyond ProcessOptions.Quality, which is
+// the lossy quality, or the compression effort of lossless output
+type WebPOptions struct {
+	Lossless     bool // Encode without loss
+	NearLossless int  // Lossless encoding after near-lossless preprocessing, from 1 (most loss) to 99 (least), as in cwebp; 0 or 100 is exact
+	Method       int  // Compression effort from 1 (fastest) to 6 (smallest files); 0 uses 4
+	AlphaQuality int  // Quality of the alpha channel of lossy output, from 1 to 100 (lossless); 0 uses 100
+	Exact        bool // Keep the RGB values of fully transparent pixels instead of clearing them for better compression
+}
+
+// lossless reports whether the output is lossless, so the quality sets the
+// effort instead
+func (o WebPOptions) lossless() bool {
+	return o.Lossless || o.NearLossless > 0 && o.NearLossless < 100
+}
+
+// webpErrors describes the libwebp VP8_ENC_ERROR codes
+var webpErrors = []string{
+	"no error",
+	"out of memory",
+	"out of memory while flushing bits",
+	"missing parameter",
+	"invalid configuration",
+	"invalid dimensions",
+	"first partition larger than 512KB",
+	"partition larger than 16MB",
+	"failed to write output",
+	"file larger than 4GB",
+	"aborted",
+}
+
+// EncodeWebP writes img as a WebP at a quality from 0 to 100 with options
+func EncodeWebP(w io.Writer, img image.Image, quality int, options WebPOptions) error {
+	src := imaging.Clone(img)
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	if width <= 0 || height <= 0 || width > 16383 || height > 16383 {
+		return fmt.Errorf("invalid WebP size: %dx%d (at most 16383x16383)", width, height)
+	}
+	config, err := webpConfig(quality, options)
+	if err != nil {
+		return err
+	}
+
+	var writer C.WebPMemoryWriter
+	code := C.nimWebPEncode(&config, (*C.uint8_t)(unsafe.Pointer(&src.Pix[0])), C.int(width), C.int(height), C.int(src.Stride), &writer)
+	defer C.WebPMemoryWriterClear(&writer)
+	if code != 0 {
+		if int(code) < len(webpErrors) {
+			return fmt.Errorf("WebP encoder failed: %s", webpErrors[code])
+		}
+		return fmt.Errorf("WebP encoder failed with error %d", int(code))
+	}
+	_, err = w.Write(C.GoBytes(unsafe.Pointer(writer.mem), C.int(writer.size)))
+	return err
+}
+
+// webpConfig returns the libwebp settings for a quality and options
+func webpConfig(quality int, options WebPOptions) (C.WebPConfig, error) {
+	var config C.WebPConfig
+	if options.NearLossless < 0 || options.NearLossless > 100 {
+		return config, fmt.Errorf("invalid WebP near-lossless level: %d (expected 1-100)", options.NearLossless)
+	}
+	if options.Method < 0 || options.Method > 6 {
+		return config, fmt.Errorf("invalid WebP method: %d (expected 1-6)", options.Method)
+	}
+	if options.AlphaQuality < 0 || options.AlphaQuality > 100 {
+		return config, fmt.Errorf("invalid WebP alpha quality: %d (expected 1-100)", options.AlphaQuality)
+	}
+	if C.nimWebPConfigInit(&config, C.float(max(0, min(100, quality)))) == 0 {
+		return config, fmt.Errorf("failed to configure WebP encoder")
+	}
+	if options.lossless() {
+		config.lossless = 1
+	}
+	if options.NearLossless > 0 {
+		config.near_lossless = C.int(options.NearLossless)
+	}
+	if options.Method > 0 {
+		config.method = C.int(options.Method)
+	}
+	if options.AlphaQuality > 0 {
+		config.alpha_quality = C.int(options.AlphaQuality)
+	}
+	if options.Exact {
+		config.exact = 1
+	}
+	if C.WebPValidateConfig(&config) == 0 {
+		return config, fmt.Errorf("invalid WebP encoder settings")
+	}
+	return config, nil
+}
+
+// webpAnimEncoder encodes the frames of an animated WebP with libwebp, which
+// stores only the part of each frame that changed
+type webpAnimEncoder struct {
+	enc       *C.WebPAnimEncoder
+	size      image.Point
+	timestamp time.Duration // When the next frame is shown
+}
+
+// newWebPAnimEncoder returns an encoder for frames of a size, playing loops
+// times or forever for 0. It must be closed.
+func newWebPAnimEncoder(size image.Point, loops int) (*webpAnimEncoder, error) {
+	if size.X <= 0 || size.Y <= 0 || size.X > 16383 || size.Y > 16383 {
+		return nil, fmt.Errorf("invalid WebP size: %dx%d (at most 16383x16383)", size.X, size.Y)
+	}
+	enc := C.nimWebPAnimEncoderNew(C.int(size.X), C.int(size.Y), C.int(min(loops, 65535)))
+	if enc == nil {
+		return nil, fmt.Errorf("failed to create WebP animation encoder")
+	}
+	return &webpAnimEncoder{enc: enc, size: size}, nil
+}
+
+// add encodes a frame shown for delay at a quality with options
+func (e *webpAnimEncoder) add(img *image.NRGBA, delay time.Duration, quality int, options WebPOptions) error {
+	if img.Rect.Size() != e.size {
+		return fmt.Errorf("frame size %dx%d differs from the animation size %dx%d", img.Rect.Dx(), img.Rect.Dy(), e.size.X, e.size.Y)
+	}
+	config, err := webpConfig(quality, options)
+	if err != nil {
+		return err
+	}
+	if C.nimWebPAnimEncoderAdd(e.enc, &config, (*C.uint8_t)(unsafe.Pointer(&img.Pix[0])), C.int(e.size.X), C.int(e.size.Y), C.int(img.Stride), C.int(e.timestamp.Milliseconds())) == 0 {
+		return fmt.Errorf("WebP animation encoder failed: %s", C.GoString(C.WebPAnimEncoderGetError(e.enc)))
+	}
+	e.timestamp += delay
+	return nil
+}
+
+// assemble returns the animated WebP file
+func (e *webpAnimEncoder) assemble() ([]byte, error) {
+	var data C.WebPData
+	if C.nimWebPAnimEncoderAssemble(e.enc, C.int(e.timestamp.Milliseconds()), &data) == 0 {
+		return nil, fmt.Errorf("WebP animation encoder failed: %s", C.GoString(C.WebPAnimEncoderGetError(e.enc)))
+	}
+	defer C.WebPFree(unsafe.Pointer(data.bytes))
+	return C.GoBytes(unsafe.Pointer(data.bytes), C.int(data.size)), nil
+}
+
+// close frees the encoder
+func (e *webpAnimEncoder) close() {
+	if e.enc != nil {
+		C.WebPAnimEncoderDelete(e.enc)
+		e.enc = nil
+	}
+}
+
+// webpChunk is a chunk of a WebP RIFF container
+type webpChunk struct {
+	id   string
+	data []byte
+}
+
+// readWebPChunks splits a WebP file into its chunks
+func readWebPChunks(data []byte) ([]webpChunk, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("not a WebP file")
+	}
+	var chunks []webpChunk
+	for pos := 12; pos < len(data); {
+		if pos+8 > len(data) {
+			return nil, fmt.Errorf("truncated WebP chunk")
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		if size < 0 || pos+8+size > len(data) {
+			return nil, fmt.Errorf("truncated WebP chunk")
+		}
+		chunks = append(chunks, webpChunk{string(data[pos : pos+4]), data[pos+8 : pos+8+size]})
+		pos += 8 + size + size%2
+	}
+	return chunks, nil
+}
+
+// writeWebPChunks joins chunks into a WebP file
+func writeWebPChunks(chunks []webpChunk) []byte {
+	out := []byte("RIFF\x00\x00\x00\x00WEBP")
+	for _, c := range chunks {
+		out = append(out, c.id...)
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(c.data)))
+		out = append(out, c.data...)
+		if len(c.data)%2 == 1 {
+			out = append(out, 0)
+		}
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out
+}
+
+// OptimizeWebP drops the EXIF and XMP metadata of a still WebP and, if it is
+// lossless, re-encodes it at the highest effort keeping every pixel value.
+// The ICC profile is kept. Lossy images are not re-encoded, and animations
+// are returned as they are, like files that cannot be made smaller.
+func OptimizeWebP(data []byte) ([]byte, error) {
+	chunks, err := readWebPChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	var kept []webpChunk
+	extended := -1
+	for _, c := range chunks {
+		switch c.id {
+		case "ANIM", "ANMF":
+			return data, nil
+		case "EXIF", "XMP ":
+		case "VP8X":
+			if len(c.data) < 10 {
+				return nil, fmt.Errorf("truncated WebP chunk")
+			}
+			extended = len(kept)
+			kept = append(kept, webpChunk{c.id, bytes.Clone(c.data)})
+		default:
+			kept = append(kept, c)
+		}
+	}
+
+	for i, c := range kept {
+		if c.id != "VP8L" {
+			continue
+		}
+		img, err := webp.DecodeRGBA(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode WebP: %w", err)
+		}
+		// The samples are not premultiplied
+		nrgba := &image.NRGBA{Pix: img.Pix, Stride: img.Stride, Rect: img.Rect}
+		var buf bytes.Buffer
+		if err := EncodeWebP(&buf, nrgba, 100, WebPOptions{Lossless: true, Method: 6, Exact: true}); err != nil {
+			return nil, err
+		}
+		encoded, err := readWebPChunks(buf.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if len(encoded) == 1 && encoded[0].id == "VP8L" && len(encoded[0].data) < len(c.data) {
+			kept[i] = encoded[0]
+		}
+	}
+
+	// The extended header is only needed for an ICC profile or a separate
+	// alpha chunk; otherwise its EXIF and XMP flags are cleared
+	if extended >= 0 {
+		needed := false
+		for _, c := range kept {
+			needed = needed || c.id == "ICCP" || c.id == "ALPH"
+		}
+		if needed {
+			kept[extended].data[0] &^= 0x08 | 0x04
+		} else {
+			kept = slices.DeleteFunc(kept, func(c webpChunk) bool { return c.id == "VP8X" })
+		}
+	}
+
+	optimized := writeWebPChunks(kept)
+	if len(optimized) < len(data) {
+		return optimized, nil
+	}
+	return data, nil
+}
@@ -0,0 +1,134 @@
+package image
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/chai2010/webp"
+	"nim/pkg/compare"
+)
+
+// encodeWebP encodes img and decodes the result, returning it with the size
+// of the file
+func encodeWebP(t *testing.T, img image.Image, quality int, options WebPOptions) (image.Image, int) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := EncodeWebP(&buf, img, quality, options); err != nil {
+		t.Fatalf("%+v: encode failed: %v", options, err)
+	}
+	size := buf.Len()
+	decoded, err := webp.Decode(&buf)
+	if err != nil {
+		t.Fatalf("%+v: decode failed: %v", options, err)
+	}
+	return decoded, size
+}
+
+func TestEncodeWebPLossless(t *testing.T) {
+	img := gradient(64, 48)
+	decoded, _ := encodeWebP(t, img, 75, WebPOptions{Lossless: true})
+	if !sameColors(img, decoded) {
+		t.Error("lossless output changed pixels")
+	}
+
+	// Near-lossless output is close but smaller
+	noisy := noise(64, 64)
+	_, exact := encodeWebP(t, noisy, 75, WebPOptions{Lossless: true})
+	near, size := encodeWebP(t, noisy, 75, WebPOptions{NearLossless: 20})
+	if size >= exact {
+		t.Errorf("near-lossless size %d, lossless %d", size, exact)
+	}
+	if result, _ := compare.Compare(noisy, near); result.PSNR < 30 {
+		t.Errorf("near-lossless PSNR %.1f dB", result.PSNR)
+	}
+}
+
+func TestEncodeWebPOptions(t *testing.T) {
+	img := noise(64, 64)
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 32; x++ {
+			c := img.NRGBAAt(x, y)
+			c.A = c.R
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	_, full := encodeWebP(t, img, 75, WebPOptions{})
+	_, alpha := encodeWebP(t, img, 75, WebPOptions{AlphaQuality: 10})
+	if alpha >= full {
+		t.Errorf("alpha quality 10 gives %d bytes, 100 gives %d", alpha, full)
+	}
+	for method := 1; method <= 6; method++ {
+		if decoded, _ := encodeWebP(t, img, 75, WebPOptions{Method: method}); decoded.Bounds() != img.Bounds() {
+			t.Errorf("method %d: decoded as %v", method, decoded.Bounds())
+		}
+	}
+
+	for _, options := range []WebPOptions{{Method: 7}, {NearLossless: 101}, {AlphaQuality: -1}} {
+		if err := EncodeWebP(&bytes.Buffer{}, img, 75, options); err == nil {
+			t.Errorf("%+v: expected an error", options)
+		}
+	}
+}
+
+func TestEncodeWebPExact(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	for i := 3; i < len(img.Pix); i += 8 {
+		img.Pix[i] = 0 // Every other pixel is transparent
+	}
+
+	// RGB values under transparent pixels survive only with Exact
+	for _, exact := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := EncodeWebP(&buf, img, 75, WebPOptions{Lossless: true, Exact: exact}); err != nil {
+			t.Fatal(err)
+		}
+		// DecodeRGBA returns the samples without premultiplying them
+		decoded, err := webp.DecodeRGBA(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		kept := bytes.Equal(decoded.Pix, img.Pix)
+		if kept != exact {
+			t.Errorf("exact %v: transparent RGB kept %v", exact, kept)
+		}
+	}
+}
+
+func TestOptimizeWebP(t *testing.T) {
+	img := noise(32, 32)
+	for _, lossless := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := EncodeWebP(&buf, img, 0, WebPOptions{Lossless: lossless, Method: 1, Exact: true}); err != nil {
+			t.Fatal(err)
+		}
+		chunks, _ := readWebPChunks(buf.Bytes())
+		// An extended header with EXIF data
+		header := []byte{0x08, 0, 0, 0, 31, 0, 0, 31, 0, 0}
+		chunks = append([]webpChunk{{"VP8X", header}}, append(chunks, webpChunk{"EXIF", []byte("exif data")})...)
+		data := writeWebPChunks(chunks)
+
+		optimized, err := OptimizeWebP(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(optimized) >= len(data) || bytes.Contains(optimized, []byte("exif data")) {
+			t.Errorf("lossless %v: optimized to %d bytes from %d", lossless, len(optimized), len(data))
+		}
+		a, _ := webp.DecodeRGBA(data)
+		b, err := webp.DecodeRGBA(optimized)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(a.Pix, b.Pix) {
+			t.Errorf("lossless %v: pixels changed", lossless)
+		}
+	}
+	if _, err := OptimizeWebP([]byte("RIFF")); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,298 @@
+// Package mark embeds and detects invisible watermarks: a short payload
+// hidden in the mid frequencies of the discrete cosine transform of an image,
+// for attribution and tracing leaks of distributed copies. The watermark
+// survives moderate JPEG recompression and resizing, but not cropping.
+package mark
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// Capacity is the largest payload in bytes
+const Capacity = 8
+
+const (
+	// canonical is the size images are scaled to, ignoring their aspect ratio,
+	// so a copy resized as a whole maps back onto the same grid
+	canonical = 256
+	// block is the size of the DCT blocks of the canonical image
+	block = 8
+	// messageBits is the number of bits embedded: the zero-padded payload and
+	// its CRC-32, which tells a watermark from noise
+	messageBits = (Capacity + 4) * 8
+	// target is the correlation each bit is embedded with at strength 1, in
+	// luma levels of orthonormal DCT coefficients
+	target = 6.0
+	// limit is the largest change of the coefficients of a bit at strength 1
+	limit = 20.0
+)
+
+// bands are the (horizontal, vertical) DCT frequencies of each block that
+// carry the watermark: high enough to be invisible, low enough to survive
+// compression and resizing
+var bands = [][2]int{{1, 2}, {2, 1}, {2, 2}, {1, 3}, {3, 1}, {3, 2}}
+
+// basis holds the orthonormal 8-point DCT-II basis, basis[u][x]
+var basis = func() (b [block][block]float64) {
+	for u := range block {
+		scale := math.Sqrt(2.0 / block)
+		if u == 0 {
+			scale = math.Sqrt(1.0 / block)
+		}
+		for x := range block {
+			b[u][x] = scale * math.Cos(float64(2*x+1)*float64(u)*math.Pi/(2*block))
+		}
+	}
+	return b
+}()
+
+// carrier is a DCT coefficient of the canonical image that carries a bit
+type carrier struct {
+	block int  // Index of the block, row by row
+	band  int  // Index in bands
+	bit   int  // Bit of the message
+	flip  bool // Whether the bit is embedded with the opposite sign
+}
+
+// layout spreads the bits of the message over all carriers in an order and
+// with signs derived from the key, so the watermark cannot be read or
+// removed without it
+func layout(key []byte) []carrier {
+	blocks := (canonical / block) * (canonical / block)
+	carriers := make([]carrier, blocks*len(bands))
+	for i := range carriers {
+		carriers[i] = carrier{block: i / len(bands), band: i % len(bands)}
+	}
+
+	// SHA-256 of the key and a counter is the random stream
+	var counter uint64
+	var pool []byte
+	next := func() uint64 {
+		if len(pool) < 8 {
+			h := sha256.New()
+			h.Write(key)
+			binary.Write(h, binary.LittleEndian, counter)
+			counter++
+			pool = h.Sum(nil)
+		}
+		v := binary.LittleEndian.Uint64(pool)
+		pool = pool[8:]
+		return v
+	}
+	for i := len(carriers) - 1; i > 0; i-- {
+		j := int(next() % uint64(i+1))
+		carriers[i], carriers[j] = carriers[j], carriers[i]
+	}
+	for i := range carriers {
+		carriers[i].bit = i % messageBits
+		carriers[i].flip = next()&1 != 0
+	}
+	return carriers
+}
+
+// sign returns the sign a carrier embeds a bit of value 1 with
+func (c carrier) sign() float64 {
+	if c.flip {
+		return -1
+	}
+	return 1
+}
+
+// luma returns the luma of img scaled to the canonical size, row by row
+func luma(img image.Image) []float64 {
+	small := imaging.Resize(img, canonical, canonical, imaging.Box)
+	values := make([]float64, canonical*canonical)
+	for i := range values {
+		p := small.Pix[i*4 : i*4+3 : i*4+3]
+		values[i] = 0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])
+	}
+	return values
+}
+
+// coefficient returns a DCT coefficient of a block of the canonical luma
+func coefficient(values []float64, blk, band int) float64 {
+	perRow := canonical / block
+	x0, y0 := blk%perRow*block, blk/perRow*block
+	u, v := bands[band][0], bands[band][1]
+	var sum float64
+	for y := range block {
+		row := values[(y0+y)*canonical+x0 : (y0+y)*canonical+x0+block]
+		var inner float64
+		for x, p := range row {
+			inner += basis[u][x] * p
+		}
+		sum += basis[v][y] * inner
+	}
+	return sum
+}
+
+// correlations returns the mean signed coefficient of the carriers of each
+// bit: positive for bits that are 1, negative for bits that are 0
+func correlations(values []float64, carriers []carrier) []float64 {
+	out := make([]float64, messageBits)
+	for _, c := range carriers {
+		out[c.bit] += c.sign() * coefficient(values, c.block, c.band)
+	}
+	for i := range out {
+		out[i] /= float64(len(carriers) / messageBits)
+	}
+	return out
+}
+
+// message returns the bits of the payload padded to Capacity and its CRC-32
+func message(payload []byte) []bool {
+	data := make([]byte, Capacity, Capacity+4)
+	copy(data, payload)
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+	bits := make([]bool, messageBits)
+	for i := range bits {
+		bits[i] = data[i/8]&(0x80>>(i%8)) != 0
+	}
+	return bits
+}
+
+// Embed returns a copy of img with payload hidden in it under key. Strength
+// scales how far the image is changed, trading visibility for robustness;
+// 1 is invisible in photos and survives JPEG quality 75 and halving the size.
+func Embed(img image.Image, key, payload []byte, strength float64) (*image.NRGBA, error) {
+	if len(key) == 0 {
+		return nil, errors.New("the watermark key is empty")
+	}
+	if len(payload) == 0 || len(payload) > Capacity {
+		return nil, fmt.Errorf("invalid payload of %d bytes (expected 1 to %d)", len(payload), Capacity)
+	}
+	if strength <= 0 {
+		return nil, fmt.Errorf("invalid strength: %g (expected more than 0)", strength)
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() < block || bounds.Dy() < block {
+		return nil, fmt.Errorf("the %dx%d image is too small to watermark", bounds.Dx(), bounds.Dy())
+	}
+
+	carriers := layout(key)
+	bits := message(payload)
+	src := imaging.Clone(img)
+	marked := src
+	// Changes of the carriers so far, and of the carriers of each bit
+	deltas := make([]float64, len(carriers))
+	spent := make([]float64, messageBits)
+	// Each pass measures the marked image and strengthens the bits that the
+	// image content, scaling and clipping left below the target
+	for range 3 {
+		corr := correlations(luma(marked), carriers)
+		changed := false
+		for i, c := range corr {
+			want := -1.0
+			if bits[i] {
+				want = 1
+			}
+			need := min(target*strength-want*c, limit*strength-spent[i])
+			if need <= 0.05 {
+				continue
+			}
+			spent[i] += need
+			changed = true
+			for k, cr := range carriers {
+				if cr.bit == i {
+					deltas[k] += want * cr.sign() * need
+				}
+			}
+		}
+		if !changed {
+			break
+		}
+		marked = apply(src, carriers, deltas)
+	}
+	return marked, nil
+}
+
+// apply adds the coefficient changes, transformed back to a canonical luma
+// pattern and scaled up to the size of src, to every color channel of src
+func apply(src *image.NRGBA, carriers []carrier, deltas []float64) *image.NRGBA {
+	pattern := make([]float64, canonical*canonical)
+	perRow := canonical / block
+	for k, c := range carriers {
+		d := deltas[k]
+		if d == 0 {
+			continue
+		}
+		x0, y0 := c.block%perRow*block, c.block/perRow*block
+		u, v := bands[c.band][0], bands[c.band][1]
+		for y := range block {
+			for x := range block {
+				pattern[(y0+y)*canonical+x0+x] += d * basis[u][x] * basis[v][y]
+			}
+		}
+	}
+
+	// Bilinear interpolation between the centers of the canonical pixels
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	type tap struct {
+		i0, i1 int
+		f      float64
+	}
+	taps := func(n int) []tap {
+		t := make([]tap, n)
+		for i := range t {
+			p := (float64(i)+0.5)*canonical/float64(n) - 0.5
+			p = min(max(p, 0), canonical-1)
+			i0 := int(p)
+			t[i] = tap{i0, min(i0+1, canonical-1), p - float64(i0)}
+		}
+		return t
+	}
+	cols, rows := taps(w), taps(h)
+
+	out := imaging.Clone(src)
+	for y, r := range rows {
+		row := out.Pix[y*out.Stride : y*out.Stride+w*4]
+		for x, c := range cols {
+			top := pattern[r.i0*canonical+c.i0]*(1-c.f) + pattern[r.i0*canonical+c.i1]*c.f
+			bottom := pattern[r.i1*canonical+c.i0]*(1-c.f) + pattern[r.i1*canonical+c.i1]*c.f
+			d := top*(1-r.f) + bottom*r.f
+			p := row[x*4 : x*4+3 : x*4+3]
+			for i := range p {
+				p[i] = uint8(min(max(math.Round(float64(p[i])+d), 0), 255))
+			}
+		}
+	}
+	return out
+}
+
+// Detection is the result of looking for a watermark
+type Detection struct {
+	Found   bool    // Whether a watermark of the key was found
+	Payload []byte  // Payload of the watermark, without its padding
+	Score   float64 // Mean strength of the bits relative to the embedding target; about 1 for an untouched image
+}
+
+// Detect looks for a watermark embedded under key in img
+func Detect(img image.Image, key []byte) Detection {
+	corr := correlations(luma(img), layout(key))
+	data := make([]byte, Capacity+4)
+	var score float64
+	for i, c := range corr {
+		if c > 0 {
+			data[i/8] |= 0x80 >> (i % 8)
+		}
+		score += math.Abs(c)
+	}
+	score /= float64(len(corr)) * target
+
+	if crc32.ChecksumIEEE(data[:Capacity]) != binary.BigEndian.Uint32(data[Capacity:]) {
+		return Detection{Score: score}
+	}
+	payload := data[:Capacity]
+	for len(payload) > 0 && payload[len(payload)-1] == 0 {
+		payload = payload[:len(payload)-1]
+	}
+	return Detection{Found: true, Payload: payload, Score: score}
+}
@@ -0,0 +1,93 @@
+package mark
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// photo returns a test image with smooth shading, edges and texture, like a
+// photo
+func photo(w, h int) *image.NRGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			v := 90 + 60*math.Sin(float64(x)/37)*math.Cos(float64(y)/23) + rng.Float64()*20
+			if (x-w/3)*(x-w/3)+(y-h/2)*(y-h/2) < h*h/9 {
+				v += 50
+			}
+			img.SetNRGBA(x, y, color.NRGBA{uint8(v), uint8(v * 0.9), uint8(v * 0.7), 255})
+		}
+	}
+	return img
+}
+
+// psnr returns the peak signal-to-noise ratio of two images of the same size
+func psnr(a, b *image.NRGBA) float64 {
+	var sum float64
+	for i := range a.Pix {
+		d := float64(a.Pix[i]) - float64(b.Pix[i])
+		sum += d * d
+	}
+	return 10 * math.Log10(255*255/(sum/float64(len(a.Pix))))
+}
+
+func TestEmbedDetect(t *testing.T) {
+	src := photo(640, 480)
+	key := []byte("secret")
+	marked, err := Embed(src, key, []byte("user-42"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := psnr(src, marked); got < 40 {
+		t.Errorf("expected the watermark to be invisible, got a PSNR of %.1f dB", got)
+	}
+
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, marked, &jpeg.Options{Quality: 75})
+	recompressed, _ := jpeg.Decode(&buf)
+	tests := map[string]image.Image{
+		"marked":       marked,
+		"jpeg 75":      recompressed,
+		"half size":    imaging.Resize(marked, 320, 240, imaging.Lanczos),
+		"stretched":    imaging.Resize(marked, 500, 480, imaging.Linear),
+		"resized jpeg": imaging.Resize(recompressed, 400, 300, imaging.Lanczos),
+	}
+	for name, img := range tests {
+		d := Detect(img, key)
+		if !d.Found || string(d.Payload) != "user-42" {
+			t.Errorf("%s: expected the payload, got %+v", name, d)
+		}
+	}
+
+	if d := Detect(marked, []byte("other")); d.Found {
+		t.Errorf("expected no watermark under another key, got %+v", d)
+	}
+	if d := Detect(src, key); d.Found {
+		t.Errorf("expected no watermark in the original, got %+v", d)
+	}
+}
+
+func TestEmbedErrors(t *testing.T) {
+	src := photo(64, 64)
+	for name, args := range map[string]struct {
+		key, payload []byte
+		strength     float64
+	}{
+		"empty key":     {nil, []byte("a"), 1},
+		"empty payload": {[]byte("k"), nil, 1},
+		"long payload":  {[]byte("k"), []byte("123456789"), 1},
+		"no strength":   {[]byte("k"), []byte("a"), 0},
+	} {
+		if _, err := Embed(src, args.key, args.payload, args.strength); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Package metrics keeps counters, gauges and histograms and writes them in
+// the Prometheus text exposition format, without depending on the
+// Prometheus client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds of histogram buckets in seconds, from
+// a fast resize to a slow AVIF encode
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Registry holds metrics and writes them in the order they were created
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// metric is a metric family that can write itself
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) add(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// desc is the name, help and label name of a metric family. Families have
+// at most one label; an empty label name means none.
+type desc struct {
+	name, help, label string
+}
+
+func (d desc) header(w *bufio.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, kind)
+}
+
+// series returns the name of a series with its label and extra labels
+func (d desc) series(suffix, value string, extra ...string) string {
+	var labels []string
+	if d.label != "" {
+		labels = append(labels, d.label+"="+strconv.Quote(value))
+	}
+	labels = append(labels, extra...)
+	name := d.name + suffix
+	if len(labels) == 0 {
+		return name
+	}
+	name += "{"
+	for i, label := range labels {
+		if i > 0 {
+			name += ","
+		}
+		name += label
+	}
+	return name + "}"
+}
+
+// Counter counts events, by the value of its label
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter registers a counter. label is the name of its label, or empty.
+func (r *Registry) NewCounter(name, help, label string) *Counter {
+	c := &Counter{desc: desc{name, help, label}, values: make(map[string]float64)}
+	r.add(c)
+	return c
+}
+
+// Inc adds one to the series with the label value
+func (c *Counter) Inc(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[value]++
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w, "counter")
+	for _, value := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s %s\n", c.series("", value), formatFloat(c.values[value]))
+	}
+}
+
+// Gauge is a value that goes up and down
+type Gauge struct {
+	desc
+	mu    sync.Mutex
+	value float64
+}
+
+// NewGauge registers a gauge without labels
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{desc: desc{name: name, help: help}}
+	r.add(g)
+	return g
+}
+
+// Add adds delta to the gauge
+func (g *Gauge) Add(delta float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value += delta
+}
+
+// Value returns the current value of the gauge
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.header(w, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.Value()))
+}
+
+// Histogram counts observations in buckets, by the value of its label
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // Per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram with the bucket upper bounds, which
+// must be sorted. label is the name of its label, or empty.
+func (r *Registry) NewHistogram(name, help, label string, buckets []float64) *Histogram {
+	h := &Histogram{desc: desc{name, help, label}, buckets: buckets, series: make(map[string]*histogramSeries)}
+	r.add(h)
+	return h
+}
+
+// Observe adds an observation to the series with the label value
+func (h *Histogram) Observe(value string, v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[value]
+	if s == nil {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[value] = s
+	}
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+// ObserveSince observes the seconds elapsed since start
+func (h *Histogram) ObserveSince(value string, start time.Time) {
+	h.Observe(value, time.Since(start).Seconds())
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w, "histogram")
+	for _, value := range sortedKeys(h.series) {
+		s := h.series[value]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s %d\n", h.desc.series("_bucket", value, `le="`+formatFloat(bound)+`"`), cumulative)
+		}
+		fmt.Fprintf(w, "%s %d\n", h.desc.series("_bucket", value, `le="+Inf"`), s.count)
+		fmt.Fprintf(w, "%s %s\n", h.desc.series("_sum", value), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s %d\n", h.desc.series("_count", value), s.count)
+	}
+}
+
+// WriteText writes every metric in the Prometheus text format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := slices.Clone(r.metrics)
+	r.mu.Unlock()
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the metrics to Prometheus
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	jobs := r.NewCounter("jobs_total", "Jobs run.", "status")
+	inFlight := r.NewGauge("in_flight", "Jobs running.")
+	duration := r.NewHistogram("duration_seconds", "Job duration.", "stage", []float64{0.1, 1})
+
+	jobs.Inc("ok")
+	jobs.Inc("ok")
+	jobs.Inc("error")
+	inFlight.Add(1)
+	duration.Observe("decode", 0.05)
+	duration.Observe("decode", 0.5)
+	duration.Observe("decode", 2)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP jobs_total Jobs run.
+# TYPE jobs_total counter
+jobs_total{status="error"} 1
+jobs_total{status="ok"} 2
+# HELP in_flight Jobs running.
+# TYPE in_flight gauge
+in_flight 1
+# HELP duration_seconds Job duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{stage="decode",le="0.1"} 1
+duration_seconds_bucket{stage="decode",le="1"} 2
+duration_seconds_bucket{stage="decode",le="+Inf"} 3
+duration_seconds_sum{stage="decode"} 2.55
+duration_seconds_count{stage="decode"} 3
+`
+	if got := b.String(); got != want {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", got, want)
+	}
+}
+
+func TestHistogramBounds(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("h", "Help.", "", []float64{1, 2})
+	// An observation on a bound falls in that bucket
+	h.Observe("", 1)
+
+	var b strings.Builder
+	r.WriteText(&b)
+	if !strings.Contains(b.String(), `h_bucket{le="1"} 1`) {
+		t.Errorf("expected the observation in the first bucket, got:\n%s", b.String())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewGauge("up", "Whether nim is up.").Add(1)
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+	if !strings.Contains(w.Body.String(), "up 1\n") {
+		t.Errorf("unexpected body:\n%s", w.Body.String())
+	}
+}
@@ -0,0 +1,356 @@
+// Package onnx runs ONNX models on the CPU in pure Go. It supports the
+// operators of convolutional image models such as the U²-Net family of
+// segmentation models, with float32 inference only: no training, no
+// quantized operators and no sequence types.
+package onnx
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"slices"
+	"time"
+)
+
+// Model is a parsed ONNX model
+type Model struct {
+	Inputs  []string // Names of the inputs to feed, without initializers
+	Outputs []string // Names of the outputs
+
+	nodes        []node
+	initializers map[string]*Tensor
+	shapes       map[string][]int
+	opset        int
+}
+
+// node is one operator of the graph
+type node struct {
+	op      string
+	name    string
+	inputs  []string
+	outputs []string
+	attrs   map[string]attribute
+}
+
+// attribute is an attribute of a node. Only the fields of its type are set.
+type attribute struct {
+	f      float32
+	i      int64
+	s      string
+	t      *Tensor
+	floats []float32
+	ints   []int64
+}
+
+// Load reads an ONNX model from a file
+func Load(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model: %w", err)
+	}
+	m, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse model %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Parse decodes an ONNX model from its protocol buffer encoding. Models that
+// use operators this package does not implement are rejected.
+func Parse(data []byte) (*Model, error) {
+	fs, err := fields(data)
+	if err != nil {
+		return nil, err
+	}
+	m := &Model{initializers: map[string]*Tensor{}, shapes: map[string][]int{}}
+	var graph []byte
+	for _, f := range fs {
+		switch f.number {
+		case 7:
+			graph = f.data
+		case 8:
+			// OperatorSetIdProto: domain 1, version 2
+			opset, err := fields(f.data)
+			if err != nil {
+				return nil, err
+			}
+			domain, version := "", 0
+			for _, o := range opset {
+				switch o.number {
+				case 1:
+					domain = string(o.data)
+				case 2:
+					version = int(o.value)
+				}
+			}
+			if domain == "" || domain == "ai.onnx" {
+				m.opset = version
+			}
+		}
+	}
+	if graph == nil {
+		return nil, fmt.Errorf("no graph in model")
+	}
+	if err := m.parseGraph(graph); err != nil {
+		return nil, err
+	}
+
+	for _, n := range m.nodes {
+		if _, ok := operators[n.op]; !ok {
+			return nil, fmt.Errorf("unsupported operator %s", n.op)
+		}
+	}
+	return m, nil
+}
+
+// parseGraph decodes a GraphProto
+func (m *Model) parseGraph(data []byte) error {
+	fs, err := fields(data)
+	if err != nil {
+		return err
+	}
+	var inputs []string
+	for _, f := range fs {
+		switch f.number {
+		case 1:
+			n, err := parseNode(f.data)
+			if err != nil {
+				return err
+			}
+			m.nodes = append(m.nodes, n)
+		case 5:
+			t, name, err := parseNamedTensor(f.data)
+			if err != nil {
+				return err
+			}
+			m.initializers[name] = t
+		case 11, 12:
+			name, shape, err := parseValueInfo(f.data)
+			if err != nil {
+				return err
+			}
+			m.shapes[name] = shape
+			if f.number == 11 {
+				inputs = append(inputs, name)
+			} else {
+				m.Outputs = append(m.Outputs, name)
+			}
+		}
+	}
+	for _, input := range inputs {
+		if _, ok := m.initializers[input]; !ok {
+			m.Inputs = append(m.Inputs, input)
+		}
+	}
+	return nil
+}
+
+// parseValueInfo decodes the name and tensor shape of a ValueInfoProto.
+// Dimensions without a fixed size are -1.
+func parseValueInfo(data []byte) (string, []int, error) {
+	// Each level holds the next one in the given field: the type in the
+	// ValueInfoProto, its tensor type, and the shape of the tensor type
+	var name string
+	var shape []byte
+	fs, err := fields(data)
+	for _, f := range fs {
+		switch f.number {
+		case 1:
+			name = string(f.data)
+		case 2:
+			shape = f.data
+		}
+	}
+	for _, number := range []int{1, 2} {
+		if err != nil || shape == nil {
+			break
+		}
+		var level []field
+		level, err = fields(shape)
+		shape = nil
+		for _, f := range level {
+			if f.number == number {
+				shape = f.data
+			}
+		}
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if shape == nil {
+		return name, nil, nil
+	}
+
+	dims, err := fields(shape)
+	if err != nil {
+		return "", nil, err
+	}
+	var out []int
+	for _, d := range dims {
+		if d.number != 1 {
+			continue
+		}
+		dim, err := fields(d.data)
+		if err != nil {
+			return "", nil, err
+		}
+		value := -1
+		for _, f := range dim {
+			if f.number == 1 && f.wire == wireVarint {
+				value = int(f.value)
+			}
+		}
+		out = append(out, value)
+	}
+	return name, out, nil
+}
+
+// parseNamedTensor decodes a TensorProto and its name
+func parseNamedTensor(data []byte) (*Tensor, string, error) {
+	t, err := parseTensor(data)
+	if err != nil {
+		return nil, "", err
+	}
+	fs, _ := fields(data)
+	name := ""
+	for _, f := range fs {
+		if f.number == 8 {
+			name = string(f.data)
+		}
+	}
+	return t, name, nil
+}
+
+// parseNode decodes a NodeProto
+func parseNode(data []byte) (node, error) {
+	fs, err := fields(data)
+	if err != nil {
+		return node{}, err
+	}
+	n := node{attrs: map[string]attribute{}}
+	for _, f := range fs {
+		switch f.number {
+		case 1:
+			n.inputs = append(n.inputs, string(f.data))
+		case 2:
+			n.outputs = append(n.outputs, string(f.data))
+		case 3:
+			n.name = string(f.data)
+		case 4:
+			n.op = string(f.data)
+		case 5:
+			name, a, err := parseAttribute(f.data)
+			if err != nil {
+				return node{}, err
+			}
+			n.attrs[name] = a
+		case 7:
+			if domain := string(f.data); domain != "" && domain != "ai.onnx" {
+				return node{}, fmt.Errorf("unsupported operator domain %s", domain)
+			}
+		}
+	}
+	return n, nil
+}
+
+// parseAttribute decodes an AttributeProto
+func parseAttribute(data []byte) (string, attribute, error) {
+	fs, err := fields(data)
+	if err != nil {
+		return "", attribute{}, err
+	}
+	var name string
+	var a attribute
+	for _, f := range fs {
+		switch f.number {
+		case 1:
+			name = string(f.data)
+		case 2:
+			a.f = math.Float32frombits(uint32(f.value))
+		case 3:
+			a.i = int64(f.value)
+		case 4:
+			a.s = string(f.data)
+		case 5:
+			a.t, err = parseTensor(f.data)
+		case 7:
+			a.floats, err = f.floats(a.floats)
+		case 8:
+			a.ints, err = f.ints(a.ints)
+		}
+		if err != nil {
+			return "", attribute{}, fmt.Errorf("attribute %s: %w", name, err)
+		}
+	}
+	return name, a, nil
+}
+
+// InputShape returns the shape the model declares for an input, with -1 for
+// dimensions of any size, or nil if it declares none
+func (m *Model) InputShape(name string) []int {
+	return m.shapes[name]
+}
+
+// Run runs the model on the named inputs and returns its outputs by name
+func (m *Model) Run(inputs map[string]*Tensor) (map[string]*Tensor, error) {
+	start := time.Now()
+	values := make(map[string]*Tensor, len(m.initializers)+len(inputs))
+	for name, t := range m.initializers {
+		values[name] = t
+	}
+	for _, name := range m.Inputs {
+		t, ok := inputs[name]
+		if !ok {
+			return nil, fmt.Errorf("missing input %s", name)
+		}
+		values[name] = t
+	}
+
+	// Intermediate values are dropped after their last use to save memory
+	last := map[string]int{}
+	for i, n := range m.nodes {
+		for _, input := range n.inputs {
+			last[input] = i
+		}
+	}
+
+	for i, n := range m.nodes {
+		in := make([]*Tensor, len(n.inputs))
+		for j, name := range n.inputs {
+			if name == "" {
+				continue
+			}
+			t, ok := values[name]
+			if !ok {
+				return nil, fmt.Errorf("%s %s: missing input %s", n.op, n.name, name)
+			}
+			in[j] = t
+		}
+		out, err := operators[n.op](m, &n, in)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", n.op, n.name, err)
+		}
+		for j, name := range n.outputs {
+			if j < len(out) && name != "" {
+				values[name] = out[j]
+			}
+		}
+		for _, name := range n.inputs {
+			if _, ok := m.initializers[name]; !ok && last[name] == i && !slices.Contains(m.Outputs, name) {
+				delete(values, name)
+			}
+		}
+	}
+
+	outputs := make(map[string]*Tensor, len(m.Outputs))
+	for _, name := range m.Outputs {
+		t, ok := values[name]
+		if !ok {
+			return nil, fmt.Errorf("model did not compute output %s", name)
+		}
+		outputs[name] = t
+	}
+	slog.Debug("ran model", "nodes", len(m.nodes), "duration", time.Since(start))
+	return outputs, nil
+}
@@ -0,0 +1,249 @@
+package onnx
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+// pb appends a protocol buffer field: a varint for uint64 values, and
+// length-delimited data for strings and bytes
+func pb(to []byte, number int, value any) []byte {
+	switch v := value.(type) {
+	case uint64:
+		to = binary.AppendUvarint(to, uint64(number)<<3|wireVarint)
+		return binary.AppendUvarint(to, v)
+	case string:
+		value = []byte(v)
+	}
+	data := value.([]byte)
+	to = binary.AppendUvarint(to, uint64(number)<<3|wireBytes)
+	to = binary.AppendUvarint(to, uint64(len(data)))
+	return append(to, data...)
+}
+
+// floatTensor encodes a float TensorProto with raw data
+func floatTensor(name string, shape []int, values []float32) []byte {
+	var t []byte
+	for _, d := range shape {
+		t = pb(t, 1, uint64(d))
+	}
+	t = pb(t, 2, uint64(typeFloat))
+	t = pb(t, 8, name)
+	raw := make([]byte, 0, len(values)*4)
+	for _, v := range values {
+		raw = binary.LittleEndian.AppendUint32(raw, math.Float32bits(v))
+	}
+	return pb(t, 9, raw)
+}
+
+// intTensor encodes an int64 TensorProto with int64_data
+func intTensor(name string, values ...int64) []byte {
+	t := pb(nil, 1, uint64(len(values)))
+	t = pb(t, 2, uint64(typeInt64))
+	t = pb(t, 8, name)
+	var packed []byte
+	for _, v := range values {
+		packed = binary.AppendUvarint(packed, uint64(v))
+	}
+	return pb(t, 7, packed)
+}
+
+// attr encodes an AttributeProto of an int, ints, string or tensor value
+func attr(name string, value any) []byte {
+	a := pb(nil, 1, name)
+	switch v := value.(type) {
+	case int:
+		a = pb(a, 3, uint64(v))
+	case []int:
+		for _, i := range v {
+			a = pb(a, 8, uint64(i))
+		}
+	case string:
+		a = pb(a, 4, v)
+	case []byte:
+		a = pb(a, 5, v)
+	}
+	return a
+}
+
+// nodeProto encodes a NodeProto
+func nodeProto(op string, inputs, outputs []string, attrs ...[]byte) []byte {
+	n := pb(nil, 4, op)
+	for _, i := range inputs {
+		n = pb(n, 1, i)
+	}
+	for _, o := range outputs {
+		n = pb(n, 2, o)
+	}
+	for _, a := range attrs {
+		n = pb(n, 5, a)
+	}
+	return n
+}
+
+// modelProto encodes a ModelProto of one graph
+func modelProto(opset int, inputs, outputs []string, initializers [][]byte, nodes ...[]byte) []byte {
+	var g []byte
+	for _, n := range nodes {
+		g = pb(g, 1, n)
+	}
+	for _, t := range initializers {
+		g = pb(g, 5, t)
+	}
+	for _, i := range inputs {
+		g = pb(g, 11, pb(nil, 1, i))
+	}
+	for _, o := range outputs {
+		g = pb(g, 12, pb(nil, 1, o))
+	}
+	m := pb(nil, 7, g)
+	return pb(m, 8, pb(nil, 2, uint64(opset)))
+}
+
+// near reports whether two floats are within 1e-4 of each other
+func near(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-4
+}
+
+func TestConv(t *testing.T) {
+	// A 3x3 box filter with a bias, padded to keep the size, then pooled
+	model := modelProto(13, []string{"x"}, []string{"y"},
+		[][]byte{
+			floatTensor("w", []int{1, 1, 3, 3}, []float32{1, 1, 1, 1, 1, 1, 1, 1, 1}),
+			floatTensor("b", []int{1}, []float32{0.5}),
+		},
+		nodeProto("Conv", []string{"x", "w", "b"}, []string{"c"}, attr("pads", []int{1, 1, 1, 1})),
+		nodeProto("Relu", []string{"c"}, []string{"r"}),
+		nodeProto("MaxPool", []string{"r"}, []string{"y"}, attr("kernel_shape", []int{2, 2}), attr("strides", []int{2, 2})),
+	)
+	m, err := Parse(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Inputs) != 1 || m.Inputs[0] != "x" {
+		t.Fatalf("expected input x without the initializers, got %v", m.Inputs)
+	}
+
+	x := NewFloat([]int{1, 1, 4, 4}, nil)
+	for i := range x.Float {
+		x.Float[i] = float32(i)
+	}
+	out, err := m.Run(map[string]*Tensor{"x": x})
+	if err != nil {
+		t.Fatal(err)
+	}
+	y := out["y"]
+	if len(y.Shape) != 4 || y.Shape[2] != 2 || y.Shape[3] != 2 {
+		t.Fatalf("expected a 2x2 output, got %v", y.Shape)
+	}
+	// The largest box sums of each quadrant, at its inner corner
+	for i, want := range []float32{45.5, 54.5, 81.5, 90.5} {
+		if !near(y.Float[i], want) {
+			t.Errorf("element %d: expected %g, got %g", i, want, y.Float[i])
+		}
+	}
+}
+
+func TestResizeLike(t *testing.T) {
+	// Upsampling to the size of another tensor as PyTorch exports it
+	model := modelProto(11, []string{"x", "like"}, []string{"y"},
+		[][]byte{intTensor("start", 2), intTensor("end", 4), intTensor("zero", 0)},
+		nodeProto("Shape", []string{"x"}, []string{"xs"}),
+		nodeProto("Slice", []string{"xs", "zero", "start"}, []string{"nc"}),
+		nodeProto("Shape", []string{"like"}, []string{"ls"}),
+		nodeProto("Slice", []string{"ls", "start", "end"}, []string{"hw"}),
+		nodeProto("Concat", []string{"nc", "hw"}, []string{"sizes"}, attr("axis", 0)),
+		nodeProto("Resize", []string{"x", "", "", "sizes"}, []string{"y"},
+			attr("mode", "linear"), attr("coordinate_transformation_mode", "half_pixel")),
+	)
+	m, err := Parse(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := m.Run(map[string]*Tensor{
+		"x":    NewFloat([]int{1, 1, 1, 2}, []float32{0, 4}),
+		"like": NewFloat([]int{1, 3, 1, 4}, nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	y := out["y"]
+	if y.Shape[3] != 4 {
+		t.Fatalf("expected a width of 4, got %v", y.Shape)
+	}
+	for i, want := range []float32{0, 1, 3, 4} {
+		if !near(y.Float[i], want) {
+			t.Errorf("element %d: expected %g, got %g", i, want, y.Float[i])
+		}
+	}
+}
+
+func TestBatchNormalization(t *testing.T) {
+	model := modelProto(13, []string{"x"}, []string{"y"},
+		[][]byte{
+			floatTensor("scale", []int{2}, []float32{2, 1}),
+			floatTensor("bias", []int{2}, []float32{1, 0}),
+			floatTensor("mean", []int{2}, []float32{1, 0}),
+			floatTensor("var", []int{2}, []float32{4, 1}),
+		},
+		nodeProto("BatchNormalization", []string{"x", "scale", "bias", "mean", "var"}, []string{"n"}, attr("epsilon", 0)),
+		nodeProto("Sigmoid", []string{"n"}, []string{"y"}),
+	)
+	m, err := Parse(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := m.Run(map[string]*Tensor{"x": NewFloat([]int{1, 2, 1, 1}, []float32{3, 0})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// (3-1)/2*2+1 = 3 and 0
+	for i, want := range []float32{0.952574, 0.5} {
+		if got := out["y"].Float[i]; !near(got, want) {
+			t.Errorf("element %d: expected %g, got %g", i, want, got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	unsupported := modelProto(13, []string{"x"}, []string{"y"}, nil, nodeProto("LSTM", []string{"x"}, []string{"y"}))
+	if _, err := Parse(unsupported); err == nil || !strings.Contains(err.Error(), "LSTM") {
+		t.Errorf("expected an unsupported operator error, got %v", err)
+	}
+	if _, err := Parse([]byte{0x3a, 0x10, 0x01}); err == nil {
+		t.Error("expected an error for a truncated model")
+	}
+
+	m, err := Parse(modelProto(13, []string{"x"}, []string{"y"}, nil, nodeProto("Relu", []string{"x"}, []string{"y"})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Run(nil); err == nil {
+		t.Error("expected an error for a missing input")
+	}
+}
+
+func TestInputShape(t *testing.T) {
+	// A batch of any size of 3x320x320 images
+	var shape []byte
+	shape = pb(shape, 1, pb(nil, 2, "batch"))
+	for _, d := range []int{3, 320, 320} {
+		shape = pb(shape, 1, pb(nil, 1, uint64(d)))
+	}
+	tensorType := pb(pb(nil, 1, uint64(typeFloat)), 2, shape)
+	info := pb(pb(nil, 1, "x"), 2, pb(nil, 1, tensorType))
+
+	var g []byte
+	g = pb(g, 1, nodeProto("Relu", []string{"x"}, []string{"y"}))
+	g = pb(g, 11, info)
+	g = pb(g, 12, pb(nil, 1, "y"))
+	m, err := Parse(pb(nil, 7, g))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.InputShape("x"); len(got) != 4 || got[0] != -1 || got[1] != 3 || got[3] != 320 {
+		t.Errorf("expected [-1 3 320 320], got %v", got)
+	}
+}
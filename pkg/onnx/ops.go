@@ -0,0 +1,1032 @@
+package onnx
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// operator computes the outputs of a node from its inputs. Inputs that are
+// left out are nil. Operators never change their inputs.
+type operator func(m *Model, n *node, in []*Tensor) ([]*Tensor, error)
+
+// operators are the supported operators by type
+var operators map[string]operator
+
+func init() {
+	operators = map[string]operator{
+		"Add":                opAdd,
+		"AveragePool":        opAveragePool,
+		"BatchNormalization": opBatchNormalization,
+		"Cast":               opCast,
+		"Ceil":               unary(func(v float32) float32 { return float32(math.Ceil(float64(v))) }),
+		"Clip":               opClip,
+		"Concat":             opConcat,
+		"Constant":           opConstant,
+		"ConstantOfShape":    opConstantOfShape,
+		"Conv":               opConv,
+		"Div":                opDiv,
+		"Dropout":            opIdentity,
+		"Exp":                unary(func(v float32) float32 { return float32(math.Exp(float64(v))) }),
+		"Flatten":            opFlatten,
+		"Floor":              unary(func(v float32) float32 { return float32(math.Floor(float64(v))) }),
+		"Gather":             opGather,
+		"GlobalAveragePool":  opGlobalAveragePool,
+		"Identity":           opIdentity,
+		"LeakyRelu":          opLeakyRelu,
+		"MaxPool":            opMaxPool,
+		"Mul":                opMul,
+		"Relu":               unary(func(v float32) float32 { return max(v, 0) }),
+		"Reshape":            opReshape,
+		"Resize":             opResize,
+		"Shape":              opShape,
+		"Sigmoid":            unary(func(v float32) float32 { return float32(1 / (1 + math.Exp(-float64(v)))) }),
+		"Slice":              opSlice,
+		"Sqrt":               unary(func(v float32) float32 { return float32(math.Sqrt(float64(v))) }),
+		"Squeeze":            opSqueeze,
+		"Sub":                opSub,
+		"Tanh":               unary(func(v float32) float32 { return float32(math.Tanh(float64(v))) }),
+		"Transpose":          opTranspose,
+		"Unsqueeze":          opUnsqueeze,
+		"Upsample":           opResize,
+	}
+}
+
+// int returns an integer attribute of the node, or def if it is not set
+func (n *node) int(name string, def int64) int64 {
+	if a, ok := n.attrs[name]; ok {
+		return a.i
+	}
+	return def
+}
+
+// float returns a float attribute of the node, or def if it is not set
+func (n *node) float(name string, def float32) float32 {
+	if a, ok := n.attrs[name]; ok {
+		return a.f
+	}
+	return def
+}
+
+// str returns a string attribute of the node, or def if it is not set
+func (n *node) str(name, def string) string {
+	if a, ok := n.attrs[name]; ok {
+		return a.s
+	}
+	return def
+}
+
+// ints returns an integer list attribute of the node as ints
+func (n *node) ints(name string) []int {
+	a, ok := n.attrs[name]
+	if !ok {
+		return nil
+	}
+	out := make([]int, len(a.ints))
+	for i, v := range a.ints {
+		out[i] = int(v)
+	}
+	return out
+}
+
+// input returns the ith input, or nil if it is left out
+func input(in []*Tensor, i int) *Tensor {
+	if i < len(in) {
+		return in[i]
+	}
+	return nil
+}
+
+// axis returns an axis of a tensor of the given rank, counting negative axes
+// from the end
+func axis(a, rank int) (int, error) {
+	if a < 0 {
+		a += rank
+	}
+	if a < 0 || a >= rank {
+		return 0, fmt.Errorf("axis %d out of range for rank %d", a, rank)
+	}
+	return a, nil
+}
+
+func opIdentity(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	return []*Tensor{in[0]}, nil
+}
+
+// unary returns an operator that applies fn to every element of a float
+// tensor
+func unary(fn func(float32) float32) operator {
+	return func(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+		x := in[0].floats()
+		out := NewFloat(slices.Clone(in[0].Shape), nil)
+		parallel(len(x), func(lo, hi int) {
+			for i := lo; i < hi; i++ {
+				out.Float[i] = fn(x[i])
+			}
+		})
+		return []*Tensor{out}, nil
+	}
+}
+
+func opLeakyRelu(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	alpha := n.float("alpha", 0.01)
+	return unary(func(v float32) float32 {
+		if v < 0 {
+			return v * alpha
+		}
+		return v
+	})(m, n, in)
+}
+
+func opClip(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	lo, hi := n.float("min", -math.MaxFloat32), n.float("max", math.MaxFloat32)
+	if t := input(in, 1); t != nil {
+		lo = t.floats()[0]
+	}
+	if t := input(in, 2); t != nil {
+		hi = t.floats()[0]
+	}
+	return unary(func(v float32) float32 { return min(max(v, lo), hi) })(m, n, in)
+}
+
+// elementwise returns the elementwise result of two tensors broadcast together,
+// computed with floats or, if both are integer tensors, with ints
+func elementwise(a, b *Tensor, floats func(x, y float32) float32, ints func(x, y int64) int64) (*Tensor, error) {
+	shape, err := broadcastShape(a.Shape, b.Shape)
+	if err != nil {
+		return nil, err
+	}
+	ia, ib := broadcastIndex(a.Shape, shape), broadcastIndex(b.Shape, shape)
+	at := func(index []int, i int) int {
+		if index == nil {
+			return i
+		}
+		return index[i]
+	}
+
+	if a.isInt() && b.isInt() {
+		out := newInt(shape, nil)
+		for i := range out.Int {
+			out.Int[i] = ints(a.Int[at(ia, i)], b.Int[at(ib, i)])
+		}
+		return out, nil
+	}
+	x, y := a.floats(), b.floats()
+	out := NewFloat(shape, nil)
+	parallel(len(out.Float), func(lo, hi int) {
+		if ia == nil && ib == nil {
+			for i := lo; i < hi; i++ {
+				out.Float[i] = floats(x[i], y[i])
+			}
+			return
+		}
+		for i := lo; i < hi; i++ {
+			out.Float[i] = floats(x[at(ia, i)], y[at(ib, i)])
+		}
+	})
+	return out, nil
+}
+
+func opAdd(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	out, err := elementwise(in[0], in[1], func(x, y float32) float32 { return x + y }, func(x, y int64) int64 { return x + y })
+	return []*Tensor{out}, err
+}
+
+func opSub(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	out, err := elementwise(in[0], in[1], func(x, y float32) float32 { return x - y }, func(x, y int64) int64 { return x - y })
+	return []*Tensor{out}, err
+}
+
+func opMul(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	out, err := elementwise(in[0], in[1], func(x, y float32) float32 { return x * y }, func(x, y int64) int64 { return x * y })
+	return []*Tensor{out}, err
+}
+
+func opDiv(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	out, err := elementwise(in[0], in[1], func(x, y float32) float32 { return x / y }, func(x, y int64) int64 {
+		if y == 0 {
+			return 0
+		}
+		return x / y
+	})
+	return []*Tensor{out}, err
+}
+
+func opConstant(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	for name, a := range n.attrs {
+		switch name {
+		case "value":
+			return []*Tensor{a.t}, nil
+		case "value_float":
+			return []*Tensor{NewFloat([]int{}, []float32{a.f})}, nil
+		case "value_floats":
+			return []*Tensor{NewFloat([]int{len(a.floats)}, a.floats)}, nil
+		case "value_int":
+			return []*Tensor{newInt([]int{}, []int64{a.i})}, nil
+		case "value_ints":
+			return []*Tensor{newInt([]int{len(a.ints)}, slices.Clone(a.ints))}, nil
+		}
+	}
+	return nil, fmt.Errorf("no supported value")
+}
+
+func opConstantOfShape(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	shape := toInts(in[0].ints())
+	value := NewFloat([]int{1}, []float32{0})
+	if a, ok := n.attrs["value"]; ok {
+		value = a.t
+	}
+	if value.isInt() {
+		out := newInt(shape, nil)
+		for i := range out.Int {
+			out.Int[i] = value.Int[0]
+		}
+		return []*Tensor{out}, nil
+	}
+	out := NewFloat(shape, nil)
+	for i := range out.Float {
+		out.Float[i] = value.Float[0]
+	}
+	return []*Tensor{out}, nil
+}
+
+func opCast(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	switch to := n.int("to", typeFloat); to {
+	case typeFloat, typeDouble, typeFloat16:
+		return []*Tensor{NewFloat(slices.Clone(in[0].Shape), slices.Clone(in[0].floats()))}, nil
+	case typeBool:
+		ints := in[0].ints()
+		out := newInt(slices.Clone(in[0].Shape), nil)
+		for i, v := range ints {
+			if v != 0 {
+				out.Int[i] = 1
+			}
+		}
+		return []*Tensor{out}, nil
+	case typeUint8, typeInt8, typeUint16, typeInt16, typeInt32, typeInt64, typeUint32, typeUint64:
+		return []*Tensor{newInt(slices.Clone(in[0].Shape), slices.Clone(in[0].ints()))}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %d", to)
+	}
+}
+
+func opShape(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	shape := in[0].Shape
+	start, end := int(n.int("start", 0)), int(n.int("end", int64(len(shape))))
+	start, end = clampRange(start, len(shape)), clampRange(end, len(shape))
+	dims := make([]int64, 0, len(shape))
+	for _, d := range shape[start:max(start, end)] {
+		dims = append(dims, int64(d))
+	}
+	return []*Tensor{newInt([]int{len(dims)}, dims)}, nil
+}
+
+// clampRange clamps an index that counts from the end when negative to
+// [0, n]
+func clampRange(i, n int) int {
+	if i < 0 {
+		i += n
+	}
+	return min(max(i, 0), n)
+}
+
+// toInts converts int64 values to ints
+func toInts(values []int64) []int {
+	out := make([]int, len(values))
+	for i, v := range values {
+		out[i] = int(v)
+	}
+	return out
+}
+
+func opReshape(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	target := toInts(in[1].ints())
+	shape := make([]int, len(target))
+	infer := -1
+	known := 1
+	for i, d := range target {
+		switch {
+		case d == 0 && n.int("allowzero", 0) == 0:
+			if i >= len(in[0].Shape) {
+				return nil, fmt.Errorf("cannot copy dimension %d of shape %v", i, in[0].Shape)
+			}
+			shape[i] = in[0].Shape[i]
+		case d == -1:
+			infer = i
+			continue
+		default:
+			shape[i] = d
+		}
+		known *= shape[i]
+	}
+	if infer >= 0 {
+		if known == 0 || in[0].Len()%known != 0 {
+			return nil, fmt.Errorf("cannot reshape %v to %v", in[0].Shape, target)
+		}
+		shape[infer] = in[0].Len() / known
+	}
+	if size(shape) != in[0].Len() {
+		return nil, fmt.Errorf("cannot reshape %v to %v", in[0].Shape, target)
+	}
+	return []*Tensor{in[0].reshaped(shape)}, nil
+}
+
+func opFlatten(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	rank := len(in[0].Shape)
+	a := int(n.int("axis", 1))
+	if a < 0 {
+		a += rank
+	}
+	if a < 0 || a > rank {
+		return nil, fmt.Errorf("axis %d out of range for rank %d", a, rank)
+	}
+	return []*Tensor{in[0].reshaped([]int{size(in[0].Shape[:a]), size(in[0].Shape[a:])})}, nil
+}
+
+// axesOf returns the axes of a node, given as an input from opset 13 or as
+// an attribute before
+func axesOf(n *node, in []*Tensor) []int {
+	if t := input(in, 1); t != nil {
+		return toInts(t.ints())
+	}
+	return n.ints("axes")
+}
+
+func opUnsqueeze(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	axes := axesOf(n, in)
+	rank := len(in[0].Shape) + len(axes)
+	shape := make([]int, 0, rank)
+	inserted := make([]bool, rank)
+	for _, a := range axes {
+		a, err := axis(a, rank)
+		if err != nil {
+			return nil, err
+		}
+		inserted[a] = true
+	}
+	rest := in[0].Shape
+	for i := range rank {
+		if inserted[i] {
+			shape = append(shape, 1)
+		} else if len(rest) > 0 {
+			shape, rest = append(shape, rest[0]), rest[1:]
+		}
+	}
+	return []*Tensor{in[0].reshaped(shape)}, nil
+}
+
+func opSqueeze(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	rank := len(in[0].Shape)
+	axes := axesOf(n, in)
+	remove := make([]bool, rank)
+	for _, a := range axes {
+		a, err := axis(a, rank)
+		if err != nil {
+			return nil, err
+		}
+		remove[a] = true
+	}
+	var shape []int
+	for i, d := range in[0].Shape {
+		if axes == nil && d == 1 || remove[i] {
+			continue
+		}
+		shape = append(shape, d)
+	}
+	if shape == nil {
+		shape = []int{}
+	}
+	return []*Tensor{in[0].reshaped(shape)}, nil
+}
+
+func opConcat(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	var parts []*Tensor
+	for _, t := range in {
+		if t != nil {
+			parts = append(parts, t)
+		}
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no inputs")
+	}
+	rank := len(parts[0].Shape)
+	a, err := axis(int(n.int("axis", 0)), rank)
+	if err != nil {
+		return nil, err
+	}
+	integer := true
+	shape := slices.Clone(parts[0].Shape)
+	shape[a] = 0
+	for _, t := range parts {
+		if len(t.Shape) != rank {
+			return nil, fmt.Errorf("inputs of rank %d and %d", rank, len(t.Shape))
+		}
+		shape[a] += t.Shape[a]
+		integer = integer && t.isInt()
+	}
+
+	outer := size(shape[:a])
+	var out *Tensor
+	if integer {
+		out = newInt(shape, nil)
+	} else {
+		out = NewFloat(shape, nil)
+	}
+	offset := 0
+	for i := range outer {
+		for _, t := range parts {
+			block := size(t.Shape[a:])
+			if integer {
+				offset += copy(out.Int[offset:], t.Int[i*block:(i+1)*block])
+			} else {
+				offset += copy(out.Float[offset:], t.floats()[i*block:(i+1)*block])
+			}
+		}
+	}
+	return []*Tensor{out}, nil
+}
+
+func opGather(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	data, indices := in[0], in[1]
+	rank := len(data.Shape)
+	a, err := axis(int(n.int("axis", 0)), rank)
+	if err != nil {
+		return nil, err
+	}
+	dim := data.Shape[a]
+	index := toInts(indices.ints())
+	for i, v := range index {
+		if v < 0 {
+			v += dim
+		}
+		if v < 0 || v >= dim {
+			return nil, fmt.Errorf("index %d out of range for dimension %d", index[i], dim)
+		}
+		index[i] = v
+	}
+
+	shape := append(append(slices.Clone(data.Shape[:a]), indices.Shape...), data.Shape[a+1:]...)
+	dataStrides := strides(data.Shape)
+	k := len(indices.Shape)
+	idxStrides := strides(indices.Shape)
+	return []*Tensor{data.remap(shape, func(pos []int) int {
+		flat, at := 0, 0
+		for d := range a {
+			flat += pos[d] * dataStrides[d]
+		}
+		for d := range k {
+			at += pos[a+d] * idxStrides[d]
+		}
+		flat += index[at] * dataStrides[a]
+		for d := a + 1; d < rank; d++ {
+			flat += pos[d+k-1] * dataStrides[d]
+		}
+		return flat
+	})}, nil
+}
+
+func opSlice(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	data := in[0]
+	rank := len(data.Shape)
+	var starts, ends, axes, steps []int
+	if input(in, 1) != nil {
+		starts, ends = toInts(in[1].ints()), toInts(in[2].ints())
+		if t := input(in, 3); t != nil {
+			axes = toInts(t.ints())
+		}
+		if t := input(in, 4); t != nil {
+			steps = toInts(t.ints())
+		}
+	} else {
+		starts, ends, axes = n.ints("starts"), n.ints("ends"), n.ints("axes")
+	}
+
+	first, step := make([]int, rank), make([]int, rank)
+	shape := slices.Clone(data.Shape)
+	for i := range rank {
+		step[i] = 1
+	}
+	for i := range starts {
+		a := i
+		if axes != nil {
+			var err error
+			if a, err = axis(axes[i], rank); err != nil {
+				return nil, err
+			}
+		}
+		s := 1
+		if steps != nil {
+			s = steps[i]
+		}
+		if s == 0 {
+			return nil, fmt.Errorf("step of 0")
+		}
+		dim := data.Shape[a]
+		start, end := starts[i], ends[i]
+		if start < 0 {
+			start += dim
+		}
+		if end < 0 {
+			end += dim
+		}
+		if s > 0 {
+			start, end = min(max(start, 0), dim), min(max(end, 0), dim)
+			shape[a] = max(0, (end-start+s-1)/s)
+		} else {
+			start, end = min(max(start, 0), dim-1), min(max(end, -1), dim-1)
+			shape[a] = max(0, (start-end-s-1)/-s)
+		}
+		first[a], step[a] = start, s
+	}
+
+	dataStrides := strides(data.Shape)
+	return []*Tensor{data.remap(shape, func(pos []int) int {
+		flat := 0
+		for d, p := range pos {
+			flat += (first[d] + p*step[d]) * dataStrides[d]
+		}
+		return flat
+	})}, nil
+}
+
+func opTranspose(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	rank := len(in[0].Shape)
+	perm := n.ints("perm")
+	if perm == nil {
+		perm = make([]int, rank)
+		for i := range perm {
+			perm[i] = rank - 1 - i
+		}
+	}
+	if len(perm) != rank {
+		return nil, fmt.Errorf("permutation %v for rank %d", perm, rank)
+	}
+	shape := make([]int, rank)
+	for i, p := range perm {
+		shape[i] = in[0].Shape[p]
+	}
+	dataStrides := strides(in[0].Shape)
+	return []*Tensor{in[0].remap(shape, func(pos []int) int {
+		flat := 0
+		for i, p := range perm {
+			flat += pos[i] * dataStrides[p]
+		}
+		return flat
+	})}, nil
+}
+
+// spatial returns the batch size, channels, height and width of an NCHW
+// tensor
+func spatial(t *Tensor) (int, int, int, int, error) {
+	if len(t.Shape) != 4 || t.isInt() {
+		return 0, 0, 0, 0, fmt.Errorf("expected a 4D float tensor, got shape %v", t.Shape)
+	}
+	return t.Shape[0], t.Shape[1], t.Shape[2], t.Shape[3], nil
+}
+
+func opBatchNormalization(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	batch, channels, h, w, err := spatial(in[0])
+	if err != nil {
+		return nil, err
+	}
+	scale, bias, mean, variance := in[1].floats(), in[2].floats(), in[3].floats(), in[4].floats()
+	epsilon := n.float("epsilon", 1e-5)
+	x := in[0].Float
+	out := NewFloat(slices.Clone(in[0].Shape), nil)
+	plane := h * w
+	parallel(batch*channels, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			c := i % channels
+			k := scale[c] / float32(math.Sqrt(float64(variance[c]+epsilon)))
+			b := bias[c] - mean[c]*k
+			src, dst := x[i*plane:(i+1)*plane], out.Float[i*plane:(i+1)*plane]
+			for j, v := range src {
+				dst[j] = v*k + b
+			}
+		}
+	})
+	return []*Tensor{out}, nil
+}
+
+// window is the geometry of a 2D convolution or pooling window
+type window struct {
+	kh, kw        int // Kernel size
+	sy, sx        int // Strides
+	dy, dx        int // Dilations
+	top, left     int // Padding before
+	bottom, right int // Padding after
+}
+
+// newWindow reads the window attributes of a node for a kernel of kh x kw
+// over an input of h x w
+func newWindow(n *node, kh, kw, h, w int) (window, error) {
+	win := window{kh: kh, kw: kw, sy: 1, sx: 1, dy: 1, dx: 1}
+	if s := n.ints("strides"); len(s) == 2 {
+		win.sy, win.sx = s[0], s[1]
+	}
+	if d := n.ints("dilations"); len(d) == 2 {
+		win.dy, win.dx = d[0], d[1]
+	}
+	if p := n.ints("pads"); len(p) == 4 {
+		win.top, win.left, win.bottom, win.right = p[0], p[1], p[2], p[3]
+	}
+	switch pad := n.str("auto_pad", "NOTSET"); pad {
+	case "NOTSET", "VALID":
+		if pad == "VALID" {
+			win.top, win.left, win.bottom, win.right = 0, 0, 0, 0
+		}
+	case "SAME_UPPER", "SAME_LOWER":
+		// Pad so the output is the input size divided by the stride
+		for _, axis := range []struct {
+			in, k, s, d   int
+			before, after *int
+		}{{h, kh, win.sy, win.dy, &win.top, &win.bottom}, {w, kw, win.sx, win.dx, &win.left, &win.right}} {
+			out := (axis.in + axis.s - 1) / axis.s
+			total := max(0, (out-1)*axis.s+(axis.k-1)*axis.d+1-axis.in)
+			*axis.before, *axis.after = total/2, total-total/2
+			if pad == "SAME_LOWER" {
+				*axis.before, *axis.after = *axis.after, *axis.before
+			}
+		}
+	default:
+		return window{}, fmt.Errorf("unsupported auto_pad %s", pad)
+	}
+	if win.sy <= 0 || win.sx <= 0 || win.dy <= 0 || win.dx <= 0 {
+		return window{}, fmt.Errorf("invalid strides or dilations")
+	}
+	return win, nil
+}
+
+// outputSize returns the output size of the window over an input of h x w,
+// rounding up with ceil
+func (win window) outputSize(h, w int, ceil bool) (int, int) {
+	size := func(in, k, s, d, before, after int) int {
+		span := in + before + after - ((k-1)*d + 1)
+		if span < 0 {
+			return 0
+		}
+		if !ceil {
+			return span/s + 1
+		}
+		out := (span+s-1)/s + 1
+		// The last window has to start inside the input or the padding before
+		if (out-1)*s >= in+before {
+			out--
+		}
+		return out
+	}
+	return size(h, win.kh, win.sy, win.dy, win.top, win.bottom), size(w, win.kw, win.sx, win.dx, win.left, win.right)
+}
+
+func opConv(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	batch, channels, h, w, err := spatial(in[0])
+	if err != nil {
+		return nil, err
+	}
+	weights := in[1]
+	if len(weights.Shape) != 4 {
+		return nil, fmt.Errorf("only 2D convolutions are supported, got weights of shape %v", weights.Shape)
+	}
+	filters, perGroup, kh, kw := weights.Shape[0], weights.Shape[1], weights.Shape[2], weights.Shape[3]
+	group := int(n.int("group", 1))
+	if group <= 0 || channels != perGroup*group || filters%group != 0 {
+		return nil, fmt.Errorf("weights of shape %v do not match %d channels in %d groups", weights.Shape, channels, group)
+	}
+	var bias []float32
+	if t := input(in, 2); t != nil {
+		bias = t.floats()
+	}
+	win, err := newWindow(n, kh, kw, h, w)
+	if err != nil {
+		return nil, err
+	}
+	oh, ow := win.outputSize(h, w, false)
+
+	x, wt := in[0].Float, weights.floats()
+	out := NewFloat([]int{batch, filters, oh, ow}, nil)
+	filtersPerGroup := filters / group
+	parallel(batch*filters, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			b, f := i/filters, i%filters
+			dst := out.Float[i*oh*ow : (i+1)*oh*ow]
+			if bias != nil {
+				for j := range dst {
+					dst[j] = bias[f]
+				}
+			}
+			first := f / filtersPerGroup * perGroup
+			for c := range perGroup {
+				src := x[(b*channels+first+c)*h*w : (b*channels+first+c+1)*h*w]
+				kernel := wt[(f*perGroup+c)*kh*kw : (f*perGroup+c+1)*kh*kw]
+				win.accumulate(dst, oh, ow, src, h, w, kernel)
+			}
+		}
+	})
+	return []*Tensor{out}, nil
+}
+
+// accumulate adds the convolution of the h x w plane src with kernel to the
+// oh x ow plane dst
+func (win window) accumulate(dst []float32, oh, ow int, src []float32, h, w int, kernel []float32) {
+	for ky := range win.kh {
+		for kx := range win.kw {
+			k := kernel[ky*win.kw+kx]
+			if k == 0 {
+				continue
+			}
+			// Output columns whose input column is inside the plane
+			offset := kx*win.dx - win.left
+			x0 := max(0, (-offset+win.sx-1)/win.sx)
+			x1 := min(ow, (w-offset+win.sx-1)/win.sx)
+			if x0 >= x1 {
+				continue
+			}
+			for oy := range oh {
+				iy := oy*win.sy + ky*win.dy - win.top
+				if iy < 0 || iy >= h {
+					continue
+				}
+				row := src[iy*w : (iy+1)*w]
+				out := dst[oy*ow+x0 : oy*ow+x1]
+				if win.sx == 1 {
+					in := row[x0+offset : x1+offset]
+					in = in[:len(out)]
+					for j, v := range in {
+						out[j] += k * v
+					}
+					continue
+				}
+				for j := range out {
+					out[j] += k * row[(x0+j)*win.sx+offset]
+				}
+			}
+		}
+	}
+}
+
+// pool computes a pooling operator with the window of the node, reducing the
+// values under each window position with reduce
+func pool(n *node, in []*Tensor, reduce func(values []float32, count int) float32, padded bool) ([]*Tensor, error) {
+	batch, channels, h, w, err := spatial(in[0])
+	if err != nil {
+		return nil, err
+	}
+	kernel := n.ints("kernel_shape")
+	if len(kernel) != 2 {
+		return nil, fmt.Errorf("only 2D pooling is supported")
+	}
+	win, err := newWindow(n, kernel[0], kernel[1], h, w)
+	if err != nil {
+		return nil, err
+	}
+	oh, ow := win.outputSize(h, w, n.int("ceil_mode", 0) != 0)
+
+	x := in[0].Float
+	out := NewFloat([]int{batch, channels, oh, ow}, nil)
+	parallel(batch*channels, func(lo, hi int) {
+		values := make([]float32, 0, win.kh*win.kw)
+		for i := lo; i < hi; i++ {
+			src := x[i*h*w : (i+1)*h*w]
+			dst := out.Float[i*oh*ow : (i+1)*oh*ow]
+			for oy := range oh {
+				for ox := range ow {
+					values = values[:0]
+					count := 0
+					for ky := range win.kh {
+						iy := oy*win.sy + ky*win.dy - win.top
+						for kx := range win.kw {
+							ix := ox*win.sx + kx*win.dx - win.left
+							if iy >= 0 && iy < h && ix >= 0 && ix < w {
+								values = append(values, src[iy*w+ix])
+								count++
+							} else if padded && iy < h+win.bottom && ix < w+win.right {
+								count++
+							}
+						}
+					}
+					dst[oy*ow+ox] = reduce(values, count)
+				}
+			}
+		}
+	})
+	return []*Tensor{out}, nil
+}
+
+func opMaxPool(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	return pool(n, in, func(values []float32, count int) float32 {
+		if len(values) == 0 {
+			return 0
+		}
+		return slices.Max(values)
+	}, false)
+}
+
+func opAveragePool(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	return pool(n, in, func(values []float32, count int) float32 {
+		if count == 0 {
+			return 0
+		}
+		var sum float32
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float32(count)
+	}, n.int("count_include_pad", 0) != 0)
+}
+
+func opGlobalAveragePool(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	batch, channels, h, w, err := spatial(in[0])
+	if err != nil {
+		return nil, err
+	}
+	out := NewFloat([]int{batch, channels, 1, 1}, nil)
+	for i := range out.Float {
+		var sum float64
+		for _, v := range in[0].Float[i*h*w : (i+1)*h*w] {
+			sum += float64(v)
+		}
+		out.Float[i] = float32(sum / float64(h*w))
+	}
+	return []*Tensor{out}, nil
+}
+
+// opResize implements Resize and Upsample for the height and width of NCHW
+// tensors, in nearest and (bi)linear modes
+func opResize(m *Model, n *node, in []*Tensor) ([]*Tensor, error) {
+	batch, channels, h, w, err := spatial(in[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// Scales are the second input of Upsample and of Resize before opset 11,
+	// the third after it, or an attribute of Upsample before opset 9. Sizes
+	// are the fourth input.
+	var scales []float32
+	var sizes []int64
+	transform := "half_pixel"
+	switch {
+	case n.op == "Upsample" || m.opset < 11:
+		transform = "asymmetric"
+		if t := input(in, 1); t != nil {
+			scales = t.floats()
+		} else if a, ok := n.attrs["scales"]; ok {
+			scales = a.floats
+		}
+	default:
+		if t := input(in, 2); t != nil {
+			scales = t.floats()
+		}
+		if t := input(in, 3); t != nil {
+			sizes = t.ints()
+		}
+	}
+	transform = n.str("coordinate_transformation_mode", transform)
+
+	oh, ow := h, w
+	sy, sx := float64(1), float64(1)
+	switch {
+	case len(sizes) == 4:
+		if sizes[0] != int64(batch) || sizes[1] != int64(channels) {
+			return nil, fmt.Errorf("only the height and width can be resized")
+		}
+		oh, ow = int(sizes[2]), int(sizes[3])
+		sy, sx = float64(oh)/float64(h), float64(ow)/float64(w)
+	case len(scales) == 4:
+		if scales[0] != 1 || scales[1] != 1 {
+			return nil, fmt.Errorf("only the height and width can be resized")
+		}
+		sy, sx = float64(scales[2]), float64(scales[3])
+		oh, ow = int(math.Floor(float64(h)*sy)), int(math.Floor(float64(w)*sx))
+	default:
+		return nil, fmt.Errorf("expected 4 scales or sizes")
+	}
+	if oh <= 0 || ow <= 0 {
+		return nil, fmt.Errorf("invalid output size %dx%d", ow, oh)
+	}
+
+	// source returns the coordinate in the input of an output coordinate
+	source := func(x float64, in, out int, scale float64) float64 {
+		switch transform {
+		case "align_corners":
+			if out == 1 {
+				return 0
+			}
+			return x * float64(in-1) / float64(out-1)
+		case "asymmetric":
+			return x / scale
+		case "pytorch_half_pixel":
+			if out == 1 {
+				return 0
+			}
+			return (x+0.5)/scale - 0.5
+		case "tf_half_pixel_for_nn":
+			return (x + 0.5) / scale
+		}
+		return (x+0.5)/scale - 0.5
+	}
+	switch transform {
+	case "half_pixel", "align_corners", "asymmetric", "pytorch_half_pixel", "tf_half_pixel_for_nn":
+	default:
+		return nil, fmt.Errorf("unsupported coordinate transformation %s", transform)
+	}
+
+	// Each output coordinate reads two input coordinates with weights, the
+	// second being 0 for nearest
+	type tap struct {
+		i0, i1 int
+		w0, w1 float32
+	}
+	mode := n.str("mode", "nearest")
+	nearestMode := n.str("nearest_mode", "round_prefer_floor")
+	if n.op == "Upsample" || m.opset < 11 {
+		nearestMode = "floor"
+	}
+	taps := func(in, out int, scale float64) ([]tap, error) {
+		t := make([]tap, out)
+		for i := range t {
+			x := source(float64(i), in, out, scale)
+			switch mode {
+			case "nearest":
+				var j float64
+				switch nearestMode {
+				case "floor":
+					j = math.Floor(x)
+				case "ceil":
+					j = math.Ceil(x)
+				case "round_prefer_ceil":
+					j = math.Floor(x + 0.5)
+				default:
+					j = math.Ceil(x - 0.5)
+				}
+				k := min(max(int(j), 0), in-1)
+				t[i] = tap{k, k, 1, 0}
+			case "linear", "bilinear":
+				x = min(max(x, 0), float64(in-1))
+				k := int(math.Floor(x))
+				frac := float32(x - float64(k))
+				t[i] = tap{k, min(k+1, in-1), 1 - frac, frac}
+			default:
+				return nil, fmt.Errorf("unsupported mode %s", mode)
+			}
+		}
+		return t, nil
+	}
+	rows, err := taps(h, oh, sy)
+	if err != nil {
+		return nil, err
+	}
+	cols, err := taps(w, ow, sx)
+	if err != nil {
+		return nil, err
+	}
+
+	x := in[0].Float
+	out := NewFloat([]int{batch, channels, oh, ow}, nil)
+	parallel(batch*channels, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			src := x[i*h*w : (i+1)*h*w]
+			dst := out.Float[i*oh*ow : (i+1)*oh*ow]
+			for oy, r := range rows {
+				row0, row1 := src[r.i0*w:(r.i0+1)*w], src[r.i1*w:(r.i1+1)*w]
+				for ox, c := range cols {
+					top := row0[c.i0]*c.w0 + row0[c.i1]*c.w1
+					bottom := row1[c.i0]*c.w0 + row1[c.i1]*c.w1
+					dst[oy*ow+ox] = top*r.w0 + bottom*r.w1
+				}
+			}
+		}
+	})
+	return []*Tensor{out}, nil
+}
+
+// parallel splits the work items 0 to n between the CPUs, calling fn with
+// each range from lo up to hi. Small amounts of work run on the calling
+// goroutine.
+func parallel(n int, fn func(lo, hi int)) {
+	workers := min(runtime.GOMAXPROCS(0), n)
+	if workers <= 1 || n < 64 {
+		fn(0, n)
+		return
+	}
+	// Small chunks balance the load when some items are slower than others
+	chunk := max(1, n/(workers*4))
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				lo := int(next.Add(int64(chunk))) - chunk
+				if lo >= n {
+					return
+				}
+				fn(lo, min(lo+chunk, n))
+			}
+		}()
+	}
+	wg.Wait()
+}
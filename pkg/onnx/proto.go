@@ -0,0 +1,111 @@
+package onnx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Protocol buffer wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("truncated protocol buffer")
+
+// field is one field of an encoded protocol buffer message
+type field struct {
+	number int
+	wire   int
+	value  uint64 // Varint and fixed values
+	data   []byte // Length-delimited values
+}
+
+// fields decodes the fields of a message in order
+func fields(data []byte) ([]field, error) {
+	var out []field
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errTruncated
+		}
+		data = data[n:]
+		f := field{number: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			if f.value, n = binary.Uvarint(data); n <= 0 {
+				return nil, errTruncated
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return nil, errTruncated
+			}
+			f.value, data = binary.LittleEndian.Uint64(data), data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return nil, errTruncated
+			}
+			f.value, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return nil, errTruncated
+			}
+			f.data, data = data[n:n+int(size)], data[n+int(size):]
+		default:
+			return nil, fmt.Errorf("unsupported protocol buffer wire type %d", f.wire)
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// ints appends the integers of a repeated integer field, which is either one
+// value or a packed list of varints
+func (f field) ints(to []int64) ([]int64, error) {
+	if f.wire != wireBytes {
+		return append(to, int64(f.value)), nil
+	}
+	for data := f.data; len(data) > 0; {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errTruncated
+		}
+		to, data = append(to, int64(v)), data[n:]
+	}
+	return to, nil
+}
+
+// floats appends the values of a repeated float field, which is either one
+// value or a packed list
+func (f field) floats(to []float32) ([]float32, error) {
+	if f.wire != wireBytes {
+		return append(to, math.Float32frombits(uint32(f.value))), nil
+	}
+	if len(f.data)%4 != 0 {
+		return nil, errTruncated
+	}
+	for i := 0; i < len(f.data); i += 4 {
+		to = append(to, math.Float32frombits(binary.LittleEndian.Uint32(f.data[i:])))
+	}
+	return to, nil
+}
+
+// doubles appends the values of a repeated double field as float32
+func (f field) doubles(to []float32) ([]float32, error) {
+	if f.wire != wireBytes {
+		return append(to, float32(math.Float64frombits(f.value))), nil
+	}
+	if len(f.data)%8 != 0 {
+		return nil, errTruncated
+	}
+	for i := 0; i < len(f.data); i += 8 {
+		to = append(to, float32(math.Float64frombits(binary.LittleEndian.Uint64(f.data[i:]))))
+	}
+	return to, nil
+}
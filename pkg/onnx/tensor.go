@@ -0,0 +1,348 @@
+package onnx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// ONNX tensor element types
+const (
+	typeFloat   = 1
+	typeUint8   = 2
+	typeInt8    = 3
+	typeUint16  = 4
+	typeInt16   = 5
+	typeInt32   = 6
+	typeInt64   = 7
+	typeBool    = 9
+	typeFloat16 = 10
+	typeDouble  = 11
+	typeUint32  = 12
+	typeUint64  = 13
+)
+
+// Tensor is a dense tensor in row-major order. Floating-point tensors hold
+// their values in Float, and integer and boolean tensors in Int, which is
+// never nil for them.
+type Tensor struct {
+	Shape []int
+	Float []float32
+	Int   []int64
+}
+
+// NewFloat returns a floating-point tensor of the given shape. Data is used
+// as is, or allocated if nil.
+func NewFloat(shape []int, data []float32) *Tensor {
+	if data == nil {
+		data = make([]float32, size(shape))
+	}
+	return &Tensor{Shape: shape, Float: data}
+}
+
+// newInt returns an integer tensor of the given shape and values
+func newInt(shape []int, data []int64) *Tensor {
+	if data == nil {
+		data = make([]int64, size(shape))
+	}
+	return &Tensor{Shape: shape, Int: data}
+}
+
+// isInt reports whether t is an integer tensor
+func (t *Tensor) isInt() bool {
+	return t.Int != nil
+}
+
+// Len returns the number of elements of t
+func (t *Tensor) Len() int {
+	return size(t.Shape)
+}
+
+// ints returns the values of t as integers
+func (t *Tensor) ints() []int64 {
+	if t.isInt() {
+		return t.Int
+	}
+	out := make([]int64, len(t.Float))
+	for i, v := range t.Float {
+		out[i] = int64(v)
+	}
+	return out
+}
+
+// floats returns the values of t as floats
+func (t *Tensor) floats() []float32 {
+	if !t.isInt() {
+		return t.Float
+	}
+	out := make([]float32, len(t.Int))
+	for i, v := range t.Int {
+		out[i] = float32(v)
+	}
+	return out
+}
+
+// reshaped returns a tensor of another shape sharing the values of t
+func (t *Tensor) reshaped(shape []int) *Tensor {
+	return &Tensor{Shape: shape, Float: t.Float, Int: t.Int}
+}
+
+// size returns the number of elements of a tensor of the given shape
+func size(shape []int) int {
+	n := 1
+	for _, d := range shape {
+		n *= d
+	}
+	return n
+}
+
+// strides returns the element strides of the dimensions of a shape
+func strides(shape []int) []int {
+	out := make([]int, len(shape))
+	n := 1
+	for i := len(shape) - 1; i >= 0; i-- {
+		out[i] = n
+		n *= shape[i]
+	}
+	return out
+}
+
+// remap returns a tensor of the given shape whose elements are taken from t
+// at the flat indices index returns for each position
+func (t *Tensor) remap(shape []int, index func(pos []int) int) *Tensor {
+	n := size(shape)
+	var out *Tensor
+	if t.isInt() {
+		out = newInt(shape, nil)
+	} else {
+		out = NewFloat(shape, nil)
+	}
+	pos := make([]int, len(shape))
+	for i := range n {
+		j := index(pos)
+		if t.isInt() {
+			out.Int[i] = t.Int[j]
+		} else {
+			out.Float[i] = t.Float[j]
+		}
+		for d := len(pos) - 1; d >= 0; d-- {
+			if pos[d]++; pos[d] < shape[d] {
+				break
+			}
+			pos[d] = 0
+		}
+	}
+	return out
+}
+
+// parseTensor decodes a TensorProto
+func parseTensor(data []byte) (*Tensor, error) {
+	fs, err := fields(data)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		dims     []int64
+		dataType int
+		raw      []byte
+		hasRaw   bool
+		floats   []float32
+		ints     []int64
+		name     string
+	)
+	for _, f := range fs {
+		switch f.number {
+		case 1:
+			if dims, err = f.ints(dims); err != nil {
+				return nil, err
+			}
+		case 2:
+			dataType = int(f.value)
+		case 4:
+			if floats, err = f.floats(floats); err != nil {
+				return nil, err
+			}
+		case 5, 7, 11:
+			if ints, err = f.ints(ints); err != nil {
+				return nil, err
+			}
+		case 8:
+			name = string(f.data)
+		case 9:
+			raw, hasRaw = f.data, true
+		case 10:
+			if floats, err = f.doubles(floats); err != nil {
+				return nil, err
+			}
+		case 14:
+			if f.value != 0 {
+				return nil, fmt.Errorf("tensor %s: external data is not supported", name)
+			}
+		}
+	}
+
+	shape := make([]int, len(dims))
+	for i, d := range dims {
+		shape[i] = int(d)
+	}
+	n := size(shape)
+	if hasRaw {
+		if floats, ints, err = decodeRaw(raw, dataType, n); err != nil {
+			return nil, fmt.Errorf("tensor %s: %w", name, err)
+		}
+	}
+
+	switch dataType {
+	case typeFloat, typeDouble, typeFloat16:
+		if dataType == typeFloat16 && !hasRaw {
+			// Half floats in int32_data hold their bits
+			floats = make([]float32, len(ints))
+			for i, v := range ints {
+				floats[i] = halfToFloat(uint16(v))
+			}
+		}
+		if len(floats) != n {
+			return nil, fmt.Errorf("tensor %s: %d values for shape %v", name, len(floats), shape)
+		}
+		return NewFloat(shape, floats), nil
+	case typeUint8, typeInt8, typeUint16, typeInt16, typeInt32, typeInt64, typeBool, typeUint32, typeUint64:
+		if ints == nil {
+			ints = []int64{}
+		}
+		if len(ints) != n {
+			return nil, fmt.Errorf("tensor %s: %d values for shape %v", name, len(ints), shape)
+		}
+		return newInt(shape, ints), nil
+	}
+	return nil, fmt.Errorf("tensor %s: unsupported data type %d", name, dataType)
+}
+
+// decodeRaw decodes the little-endian raw data of n tensor elements
+func decodeRaw(raw []byte, dataType, n int) ([]float32, []int64, error) {
+	widths := map[int]int{
+		typeFloat: 4, typeUint8: 1, typeInt8: 1, typeUint16: 2, typeInt16: 2, typeInt32: 4, typeInt64: 8,
+		typeBool: 1, typeFloat16: 2, typeDouble: 8, typeUint32: 4, typeUint64: 8,
+	}
+	width, ok := widths[dataType]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported data type %d", dataType)
+	}
+	if len(raw) != n*width {
+		return nil, nil, fmt.Errorf("%d bytes of data for %d elements", len(raw), n)
+	}
+
+	switch dataType {
+	case typeFloat, typeDouble, typeFloat16:
+		floats := make([]float32, n)
+		for i := range floats {
+			switch dataType {
+			case typeFloat:
+				floats[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:]))
+			case typeDouble:
+				floats[i] = float32(math.Float64frombits(binary.LittleEndian.Uint64(raw[i*8:])))
+			default:
+				floats[i] = halfToFloat(binary.LittleEndian.Uint16(raw[i*2:]))
+			}
+		}
+		return floats, nil, nil
+	}
+	ints := make([]int64, n)
+	for i := range ints {
+		switch dataType {
+		case typeUint8, typeBool:
+			ints[i] = int64(raw[i])
+		case typeInt8:
+			ints[i] = int64(int8(raw[i]))
+		case typeUint16:
+			ints[i] = int64(binary.LittleEndian.Uint16(raw[i*2:]))
+		case typeInt16:
+			ints[i] = int64(int16(binary.LittleEndian.Uint16(raw[i*2:])))
+		case typeInt32:
+			ints[i] = int64(int32(binary.LittleEndian.Uint32(raw[i*4:])))
+		case typeUint32:
+			ints[i] = int64(binary.LittleEndian.Uint32(raw[i*4:]))
+		default:
+			ints[i] = int64(binary.LittleEndian.Uint64(raw[i*8:]))
+		}
+	}
+	return nil, ints, nil
+}
+
+// halfToFloat converts an IEEE 754 half-precision float to a float32
+func halfToFloat(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	frac := uint32(h) & 0x3ff
+	switch {
+	case exp == 0 && frac == 0:
+		return math.Float32frombits(sign)
+	case exp == 0:
+		// Subnormal
+		v := float32(frac) / (1 << 24)
+		if sign != 0 {
+			return -v
+		}
+		return v
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | frac<<13)
+	}
+	return math.Float32frombits(sign | (exp+112)<<23 | frac<<13)
+}
+
+// broadcastShape returns the shape two tensors broadcast to, following the
+// rules of numpy
+func broadcastShape(a, b []int) ([]int, error) {
+	n := max(len(a), len(b))
+	out := make([]int, n)
+	for i := range n {
+		da, db := 1, 1
+		if j := len(a) - n + i; j >= 0 {
+			da = a[j]
+		}
+		if j := len(b) - n + i; j >= 0 {
+			db = b[j]
+		}
+		switch {
+		case da == db || db == 1:
+			out[i] = da
+		case da == 1:
+			out[i] = db
+		default:
+			return nil, fmt.Errorf("shapes %v and %v cannot be broadcast", a, b)
+		}
+	}
+	return out, nil
+}
+
+// broadcastIndex returns, for each element of a tensor of shape out, the
+// index of the element of a tensor of shape in that broadcasts to it
+func broadcastIndex(in, out []int) []int {
+	if slices.Equal(in, out) {
+		return nil
+	}
+	inStrides := strides(in)
+	// Strides of the input along the output dimensions, 0 where broadcast
+	along := make([]int, len(out))
+	for i := range out {
+		if j := len(in) - len(out) + i; j >= 0 && in[j] != 1 {
+			along[i] = inStrides[j]
+		}
+	}
+	index := make([]int, size(out))
+	pos := make([]int, len(out))
+	flat := 0
+	for i := range index {
+		index[i] = flat
+		for d := len(pos) - 1; d >= 0; d-- {
+			pos[d]++
+			flat += along[d]
+			if pos[d] < out[d] {
+				break
+			}
+			flat -= along[d] * pos[d]
+			pos[d] = 0
+		}
+	}
+	return index
+}
@@ -0,0 +1,282 @@
+// Package pdf writes images as the pages of a PDF document
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PageSize is a page size in points (1/72 inch). The zero value sizes each
+// page to its image.
+type PageSize struct {
+	Width  float64
+	Height float64
+}
+
+// Standard page sizes, in portrait orientation
+var (
+	A3     = PageSize{841.89, 1190.55}
+	A4     = PageSize{595.28, 841.89}
+	A5     = PageSize{419.53, 595.28}
+	Letter = PageSize{612, 792}
+	Legal  = PageSize{612, 1008}
+)
+
+// pageSizes maps page size names accepted by ParsePageSize
+var pageSizes = map[string]PageSize{
+	"a3":     A3,
+	"a4":     A4,
+	"a5":     A5,
+	"letter": Letter,
+	"legal":  Legal,
+}
+
+// Options controls the page layout of a PDF
+type Options struct {
+	PageSize PageSize // Page size; the zero value sizes each page to its image
+	Margin   float64  // Margin around the image, in points
+	Quality  int      // JPEG quality for opaque images (1-100)
+	DPI      float64  // Resolution images are placed at when PageSize is zero
+}
+
+// ParsePageSize parses a page size name (a3, a4, a5, letter, legal), "fit"
+// to size each page to its image, or explicit dimensions such as 210x297mm
+func ParsePageSize(s string) (PageSize, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == "fit" {
+		return PageSize{}, nil
+	}
+	if size, ok := pageSizes[s]; ok {
+		return size, nil
+	}
+
+	w, h, ok := strings.Cut(s, "x")
+	if !ok {
+		return PageSize{}, fmt.Errorf("invalid page size: %s (expected a3, a4, a5, letter, legal, fit, or WIDTHxHEIGHT with a unit)", s)
+	}
+	// A unit on the height applies to both dimensions, as in 210x297mm
+	unit := strings.TrimLeft(h, "0123456789.")
+	if strings.TrimLeft(w, "0123456789.") == "" {
+		w += unit
+	}
+	width, err := ParseLength(w)
+	if err != nil {
+		return PageSize{}, err
+	}
+	height, err := ParseLength(h)
+	if err != nil {
+		return PageSize{}, err
+	}
+	if width <= 0 || height <= 0 {
+		return PageSize{}, fmt.Errorf("invalid page size: %s", s)
+	}
+	return PageSize{width, height}, nil
+}
+
+// ParseLength parses a length with an optional unit (pt, mm, cm, in) and
+// returns it in points. Lengths without a unit are in points.
+func ParseLength(s string) (float64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	scale := 1.0
+	for unit, points := range map[string]float64{"pt": 1, "mm": 72 / 25.4, "cm": 72 / 2.54, "in": 72} {
+		if number, ok := strings.CutSuffix(s, unit); ok {
+			s, scale = number, points
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid length: %s (expected a number with an optional pt, mm, cm, or in unit)", s)
+	}
+	return v * scale, nil
+}
+
+// Write writes a PDF with one page per image. Each image is scaled to fit
+// the page inside the margins and centered; pages are turned to landscape
+// for landscape images. Opaque images are embedded as JPEG, images with
+// transparency losslessly with a soft mask.
+func Write(w io.Writer, images []image.Image, options Options) error {
+	if len(images) == 0 {
+		return fmt.Errorf("no images to write")
+	}
+	if options.Quality <= 0 {
+		options.Quality = 85
+	}
+	if options.DPI <= 0 {
+		options.DPI = 72
+	}
+
+	pw := &writer{w: bufio.NewWriter(w)}
+	pw.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 and 2 are the catalog and page tree; each page uses four more
+	const catalog, pages = 1, 2
+	pw.object(catalog, "<< /Type /Catalog /Pages %d 0 R >>", pages)
+
+	kids := make([]string, len(images))
+	for i, img := range images {
+		base := 3 + i*4
+		page, content, xobject, mask := base, base+1, base+2, base+3
+		kids[i] = fmt.Sprintf("%d 0 R", page)
+
+		bounds := img.Bounds()
+		iw, ih := float64(bounds.Dx()), float64(bounds.Dy())
+		if iw == 0 || ih == 0 {
+			return fmt.Errorf("image %d is empty", i+1)
+		}
+
+		// Lay out the page
+		var pageW, pageH, drawW, drawH float64
+		if options.PageSize == (PageSize{}) {
+			drawW, drawH = iw*72/options.DPI, ih*72/options.DPI
+			pageW, pageH = drawW+2*options.Margin, drawH+2*options.Margin
+		} else {
+			pageW, pageH = options.PageSize.Width, options.PageSize.Height
+			if (iw > ih) != (pageW > pageH) {
+				pageW, pageH = pageH, pageW
+			}
+			scale := math.Min((pageW-2*options.Margin)/iw, (pageH-2*options.Margin)/ih)
+			if scale <= 0 {
+				return fmt.Errorf("margin %gpt leaves no room on the page", options.Margin)
+			}
+			drawW, drawH = iw*scale, ih*scale
+		}
+		x, y := (pageW-drawW)/2, (pageH-drawH)/2
+
+		pw.object(page, "<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+			pages, num(pageW), num(pageH), xobject, content)
+		pw.stream(content, "", []byte(fmt.Sprintf("q %s 0 0 %s %s %s cm /Im0 Do Q", num(drawW), num(drawH), num(x), num(y))))
+
+		if err := pw.image(img, xobject, mask, options.Quality); err != nil {
+			return fmt.Errorf("failed to embed image %d: %w", i+1, err)
+		}
+	}
+
+	pw.object(pages, "<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(images))
+
+	// Cross-reference table and trailer
+	xref := pw.n
+	pw.printf("xref\n0 %d\n0000000000 65535 f \n", len(pw.offsets)+1)
+	for id := 1; id <= len(pw.offsets); id++ {
+		pw.printf("%010d 00000 n \n", pw.offsets[id])
+	}
+	pw.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(pw.offsets)+1, catalog, xref)
+
+	if pw.err != nil {
+		return pw.err
+	}
+	return pw.w.Flush()
+}
+
+// writer tracks byte offsets of objects for the cross-reference table
+type writer struct {
+	w       *bufio.Writer
+	n       int
+	offsets map[int]int
+	err     error
+}
+
+func (pw *writer) printf(format string, args ...any) {
+	pw.write([]byte(fmt.Sprintf(format, args...)))
+}
+
+func (pw *writer) write(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(b)
+	pw.n += n
+	pw.err = err
+}
+
+// object writes an indirect object with the given dictionary
+func (pw *writer) object(id int, format string, args ...any) {
+	pw.begin(id)
+	pw.printf(format, args...)
+	pw.printf("\nendobj\n")
+}
+
+// stream writes an indirect stream object; dict holds extra dictionary entries
+func (pw *writer) stream(id int, dict string, data []byte) {
+	pw.begin(id)
+	pw.printf("<< %s/Length %d >>\nstream\n", dict, len(data))
+	pw.write(data)
+	pw.printf("\nendstream\nendobj\n")
+}
+
+func (pw *writer) begin(id int) {
+	if pw.offsets == nil {
+		pw.offsets = make(map[int]int)
+	}
+	pw.offsets[id] = pw.n
+	pw.printf("%d 0 obj\n", id)
+}
+
+// image writes img as an image XObject, with a soft mask object if it has
+// transparency. The mask object is written empty when unused so object
+// numbers stay sequential.
+func (pw *writer) image(img image.Image, id, maskID, quality int) error {
+	bounds := img.Bounds()
+	header := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /BitsPerComponent 8 ", bounds.Dx(), bounds.Dy())
+
+	if opaque(img) {
+		colorSpace := "/DeviceRGB"
+		if _, ok := img.(*image.Gray); ok {
+			colorSpace = "/DeviceGray"
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return err
+		}
+		pw.stream(id, header+"/ColorSpace "+colorSpace+" /Filter /DCTDecode ", buf.Bytes())
+		pw.object(maskID, "null")
+		return nil
+	}
+
+	// Split into RGB and alpha planes, both Flate compressed
+	rgb := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	alpha := make([]byte, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			// Un-premultiply; the soft mask applies alpha when drawing
+			if a > 0 && a < 0xffff {
+				r, g, b = r*0xffff/a, g*0xffff/a, b*0xffff/a
+			}
+			rgb = append(rgb, uint8(r>>8), uint8(g>>8), uint8(b>>8))
+			alpha = append(alpha, uint8(a>>8))
+		}
+	}
+	pw.stream(id, header+fmt.Sprintf("/ColorSpace /DeviceRGB /SMask %d 0 R /Filter /FlateDecode ", maskID), deflate(rgb))
+	pw.stream(maskID, header+"/ColorSpace /DeviceGray /Filter /FlateDecode ", deflate(alpha))
+	return nil
+}
+
+// opaque reports whether img has no transparent pixels
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// num formats a PDF number with at most two decimals
+func num(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,116 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	opaqueImg := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for i := 3; i < len(opaqueImg.Pix); i += 4 {
+		opaqueImg.Pix[i] = 255
+	}
+	translucent := image.NewNRGBA(image.Rect(0, 0, 50, 80))
+	translucent.SetNRGBA(0, 0, color.NRGBA{R: 255, A: 128})
+
+	var buf bytes.Buffer
+	if err := Write(&buf, []image.Image{opaqueImg, translucent}, Options{PageSize: A4, Margin: 36}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	data := buf.String()
+
+	if !strings.HasPrefix(data, "%PDF-1.4") || !strings.HasSuffix(data, "%%EOF\n") {
+		t.Fatalf("Missing PDF header or trailer")
+	}
+	if !strings.Contains(data, "/Count 2") {
+		t.Errorf("Expected 2 pages")
+	}
+	if !strings.Contains(data, "/DCTDecode") || !strings.Contains(data, "/SMask") {
+		t.Errorf("Expected a JPEG image and a soft-masked image")
+	}
+	// The landscape image gets a landscape page
+	if !strings.Contains(data, "/MediaBox [0 0 841.89 595.28]") || !strings.Contains(data, "/MediaBox [0 0 595.28 841.89]") {
+		t.Errorf("Expected one landscape and one portrait A4 page")
+	}
+
+	// Every cross-reference entry points at its object
+	match := regexp.MustCompile(`startxref\n(\d+)`).FindStringSubmatch(data)
+	if match == nil {
+		t.Fatalf("Missing startxref")
+	}
+	xref, _ := strconv.Atoi(match[1])
+	lines := strings.Split(data[xref:], "\n")
+	count, _ := strconv.Atoi(strings.Fields(lines[1])[1])
+	for id := 1; id < count; id++ {
+		offset, _ := strconv.Atoi(strings.Fields(lines[2+id])[0])
+		if !strings.HasPrefix(data[offset:], fmt.Sprintf("%d 0 obj", id)) {
+			t.Errorf("Cross-reference entry %d does not point at its object", id)
+		}
+	}
+}
+
+func TestWriteFitPage(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 300, 150))
+
+	var buf bytes.Buffer
+	if err := Write(&buf, []image.Image{img}, Options{DPI: 150, Margin: 10}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	// 300x150 pixels at 150 DPI is 144x72 points, plus margins
+	if !strings.Contains(buf.String(), "/MediaBox [0 0 164 92]") {
+		t.Errorf("Expected a page sized to the image")
+	}
+}
+
+func TestWriteNoImages(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, nil, Options{}); err == nil {
+		t.Fatalf("Expected an error without images")
+	}
+}
+
+func TestParsePageSize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  PageSize
+	}{
+		{"a4", A4},
+		{"Letter", Letter},
+		{"fit", PageSize{}},
+		{"210x297mm", PageSize{595.28, 841.89}},
+		{"8.5x11in", Letter},
+		{"100x200", PageSize{100, 200}},
+	}
+	for _, tt := range tests {
+		got, err := ParsePageSize(tt.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if math.Abs(got.Width-tt.want.Width) > 0.01 || math.Abs(got.Height-tt.want.Height) > 0.01 {
+			t.Errorf("%s: expected %v, got %v", tt.input, tt.want, got)
+		}
+	}
+
+	for _, input := range []string{"a9", "10x", "axb"} {
+		if _, err := ParsePageSize(input); err == nil {
+			t.Errorf("%s: expected an error", input)
+		}
+	}
+}
+
+func TestParseLength(t *testing.T) {
+	tests := map[string]float64{"36": 36, "12pt": 12, "1in": 72, "25.4mm": 72, "2.54cm": 72}
+	for input, want := range tests {
+		got, err := ParseLength(input)
+		if err != nil || math.Abs(got-want) > 0.001 {
+			t.Errorf("%s: expected %g, got %g (%v)", input, want, got, err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package phash
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/disintegration/imaging"
+)
+
+// Hash is a 64-bit perceptual hash. Similar images have hashes that differ in
+// few bits.
+type Hash uint64
+
+// String returns the hash as 16 hexadecimal digits
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// Parse parses a hash written by String
+func Parse(s string) (Hash, error) {
+	v, err := strconv.ParseUint(s, 16, 64)
+	if err != nil || len(s) != 16 {
+		return 0, fmt.Errorf("invalid hash: %s (expected 16 hexadecimal digits)", s)
+	}
+	return Hash(v), nil
+}
+
+// Distance returns the Hamming distance between two hashes, the number of
+// bits that differ
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+// Algorithm selects how an image is hashed
+type Algorithm string
+
+const (
+	// AlgorithmAverage compares each pixel of an 8x8 thumbnail with the mean
+	AlgorithmAverage Algorithm = "ahash"
+	// AlgorithmDifference compares horizontally adjacent pixels of a 9x8 thumbnail
+	AlgorithmDifference Algorithm = "dhash"
+	// AlgorithmPerceptual compares the low frequencies of a 32x32 DCT with their median
+	AlgorithmPerceptual Algorithm = "phash"
+)
+
+// Algorithms lists the supported algorithms
+var Algorithms = []Algorithm{AlgorithmAverage, AlgorithmDifference, AlgorithmPerceptual}
+
+// Compute hashes an image with the given algorithm
+func Compute(img image.Image, algorithm Algorithm) (Hash, error) {
+	switch algorithm {
+	case AlgorithmAverage:
+		return AHash(img), nil
+	case AlgorithmDifference:
+		return DHash(img), nil
+	case AlgorithmPerceptual:
+		return PHash(img), nil
+	}
+	return 0, fmt.Errorf("unknown hash algorithm: %s (expected ahash, dhash, or phash)", algorithm)
+}
+
+// gray shrinks an image to width x height and returns its luma, row by row
+func gray(img image.Image, width, height int) []float64 {
+	small := imaging.Resize(img, width, height, imaging.Box)
+	values := make([]float64, width*height)
+	for i := range values {
+		p := small.Pix[i*4 : i*4+4]
+		values[i] = 0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])
+	}
+	return values
+}
+
+// AHash computes the average hash: a bit is set for each pixel of an 8x8
+// grayscale thumbnail that is brighter than the mean
+func AHash(img image.Image) Hash {
+	values := gray(img, 8, 8)
+	var mean float64
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+
+	var h Hash
+	for i, v := range values {
+		if v > mean {
+			h |= 1 << (63 - i)
+		}
+	}
+	return h
+}
+
+// DHash computes the difference hash: a bit is set for each pixel of a 9x8
+// grayscale thumbnail that is brighter than its right neighbor
+func DHash(img image.Image) Hash {
+	values := gray(img, 9, 8)
+	var h Hash
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			if values[y*9+x] > values[y*9+x+1] {
+				h |= 1 << (63 - (y*8 + x))
+			}
+		}
+	}
+	return h
+}
+
+// PHash computes the perceptual hash: the 8x8 lowest frequencies of the
+// discrete cosine transform of a 32x32 grayscale thumbnail, each compared
+// with their median. The DC term is left out since it only carries the mean
+// brightness.
+func PHash(img image.Image) Hash {
+	const size, low = 32, 8
+	values := gray(img, size, size)
+
+	// Separable 2D DCT-II, rows then columns, keeping the low frequencies
+	rows := make([]float64, size*low)
+	for y := 0; y < size; y++ {
+		for u := 0; u < low; u++ {
+			rows[y*low+u] = dct(func(x int) float64 { return values[y*size+x] }, u, size)
+		}
+	}
+	coefficients := make([]float64, low*low)
+	for v := 0; v < low; v++ {
+		for u := 0; u < low; u++ {
+			coefficients[v*low+u] = dct(func(y int) float64 { return rows[y*low+u] }, v, size)
+		}
+	}
+
+	sorted := slices.Clone(coefficients[1:])
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var h Hash
+	for i, c := range coefficients {
+		if i > 0 && c > median {
+			h |= 1 << (63 - i)
+		}
+	}
+	return h
+}
+
+// dct returns coefficient k of the DCT-II of n values
+func dct(value func(int) float64, k, n int) float64 {
+	var sum float64
+	for i := 0; i < n; i++ {
+		sum += value(i) * math.Cos(math.Pi*float64(k)*(2*float64(i)+1)/float64(2*n))
+	}
+	return sum
+}
+
+// Group returns the indexes of hashes that are near-duplicates of each
+// other: hashes within maxDistance of any member join its group. Only groups
+// of two or more are returned, each sorted, in order of their first member.
+func Group(hashes []Hash, maxDistance int) [][]int {
+	parent := make([]int, len(hashes))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			if Distance(hashes[i], hashes[j]) <= maxDistance {
+				if a, b := find(i), find(j); a != b {
+					parent[max(a, b)] = min(a, b)
+				}
+			}
+		}
+	}
+
+	members := make(map[int][]int)
+	var roots []int
+	for i := range hashes {
+		root := find(i)
+		if _, ok := members[root]; !ok {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], i)
+	}
+
+	var groups [][]int
+	for _, root := range roots {
+		if len(members[root]) > 1 {
+			groups = append(groups, members[root])
+		}
+	}
+	return groups
+}
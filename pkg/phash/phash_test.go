@@ -0,0 +1,103 @@
+package phash
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// scene returns an image with a bright square on a gradient
+func scene(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(x * 200 / width)
+			if x > width/4 && x < width/2 && y > height/4 && y < height*3/4 {
+				v = 255
+			}
+			img.SetNRGBA(x, y, color.NRGBA{v, v / 2, 255 - v, 255})
+		}
+	}
+	return img
+}
+
+func TestHashSimilarity(t *testing.T) {
+	original := scene(256, 192)
+	// A smaller, slightly brighter copy is a near-duplicate
+	copy := imaging.AdjustBrightness(imaging.Resize(original, 128, 96, imaging.Lanczos), 5)
+	// The mirrored scene is a different image
+	other := imaging.FlipH(original)
+
+	for _, algorithm := range Algorithms {
+		a, err := Compute(original, algorithm)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+		b, _ := Compute(copy, algorithm)
+		c, _ := Compute(other, algorithm)
+
+		if d := Distance(a, b); d > 6 {
+			t.Errorf("%s: expected a near-duplicate to be within 6 bits, got %d", algorithm, d)
+		}
+		if d := Distance(a, c); d < 16 {
+			t.Errorf("%s: expected a different image to be at least 16 bits away, got %d", algorithm, d)
+		}
+	}
+
+	if _, err := Compute(original, "md5"); err == nil {
+		t.Errorf("Expected an error for an unknown algorithm")
+	}
+}
+
+func TestParse(t *testing.T) {
+	h := Hash(0x0123456789abcdef)
+	if h.String() != "0123456789abcdef" {
+		t.Errorf("Unexpected string: %s", h)
+	}
+	if parsed, err := Parse(h.String()); err != nil || parsed != h {
+		t.Errorf("Expected %s, got %s (%v)", h, parsed, err)
+	}
+	for _, invalid := range []string{"", "123", "0123456789abcdeg", "0123456789abcdef0"} {
+		if _, err := Parse(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	if d := Distance(0, 0xff); d != 8 {
+		t.Errorf("Expected 8, got %d", d)
+	}
+	if d := Distance(0xf0f0, 0xf0f0); d != 0 {
+		t.Errorf("Expected 0, got %d", d)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	hashes := []Hash{
+		0x0000000000000000,
+		0xffffffffffffffff,
+		0x0000000000000003, // 2 bits from the first
+		0x00000000000000ff, // 6 bits from the third, 8 from the first
+		0xfffffffffffffffe, // 1 bit from the second
+		0x00000000ffff0000,
+	}
+
+	groups := Group(hashes, 6)
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %v", groups)
+	}
+	// Near-duplicates chain: the fourth joins through the third
+	if len(groups[0]) != 3 || groups[0][0] != 0 || groups[0][1] != 2 || groups[0][2] != 3 {
+		t.Errorf("Unexpected first group: %v", groups[0])
+	}
+	if len(groups[1]) != 2 || groups[1][0] != 1 || groups[1][1] != 4 {
+		t.Errorf("Unexpected second group: %v", groups[1])
+	}
+
+	if groups := Group(hashes, 0); len(groups) != 0 {
+		t.Errorf("Expected no groups at distance 0, got %v", groups)
+	}
+}
@@ -0,0 +1,809 @@
+package pipeline
+
+import (
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"nim/pkg/colorparse"
+	"nim/pkg/effect"
+	"nim/pkg/image"
+	"nim/pkg/plugin"
+)
+
+// Operation is one step of a pipeline. Operations return a new image rather
+// than modifying img, since outputs share the result of the steps before
+// them. Operations that configure the encoder, such as encode, change
+// options instead.
+type Operation interface {
+	Apply(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error)
+}
+
+// OperationFunc adapts a function to the Operation interface
+type OperationFunc func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error)
+
+// Apply calls f
+func (f OperationFunc) Apply(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+	return f(img, options)
+}
+
+// Definition describes an operation that steps can use
+type Definition struct {
+	Name        string                                 // Operation name used in recipes
+	Description string                                 // One-line description
+	Params      []string                               // Accepted parameters, in the order of the short form's arguments
+	ExtraParams bool                                   // Whether parameters not in Params are accepted too
+	Build       func(params Params) (Operation, error) // Validates the parameters and builds the operation
+}
+
+// definitions maps operation names to registered operations
+var definitions = make(map[string]*Definition)
+
+// Register makes an operation available to recipes by its name. Registering
+// a name again replaces the previous operation.
+func Register(def Definition) {
+	definitions[strings.ToLower(def.Name)] = &def
+}
+
+// Lookup returns the operation registered under a name
+func Lookup(name string) (*Definition, bool) {
+	def, ok := definitions[strings.ToLower(name)]
+	return def, ok
+}
+
+// Definitions returns all registered operations sorted by name
+func Definitions() []*Definition {
+	list := make([]*Definition, 0, len(definitions))
+	for _, def := range definitions {
+		list = append(list, def)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func init() {
+	Register(Definition{
+		Name:        "crop",
+		Description: "Cut a region in the form WIDTHxHEIGHT+X+Y out of the image",
+		Params:      []string{"region"},
+		Build:       buildCrop,
+	})
+	Register(Definition{
+		Name:        "resize",
+		Description: "Resize to WIDTHxHEIGHT in fit, fill, stretch or liquid mode, padding fit with a color",
+		Params:      []string{"size", "mode", "pad"},
+		Build:       buildResize,
+	})
+	Register(Definition{
+		Name:        "watermark",
+		Description: "Overlay an image at a position, with optional opacity, margin and scale",
+		Params:      []string{"image", "position", "opacity", "margin", "scale"},
+		Build:       buildWatermark,
+	})
+	Register(Definition{
+		Name:        "adjust",
+		Description: "Change brightness, contrast and saturation (-100 to 100) and gamma",
+		Params:      []string{"brightness", "contrast", "saturation", "gamma"},
+		Build:       buildAdjust,
+	})
+	Register(Definition{
+		Name:        "levels",
+		Description: "Map the black point, gamma and white point of the red, green and blue channels, or of one",
+		Params:      []string{"black", "gamma", "white", "channel"},
+		Build:       buildLevels,
+	})
+	Register(Definition{
+		Name:        "auto-contrast",
+		Description: "Stretch the levels so a fraction of the pixels (clip, in percent) turn black and white",
+		Params:      []string{"clip"},
+		Build:       buildAutoContrast,
+	})
+	Register(Definition{
+		Name:        "auto-wb",
+		Description: "Remove a color cast by balancing the means of the channels",
+		Build:       buildAutoWB,
+	})
+	Register(Definition{
+		Name:        "blur",
+		Description: "Apply a gaussian blur with the given sigma",
+		Params:      []string{"sigma"},
+		Build:       buildBlur,
+	})
+	Register(Definition{
+		Name:        "sharpen",
+		Description: "Sharpen with the given sigma",
+		Params:      []string{"sigma"},
+		Build:       buildSharpen,
+	})
+	Register(Definition{
+		Name:        "vignette",
+		Description: "Darken the corners by a strength (0-1), starting at a radius (0-1)",
+		Params:      []string{"strength", "radius"},
+		Build:       buildVignette,
+	})
+	Register(Definition{
+		Name:        "grain",
+		Description: "Add gaussian or perlin noise by an amount (0-100), hiding banding in gradients",
+		Params:      []string{"amount", "type", "size"},
+		Build:       buildGrain,
+	})
+	Register(Definition{
+		Name:        "shadow",
+		Description: "Add a drop shadow with an offset, blur and color, growing the canvas",
+		Params:      []string{"offset", "blur", "color", "background"},
+		Build:       buildShadow,
+	})
+	Register(Definition{
+		Name:        "extent",
+		Description: "Place the image unscaled on a WIDTHxHEIGHT canvas at an anchor, cropping what does not fit",
+		Params:      []string{"size", "anchor", "background"},
+		Build:       buildExtent,
+	})
+	Register(Definition{
+		Name:        "deskew",
+		Description: "Detect the tilt of lines and edges and level the image, cropping or padding the corners",
+		Params:      []string{"mode", "max", "background"},
+		Build:       buildDeskew,
+	})
+	Register(Definition{
+		Name:        "simulate",
+		Description: "Show the image as seen with protanopia, deuteranopia or tritanopia",
+		Params:      []string{"type"},
+		Build:       buildSimulate,
+	})
+	Register(Definition{
+		Name:        "daltonize",
+		Description: "Shift colors lost to protanopia, deuteranopia or tritanopia into visible ones",
+		Params:      []string{"type"},
+		Build:       buildDaltonize,
+	})
+	Register(Definition{
+		Name:        "plugin",
+		Description: "Run a WebAssembly filter module, passing it the other parameters",
+		Params:      []string{"module"},
+		ExtraParams: true,
+		Build:       buildPlugin,
+	})
+	Register(Definition{
+		Name:        "encode",
+		Description: "Set the output format and quality of the outputs, and whether JPEGs are progressive",
+		Params:      []string{"format", "quality", "progressive"},
+		Build:       buildEncode,
+	})
+}
+
+// required returns a parameter that must be set
+func (p Params) required(key string) (string, error) {
+	value := p[key]
+	if value == "" {
+		return "", fmt.Errorf("missing %s", key)
+	}
+	return value, nil
+}
+
+// float returns a numeric parameter, or def if unset
+func (p Params) float(key string, def float64) (float64, error) {
+	value, ok := p[key]
+	if !ok || value == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s (expected a number)", key, value)
+	}
+	return f, nil
+}
+
+// int returns an integer parameter, or def if unset
+func (p Params) int(key string, def int) (int, error) {
+	value, ok := p[key]
+	if !ok || value == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s (expected an integer)", key, value)
+	}
+	return i, nil
+}
+
+// buildCrop builds the crop operation
+func buildCrop(params Params) (Operation, error) {
+	value, err := params.required("region")
+	if err != nil {
+		return nil, err
+	}
+	region, err := image.ParseGeometry(value)
+	if err != nil {
+		return nil, err
+	}
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		return image.Crop(img, region)
+	}), nil
+}
+
+// buildResize builds the resize operation. Without a pad color, fit mode pads
+// with the color of the processing options.
+func buildResize(params Params) (Operation, error) {
+	value, err := params.required("size")
+	if err != nil {
+		return nil, err
+	}
+	width, height, err := image.ParseSize(value)
+	if err != nil {
+		return nil, err
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid size: %s", value)
+	}
+
+	mode := image.ResizeModeFit
+	if value := params["mode"]; value != "" {
+		mode = image.ResizeMode(strings.ToLower(value))
+		switch mode {
+		case image.ResizeModeFit, image.ResizeModeFill, image.ResizeModeStretch, image.ResizeModeLiquid:
+		default:
+			return nil, fmt.Errorf("invalid mode: %s (expected fit, fill, stretch, or liquid)", value)
+		}
+	}
+
+	var pad *color.NRGBA
+	if value := params["pad"]; value != "" {
+		color, err := image.ParseHexColor(value)
+		if err != nil {
+			return nil, err
+		}
+		pad = &color
+	}
+
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		resize := *options
+		resize.Width, resize.Height, resize.ResizeMode = width, height, mode
+		if pad != nil {
+			resize.PadColor = *pad
+		}
+		return image.Resize(img, resize)
+	}), nil
+}
+
+// anchors maps watermark and extent positions to imaging anchor points
+var anchors = map[string]imaging.Anchor{
+	"center":       imaging.Center,
+	"top-left":     imaging.TopLeft,
+	"top":          imaging.Top,
+	"top-right":    imaging.TopRight,
+	"left":         imaging.Left,
+	"right":        imaging.Right,
+	"bottom-left":  imaging.BottomLeft,
+	"bottom":       imaging.Bottom,
+	"bottom-right": imaging.BottomRight,
+}
+
+// ParseAnchor parses a position such as top-left or bottom-right
+func ParseAnchor(position string) (imaging.Anchor, error) {
+	anchor, ok := anchors[strings.ToLower(strings.TrimSpace(position))]
+	if !ok {
+		return 0, fmt.Errorf("invalid position: %s (expected center, top-left, top, top-right, left, right, bottom-left, bottom, or bottom-right)", position)
+	}
+	return anchor, nil
+}
+
+// buildWatermark builds the watermark operation. The overlay is decoded once,
+// when the pipeline is compiled. A scale sizes it to a fraction of the image
+// width; otherwise it keeps its own size.
+func buildWatermark(params Params) (Operation, error) {
+	path, err := params.required("image")
+	if err != nil {
+		return nil, err
+	}
+	position := strings.ToLower(params["position"])
+	if position == "" {
+		position = "bottom-right"
+	}
+	anchor, err := ParseAnchor(position)
+	if err != nil {
+		return nil, err
+	}
+	opacity, err := params.float("opacity", 1)
+	if err != nil {
+		return nil, err
+	}
+	if opacity < 0 || opacity > 1 {
+		return nil, fmt.Errorf("invalid opacity: %g (expected 0-1)", opacity)
+	}
+	margin, err := params.int("margin", 0)
+	if err != nil {
+		return nil, err
+	}
+	if margin < 0 {
+		return nil, fmt.Errorf("invalid margin: %d", margin)
+	}
+	scale, err := params.float("scale", 0)
+	if err != nil {
+		return nil, err
+	}
+	if scale < 0 || scale > 1 {
+		return nil, fmt.Errorf("invalid scale: %g (expected 0-1)", scale)
+	}
+
+	mark, err := image.OpenImage(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open watermark: %w", err)
+	}
+
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		overlay := mark
+		if scale > 0 {
+			overlay = imaging.Resize(mark, max(int(float64(img.Bounds().Dx())*scale), 1), 0, imaging.Lanczos)
+		}
+		return Watermark(img, overlay, anchor, margin, opacity), nil
+	}), nil
+}
+
+// Watermark draws mark over img at the anchor, inset by margin pixels from
+// the edges it is anchored to, blended with the given opacity
+func Watermark(img, mark stdimage.Image, anchor imaging.Anchor, margin int, opacity float64) *stdimage.NRGBA {
+	bounds := img.Bounds()
+	w, h := mark.Bounds().Dx(), mark.Bounds().Dy()
+
+	x := (bounds.Dx() - w) / 2
+	switch anchor {
+	case imaging.TopLeft, imaging.Left, imaging.BottomLeft:
+		x = margin
+	case imaging.TopRight, imaging.Right, imaging.BottomRight:
+		x = bounds.Dx() - w - margin
+	}
+	y := (bounds.Dy() - h) / 2
+	switch anchor {
+	case imaging.TopLeft, imaging.Top, imaging.TopRight:
+		y = margin
+	case imaging.BottomLeft, imaging.Bottom, imaging.BottomRight:
+		y = bounds.Dy() - h - margin
+	}
+
+	return imaging.Overlay(img, mark, stdimage.Pt(bounds.Min.X+x, bounds.Min.Y+y), opacity)
+}
+
+// buildAdjust builds the adjust operation. Brightness, contrast and
+// saturation are percentages where 0 leaves the image unchanged; gamma is
+// unchanged at 1.
+func buildAdjust(params Params) (Operation, error) {
+	values := make(map[string]float64)
+	for _, key := range []string{"brightness", "contrast", "saturation"} {
+		v, err := params.float(key, 0)
+		if err != nil {
+			return nil, err
+		}
+		if v < -100 || v > 100 {
+			return nil, fmt.Errorf("invalid %s: %g (expected -100 to 100)", key, v)
+		}
+		values[key] = v
+	}
+	gamma, err := params.float("gamma", 1)
+	if err != nil {
+		return nil, err
+	}
+	if gamma <= 0 {
+		return nil, fmt.Errorf("invalid gamma: %g (expected a positive number)", gamma)
+	}
+
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		if v := values["brightness"]; v != 0 {
+			img = imaging.AdjustBrightness(img, v)
+		}
+		if v := values["contrast"]; v != 0 {
+			img = imaging.AdjustContrast(img, v)
+		}
+		if v := values["saturation"]; v != 0 {
+			img = imaging.AdjustSaturation(img, v)
+		}
+		if gamma != 1 {
+			img = imaging.AdjustGamma(img, gamma)
+		}
+		return img, nil
+	}), nil
+}
+
+// buildLevels builds the levels operation. The black and white points are
+// levels from 0 to 255 (default 0 and 255), and the channel is red, green or
+// blue, or all three when unset.
+func buildLevels(params Params) (Operation, error) {
+	black, err := params.float("black", 0)
+	if err != nil {
+		return nil, err
+	}
+	white, err := params.float("white", 255)
+	if err != nil {
+		return nil, err
+	}
+	if black < 0 || white > 255 || black >= white {
+		return nil, fmt.Errorf("invalid levels: black %g, white %g (expected 0 <= black < white <= 255)", black, white)
+	}
+	gamma, err := params.float("gamma", 1)
+	if err != nil {
+		return nil, err
+	}
+	if gamma <= 0 {
+		return nil, fmt.Errorf("invalid gamma: %g (expected a positive number)", gamma)
+	}
+	levels := effect.Levels{Black: black, White: white, Gamma: gamma}
+	channels := [3]effect.Levels{levels, levels, levels}
+	switch channel := strings.ToLower(params["channel"]); channel {
+	case "", "rgb":
+	case "red", "r", "green", "g", "blue", "b":
+		channels = [3]effect.Levels{effect.Identity, effect.Identity, effect.Identity}
+		channels[strings.IndexByte("rgb", channel[0])] = levels
+	default:
+		return nil, fmt.Errorf("invalid channel: %s (expected red, green or blue)", channel)
+	}
+
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		return effect.ApplyLevels(img, channels[0], channels[1], channels[2]), nil
+	}), nil
+}
+
+// buildAutoContrast builds the auto-contrast operation. The clip is the
+// percentage of pixels that turn black, and as many white (default 0.5).
+func buildAutoContrast(params Params) (Operation, error) {
+	clip, err := params.float("clip", 0.5)
+	if err != nil {
+		return nil, err
+	}
+	if clip < 0 || clip >= 50 {
+		return nil, fmt.Errorf("invalid clip: %g (expected 0 to 50 percent)", clip)
+	}
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		return effect.AutoContrast(img, clip/100), nil
+	}), nil
+}
+
+// buildAutoWB builds the auto-wb operation
+func buildAutoWB(params Params) (Operation, error) {
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		return effect.AutoWhiteBalance(img), nil
+	}), nil
+}
+
+// sigma returns the positive sigma parameter of a blur or sharpen step
+func (p Params) sigma() (float64, error) {
+	value, err := p.required("sigma")
+	if err != nil {
+		return 0, err
+	}
+	sigma, err := p.float("sigma", 0)
+	if err != nil {
+		return 0, err
+	}
+	if sigma <= 0 {
+		return 0, fmt.Errorf("invalid sigma: %s (expected a positive number)", value)
+	}
+	return sigma, nil
+}
+
+// buildBlur builds the blur operation
+func buildBlur(params Params) (Operation, error) {
+	sigma, err := params.sigma()
+	if err != nil {
+		return nil, err
+	}
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		return imaging.Blur(img, sigma), nil
+	}), nil
+}
+
+// buildSharpen builds the sharpen operation
+func buildSharpen(params Params) (Operation, error) {
+	sigma, err := params.sigma()
+	if err != nil {
+		return nil, err
+	}
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		return imaging.Sharpen(img, sigma), nil
+	}), nil
+}
+
+// fraction returns a parameter from 0 to 1, or def if unset
+func (p Params) fraction(key string, def float64) (float64, error) {
+	v, err := p.float(key, def)
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 || v > 1 {
+		return 0, fmt.Errorf("invalid %s: %g (expected 0 to 1)", key, v)
+	}
+	return v, nil
+}
+
+// buildVignette builds the vignette operation
+func buildVignette(params Params) (Operation, error) {
+	if _, err := params.required("strength"); err != nil {
+		return nil, err
+	}
+	strength, err := params.fraction("strength", 0)
+	if err != nil {
+		return nil, err
+	}
+	radius, err := params.fraction("radius", 0.5)
+	if err != nil {
+		return nil, err
+	}
+	if radius == 1 {
+		return nil, fmt.Errorf("invalid radius: 1 (expected less than 1)")
+	}
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		return effect.Vignette(img, strength, radius), nil
+	}), nil
+}
+
+// buildGrain builds the grain operation. The noise is gaussian unless the
+// type is perlin, whose clumps are size pixels wide (2 by default).
+func buildGrain(params Params) (Operation, error) {
+	if _, err := params.required("amount"); err != nil {
+		return nil, err
+	}
+	amount, err := params.float("amount", 0)
+	if err != nil {
+		return nil, err
+	}
+	if amount < 0 || amount > 100 {
+		return nil, fmt.Errorf("invalid amount: %g (expected 0 to 100)", amount)
+	}
+	noise := effect.NoiseGaussian
+	if value := params["type"]; value != "" {
+		if noise, err = effect.ParseNoise(value); err != nil {
+			return nil, err
+		}
+	}
+	size, err := params.float("size", 2)
+	if err != nil {
+		return nil, err
+	}
+	if size < 1 {
+		return nil, fmt.Errorf("invalid size: %g (expected 1 or more)", size)
+	}
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		return effect.Grain(img, amount, noise, size), nil
+	}), nil
+}
+
+// buildDeskew builds the deskew operation. The crop mode keeps the size of
+// the image; the pad mode grows the canvas, filling the corners with the
+// background color when one is given, or with the pad color when the output
+// format has no alpha.
+func buildDeskew(params Params) (Operation, error) {
+	mode := effect.DeskewCrop
+	if value := params["mode"]; value != "" {
+		var err error
+		if mode, err = effect.ParseDeskewMode(value); err != nil {
+			return nil, err
+		}
+	}
+	maxAngle, err := params.float("max", 15)
+	if err != nil {
+		return nil, err
+	}
+	if maxAngle <= 0 || maxAngle > 45 {
+		return nil, fmt.Errorf("invalid max: %g (expected more than 0 up to 45)", maxAngle)
+	}
+	var background *color.NRGBA
+	if value := params["background"]; value != "" {
+		c, err := colorparse.Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		background = &c
+	}
+
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		canvas := color.NRGBA{}
+		if background != nil {
+			canvas = *background
+		} else if options.OutputFormat != "" && !image.SupportsAlpha(options.OutputFormat) {
+			canvas = image.FlattenColor(options.PadColor)
+		}
+		return effect.Deskew(img, maxAngle, mode, canvas), nil
+	}), nil
+}
+
+// buildShadow builds the shadow operation. The offset is N to shift the
+// shadow down and right by N pixels, or XxY. The color may have an alpha,
+// as #RRGGBBAA. The shadow is composited onto the background color when one
+// is given, which may also have an alpha, or flattened onto the pad color
+// when the output format has no alpha.
+func buildShadow(params Params) (Operation, error) {
+	offset := stdimage.Pt(10, 10)
+	if value := params["offset"]; value != "" {
+		x, y, ok := strings.Cut(value, "x")
+		if !ok {
+			y = x
+		}
+		dx, errX := strconv.Atoi(x)
+		dy, errY := strconv.Atoi(y)
+		if errX != nil || errY != nil {
+			return nil, fmt.Errorf("invalid offset: %s (expected N or XxY)", value)
+		}
+		offset = stdimage.Pt(dx, dy)
+	}
+	blur, err := params.float("blur", 8)
+	if err != nil {
+		return nil, err
+	}
+	if blur < 0 {
+		return nil, fmt.Errorf("invalid blur: %g (expected 0 or more)", blur)
+	}
+	shade := color.NRGBA{0, 0, 0, 128}
+	if value := params["color"]; value != "" {
+		if shade, err = colorparse.Parse(value); err != nil {
+			return nil, err
+		}
+	}
+	var background *color.NRGBA
+	if value := params["background"]; value != "" {
+		c, err := image.ParseHexColor(value)
+		if err != nil {
+			return nil, err
+		}
+		background = &c
+	}
+
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		result := effect.Shadow(img, offset, blur, shade)
+		opaque := options.OutputFormat != "" && !image.SupportsAlpha(options.OutputFormat)
+		switch {
+		case background != nil && opaque:
+			return effect.Flatten(result, image.FlattenColor(*background)), nil
+		case background != nil:
+			return effect.Underlay(result, *background), nil
+		case opaque:
+			return effect.Flatten(result, image.FlattenColor(options.PadColor)), nil
+		}
+		return result, nil
+	}), nil
+}
+
+// buildExtent builds the extent operation. The anchor is a watermark
+// position, center by default. The canvas is the background color, which may
+// have an alpha, or transparent, or the pad color when the output format has
+// no alpha.
+func buildExtent(params Params) (Operation, error) {
+	value, err := params.required("size")
+	if err != nil {
+		return nil, err
+	}
+	width, height, err := image.ParseSize(value)
+	if err != nil {
+		return nil, err
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid size: %s (expected a positive WIDTHxHEIGHT)", value)
+	}
+	position := strings.ToLower(params["anchor"])
+	if position == "" {
+		position = "center"
+	}
+	anchor, ok := anchors[position]
+	if !ok {
+		return nil, fmt.Errorf("invalid anchor: %s (expected center, top-left, top, top-right, left, right, bottom-left, bottom, or bottom-right)", position)
+	}
+	var background *color.NRGBA
+	if value := params["background"]; value != "" {
+		c, err := colorparse.Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		background = &c
+	}
+
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		canvas := color.NRGBA{}
+		if background != nil {
+			canvas = *background
+		} else if options.OutputFormat != "" && !image.SupportsAlpha(options.OutputFormat) {
+			canvas = image.FlattenColor(options.PadColor)
+		}
+		return Extent(img, width, height, anchor, canvas), nil
+	}), nil
+}
+
+// Extent places img at its size on a width x height canvas of the color c,
+// at the anchor. Parts of an image larger than the canvas are cut off.
+func Extent(img stdimage.Image, width, height int, anchor imaging.Anchor, c color.NRGBA) *stdimage.NRGBA {
+	return Watermark(imaging.New(width, height, c), img, anchor, 0, 1)
+}
+
+// deficiency returns the color vision deficiency of a simulate or daltonize
+// step
+func (p Params) deficiency() (effect.Deficiency, error) {
+	value, err := p.required("type")
+	if err != nil {
+		return "", err
+	}
+	return effect.ParseDeficiency(value)
+}
+
+// buildSimulate builds the simulate operation
+func buildSimulate(params Params) (Operation, error) {
+	d, err := params.deficiency()
+	if err != nil {
+		return nil, err
+	}
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		return effect.Simulate(img, d), nil
+	}), nil
+}
+
+// buildDaltonize builds the daltonize operation
+func buildDaltonize(params Params) (Operation, error) {
+	d, err := params.deficiency()
+	if err != nil {
+		return nil, err
+	}
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		return effect.Daltonize(img, d), nil
+	}), nil
+}
+
+// buildPlugin builds the plugin operation. The module is compiled once, when
+// the pipeline is compiled, and gets the other parameters as a URL query
+// string such as strength=3&mode=soft.
+func buildPlugin(params Params) (Operation, error) {
+	path, err := params.required("module")
+	if err != nil {
+		return nil, err
+	}
+	args := make(url.Values)
+	for key, value := range params {
+		if key != "module" {
+			args.Set(key, value)
+		}
+	}
+	query := args.Encode()
+
+	filter, err := plugin.LoadFilter(path)
+	if err != nil {
+		return nil, err
+	}
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		return filter.Apply(img, query)
+	}), nil
+}
+
+// buildEncode builds the encode operation, which sets the output format and
+// quality for the outputs that follow it
+func buildEncode(params Params) (Operation, error) {
+	format := strings.ToLower(strings.TrimPrefix(params["format"], "."))
+	quality, err := params.int("quality", 0)
+	if err != nil {
+		return nil, err
+	}
+	if quality < 0 || quality > 100 {
+		return nil, fmt.Errorf("invalid quality: %d (expected 1-100)", quality)
+	}
+	progressive, set := false, params["progressive"] != ""
+	if set {
+		if progressive, err = strconv.ParseBool(params["progressive"]); err != nil {
+			return nil, fmt.Errorf("invalid progressive: %s (expected true or false)", params["progressive"])
+		}
+	}
+	if format == "" && quality == 0 && !set {
+		return nil, fmt.Errorf("missing format, quality or progressive")
+	}
+
+	return OperationFunc(func(img stdimage.Image, options *image.ProcessOptions) (stdimage.Image, error) {
+		if format != "" {
+			options.OutputFormat = format
+		}
+		if quality != 0 {
+			options.Quality = quality
+		}
+		if set {
+			options.JPEG.Progressive = progressive
+		}
+		return img, nil
+	}), nil
+}
@@ -0,0 +1,406 @@
+package pipeline
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	nimimage "nim/pkg/image"
+)
+
+// build builds an operation from its parameters, failing the test on errors
+func build(t *testing.T, name string, params Params) Operation {
+	t.Helper()
+	def, ok := Lookup(name)
+	if !ok {
+		t.Fatalf("Operation %s is not registered", name)
+	}
+	operation, err := def.Build(params)
+	if err != nil {
+		t.Fatalf("Failed to build %s: %v", name, err)
+	}
+	return operation
+}
+
+func TestDefinitions(t *testing.T) {
+	var names []string
+	for _, def := range Definitions() {
+		names = append(names, def.Name)
+	}
+	for _, name := range []string{"adjust", "crop", "encode", "resize", "watermark"} {
+		if _, ok := Lookup(name); !ok {
+			t.Errorf("Expected %s to be registered, got %v", name, names)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	src := imaging.New(100, 50, color.NRGBA{255, 0, 0, 255})
+	options := nimimage.DefaultOptions()
+
+	img, err := build(t, "resize", Params{"size": "40x40", "pad": "#00FF00"}).Apply(src, &options)
+	if err != nil {
+		t.Fatalf("Failed to resize: %v", err)
+	}
+	if img.Bounds().Dx() != 40 || img.Bounds().Dy() != 40 {
+		t.Errorf("Expected 40x40, got %v", img.Bounds())
+	}
+	// Fit mode pads with the given color rather than the options' color
+	if r, g, _, _ := img.At(0, 0).RGBA(); r != 0 || g != 0xffff {
+		t.Errorf("Expected green padding, got %v", img.At(0, 0))
+	}
+
+	// A transparent pad color is kept for outputs with alpha
+	img, err = build(t, "resize", Params{"size": "40x40", "pad": "transparent"}).Apply(src, &options)
+	if err != nil {
+		t.Fatalf("Failed to resize: %v", err)
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("Expected transparent padding, got %v", img.At(0, 0))
+	}
+
+	for _, params := range []Params{{"size": "40"}, {"size": "0x10"}, {"size": "4x4", "mode": "squash"}, {"size": "4x4", "pad": "greenish"}} {
+		if _, err := buildResize(params); err == nil {
+			t.Errorf("Expected an error for %v", params)
+		}
+	}
+}
+
+func TestCrop(t *testing.T) {
+	src := imaging.New(100, 50, color.NRGBA{255, 0, 0, 255})
+	options := nimimage.DefaultOptions()
+
+	img, err := build(t, "crop", Params{"region": "10x20+5+5"}).Apply(src, &options)
+	if err != nil || img.Bounds().Dx() != 10 || img.Bounds().Dy() != 20 {
+		t.Errorf("Expected a 10x20 crop, got %v (%v)", img.Bounds(), err)
+	}
+	if _, err := build(t, "crop", Params{"region": "200x20"}).Apply(src, &options); err == nil {
+		t.Errorf("Expected an error for a region outside the image")
+	}
+	if _, err := buildCrop(Params{}); err == nil {
+		t.Errorf("Expected an error for a missing region")
+	}
+}
+
+func TestWatermark(t *testing.T) {
+	src := imaging.New(100, 50, color.NRGBA{255, 255, 255, 255})
+	mark := imaging.New(10, 10, color.NRGBA{0, 0, 0, 255})
+
+	img := Watermark(src, mark, imaging.BottomRight, 5, 1)
+	if c := img.NRGBAAt(85, 35); c.R != 0 {
+		t.Errorf("Expected the mark at the bottom right, got %v", c)
+	}
+	if c := img.NRGBAAt(95, 45); c.R != 255 {
+		t.Errorf("Expected the margin to stay white, got %v", c)
+	}
+
+	img = Watermark(src, mark, imaging.Center, 0, 0.5)
+	if c := img.NRGBAAt(50, 25); c.R < 120 || c.R > 135 {
+		t.Errorf("Expected a half-transparent mark in the center, got %v", c)
+	}
+
+	// The mark is loaded when the operation is built and can be scaled
+	path := filepath.Join(t.TempDir(), "mark.png")
+	if err := imaging.Save(mark, path); err != nil {
+		t.Fatalf("Failed to write mark: %v", err)
+	}
+	options := nimimage.DefaultOptions()
+	result, err := build(t, "watermark", Params{"image": path, "position": "top-left", "scale": "0.5"}).Apply(src, &options)
+	if err != nil {
+		t.Fatalf("Failed to apply watermark: %v", err)
+	}
+	nrgba := imaging.Clone(result)
+	if nrgba.NRGBAAt(49, 49).R != 0 || nrgba.NRGBAAt(51, 0).R != 255 {
+		t.Errorf("Expected a 50px mark at the top left")
+	}
+
+	for _, params := range []Params{{}, {"image": path, "position": "middle"}, {"image": path, "opacity": "2"}, {"image": filepath.Join(t.TempDir(), "missing.png")}} {
+		if _, err := buildWatermark(params); err == nil {
+			t.Errorf("Expected an error for %v", params)
+		}
+	}
+}
+
+func TestAdjust(t *testing.T) {
+	src := imaging.New(4, 4, color.NRGBA{100, 100, 100, 255})
+	options := nimimage.DefaultOptions()
+
+	img, err := build(t, "adjust", Params{"brightness": "20"}).Apply(src, &options)
+	if err != nil {
+		t.Fatalf("Failed to adjust: %v", err)
+	}
+	if c := imaging.Clone(img).NRGBAAt(0, 0); c.R <= 100 {
+		t.Errorf("Expected a brighter image, got %v", c)
+	}
+
+	// Without changes the image is returned as-is
+	if img, _ := build(t, "adjust", Params{}).Apply(src, &options); img != image.Image(src) {
+		t.Errorf("Expected the source image to be returned")
+	}
+
+	for _, params := range []Params{{"contrast": "200"}, {"gamma": "0"}, {"saturation": "much"}} {
+		if _, err := buildAdjust(params); err == nil {
+			t.Errorf("Expected an error for %v", params)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	options := nimimage.DefaultOptions()
+	src := imaging.New(1, 1, color.NRGBA{})
+	if _, err := build(t, "encode", Params{"format": ".WEBP", "quality": "60"}).Apply(src, &options); err != nil {
+		t.Fatalf("Failed to apply encode: %v", err)
+	}
+	if options.OutputFormat != "webp" || options.Quality != 60 {
+		t.Errorf("Expected webp at quality 60, got %s at %d", options.OutputFormat, options.Quality)
+	}
+
+	if _, err := build(t, "encode", Params{"progressive": "true"}).Apply(src, &options); err != nil || !options.JPEG.Progressive {
+		t.Errorf("Expected progressive output (%v)", err)
+	}
+
+	for _, params := range []Params{{}, {"quality": "0"}, {"quality": "101"}, {"progressive": "sometimes"}} {
+		if _, err := buildEncode(params); err == nil {
+			t.Errorf("Expected an error for %v", params)
+		}
+	}
+}
+
+func TestBlurAndSharpen(t *testing.T) {
+	// A hard edge between black and white
+	src := imaging.New(20, 1, color.NRGBA{0, 0, 0, 255})
+	src = imaging.Paste(src, imaging.New(10, 1, color.NRGBA{255, 255, 255, 255}), image.Pt(10, 0))
+	options := nimimage.DefaultOptions()
+
+	blurred, err := build(t, "blur", Params{"sigma": "2"}).Apply(src, &options)
+	if err != nil {
+		t.Fatalf("Failed to blur: %v", err)
+	}
+	if c := imaging.Clone(blurred).NRGBAAt(9, 0); c.R == 0 {
+		t.Errorf("Expected the edge to be softened, got %v", c)
+	}
+
+	sharpened, err := build(t, "sharpen", Params{"sigma": "1"}).Apply(blurred, &options)
+	if err != nil {
+		t.Fatalf("Failed to sharpen: %v", err)
+	}
+	if imaging.Clone(sharpened).NRGBAAt(9, 0).R >= imaging.Clone(blurred).NRGBAAt(9, 0).R {
+		t.Errorf("Expected sharpening to darken the dark side of the edge")
+	}
+
+	for _, params := range []Params{{}, {"sigma": "0"}, {"sigma": "-1"}, {"sigma": "soft"}} {
+		if _, err := buildBlur(params); err == nil {
+			t.Errorf("Expected an error for %v", params)
+		}
+	}
+}
+
+func TestPlugin(t *testing.T) {
+	src := imaging.New(4, 3, color.NRGBA{10, 20, 30, 255})
+	options := nimimage.DefaultOptions()
+	module := filepath.Join("..", "plugin", "testdata", "invert.wasm")
+
+	step, err := ParseStep("plugin=" + module + ":strength=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Parameters other than the module are passed to it
+	chain, err := CompileSteps([]Step{step})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, _, err := chain.Transform(src, options)
+	if err != nil {
+		t.Fatalf("Failed to run the plugin: %v", err)
+	}
+	if c := img.NRGBAAt(3, 2); c != (color.NRGBA{245, 235, 225, 255}) {
+		t.Errorf("Expected inverted colors, got %v", c)
+	}
+	// The test filter fails on arguments starting with x
+	if _, err := build(t, "plugin", Params{"module": module, "x": "1"}).Apply(src, &options); err == nil {
+		t.Error("Expected the plugin to fail")
+	}
+
+	for _, params := range []Params{{}, {"module": "missing.wasm"}} {
+		if _, err := buildPlugin(params); err == nil {
+			t.Errorf("Expected an error for %v", params)
+		}
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	src := imaging.New(4, 4, color.NRGBA{200, 40, 40, 255})
+	options := nimimage.DefaultOptions()
+	img, err := build(t, "simulate", Params{"type": "deuteranopia"}).Apply(src, &options)
+	if err != nil {
+		t.Fatalf("Failed to simulate: %v", err)
+	}
+	if r, g, _, _ := img.At(0, 0).RGBA(); r>>8 == 200 || g>>8 == 40 {
+		t.Errorf("Expected the red to change, got %v", img.At(0, 0))
+	}
+
+	for _, params := range []Params{{}, {"type": "red"}} {
+		if _, err := buildSimulate(params); err == nil {
+			t.Errorf("Expected an error for %v", params)
+		}
+	}
+}
+
+func TestLevels(t *testing.T) {
+	src := imaging.New(4, 4, color.NRGBA{20, 20, 235, 255})
+	options := nimimage.DefaultOptions()
+
+	img, err := build(t, "levels", Params{"black": "20", "white": "235", "channel": "blue"}).Apply(src, &options)
+	if err != nil {
+		t.Fatalf("Failed to apply levels: %v", err)
+	}
+	if c := imaging.Clone(img).NRGBAAt(0, 0); c != (color.NRGBA{20, 20, 255, 255}) {
+		t.Errorf("Expected only the blue channel stretched, got %v", c)
+	}
+
+	img, _ = build(t, "auto-contrast", Params{}).Apply(src, &options)
+	if c := imaging.Clone(img).NRGBAAt(0, 0); c != (color.NRGBA{0, 0, 255, 255}) {
+		t.Errorf("Expected the full range, got %v", c)
+	}
+
+	for _, params := range []Params{{"black": "200", "white": "100"}, {"white": "300"}, {"gamma": "-1"}, {"channel": "alpha"}} {
+		if _, err := buildLevels(params); err == nil {
+			t.Errorf("Expected an error for %v", params)
+		}
+	}
+	if _, err := buildAutoContrast(Params{"clip": "50"}); err == nil {
+		t.Error("Expected an error for a clip of 50%")
+	}
+}
+
+func TestShadow(t *testing.T) {
+	src := imaging.New(20, 20, color.NRGBA{255, 0, 0, 255})
+	options := nimimage.DefaultOptions()
+	img, err := build(t, "shadow", Params{"offset": "4x6", "blur": "0", "color": "#00000080"}).Apply(src, &options)
+	if err != nil {
+		t.Fatalf("Failed to add a shadow: %v", err)
+	}
+	if img.Bounds().Dx() != 24 || img.Bounds().Dy() != 26 {
+		t.Errorf("Expected 24x26, got %v", img.Bounds())
+	}
+	if _, _, _, a := img.At(22, 1).RGBA(); a != 0 {
+		t.Errorf("Expected transparency outside the shadow, got %v", img.At(22, 1))
+	}
+
+	// Outputs without alpha are flattened onto the pad color
+	options.OutputFormat = "jpg"
+	img, _ = build(t, "shadow", Params{"offset": "4", "blur": "0"}).Apply(src, &options)
+	if got := color.NRGBAModel.Convert(img.At(22, 1)); got != (color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("Expected the white pad color, got %v", got)
+	}
+
+	// A translucent background is kept for outputs with alpha
+	options.OutputFormat = "png"
+	img, _ = build(t, "shadow", Params{"offset": "4", "blur": "0", "background": "#0000FF80"}).Apply(src, &options)
+	if got := color.NRGBAModel.Convert(img.At(22, 1)); got != (color.NRGBA{0, 0, 255, 128}) {
+		t.Errorf("Expected the translucent background, got %v", got)
+	}
+
+	for _, params := range []Params{{"offset": "4,4"}, {"blur": "-1"}, {"color": "#00000"}, {"color": "rgb(0, 0, 0, 2)"}, {"background": "#0000008"}} {
+		if _, err := buildShadow(params); err == nil {
+			t.Errorf("Expected an error for %v", params)
+		}
+	}
+}
+
+func TestExtent(t *testing.T) {
+	src := imaging.New(20, 10, color.NRGBA{255, 0, 0, 255})
+	options := nimimage.DefaultOptions()
+	img, err := build(t, "extent", Params{"size": "64x32"}).Apply(src, &options)
+	if err != nil {
+		t.Fatalf("Failed to extend the canvas: %v", err)
+	}
+	if img.Bounds().Dx() != 64 || img.Bounds().Dy() != 32 {
+		t.Errorf("Expected 64x32, got %v", img.Bounds())
+	}
+	// Centered at its own size, on a transparent canvas
+	if got := color.NRGBAModel.Convert(img.At(22, 11)); got != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("Expected the image at 22,11, got %v", got)
+	}
+	if _, _, _, a := img.At(21, 10).RGBA(); a != 0 {
+		t.Errorf("Expected transparency around the image, got %v", img.At(21, 10))
+	}
+
+	img, _ = build(t, "extent", Params{"size": "30x30", "anchor": "bottom-right", "background": "#0000FF"}).Apply(src, &options)
+	if got := color.NRGBAModel.Convert(img.At(10, 20)); got != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("Expected the image in the bottom right corner, got %v", got)
+	}
+	if got := color.NRGBAModel.Convert(img.At(9, 19)); got != (color.NRGBA{0, 0, 255, 255}) {
+		t.Errorf("Expected the background color, got %v", got)
+	}
+
+	// Images larger than the canvas are cut, and outputs without alpha get the pad color
+	options.OutputFormat = "jpg"
+	img, _ = build(t, "extent", Params{"size": "10x20", "anchor": "left"}).Apply(src, &options)
+	if got := color.NRGBAModel.Convert(img.At(9, 2)); got != (color.NRGBA{255, 255, 255, 255}) {
+		t.Errorf("Expected the white pad color, got %v", got)
+	}
+	if got := color.NRGBAModel.Convert(img.At(9, 5)); got != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("Expected the left of the image, got %v", got)
+	}
+
+	for _, params := range []Params{{}, {"size": "0x10"}, {"size": "10x10", "anchor": "middle"}, {"size": "10x10", "background": "bluish"}} {
+		if _, err := buildExtent(params); err == nil {
+			t.Errorf("Expected an error for %v", params)
+		}
+	}
+}
+
+func TestDeskew(t *testing.T) {
+	src := imaging.New(200, 100, color.NRGBA{255, 255, 255, 255})
+	for y := 20; y < 80; y += 15 {
+		for x := 20; x < 180; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{0, 0, 0, 255})
+		}
+	}
+	src = imaging.Rotate(src, -3, color.NRGBA{255, 255, 255, 255})
+	options := nimimage.DefaultOptions()
+	options.OutputFormat = "jpeg"
+	options.PadColor = color.NRGBA{255, 0, 0, 255}
+	img, err := build(t, "deskew", Params{"mode": "pad"}).Apply(src, &options)
+	if err != nil {
+		t.Fatalf("Failed to deskew: %v", err)
+	}
+	if img.Bounds().Dx() <= src.Bounds().Dx() {
+		t.Errorf("Expected the padded canvas to grow from %v, got %v", src.Bounds(), img.Bounds())
+	}
+	if c := color.NRGBAModel.Convert(img.At(0, 0)); c != (color.NRGBA{255, 0, 0, 255}) {
+		t.Errorf("Expected the corner in the pad color, got %v", c)
+	}
+
+	for _, params := range []Params{{"mode": "fill"}, {"max": "0"}, {"max": "60"}, {"background": "#zz"}} {
+		if _, err := buildDeskew(params); err == nil {
+			t.Errorf("Expected an error for %v", params)
+		}
+	}
+}
+
+func TestGrain(t *testing.T) {
+	src := imaging.New(8, 8, color.NRGBA{128, 128, 128, 255})
+	options := nimimage.DefaultOptions()
+	img, err := build(t, "grain", Params{"amount": "20", "type": "perlin"}).Apply(src, &options)
+	if err != nil {
+		t.Fatalf("Failed to add grain: %v", err)
+	}
+	changed := false
+	for y := 0; y < 8; y++ {
+		r, _, _, _ := img.At(y, y).RGBA()
+		changed = changed || r>>8 != 128
+	}
+	if !changed {
+		t.Error("Expected the grain to change some pixels")
+	}
+
+	for _, params := range []Params{{}, {"amount": "101"}, {"amount": "5", "type": "pink"}, {"amount": "5", "size": "0"}} {
+		if _, err := buildGrain(params); err == nil {
+			t.Errorf("Expected an error for %v", params)
+		}
+	}
+}
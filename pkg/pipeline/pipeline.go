@@ -0,0 +1,327 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	stdimage "image"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"gopkg.in/yaml.v3"
+	"nim/pkg/colorparse"
+	"nim/pkg/image"
+)
+
+// Params are the parameters of a step, by name
+type Params map[string]string
+
+// Step is one operation of a recipe with its parameters
+type Step struct {
+	Operation string
+	Params    Params
+}
+
+// Output is a file written by a recipe. Format and Quality override the
+// encoder settings of the shared steps, and Steps run on this output only,
+// after the shared steps.
+type Output struct {
+	Path    string `yaml:"path"`
+	Format  string `yaml:"format"`
+	Quality int    `yaml:"quality"`
+	Steps   []Step `yaml:"steps"`
+}
+
+// Recipe declares an ordered list of operations and the outputs written from
+// their result. Paths are relative to the working directory, and {name} in an
+// output path is replaced by the input file name without its extension.
+type Recipe struct {
+	Input   string   `yaml:"input"`
+	Steps   []Step   `yaml:"steps"`
+	Outputs []Output `yaml:"outputs"`
+}
+
+// Load reads a recipe from a YAML or JSON file
+func Load(path string) (Recipe, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Recipe{}, fmt.Errorf("failed to read recipe: %w", err)
+	}
+	recipe, err := Parse(data)
+	if err != nil {
+		return Recipe{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return recipe, nil
+}
+
+// Parse parses a recipe in YAML or JSON. Unknown keys are rejected so that
+// typos do not silently drop a step.
+func Parse(data []byte) (Recipe, error) {
+	var recipe Recipe
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&recipe); err != nil {
+		return Recipe{}, err
+	}
+	return recipe, nil
+}
+
+// UnmarshalYAML reads a step written as a mapping with a single key, the
+// operation name, set either to the short form of its parameters
+// ("resize: 400x400:fit") or to a mapping of them ("resize: {size: 400x400}")
+func (s *Step) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode || len(node.Content) != 2 {
+		return fmt.Errorf("line %d: a step must be a mapping with a single operation name", node.Line)
+	}
+	name, value := node.Content[0], node.Content[1]
+	s.Operation = strings.ToLower(name.Value)
+
+	switch value.Kind {
+	case yaml.ScalarNode:
+		params, err := parseArgs(s.Operation, value.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", value.Line, err)
+		}
+		s.Params = params
+	case yaml.MappingNode:
+		s.Params = make(Params)
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			key, v := value.Content[i], value.Content[i+1]
+			if v.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: parameter %s of %s must be a single value", v.Line, key.Value, s.Operation)
+			}
+			s.Params[strings.ToLower(key.Value)] = v.Value
+		}
+	default:
+		return fmt.Errorf("line %d: invalid parameters for %s", value.Line, s.Operation)
+	}
+	return nil
+}
+
+// ParseStep parses the short form of a step, NAME=ARGS, such as
+// resize=400x400:fit. ARGS are separated by colons and are either the
+// operation's parameters in order or KEY=VALUE pairs.
+func ParseStep(spec string) (Step, error) {
+	name, args, _ := strings.Cut(spec, "=")
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return Step{}, fmt.Errorf("invalid step: %s (expected NAME=ARGS)", spec)
+	}
+	params, err := parseArgs(name, args)
+	if err != nil {
+		return Step{}, err
+	}
+	return Step{Operation: name, Params: params}, nil
+}
+
+// parseArgs parses the short form of the parameters of an operation
+func parseArgs(name, args string) (Params, error) {
+	params := make(Params)
+	if strings.TrimSpace(args) == "" {
+		return params, nil
+	}
+	def, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown operation: %s", name)
+	}
+
+	// Colons inside parentheses belong to values such as rgb() colors
+	for i, field := range colorparse.Split(args, ':') {
+		if key, value, ok := strings.Cut(field, "="); ok {
+			params[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+			continue
+		}
+		if i >= len(def.Params) {
+			return nil, fmt.Errorf("too many arguments for %s: %s", name, args)
+		}
+		params[def.Params[i]] = strings.TrimSpace(field)
+	}
+	return params, nil
+}
+
+// Pipeline is a validated recipe that can run on any number of images
+type Pipeline struct {
+	steps   []compiledStep
+	outputs []compiledOutput
+}
+
+// compiledStep is a step whose parameters have been validated
+type compiledStep struct {
+	name      string
+	operation Operation
+}
+
+// compiledOutput is an output whose steps have been validated
+type compiledOutput struct {
+	Output
+	steps []compiledStep
+}
+
+// Compile validates a recipe and builds its operations, so errors such as an
+// unknown operation or a missing parameter are reported before any image is
+// processed
+func Compile(recipe Recipe) (*Pipeline, error) {
+	steps, err := compileSteps(recipe.Steps)
+	if err != nil {
+		return nil, err
+	}
+	if len(recipe.Outputs) == 0 {
+		return nil, fmt.Errorf("recipe has no outputs")
+	}
+
+	p := &Pipeline{steps: steps}
+	for i, output := range recipe.Outputs {
+		if output.Path == "" {
+			return nil, fmt.Errorf("output %d has no path", i+1)
+		}
+		if output.Quality < 0 || output.Quality > 100 {
+			return nil, fmt.Errorf("invalid quality for %s: %d (expected 1-100)", output.Path, output.Quality)
+		}
+		steps, err := compileSteps(output.Steps)
+		if err != nil {
+			return nil, fmt.Errorf("invalid steps for %s: %w", output.Path, err)
+		}
+		p.outputs = append(p.outputs, compiledOutput{Output: output, steps: steps})
+	}
+	return p, nil
+}
+
+// CompileSteps validates steps given without a recipe, such as with --op on
+// the command line, into a pipeline without outputs. Use Transform to apply
+// it.
+func CompileSteps(steps []Step) (*Pipeline, error) {
+	compiled, err := compileSteps(steps)
+	if err != nil {
+		return nil, err
+	}
+	return &Pipeline{steps: compiled}, nil
+}
+
+// compileSteps builds the operations of steps
+func compileSteps(steps []Step) ([]compiledStep, error) {
+	compiled := make([]compiledStep, len(steps))
+	for i, step := range steps {
+		def, ok := Lookup(step.Operation)
+		if !ok {
+			return nil, fmt.Errorf("step %d: unknown operation: %s", i+1, step.Operation)
+		}
+		for key := range step.Params {
+			if !slices.Contains(def.Params, key) && !def.ExtraParams {
+				return nil, fmt.Errorf("step %d: unknown parameter for %s: %s", i+1, step.Operation, key)
+			}
+		}
+		operation, err := def.Build(step.Params)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: invalid %s: %w", i+1, step.Operation, err)
+		}
+		compiled[i] = compiledStep{name: def.Name, operation: operation}
+	}
+	return compiled, nil
+}
+
+// Rendered is an image produced for an output of a pipeline, with the options
+// to encode it with
+type Rendered struct {
+	Path    string
+	Image   *stdimage.NRGBA
+	Options image.ProcessOptions
+}
+
+// Run applies the shared steps to src, then the steps of each output to the
+// result. options provides the encoder settings the steps start
+// from and receives progress. Output paths are returned unexpanded.
+func (p *Pipeline) Run(src stdimage.Image, options image.ProcessOptions) ([]Rendered, error) {
+	img, options, err := p.Transform(src, options)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := make([]Rendered, len(p.outputs))
+	for i, output := range p.outputs {
+		outputOptions := options
+		if output.Format != "" {
+			outputOptions.OutputFormat = output.Format
+		}
+		if output.Quality != 0 {
+			outputOptions.Quality = output.Quality
+		}
+		result, err := apply(img, output.steps, &outputOptions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", output.Path, err)
+		}
+		rendered[i] = Rendered{Path: output.Path, Image: toNRGBA(result), Options: outputOptions}
+	}
+	return rendered, nil
+}
+
+// Transform applies the shared steps of the pipeline to src in order. It
+// returns the result and options as changed by encode steps.
+func (p *Pipeline) Transform(src stdimage.Image, options image.ProcessOptions) (*stdimage.NRGBA, image.ProcessOptions, error) {
+	img, err := apply(src, p.steps, &options)
+	if err != nil {
+		return nil, options, err
+	}
+	return toNRGBA(img), options, nil
+}
+
+// toNRGBA returns img as an NRGBA image, converting it if needed
+func toNRGBA(img stdimage.Image) *stdimage.NRGBA {
+	if nrgba, ok := img.(*stdimage.NRGBA); ok {
+		return nrgba
+	}
+	return imaging.Clone(img)
+}
+
+// apply runs steps in order
+func apply(img stdimage.Image, steps []compiledStep, options *image.ProcessOptions) (stdimage.Image, error) {
+	for _, step := range steps {
+		end := options.Hooks.Start(step.name)
+		slog.Debug("applying operation", "operation", step.name)
+		var err error
+		img, err = step.operation.Apply(img, options)
+		end()
+		if err != nil {
+			return nil, fmt.Errorf("failed to %s: %w", step.name, err)
+		}
+	}
+	return img, nil
+}
+
+// Execute decodes input, runs the pipeline on it and writes every output,
+// replacing existing files. Library users that need an overwrite policy can
+// call Run and write the outputs themselves.
+func (p *Pipeline) Execute(input string, options image.ProcessOptions) ([]image.Result, error) {
+	start := time.Now()
+	src, err := image.OpenImageWithOptions(input, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %w", err)
+	}
+
+	rendered, err := p.Run(src, options)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]image.Result, len(rendered))
+	for i, r := range rendered {
+		path := OutputPath(r.Path, input)
+		if err := image.SaveImage(r.Image, path, r.Options); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		if results[i], err = image.NewResult(input, src, path, r.Image, r.Options, start); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// OutputPath expands {name} in an output path to the file name of input
+// without its extension
+func OutputPath(template, input string) string {
+	name := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	return strings.ReplaceAll(template, "{name}", name)
+}
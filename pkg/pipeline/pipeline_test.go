@@ -0,0 +1,221 @@
+package pipeline
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	nimimage "nim/pkg/image"
+)
+
+func TestParse(t *testing.T) {
+	recipe, err := Parse([]byte(`
+input: photo.jpg
+steps:
+  - crop: 800x800+10+10
+  - resize: {size: 400x400, mode: fill}
+  - adjust: brightness=10:contrast=5
+outputs:
+  - path: out.webp
+    quality: 80
+  - path: thumb.png
+    steps:
+      - resize: 100x100:stretch
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse recipe: %v", err)
+	}
+
+	if recipe.Input != "photo.jpg" || len(recipe.Steps) != 3 || len(recipe.Outputs) != 2 {
+		t.Fatalf("Unexpected recipe: %+v", recipe)
+	}
+	if step := recipe.Steps[0]; step.Operation != "crop" || step.Params["region"] != "800x800+10+10" {
+		t.Errorf("Unexpected crop step: %+v", step)
+	}
+	if step := recipe.Steps[1]; step.Params["size"] != "400x400" || step.Params["mode"] != "fill" {
+		t.Errorf("Unexpected resize step: %+v", step)
+	}
+	if step := recipe.Steps[2]; step.Params["brightness"] != "10" || step.Params["contrast"] != "5" {
+		t.Errorf("Unexpected adjust step: %+v", step)
+	}
+	if output := recipe.Outputs[1]; len(output.Steps) != 1 || output.Steps[0].Params["mode"] != "stretch" {
+		t.Errorf("Unexpected output steps: %+v", output)
+	}
+
+	// JSON recipes are read as well
+	recipe, err = Parse([]byte(`{"steps": [{"resize": {"size": "10x10"}}], "outputs": [{"path": "out.png"}]}`))
+	if err != nil || len(recipe.Steps) != 1 || recipe.Steps[0].Params["size"] != "10x10" {
+		t.Errorf("Unexpected JSON recipe: %+v (%v)", recipe, err)
+	}
+
+	for _, invalid := range []string{
+		"stepz: []",                         // Unknown key
+		"steps: [resize]",                   // Step without parameters
+		"steps: [{crop: 1x1, resize: 1x1}]", // Two operations in one step
+		"steps: [{blurry: 2}]",              // Unknown operation in short form
+		"steps: [{crop: 1x1:2:3}]",          // Too many arguments
+	} {
+		if _, err := Parse([]byte(invalid)); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestParseStep(t *testing.T) {
+	step, err := ParseStep("resize=400x300:fit:pad=#000000")
+	if err != nil {
+		t.Fatalf("Failed to parse step: %v", err)
+	}
+	if step.Operation != "resize" || step.Params["size"] != "400x300" || step.Params["mode"] != "fit" || step.Params["pad"] != "#000000" {
+		t.Errorf("Unexpected step: %+v", step)
+	}
+
+	// Colons inside an rgb() color stay in the value
+	step, err = ParseStep("shadow=8:6:rgb(0 0 0 / 50%):background=rgb(1,2,3)")
+	if err != nil || step.Params["color"] != "rgb(0 0 0 / 50%)" || step.Params["background"] != "rgb(1,2,3)" {
+		t.Errorf("Unexpected step: %+v (%v)", step, err)
+	}
+
+	if _, err := ParseStep("=10"); err == nil {
+		t.Errorf("Expected an error for a step without a name")
+	}
+}
+
+func TestCompile(t *testing.T) {
+	valid := Recipe{
+		Steps:   []Step{{Operation: "resize", Params: Params{"size": "10x10"}}},
+		Outputs: []Output{{Path: "out.png"}},
+	}
+	if _, err := Compile(valid); err != nil {
+		t.Errorf("Expected a valid recipe, got %v", err)
+	}
+
+	tests := map[string]Recipe{
+		"no outputs":          {Steps: valid.Steps},
+		"output path":         {Outputs: []Output{{Format: "png"}}},
+		"output quality":      {Outputs: []Output{{Path: "out.jpg", Quality: 101}}},
+		"unknown operation":   {Steps: []Step{{Operation: "sepia"}}, Outputs: valid.Outputs},
+		"unknown parameter":   {Steps: []Step{{Operation: "resize", Params: Params{"size": "1x1", "filter": "box"}}}, Outputs: valid.Outputs},
+		"missing parameter":   {Steps: []Step{{Operation: "resize", Params: Params{"mode": "fit"}}}, Outputs: valid.Outputs},
+		"invalid output step": {Outputs: []Output{{Path: "out.png", Steps: []Step{{Operation: "crop", Params: Params{"region": "big"}}}}}},
+	}
+	for name, recipe := range tests {
+		if _, err := Compile(recipe); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	src := imaging.New(100, 50, color.NRGBA{255, 0, 0, 255})
+	p, err := Compile(Recipe{
+		Steps: []Step{
+			{Operation: "crop", Params: Params{"region": "50x50+25+0"}},
+			{Operation: "encode", Params: Params{"format": "png", "quality": "70"}},
+		},
+		Outputs: []Output{
+			{Path: "large.png"},
+			{Path: "small.jpg", Format: "jpg", Steps: []Step{{Operation: "resize", Params: Params{"size": "10x10"}}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to compile recipe: %v", err)
+	}
+
+	var stages []string
+	options := nimimage.DefaultOptions()
+	options.Hooks.OnStageStart = func(stage string) { stages = append(stages, stage) }
+	rendered, err := p.Run(src, options)
+	if err != nil {
+		t.Fatalf("Failed to run pipeline: %v", err)
+	}
+
+	if len(rendered) != 2 {
+		t.Fatalf("Expected 2 outputs, got %d", len(rendered))
+	}
+	if r := rendered[0]; r.Image.Bounds() != image.Rect(0, 0, 50, 50) || r.Options.OutputFormat != "png" || r.Options.Quality != 70 {
+		t.Errorf("Unexpected large output: %v, %s, %d", r.Image.Bounds(), r.Options.OutputFormat, r.Options.Quality)
+	}
+	if r := rendered[1]; r.Image.Bounds() != image.Rect(0, 0, 10, 10) || r.Options.OutputFormat != "jpg" || r.Options.Quality != 70 {
+		t.Errorf("Unexpected small output: %v, %s, %d", r.Image.Bounds(), r.Options.OutputFormat, r.Options.Quality)
+	}
+	if strings.Join(stages, ",") != "crop,encode,resize" {
+		t.Errorf("Unexpected stages: %v", stages)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "photo.png")
+	if err := imaging.Save(imaging.New(40, 20, color.NRGBA{0, 0, 255, 255}), input); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+
+	p, err := Compile(Recipe{
+		Steps:   []Step{{Operation: "resize", Params: Params{"size": "20x10", "mode": "stretch"}}},
+		Outputs: []Output{{Path: filepath.Join(dir, "{name}-small.png")}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to compile recipe: %v", err)
+	}
+	results, err := p.Execute(input, nimimage.DefaultOptions())
+	if err != nil {
+		t.Fatalf("Failed to execute pipeline: %v", err)
+	}
+
+	output := filepath.Join(dir, "photo-small.png")
+	if len(results) != 1 || results[0].Output != output || results[0].Width != 20 || results[0].OriginalWidth != 40 {
+		t.Errorf("Unexpected results: %+v", results)
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("Expected %s to be written: %v", output, err)
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	if path := OutputPath("out/{name}.webp", "/photos/beach.jpg"); path != "out/beach.webp" {
+		t.Errorf("Expected out/beach.webp, got %s", path)
+	}
+	if path := OutputPath("out.webp", "beach.jpg"); path != "out.webp" {
+		t.Errorf("Expected out.webp, got %s", path)
+	}
+}
+
+func TestCompileSteps(t *testing.T) {
+	var steps []Step
+	for _, spec := range []string{"crop=80x40+10+5", "resize=40x20:stretch", "blur=1", "encode=webp:70"} {
+		step, err := ParseStep(spec)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", spec, err)
+		}
+		steps = append(steps, step)
+	}
+	p, err := CompileSteps(steps)
+	if err != nil {
+		t.Fatalf("Failed to compile steps: %v", err)
+	}
+
+	img, options, err := p.Transform(imaging.New(100, 50, color.NRGBA{0, 255, 0, 255}), nimimage.DefaultOptions())
+	if err != nil {
+		t.Fatalf("Failed to transform: %v", err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 40, 20) {
+		t.Errorf("Expected 40x20, got %v", img.Bounds())
+	}
+	if options.OutputFormat != "webp" || options.Quality != 70 {
+		t.Errorf("Expected webp at quality 70, got %s at %d", options.OutputFormat, options.Quality)
+	}
+
+	// Order matters: resizing first leaves too little to crop
+	steps[0], steps[1] = steps[1], steps[0]
+	if p, err = CompileSteps(steps); err != nil {
+		t.Fatalf("Failed to compile steps: %v", err)
+	}
+	if _, _, err := p.Transform(imaging.New(100, 50, color.NRGBA{}), nimimage.DefaultOptions()); err == nil {
+		t.Errorf("Expected cropping 80x40 out of 40x20 to fail")
+	}
+}
@@ -0,0 +1,196 @@
+package placeholder
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// base83 is the BlurHash alphabet
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// blurHashMaxSize is the size images are shrunk to before BlurHash encoding;
+// the few components a hash holds gain nothing from more pixels
+const blurHashMaxSize = 64
+
+// BlurHash encodes an image as a BlurHash string with the given number of
+// horizontal and vertical components (1-9 each). See https://blurha.sh.
+func BlurHash(img image.Image, xComponents, yComponents int) (string, error) {
+	if xComponents < 1 || xComponents > 9 || yComponents < 1 || yComponents > 9 {
+		return "", fmt.Errorf("invalid BlurHash components: %dx%d (expected 1-9 each)", xComponents, yComponents)
+	}
+	if img.Bounds().Empty() {
+		return "", fmt.Errorf("image is empty")
+	}
+
+	small := imaging.Fit(img, blurHashMaxSize, blurHashMaxSize, imaging.Box)
+	w, h := small.Bounds().Dx(), small.Bounds().Dy()
+
+	// Linear RGB of every pixel
+	linear := make([][3]float64, w*h)
+	for i := range linear {
+		p := small.Pix[i*4 : i*4+3]
+		linear[i] = [3]float64{sRGBToLinear(p[0]), sRGBToLinear(p[1]), sRGBToLinear(p[2])}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalization := 2.0
+			if i == 0 && j == 0 {
+				normalization = 1
+			}
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				fy := math.Cos(math.Pi * float64(j) * float64(y) / float64(h))
+				for x := 0; x < w; x++ {
+					basis := fy * math.Cos(math.Pi*float64(i)*float64(x)/float64(w))
+					for c := 0; c < 3; c++ {
+						f[c] += basis * linear[y*w+x][c]
+					}
+				}
+			}
+			scale := normalization / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(encode83((xComponents-1)+(yComponents-1)*9, 1))
+
+	maximum := 1.0
+	if len(factors) > 1 {
+		var actual float64
+		for _, f := range factors[1:] {
+			actual = max(actual, math.Abs(f[0]), math.Abs(f[1]), math.Abs(f[2]))
+		}
+		quantized := int(max(0, min(82, math.Floor(actual*166-0.5))))
+		maximum = float64(quantized+1) / 166
+		b.WriteString(encode83(quantized, 1))
+	} else {
+		b.WriteString(encode83(0, 1))
+	}
+
+	dc := factors[0]
+	b.WriteString(encode83(linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4))
+	for _, f := range factors[1:] {
+		quantize := func(v float64) int {
+			return int(max(0, min(18, math.Floor(signPow(v/maximum, 0.5)*9+9.5))))
+		}
+		b.WriteString(encode83(quantize(f[0])*19*19+quantize(f[1])*19+quantize(f[2]), 2))
+	}
+	return b.String(), nil
+}
+
+// DecodeBlurHash renders a BlurHash at the given size. punch scales the
+// contrast of the components; 1 renders them as encoded.
+func DecodeBlurHash(hash string, width, height int, punch float64) (*image.NRGBA, error) {
+	if len(hash) < 6 {
+		return nil, fmt.Errorf("invalid BlurHash: too short")
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid size: %dx%d", width, height)
+	}
+
+	sizeFlag, err := decode83(hash[:1])
+	if err != nil {
+		return nil, err
+	}
+	xComponents, yComponents := sizeFlag%9+1, sizeFlag/9+1
+	if len(hash) != 4+2*xComponents*yComponents {
+		return nil, fmt.Errorf("invalid BlurHash: expected %d characters for %dx%d components, got %d",
+			4+2*xComponents*yComponents, xComponents, yComponents, len(hash))
+	}
+
+	quantizedMaximum, err := decode83(hash[1:2])
+	if err != nil {
+		return nil, err
+	}
+	maximum := float64(quantizedMaximum+1) / 166 * punch
+
+	colors := make([][3]float64, xComponents*yComponents)
+	dc, err := decode83(hash[2:6])
+	if err != nil {
+		return nil, err
+	}
+	colors[0] = [3]float64{sRGBToLinear(uint8(dc >> 16)), sRGBToLinear(uint8(dc >> 8)), sRGBToLinear(uint8(dc))}
+	for i := 1; i < len(colors); i++ {
+		ac, err := decode83(hash[4+i*2 : 6+i*2])
+		if err != nil {
+			return nil, err
+		}
+		unquantize := func(v int) float64 {
+			return signPow((float64(v)-9)/9, 2) * maximum
+		}
+		colors[i] = [3]float64{unquantize(ac / (19 * 19)), unquantize(ac / 19 % 19), unquantize(ac % 19)}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var c [3]float64
+			for j := 0; j < yComponents; j++ {
+				for i := 0; i < xComponents; i++ {
+					basis := math.Cos(math.Pi*float64(x)*float64(i)/float64(width)) *
+						math.Cos(math.Pi*float64(y)*float64(j)/float64(height))
+					for k := 0; k < 3; k++ {
+						c[k] += colors[j*xComponents+i][k] * basis
+					}
+				}
+			}
+			o := img.PixOffset(x, y)
+			img.Pix[o], img.Pix[o+1], img.Pix[o+2], img.Pix[o+3] =
+				uint8(linearToSRGB(c[0])), uint8(linearToSRGB(c[1])), uint8(linearToSRGB(c[2])), 255
+		}
+	}
+	return img, nil
+}
+
+// encode83 writes value as length base 83 digits
+func encode83(value, length int) string {
+	digits := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		digits[i] = base83[value%83]
+		value /= 83
+	}
+	return string(digits)
+}
+
+// decode83 reads base 83 digits
+func decode83(s string) (int, error) {
+	value := 0
+	for _, r := range s {
+		digit := strings.IndexRune(base83, r)
+		if digit < 0 {
+			return 0, fmt.Errorf("invalid BlurHash character: %q", r)
+		}
+		value = value*83 + digit
+	}
+	return value, nil
+}
+
+// sRGBToLinear converts an sRGB channel value to linear light
+func sRGBToLinear(v uint8) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB converts linear light to an sRGB channel value
+func linearToSRGB(v float64) int {
+	v = max(0, min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+// signPow raises the magnitude of v to exp, keeping its sign
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
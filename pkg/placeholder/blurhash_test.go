@@ -0,0 +1,76 @@
+package placeholder
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestBlurHashSolid(t *testing.T) {
+	img := imaging.New(32, 24, color.NRGBA{200, 100, 50, 255})
+	hash, err := BlurHash(img, 4, 3)
+	if err != nil {
+		t.Fatalf("BlurHash failed: %v", err)
+	}
+	if len(hash) != 4+2*4*3 {
+		t.Fatalf("Expected %d characters, got %q", 4+2*4*3, hash)
+	}
+	// Size flag 3+2*9 = 21 is "L"
+	if hash[0] != 'L' {
+		t.Errorf("Unexpected size flag in %q", hash)
+	}
+	if dc, _ := decode83(hash[2:6]); dc != 200<<16|100<<8|50 {
+		t.Errorf("Expected the DC term to hold the color, got %06x", dc)
+	}
+
+	decoded, err := DecodeBlurHash(hash, 8, 6, 1)
+	if err != nil {
+		t.Fatalf("DecodeBlurHash failed: %v", err)
+	}
+	c := decoded.NRGBAAt(4, 3)
+	if absDiff(c.R, 200) > 8 || absDiff(c.G, 100) > 8 || absDiff(c.B, 50) > 8 {
+		t.Errorf("Expected about the solid color back, got %v", c)
+	}
+}
+
+func TestBlurHashRoundTrip(t *testing.T) {
+	// Left half black, right half white
+	img := imaging.New(64, 32, color.NRGBA{0, 0, 0, 255})
+	img = imaging.Paste(img, imaging.New(32, 32, color.NRGBA{255, 255, 255, 255}), image.Pt(32, 0))
+
+	hash, err := BlurHash(img, 4, 3)
+	if err != nil {
+		t.Fatalf("BlurHash failed: %v", err)
+	}
+	decoded, err := DecodeBlurHash(hash, 64, 32, 1)
+	if err != nil {
+		t.Fatalf("DecodeBlurHash failed: %v", err)
+	}
+	if left, right := decoded.NRGBAAt(4, 16), decoded.NRGBAAt(60, 16); left.R > 128 || right.R < 192 {
+		t.Errorf("Expected a dark left and bright right side, got %v and %v", left, right)
+	}
+}
+
+func TestBlurHashErrors(t *testing.T) {
+	img := imaging.New(4, 4, color.NRGBA{})
+	for _, c := range [][2]int{{0, 3}, {4, 10}} {
+		if _, err := BlurHash(img, c[0], c[1]); err == nil {
+			t.Errorf("Expected an error for %dx%d components", c[0], c[1])
+		}
+	}
+	for _, hash := range []string{"", "L00000", "L0!!!!" + "00000000000000000000000"} {
+		if _, err := DecodeBlurHash(hash, 4, 4, 1); err == nil {
+			t.Errorf("Expected an error for %q", hash)
+		}
+	}
+}
+
+// absDiff returns the absolute difference of two channel values
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,69 @@
+package placeholder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	nimimage "nim/pkg/image"
+)
+
+// LQIPOptions configures a low-quality image placeholder
+type LQIPOptions struct {
+	Width   int     // Width of the preview; the height follows the aspect ratio
+	Blur    float64 // Sigma of the gaussian blur applied after shrinking; 0 disables it
+	Format  string  // Encoding of the preview (webp, jpg, png, ...)
+	Quality int     // Encoder quality (1-100)
+}
+
+// DefaultLQIPOptions returns options for a 24px wide, blurred WebP preview
+func DefaultLQIPOptions() LQIPOptions {
+	return LQIPOptions{Width: 24, Blur: 1.5, Format: "webp", Quality: 30}
+}
+
+// LQIP shrinks and blurs an image into a tiny preview and returns it as a
+// data: URI to inline in HTML or CSS
+func LQIP(img image.Image, options LQIPOptions) (string, error) {
+	if options.Width <= 0 {
+		return "", fmt.Errorf("invalid LQIP width: %d", options.Width)
+	}
+	if img.Bounds().Empty() {
+		return "", fmt.Errorf("image is empty")
+	}
+
+	preview := imaging.Resize(img, min(options.Width, img.Bounds().Dx()), 0, imaging.Lanczos)
+	if options.Blur > 0 {
+		preview = imaging.Blur(preview, options.Blur)
+	}
+
+	format := strings.ToLower(strings.TrimPrefix(options.Format, "."))
+	var buf bytes.Buffer
+	if err := nimimage.Encode(&buf, preview, nimimage.ProcessOptions{OutputFormat: format, Quality: options.Quality}); err != nil {
+		return "", err
+	}
+	return DataURI(buf.Bytes(), format), nil
+}
+
+// DataURI returns data encoded as a base64 data: URI with the MIME type of
+// the image format
+func DataURI(data []byte, format string) string {
+	return "data:" + MIMEType(format) + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// MIMEType returns the MIME type of an image format
+func MIMEType(format string) string {
+	switch format = strings.ToLower(format); format {
+	case "jpg", "jpeg":
+		return "image/jpeg"
+	case "svg":
+		return "image/svg+xml"
+	case "ico":
+		return "image/x-icon"
+	case "tif":
+		return "image/tiff"
+	}
+	return "image/" + format
+}
@@ -0,0 +1,63 @@
+package placeholder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestLQIP(t *testing.T) {
+	img := imaging.New(400, 200, color.NRGBA{30, 60, 90, 255})
+
+	options := DefaultLQIPOptions()
+	options.Format = "png"
+	uri, err := LQIP(img, options)
+	if err != nil {
+		t.Fatalf("LQIP failed: %v", err)
+	}
+	data, ok := strings.CutPrefix(uri, "data:image/png;base64,")
+	if !ok {
+		t.Fatalf("Expected a PNG data URI, got %q", uri)
+	}
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		t.Fatalf("Invalid base64: %v", err)
+	}
+	preview, err := png.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Invalid PNG: %v", err)
+	}
+	if preview.Bounds().Dx() != 24 || preview.Bounds().Dy() != 12 {
+		t.Errorf("Expected a 24x12 preview, got %v", preview.Bounds())
+	}
+
+	// The default WebP preview stays small enough to inline
+	if uri, err := LQIP(img, DefaultLQIPOptions()); err != nil || !strings.HasPrefix(uri, "data:image/webp;base64,") || len(uri) > 1000 {
+		t.Errorf("Unexpected WebP preview: %d bytes (%v)", len(uri), err)
+	}
+
+	// Small images are not enlarged
+	options.Width = 1000
+	if _, err := LQIP(imaging.New(10, 10, color.NRGBA{}), options); err != nil {
+		t.Errorf("LQIP failed for a small image: %v", err)
+	}
+
+	options.Width = 0
+	if _, err := LQIP(img, options); err == nil {
+		t.Errorf("Expected an error for a zero width")
+	}
+}
+
+func TestMIMEType(t *testing.T) {
+	tests := map[string]string{"jpg": "image/jpeg", "JPEG": "image/jpeg", "webp": "image/webp", "avif": "image/avif", "svg": "image/svg+xml"}
+	for format, expected := range tests {
+		if got := MIMEType(format); got != expected {
+			t.Errorf("%s: expected %s, got %s", format, expected, got)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package placeholder
+
+import (
+	"encoding/base64"
+	"fmt"
+	"image"
+)
+
+// Algorithm selects the placeholder encoding
+type Algorithm string
+
+const (
+	// AlgorithmBlurHash encodes a BlurHash with DefaultBlurHashComponents
+	AlgorithmBlurHash Algorithm = "blurhash"
+	// AlgorithmThumbHash encodes a ThumbHash as base64
+	AlgorithmThumbHash Algorithm = "thumbhash"
+	// AlgorithmLQIP encodes a tiny preview with DefaultLQIPOptions as a data: URI
+	AlgorithmLQIP Algorithm = "lqip"
+)
+
+// DefaultBlurHashComponents are the horizontal and vertical BlurHash
+// components Compute uses, which suit landscape photos
+var DefaultBlurHashComponents = [2]int{4, 3}
+
+// Compute returns the placeholder string of an image: a BlurHash, a
+// base64-encoded ThumbHash, or an LQIP data: URI
+func Compute(img image.Image, algorithm Algorithm) (string, error) {
+	switch algorithm {
+	case AlgorithmBlurHash:
+		return BlurHash(img, DefaultBlurHashComponents[0], DefaultBlurHashComponents[1])
+	case AlgorithmThumbHash:
+		if img.Bounds().Empty() {
+			return "", fmt.Errorf("image is empty")
+		}
+		return base64.StdEncoding.EncodeToString(ThumbHash(img)), nil
+	case AlgorithmLQIP:
+		return LQIP(img, DefaultLQIPOptions())
+	}
+	return "", fmt.Errorf("unknown placeholder algorithm: %s (expected blurhash, thumbhash, or lqip)", algorithm)
+}
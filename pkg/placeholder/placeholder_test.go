@@ -0,0 +1,39 @@
+package placeholder
+
+import (
+	"encoding/base64"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestCompute(t *testing.T) {
+	img := imaging.New(30, 20, color.NRGBA{10, 20, 30, 255})
+
+	blurHash, err := Compute(img, AlgorithmBlurHash)
+	if err != nil || len(blurHash) != 28 {
+		t.Errorf("Expected a 28 character BlurHash, got %q (%v)", blurHash, err)
+	}
+
+	thumbHash, err := Compute(img, AlgorithmThumbHash)
+	if err != nil {
+		t.Fatalf("Compute failed: %v", err)
+	}
+	if data, err := base64.StdEncoding.DecodeString(thumbHash); err != nil || len(data) < 5 {
+		t.Errorf("Expected a base64 ThumbHash, got %q (%v)", thumbHash, err)
+	}
+
+	if uri, err := Compute(img, AlgorithmLQIP); err != nil || !strings.HasPrefix(uri, "data:image/webp;base64,") {
+		t.Errorf("Expected a WebP data URI, got %q (%v)", uri, err)
+	}
+
+	if _, err := Compute(img, "jpeg"); err == nil {
+		t.Errorf("Expected an error for an unknown algorithm")
+	}
+	if _, err := Compute(image.NewNRGBA(image.Rect(0, 0, 0, 0)), AlgorithmThumbHash); err == nil {
+		t.Errorf("Expected an error for an empty image")
+	}
+}
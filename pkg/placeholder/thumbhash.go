@@ -0,0 +1,138 @@
+package placeholder
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// thumbHashMaxSize is the largest size ThumbHash encodes; larger images are
+// shrunk to fit
+const thumbHashMaxSize = 100
+
+// ThumbHash encodes an image as a ThumbHash, following the reference
+// implementation at https://evanw.github.io/thumbhash. Unlike BlurHash, it
+// keeps the aspect ratio and alpha of the image.
+func ThumbHash(img image.Image) []byte {
+	small := imaging.Fit(img, thumbHashMaxSize, thumbHashMaxSize, imaging.Box)
+	w, h := small.Bounds().Dx(), small.Bounds().Dy()
+	n := w * h
+
+	// Average color, weighted by alpha
+	var avgR, avgG, avgB, avgA float64
+	for i := 0; i < n; i++ {
+		p := small.Pix[i*4 : i*4+4]
+		alpha := float64(p[3]) / 255
+		avgR += alpha / 255 * float64(p[0])
+		avgG += alpha / 255 * float64(p[1])
+		avgB += alpha / 255 * float64(p[2])
+		avgA += alpha
+	}
+	if avgA > 0 {
+		avgR /= avgA
+		avgG /= avgA
+		avgB /= avgA
+	}
+
+	hasAlpha := avgA < float64(n)
+	limit := 7.0
+	if hasAlpha {
+		// Fewer luminance bits leave room for the alpha channel
+		limit = 5
+	}
+	longest := float64(max(w, h))
+	lx := max(1, int(math.Round(limit*float64(w)/longest)))
+	ly := max(1, int(math.Round(limit*float64(h)/longest)))
+
+	// Convert to luminance, yellow-blue, red-green and alpha, composited
+	// over the average color
+	l, p, q, a := make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n)
+	for i := 0; i < n; i++ {
+		px := small.Pix[i*4 : i*4+4]
+		alpha := float64(px[3]) / 255
+		r := avgR*(1-alpha) + alpha/255*float64(px[0])
+		g := avgG*(1-alpha) + alpha/255*float64(px[1])
+		b := avgB*(1-alpha) + alpha/255*float64(px[2])
+		l[i] = (r + g + b) / 3
+		p[i] = (r+g)/2 - b
+		q[i] = r - g
+		a[i] = alpha
+	}
+
+	// encodeChannel splits a channel into its DCT constant and the varying
+	// terms normalized to 0-1, with the scale they were normalized by
+	encodeChannel := func(channel []float64, nx, ny int) (float64, []float64, float64) {
+		var dc, scale float64
+		var ac []float64
+		fx := make([]float64, w)
+		for cy := 0; cy < ny; cy++ {
+			for cx := 0; cx*ny < nx*(ny-cy); cx++ {
+				for x := 0; x < w; x++ {
+					fx[x] = math.Cos(math.Pi / float64(w) * float64(cx) * (float64(x) + 0.5))
+				}
+				var f float64
+				for y := 0; y < h; y++ {
+					fy := math.Cos(math.Pi / float64(h) * float64(cy) * (float64(y) + 0.5))
+					for x := 0; x < w; x++ {
+						f += channel[x+y*w] * fx[x] * fy
+					}
+				}
+				f /= float64(n)
+				if cx > 0 || cy > 0 {
+					ac = append(ac, f)
+					scale = max(scale, math.Abs(f))
+				} else {
+					dc = f
+				}
+			}
+		}
+		if scale > 0 {
+			for i := range ac {
+				ac[i] = 0.5 + 0.5/scale*ac[i]
+			}
+		}
+		return dc, ac, scale
+	}
+
+	lDC, lAC, lScale := encodeChannel(l, max(3, lx), max(3, ly))
+	pDC, pAC, pScale := encodeChannel(p, 3, 3)
+	qDC, qAC, qScale := encodeChannel(q, 3, 3)
+
+	round := func(v float64) int { return int(math.Round(v)) }
+	isLandscape := 0
+	if w > h {
+		isLandscape = 1
+	}
+	alphaBit := 0
+	if hasAlpha {
+		alphaBit = 1
+	}
+	header24 := round(63*lDC) | round(31.5+31.5*pDC)<<6 | round(31.5+31.5*qDC)<<12 | round(31*lScale)<<18 | alphaBit<<23
+	side := lx
+	if isLandscape == 1 {
+		side = ly
+	}
+	header16 := side | round(63*pScale)<<3 | round(63*qScale)<<9 | isLandscape<<15
+	hash := []byte{byte(header24), byte(header24 >> 8), byte(header24 >> 16), byte(header16), byte(header16 >> 8)}
+
+	channels := [][]float64{lAC, pAC, qAC}
+	if hasAlpha {
+		aDC, aAC, aScale := encodeChannel(a, 5, 5)
+		hash = append(hash, byte(round(15*aDC)|round(15*aScale)<<4))
+		channels = append(channels, aAC)
+	}
+
+	// Two varying terms per byte, low nibble first
+	index := 0
+	for _, ac := range channels {
+		for _, f := range ac {
+			if index%2 == 0 {
+				hash = append(hash, 0)
+			}
+			hash[len(hash)-1] |= byte(round(15*f) << ((index & 1) << 2))
+			index++
+		}
+	}
+	return hash
+}
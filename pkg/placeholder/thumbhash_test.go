@@ -0,0 +1,50 @@
+package placeholder
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestThumbHashSolid(t *testing.T) {
+	hash := ThumbHash(imaging.New(50, 50, color.NRGBA{255, 0, 0, 255}))
+
+	// A square opaque image has 7x7 luminance terms: 27 varying luminance
+	// terms and 5 each of the two chroma channels, two to a byte
+	if len(hash) != 5+(27+5+5+1)/2 {
+		t.Fatalf("Expected %d bytes, got %d", 5+(27+5+5+1)/2, len(hash))
+	}
+
+	header24 := int(hash[0]) | int(hash[1])<<8 | int(hash[2])<<16
+	// Red has luminance 1/3, yellow-blue 0.5 and red-green 1
+	if l := header24 & 63; l != 21 {
+		t.Errorf("Expected luminance 21, got %d", l)
+	}
+	if p := header24 >> 6 & 63; p != 47 {
+		t.Errorf("Expected yellow-blue 47, got %d", p)
+	}
+	if q := header24 >> 12 & 63; q != 63 {
+		t.Errorf("Expected red-green 63, got %d", q)
+	}
+	if header24>>23 != 0 {
+		t.Errorf("Expected no alpha")
+	}
+}
+
+func TestThumbHashShape(t *testing.T) {
+	landscape := ThumbHash(imaging.New(200, 100, color.NRGBA{0, 0, 255, 255}))
+	header16 := int(landscape[3]) | int(landscape[4])<<8
+	if header16>>15 != 1 {
+		t.Errorf("Expected the landscape flag")
+	}
+	// The short side of a 2:1 image gets 4 of the 7 luminance terms
+	if side := header16 & 7; side != 4 {
+		t.Errorf("Expected 4 terms on the short side, got %d", side)
+	}
+
+	transparent := ThumbHash(imaging.New(40, 40, color.NRGBA{0, 255, 0, 128}))
+	if transparent[2]>>7 != 1 {
+		t.Errorf("Expected the alpha flag")
+	}
+}
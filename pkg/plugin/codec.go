@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+	nimimage "nim/pkg/image"
+)
+
+// CodecPrefix is the name prefix of codec plugin executables in PATH
+const CodecPrefix = "nim-codec-"
+
+// frameMagic starts every frame, and changes if the frame layout does
+var frameMagic = [4]byte{'N', 'I', 'M', '1'}
+
+// infoTimeout limits how long a plugin may take to describe itself
+const infoTimeout = 5 * time.Second
+
+// CodecInfo is the JSON a codec plugin prints when run with "info"
+type CodecInfo struct {
+	Name       string   `json:"name"`       // Human-readable format name
+	Extensions []string `json:"extensions"` // File extensions without the leading dot
+	Decode     bool     `json:"decode"`     // Whether "decode" is supported
+	Encode     bool     `json:"encode"`     // Whether "encode" is supported
+}
+
+// FindCodecs returns the codec plugins in PATH. Like PATH lookup, the first
+// directory wins when several have a plugin of the same name.
+func FindCodecs() []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+			if !strings.HasPrefix(name, CodecPrefix) || seen[name] || entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if _, err := exec.LookPath(path); err != nil {
+				continue
+			}
+			seen[name] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// LoadCodec asks the plugin at path what it supports and returns a codec
+// that runs it
+func LoadCodec(path string) (nimimage.Codec, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), infoTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, "info")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nimimage.Codec{}, fmt.Errorf("%s info failed: %w: %s", path, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	var info CodecInfo
+	if err := json.Unmarshal(stdout.Bytes(), &info); err != nil {
+		return nimimage.Codec{}, fmt.Errorf("%s info printed invalid JSON: %w", path, err)
+	}
+	if info.Name == "" || len(info.Extensions) == 0 || !info.Decode && !info.Encode {
+		return nimimage.Codec{}, fmt.Errorf("%s info needs a name, extensions and decode or encode", path)
+	}
+
+	name := filepath.Base(path)
+	codec := nimimage.Codec{
+		Name:       info.Name,
+		Extensions: info.Extensions,
+		Tools:      []string{strings.TrimSuffix(name, filepath.Ext(name))},
+		Note:       "plugin " + name,
+	}
+	if info.Decode {
+		codec.Decode = func(r io.Reader, options nimimage.ProcessOptions) (image.Image, error) {
+			var stdout bytes.Buffer
+			if err := run(path, r, &stdout, "decode"); err != nil {
+				return nil, err
+			}
+			return ReadFrame(&stdout)
+		}
+	}
+	if info.Encode {
+		codec.Encode = func(w io.Writer, img image.Image, options nimimage.ProcessOptions) error {
+			var frame bytes.Buffer
+			if err := WriteFrame(&frame, img); err != nil {
+				return err
+			}
+			return run(path, &frame, w, "encode", "--format", options.OutputFormat, "--quality", strconv.Itoa(options.Quality))
+		}
+	}
+	return codec, nil
+}
+
+// RegisterCodecs registers the codec plugins in PATH, so OpenImage, Encode
+// and Formats handle their formats. Plugins that fail to load are skipped
+// and their errors returned.
+func RegisterCodecs() []error {
+	var errs []error
+	for _, path := range FindCodecs() {
+		codec, err := LoadCodec(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		slog.Debug("registered codec plugin", "path", path, "format", codec.Name, "extensions", codec.Extensions)
+		nimimage.RegisterCodec(codec)
+	}
+	return errs
+}
+
+// run runs a plugin command with stdin and stdout
+func run(path string, stdin io.Reader, stdout io.Writer, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(path, args...)
+	slog.Debug("running codec plugin", "path", path, "args", args)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s failed: %w: %s", filepath.Base(path), args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// WriteFrame writes img as a frame: the magic "NIM1", the width and height
+// as big-endian 32-bit integers, then the 8-bit non-premultiplied RGBA
+// pixels row by row
+func WriteFrame(w io.Writer, img image.Image) error {
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || nrgba.Rect.Min != (image.Point{}) || nrgba.Stride != 4*nrgba.Rect.Dx() {
+		nrgba = imaging.Clone(img)
+	}
+	var header [12]byte
+	copy(header[:], frameMagic[:])
+	binary.BigEndian.PutUint32(header[4:], uint32(nrgba.Rect.Dx()))
+	binary.BigEndian.PutUint32(header[8:], uint32(nrgba.Rect.Dy()))
+	if _, err := w.Write(header[:]); err != nil {
+		return fmt.Errorf("failed to write frame: %w", err)
+	}
+	if _, err := w.Write(nrgba.Pix); err != nil {
+		return fmt.Errorf("failed to write frame: %w", err)
+	}
+	return nil
+}
+
+// ReadFrame reads a frame written by WriteFrame
+func ReadFrame(r io.Reader) (*image.NRGBA, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read frame header: %w", err)
+	}
+	if [4]byte(header[:4]) != frameMagic {
+		return nil, errors.New("invalid frame: expected the NIM1 magic")
+	}
+	width, height := binary.BigEndian.Uint32(header[4:]), binary.BigEndian.Uint32(header[8:])
+	if width == 0 || height == 0 || uint64(width)*uint64(height) > 1<<32 {
+		return nil, fmt.Errorf("invalid frame size: %dx%d", width, height)
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, int(width), int(height)))
+	if _, err := io.ReadFull(r, img.Pix); err != nil {
+		return nil, fmt.Errorf("failed to read frame pixels: %w", err)
+	}
+	return img, nil
+}
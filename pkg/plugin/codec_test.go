@@ -0,0 +1,126 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	nimimage "nim/pkg/image"
+)
+
+// TestMain makes the test binary act as a codec plugin for the "frame"
+// format, whose files are frames, when NIM_TEST_CODEC is set
+func TestMain(m *testing.M) {
+	if os.Getenv("NIM_TEST_CODEC") == "" {
+		os.Exit(m.Run())
+	}
+	switch os.Args[1] {
+	case "info":
+		json.NewEncoder(os.Stdout).Encode(CodecInfo{Name: "Test frame", Extensions: []string{"frame"}, Decode: true, Encode: true})
+	case "decode", "encode":
+		img, err := ReadFrame(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		WriteFrame(os.Stdout, img)
+	default:
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+// installCodec puts a codec plugin running the test binary in a new PATH
+func installCodec(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test plugin is a shell script")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, CodecPrefix+"test")
+	script := fmt.Sprintf("#!/bin/sh\nNIM_TEST_CODEC=1 exec %q \"$@\"\n", exe)
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Not executable, so not a plugin
+	if err := os.WriteFile(filepath.Join(dir, CodecPrefix+"readme"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	return path
+}
+
+func TestCodecPlugin(t *testing.T) {
+	path := installCodec(t)
+	if found := FindCodecs(); len(found) != 1 || found[0] != path {
+		t.Fatalf("found %v, expected %s", found, path)
+	}
+	if errs := RegisterCodecs(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	codec, ok := nimimage.LookupCodec("frame")
+	if !ok || codec.Decode == nil || codec.Encode == nil {
+		t.Fatalf("codec: %+v", codec)
+	}
+
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	src.SetNRGBA(1, 1, color.NRGBA{10, 20, 30, 40})
+	var buf bytes.Buffer
+	if err := nimimage.Encode(&buf, src, nimimage.ProcessOptions{OutputFormat: "frame", Quality: 85}); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := codec.Decode(&buf, nimimage.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.(*image.NRGBA).Pix, src.Pix) {
+		t.Errorf("decoded %v, expected %v", decoded.(*image.NRGBA).Pix, src.Pix)
+	}
+	if _, err := codec.Decode(bytes.NewReader([]byte("garbage")), nimimage.DefaultOptions()); err == nil {
+		t.Error("expected an error for an invalid file")
+	}
+
+	var listed bool
+	for _, format := range nimimage.Formats() {
+		if format.Name == "Test frame" {
+			listed = format.Read && format.Write && format.Enabled
+		}
+	}
+	if !listed {
+		t.Error("expected the plugin format in Formats")
+	}
+}
+
+func TestFrame(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(5, 5, 9, 8))
+	src.SetNRGBA(6, 7, color.NRGBA{1, 2, 3, 4})
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, src.SubImage(image.Rect(5, 5, 9, 8))); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 12+4*3*4 {
+		t.Fatalf("frame of %d bytes", buf.Len())
+	}
+	img, err := ReadFrame(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Rect != image.Rect(0, 0, 4, 3) || img.NRGBAAt(1, 2) != (color.NRGBA{1, 2, 3, 4}) {
+		t.Errorf("read %v with %v", img.Rect, img.NRGBAAt(1, 2))
+	}
+
+	for _, data := range []string{"", "NIM2\x00\x00\x00\x01\x00\x00\x00\x01abcd", "NIM1\x00\x00\x00\x00\x00\x00\x00\x01", "NIM1\x00\x00\x00\x02\x00\x00\x00\x01abcd"} {
+		if _, err := ReadFrame(bytes.NewReader([]byte(data))); err == nil {
+			t.Errorf("%q: expected an error", data)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"os"
+
+	"github.com/disintegration/imaging"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// Filter is a WebAssembly module that changes the pixels of images. It
+// exports its memory as "memory" and two functions:
+//
+//	alloc(size i32) i32
+//	filter(pixels i32, width i32, height i32, args i32, args_len i32) i32
+//
+// alloc returns the address of size free bytes in memory. filter changes the
+// 8-bit non-premultiplied RGBA pixels at pixels in place, row by row, and
+// returns 0, or an error code. args holds the arguments of the filter as a
+// string. Modules built for WASI can use its functions, but have no access
+// to files, the network or the environment.
+type Filter struct {
+	path     string
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+}
+
+// LoadFilter compiles the WebAssembly module at path
+func LoadFilter(path string) (*Filter, error) {
+	wasm, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin: %w", err)
+	}
+	ctx := context.Background()
+	r := wazero.NewRuntime(ctx)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		r.Close(ctx)
+		return nil, fmt.Errorf("failed to set up WASI: %w", err)
+	}
+	compiled, err := r.CompileModule(ctx, wasm)
+	if err != nil {
+		r.Close(ctx)
+		return nil, fmt.Errorf("failed to compile plugin %s: %w", path, err)
+	}
+	for _, name := range []string{"alloc", "filter"} {
+		if _, ok := compiled.ExportedFunctions()[name]; !ok {
+			r.Close(ctx)
+			return nil, fmt.Errorf("plugin %s does not export %s", path, name)
+		}
+	}
+	if _, ok := compiled.ExportedMemories()["memory"]; !ok {
+		r.Close(ctx)
+		return nil, fmt.Errorf("plugin %s does not export its memory", path)
+	}
+	return &Filter{path: path, runtime: r, compiled: compiled}, nil
+}
+
+// Apply runs the filter on a copy of img with the given arguments. Each call
+// runs in a new instance of the module, so no state is kept between images.
+func (f *Filter) Apply(img image.Image, args string) (*image.NRGBA, error) {
+	ctx := context.Background()
+	var stderr bytes.Buffer
+	config := wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize").WithStderr(&stderr)
+	module, err := f.runtime.InstantiateModule(ctx, f.compiled, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %w", f.path, err)
+	}
+	defer module.Close(ctx)
+
+	out := imaging.Clone(img)
+	w, h := out.Rect.Dx(), out.Rect.Dy()
+	pixels, err := f.write(ctx, module, out.Pix)
+	if err != nil {
+		return nil, err
+	}
+	argsPtr, err := f.write(ctx, module, []byte(args))
+	if err != nil {
+		return nil, err
+	}
+	results, err := module.ExportedFunction("filter").Call(ctx, uint64(pixels), uint64(w), uint64(h), uint64(argsPtr), uint64(len(args)))
+	if err == nil && int32(results[0]) != 0 {
+		err = fmt.Errorf("error code %d", int32(results[0]))
+	}
+	if err != nil {
+		if message := bytes.TrimSpace(stderr.Bytes()); len(message) > 0 {
+			return nil, fmt.Errorf("plugin %s failed: %w: %s", f.path, err, message)
+		}
+		return nil, fmt.Errorf("plugin %s failed: %w", f.path, err)
+	}
+	result, ok := module.Memory().Read(pixels, uint32(len(out.Pix)))
+	if !ok {
+		return nil, fmt.Errorf("plugin %s freed the image memory", f.path)
+	}
+	copy(out.Pix, result)
+	return out, nil
+}
+
+// write copies data into memory the module allocates, and returns its address
+func (f *Filter) write(ctx context.Context, module api.Module, data []byte) (uint32, error) {
+	if uint64(len(data)) > 1<<32-1 {
+		return 0, fmt.Errorf("image too large for plugin %s", f.path)
+	}
+	results, err := module.ExportedFunction("alloc").Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, fmt.Errorf("plugin %s failed to allocate memory: %w", f.path, err)
+	}
+	ptr := uint32(results[0])
+	if !module.Memory().Write(ptr, data) {
+		return 0, fmt.Errorf("plugin %s allocated memory out of range", f.path)
+	}
+	return ptr, nil
+}
+
+// Close releases the compiled module
+func (f *Filter) Close() error {
+	return f.runtime.Close(context.Background())
+}
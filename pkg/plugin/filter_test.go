@@ -0,0 +1,62 @@
+package plugin
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	filter, err := LoadFilter(filepath.Join("testdata", "invert.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filter.Close()
+
+	src := image.NewNRGBA(image.Rect(3, 4, 303, 204))
+	src.SetNRGBA(10, 20, color.NRGBA{10, 200, 30, 40})
+	sub := src.SubImage(image.Rect(5, 10, 105, 110))
+	for i := 0; i < 2; i++ {
+		out, err := filter.Apply(sub, "strength=3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.Rect != image.Rect(0, 0, 100, 100) {
+			t.Fatalf("size %v", out.Rect)
+		}
+		if c := out.NRGBAAt(5, 10); c != (color.NRGBA{245, 55, 225, 40}) {
+			t.Errorf("run %d: pixel is %v", i, c)
+		}
+		if c := out.NRGBAAt(99, 99); c != (color.NRGBA{255, 255, 255, 0}) {
+			t.Errorf("run %d: last pixel is %v", i, c)
+		}
+	}
+	// The source is left alone
+	if c := src.NRGBAAt(10, 20); c != (color.NRGBA{10, 200, 30, 40}) {
+		t.Errorf("source pixel is %v", c)
+	}
+
+	if _, err := filter.Apply(sub, "x=1"); err == nil {
+		t.Error("expected the error code of the filter")
+	}
+}
+
+func TestLoadFilterErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.wasm")
+	if err := os.WriteFile(invalid, []byte("not wasm"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A valid module without exports
+	empty := filepath.Join(dir, "empty.wasm")
+	if err := os.WriteFile(empty, []byte("\x00asm\x01\x00\x00\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(dir, "missing.wasm"), invalid, empty} {
+		if _, err := LoadFilter(path); err == nil {
+			t.Errorf("%s: expected an error", filepath.Base(path))
+		}
+	}
+}
@@ -0,0 +1,35 @@
+;; Source of invert.wasm: a filter that inverts the RGB channels, and fails
+;; with code 1 when its arguments start with "x"
+(module
+  (memory (export "memory") 1)
+  (global $next (mut i32) (i32.const 1024))
+
+  (func (export "alloc") (param $size i32) (result i32)
+    (local $p i32) (local $grow i32)
+    (local.set $p (global.get $next))
+    (local.tee $grow
+      (i32.sub
+        (i32.shr_u (i32.add (i32.add (local.get $p) (local.get $size)) (i32.const 65535)) (i32.const 16))
+        (memory.size)))
+    (if (i32.gt_s (i32.const 0))
+      (then (drop (memory.grow (local.get $grow)))))
+    (global.set $next (i32.add (local.get $p) (local.get $size)))
+    (local.get $p))
+
+  (func (export "filter") (param $pixels i32) (param $width i32) (param $height i32)
+                          (param $args i32) (param $len i32) (result i32)
+    (local $end i32)
+    (if (local.get $len)
+      (then (if (i32.eq (i32.load8_u (local.get $args)) (i32.const 120))
+        (then (return (i32.const 1))))))
+    (local.set $end (i32.add (local.get $pixels)
+      (i32.mul (i32.mul (local.get $width) (local.get $height)) (i32.const 4))))
+    (block $done
+      (loop $next
+        (br_if $done (i32.ge_u (local.get $pixels) (local.get $end)))
+        (i32.store8 offset=0 (local.get $pixels) (i32.sub (i32.const 255) (i32.load8_u offset=0 (local.get $pixels))))
+        (i32.store8 offset=1 (local.get $pixels) (i32.sub (i32.const 255) (i32.load8_u offset=1 (local.get $pixels))))
+        (i32.store8 offset=2 (local.get $pixels) (i32.sub (i32.const 255) (i32.load8_u offset=2 (local.get $pixels))))
+        (local.set $pixels (i32.add (local.get $pixels) (i32.const 4)))
+        (br $next)))
+    (i32.const 0)))
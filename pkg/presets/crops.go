@@ -0,0 +1,67 @@
+package presets
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Crop is the image spec of a platform: the exact pixel size it shows, the
+// resize mode that reaches its aspect ratio, and the format and quality it
+// handles best
+type Crop struct {
+	Name        string
+	Description string
+	Width       int
+	Height      int
+	Mode        string // fill crops the excess; fit keeps the whole image inside the size
+	Format      string
+	Quality     int
+}
+
+// Crops are the platform specs of --crop-preset
+var Crops = []Crop{
+	{Name: "instagram-square", Description: "Instagram square post", Width: 1080, Height: 1080, Mode: "fill", Format: "jpg", Quality: 90},
+	{Name: "instagram-portrait", Description: "Instagram portrait post (4:5)", Width: 1080, Height: 1350, Mode: "fill", Format: "jpg", Quality: 90},
+	{Name: "instagram-landscape", Description: "Instagram landscape post (1.91:1)", Width: 1080, Height: 566, Mode: "fill", Format: "jpg", Quality: 90},
+	{Name: "instagram-story", Description: "Instagram and Facebook story or reel cover (9:16)", Width: 1080, Height: 1920, Mode: "fill", Format: "jpg", Quality: 90},
+	{Name: "facebook-post", Description: "Facebook link and feed image", Width: 1200, Height: 630, Mode: "fill", Format: "jpg", Quality: 85},
+	{Name: "facebook-cover", Description: "Facebook page cover photo", Width: 851, Height: 315, Mode: "fill", Format: "jpg", Quality: 90},
+	{Name: "twitter-post", Description: "X (Twitter) post image (16:9)", Width: 1600, Height: 900, Mode: "fill", Format: "jpg", Quality: 85},
+	{Name: "twitter-header", Description: "X (Twitter) profile header (3:1)", Width: 1500, Height: 500, Mode: "fill", Format: "jpg", Quality: 90},
+	{Name: "linkedin-post", Description: "LinkedIn shared image", Width: 1200, Height: 627, Mode: "fill", Format: "jpg", Quality: 85},
+	{Name: "linkedin-banner", Description: "LinkedIn profile background (4:1)", Width: 1584, Height: 396, Mode: "fill", Format: "jpg", Quality: 90},
+	{Name: "youtube-thumb", Description: "YouTube video thumbnail (16:9, under 2 MB)", Width: 1280, Height: 720, Mode: "fill", Format: "jpg", Quality: 85},
+	{Name: "youtube-banner", Description: "YouTube channel banner", Width: 2560, Height: 1440, Mode: "fill", Format: "jpg", Quality: 90},
+	{Name: "pinterest-pin", Description: "Pinterest standard pin (2:3)", Width: 1000, Height: 1500, Mode: "fill", Format: "jpg", Quality: 85},
+	{Name: "tiktok-cover", Description: "TikTok video cover (9:16)", Width: 1080, Height: 1920, Mode: "fill", Format: "jpg", Quality: 85},
+}
+
+// LookupCrop returns the platform spec with the given name
+func LookupCrop(name string) (Crop, bool) {
+	for _, crop := range Crops {
+		if crop.Name == name {
+			return crop, true
+		}
+	}
+	return Crop{}, false
+}
+
+// Size returns the size of c in format WIDTHxHEIGHT
+func (c Crop) Size() string {
+	return fmt.Sprintf("%dx%d", c.Width, c.Height)
+}
+
+// Preset returns c as the flag values it sets. The format is left out: it is
+// only a recommendation, used when the output file has no extension.
+func (c Crop) Preset() Preset {
+	return Preset{
+		Name:        c.Name,
+		Description: fmt.Sprintf("%s, %s %s, %s quality %d", c.Description, c.Size(), c.Mode, c.Format, c.Quality),
+		Values: map[string]string{
+			"size":    c.Size(),
+			"mode":    c.Mode,
+			"quality": strconv.Itoa(c.Quality),
+		},
+		Builtin: true,
+	}
+}
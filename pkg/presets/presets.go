@@ -0,0 +1,93 @@
+package presets
+
+import (
+	"sort"
+)
+
+// DescriptionKey is the preset value that holds its description rather than a flag value
+const DescriptionKey = "description"
+
+// Preset is a named set of flag values, keyed by long flag name
+type Preset struct {
+	Name        string
+	Description string
+	Values      map[string]string
+	Builtin     bool
+}
+
+// Builtin are the presets bundled with nim
+var Builtin = []Preset{
+	{
+		Name:        "thumbnail",
+		Description: "256x256 thumbnail, cropped to fill",
+		Values:      map[string]string{"size": "256x256", "mode": "fill", "quality": "80"},
+		Builtin:     true,
+	},
+	{
+		Name:        "avatar",
+		Description: "512x512 profile picture, cropped to fill",
+		Values:      map[string]string{"size": "512x512", "mode": "fill", "quality": "85"},
+		Builtin:     true,
+	},
+	{
+		Name:        "og-image",
+		Description: "1200x630 Open Graph and social preview image, cropped to fill",
+		Values:      map[string]string{"size": "1200x630", "mode": "fill", "quality": "85"},
+		Builtin:     true,
+	},
+}
+
+// FromConfig returns a user-defined preset from its configured values
+func FromConfig(name string, values map[string]string) Preset {
+	preset := Preset{Name: name, Values: map[string]string{}}
+	for key, value := range values {
+		if key == DescriptionKey {
+			preset.Description = value
+			continue
+		}
+		preset.Values[key] = value
+	}
+	return preset
+}
+
+// All returns the bundled presets and the user-defined ones, sorted by name.
+// User-defined presets replace bundled presets of the same name.
+func All(user map[string]map[string]string) []Preset {
+	byName := map[string]Preset{}
+	for _, preset := range Builtin {
+		byName[preset.Name] = preset
+	}
+	for name, values := range user {
+		byName[name] = FromConfig(name, values)
+	}
+
+	presets := make([]Preset, 0, len(byName))
+	for _, preset := range byName {
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	return presets
+}
+
+// Lookup returns the preset with the given name, preferring user-defined presets
+func Lookup(name string, user map[string]map[string]string) (Preset, bool) {
+	if values, ok := user[name]; ok {
+		return FromConfig(name, values), true
+	}
+	for _, preset := range Builtin {
+		if preset.Name == name {
+			return preset, true
+		}
+	}
+	return Preset{}, false
+}
+
+// Keys returns the flag names a preset sets, sorted
+func (p Preset) Keys() []string {
+	keys := make([]string, 0, len(p.Values))
+	for key := range p.Values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
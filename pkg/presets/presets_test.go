@@ -0,0 +1,89 @@
+package presets
+
+import (
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	user := map[string]map[string]string{
+		"hero":      {"size": "1600x900", "description": "Homepage hero"},
+		"thumbnail": {"size": "128x128"},
+	}
+
+	hero, ok := Lookup("hero", user)
+	if !ok || hero.Values["size"] != "1600x900" || hero.Description != "Homepage hero" || hero.Builtin {
+		t.Errorf("Unexpected hero preset: %+v", hero)
+	}
+	if _, ok := hero.Values[DescriptionKey]; ok {
+		t.Errorf("Expected the description not to be a flag value")
+	}
+
+	// User presets replace bundled ones
+	thumbnail, ok := Lookup("thumbnail", user)
+	if !ok || thumbnail.Values["size"] != "128x128" {
+		t.Errorf("Expected the user thumbnail preset, got %+v", thumbnail)
+	}
+
+	avatar, ok := Lookup("avatar", user)
+	if !ok || !avatar.Builtin || avatar.Values["size"] != "512x512" {
+		t.Errorf("Expected the bundled avatar preset, got %+v", avatar)
+	}
+
+	if _, ok := Lookup("missing", user); ok {
+		t.Errorf("Expected no preset named missing")
+	}
+}
+
+func TestAll(t *testing.T) {
+	presets := All(map[string]map[string]string{"hero": {"size": "1600x900"}, "avatar": {"size": "64x64"}})
+
+	names := make([]string, len(presets))
+	for i, preset := range presets {
+		names[i] = preset.Name
+	}
+	expected := []string{"avatar", "hero", "og-image", "thumbnail"}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, names)
+		}
+	}
+	if presets[0].Builtin {
+		t.Errorf("Expected the user avatar preset to replace the bundled one")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	keys := Builtin[0].Keys()
+	if len(keys) != 3 || keys[0] != "mode" || keys[1] != "quality" || keys[2] != "size" {
+		t.Errorf("Unexpected keys: %v", keys)
+	}
+}
+
+func TestLookupCrop(t *testing.T) {
+	crop, ok := LookupCrop("twitter-header")
+	if !ok || crop.Size() != "1500x500" {
+		t.Fatalf("Unexpected twitter-header crop: %+v", crop)
+	}
+	preset := crop.Preset()
+	if preset.Values["size"] != "1500x500" || preset.Values["mode"] != "fill" || preset.Values["quality"] != "90" {
+		t.Errorf("Unexpected flag values: %v", preset.Values)
+	}
+	if _, ok := preset.Values["format"]; ok {
+		t.Error("Expected the format not to be a flag value")
+	}
+	if _, ok := LookupCrop("myspace-banner"); ok {
+		t.Error("Expected no crop named myspace-banner")
+	}
+
+	// Names are unique and specs complete
+	seen := map[string]bool{}
+	for _, crop := range Crops {
+		if seen[crop.Name] || crop.Width <= 0 || crop.Height <= 0 || crop.Format == "" || crop.Quality <= 0 {
+			t.Errorf("Invalid crop: %+v", crop)
+		}
+		seen[crop.Name] = true
+	}
+}
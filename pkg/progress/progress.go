@@ -0,0 +1,177 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// barWidth is the number of cells in the progress bar
+const barWidth = 30
+
+// spinnerFrames are drawn in turn while a spinner runs
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// clearLine returns the cursor to the start of the line and erases it
+const clearLine = "\r\033[K"
+
+// Display is a progress indicator drawn on a single terminal line
+type Display interface {
+	// Printf writes a message to w, keeping it from sharing a line with the indicator
+	Printf(w io.Writer, format string, a ...any)
+}
+
+// IsTerminal reports whether f is attached to a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Bar shows the number of items done out of a total, the current item and
+// an estimate of the time remaining
+type Bar struct {
+	mu      sync.Mutex
+	w       io.Writer
+	total   int
+	done    int
+	current string
+	start   time.Time
+	now     func() time.Time
+}
+
+// NewBar returns a progress bar for total items drawn on w
+func NewBar(w io.Writer, total int) *Bar {
+	return &Bar{w: w, total: total, start: time.Now(), now: time.Now}
+}
+
+// Update sets the number of items done and the item being worked on, and redraws the bar
+func (b *Bar) Update(done int, current string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.done = done
+	b.current = current
+	b.draw()
+}
+
+// Printf writes a message to w and redraws the bar below it
+func (b *Bar) Printf(w io.Writer, format string, a ...any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	io.WriteString(b.w, clearLine)
+	fmt.Fprintf(w, format, a...)
+	b.draw()
+}
+
+// Finish erases the bar
+func (b *Bar) Finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	io.WriteString(b.w, clearLine)
+}
+
+// draw renders the bar; the caller holds b.mu
+func (b *Bar) draw() {
+	filled := 0
+	if b.total > 0 {
+		filled = min(b.done*barWidth/b.total, barWidth)
+	}
+	line := fmt.Sprintf("[%s%s] %d/%d", strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled), b.done, b.total)
+	if b.current != "" {
+		line += " " + b.current
+	}
+	if eta, ok := b.eta(); ok {
+		line += " ETA " + eta.String()
+	}
+	io.WriteString(b.w, clearLine+line)
+}
+
+// eta estimates the remaining time from the average time per item so far
+func (b *Bar) eta() (time.Duration, bool) {
+	if b.done == 0 || b.done >= b.total {
+		return 0, false
+	}
+	elapsed := b.now().Sub(b.start)
+	remaining := elapsed / time.Duration(b.done) * time.Duration(b.total-b.done)
+	return remaining.Round(time.Second), true
+}
+
+// Spinner animates while a single slow operation runs, showing the name of
+// its current stage
+type Spinner struct {
+	mu    sync.Mutex
+	w     io.Writer
+	label string
+	stage string
+	frame int
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// StartSpinner starts a spinner labelled label on w
+func StartSpinner(w io.Writer, label string) *Spinner {
+	s := &Spinner{w: w, label: label, stop: make(chan struct{}), done: make(chan struct{})}
+	go s.run()
+	return s
+}
+
+// Stage sets the name of the stage being worked on
+func (s *Spinner) Stage(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stage = name
+	s.draw()
+}
+
+// Printf writes a message to w and redraws the spinner below it
+func (s *Spinner) Printf(w io.Writer, format string, a ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	io.WriteString(s.w, clearLine)
+	fmt.Fprintf(w, format, a...)
+	s.draw()
+}
+
+// Stop stops the spinner and erases it
+func (s *Spinner) Stop() {
+	select {
+	case <-s.stop:
+		return
+	default:
+	}
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	io.WriteString(s.w, clearLine)
+}
+
+// run advances the animation until the spinner is stopped
+func (s *Spinner) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.frame++
+			s.draw()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// draw renders the spinner; the caller holds s.mu
+func (s *Spinner) draw() {
+	line := spinnerFrames[s.frame%len(spinnerFrames)] + " " + s.label
+	if s.stage != "" {
+		line += ": " + s.stage
+	}
+	io.WriteString(s.w, clearLine+line)
+}
@@ -0,0 +1,65 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBar(t *testing.T) {
+	var out bytes.Buffer
+	bar := NewBar(&out, 4)
+	start := bar.start
+	bar.now = func() time.Time { return start.Add(10 * time.Second) }
+
+	bar.Update(1, "b.png")
+	line := out.String()
+	if !strings.Contains(line, "["+strings.Repeat("=", 7)+strings.Repeat(" ", 23)+"] 1/4 b.png") {
+		t.Errorf("Unexpected bar: %q", line)
+	}
+	// One item took 10s, so three remain for 30s
+	if !strings.HasSuffix(line, "ETA 30s") {
+		t.Errorf("Expected an ETA of 30s, got %q", line)
+	}
+
+	out.Reset()
+	var msg bytes.Buffer
+	bar.Printf(&msg, "Skipping %s\n", "c.png")
+	if msg.String() != "Skipping c.png\n" {
+		t.Errorf("Unexpected message: %q", msg.String())
+	}
+	if !strings.HasPrefix(out.String(), clearLine) || !strings.Contains(out.String(), "1/4") {
+		t.Errorf("Expected the bar to be cleared and redrawn, got %q", out.String())
+	}
+
+	out.Reset()
+	bar.Update(4, "")
+	if strings.Contains(out.String(), "ETA") {
+		t.Errorf("Expected no ETA once done, got %q", out.String())
+	}
+	bar.Finish()
+	if !strings.HasSuffix(out.String(), clearLine) {
+		t.Errorf("Expected Finish to erase the bar, got %q", out.String())
+	}
+}
+
+func TestSpinner(t *testing.T) {
+	var out bytes.Buffer
+	s := StartSpinner(&out, "photo.jpg")
+	s.Stage("decode")
+	s.Stage("encode")
+	s.Stop()
+	// Stopping twice is harmless
+	s.Stop()
+
+	got := out.String()
+	for _, want := range []string{"photo.jpg: decode", "photo.jpg: encode"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in spinner output %q", want, got)
+		}
+	}
+	if !strings.HasSuffix(got, clearLine) {
+		t.Errorf("Expected Stop to erase the spinner, got %q", got)
+	}
+}
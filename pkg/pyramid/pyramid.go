@@ -0,0 +1,493 @@
+// Package pyramid writes the tile pyramids of zoomable image viewers such as
+// OpenSeadragon, Leaflet and Mirador: Deep Zoom (DZI) and IIIF level 0
+// static tiles. The source is read a row at a time and each level is made by
+// halving the one above it, so images far larger than memory can be tiled.
+package pyramid
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	stdimage "image"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"nim/pkg/image"
+)
+
+// Layout is how the tiles and the description of a pyramid are laid out
+type Layout string
+
+const (
+	// LayoutDZI writes NAME.dzi and the tiles in NAME_files/LEVEL/COL_ROW.FORMAT
+	LayoutDZI Layout = "dzi"
+	// LayoutIIIF writes NAME/info.json and the tiles in
+	// NAME/X,Y,W,H/W,H/0/default.FORMAT, as IIIF Image API 3.0 level 0
+	LayoutIIIF Layout = "iiif"
+)
+
+// Formats are the formats tiles can be written in
+var Formats = []string{"jpg", "png", "webp"}
+
+// ParseLayout parses a layout name
+func ParseLayout(name string) (Layout, error) {
+	switch layout := Layout(strings.ToLower(name)); layout {
+	case LayoutDZI, LayoutIIIF:
+		return layout, nil
+	}
+	return "", fmt.Errorf("invalid layout: %s (expected dzi or iiif)", name)
+}
+
+// Options controls the tiles of a pyramid
+type Options struct {
+	Layout   Layout
+	TileSize int    // Width and height of tiles, without the overlap
+	Overlap  int    // Pixels each DZI tile repeats of its neighbors; IIIF tiles do not overlap
+	Format   string // Format of the tiles: jpg, png or webp
+	Quality  int    // Quality of JPEG and WebP tiles
+	ID       string // URI of the IIIF image service in info.json; empty is the folder name
+	Workers  int    // Tiles encoded at once; 0 uses every CPU
+
+	// Progress, if set, is called with the number of source rows read
+	Progress func(done, total int)
+}
+
+// DefaultOptions returns the options of a Deep Zoom pyramid with the tile
+// size and overlap most viewers expect
+func DefaultOptions() Options {
+	return Options{Layout: LayoutDZI, TileSize: 254, Overlap: 1, Format: "jpg", Quality: 85}
+}
+
+// Source is an image read a row at a time, such as an *image.RowReader
+type Source interface {
+	// Size returns the dimensions of the image
+	Size() stdimage.Point
+	// Read fills row, 4 bytes per pixel of 8-bit NRGBA, with the next row
+	Read(row []byte) error
+}
+
+// Result describes a pyramid written by Generate
+type Result struct {
+	Descriptor string // Path of the .dzi or info.json file
+	Width      int
+	Height     int
+	Levels     int
+	Tiles      int
+}
+
+// Generate reads src and writes its tile pyramid at path: the .dzi file of
+// LayoutDZI, with the tiles in a _files folder next to it, or the folder of
+// LayoutIIIF. The descriptor is written last, once every tile is, so viewers
+// never see an incomplete pyramid.
+func Generate(src Source, path string, options Options) (Result, error) {
+	if err := options.validate(); err != nil {
+		return Result{}, err
+	}
+	size := src.Size()
+	if size.X <= 0 || size.Y <= 0 {
+		return Result{}, fmt.Errorf("invalid image size: %dx%d", size.X, size.Y)
+	}
+	if options.Layout == LayoutIIIF {
+		options.Overlap = 0
+	} else if !strings.EqualFold(filepath.Ext(path), ".dzi") {
+		path += ".dzi"
+	}
+
+	p := &pyramid{options: options, path: path, levels: plan(size, options)}
+	if err := p.start(); err != nil {
+		return Result{}, err
+	}
+
+	// The rows of the source go through every level, then the last rows of
+	// the levels are cut into tiles
+	row := p.levels[0].get()
+	var err error
+	for y := 0; y < size.Y && err == nil; y++ {
+		if err = src.Read(row); err != nil {
+			err = fmt.Errorf("failed to read row %d: %w", y, err)
+			break
+		}
+		row = p.levels[0].push(row)
+		if options.Progress != nil {
+			options.Progress(y+1, size.Y)
+		}
+		err = p.failed()
+	}
+	if closeErr := p.close(err == nil); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Descriptor: path, Width: size.X, Height: size.Y, Levels: len(p.levels), Tiles: p.tiles}
+	if options.Layout == LayoutIIIF {
+		result.Descriptor = filepath.Join(path, "info.json")
+		err = image.WriteFile(result.Descriptor, func(w io.Writer) error { return writeInfo(w, size, options, path, len(p.levels)) })
+	} else {
+		err = image.WriteFile(path, func(w io.Writer) error { return writeDZI(w, size, options) })
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+func (o Options) validate() error {
+	switch {
+	case o.Layout != LayoutDZI && o.Layout != LayoutIIIF:
+		return fmt.Errorf("invalid layout: %s (expected dzi or iiif)", o.Layout)
+	case o.TileSize < 1:
+		return fmt.Errorf("invalid tile size: %d", o.TileSize)
+	case o.Overlap < 0 || o.Overlap > o.TileSize:
+		return fmt.Errorf("invalid overlap: %d (expected 0 to the tile size)", o.Overlap)
+	case o.Layout == LayoutIIIF && o.Overlap > 0:
+		return fmt.Errorf("IIIF tiles cannot overlap")
+	case !slices.Contains(Formats, o.Format):
+		return fmt.Errorf("invalid tile format: %s (expected %s)", o.Format, strings.Join(Formats, ", "))
+	}
+	return nil
+}
+
+// plan returns the levels of a pyramid, from the full size down. Deep Zoom
+// halves down to a single pixel; IIIF stops at the first level that fits in
+// a tile.
+func plan(size stdimage.Point, options Options) []*level {
+	levels := []*level{{size: size}}
+	for {
+		last := levels[len(levels)-1]
+		if options.Layout == LayoutIIIF && last.size.X <= options.TileSize && last.size.Y <= options.TileSize {
+			break
+		}
+		if last.size.X <= 1 && last.size.Y <= 1 {
+			break
+		}
+		next := &level{index: len(levels), size: stdimage.Pt((last.size.X+1)/2, (last.size.Y+1)/2)}
+		last.next = next
+		levels = append(levels, next)
+	}
+	return levels
+}
+
+// pyramid is a pyramid being written
+type pyramid struct {
+	options Options
+	path    string
+	levels  []*level
+	tiles   int
+
+	jobs chan tile
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	err  error
+}
+
+// tile is a tile cut from its level, waiting to be encoded
+type tile struct {
+	path string
+	img  *stdimage.NRGBA
+}
+
+// start creates the folders of the levels and starts the workers encoding
+// tiles
+func (p *pyramid) start() error {
+	for _, l := range p.levels {
+		l.pyramid = p
+		if p.options.Layout == LayoutDZI {
+			if err := os.MkdirAll(p.levelDir(l), 0o755); err != nil {
+				return fmt.Errorf("failed to create tile folder: %w", err)
+			}
+		}
+	}
+	workers := p.options.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	// A few tiles wait per worker, so memory stays bounded when encoding is
+	// slower than reading
+	p.jobs = make(chan tile, workers*2)
+	for range workers {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for t := range p.jobs {
+				if p.failed() != nil {
+					continue
+				}
+				if err := p.write(t); err != nil {
+					p.fail(err)
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// close cuts the last tiles of every level, unless the pyramid is not
+// complete, and waits for the workers
+func (p *pyramid) close(complete bool) error {
+	if complete && p.failed() == nil {
+		for _, l := range p.levels {
+			l.flush()
+		}
+	}
+	close(p.jobs)
+	p.wg.Wait()
+	return p.failed()
+}
+
+func (p *pyramid) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+func (p *pyramid) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// write encodes a tile into its file
+func (p *pyramid) write(t tile) error {
+	if err := os.MkdirAll(filepath.Dir(t.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create tile folder: %w", err)
+	}
+	file, err := os.Create(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to create tile: %w", err)
+	}
+	options := image.ProcessOptions{OutputFormat: p.options.Format, Quality: p.options.Quality}
+	if err := image.Encode(file, t.img, options); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", t.path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", t.path, err)
+	}
+	return nil
+}
+
+// levelDir returns the folder of the Deep Zoom tiles of a level, numbered
+// from 0 for the single pixel
+func (p *pyramid) levelDir(l *level) string {
+	base := strings.TrimSuffix(p.path, filepath.Ext(p.path))
+	return filepath.Join(base+"_files", strconv.Itoa(len(p.levels)-1-l.index))
+}
+
+// tilePaths returns the paths of the tile of a level at a column and row.
+// The IIIF tile of a level that fits in a single tile is also written as
+// the full region, which viewers ask for instead.
+func (p *pyramid) tilePaths(l *level, column, row int) []string {
+	name := fmt.Sprintf("default.%s", p.options.Format)
+	if p.options.Layout == LayoutDZI {
+		return []string{filepath.Join(p.levelDir(l), fmt.Sprintf("%d_%d.%s", column, row, p.options.Format))}
+	}
+	scale := 1 << l.index
+	full := p.levels[0].size
+	step := p.options.TileSize * scale
+	region := stdimage.Rect(column*step, row*step, (column+1)*step, (row+1)*step).Intersect(stdimage.Rectangle{Max: full})
+	size := fmt.Sprintf("%d,%d", (region.Dx()+scale-1)/scale, (region.Dy()+scale-1)/scale)
+	paths := []string{filepath.Join(p.path, fmt.Sprintf("%d,%d,%d,%d", region.Min.X, region.Min.Y, region.Dx(), region.Dy()), size, "0", name)}
+	if l.size.X <= p.options.TileSize && l.size.Y <= p.options.TileSize {
+		paths = append(paths, filepath.Join(p.path, "full", size, "0", name))
+		if l.index == 0 {
+			paths = append(paths, filepath.Join(p.path, "full", "max", "0", name))
+		}
+	}
+	return paths
+}
+
+// level is one level of a pyramid, which keeps the rows of the tiles being
+// cut
+type level struct {
+	pyramid *pyramid
+	index   int // 0 is the full size; each level is half of the one before
+	size    stdimage.Point
+	next    *level
+
+	rows    [][]byte // Rows from first on, 4 bytes per pixel
+	first   int
+	tileRow int    // Next row of tiles to cut
+	pending []byte // Even row waiting for the odd one to be halved with
+	free    [][]byte
+}
+
+// get returns a row of the level to fill
+func (l *level) get() []byte {
+	if n := len(l.free); n > 0 {
+		row := l.free[n-1]
+		l.free = l.free[:n-1]
+		return row
+	}
+	return make([]byte, l.size.X*4)
+}
+
+// push adds the next row to the level, passing it on halved to the next
+// level, and cuts the rows of tiles it completes. The level keeps row; it
+// returns a row the caller can fill next.
+func (l *level) push(row []byte) []byte {
+	l.rows = append(l.rows, row)
+	y := l.first + len(l.rows)
+	if l.next != nil {
+		if y%2 == 1 && y < l.size.Y {
+			l.pending = row
+		} else {
+			pair := row
+			if y%2 == 0 {
+				pair = l.pending
+			}
+			halved := l.next.get()
+			halve(halved, pair, row)
+			l.pending = nil
+			l.next.push(halved)
+		}
+	}
+	size := l.pyramid.options.TileSize
+	for l.tileRow*size < l.size.Y && y >= min((l.tileRow+1)*size+l.pyramid.options.Overlap, l.size.Y) {
+		l.cut()
+	}
+	return l.get()
+}
+
+// flush cuts the rows of tiles left
+func (l *level) flush() {
+	for l.tileRow*l.pyramid.options.TileSize < l.size.Y {
+		l.cut()
+	}
+}
+
+// cut cuts the next row of tiles and drops the rows no later tile needs
+func (l *level) cut() {
+	p := l.pyramid
+	size, overlap := p.options.TileSize, p.options.Overlap
+	y0 := max(l.tileRow*size-overlap, 0)
+	y1 := min((l.tileRow+1)*size+overlap, l.size.Y, l.first+len(l.rows))
+	for column := 0; column*size < l.size.X; column++ {
+		x0 := max(column*size-overlap, 0)
+		x1 := min((column+1)*size+overlap, l.size.X)
+		img := stdimage.NewNRGBA(stdimage.Rect(0, 0, x1-x0, y1-y0))
+		for y := y0; y < y1; y++ {
+			copy(img.Pix[(y-y0)*img.Stride:], l.rows[y-l.first][x0*4:x1*4])
+		}
+		for _, path := range p.tilePaths(l, column, l.tileRow) {
+			p.jobs <- tile{path: path, img: img}
+			p.tiles++
+		}
+	}
+	l.tileRow++
+
+	// Rows above the next tiles, and their overlap, are no longer needed
+	drop := min(max(l.tileRow*size-overlap-l.first, 0), len(l.rows))
+	for _, row := range l.rows[:drop] {
+		if &row[0] != pendingStart(l.pending) {
+			l.free = append(l.free, row)
+		}
+	}
+	l.rows = slices.Delete(l.rows, 0, drop)
+	l.first += drop
+}
+
+// pendingStart returns the first byte of a pending row, to keep it from
+// being reused before it is halved
+func pendingStart(row []byte) *byte {
+	if len(row) == 0 {
+		return nil
+	}
+	return &row[0]
+}
+
+// halve averages the 2x2 blocks of rows a and b into dst, weighting the
+// colors by their alpha. An odd last column is averaged with itself.
+func halve(dst, a, b []byte) {
+	width := len(a) / 4
+	for x := 0; x < len(dst)/4; x++ {
+		x0, x1 := 2*x*4, min(2*x+1, width-1)*4
+		var alpha, r, g, bl int
+		for _, px := range [][]byte{a[x0 : x0+4], a[x1 : x1+4], b[x0 : x0+4], b[x1 : x1+4]} {
+			w := int(px[3])
+			alpha += w
+			r += int(px[0]) * w
+			g += int(px[1]) * w
+			bl += int(px[2]) * w
+		}
+		out := dst[x*4 : x*4+4]
+		if alpha == 0 {
+			out[0], out[1], out[2], out[3] = 0, 0, 0, 0
+			continue
+		}
+		out[0] = uint8((r + alpha/2) / alpha)
+		out[1] = uint8((g + alpha/2) / alpha)
+		out[2] = uint8((bl + alpha/2) / alpha)
+		out[3] = uint8((alpha + 2) / 4)
+	}
+}
+
+// writeDZI writes the Deep Zoom descriptor of an image
+func writeDZI(w io.Writer, size stdimage.Point, options Options) error {
+	type dziSize struct {
+		Width  int `xml:"Width,attr"`
+		Height int `xml:"Height,attr"`
+	}
+	type dziImage struct {
+		XMLName  xml.Name `xml:"http://schemas.microsoft.com/deepzoom/2008 Image"`
+		Format   string   `xml:"Format,attr"`
+		Overlap  int      `xml:"Overlap,attr"`
+		TileSize int      `xml:"TileSize,attr"`
+		Size     dziSize
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err := encoder.Encode(dziImage{
+		Format:   options.Format,
+		Overlap:  options.Overlap,
+		TileSize: options.TileSize,
+		Size:     dziSize{Width: size.X, Height: size.Y},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// writeInfo writes the IIIF info.json of an image with levels levels
+func writeInfo(w io.Writer, size stdimage.Point, options Options, dir string, levels int) error {
+	id := options.ID
+	if id == "" {
+		id = filepath.Base(dir)
+	}
+	scaleFactors := make([]int, levels)
+	for i := range scaleFactors {
+		scaleFactors[i] = 1 << i
+	}
+	info := map[string]any{
+		"@context": "http://iiif.io/api/image/3/context.json",
+		"id":       strings.TrimSuffix(id, "/"),
+		"type":     "ImageService3",
+		"protocol": "http://iiif.io/api/image",
+		"profile":  "level0",
+		"width":    size.X,
+		"height":   size.Y,
+		"tiles": []map[string]any{{
+			"width":        options.TileSize,
+			"height":       options.TileSize,
+			"scaleFactors": scaleFactors,
+		}},
+		"preferredFormats": []string{options.Format},
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(info)
+}
@@ -0,0 +1,215 @@
+package pyramid
+
+import (
+	"encoding/json"
+	"errors"
+	stdimage "image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// imageSource reads the rows of an image, failing at row failAt if set
+type imageSource struct {
+	img    *stdimage.NRGBA
+	y      int
+	failAt int
+}
+
+func (s *imageSource) Size() stdimage.Point {
+	return s.img.Rect.Size()
+}
+
+func (s *imageSource) Read(row []byte) error {
+	if s.failAt > 0 && s.y == s.failAt {
+		return errors.New("truncated")
+	}
+	copy(row, s.img.Pix[s.y*s.img.Stride:])
+	s.y++
+	return nil
+}
+
+// pattern returns an image whose pixels differ by position
+func pattern(width, height int) *stdimage.NRGBA {
+	img := stdimage.NewNRGBA(stdimage.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), uint8(x + y), 255})
+		}
+	}
+	return img
+}
+
+func readPNG(t *testing.T, path string) *stdimage.NRGBA {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nrgba := stdimage.NewNRGBA(img.Bounds())
+	draw.Draw(nrgba, nrgba.Rect, img, img.Bounds().Min, draw.Src)
+	return nrgba
+}
+
+func TestGenerateDZI(t *testing.T) {
+	dir := t.TempDir()
+	src := pattern(600, 400)
+	options := DefaultOptions()
+	options.Format = "png"
+	options.Workers = 3
+	var done []int
+	options.Progress = func(n, total int) { done = append(done, n) }
+	result, err := Generate(&imageSource{img: src}, filepath.Join(dir, "photo"), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 600 pixels halve down to one in 10 steps
+	if result.Descriptor != filepath.Join(dir, "photo.dzi") || result.Levels != 11 || len(done) != 400 || done[399] != 400 {
+		t.Errorf("Unexpected result %+v after %d rows", result, len(done))
+	}
+	data, err := os.ReadFile(result.Descriptor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`Format="png"`, `Overlap="1"`, `TileSize="254"`, `<Size Width="600" Height="400">`, `xmlns="http://schemas.microsoft.com/deepzoom/2008"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected %s in the descriptor:\n%s", want, data)
+		}
+	}
+
+	// Tiles repeat the pixel of each neighbor
+	files := filepath.Join(dir, "photo_files")
+	for name, want := range map[string]stdimage.Rectangle{
+		"10/0_0.png": stdimage.Rect(0, 0, 255, 255),
+		"10/1_0.png": stdimage.Rect(253, 0, 509, 255),
+		"10/2_1.png": stdimage.Rect(507, 253, 600, 400),
+	} {
+		tile := readPNG(t, filepath.Join(files, name))
+		if tile.Rect.Size() != want.Size() {
+			t.Errorf("%s: expected %v, got %v", name, want.Size(), tile.Rect.Size())
+			continue
+		}
+		for _, p := range []stdimage.Point{{0, 0}, {want.Dx() - 1, want.Dy() - 1}} {
+			if got, want := tile.NRGBAAt(p.X, p.Y), src.NRGBAAt(want.Min.X+p.X, want.Min.Y+p.Y); got != want {
+				t.Errorf("%s at %v: expected %v, got %v", name, p, want, got)
+			}
+		}
+	}
+	// Lower levels average 2x2 blocks, down to a single pixel
+	half := readPNG(t, filepath.Join(files, "9", "0_0.png"))
+	if half.Rect.Size() != stdimage.Pt(255, 200) || half.NRGBAAt(1, 1) != (color.NRGBA{3, 3, 5, 255}) {
+		t.Errorf("Unexpected halved tile: %v, %v", half.Rect.Size(), half.NRGBAAt(1, 1))
+	}
+	if top := readPNG(t, filepath.Join(files, "0", "0_0.png")); top.Rect.Size() != stdimage.Pt(1, 1) {
+		t.Errorf("Expected a 1x1 top level, got %v", top.Rect.Size())
+	}
+	entries, _ := os.ReadDir(filepath.Join(files, "10"))
+	if len(entries) != 6 {
+		t.Errorf("Expected 6 tiles at full size, got %d", len(entries))
+	}
+}
+
+func TestGenerateIIIF(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "map")
+	options := Options{Layout: LayoutIIIF, TileSize: 128, Format: "png", ID: "https://example.com/iiif/map/"}
+	result, err := Generate(&imageSource{img: pattern(300, 200)}, dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Descriptor != filepath.Join(dir, "info.json") || result.Levels != 3 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	var info struct {
+		ID     string `json:"id"`
+		Width  int    `json:"width"`
+		Height int    `json:"height"`
+		Tiles  []struct {
+			Width        int   `json:"width"`
+			ScaleFactors []int `json:"scaleFactors"`
+		} `json:"tiles"`
+	}
+	data, err := os.ReadFile(result.Descriptor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != "https://example.com/iiif/map" || info.Width != 300 || info.Height != 200 ||
+		len(info.Tiles) != 1 || info.Tiles[0].Width != 128 || !slices.Equal(info.Tiles[0].ScaleFactors, []int{1, 2, 4}) {
+		t.Errorf("Unexpected info.json: %s", data)
+	}
+
+	// Regions are in full-size pixels, sizes in the pixels of the level
+	for name, want := range map[string]stdimage.Point{
+		"0,0,128,128/128,128/0/default.png": {128, 128},
+		"256,128,44,72/44,72/0/default.png": {44, 72},
+		"256,0,44,200/22,100/0/default.png": {22, 100},
+		"0,0,300,200/75,50/0/default.png":   {75, 50},
+		"full/75,50/0/default.png":          {75, 50},
+		"0,0,256,200/128,100/0/default.png": {128, 100},
+	} {
+		if tile := readPNG(t, filepath.Join(dir, name)); tile.Rect.Size() != want {
+			t.Errorf("%s: expected %v, got %v", name, want, tile.Rect.Size())
+		}
+	}
+}
+
+func TestGenerateFailure(t *testing.T) {
+	dir := t.TempDir()
+	options := DefaultOptions()
+	if _, err := Generate(&imageSource{img: pattern(300, 300), failAt: 100}, filepath.Join(dir, "photo.dzi"), options); err == nil {
+		t.Fatal("Expected an error for a truncated source")
+	}
+	// Without the descriptor, viewers do not find the incomplete pyramid
+	if _, err := os.Stat(filepath.Join(dir, "photo.dzi")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected no descriptor, got %v", err)
+	}
+
+	for _, options := range []Options{
+		{Layout: "zoomify", TileSize: 256, Format: "jpg"},
+		{Layout: LayoutDZI, TileSize: 0, Format: "jpg"},
+		{Layout: LayoutDZI, TileSize: 256, Overlap: -1, Format: "jpg"},
+		{Layout: LayoutIIIF, TileSize: 256, Overlap: 1, Format: "jpg"},
+		{Layout: LayoutDZI, TileSize: 256, Format: "gif"},
+	} {
+		if _, err := Generate(&imageSource{img: pattern(10, 10)}, filepath.Join(dir, "x"), options); err == nil {
+			t.Errorf("Expected an error for %+v", options)
+		}
+	}
+}
+
+func TestHalve(t *testing.T) {
+	// Transparent pixels do not darken their neighbors, and an odd last
+	// column is averaged with itself
+	a := []byte{200, 100, 0, 255, 0, 0, 0, 0, 10, 20, 30, 255}
+	b := []byte{100, 100, 0, 255, 0, 0, 0, 0, 10, 20, 30, 255}
+	dst := make([]byte, 8)
+	halve(dst, a, b)
+	if want := []byte{150, 100, 0, 128, 10, 20, 30, 255}; !slices.Equal(dst, want) {
+		t.Errorf("Expected %v, got %v", want, dst)
+	}
+	halve(dst[:4], make([]byte, 8), make([]byte, 8))
+	if !slices.Equal(dst[:4], []byte{0, 0, 0, 0}) {
+		t.Errorf("Expected a transparent pixel, got %v", dst[:4])
+	}
+}
+
+func TestParseLayout(t *testing.T) {
+	if layout, err := ParseLayout("IIIF"); err != nil || layout != LayoutIIIF {
+		t.Errorf("Expected iiif, got %v, %v", layout, err)
+	}
+	if _, err := ParseLayout("zoomify"); err == nil {
+		t.Errorf("Expected an error for an unknown layout")
+	}
+}
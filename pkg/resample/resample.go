@@ -0,0 +1,317 @@
+package resample
+
+import (
+	"image"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/disintegration/imaging"
+)
+
+// Resizing with the Lanczos filter, as imaging does it: a horizontal pass
+// rounded to 8 bits, then a vertical one, with the colors premultiplied by
+// alpha. The weighted sums run through Dot and Accumulate, which use SIMD
+// instructions on CPUs that have them (see resample_amd64.go and
+// resample_arm64.go; the purego build tag leaves them out), and the rows are
+// split between the CPUs.
+
+// Kernels for Dot, Accumulate and Store, replaced by SIMD ones where
+// supported
+var (
+	dot        = dotGo
+	dotPair    = dotPairGo
+	accumulate = accumulateGo
+	store      = storeGo
+)
+
+// Dot sets sum to the pixels of src, premultiplied by their alpha, weighted
+// by weights and added up; the alpha of sum is the weighted alpha. src holds
+// at least len(weights) 8-bit NRGBA pixels.
+func Dot(sum *[4]float64, src []byte, weights []float64) {
+	dot(sum, src, weights)
+}
+
+// Accumulate adds the pixels of src, 8-bit NRGBA, premultiplied by their
+// alpha and weighted by weight, to sum, which holds 4 values per pixel
+func Accumulate(sum []float64, src []byte, weight float64) {
+	accumulate(sum, src, weight)
+}
+
+// DotRow resizes a row of 8-bit NRGBA pixels with weights, setting sums to
+// the premultiplied sums of Dot for each resized pixel
+func DotRow(sums []float64, src []byte, weights Weights) {
+	// Pairs of pixels with as many weights are summed together, which
+	// keeps the SIMD units busier
+	for x := 0; x < len(weights.Start); x++ {
+		start, values := weights.Start[x], weights.Values[x]
+		if x+1 < len(weights.Start) && len(weights.Values[x+1]) == len(values) {
+			dotPair((*[8]float64)(sums[x*4:]), src[start*4:], src[weights.Start[x+1]*4:], values, weights.Values[x+1])
+			x++
+			continue
+		}
+		dot((*[4]float64)(sums[x*4:]), src[start*4:], values)
+	}
+}
+
+// Store converts premultiplied sums from Dot or Accumulate, 4 per pixel, to
+// 8-bit NRGBA pixels in dst, rounding like imaging. Fully transparent pixels
+// are cleared.
+func Store(dst []byte, sums []float64) {
+	store(dst, sums)
+}
+
+// dotGo is Dot without SIMD
+func dotGo(sum *[4]float64, src []byte, weights []float64) {
+	var r, g, b, a float64
+	for j, weight := range weights {
+		p := src[j*4 : j*4+4 : j*4+4]
+		alpha := float64(p[3]) * weight
+		r += float64(p[0]) * alpha
+		g += float64(p[1]) * alpha
+		b += float64(p[2]) * alpha
+		a += alpha
+	}
+	sum[0], sum[1], sum[2], sum[3] = r, g, b, a
+}
+
+// dotPairGo sets sums to the Dot of src0 with weights0 followed by the Dot
+// of src1 with weights1, which has the same length, one after the other
+func dotPairGo(sums *[8]float64, src0, src1 []byte, weights0, weights1 []float64) {
+	dot((*[4]float64)(sums[:4]), src0, weights0)
+	dot((*[4]float64)(sums[4:]), src1, weights1)
+}
+
+// accumulateGo is Accumulate without SIMD
+func accumulateGo(sum []float64, src []byte, weight float64) {
+	for i := 0; i+4 <= len(src); i += 4 {
+		p := src[i : i+4 : i+4]
+		s := sum[i : i+4 : i+4]
+		alpha := float64(p[3]) * weight
+		s[0] += float64(p[0]) * alpha
+		s[1] += float64(p[1]) * alpha
+		s[2] += float64(p[2]) * alpha
+		s[3] += alpha
+	}
+}
+
+// Resize resizes img to width x height with the Lanczos filter, giving the
+// same result as imaging.Resize. A width or height of 0 keeps the aspect
+// ratio.
+func Resize(img image.Image, width, height int) *image.NRGBA {
+	srcW, srcH := img.Bounds().Dx(), img.Bounds().Dy()
+	if width < 0 || height < 0 || width == 0 && height == 0 || srcW <= 0 || srcH <= 0 {
+		return &image.NRGBA{}
+	}
+	if width == 0 {
+		width = int(math.Max(1, math.Floor(float64(height)*float64(srcW)/float64(srcH)+0.5)))
+	}
+	if height == 0 {
+		height = int(math.Max(1, math.Floor(float64(width)*float64(srcH)/float64(srcW)+0.5)))
+	}
+
+	src, ok := img.(*image.NRGBA)
+	if !ok {
+		src = imaging.Clone(img)
+	}
+	switch {
+	case srcW != width && srcH != height:
+		return vertical(horizontal(src, width), height)
+	case srcW != width:
+		return horizontal(src, width)
+	case srcH != height:
+		return vertical(src, height)
+	}
+	return imaging.Clone(img)
+}
+
+// Fit shrinks img to fit in width x height like imaging.Fit
+func Fit(img image.Image, width, height int) *image.NRGBA {
+	srcW, srcH := img.Bounds().Dx(), img.Bounds().Dy()
+	if width <= 0 || height <= 0 || srcW <= 0 || srcH <= 0 {
+		return &image.NRGBA{}
+	}
+	if srcW <= width && srcH <= height {
+		return imaging.Clone(img)
+	}
+	if float64(srcW)/float64(srcH) > float64(width)/float64(height) {
+		return Resize(img, width, int(float64(width)/(float64(srcW)/float64(srcH))))
+	}
+	return Resize(img, int(float64(height)*(float64(srcW)/float64(srcH))), height)
+}
+
+// Fill resizes and crops img to fill width x height around its center like
+// imaging.Fill
+func Fill(img image.Image, width, height int) *image.NRGBA {
+	srcW, srcH := img.Bounds().Dx(), img.Bounds().Dy()
+	if width <= 0 || height <= 0 || srcW <= 0 || srcH <= 0 {
+		return &image.NRGBA{}
+	}
+	if srcW == width && srcH == height {
+		return imaging.Clone(img)
+	}
+	narrower := float64(srcW)/float64(srcH) < float64(width)/float64(height)
+	if srcW >= 100 && srcH >= 100 {
+		// Crop to the aspect ratio of the output, then resize
+		if narrower {
+			cropH := float64(srcW) * float64(height) / float64(width)
+			img = imaging.CropAnchor(img, srcW, int(math.Max(1, cropH)+0.5), imaging.Center)
+		} else {
+			cropW := float64(srcH) * float64(width) / float64(height)
+			img = imaging.CropAnchor(img, int(math.Max(1, cropW)+0.5), srcH, imaging.Center)
+		}
+		return Resize(img, width, height)
+	}
+	// Small images are resized first, then cropped
+	if narrower {
+		img = Resize(img, width, 0)
+	} else {
+		img = Resize(img, 0, height)
+	}
+	return imaging.CropAnchor(img, width, height, imaging.Center)
+}
+
+// horizontal resizes the rows of src to width pixels
+func horizontal(src *image.NRGBA, width int) *image.NRGBA {
+	srcW, height := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	weights := Lanczos(width, srcW)
+	parallelRows(height, func(lo, hi int) {
+		sums := make([]float64, width*4)
+		for y := lo; y < hi; y++ {
+			row := src.Pix[src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y+y):][:srcW*4]
+			DotRow(sums, row, weights)
+			store(dst.Pix[y*dst.Stride:], sums)
+		}
+	})
+	return dst
+}
+
+// vertical resizes the columns of src to height pixels
+func vertical(src *image.NRGBA, height int) *image.NRGBA {
+	width := src.Rect.Dx()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	weights := Lanczos(height, src.Rect.Dy())
+	parallelRows(height, func(lo, hi int) {
+		sums := make([]float64, width*4)
+		for y := lo; y < hi; y++ {
+			clear(sums)
+			for k, weight := range weights.Values[y] {
+				row := src.Pix[src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y+weights.Start[y]+k):][:width*4]
+				accumulate(sums, row, weight)
+			}
+			store(dst.Pix[y*dst.Stride:], sums)
+		}
+	})
+	return dst
+}
+
+// parallelRows splits rows 0 to n between the CPUs, calling fn with each
+// range of rows from lo up to hi
+func parallelRows(n int, fn func(lo, hi int)) {
+	workers := min(runtime.GOMAXPROCS(0), n)
+	if workers <= 1 {
+		fn(0, n)
+		return
+	}
+	// Small chunks balance the load when some rows are slower than others
+	chunk := max(1, n/(workers*4))
+	var next int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				lo := next
+				next += chunk
+				mu.Unlock()
+				if lo >= n {
+					return
+				}
+				fn(lo, min(lo+chunk, n))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Weights holds the filter weights of the source pixels each pixel of a
+// resized dimension is made of
+type Weights struct {
+	Start  []int       // First source pixel of each resized pixel
+	Values [][]float64 // Weights of the source pixels from Start, summing to 1
+}
+
+// Lanczos returns the Lanczos weights that resize src pixels to dst, widened
+// when shrinking so every source pixel counts. They are worked out like
+// imaging does, so resized images match.
+func Lanczos(dst, src int) Weights {
+	scale := float64(src) / float64(dst)
+	stretch := max(scale, 1)
+	support := math.Ceil(3 * stretch)
+	w := Weights{Start: make([]int, dst), Values: make([][]float64, dst)}
+	for i := range dst {
+		center := (float64(i)+0.5)*scale - 0.5
+		lo := max(0, int(math.Ceil(center-support)))
+		hi := min(src-1, int(math.Floor(center+support)))
+		values := make([]float64, hi-lo+1)
+		var sum float64
+		for j := lo; j <= hi; j++ {
+			values[j-lo] = lanczos3((float64(j) - center) / stretch)
+			sum += values[j-lo]
+		}
+		if sum != 0 {
+			for j := range values {
+				values[j] /= sum
+			}
+		}
+		w.Start[i], w.Values[i] = lo, values
+	}
+	return w
+}
+
+// lanczos3 is the Lanczos kernel with 3 lobes
+func lanczos3(x float64) float64 {
+	x = math.Abs(x)
+	if x >= 3 {
+		return 0
+	}
+	return sinc(x) * sinc(x/3)
+}
+
+// sinc is sin(πx)/(πx)
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// storeGo is Store without SIMD
+func storeGo(dst []byte, sums []float64) {
+	for i := 0; i+4 <= len(sums); i += 4 {
+		p := dst[i : i+4 : i+4]
+		a := sums[i+3]
+		if a == 0 {
+			p[0], p[1], p[2], p[3] = 0, 0, 0, 0
+			continue
+		}
+		aInv := 1 / a
+		p[0], p[1], p[2], p[3] = clamp(sums[i]*aInv), clamp(sums[i+1]*aInv), clamp(sums[i+2]*aInv), clamp(a)
+	}
+}
+
+// clamp rounds x to a byte like imaging
+func clamp(x float64) uint8 {
+	v := int64(x + 0.5)
+	if v > 255 {
+		return 255
+	}
+	if v > 0 {
+		return uint8(v)
+	}
+	return 0
+}
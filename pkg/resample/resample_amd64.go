@@ -0,0 +1,36 @@
+//go:build !purego
+
+package resample
+
+import "golang.org/x/sys/cpu"
+
+func init() {
+	if cpu.X86.HasAVX2 {
+		dot = dotAVX2
+		dotPair = dotPairAVX2
+		accumulate = accumulateAVX2
+		store = storeAVX2
+	}
+}
+
+// dotAVX2 is Dot with AVX2 instructions, which weigh the
+// four channels of a pixel at once
+//
+//go:noescape
+func dotAVX2(sum *[4]float64, src []byte, weights []float64)
+
+// dotPairAVX2 is dotPairGo with AVX2 instructions, interleaving the two
+// sums so one does not wait for the other
+//
+//go:noescape
+func dotPairAVX2(sums *[8]float64, src0, src1 []byte, weights0, weights1 []float64)
+
+// accumulateAVX2 is Accumulate with AVX2 instructions
+//
+//go:noescape
+func accumulateAVX2(sum []float64, src []byte, weight float64)
+
+// storeAVX2 is Store with AVX2 instructions
+//
+//go:noescape
+func storeAVX2(dst []byte, sums []float64)
@@ -0,0 +1,154 @@
+//go:build !purego
+
+#include "textflag.h"
+
+// Each pixel is widened to four float64 in a YMM register. Its alpha, times
+// the weight, is broadcast to all four, and the alpha channel of the pixel
+// is replaced by 1, so one multiplication gives the premultiplied, weighted
+// r, g and b along with the weighted alpha. The products are rounded like
+// the Go code, without fused multiply-adds.
+
+DATA ones<>+0(SB)/8, $1.0
+GLOBL ones<>(SB), RODATA|NOPTR, $8
+
+DATA halves<>+0(SB)/8, $0.5
+GLOBL halves<>(SB), RODATA|NOPTR, $8
+
+// func dotAVX2(sum *[4]float64, src []byte, weights []float64)
+TEXT ·dotAVX2(SB), NOSPLIT, $0-56
+	MOVQ sum+0(FP), DI
+	MOVQ src_base+8(FP), SI
+	MOVQ weights_base+32(FP), DX
+	MOVQ weights_len+40(FP), CX
+	VXORPD Y0, Y0, Y0
+	VBROADCASTSD ones<>(SB), Y3
+	TESTQ CX, CX
+	JZ dotDone
+
+dotLoop:
+	VPMOVZXBD (SI), X1
+	VCVTDQ2PD X1, Y1
+	VPERMPD $0xFF, Y1, Y2
+	VBROADCASTSD (DX), Y4
+	VMULPD Y4, Y2, Y2
+	VBLENDPD $8, Y3, Y1, Y1
+	VMULPD Y2, Y1, Y1
+	VADDPD Y1, Y0, Y0
+	ADDQ $4, SI
+	ADDQ $8, DX
+	DECQ CX
+	JNZ dotLoop
+
+dotDone:
+	VMOVUPD Y0, (DI)
+	VZEROUPPER
+	RET
+
+// func dotPairAVX2(sums *[8]float64, src0, src1 []byte, weights0, weights1 []float64)
+TEXT ·dotPairAVX2(SB), NOSPLIT, $0-104
+	MOVQ sums+0(FP), DI
+	MOVQ src0_base+8(FP), SI
+	MOVQ src1_base+32(FP), R8
+	MOVQ weights0_base+56(FP), DX
+	MOVQ weights0_len+64(FP), CX
+	MOVQ weights1_base+80(FP), R9
+	VXORPD Y0, Y0, Y0
+	VXORPD Y9, Y9, Y9
+	VBROADCASTSD ones<>(SB), Y3
+	TESTQ CX, CX
+	JZ pairDone
+
+pairLoop:
+	VPMOVZXBD (SI), X1
+	VPMOVZXBD (R8), X6
+	VCVTDQ2PD X1, Y1
+	VCVTDQ2PD X6, Y6
+	VPERMPD $0xFF, Y1, Y2
+	VPERMPD $0xFF, Y6, Y7
+	VBROADCASTSD (DX), Y4
+	VBROADCASTSD (R9), Y8
+	VMULPD Y4, Y2, Y2
+	VMULPD Y8, Y7, Y7
+	VBLENDPD $8, Y3, Y1, Y1
+	VBLENDPD $8, Y3, Y6, Y6
+	VMULPD Y2, Y1, Y1
+	VMULPD Y7, Y6, Y6
+	VADDPD Y1, Y0, Y0
+	VADDPD Y6, Y9, Y9
+	ADDQ $4, SI
+	ADDQ $4, R8
+	ADDQ $8, DX
+	ADDQ $8, R9
+	DECQ CX
+	JNZ pairLoop
+
+pairDone:
+	VMOVUPD Y0, (DI)
+	VMOVUPD Y9, 32(DI)
+	VZEROUPPER
+	RET
+
+// func accumulateAVX2(sum []float64, src []byte, weight float64)
+TEXT ·accumulateAVX2(SB), NOSPLIT, $0-56
+	MOVQ sum_base+0(FP), DI
+	MOVQ src_base+24(FP), SI
+	MOVQ src_len+32(FP), CX
+	SHRQ $2, CX
+	VBROADCASTSD weight+48(FP), Y4
+	VBROADCASTSD ones<>(SB), Y3
+	TESTQ CX, CX
+	JZ accumulateDone
+
+accumulateLoop:
+	VPMOVZXBD (SI), X1
+	VCVTDQ2PD X1, Y1
+	VPERMPD $0xFF, Y1, Y2
+	VMULPD Y4, Y2, Y2
+	VBLENDPD $8, Y3, Y1, Y1
+	VMULPD Y2, Y1, Y1
+	VADDPD (DI), Y1, Y1
+	VMOVUPD Y1, (DI)
+	ADDQ $4, SI
+	ADDQ $32, DI
+	DECQ CX
+	JNZ accumulateLoop
+
+accumulateDone:
+	VZEROUPPER
+	RET
+
+// Store divides r, g and b by alpha, as a multiplication by 1/alpha like the
+// Go code, and rounds all four by adding 0.5 and truncating. The packs
+// saturate to 0 to 255, and turn the NaNs and infinities of fully
+// transparent pixels into 0.
+
+// func storeAVX2(dst []byte, sums []float64)
+TEXT ·storeAVX2(SB), NOSPLIT, $0-48
+	MOVQ dst_base+0(FP), DI
+	MOVQ sums_base+24(FP), SI
+	MOVQ sums_len+32(FP), CX
+	SHRQ $2, CX
+	VBROADCASTSD ones<>(SB), Y3
+	VBROADCASTSD halves<>(SB), Y5
+	TESTQ CX, CX
+	JZ storeDone
+
+storeLoop:
+	VMOVUPD (SI), Y1
+	VPERMPD $0xFF, Y1, Y2
+	VDIVPD Y2, Y3, Y2
+	VMULPD Y2, Y1, Y2
+	VBLENDPD $8, Y1, Y2, Y2
+	VADDPD Y5, Y2, Y2
+	VCVTTPD2DQY Y2, X2
+	VPACKSSDW X2, X2, X2
+	VPACKUSWB X2, X2, X2
+	VMOVD X2, (DI)
+	ADDQ $32, SI
+	ADDQ $4, DI
+	DECQ CX
+	JNZ storeLoop
+
+storeDone:
+	VZEROUPPER
+	RET
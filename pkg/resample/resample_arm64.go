@@ -0,0 +1,20 @@
+//go:build !purego
+
+package resample
+
+// NEON is part of every arm64 CPU, so its kernels are always used
+func init() {
+	dot = dotNEON
+	accumulate = accumulateNEON
+}
+
+// dotNEON is Dot with NEON instructions, which weigh two channels of a pixel
+// at once
+//
+//go:noescape
+func dotNEON(sum *[4]float64, src []byte, weights []float64)
+
+// accumulateNEON is Accumulate with NEON instructions
+//
+//go:noescape
+func accumulateNEON(sum []float64, src []byte, weight float64)
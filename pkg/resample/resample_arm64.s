@@ -0,0 +1,76 @@
+//go:build !purego
+
+#include "textflag.h"
+
+// Each pixel is widened to four float64 in two registers, r and g in one and
+// b and alpha in the other. Its alpha, times the weight, is broadcast, and
+// the alpha of the pixel is replaced by 1, so two fused multiply-adds give
+// the premultiplied, weighted r, g and b along with the weighted alpha, like
+// the Go code compiles to on arm64.
+
+// func dotNEON(sum *[4]float64, src []byte, weights []float64)
+TEXT ·dotNEON(SB), NOSPLIT, $0-56
+	MOVD sum+0(FP), R0
+	MOVD src_base+8(FP), R1
+	MOVD weights_base+32(FP), R2
+	MOVD weights_len+40(FP), R3
+	VEOR V0.B16, V0.B16, V0.B16
+	VEOR V1.B16, V1.B16, V1.B16
+	FMOVD $1.0, F7
+	CBZ R3, dotDone
+
+dotLoop:
+	MOVWU.P 4(R1), R4
+	VMOV R4, V2.S[0]
+	VUXTL V2.B8, V2.H8
+	VUXTL V2.H4, V2.S4
+	VUXTL2 V2.S4, V3.D2
+	VUXTL V2.S2, V2.D2
+	VUCVTF V2.D2, V2.D2
+	VUCVTF V3.D2, V3.D2
+	FMOVD.P 8(R2), F5
+	VDUP V5.D[0], V5.D2
+	VDUP V3.D[1], V4.D2
+	VFMUL V5.D2, V4.D2, V4.D2
+	VMOV V7.D[0], V3.D[1]
+	VFMLA V4.D2, V2.D2, V0.D2
+	VFMLA V4.D2, V3.D2, V1.D2
+	SUB $1, R3
+	CBNZ R3, dotLoop
+
+dotDone:
+	VST1 [V0.D2, V1.D2], (R0)
+	RET
+
+// func accumulateNEON(sum []float64, src []byte, weight float64)
+TEXT ·accumulateNEON(SB), NOSPLIT, $0-56
+	MOVD sum_base+0(FP), R0
+	MOVD src_base+24(FP), R1
+	MOVD src_len+32(FP), R3
+	FMOVD weight+48(FP), F5
+	VDUP V5.D[0], V5.D2
+	FMOVD $1.0, F7
+	LSR $2, R3
+	CBZ R3, accumulateDone
+
+accumulateLoop:
+	MOVWU.P 4(R1), R4
+	VMOV R4, V2.S[0]
+	VUXTL V2.B8, V2.H8
+	VUXTL V2.H4, V2.S4
+	VUXTL2 V2.S4, V3.D2
+	VUXTL V2.S2, V2.D2
+	VUCVTF V2.D2, V2.D2
+	VUCVTF V3.D2, V3.D2
+	VDUP V3.D[1], V4.D2
+	VFMUL V5.D2, V4.D2, V4.D2
+	VMOV V7.D[0], V3.D[1]
+	VLD1 (R0), [V0.D2, V1.D2]
+	VFMLA V4.D2, V2.D2, V0.D2
+	VFMLA V4.D2, V3.D2, V1.D2
+	VST1.P [V0.D2, V1.D2], 32(R0)
+	SUB $1, R3
+	CBNZ R3, accumulateLoop
+
+accumulateDone:
+	RET
@@ -0,0 +1,137 @@
+package resample
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// noise returns random pixels with random alpha
+func noise(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	rng := rand.New(rand.NewSource(1))
+	rng.Read(img.Pix)
+	return img
+}
+
+func TestLanczos(t *testing.T) {
+	for _, sizes := range [][2]int{{10, 10}, {7, 100}, {100, 7}, {1, 5}} {
+		w := Lanczos(sizes[0], sizes[1])
+		for i, values := range w.Values {
+			var sum float64
+			for _, v := range values {
+				sum += v
+			}
+			if math.Abs(sum-1) > 1e-9 || w.Start[i] < 0 || w.Start[i]+len(values) > sizes[1] {
+				t.Errorf("%d to %d: pixel %d has weights %v from %d", sizes[1], sizes[0], i, values, w.Start[i])
+			}
+		}
+	}
+	// The same size keeps every pixel
+	w := Lanczos(5, 5)
+	for i, values := range w.Values {
+		if math.Abs(values[i-w.Start[i]]-1) > 1e-9 {
+			t.Errorf("pixel %d: weights %v", i, values)
+		}
+	}
+}
+
+func TestKernels(t *testing.T) {
+	// The kernels picked for this CPU must match the Go ones
+	src := noise(37, 1).Pix
+	weights := Lanczos(5, 37).Values[2]
+	var got, expected [4]float64
+	Dot(&got, src, weights)
+	dotGo(&expected, src, weights)
+	for c := range got {
+		if math.Abs(got[c]-expected[c]) > 1e-9*math.Max(1, math.Abs(expected[c])) {
+			t.Errorf("Dot: %v, expected %v", got, expected)
+			break
+		}
+	}
+
+	var pair, pairExpected [8]float64
+	dotPair(&pair, src, src[4:], weights[:20], weights[1:21])
+	dotGo((*[4]float64)(pairExpected[:4]), src, weights[:20])
+	dotGo((*[4]float64)(pairExpected[4:]), src[4:], weights[1:21])
+	for c := range pair {
+		if math.Abs(pair[c]-pairExpected[c]) > 1e-9*math.Max(1, math.Abs(pairExpected[c])) {
+			t.Errorf("dotPair: %v, expected %v", pair, pairExpected)
+			break
+		}
+	}
+
+	sums := [2][]float64{make([]float64, 37*4), make([]float64, 37*4)}
+	for i := range sums[0] {
+		sums[0][i], sums[1][i] = float64(i), float64(i)
+	}
+	Accumulate(sums[0], src, 0.37)
+	accumulateGo(sums[1], src, 0.37)
+	for i := range sums[0] {
+		if math.Abs(sums[0][i]-sums[1][i]) > 1e-9*math.Max(1, math.Abs(sums[1][i])) {
+			t.Fatalf("Accumulate: value %d is %v, expected %v", i, sums[0][i], sums[1][i])
+		}
+	}
+
+	// Overshoots, transparent pixels and sums that cancel out
+	values := append(sums[1], 300, -20, 0.5, 1, 7, 3, 0, 0, 0, 0, 0, 0, 0.2, 0.4, 0.6, 0.001, -5, 10, 400, 255.4)
+	got8, expected8 := make([]byte, len(values)), make([]byte, len(values))
+	Store(got8, values)
+	storeGo(expected8, values)
+	if !bytes.Equal(got8, expected8) {
+		t.Errorf("Store: %v, expected %v", got8, expected8)
+	}
+}
+
+func TestResize(t *testing.T) {
+	src := noise(300, 200)
+	sub := src.SubImage(image.Rect(13, 7, 213, 157))
+	for _, test := range []struct {
+		name     string
+		got      *image.NRGBA
+		expected *image.NRGBA
+	}{
+		{"shrink", Resize(src, 97, 41), imaging.Resize(src, 97, 41, imaging.Lanczos)},
+		{"enlarge", Resize(src, 450, 310), imaging.Resize(src, 450, 310, imaging.Lanczos)},
+		{"width only", Resize(src, 120, 200), imaging.Resize(src, 120, 200, imaging.Lanczos)},
+		{"height only", Resize(src, 300, 90), imaging.Resize(src, 300, 90, imaging.Lanczos)},
+		{"aspect", Resize(src, 0, 50), imaging.Resize(src, 0, 50, imaging.Lanczos)},
+		{"subimage", Resize(sub, 64, 64), imaging.Resize(sub, 64, 64, imaging.Lanczos)},
+		{"gray", Resize(image.NewGray(image.Rect(0, 0, 30, 20)), 7, 5),
+			imaging.Resize(image.NewGray(image.Rect(0, 0, 30, 20)), 7, 5, imaging.Lanczos)},
+		{"fit", Fit(src, 100, 100), imaging.Fit(src, 100, 100, imaging.Lanczos)},
+		{"fit small", Fit(src, 400, 400), imaging.Fit(src, 400, 400, imaging.Lanczos)},
+		{"fill", Fill(src, 50, 80), imaging.Fill(src, 50, 80, imaging.Center, imaging.Lanczos)},
+		{"fill small", Fill(noise(60, 40), 30, 30), imaging.Fill(noise(60, 40), 30, 30, imaging.Center, imaging.Lanczos)},
+	} {
+		if test.got.Rect != test.expected.Rect {
+			t.Errorf("%s: size %v, expected %v", test.name, test.got.Rect, test.expected.Rect)
+			continue
+		}
+		// Fused multiply-adds on some CPUs may round a channel the other way
+		for i := range test.got.Pix {
+			if d := int(test.got.Pix[i]) - int(test.expected.Pix[i]); d < -1 || d > 1 {
+				t.Errorf("%s: byte %d is %d, expected %d", test.name, i, test.got.Pix[i], test.expected.Pix[i])
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkResize(b *testing.B) {
+	src := noise(2000, 1500)
+	b.Run("nim", func(b *testing.B) {
+		for range b.N {
+			Resize(src, 640, 480)
+		}
+	})
+	b.Run("imaging", func(b *testing.B) {
+		for range b.N {
+			imaging.Resize(src, 640, 480, imaging.Lanczos)
+		}
+	})
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package sandbox
+
+import "log/slog"
+
+// applyLimits only warns on systems without resource limits: the worker
+// still runs in its own process, and Timeout is enforced by the supervisor
+func applyLimits(limits Limits) error {
+	if limits.Memory > 0 || limits.CPU > 0 || limits.Seccomp {
+		slog.Warn("sandbox memory, CPU and system call limits are not supported on this system")
+	}
+	return nil
+}
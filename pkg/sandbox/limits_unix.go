@@ -0,0 +1,31 @@
+//go:build linux || darwin
+
+package sandbox
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// applyLimits limits the resources of the current process. The address
+// space limit makes allocations fail instead of exhausting the memory of
+// the machine, and the CPU limit ends the process with SIGXCPU.
+func applyLimits(limits Limits) error {
+	if limits.Memory > 0 {
+		limit := syscall.Rlimit{Cur: uint64(limits.Memory), Max: uint64(limits.Memory)}
+		if err := syscall.Setrlimit(syscall.RLIMIT_AS, &limit); err != nil {
+			return fmt.Errorf("failed to limit sandbox memory: %w", err)
+		}
+	}
+	if limits.CPU > 0 {
+		seconds := uint64(max(limits.CPU.Seconds(), 1))
+		limit := syscall.Rlimit{Cur: seconds, Max: seconds + 1}
+		if err := syscall.Setrlimit(syscall.RLIMIT_CPU, &limit); err != nil {
+			return fmt.Errorf("failed to limit sandbox CPU time: %w", err)
+		}
+	}
+	if limits.Seccomp {
+		return applySeccomp()
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+// Package sandbox decodes untrusted images in a separate, resource-limited
+// worker process, so a malicious file that crashes, hangs or exhausts a
+// decoder (many of which are C libraries) cannot take down the process that
+// asked for it
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"time"
+
+	"nim/pkg/image"
+	"nim/pkg/plugin"
+)
+
+// WorkerCommand is the hidden nim subcommand that runs a worker
+const WorkerCommand = "sandbox-worker"
+
+// Limits are the resources a worker may use
+type Limits struct {
+	Memory  int64         `json:"memory"`  // Largest address space of the worker in bytes; 0 is unlimited
+	CPU     time.Duration `json:"cpu"`     // CPU time the worker may use; 0 is unlimited
+	Timeout time.Duration `json:"timeout"` // Time the worker may take before it is killed; 0 waits forever
+	Seccomp bool          `json:"seccomp"` // Deny network, program execution and tracing system calls (Linux only)
+}
+
+// DefaultLimits returns limits that fit the decoding of any reasonable image
+func DefaultLimits() Limits {
+	return Limits{
+		Memory:  4 << 30,
+		CPU:     time.Minute,
+		Timeout: 2 * time.Minute,
+	}
+}
+
+// Exit codes of a worker, which tell the supervisor the kind of error it
+// printed
+const (
+	exitError       = 1 // Other errors
+	exitUnsupported = 3 // image.ErrUnsupportedFormat
+	exitDecode      = 4 // image.ErrDecode
+	exitNotExist    = 5 // fs.ErrNotExist
+	exitPermission  = 6 // fs.ErrPermission
+)
+
+// errorKinds are the errors the exit codes of a worker stand for
+var errorKinds = map[int]error{
+	exitUnsupported: image.ErrUnsupportedFormat,
+	exitDecode:      image.ErrDecode,
+	exitNotExist:    fs.ErrNotExist,
+	exitPermission:  fs.ErrPermission,
+}
+
+// ExitCode returns the code a worker exits with after printing err, so
+// the supervisor can return an error of the same kind
+func ExitCode(err error) int {
+	for _, code := range []int{exitUnsupported, exitDecode, exitNotExist, exitPermission} {
+		if errors.Is(err, errorKinds[code]) {
+			return code
+		}
+	}
+	return exitError
+}
+
+// workerError is an error a worker printed, of the kind its exit code
+// stands for
+type workerError struct {
+	kind    error
+	message string
+}
+
+func (e *workerError) Error() string {
+	return e.message
+}
+
+func (e *workerError) Unwrap() error {
+	return e.kind
+}
+
+// request is what the supervisor sends a worker on its stdin
+type request struct {
+	Path    string               `json:"path"`
+	Options image.ProcessOptions `json:"options"`
+	Limits  Limits               `json:"limits"`
+}
+
+// response is what a worker writes on its stdout, as a JSON line before the
+// image frame
+type response struct {
+	Recovery *image.Recovery `json:"recovery,omitempty"` // How much of a damaged input best-effort decoding recovered
+}
+
+// Sandbox starts a worker process for each decode
+type Sandbox struct {
+	Command []string // Program and arguments that start a worker
+	Limits  Limits   // Resources each worker may use
+}
+
+// New returns a sandbox whose workers run the current executable with
+// WorkerCommand
+func New(limits Limits) (*Sandbox, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the nim executable: %w", err)
+	}
+	return &Sandbox{Command: []string{exe, WorkerCommand}, Limits: limits}, nil
+}
+
+// Decode decodes the image file at path in a new worker process. A worker
+// that crashes, runs out of memory or time, or is killed returns an error
+// instead of affecting the caller.
+func (s *Sandbox) Decode(path string, options image.ProcessOptions) (stdimage.Image, error) {
+	start := time.Now()
+	options.Hooks = image.Hooks{}
+	data, err := json.Marshal(request{Path: path, Options: options, Limits: s.Limits})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sandbox request: %w", err)
+	}
+
+	ctx := context.Background()
+	if s.Limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Limits.Timeout)
+		defer cancel()
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	slog.Debug("decoding in sandbox", "file", path, "worker", s.Command[0])
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to decode %s: the sandboxed decoder took longer than %s", path, s.Limits.Timeout)
+		}
+		message := bytes.TrimSpace(stderr.Bytes())
+		var exit *exec.ExitError
+		if errors.As(err, &exit) && len(message) > 0 {
+			if exit.ExitCode() == exitError {
+				return nil, errors.New(string(message))
+			}
+			if kind, ok := errorKinds[exit.ExitCode()]; ok {
+				return nil, &workerError{kind: kind, message: string(message)}
+			}
+		}
+		return nil, fmt.Errorf("failed to decode %s: the sandboxed decoder crashed: %w: %s", path, err, firstLine(message))
+	}
+
+	var resp response
+	line, err := stdout.ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, &resp)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: invalid sandbox response: %w", path, err)
+	}
+	img, err := plugin.ReadFrame(&stdout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: invalid sandbox output: %w", path, err)
+	}
+	slog.Info("decoded image in sandbox", "file", path, "size", fmt.Sprintf("%dx%d", img.Rect.Dx(), img.Rect.Dy()), "duration", time.Since(start))
+	if resp.Recovery != nil {
+		return image.WithRecovery(img, *resp.Recovery), nil
+	}
+	return img, nil
+}
+
+// Serve runs a worker: it reads a request from r, applies its limits, decodes
+// the file and writes a response and the image to w as a plugin frame. Errors are returned
+// for the worker to print and exit with their ExitCode.
+func Serve(r io.Reader, w io.Writer) error {
+	var req request
+	if err := json.NewDecoder(r).Decode(&req); err != nil {
+		return fmt.Errorf("invalid sandbox request: %w", err)
+	}
+	if err := applyLimits(req.Limits); err != nil {
+		return err
+	}
+	img, err := image.OpenImageWithOptions(req.Path, req.Options)
+	if err != nil {
+		return err
+	}
+	var resp response
+	if recovery, ok := image.Recovered(img); ok {
+		resp.Recovery = &recovery
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("failed to encode sandbox response: %w", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write sandbox response: %w", err)
+	}
+	return plugin.WriteFrame(w, img)
+}
+
+// firstLine returns the first line of a message, such as the panic or
+// signal that ended a worker, without the stack trace that follows
+func firstLine(message []byte) []byte {
+	line, _, _ := bytes.Cut(message, []byte("\n"))
+	return line
+}
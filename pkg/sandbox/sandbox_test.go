@@ -0,0 +1,125 @@
+package sandbox
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	nimimage "nim/pkg/image"
+)
+
+// TestMain runs the test binary as a worker when the tests start it so
+func TestMain(m *testing.M) {
+	switch os.Getenv("NIM_SANDBOX_TEST") {
+	case "worker":
+		if err := Serve(os.Stdin, os.Stdout); err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			os.Exit(ExitCode(err))
+		}
+		os.Exit(0)
+	case "crash":
+		panic("decoder exploded")
+	case "hang":
+		time.Sleep(time.Minute)
+	}
+	os.Exit(m.Run())
+}
+
+// testSandbox returns a sandbox whose workers run this test binary in mode
+func testSandbox(t *testing.T, mode string, limits Limits) *Sandbox {
+	t.Setenv("NIM_SANDBOX_TEST", mode)
+	return &Sandbox{Command: []string{os.Args[0]}, Limits: limits}
+}
+
+func TestDecode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "in.png")
+	src := image.NewNRGBA(image.Rect(0, 0, 7, 5))
+	src.SetNRGBA(3, 2, color.NRGBA{R: 200, G: 10, B: 30, A: 255})
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, src)
+	f.Close()
+
+	img, err := testSandbox(t, "worker", DefaultLimits()).Decode(path, nimimage.DefaultOptions())
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if img.Bounds() != src.Bounds() {
+		t.Fatalf("Expected %v, got %v", src.Bounds(), img.Bounds())
+	}
+	if got := color.NRGBAModel.Convert(img.At(3, 2)); got != src.At(3, 2) {
+		t.Errorf("Expected %v at 3,2, got %v", src.At(3, 2), got)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.png")
+	os.WriteFile(path, []byte("not a png"), 0o644)
+
+	_, err := testSandbox(t, "worker", DefaultLimits()).Decode(path, nimimage.DefaultOptions())
+	if err == nil || !strings.Contains(err.Error(), "failed to decode image") {
+		t.Errorf("Expected the decoder error of the worker, got %v", err)
+	}
+}
+
+func TestDecodeRecovery(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 64, 48)))
+	path := filepath.Join(t.TempDir(), "truncated.png")
+	os.WriteFile(path, buf.Bytes()[:buf.Len()*6/10], 0o644)
+
+	options := nimimage.DefaultOptions()
+	options.BestEffort = true
+	img, err := testSandbox(t, "worker", DefaultLimits()).Decode(path, options)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	recovery, ok := nimimage.Recovered(img)
+	if !ok || recovery.Height != 48 || recovery.Error == "" {
+		t.Errorf("Expected the recovery of the worker, got %+v, %v", recovery, ok)
+	}
+}
+
+func TestDecodeErrorKind(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "in.xyz"), []byte("data"), 0o644)
+	os.WriteFile(filepath.Join(dir, "broken.png"), []byte("not a png"), 0o644)
+
+	for _, tt := range []struct {
+		file string
+		kind error
+	}{
+		{"in.xyz", nimimage.ErrUnsupportedFormat},
+		{"broken.png", nimimage.ErrDecode},
+		{"missing.png", fs.ErrNotExist},
+	} {
+		_, err := testSandbox(t, "worker", DefaultLimits()).Decode(filepath.Join(dir, tt.file), nimimage.DefaultOptions())
+		if !errors.Is(err, tt.kind) {
+			t.Errorf("%s: expected a %v error, got %v", tt.file, tt.kind, err)
+		}
+	}
+}
+
+func TestDecodeCrash(t *testing.T) {
+	_, err := testSandbox(t, "crash", DefaultLimits()).Decode("in.png", nimimage.DefaultOptions())
+	if err == nil || !strings.Contains(err.Error(), "crashed") || !strings.Contains(err.Error(), "decoder exploded") {
+		t.Errorf("Expected a crash error with the panic message, got %v", err)
+	}
+}
+
+func TestDecodeTimeout(t *testing.T) {
+	_, err := testSandbox(t, "hang", Limits{Timeout: 100 * time.Millisecond}).Decode("in.png", nimimage.DefaultOptions())
+	if err == nil || !strings.Contains(err.Error(), "took longer") {
+		t.Errorf("Expected a timeout error, got %v", err)
+	}
+}
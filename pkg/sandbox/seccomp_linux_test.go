@@ -0,0 +1,63 @@
+package sandbox
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// runFilter runs the instructions of a seccomp filter that seccompFilter
+// uses on a system call and returns the action
+func runFilter(t *testing.T, filter []unix.SockFilter, arch, nr uint32) uint32 {
+	t.Helper()
+	var acc uint32
+	for pc := 0; pc < len(filter); pc++ {
+		in := filter[pc]
+		switch in.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			acc = map[uint32]uint32{0: nr, 4: arch}[in.K]
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K:
+			taken := acc == in.K
+			if in.Code&0xf0 == unix.BPF_JGE {
+				taken = acc >= in.K
+			}
+			if taken {
+				pc += int(in.Jt)
+			} else {
+				pc += int(in.Jf)
+			}
+		case unix.BPF_RET | unix.BPF_K:
+			return in.K
+		default:
+			t.Fatalf("unexpected instruction %#x", in.Code)
+		}
+	}
+	t.Fatal("the filter does not return")
+	return 0
+}
+
+func TestSeccompFilter(t *testing.T) {
+	arch := uint32(unix.AUDIT_ARCH_X86_64)
+	filter := seccompFilter(arch)
+	eperm := uint32(seccompRetErrno | uint32(unix.EPERM))
+	for _, tt := range []struct {
+		name     string
+		arch, nr uint32
+		want     uint32
+	}{
+		{"read", arch, unix.SYS_READ, seccompRetAllow},
+		{"openat", arch, unix.SYS_OPENAT, seccompRetAllow},
+		{"socket", arch, unix.SYS_SOCKET, eperm},
+		{"execve", arch, unix.SYS_EXECVE, eperm},
+		{"io_uring_setup", arch, unix.SYS_IO_URING_SETUP, eperm},
+		{"io_uring_enter", arch, unix.SYS_IO_URING_ENTER, eperm},
+		{"io_uring_register", arch, unix.SYS_IO_URING_REGISTER, eperm},
+		{"x32 socket", arch, x32SyscallBit | 41, seccompRetKill},
+		{"x32 read", arch, x32SyscallBit, seccompRetKill},
+		{"other architecture", unix.AUDIT_ARCH_I386, unix.SYS_READ, seccompRetKill},
+	} {
+		if got := runFilter(t, filter, tt.arch, tt.nr); got != tt.want {
+			t.Errorf("%s: expected %#x, got %#x", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build darwin
+
+package sandbox
+
+import "errors"
+
+// applySeccomp fails outside Linux, which alone has seccomp
+func applySeccomp() error {
+	return errors.New("seccomp is only available on Linux")
+}
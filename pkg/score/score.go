@@ -0,0 +1,189 @@
+// Package score measures the technical quality of photos: how sharp, noisy
+// and well exposed they are, so batch jobs can flag bad shots before
+// converting them.
+package score
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// sharpnessSize is the longest side images are scaled down to before
+// measuring sharpness, so scores of images of different sizes compare
+const sharpnessSize = 1024
+
+// Luma levels at or below which a pixel is underexposed, and at or above
+// which it is overexposed
+const (
+	shadowLevel    = 10
+	highlightLevel = 245
+)
+
+// Score holds the quality measures of an image
+type Score struct {
+	Sharpness    float64 // Variance of the Laplacian of the luma; blurry images score low
+	Noise        float64 // Estimated standard deviation of the noise, in levels (0-255)
+	Underexposed float64 // Fraction of pixels with a luma near black
+	Overexposed  float64 // Fraction of pixels with a luma near white
+	Brightness   float64 // Mean luma (0-255)
+}
+
+// Thresholds are the limits past which a score is an issue. A zero limit is
+// not checked.
+type Thresholds struct {
+	MinSharpness    float64
+	MaxNoise        float64
+	MaxUnderexposed float64
+	MaxOverexposed  float64
+}
+
+// DefaultThresholds returns limits that flag clearly blurry, noisy or badly
+// exposed photos
+func DefaultThresholds() Thresholds {
+	return Thresholds{
+		MinSharpness:    100,
+		MaxNoise:        8,
+		MaxUnderexposed: 0.25,
+		MaxOverexposed:  0.1,
+	}
+}
+
+// Compute scores an image. Sharpness is measured at most 1024 pixels on the
+// longest side; noise is measured at full size, since scaling smooths it out.
+func Compute(img image.Image) Score {
+	src := imaging.Clone(img)
+	b := src.Bounds()
+	var s Score
+	if b.Empty() {
+		return s
+	}
+
+	full := lumaPlane(src)
+	under, over, sum := 0, 0, 0.0
+	for _, v := range full.pix {
+		sum += v
+		if v <= shadowLevel {
+			under++
+		}
+		if v >= highlightLevel {
+			over++
+		}
+	}
+	n := float64(len(full.pix))
+	s.Brightness = sum / n
+	s.Underexposed = float64(under) / n
+	s.Overexposed = float64(over) / n
+	s.Noise = noise(full)
+
+	small := full
+	if max(b.Dx(), b.Dy()) > sharpnessSize {
+		if b.Dx() >= b.Dy() {
+			small = lumaPlane(imaging.Resize(src, sharpnessSize, 0, imaging.Box))
+		} else {
+			small = lumaPlane(imaging.Resize(src, 0, sharpnessSize, imaging.Box))
+		}
+	}
+	s.Sharpness = sharpness(small)
+	return s
+}
+
+// Issues returns the names of the limits s is past: "blurry", "noisy",
+// "underexposed" and "overexposed"
+func (s Score) Issues(t Thresholds) []string {
+	var issues []string
+	if t.MinSharpness > 0 && s.Sharpness < t.MinSharpness {
+		issues = append(issues, "blurry")
+	}
+	if t.MaxNoise > 0 && s.Noise > t.MaxNoise {
+		issues = append(issues, "noisy")
+	}
+	if t.MaxUnderexposed > 0 && s.Underexposed > t.MaxUnderexposed {
+		issues = append(issues, "underexposed")
+	}
+	if t.MaxOverexposed > 0 && s.Overexposed > t.MaxOverexposed {
+		issues = append(issues, "overexposed")
+	}
+	return issues
+}
+
+// plane is a single channel of levels
+type plane struct {
+	w, h int
+	pix  []float64
+}
+
+func (p plane) at(x, y int) float64 {
+	return p.pix[y*p.w+x]
+}
+
+// lumaPlane returns the Rec. 601 luma of an image. Transparent pixels count
+// as their color, as in the histogram.
+func lumaPlane(img *image.NRGBA) plane {
+	b := img.Bounds()
+	p := plane{w: b.Dx(), h: b.Dy(), pix: make([]float64, b.Dx()*b.Dy())}
+	for y := range p.h {
+		row := img.Pix[y*img.Stride:]
+		for x := range p.w {
+			r, g, b := row[x*4], row[x*4+1], row[x*4+2]
+			p.pix[y*p.w+x] = 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+		}
+	}
+	return p
+}
+
+// sharpness returns the variance of the 4-neighbour Laplacian over the
+// interior of p. Edges give large responses and blur removes them.
+func sharpness(p plane) float64 {
+	if p.w < 3 || p.h < 3 {
+		return 0
+	}
+	var sum, sumSq float64
+	for y := 1; y < p.h-1; y++ {
+		for x := 1; x < p.w-1; x++ {
+			l := p.at(x-1, y) + p.at(x+1, y) + p.at(x, y-1) + p.at(x, y+1) - 4*p.at(x, y)
+			sum += l
+			sumSq += l * l
+		}
+	}
+	n := float64((p.w - 2) * (p.h - 2))
+	mean := sum / n
+	return sumSq/n - mean*mean
+}
+
+// noiseBins is the number of bins per level of the histogram noise takes
+// the median of
+const noiseBins = 8
+
+// noise estimates the standard deviation of Gaussian noise in p with the
+// mask of Immerkær (1996), which cancels out smooth gradients and leaves
+// mostly the noise. The median of the responses is used instead of their
+// mean, so the edges and texture of a photo are not taken for noise.
+func noise(p plane) float64 {
+	if p.w < 3 || p.h < 3 {
+		return 0
+	}
+	// Responses range up to 16 times 255
+	counts := make([]int, 16*255*noiseBins+1)
+	for y := 1; y < p.h-1; y++ {
+		for x := 1; x < p.w-1; x++ {
+			v := p.at(x-1, y-1) - 2*p.at(x, y-1) + p.at(x+1, y-1) -
+				2*p.at(x-1, y) + 4*p.at(x, y) - 2*p.at(x+1, y) +
+				p.at(x-1, y+1) - 2*p.at(x, y+1) + p.at(x+1, y+1)
+			counts[min(int(math.Abs(v)*noiseBins), len(counts)-1)]++
+		}
+	}
+	half, seen := (p.w-2)*(p.h-2)/2, 0
+	median := 0.0
+	for bin, n := range counts {
+		seen += n
+		if seen > half {
+			median = (float64(bin) + 0.5) / noiseBins
+			break
+		}
+	}
+	// The responses of noise of deviation s are normal with deviation 6s,
+	// and the median of their absolute values is 0.6745 times that
+	return median / 0.6745 / 6
+}
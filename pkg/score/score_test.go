@@ -0,0 +1,75 @@
+package score
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// checkers returns a board of 8-pixel black and white squares
+func checkers(w, h int) *image.NRGBA {
+	img := imaging.New(w, h, color.NRGBA{255, 255, 255, 255})
+	for y := range h {
+		for x := range w {
+			if (x/8+y/8)%2 == 0 {
+				img.SetNRGBA(x, y, color.NRGBA{0, 0, 0, 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestSharpness(t *testing.T) {
+	sharp := Compute(checkers(256, 256))
+	blurry := Compute(imaging.Blur(checkers(256, 256), 4))
+	if sharp.Sharpness <= 10*blurry.Sharpness {
+		t.Errorf("expected the sharp image to score far higher, got %.1f and %.1f", sharp.Sharpness, blurry.Sharpness)
+	}
+	if flat := Compute(imaging.New(64, 64, color.NRGBA{128, 128, 128, 255})); flat.Sharpness != 0 {
+		t.Errorf("expected a flat image to score 0, got %.1f", flat.Sharpness)
+	}
+}
+
+func TestNoise(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	img := imaging.New(256, 256, color.NRGBA{128, 128, 128, 255})
+	for i := 0; i < len(img.Pix); i += 4 {
+		v := uint8(128 + math.Round(rng.NormFloat64()*5))
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2] = v, v, v
+	}
+	if s := Compute(img); math.Abs(s.Noise-5) > 0.5 {
+		t.Errorf("expected a noise of about 5, got %.2f", s.Noise)
+	}
+	// Edges are not noise
+	if s := Compute(checkers(256, 256)); s.Noise > 2 {
+		t.Errorf("expected little noise in a clean image, got %.2f", s.Noise)
+	}
+}
+
+func TestExposure(t *testing.T) {
+	img := imaging.New(100, 100, color.NRGBA{0, 0, 0, 255})
+	for y := range 100 {
+		for x := range 30 {
+			img.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+		}
+	}
+	s := Compute(img)
+	if math.Abs(s.Underexposed-0.7) > 1e-9 || math.Abs(s.Overexposed-0.3) > 1e-9 {
+		t.Errorf("expected 70%% underexposed and 30%% overexposed, got %v and %v", s.Underexposed, s.Overexposed)
+	}
+	if math.Abs(s.Brightness-0.3*255) > 1e-6 {
+		t.Errorf("expected a brightness of %.1f, got %.1f", 0.3*255, s.Brightness)
+	}
+	want := []string{"underexposed", "overexposed"}
+	if issues := s.Issues(DefaultThresholds()); !slices.Equal(issues, want) {
+		t.Errorf("expected %v, got %v", want, issues)
+	}
+	if issues := s.Issues(Thresholds{}); issues != nil {
+		t.Errorf("expected no issues without limits, got %v", issues)
+	}
+}
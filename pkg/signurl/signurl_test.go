@@ -0,0 +1,55 @@
+package signurl
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSign(t *testing.T) {
+	// HMAC-SHA256 of the salt and the path, as imgproxy computes it
+	key, err := ParseKey("943b421c9eb07c830af81030552c86009268de4e532ba2ee2eab8247c6da0881:520f986b998545b4785e0defbc4f3c1203f22de2374a3d53cb7a7fe9fea309c5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := Sign(key, "/rs:fill:300:400:0/g:sm/aHR0cDovL2V4YW1w/bGUuY29tL2ltYWdl/cy9jdXJpb3NpdHku/anBn.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/90UxdwGRAI2bpLSHKkZculJau5ahfxfS0h3fMuQAf40/rs:fill:300:400:0/g:sm/aHR0cDovL2V4YW1w/bGUuY29tL2ltYWdl/cy9jdXJpb3NpdHku/anBn.png"; signed != want {
+		t.Errorf("expected %s, got %s", want, signed)
+	}
+
+	if _, err := Sign(key, "photo.jpg"); err == nil {
+		t.Error("expected an error for a relative path")
+	}
+	for _, spec := range []string{"", "xyz", "00ff:salt"} {
+		if _, err := ParseKey(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	keys, err := ParseKeys([]string{"0123456789abcdef", "fedcba9876543210:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		signed, _ := Sign(key, "/w:800/photos/cat.jpg")
+		if path, err := Verify(keys, signed); err != nil || path != "/w:800/photos/cat.jpg" {
+			t.Errorf("expected a valid signature, got %q, %v", path, err)
+		}
+	}
+
+	signed, _ := Sign(keys[0], "/w:800/photos/cat.jpg")
+	tampered := signed[:len(signed)-len("/w:800/photos/cat.jpg")] + "/w:8000/photos/cat.jpg"
+	for _, path := range []string{tampered, "/w:800/photos/cat.jpg", "", "/unsigned"} {
+		if _, err := Verify(keys, path); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("expected an invalid signature for %q, got %v", path, err)
+		}
+	}
+	// A key that was rotated out no longer verifies
+	if _, err := Verify(keys[1:], signed); err == nil {
+		t.Error("expected the removed key to be rejected")
+	}
+}
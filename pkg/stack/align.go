@@ -0,0 +1,138 @@
+package stack
+
+import (
+	"image"
+	"math/bits"
+	"sync/atomic"
+)
+
+// noise is how close to the median a pixel can be before alignment ignores
+// it, in gray levels
+const noise = 4
+
+// bitmap is a median threshold bitmap: which pixels are brighter than the
+// median of the image, and which are far enough from it to be reliable
+type bitmap struct {
+	w, h   int
+	bright []bool
+	usable []bool
+}
+
+// Align returns the shift of frame relative to reference, up to maxShift
+// pixels in each direction: the content at p in reference is at p plus the
+// shift in frame. It compares median threshold bitmaps (Ward, 2003), which do
+// not change with exposure, at increasing resolutions.
+func Align(reference, frame *image.NRGBA, maxShift int) image.Point {
+	levels := bits.Len(uint(maxShift))
+	a, b := gray(reference), gray(frame)
+	pyramidA, pyramidB := []grayImage{a}, []grayImage{b}
+	for range levels - 1 {
+		if a.w < 16 || a.h < 16 {
+			break
+		}
+		a, b = a.half(), b.half()
+		pyramidA, pyramidB = append(pyramidA, a), append(pyramidB, b)
+	}
+
+	var shift image.Point
+	for level := len(pyramidA) - 1; level >= 0; level-- {
+		ta, tb := pyramidA[level].threshold(), pyramidB[level].threshold()
+		shift = shift.Mul(2)
+		// Ties keep the shift of the previous level, so that images without
+		// reliable pixels, such as flat ones, are not moved
+		best, bestErr := shift, mismatch(ta, tb, shift)
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				s := shift.Add(image.Pt(dx, dy))
+				if e := mismatch(ta, tb, s); e < bestErr {
+					best, bestErr = s, e
+				}
+			}
+		}
+		shift = best
+	}
+	return image.Pt(min(max(shift.X, -maxShift), maxShift), min(max(shift.Y, -maxShift), maxShift))
+}
+
+// mismatch counts the usable pixels of a that differ from b shifted by s,
+// relative to the number of pixels compared, so that shifts with less
+// overlap are not favored
+func mismatch(a, b bitmap, s image.Point) int {
+	x0, x1 := max(0, -s.X), min(a.w, b.w-s.X)
+	y0, y1 := max(0, -s.Y), min(a.h, b.h-s.Y)
+	if x1 <= x0 || y1 <= y0 {
+		return int(^uint(0) >> 1)
+	}
+	var count atomic.Int64
+	parallel(y1-y0, func(lo, hi int) {
+		n := 0
+		for y := y0 + lo; y < y0+hi; y++ {
+			ra := y * a.w
+			rb := (y+s.Y)*b.w + s.X
+			for x := x0; x < x1; x++ {
+				if a.usable[ra+x] && b.usable[rb+x] && a.bright[ra+x] != b.bright[rb+x] {
+					n++
+				}
+			}
+		}
+		count.Add(int64(n))
+	})
+	// Per million compared pixels
+	return int(count.Load() * 1e6 / int64((x1-x0)*(y1-y0)))
+}
+
+// grayImage is an 8-bit grayscale image
+type grayImage struct {
+	w, h int
+	pix  []uint8
+}
+
+// gray returns the luma of img
+func gray(img *image.NRGBA) grayImage {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	g := grayImage{w, h, make([]uint8, w*h)}
+	for y := range h {
+		row := img.Pix[img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y):][:w*4]
+		for x := range w {
+			p := row[x*4 : x*4+3 : x*4+3]
+			g.pix[y*w+x] = uint8((54*uint32(p[0]) + 183*uint32(p[1]) + 19*uint32(p[2]) + 128) >> 8)
+		}
+	}
+	return g
+}
+
+// half returns g at half the size, averaging blocks of 2x2 pixels
+func (g grayImage) half() grayImage {
+	w, h := g.w/2, g.h/2
+	out := grayImage{w, h, make([]uint8, w*h)}
+	for y := range h {
+		for x := range w {
+			i := 2*y*g.w + 2*x
+			sum := uint32(g.pix[i]) + uint32(g.pix[i+1]) + uint32(g.pix[i+g.w]) + uint32(g.pix[i+g.w+1])
+			out.pix[y*w+x] = uint8((sum + 2) / 4)
+		}
+	}
+	return out
+}
+
+// threshold returns the median threshold bitmap of g
+func (g grayImage) threshold() bitmap {
+	var histogram [256]int
+	for _, v := range g.pix {
+		histogram[v]++
+	}
+	med, count := 0, 0
+	for v, n := range histogram {
+		if count += n; count*2 >= len(g.pix) {
+			med = v
+			break
+		}
+	}
+	b := bitmap{g.w, g.h, make([]bool, len(g.pix)), make([]bool, len(g.pix))}
+	for i, v := range g.pix {
+		d := int(v) - med
+		b.bright[i] = d > 0
+		b.usable[i] = d > noise || d < -noise
+	}
+	return b
+}
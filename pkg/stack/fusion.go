@@ -0,0 +1,227 @@
+package stack
+
+import (
+	"image"
+	"math"
+)
+
+// sigma is the spread of the well-exposedness weight around mid-gray
+const sigma = 0.2
+
+// plane is a channel of an image in floating point
+type plane struct {
+	w, h int
+	pix  []float32
+}
+
+func newPlane(w, h int) plane {
+	return plane{w, h, make([]float32, w*h)}
+}
+
+// fuse blends exposures of the same size with Mertens exposure fusion: each
+// pixel is weighted by its contrast, saturation and closeness to mid-gray,
+// and the frames are blended in a Laplacian pyramid so that the weights do
+// not leave seams
+func fuse(images []*image.NRGBA) *image.NRGBA {
+	w, h := images[0].Rect.Dx(), images[0].Rect.Dy()
+	levels := 1
+	for s := min(w, h); s >= 16; s /= 2 {
+		levels++
+	}
+
+	// Normalize the weights so they add up to 1 at each pixel, computing
+	// them again for each frame to keep one frame in memory at a time
+	total := newPlane(w, h)
+	for _, img := range images {
+		weight := weights(channels(img))
+		for i, v := range weight.pix {
+			total.pix[i] += v
+		}
+	}
+
+	var result [3][]plane
+	for _, img := range images {
+		rgb := channels(img)
+		weight := weights(rgb)
+		for i, v := range weight.pix {
+			weight.pix[i] = v / total.pix[i]
+		}
+		gauss := gaussianPyramid(weight, levels)
+		for c := range rgb {
+			laplace := laplacianPyramid(rgb[c], levels)
+			if result[c] == nil {
+				result[c] = make([]plane, levels)
+				for l, p := range laplace {
+					result[c][l] = newPlane(p.w, p.h)
+				}
+			}
+			for l, p := range laplace {
+				dst, g := result[c][l].pix, gauss[l].pix
+				for i, v := range p.pix {
+					dst[i] += v * g[i]
+				}
+			}
+		}
+	}
+
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for c := range result {
+		p := collapse(result[c])
+		for i, v := range p.pix {
+			out.Pix[i*4+c] = uint8(min(max(v*255+0.5, 0), 255))
+		}
+	}
+	for i := 3; i < len(out.Pix); i += 4 {
+		out.Pix[i] = 255
+	}
+	return out
+}
+
+// channels returns the red, green and blue of img from 0 to 1
+func channels(img *image.NRGBA) [3]plane {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	rgb := [3]plane{newPlane(w, h), newPlane(w, h), newPlane(w, h)}
+	for y := range h {
+		row := img.Pix[img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y):][:w*4]
+		for x := range w {
+			for c := range rgb {
+				rgb[c].pix[y*w+x] = float32(row[x*4+c]) / 255
+			}
+		}
+	}
+	return rgb
+}
+
+// weights returns the fusion weight of each pixel: the product of its local
+// contrast, its saturation and how well exposed it is
+func weights(rgb [3]plane) plane {
+	w, h := rgb[0].w, rgb[0].h
+	gray := newPlane(w, h)
+	for i := range gray.pix {
+		gray.pix[i] = 0.299*rgb[0].pix[i] + 0.587*rgb[1].pix[i] + 0.114*rgb[2].pix[i]
+	}
+	out := newPlane(w, h)
+	parallel(h, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			up, down := max(y-1, 0), min(y+1, h-1)
+			for x := range w {
+				i := y*w + x
+				left, right := max(x-1, 0), min(x+1, w-1)
+				laplacian := gray.pix[up*w+x] + gray.pix[down*w+x] + gray.pix[y*w+left] + gray.pix[y*w+right] - 4*gray.pix[i]
+				contrast := math.Abs(float64(laplacian))
+
+				r, g, b := float64(rgb[0].pix[i]), float64(rgb[1].pix[i]), float64(rgb[2].pix[i])
+				mu := (r + g + b) / 3
+				saturation := math.Sqrt(((r-mu)*(r-mu) + (g-mu)*(g-mu) + (b-mu)*(b-mu)) / 3)
+
+				exposure := math.Exp(-((r-0.5)*(r-0.5) + (g-0.5)*(g-0.5) + (b-0.5)*(b-0.5)) / (2 * sigma * sigma))
+				out.pix[i] = float32(contrast*saturation*exposure + 1e-12)
+			}
+		}
+	})
+	return out
+}
+
+// binomial is the 5-tap filter of the pyramids
+var binomial = [5]float32{1.0 / 16, 4.0 / 16, 6.0 / 16, 4.0 / 16, 1.0 / 16}
+
+// reduce blurs p and halves its size
+func reduce(p plane) plane {
+	w, h := (p.w+1)/2, (p.h+1)/2
+	// Horizontally, then vertically
+	tmp := newPlane(w, p.h)
+	parallel(p.h, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			row := p.pix[y*p.w:][:p.w]
+			for x := range w {
+				var sum float32
+				for k, f := range binomial {
+					sum += f * row[min(max(2*x+k-2, 0), p.w-1)]
+				}
+				tmp.pix[y*w+x] = sum
+			}
+		}
+	})
+	out := newPlane(w, h)
+	parallel(h, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			for x := range w {
+				var sum float32
+				for k, f := range binomial {
+					sum += f * tmp.pix[min(max(2*y+k-2, 0), p.h-1)*w+x]
+				}
+				out.pix[y*w+x] = sum
+			}
+		}
+	})
+	return out
+}
+
+// expand doubles the size of p to w by h, interpolating with the binomial
+// filter
+func expand(p plane, w, h int) plane {
+	// Even positions fall on a sample, odd ones halfway between two
+	taps := func(i, n int) (a, b, c int, fa, fb, fc float32) {
+		k := i / 2
+		if i%2 == 0 {
+			return max(k-1, 0), k, min(k+1, n-1), 1.0 / 8, 6.0 / 8, 1.0 / 8
+		}
+		return k, min(k+1, n-1), k, 0.5, 0.5, 0
+	}
+	tmp := newPlane(w, p.h)
+	parallel(p.h, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			row := p.pix[y*p.w:][:p.w]
+			for x := range w {
+				a, b, c, fa, fb, fc := taps(x, p.w)
+				tmp.pix[y*w+x] = fa*row[a] + fb*row[b] + fc*row[c]
+			}
+		}
+	})
+	out := newPlane(w, h)
+	parallel(h, func(lo, hi int) {
+		for y := lo; y < hi; y++ {
+			a, b, c, fa, fb, fc := taps(y, p.h)
+			for x := range w {
+				out.pix[y*w+x] = fa*tmp.pix[a*w+x] + fb*tmp.pix[b*w+x] + fc*tmp.pix[c*w+x]
+			}
+		}
+	})
+	return out
+}
+
+// gaussianPyramid returns p and levels-1 successively reduced copies
+func gaussianPyramid(p plane, levels int) []plane {
+	pyramid := []plane{p}
+	for range levels - 1 {
+		p = reduce(p)
+		pyramid = append(pyramid, p)
+	}
+	return pyramid
+}
+
+// laplacianPyramid returns the details of p lost at each level of its
+// Gaussian pyramid, and the smallest level
+func laplacianPyramid(p plane, levels int) []plane {
+	pyramid := gaussianPyramid(p, levels)
+	for l := range levels - 1 {
+		up := expand(pyramid[l+1], pyramid[l].w, pyramid[l].h)
+		for i, v := range up.pix {
+			pyramid[l].pix[i] -= v
+		}
+	}
+	return pyramid
+}
+
+// collapse reconstructs the image of a Laplacian pyramid
+func collapse(pyramid []plane) plane {
+	p := pyramid[len(pyramid)-1]
+	for l := len(pyramid) - 2; l >= 0; l-- {
+		up := expand(p, pyramid[l].w, pyramid[l].h)
+		for i, v := range pyramid[l].pix {
+			up.pix[i] += v
+		}
+		p = up
+	}
+	return p
+}
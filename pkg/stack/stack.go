@@ -0,0 +1,180 @@
+// Package stack merges several shots of the same scene into one image:
+// mean or median stacking to reduce noise, and Mertens exposure fusion to
+// combine bracketed exposures into an HDR-look image. Frames are aligned
+// first to correct small shifts of a handheld camera.
+package stack
+
+import (
+	"fmt"
+	"image"
+	"log/slog"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/disintegration/imaging"
+)
+
+// Method is how frames are merged
+type Method string
+
+const (
+	// MethodMean averages the frames, which reduces noise the most
+	MethodMean Method = "mean"
+	// MethodMedian takes the median of the frames, which also removes
+	// things that appear in only a few of them, such as passers-by or
+	// satellite trails
+	MethodMedian Method = "median"
+	// MethodFusion blends the best exposed parts of bracketed exposures
+	MethodFusion Method = "fusion"
+)
+
+// ParseMethod parses the name of a merge method
+func ParseMethod(name string) (Method, error) {
+	switch m := Method(strings.ToLower(strings.TrimSpace(name))); m {
+	case MethodMean, MethodMedian, MethodFusion:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid stack method: %s (expected mean, median or fusion)", name)
+}
+
+// DefaultMaxShift is the largest shift between frames Align looks for by
+// default, in pixels
+const DefaultMaxShift = 64
+
+// Options configure Merge
+type Options struct {
+	Method   Method
+	Align    bool // Whether to align the frames to the first one
+	MaxShift int  // Largest shift between frames that alignment corrects, in pixels
+}
+
+// Merge merges frames of the same size into one image. Aligned frames are
+// cropped to the area they all cover.
+func Merge(frames []image.Image, options Options) (*image.NRGBA, error) {
+	if len(frames) < 2 {
+		return nil, fmt.Errorf("stacking needs at least 2 images, got %d", len(frames))
+	}
+	size := frames[0].Bounds().Size()
+	images := make([]*image.NRGBA, len(frames))
+	for i, frame := range frames {
+		if s := frame.Bounds().Size(); s != size {
+			return nil, fmt.Errorf("image %d is %dx%d, expected %dx%d like the first one", i+1, s.X, s.Y, size.X, size.Y)
+		}
+		images[i] = imaging.Clone(frame)
+	}
+
+	offsets := make([]image.Point, len(images))
+	if options.Align {
+		maxShift := options.MaxShift
+		if maxShift <= 0 {
+			maxShift = DefaultMaxShift
+		}
+		for i := 1; i < len(images); i++ {
+			offsets[i] = Align(images[0], images[i], maxShift)
+			slog.Info("aligned frame", "frame", i+1, "dx", offsets[i].X, "dy", offsets[i].Y)
+		}
+	}
+
+	// Crop each frame to the area of the first one that all frames cover
+	area := images[0].Rect
+	for i, img := range images {
+		area = area.Intersect(img.Rect.Sub(offsets[i]))
+	}
+	if area.Empty() {
+		return nil, fmt.Errorf("the aligned images do not overlap")
+	}
+	for i, img := range images {
+		images[i] = img.SubImage(area.Add(offsets[i])).(*image.NRGBA)
+	}
+
+	switch options.Method {
+	case MethodMedian:
+		return median(images), nil
+	case MethodFusion:
+		return fuse(images), nil
+	}
+	return mean(images), nil
+}
+
+// mean returns the average of images of the same size
+func mean(images []*image.NRGBA) *image.NRGBA {
+	w, h := images[0].Rect.Dx(), images[0].Rect.Dy()
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	n := uint32(len(images))
+	parallel(h, func(lo, hi int) {
+		sums := make([]uint32, w*4)
+		for y := lo; y < hi; y++ {
+			clear(sums)
+			for _, img := range images {
+				row := img.Pix[img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y):][:w*4]
+				for i, v := range row {
+					sums[i] += uint32(v)
+				}
+			}
+			dst := out.Pix[y*out.Stride:][:w*4]
+			for i, s := range sums {
+				dst[i] = uint8((s + n/2) / n)
+			}
+		}
+	})
+	return out
+}
+
+// median returns the per-channel median of images of the same size
+func median(images []*image.NRGBA) *image.NRGBA {
+	w, h := images[0].Rect.Dx(), images[0].Rect.Dy()
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	n := len(images)
+	parallel(h, func(lo, hi int) {
+		values := make([]uint8, n)
+		rows := make([][]uint8, n)
+		for y := lo; y < hi; y++ {
+			for k, img := range images {
+				rows[k] = img.Pix[img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y):][:w*4]
+			}
+			dst := out.Pix[y*out.Stride:][:w*4]
+			for i := range dst {
+				for k, row := range rows {
+					values[k] = row[i]
+				}
+				slices.Sort(values)
+				if n%2 == 1 {
+					dst[i] = values[n/2]
+				} else {
+					dst[i] = uint8((uint16(values[n/2-1]) + uint16(values[n/2]) + 1) / 2)
+				}
+			}
+		}
+	})
+	return out
+}
+
+// parallel splits rows 0 to n between the CPUs, calling fn with each range of
+// rows from lo up to hi
+func parallel(n int, fn func(lo, hi int)) {
+	workers := min(runtime.GOMAXPROCS(0), n)
+	if workers <= 1 {
+		fn(0, n)
+		return
+	}
+	chunk := max(1, n/(workers*4))
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				lo := int(next.Add(int64(chunk))) - chunk
+				if lo >= n {
+					return
+				}
+				fn(lo, min(lo+chunk, n))
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,123 @@
+package stack
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+)
+
+// scene returns a textured test image, seen through a window at offset
+func scene(w, h int, offset image.Point, exposure float64) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			sx, sy := x+offset.X, y+offset.Y
+			// Blocks of random brightness with a colored gradient
+			r := rand.New(rand.NewSource(int64(sx/6*1000 + sy/6)))
+			v := float64(r.Intn(200)+20) * exposure
+			p := img.Pix[y*img.Stride+x*4:]
+			p[0] = uint8(min(v, 255))
+			p[1] = uint8(min(v*float64(sx%97)/97, 255))
+			p[2] = uint8(min(v*0.5, 255))
+			p[3] = 255
+		}
+	}
+	return img
+}
+
+func TestAlign(t *testing.T) {
+	reference := scene(160, 120, image.Pt(0, 0), 1)
+	for _, shift := range []image.Point{{5, -3}, {-12, 7}, {0, 0}} {
+		// A darker exposure of the same scene, moved
+		frame := scene(160, 120, shift, 0.5)
+		if got := Align(reference, frame, 32); got != shift.Mul(-1) {
+			t.Errorf("expected a shift of %v, got %v", shift.Mul(-1), got)
+		}
+	}
+
+	// Flat images stay in place
+	flat := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	if got := Align(flat, flat, 32); got != (image.Point{}) {
+		t.Errorf("expected no shift of a flat image, got %v", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := scene(64, 48, image.Point{}, 1)
+	var frames []image.Image
+	for i := range 3 {
+		frame := image.NewNRGBA(base.Rect)
+		copy(frame.Pix, base.Pix)
+		// An outlier in one frame only
+		if i == 1 {
+			frame.Pix[0] = 0
+		}
+		frames = append(frames, frame)
+	}
+
+	med, err := Merge(frames, Options{Method: MethodMedian})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if med.Pix[0] != base.Pix[0] {
+		t.Errorf("expected the median to drop the outlier, got %d, want %d", med.Pix[0], base.Pix[0])
+	}
+	avg, err := Merge(frames, Options{Method: MethodMean})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := uint8((2*int(base.Pix[0]) + 1) / 3); avg.Pix[0] != want {
+		t.Errorf("expected the mean %d, got %d", want, avg.Pix[0])
+	}
+
+	// Shifted frames are cropped to their overlap
+	shifted := []image.Image{scene(64, 48, image.Point{}, 1), scene(64, 48, image.Pt(4, 2), 1)}
+	aligned, err := Merge(shifted, Options{Method: MethodMean, Align: true, MaxShift: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := aligned.Rect.Size(); size != image.Pt(60, 46) {
+		t.Errorf("expected the 60x46 overlap, got %v", size)
+	}
+
+	if _, err := Merge(frames[:1], Options{}); err == nil {
+		t.Error("expected an error for a single image")
+	}
+	if _, err := Merge([]image.Image{base, scene(10, 10, image.Point{}, 1)}, Options{}); err == nil {
+		t.Error("expected an error for images of different sizes")
+	}
+}
+
+func TestFusion(t *testing.T) {
+	// Fusing copies of one image gives it back
+	img := scene(50, 40, image.Point{}, 1)
+	fused := fuse([]*image.NRGBA{img, img})
+	for i, v := range img.Pix {
+		if d := int(v) - int(fused.Pix[i]); d < -1 || d > 1 {
+			t.Fatalf("byte %d: expected %d, got %d", i, v, fused.Pix[i])
+		}
+	}
+
+	// The fusion of a dark and a bright exposure is better exposed than both
+	dark, bright := scene(50, 40, image.Point{}, 0.3), scene(50, 40, image.Point{}, 3)
+	fused = fuse([]*image.NRGBA{dark, bright})
+	badness := func(img *image.NRGBA) (sum float64) {
+		for i := 0; i < len(img.Pix); i += 4 {
+			d := float64(img.Pix[i]) - 128
+			sum += d * d
+		}
+		return sum
+	}
+	if b := badness(fused); b >= badness(dark) || b >= badness(bright) {
+		t.Errorf("expected the fusion closer to mid-gray than the exposures: %g vs %g and %g", b, badness(dark), badness(bright))
+	}
+}
+
+func TestParseMethod(t *testing.T) {
+	if m, err := ParseMethod("Median"); err != nil || m != MethodMedian {
+		t.Errorf("expected median, got %q, %v", m, err)
+	}
+	if _, err := ParseMethod("max"); err == nil {
+		t.Error("expected an error for an unknown method")
+	}
+}
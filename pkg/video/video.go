@@ -0,0 +1,117 @@
+package video
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// FFmpegPath is the ffmpeg executable used to extract frames
+var FFmpegPath = "ffmpeg"
+
+// Available reports whether ffmpeg can be found
+func Available() bool {
+	_, err := exec.LookPath(FFmpegPath)
+	return err == nil
+}
+
+// ExtractFrame extracts a single frame at the given timestamp. The timestamp
+// is passed to ffmpeg as-is, so both "00:01:23" and "83.5" are accepted.
+func ExtractFrame(path, at string) (image.Image, error) {
+	var frame image.Image
+	err := run(func(img image.Image) error {
+		frame = img
+		return nil
+	}, "-ss", at, "-i", path, "-frames:v", "1")
+	if err != nil {
+		return nil, err
+	}
+	if frame == nil {
+		return nil, fmt.Errorf("no frame found at %s in %s", at, path)
+	}
+	return frame, nil
+}
+
+// ExtractFrames extracts one frame for every interval of the video, and
+// calls fn with each as soon as it is decoded, so only one frame is held at a
+// time. An error from fn stops the extraction and is returned.
+func ExtractFrames(path string, every time.Duration, fn func(frame image.Image) error) error {
+	if every <= 0 {
+		return fmt.Errorf("invalid frame interval: %s", every)
+	}
+
+	fps := "fps=1/" + strconv.FormatFloat(every.Seconds(), 'f', -1, 64)
+	count := 0
+	err := run(func(frame image.Image) error {
+		count++
+		return fn(frame)
+	}, "-i", path, "-vf", fps)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("no frames extracted from %s", path)
+	}
+	return nil
+}
+
+// run invokes ffmpeg with the given input arguments and calls fn with each
+// PNG frame it writes to stdout
+func run(fn func(image.Image) error, args ...string) error {
+	if !Available() {
+		return fmt.Errorf("ffmpeg not found in PATH: it is required for video input")
+	}
+
+	args = append([]string{"-v", "error", "-nostdin"}, args...)
+	args = append(args, "-f", "image2pipe", "-vcodec", "png", "-")
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(FFmpegPath, args...)
+	slog.Debug("running ffmpeg", "path", FFmpegPath, "args", args)
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	if err := decodeFrames(stdout, fn); err != nil {
+		// Stop ffmpeg instead of letting it extract the rest of the video
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// decodeFrames decodes a stream of concatenated PNG images, calling fn with
+// each in turn
+func decodeFrames(r io.Reader, fn func(image.Image) error) error {
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		// Stop cleanly at the end of the stream
+		if _, err := br.Peek(1); err == io.EOF {
+			return nil
+		}
+
+		frame, err := png.Decode(br)
+		if err != nil {
+			return fmt.Errorf("failed to decode frame %d: %w", n, err)
+		}
+		if err := fn(frame); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package video
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestDecodeFrames(t *testing.T) {
+	// Concatenate three PNG frames the way ffmpeg's image2pipe does
+	var stream bytes.Buffer
+	for i := 0; i < 3; i++ {
+		img := image.NewGray(image.Rect(0, 0, 4+i, 4))
+		img.Set(0, 0, color.Gray{Y: uint8(i)})
+		if err := png.Encode(&stream, img); err != nil {
+			t.Fatalf("Failed to encode frame: %v", err)
+		}
+	}
+
+	var frames []image.Image
+	err := decodeFrames(&stream, func(frame image.Image) error {
+		frames = append(frames, frame)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("decodeFrames failed: %v", err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("Expected 3 frames, got %d", len(frames))
+	}
+	for i, frame := range frames {
+		if frame.Bounds().Dx() != 4+i {
+			t.Errorf("Frame %d: expected width %d, got %d", i, 4+i, frame.Bounds().Dx())
+		}
+	}
+}
+
+func TestDecodeFramesTruncated(t *testing.T) {
+	var stream bytes.Buffer
+	png.Encode(&stream, image.NewGray(image.Rect(0, 0, 4, 4)))
+	truncated := stream.Bytes()[:stream.Len()-8]
+
+	if err := decodeFrames(bytes.NewReader(truncated), func(image.Image) error { return nil }); err == nil {
+		t.Fatalf("Expected an error for a truncated stream")
+	}
+}
+
+func TestDecodeFramesStop(t *testing.T) {
+	var stream bytes.Buffer
+	for i := 0; i < 3; i++ {
+		png.Encode(&stream, image.NewGray(image.Rect(0, 0, 4, 4)))
+	}
+
+	// An error from the callback stops decoding at that frame
+	stop := errors.New("stop")
+	count := 0
+	err := decodeFrames(&stream, func(image.Image) error {
+		count++
+		return stop
+	})
+	if !errors.Is(err, stop) || count != 1 {
+		t.Errorf("Expected decoding to stop after 1 frame, got %d frames and %v", count, err)
+	}
+}